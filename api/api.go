@@ -2,6 +2,7 @@
 package api
 
 import (
+	stdcontext "context"
 	"fmt"
 	"net/http"
 	"sort"
@@ -13,6 +14,7 @@ import (
 	"github.com/aptly-dev/aptly/deb"
 	"github.com/aptly-dev/aptly/query"
 	"github.com/aptly-dev/aptly/task"
+	"github.com/aptly-dev/aptly/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 )
@@ -91,6 +93,52 @@ func acquireDatabase() {
 	}
 }
 
+// databaseMiddleware acquires database connection for the time of request
+// when running with -no-lock
+func databaseMiddleware(c *gin.Context) {
+	var err error
+
+	errCh := make(chan error)
+	dbRequests <- dbRequest{acquiredb, errCh}
+
+	err = <-errCh
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	released := false
+	release := func() {
+		if released {
+			return
+		}
+		released = true
+
+		dbRequests <- dbRequest{releasedb, errCh}
+		err = <-errCh
+		if err != nil {
+			AbortWithJSONError(c, 500, err)
+		}
+	}
+	c.Set(releaseDatabaseKey, release)
+
+	defer release()
+
+	c.Next()
+}
+
+// releaseDatabaseKey is key of function releasing database connection acquired by databaseMiddleware
+const releaseDatabaseKey = "releaseDatabase"
+
+// releaseRequestDatabase releases database connection acquired for the request by databaseMiddleware
+// before request is finished, so that long-running requests which don't access database (like
+// event streams) don't hold database open when running with -no-lock
+func releaseRequestDatabase(c *gin.Context) {
+	if release, ok := c.Get(releaseDatabaseKey); ok {
+		release.(func())()
+	}
+}
+
 // Should be called before database access is needed in any api call.
 // Happens per default for each api call. It is important that you run
 // runTaskInBackground to run a task which accquire database.
@@ -119,7 +167,12 @@ func releaseDatabaseConnection() error {
 
 // runs tasks in background. Acquires database connection first.
 func runTaskInBackground(name string, resources []string, proc task.Process) (task.Task, *task.ResourceConflictError) {
-	return context.TaskList().RunTaskInBackground(name, resources, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+	return runTaskWithPriority(name, resources, 0, proc)
+}
+
+// runs tasks in background with given priority. Acquires database connection first.
+func runTaskWithPriority(name string, resources []string, priority int, proc task.Process) (task.Task, *task.ResourceConflictError) {
+	return context.TaskList().RunTaskWithPriority(name, resources, priority, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
 		err := acquireDatabaseConnection()
 
 		if err != nil {
@@ -154,9 +207,17 @@ func truthy(value interface{}) bool {
 func maybeRunTaskInBackground(c *gin.Context, name string, resources []string, proc task.Process) {
 	// Run this task in background if configured globally or per-request
 	background := truthy(c.DefaultQuery("_async", strconv.FormatBool(context.Config().AsyncAPI)))
+
+	// tasks with higher priority are started first when waiting for the same resources
+	priority, err := strconv.Atoi(c.DefaultQuery("_priority", "0"))
+	if err != nil {
+		AbortWithJSONError(c, 400, fmt.Errorf("invalid _priority: %s", err))
+		return
+	}
+
 	if background {
 		log.Debug().Msg("Executing task asynchronously")
-		task, conflictErr := runTaskInBackground(name, resources, proc)
+		task, conflictErr := runTaskWithPriority(name, resources, priority, proc)
 		if conflictErr != nil {
 			AbortWithJSONError(c, 409, conflictErr)
 			return
@@ -164,12 +225,20 @@ func maybeRunTaskInBackground(c *gin.Context, name string, resources []string, p
 		c.JSON(202, task)
 	} else {
 		log.Debug().Msg("Executing task synchronously")
-		task, conflictErr := runTaskInBackground(name, resources, proc)
+		task, conflictErr := runTaskWithPriority(name, resources, priority, proc)
 		if conflictErr != nil {
 			AbortWithJSONError(c, 409, conflictErr)
 			return
 		}
 
+		// task started by step of other task is cancelled together with it
+		if _, ok := c.Request.Context().Value(subtaskRequestKey{}).(bool); ok {
+			stop := stdcontext.AfterFunc(c.Request.Context(), func() {
+				context.TaskList().CancelTaskByID(task.ID)
+			})
+			defer stop()
+		}
+
 		// wait for task to finish
 		context.TaskList().WaitForTaskByID(task.ID)
 
@@ -188,10 +257,38 @@ func maybeRunTaskInBackground(c *gin.Context, name string, resources []string, p
 	}
 }
 
+// checkEstimate verifies that estimated size of an operation doesn't exceed configured
+// confirmation threshold, unless operation was confirmed explicitly
+func checkEstimate(size int64, confirmed bool) error {
+	threshold := context.Config().EstimateConfirmThreshold
+	if threshold > 0 && size > threshold && !confirmed {
+		return fmt.Errorf("estimated size %s exceeds confirmation threshold %s, set ConfirmEstimate to proceed",
+			utils.HumanBytes(size), utils.HumanBytes(threshold))
+	}
+
+	return nil
+}
+
+// Common piece of code to show licenses of packages, optionally
+// filtered by license
+func showLicenses(c *gin.Context, reflist *deb.PackageRefList, collectionFactory *deb.CollectionFactory) {
+	report, err := deb.NewLicenseReport(reflist, collectionFactory.PackageCollection(), context.PackagePool(),
+		c.Request.URL.Query().Get("license"), nil)
+	if err != nil {
+		AbortWithJSONError(c, 500, fmt.Errorf("unable to show licenses: %s", err))
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"Packages": report,
+		"Summary":  deb.LicenseSummary(report),
+	})
+}
+
 // Common piece of code to show list of packages,
 // with searching & details if requested
 func showPackages(c *gin.Context, reflist *deb.PackageRefList, collectionFactory *deb.CollectionFactory) {
-	result := []*deb.Package{}
+	var explain *deb.QueryExplain
 
 	list, err := deb.NewPackageListFromRefList(reflist, collectionFactory.PackageCollection(), nil)
 	if err != nil {
@@ -227,12 +324,17 @@ func showPackages(c *gin.Context, reflist *deb.PackageRefList, collectionFactory
 
 		list.PrepareIndex()
 
+		q, explain = queryExplain(c, q)
 		list, err = list.Filter([]deb.PackageQuery{q}, withDeps,
 			nil, context.DependencyOptions(), architecturesList)
 		if err != nil {
 			AbortWithJSONError(c, 500, fmt.Errorf("unable to search: %s", err))
 			return
 		}
+
+		if explain != nil {
+			explain.Finish(list.Len())
+		}
 	}
 
 	// filter packages by version
@@ -265,16 +367,41 @@ func showPackages(c *gin.Context, reflist *deb.PackageRefList, collectionFactory
 		})
 	}
 
+	renderPackages(c, list, explain)
+}
+
+// renderPackages responds with list of packages, wrapped together with
+// query explanation if it was requested
+func renderPackages(c *gin.Context, list *deb.PackageList, explain *deb.QueryExplain) {
+	var packages interface{}
+
 	if c.Request.URL.Query().Get("format") == "details" {
+		result := []*deb.Package{}
 		list.ForEach(func(p *deb.Package) error {
 			result = append(result, p)
 			return nil
 		})
 
-		c.JSON(200, result)
+		packages = result
 	} else {
-		c.JSON(200, list.Strings())
+		packages = list.Strings()
 	}
+
+	if explain != nil {
+		c.JSON(200, gin.H{"Explain": explain, "Packages": packages})
+	} else {
+		c.JSON(200, packages)
+	}
+}
+
+// queryExplain instruments query if explanation was requested with explain=1
+func queryExplain(c *gin.Context, q deb.PackageQuery) (deb.PackageQuery, *deb.QueryExplain) {
+	if c.Request.URL.Query().Get("explain") != "1" {
+		return q, nil
+	}
+
+	explain := deb.NewQueryExplain(q)
+	return explain.PackageQuery(), explain
 }
 
 func AbortWithJSONError(c *gin.Context, code int, err error) *gin.Error {
@@ -2,18 +2,25 @@ package api
 
 import (
 	"bytes"
+	stdcontext "context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/aptly-dev/aptly/aptly"
 	ctx "github.com/aptly-dev/aptly/context"
+	"github.com/aptly-dev/aptly/rpc"
+	"github.com/aptly-dev/aptly/utils"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/smira/flag"
 
@@ -127,6 +134,166 @@ func (s *ApiSuite) TestGetHealthiness(c *C) {
 	c.Check(response.Body.String(), Matches, "{\"Status\":\"Aptly is healthy\"}")
 }
 
+func (s *ApiSuite) TestConfigReload(c *C) {
+	config := s.context.Config()
+	downloadRetries := config.DownloadRetries
+	defer func() {
+		c.Assert(os.WriteFile(s.configFile.Name(), []byte(`{"architectures": [], "enableMetricsEndpoint": true}`), 0644), IsNil)
+		_, err := s.context.ReloadConfig()
+		c.Assert(err, IsNil)
+		s.context.Config().DownloadRetries = downloadRetries
+	}()
+
+	c.Assert(os.WriteFile(s.configFile.Name(),
+		[]byte(`{"architectures": ["amd64"], "enableMetricsEndpoint": true, "downloadRetries": 7}`), 0644), IsNil)
+
+	response, _ := s.HTTPRequest("POST", "/api/config/reload", nil)
+	c.Check(response.Code, Equals, 200)
+
+	var result configReload
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result.Ignored, DeepEquals, []string{"architectures"})
+	c.Check(s.context.Config().DownloadRetries, Equals, 7)
+	c.Check(s.context.Config().Architectures, DeepEquals, []string{})
+
+	c.Assert(os.WriteFile(s.configFile.Name(), []byte(`{"architectures": [`), 0644), IsNil)
+
+	response, _ = s.HTTPRequest("POST", "/api/config/reload", nil)
+	c.Check(response.Code, Equals, 500)
+	c.Check(response.Body.String(), Matches, ".*error loading config file.*")
+}
+
+func (s *ApiSuite) TestConfigShowUpdate(c *C) {
+	config := s.context.Config()
+	saved := *config
+	defer func() {
+		*s.context.Config() = saved
+		c.Assert(os.WriteFile(s.configFile.Name(), []byte(`{"architectures": [], "enableMetricsEndpoint": true}`), 0644), IsNil)
+	}()
+
+	config.WebUIAccessControl = utils.ServeACL{Tokens: []string{"secret-token"}}
+
+	response, _ := s.HTTPRequest("GET", "/api/config", nil)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Not(Matches), ".*secret-token.*")
+
+	var result map[string]interface{}
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result["webUIAccessControl"], DeepEquals, map[string]interface{}{"tokens": []interface{}{utils.RedactedValue}})
+
+	response, _ = s.HTTPRequest("PATCH", "/api/config", bytes.NewBufferString(`{"downloadSpeedLimit": 1024, "skipContentsPublishing": true}`))
+	c.Check(response.Code, Equals, 200)
+	c.Check(s.context.Config().DownloadLimit, Equals, int64(1024))
+	c.Check(s.context.Config().SkipContentsPublishing, Equals, true)
+	// configuration handed out before update is not modified
+	c.Check(config.DownloadLimit, Equals, saved.DownloadLimit)
+
+	contents, err := os.ReadFile(s.configFile.Name())
+	c.Assert(err, IsNil)
+	c.Check(string(contents), Matches, `(?s).*"downloadSpeedLimit": 1024.*`)
+	c.Check(string(contents), Matches, `(?s).*"enableMetricsEndpoint": true.*`)
+
+	response, _ = s.HTTPRequest("PATCH", "/api/config", bytes.NewBufferString(`{"rootDir": "/tmp"}`))
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Matches, ".*setting rootDir could not be changed at runtime.*")
+}
+
+func (s *ApiSuite) TestCreateWithTemplate(c *C) {
+	config := s.context.Config()
+	templates := config.Templates
+	defer func() {
+		config.Templates = templates
+	}()
+
+	config.Templates = map[string]utils.ResourceTemplate{
+		"standard": {Distribution: "bookworm", Component: "contrib", VersionPolicy: "no-downgrade"}}
+
+	response, _ := s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(`{"Name": "templated", "Template": "standard"}`))
+	c.Assert(response.Code, Equals, 201)
+
+	var repo map[string]interface{}
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &repo), IsNil)
+	c.Check(repo["DefaultDistribution"], Equals, "bookworm")
+	c.Check(repo["DefaultComponent"], Equals, "contrib")
+
+	response, _ = s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(
+		`{"Name": "templated-override", "Template": "standard", "DefaultComponent": "main"}`))
+	c.Assert(response.Code, Equals, 201)
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &repo), IsNil)
+	c.Check(repo["DefaultDistribution"], Equals, "bookworm")
+	c.Check(repo["DefaultComponent"], Equals, "main")
+	c.Check(config.Templates["standard"].Component, Equals, "contrib")
+
+	response, _ = s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(`{"Name": "templated-missing", "Template": "missing"}`))
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Matches, ".*template missing not found in configuration.*")
+
+	collection := s.context.NewCollectionFactory().LocalRepoCollection()
+	for _, name := range []string{"templated", "templated-override"} {
+		localRepo, err := collection.ByName(name)
+		c.Assert(err, IsNil)
+		c.Check(collection.Drop(localRepo), IsNil)
+	}
+}
+
+func (s *ApiSuite) TestInstance(c *C) {
+	response, _ := s.HTTPRequest("GET", "/api/instance", nil)
+	c.Assert(response.Code, Equals, 200)
+
+	var result instanceInfo
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result.ID, Not(Equals), "")
+	c.Check(result.Version, Equals, "testVersion")
+	c.Check(result.Features.DatabaseBackend, Equals, "leveldb")
+	c.Check(result.Features.Metrics, Equals, true)
+	c.Check(result.Features.Experimental, DeepEquals, map[string]bool{utils.FeatureB2Publishing: false})
+	c.Check(result.Counts.LocalRepos >= 0, Equals, true)
+
+	response, _ = s.HTTPRequest("GET", "/api/instance", nil)
+	c.Assert(response.Code, Equals, 200)
+
+	var again instanceInfo
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &again), IsNil)
+	c.Check(again.ID, Equals, result.ID)
+}
+
+func (s *ApiSuite) TestStorageHealth(c *C) {
+	config := s.context.Config()
+	fsRoots := config.FileSystemPublishRoots
+	defer func() {
+		config.FileSystemPublishRoots = fsRoots
+	}()
+
+	root := c.MkDir()
+	config.FileSystemPublishRoots = map[string]utils.FileSystemPublishRoot{
+		"good": {RootDir: root}, "bad": {RootDir: filepath.Join(root, "Release")}}
+	c.Assert(os.WriteFile(filepath.Join(root, "Release"), nil, 0644), IsNil)
+
+	response, _ := s.HTTPRequest("GET", "/api/storage/health?storage=filesystem:good", nil)
+	c.Check(response.Code, Equals, 200)
+
+	var result []storageHealth
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Assert(result, HasLen, 1)
+	c.Check(result[0].Storage, Equals, "filesystem:good")
+	c.Check(result[0].Healthy, Equals, true)
+
+	response, _ = s.HTTPRequest("GET", "/api/storage/health", nil)
+	c.Check(response.Code, Equals, 503)
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Assert(result, HasLen, 2)
+	c.Check(result[0].Storage, Equals, "filesystem:bad")
+	c.Check(result[0].Healthy, Equals, false)
+	c.Check(result[0].Error, Matches, "unable to create .aptly-health: .*")
+	c.Check(result[1].Healthy, Equals, true)
+
+	response, _ = s.HTTPRequest("GET", "/api/storage/health?storage=s3:missing", nil)
+	c.Check(response.Code, Equals, 404)
+
+	response, _ = s.HTTPRequest("GET", "/api/metrics", nil)
+	c.Check(response.Body.String(), Matches, `(?s).*aptly_published_storage_healthy\{storage="filesystem:bad"\} 0.*`)
+}
+
 func (s *ApiSuite) TestGetMetrics(c *C) {
 	response, err := s.HTTPRequest("GET", "/api/metrics", nil)
 	c.Assert(err, IsNil)
@@ -139,6 +306,12 @@ func (s *ApiSuite) TestGetMetrics(c *C) {
 	c.Check(b, Matches, ".*# TYPE aptly_api_http_request_duration_seconds summary.*")
 	c.Check(b, Matches, ".*# TYPE aptly_build_info gauge.*")
 	c.Check(b, Matches, ".*aptly_build_info.*version=\"testVersion\".*")
+	c.Check(b, Matches, ".*# TYPE aptly_tasks_queued gauge.*")
+	c.Check(b, Matches, ".*# TYPE aptly_tasks_running gauge.*")
+	c.Check(b, Matches, ".*# TYPE aptly_database_size_bytes gauge.*")
+	c.Check(b, Matches, ".*# TYPE aptly_publish_duration_seconds histogram.*")
+	c.Check(b, Matches, ".*# TYPE aptly_download_bytes_total counter.*")
+	c.Check(b, Matches, ".*# TYPE aptly_download_errors_total counter.*")
 }
 
 func (s *ApiSuite) TestRepoCreate(c *C) {
@@ -150,6 +323,119 @@ func (s *ApiSuite) TestRepoCreate(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *ApiSuite) TestMultiArchNotFound(c *C) {
+	response, err := s.HTTPRequest("GET", "/api/repos/does-not-exist/multiarch", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+
+	response, err = s.HTTPRequest("GET", "/api/snapshots/does-not-exist/multiarch", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+}
+
+func (s *ApiSuite) TestLicensesNotFound(c *C) {
+	response, err := s.HTTPRequest("GET", "/api/repos/does-not-exist/licenses", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+
+	response, err = s.HTTPRequest("GET", "/api/snapshots/does-not-exist/licenses?license=MIT", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+}
+
+func (s *ApiSuite) TestVulnerabilities(c *C) {
+	response, err := s.HTTPRequest("GET", "/api/security/trackers", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+
+	response, err = s.HTTPRequest("GET", "/api/snapshots/does-not-exist/vulnerabilities?tracker=debian", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+
+	response, err = s.HTTPRequest("GET", "/api/publish/:./does-not-exist/vulnerabilities?tracker=debian", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+}
+
+func (s *ApiSuite) TestDownloads(c *C) {
+	response, err := s.HTTPRequest("GET", "/api/downloads/top?limit=5", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+
+	response, err = s.HTTPRequest("GET", "/api/downloads/top?limit=many", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 400)
+
+	response, err = s.HTTPRequest("GET", "/api/downloads/stale?days=90", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+}
+
+func (s *ApiSuite) TestGraphQL(c *C) {
+	body, err := json.Marshal(gin.H{
+		"Name": "graphql-repo",
+	})
+	c.Assert(err, IsNil)
+	_, err = s.HTTPRequest("POST", "/api/repos", bytes.NewReader(body))
+	c.Assert(err, IsNil)
+
+	body, err = json.Marshal(gin.H{
+		"query":     `query Repo($name: String!) { localRepo(name: $name) { name packageCount packages { name } } }`,
+		"variables": gin.H{"name": "graphql-repo"},
+	})
+	c.Assert(err, IsNil)
+	response, err := s.HTTPRequest("POST", "/api/graphql", bytes.NewReader(body))
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Equals, `{"data":{"localRepo":{"name":"graphql-repo","packageCount":0,"packages":[]}}}`)
+
+	response, err = s.HTTPRequest("GET", "/api/graphql?query="+url.QueryEscape("{ snapshot(name: \"does-not-exist\") { name } }"), nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `.*"errors":\[.*snapshot with name does-not-exist not found.*`)
+
+	response, err = s.HTTPRequest("GET", "/api/graphql", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 400)
+}
+
+func (s *ApiSuite) TestGRPC(c *C) {
+	server := &grpcServer{router: s.router}
+	ctx := stdcontext.Background()
+
+	_, err := server.CreateRepo(ctx, &rpc.CreateRepoRequest{Name: "grpc-repo", DefaultComponent: "contrib"})
+	if err != nil {
+		c.Check(status.Code(err), Equals, codes.AlreadyExists)
+	}
+
+	_, err = server.CreateRepo(ctx, &rpc.CreateRepoRequest{Name: "grpc-repo"})
+	c.Check(status.Code(err), Equals, codes.AlreadyExists)
+	c.Check(status.Convert(err).Message(), Matches, "local repo with name grpc-repo already exists")
+
+	repos, err := server.ListRepos(ctx, &rpc.ListReposRequest{})
+	c.Assert(err, IsNil)
+	found := false
+	for _, repo := range repos.Repos {
+		if repo.Name == "grpc-repo" {
+			found = true
+			c.Check(repo.DefaultComponent, Equals, "contrib")
+		}
+	}
+	c.Check(found, Equals, true)
+
+	_, err = server.GetTask(ctx, &rpc.GetTaskRequest{Id: 999999})
+	c.Check(status.Code(err), Equals, codes.NotFound)
+
+	_, err = server.CreateSnapshotFromRepo(ctx, &rpc.CreateSnapshotFromRepoRequest{Repo: "grpc-missing", Name: "snap"})
+	c.Check(status.Code(err), Equals, codes.NotFound)
+}
+
+func (s *ApiSuite) TestReposHoldsNotFound(c *C) {
+	response, err := s.HTTPRequest("GET", "/api/repos/does-not-exist/holds", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+}
+
 func (s *ApiSuite) TestTruthy(c *C) {
 	c.Check(truthy("no"), Equals, false)
 	c.Check(truthy("n"), Equals, false)
@@ -0,0 +1,333 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// apiRouteScopes are scopes (besides admin) allowed to modify resources under route prefix,
+// all other modifying requests are limited to admin scope
+var apiRouteScopes = []struct {
+	prefix string
+	scopes []string
+}{
+	{"/api/repos", []string{utils.APIScopeRepoAdmin}},
+	{"/api/mirrors", []string{utils.APIScopeRepoAdmin}},
+	{"/api/snapshots", []string{utils.APIScopeRepoAdmin}},
+	{"/api/files", []string{utils.APIScopeRepoAdmin}},
+	{"/api/incoming", []string{utils.APIScopeRepoAdmin}},
+	{"/api/publish", []string{utils.APIScopePublishAdmin}},
+	{"/api/tasks/:id", []string{utils.APIScopeRepoAdmin, utils.APIScopePublishAdmin}},
+	{"/api/tasks-clear", []string{utils.APIScopeRepoAdmin, utils.APIScopePublishAdmin}},
+}
+
+// apiReadRoutes are routes which don't modify anything, though not using GET method
+var apiReadRoutes = map[string]bool{
+	"POST /api/graphql": true,
+	"POST /api/publish/:prefix/:distribution/verify": true,
+}
+
+// apiAdminReadRoutes are read routes limited to admin scope
+var apiAdminReadRoutes = []string{
+	"/api/tokens",
+	"/api/replication",
+}
+
+// apiAuthToken is token request was authenticated with
+type apiAuthToken struct {
+	Name     string
+	Scope    string
+	Prefixes []string
+}
+
+// apiAuthenticate finds token (defined in configuration or managed with /api/tokens)
+// request was made with, returns nil if request isn't authenticated
+func apiAuthenticate(r *http.Request, conf *utils.APIAuthConfig) (*apiAuthToken, error) {
+	if token := conf.Authenticate(r); token != nil {
+		return &apiAuthToken{Name: token.Name, Scope: token.Scope, Prefixes: token.Prefixes}, nil
+	}
+
+	collection := context.NewCollectionFactory().APITokenCollection()
+	for _, candidate := range utils.RequestTokens(r) {
+		token, err := collection.ByToken(candidate)
+		if err == nil {
+			return &apiAuthToken{Name: token.Name, Scope: token.Scope, Prefixes: token.Prefixes}, nil
+		}
+		if err != database.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// apiReadRequest checks whether request doesn't modify anything
+func apiReadRequest(c *gin.Context) bool {
+	return c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead ||
+		apiReadRoutes[c.Request.Method+" "+c.FullPath()]
+}
+
+// apiRouteAllowedScopes returns scopes allowed to make request, admin scope is always allowed
+func apiRouteAllowedScopes(c *gin.Context) []string {
+	route := c.FullPath()
+
+	for _, prefix := range apiAdminReadRoutes {
+		if route == prefix || strings.HasPrefix(route, prefix+"/") {
+			return nil
+		}
+	}
+
+	if apiReadRequest(c) {
+		return utils.APIScopes
+	}
+
+	for _, routeScope := range apiRouteScopes {
+		if route == routeScope.prefix || strings.HasPrefix(route, routeScope.prefix+"/") {
+			return routeScope.scopes
+		}
+	}
+
+	return nil
+}
+
+// apiTokenAllowed checks that token is allowed to make request
+func apiTokenAllowed(c *gin.Context, token *apiAuthToken) error {
+	if token.Scope != utils.APIScopeAdmin && !utils.StrSliceHasItem(apiRouteAllowedScopes(c), token.Scope) {
+		return fmt.Errorf("token %s with scope %s is not allowed to %s %s", token.Name, token.Scope, c.Request.Method, c.FullPath())
+	}
+
+	if len(token.Prefixes) == 0 || !strings.HasPrefix(c.FullPath(), "/api/publish") || apiReadRequest(c) {
+		return nil
+	}
+
+	storage, prefix := deb.ParsePrefix(slashEscape(c.Params.ByName("prefix")))
+
+	for _, allowed := range token.Prefixes {
+		allowedStorage, allowedPrefix := deb.ParsePrefix(allowed)
+		if allowedStorage == storage && utils.InNamespace(allowedPrefix, prefix) {
+			return nil
+		}
+	}
+
+	if storage != "" {
+		prefix = storage + ":" + prefix
+	}
+
+	return fmt.Errorf("token %s is not allowed to modify publishing prefix %s", token.Name, prefix)
+}
+
+// apiAuthMiddleware authenticates API requests with tokens and enforces their scopes,
+// if API authentication is enabled
+//
+// If tenancy is enabled as well, requests not authenticated with API token are passed over
+// to tenancy middleware, as they might be made with tenant or admin tokens of tenancy.
+func apiAuthMiddleware(c *gin.Context) {
+	conf := context.Config().APIAuth
+	if !conf.Enabled || publicRoutes[c.FullPath()] {
+		c.Next()
+		return
+	}
+
+	if trusted, _ := c.Request.Context().Value(trustedRequestKey{}).(bool); trusted {
+		c.Next()
+		return
+	}
+
+	token, err := apiAuthenticate(c.Request, &conf)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if token == nil {
+		if context.Config().Tenancy.Enabled {
+			c.Next()
+			return
+		}
+
+		c.Header("WWW-Authenticate", `Basic realm="aptly"`)
+		AbortWithJSONError(c, http.StatusUnauthorized, fmt.Errorf("authentication required"))
+		return
+	}
+
+	if err = apiTokenAllowed(c, token); err != nil {
+		AbortWithJSONError(c, http.StatusForbidden, err)
+		return
+	}
+
+	c.Set("apiToken", token.Name)
+	c.Set("apiScope", token.Scope)
+	c.Next()
+}
+
+// adminRequest checks whether request is made with admin privileges: neither by tenant
+// nor with API token of limited scope
+func adminRequest(c *gin.Context) bool {
+	scope := c.GetString("apiScope")
+	return tenantOf(c) == "" && (scope == "" || scope == utils.APIScopeAdmin)
+}
+
+type apiTokenInfo struct {
+	// Name of the token
+	Name string `json:"Name"            example:"ci"`
+	// Scope: read-only, repo-admin, publish-admin or admin
+	Scope string `json:"Scope"          example:"publish-admin"`
+	// Published prefixes token is allowed to modify, all prefixes if empty
+	Prefixes []string `json:"Prefixes"  example:"ppa"`
+	// Token is defined in configuration file (config) or managed with API (api)
+	Source string `json:"Source"        example:"api"`
+	// Time token was created (for tokens managed with API)
+	CreatedAt *time.Time `json:"CreatedAt,omitempty"`
+}
+
+type apiTokenCreateParams struct {
+	// Name of the token
+	Name string `binding:"required" json:"Name" example:"ci"`
+	// Scope: read-only, repo-admin, publish-admin or admin
+	Scope string `binding:"required" json:"Scope" example:"publish-admin"`
+	// Published prefixes token is allowed to modify, all prefixes if empty
+	Prefixes []string `json:"Prefixes" example:"ppa"`
+}
+
+type apiTokenCreated struct {
+	apiTokenInfo
+	// Token, reported only once, as only its hash is stored
+	Token string `json:"Token" example:"5f0c7d..."`
+}
+
+// @Summary List Tokens
+// @Description **Get list of API tokens**
+// @Description
+// @Description Lists tokens defined in `apiAuth` section of configuration file and tokens created with API.
+// @Description Tokens themselves are never reported.
+// @Tags Tokens
+// @Produce json
+// @Success 200 {array} apiTokenInfo
+// @Failure 401 {object} Error "Authentication required"
+// @Failure 403 {object} Error "Admin scope required"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/tokens [get]
+func apiTokensList(c *gin.Context) {
+	result := []apiTokenInfo{}
+
+	for _, token := range context.Config().APIAuth.Tokens {
+		result = append(result, apiTokenInfo{Name: token.Name, Scope: token.Scope, Prefixes: token.Prefixes, Source: "config"})
+	}
+
+	err := context.NewCollectionFactory().APITokenCollection().ForEach(func(token *deb.APIToken) error {
+		createdAt := token.CreatedAt
+		result = append(result, apiTokenInfo{Name: token.Name, Scope: token.Scope, Prefixes: token.Prefixes,
+			Source: "api", CreatedAt: &createdAt})
+		return nil
+	})
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// @Summary Create Token
+// @Description **Create API token**
+// @Description
+// @Description Token is generated randomly and returned in response, only its hash is stored, so token
+// @Description couldn't be retrieved later. Scopes:
+// @Description * `read-only`: read requests only
+// @Description * `repo-admin`: manage local repos, mirrors, snapshots, uploaded files and incoming queue
+// @Description * `publish-admin`: manage published repositories, limited to `Prefixes` if set
+// @Description * `admin`: unrestricted access
+// @Tags Tokens
+// @Consume json
+// @Produce json
+// @Param request body apiTokenCreateParams true "Parameters"
+// @Success 201 {object} apiTokenCreated
+// @Failure 400 {object} Error "Invalid parameters"
+// @Failure 401 {object} Error "Authentication required"
+// @Failure 403 {object} Error "Admin scope required"
+// @Failure 409 {object} Error "Token already exists"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/tokens [post]
+func apiTokensCreate(c *gin.Context) {
+	var b apiTokenCreateParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	for _, token := range context.Config().APIAuth.Tokens {
+		if token.Name == b.Name {
+			AbortWithJSONError(c, http.StatusConflict, fmt.Errorf("token with name %s is defined in configuration", b.Name))
+			return
+		}
+	}
+
+	token, secret, err := deb.NewAPIToken(b.Name, b.Scope, b.Prefixes)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	collection := context.NewCollectionFactory().APITokenCollection()
+
+	if _, err = collection.ByName(b.Name); err == nil {
+		AbortWithJSONError(c, http.StatusConflict, fmt.Errorf("token with name %s already exists", b.Name))
+		return
+	}
+
+	if err = collection.Add(token); err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, apiTokenCreated{
+		apiTokenInfo: apiTokenInfo{Name: token.Name, Scope: token.Scope, Prefixes: token.Prefixes,
+			Source: "api", CreatedAt: &token.CreatedAt},
+		Token: secret,
+	})
+}
+
+// @Summary Delete Token
+// @Description **Revoke API token created with API**
+// @Tags Tokens
+// @Produce json
+// @Param name path string true "Token name"
+// @Success 200 ""
+// @Failure 400 {object} Error "Token is defined in configuration"
+// @Failure 401 {object} Error "Authentication required"
+// @Failure 403 {object} Error "Admin scope required"
+// @Failure 404 {object} Error "Token not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/tokens/{name} [delete]
+func apiTokensDrop(c *gin.Context) {
+	name := c.Params.ByName("name")
+
+	for _, token := range context.Config().APIAuth.Tokens {
+		if token.Name == name {
+			AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("token %s is defined in configuration and couldn't be deleted with API", name))
+			return
+		}
+	}
+
+	collection := context.NewCollectionFactory().APITokenCollection()
+
+	token, err := collection.ByName(name)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	if err = collection.Drop(token); err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
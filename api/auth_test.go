@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type APIAuthSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&APIAuthSuite{})
+
+func (s *APIAuthSuite) enableAPIAuth() {
+	s.context.Config().APIAuth = utils.APIAuthConfig{
+		Enabled: true,
+		Tokens: []utils.APITokenConfig{
+			{Name: "root", Token: "r00t", Scope: utils.APIScopeAdmin},
+			{Name: "dashboard", Token: "ro", Scope: utils.APIScopeReadOnly},
+			{Name: "ci", Token: "ci", Scope: utils.APIScopePublishAdmin, Prefixes: []string{"ppa"}},
+			{Name: "builder", Token: "build", Scope: utils.APIScopeRepoAdmin},
+		},
+	}
+}
+
+func (s *APIAuthSuite) disableAPIAuth() {
+	s.context.Config().APIAuth = utils.APIAuthConfig{}
+	s.context.Config().Tenancy = utils.TenancyConfig{}
+}
+
+func (s *APIAuthSuite) authRequest(method, url, token, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *APIAuthSuite) TestScopes(c *C) {
+	s.enableAPIAuth()
+	defer s.disableAPIAuth()
+
+	c.Check(s.authRequest("GET", "/api/version", "", "").Code, Equals, 200)
+	c.Check(s.authRequest("GET", "/api/repos", "", "").Code, Equals, 401)
+	c.Check(s.authRequest("GET", "/api/repos", "wrong", "").Code, Equals, 401)
+
+	for _, token := range []string{"r00t", "ro", "ci", "build"} {
+		c.Check(s.authRequest("GET", "/api/repos", token, "").Code, Equals, 200)
+		c.Check(s.authRequest("GET", "/api/tasks", token, "").Code, Equals, 200)
+	}
+
+	response := s.authRequest("POST", "/api/repos", "ro", `{"Name": "auth-test"}`)
+	c.Check(response.Code, Equals, 403)
+	c.Check(response.Body.String(), Matches, `.*token dashboard with scope read-only is not allowed to POST /api/repos.*`)
+	c.Check(s.authRequest("POST", "/api/repos", "ci", `{"Name": "auth-test"}`).Code, Equals, 403)
+	c.Check(s.authRequest("POST", "/api/repos", "build", `{"Name": "auth-test"}`).Code, Equals, 201)
+	c.Check(s.authRequest("DELETE", "/api/repos/auth-test", "build", "").Code, Equals, 200)
+
+	c.Check(s.authRequest("POST", "/api/graphql", "ro", `{"query": "{ repos { name } }"}`).Code, Not(Equals), 403)
+
+	c.Check(s.authRequest("DELETE", "/api/publish/:./wheezy", "build", "").Code, Equals, 403)
+	response = s.authRequest("DELETE", "/api/publish/:./wheezy", "ci", "")
+	c.Check(response.Code, Equals, 403)
+	c.Check(response.Body.String(), Matches, `.*token ci is not allowed to modify publishing prefix \..*`)
+	c.Check(s.authRequest("DELETE", "/api/publish/ppa/wheezy", "ci", "").Code, Equals, 404)
+	c.Check(s.authRequest("DELETE", "/api/publish/ppa_stable/wheezy", "ci", "").Code, Equals, 404)
+	c.Check(s.authRequest("DELETE", "/api/publish/ppa-other/wheezy", "ci", "").Code, Equals, 403)
+	c.Check(s.authRequest("DELETE", "/api/publish/:./wheezy", "r00t", "").Code, Equals, 404)
+
+	c.Check(s.authRequest("DELETE", "/api/tasks/1000", "ci", "").Code, Not(Equals), 403)
+	c.Check(s.authRequest("DELETE", "/api/tasks/1000", "ro", "").Code, Equals, 403)
+
+	c.Check(s.authRequest("POST", "/api/db/cleanup", "build", "").Code, Equals, 403)
+	c.Check(s.authRequest("GET", "/api/tokens", "build", "").Code, Equals, 403)
+	c.Check(s.authRequest("GET", "/api/replication/status", "ro", "").Code, Equals, 403)
+}
+
+func (s *APIAuthSuite) TestTokens(c *C) {
+	s.enableAPIAuth()
+	defer s.disableAPIAuth()
+
+	response := s.authRequest("POST", "/api/tokens", "r00t", `{"Name": "deploy", "Scope": "unknown"}`)
+	c.Check(response.Code, Equals, 400)
+	c.Check(s.authRequest("POST", "/api/tokens", "r00t", `{"Name": "ci", "Scope": "admin"}`).Code, Equals, 409)
+
+	response = s.authRequest("POST", "/api/tokens", "r00t", `{"Name": "deploy", "Scope": "repo-admin"}`)
+	c.Assert(response.Code, Equals, 201)
+	var created apiTokenCreated
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &created), IsNil)
+	c.Check(created.Token, HasLen, 64)
+	c.Check(created.Source, Equals, "api")
+
+	c.Check(s.authRequest("POST", "/api/tokens", "r00t", `{"Name": "deploy", "Scope": "admin"}`).Code, Equals, 409)
+
+	c.Check(s.authRequest("POST", "/api/repos", created.Token, `{"Name": "auth-deploy"}`).Code, Equals, 201)
+	c.Check(s.authRequest("DELETE", "/api/repos/auth-deploy", created.Token, "").Code, Equals, 200)
+	c.Check(s.authRequest("POST", "/api/tokens", created.Token, `{"Name": "escalate", "Scope": "admin"}`).Code, Equals, 403)
+
+	response = s.authRequest("GET", "/api/tokens", "r00t", "")
+	c.Assert(response.Code, Equals, 200)
+	var tokens []apiTokenInfo
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &tokens), IsNil)
+	c.Assert(tokens, HasLen, 5)
+	c.Check(tokens[4].Name, Equals, "deploy")
+	c.Check(response.Body.String(), Not(Matches), ".*"+created.Token+".*")
+	c.Check(response.Body.String(), Not(Matches), `.*r00t.*`)
+
+	c.Check(s.authRequest("DELETE", "/api/tokens/ci", "r00t", "").Code, Equals, 400)
+	c.Check(s.authRequest("DELETE", "/api/tokens/deploy", "r00t", "").Code, Equals, 200)
+	c.Check(s.authRequest("DELETE", "/api/tokens/deploy", "r00t", "").Code, Equals, 404)
+	c.Check(s.authRequest("GET", "/api/repos", created.Token, "").Code, Equals, 401)
+}
+
+func (s *APIAuthSuite) TestTenancy(c *C) {
+	s.enableAPIAuth()
+	defer s.disableAPIAuth()
+
+	s.context.Config().Tenancy = utils.TenancyConfig{
+		Enabled:     true,
+		AdminTokens: []string{"tenancy-root"},
+		Tenants:     map[string]utils.TenantConfig{"team-a": {Tokens: []string{"a-token"}}},
+	}
+
+	c.Check(s.authRequest("GET", "/api/repos", "", "").Code, Equals, 401)
+	c.Check(s.authRequest("GET", "/api/repos", "a-token", "").Code, Equals, 200)
+	c.Check(s.authRequest("GET", "/api/config", "a-token", "").Code, Equals, 403)
+	c.Check(s.authRequest("GET", "/api/config", "tenancy-root", "").Code, Equals, 200)
+	c.Check(s.authRequest("GET", "/api/config", "ro", "").Code, Equals, 200)
+	c.Check(s.authRequest("POST", "/api/repos", "ro", `{"Name": "team-a/repo"}`).Code, Equals, 403)
+}
+
+func (s *APIAuthSuite) TestScheduleActions(c *C) {
+	s.enableAPIAuth()
+	defer s.disableAPIAuth()
+
+	repo, err := deb.NewRemoteRepo("auth-scheduled", "http://127.0.0.1:1/debian/", "bookworm", []string{"main"}, []string{}, false, false, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.context.NewCollectionFactory().RemoteRepoCollection().Add(repo), IsNil)
+	defer s.context.NewCollectionFactory().RemoteRepoCollection().Drop(repo)
+	defer s.context.NewCollectionFactory().MirrorScheduleCollection().Drop(repo)
+
+	withActions := `{"Cron": "@daily", "Actions": [{"Action": "publish-update", "Distribution": "bookworm"}]}`
+
+	c.Check(s.authRequest("PUT", "/api/mirrors/auth-scheduled/schedule", "build", `{"Cron": "@daily"}`).Code, Equals, 200)
+	response := s.authRequest("PUT", "/api/mirrors/auth-scheduled/schedule", "build", withActions)
+	c.Check(response.Code, Equals, 403)
+	c.Check(response.Body.String(), Matches, ".*only admins are allowed to set actions of mirror schedule.*")
+	c.Check(s.authRequest("PUT", "/api/mirrors/auth-scheduled/schedule", "r00t", withActions).Code, Equals, 200)
+}
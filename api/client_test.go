@@ -0,0 +1,113 @@
+package api
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/client"
+
+	. "gopkg.in/check.v1"
+)
+
+type ClientSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&ClientSuite{})
+
+// jsonFields lists JSON field names of the struct
+func jsonFields(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	result := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("json")
+		if name == "" {
+			name = field.Name
+		}
+		result = append(result, fmt.Sprintf("%s %s", name, field.Type.Kind()))
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+func (s *ClientSuite) TestClientParamsInSync(c *C) {
+	c.Check(jsonFields(client.RepoCreateParams{}), DeepEquals, jsonFields(repoCreateParams{}))
+	c.Check(jsonFields(client.RepoPruneParams{}), DeepEquals, jsonFields(repoPruneParams{}))
+	c.Check(jsonFields(client.SigningParams{}), DeepEquals, jsonFields(signingParams{}))
+	c.Check(jsonFields(client.SigningKeyParams{}), DeepEquals, jsonFields(signingKeyParams{}))
+	c.Check(jsonFields(client.SourceParams{}), DeepEquals, jsonFields(sourceParams{}))
+	c.Check(jsonFields(client.PublishParams{}), DeepEquals, jsonFields(publishedRepoCreateParams{}))
+	c.Check(jsonFields(client.PublishUpdateParams{}), DeepEquals, jsonFields(publishedRepoUpdateSwitchParams{}))
+}
+
+func (s *ClientSuite) TestClient(c *C) {
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	cl, err := client.NewClient(server.URL, nil)
+	c.Assert(err, IsNil)
+
+	ctx := stdcontext.Background()
+	suffix := time.Now().UnixNano()
+
+	version, err := cl.Version(ctx)
+	c.Assert(err, IsNil)
+	c.Check(version, Equals, "testVersion")
+
+	_, err = cl.GetRepo(ctx, "client-does-not-exist")
+	c.Check(client.IsNotFound(err), Equals, true)
+
+	repoName := fmt.Sprintf("client-repo-%d", suffix)
+	repo, err := cl.CreateRepo(ctx, client.RepoCreateParams{Name: repoName, DefaultComponent: "contrib"})
+	c.Assert(err, IsNil)
+	c.Check(repo.DefaultComponent, Equals, "contrib")
+
+	uploadDir := fmt.Sprintf("client-upload-%d", suffix)
+	stored, err := cl.UploadPaths(ctx, uploadDir, "../system/files/libboost-program-options-dev_1.49.0.1_i386.deb")
+	c.Assert(err, IsNil)
+	c.Check(stored, DeepEquals, []string{uploadDir + "/libboost-program-options-dev_1.49.0.1_i386.deb"})
+
+	t, err := cl.AddUploadedPackages(ctx, repoName, uploadDir, client.RepoAddOptions{})
+	c.Assert(err, IsNil)
+
+	var addResult client.RepoAddResult
+	c.Assert(cl.Wait(ctx, t, &addResult), IsNil)
+	c.Check(addResult.FailedFiles, HasLen, 0)
+	c.Check(addResult.Report.AddedLines, HasLen, 1)
+
+	packages, err := cl.RepoPackages(ctx, repoName, "libboost-program-options-dev")
+	c.Assert(err, IsNil)
+	c.Check(packages, HasLen, 1)
+
+	snapshotName := fmt.Sprintf("client-snapshot-%d", suffix)
+	t, err = cl.CreateSnapshotFromRepo(ctx, repoName, client.SnapshotCreateParams{Name: snapshotName})
+	c.Assert(err, IsNil)
+
+	var snapshot client.Snapshot
+	c.Assert(cl.Wait(ctx, t, &snapshot), IsNil)
+	c.Check(snapshot.Name, Equals, snapshotName)
+	c.Check(snapshot.SourceKind, Equals, "local")
+
+	t, err = cl.CreateSnapshotFromRepo(ctx, repoName, client.SnapshotCreateParams{Name: snapshotName})
+	c.Assert(err, IsNil)
+	c.Check(cl.Wait(ctx, t, nil), ErrorMatches, "task .* failed: .*")
+
+	t, err = cl.DropSnapshot(ctx, snapshotName, false)
+	c.Assert(err, IsNil)
+	c.Assert(cl.Wait(ctx, t, nil), IsNil)
+
+	_, err = cl.GetSnapshot(ctx, snapshotName)
+	c.Check(client.IsNotFound(err), Equals, true)
+
+	t, err = cl.DropRepo(ctx, repoName, false)
+	c.Assert(err, IsNil)
+	c.Assert(cl.Wait(ctx, t, nil), IsNil)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+type configReload struct {
+	// Changed settings which require restart to be applied
+	Ignored []string
+}
+
+// ReloadConfig reloads configuration file, logging the result
+//
+// It is called on SIGHUP.
+func ReloadConfig() {
+	ignored, err := context.ReloadConfig()
+	if err != nil {
+		log.Error().Msgf("unable to reload configuration: %s", err)
+		return
+	}
+
+	log.Info().Msg("configuration reloaded")
+	if len(ignored) > 0 {
+		log.Warn().Msgf("changed settings require restart to be applied: %s", strings.Join(ignored, ", "))
+	}
+}
+
+// @Summary Reload Configuration
+// @Description **Reload configuration file**
+// @Description
+// @Description Settings which could be changed without restart (published storage endpoints, signing and download
+// @Description settings, access control, webhooks) are applied to new requests and tasks, running tasks are not affected.
+// @Description Other changed settings are listed in response and require restart.
+// @Tags Status
+// @Produce json
+// @Success 200 {object} configReload "Configuration reloaded"
+// @Failure 500 {object} Error "Unable to load configuration file"
+// @Router /api/config/reload [post]
+func apiConfigReload(c *gin.Context) {
+	ignored, err := context.ReloadConfig()
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	if len(ignored) > 0 {
+		log.Warn().Msgf("changed settings require restart to be applied: %s", strings.Join(ignored, ", "))
+	}
+
+	c.JSON(200, configReload{Ignored: ignored})
+}
+
+// @Summary Show Configuration
+// @Description **Show effective configuration**
+// @Description
+// @Description Configuration is returned as in configuration file (with fragments and context applied),
+// @Description secrets (passwords, keys, tokens) are replaced with `<redacted>`.
+// @Tags Status
+// @Produce json
+// @Success 200 {object} object "Configuration"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/config [get]
+func apiConfigShow(c *gin.Context) {
+	result, err := context.Config().Redacted()
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+// @Summary Update Configuration
+// @Description **Change runtime settings**
+// @Description
+// @Description Only `downloadConcurrency`, `downloadSpeedLimit`, `downloadRetries`, `skipContentsPublishing`,
+// @Description `skipBz2Publishing` and `enableZstPublishing` could be changed. New settings are applied immediately and saved to
+// @Description configuration file (to selected context, if any), other settings and layout of the file are preserved.
+// @Description Settings defined in configuration fragments (`aptly.conf.d/`) could not be changed.
+// @Tags Status
+// @Consume json
+// @Param request body object true "Settings to change"
+// @Produce json
+// @Success 200 {object} object "Configuration"
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 500 {object} Error "Unable to update configuration file"
+// @Router /api/config [patch]
+func apiConfigUpdate(c *gin.Context) {
+	var settings map[string]json.RawMessage
+
+	if c.Bind(&settings) != nil {
+		return
+	}
+
+	current := *context.Config()
+	if err := utils.ValidateRuntimeSettings(&current, settings); err != nil {
+		AbortWithJSONError(c, 400, err)
+		return
+	}
+
+	if err := context.UpdateConfig(settings); err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	apiConfigShow(c)
+}
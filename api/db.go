@@ -21,68 +21,8 @@ func apiDbCleanup(c *gin.Context) {
 		collectionFactory := context.NewCollectionFactory()
 
 		// collect information about referenced packages...
-		existingPackageRefs := deb.NewPackageRefList()
-
 		out.Printf("Loading mirrors, local repos, snapshots and published repos...")
-		err = collectionFactory.RemoteRepoCollection().ForEach(func(repo *deb.RemoteRepo) error {
-			e := collectionFactory.RemoteRepoCollection().LoadComplete(repo)
-			if e != nil {
-				return e
-			}
-			if repo.RefList() != nil {
-				existingPackageRefs = existingPackageRefs.Merge(repo.RefList(), false, true)
-			}
-
-			return nil
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		err = collectionFactory.LocalRepoCollection().ForEach(func(repo *deb.LocalRepo) error {
-			e := collectionFactory.LocalRepoCollection().LoadComplete(repo)
-			if e != nil {
-				return e
-			}
-
-			if repo.RefList() != nil {
-				existingPackageRefs = existingPackageRefs.Merge(repo.RefList(), false, true)
-			}
-
-			return nil
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		err = collectionFactory.SnapshotCollection().ForEach(func(snapshot *deb.Snapshot) error {
-			e := collectionFactory.SnapshotCollection().LoadComplete(snapshot)
-			if e != nil {
-				return e
-			}
-
-			existingPackageRefs = existingPackageRefs.Merge(snapshot.RefList(), false, true)
-
-			return nil
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		err = collectionFactory.PublishedRepoCollection().ForEach(func(published *deb.PublishedRepo) error {
-			if published.SourceKind != deb.SourceLocalRepo {
-				return nil
-			}
-			e := collectionFactory.PublishedRepoCollection().LoadComplete(published, collectionFactory)
-			if e != nil {
-				return e
-			}
-
-			for _, component := range published.Components() {
-				existingPackageRefs = existingPackageRefs.Merge(published.RefList(component), false, true)
-			}
-			return nil
-		})
+		existingPackageRefs, err := deb.ReferencedPackageRefs(collectionFactory)
 		if err != nil {
 			return nil, err
 		}
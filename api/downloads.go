@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// downloadStatsInterval is how often collected download statistics are written
+const downloadStatsInterval = 10 * time.Second
+
+// downloadsRecorder collects downloads of package files served in API mode, set up by Router
+var downloadsRecorder *deb.DownloadStatsRecorder
+
+// recordDownload queues update of download statistics after package file was served
+func recordDownload(path string) {
+	downloadsRecorder.Record(path, time.Now())
+}
+
+// writeDownloads writes batch of download statistics
+func writeDownloads(downloads []*deb.PackageDownloads) error {
+	err := acquireDatabaseConnection()
+	if err != nil {
+		return err
+	}
+	defer releaseDatabaseConnection()
+
+	_, err = context.NewCollectionFactory().DownloadStatsCollection().RecordBatch(downloads)
+	return err
+}
+
+// FlushDownloadStats writes download statistics collected so far, should be called on shutdown
+func FlushDownloadStats() {
+	if downloadsRecorder == nil {
+		return
+	}
+
+	if err := downloadsRecorder.Flush(); err != nil {
+		log.Error().Msgf("unable to record downloads: %s", err)
+	}
+}
+
+// GET /api/downloads/top
+func apiDownloadsTop(c *gin.Context) {
+	limit := 10
+
+	if value := c.Request.URL.Query().Get("limit"); value != "" {
+		var err error
+
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("wrong limit value: %#v", value))
+			return
+		}
+	}
+
+	result, err := context.NewCollectionFactory().DownloadStatsCollection().Top(limit)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GET /api/downloads/stale
+func apiDownloadsStale(c *gin.Context) {
+	days := 30
+
+	if value := c.Request.URL.Query().Get("days"); value != "" {
+		var err error
+
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 0 {
+			AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("wrong days value: %#v", value))
+			return
+		}
+	}
+
+	result, err := context.NewCollectionFactory().DownloadStatsCollection().Stale(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
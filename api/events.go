@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// eventsKeepAlive is interval of keep-alive comments sent to idle event stream
+var eventsKeepAlive = 30 * time.Second
+
+// @Summary Event Stream
+// @Description **Stream live events as server-sent events**
+// @Description
+// @Description Stream delivers events as they happen (`publish-created`, `publish-updated`, `publish-dropped`,
+// @Description `mirror-updated`, `snapshot-created`, `packages-uploaded`, task and security events), each event is sent
+// @Description as `event: <type>` with JSON `data`. Events happened before connection are not delivered.
+// @Description
+// @Description Stream might be limited to some event types with `events` parameter (comma-separated).
+// @Tags Events
+// @Param events query string false "comma-separated list of event types"
+// @Produce text/event-stream
+// @Success 200
+// @Failure 500 {object} Error "Streaming not supported"
+// @Router /api/events [get]
+func apiEvents(c *gin.Context) {
+	var types []string
+	if param := c.Query("events"); param != "" {
+		types = strings.Split(param, ",")
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	// database was needed only to authenticate request, stream could be open for a long time
+	releaseRequestDatabase(c)
+	if c.IsAborted() {
+		return
+	}
+
+	events, unsubscribe := context.Events().Subscribe()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// let client know subscription is active
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if types != nil && !utils.StrSliceHasItem(types, event.Type) {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+
+		flusher.Flush()
+	}
+}
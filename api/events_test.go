@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aptly-dev/aptly/notify"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ApiSuite) TestEvents(c *C) {
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/events?events=snapshot-created,publish-dropped")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	c.Check(resp.StatusCode, Equals, 200)
+	c.Check(resp.Header.Get("Content-Type"), Equals, "text/event-stream")
+
+	reader := bufio.NewReader(resp.Body)
+	readMessage := func() []string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			c.Assert(err, IsNil)
+			if line == "\n" {
+				return lines
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+	}
+
+	c.Check(readMessage(), DeepEquals, []string{": connected"})
+
+	s.context.Notify(notify.NewEvent(utils.NotifyEventMirrorUpdated, utils.NotifySeverityInfo,
+		"Mirror wheezy updated", "", map[string]string{"mirror": "wheezy"}), nil)
+	s.context.Notify(notify.NewEvent(utils.NotifyEventSnapshotCreated, utils.NotifySeverityInfo,
+		"Snapshot snap1 created", "", map[string]string{"snapshot": "snap1"}), nil)
+
+	message := readMessage()
+	c.Assert(message, HasLen, 2)
+	c.Check(message[0], Equals, "event: snapshot-created")
+
+	var event notify.Event
+	c.Assert(json.Unmarshal([]byte(strings.TrimPrefix(message[1], "data: ")), &event), IsNil)
+	c.Check(event.Title, Equals, "Snapshot snap1 created")
+	c.Check(event.Fields, DeepEquals, map[string]string{"snapshot": "snap1"})
+}
+
+func (s *ApiSuite) TestEventsReleaseDatabase(c *C) {
+	// count clients of database, as acquireDatabase does with -no-lock
+	requests := make(chan dbRequest)
+	var clients atomic.Int32
+	go func() {
+		for request := range requests {
+			if request.kind == acquiredb {
+				clients.Add(1)
+			} else {
+				clients.Add(-1)
+			}
+			request.err <- nil
+		}
+	}()
+
+	saved := dbRequests
+	dbRequests = requests
+	defer func() {
+		dbRequests = saved
+		close(requests)
+	}()
+
+	router := gin.New()
+	router.GET("/api/events", databaseMiddleware, apiEvents)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/events")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	c.Assert(err, IsNil)
+	c.Check(line, Equals, ": connected\n")
+
+	// stream is open, but database is not held by it
+	c.Check(clients.Load(), Equals, int32(0))
+}
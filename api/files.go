@@ -117,6 +117,7 @@ func apiFilesUpload(c *gin.Context) {
 	}
 
 	apiFilesUploadedCounter.WithLabelValues(c.Params.ByName("dir")).Inc()
+	context.PackagesUploaded(c.Params.ByName("dir"), stored)
 	c.JSON(200, stored)
 
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"mime"
+	"net/http"
 	"os"
 	"os/exec"
 
@@ -12,6 +13,44 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// @Summary Get Resource Graph
+// @Description **Get graph of relationships between mirrors, local repos, snapshots and published repositories**
+// @Description
+// @Description Nodes are resources identified by UUID, with their metadata. Edges show flow of packages: from mirrors and
+// @Description local repos to snapshots (`snapshot`), from snapshots to snapshots created by filtering or pulling (`derive`)
+// @Description or merging (`merge`), and from sources to published repositories (`publish`, with published component).
+// @Description
+// @Description With `format=dot` graph is returned in graphviz format, same as `/api/graph.dot`.
+// @Tags Graph
+// @Produce json
+// @Produce plain
+// @Param format query string false "json (default) or dot"
+// @Param layout query string false "layout of dot graph: vertical or horizontal (default)"
+// @Success 200 {object} deb.ResourceGraph
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/graph [get]
+func apiGraphData(c *gin.Context) {
+	format := c.Request.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "dot" {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("unknown format %s", format))
+		return
+	}
+
+	graph, err := deb.BuildResourceGraph(context.NewCollectionFactory())
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if format == "dot" {
+		c.String(http.StatusOK, graph.Dot(c.Request.URL.Query().Get("layout")).String())
+		return
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
+
 // GET /api/graph.:ext?layout=[vertical|horizontal(default)]
 func apiGraph(c *gin.Context) {
 	var (
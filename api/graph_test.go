@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	. "gopkg.in/check.v1"
+)
+
+type GraphSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&GraphSuite{})
+
+func (s *GraphSuite) TestGraphJSON(c *C) {
+	response, err := s.HTTPRequest("POST", "/api/repos", strings.NewReader(`{"Name": "graph-test-repo", "Comment": "graph"}`))
+	c.Assert(err, IsNil)
+	c.Assert(response.Code, Equals, 201)
+	defer s.HTTPRequest("DELETE", "/api/repos/graph-test-repo", nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/graph", nil)
+	s.router.ServeHTTP(w, req)
+	c.Assert(w.Code, Equals, 200)
+
+	var graph deb.ResourceGraph
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &graph), IsNil)
+
+	found := false
+	for _, node := range graph.Nodes {
+		if node.Name == "graph-test-repo" {
+			found = true
+			c.Check(node.Type, Equals, deb.GraphNodeRepo)
+			c.Check(node.Description, Equals, "graph")
+		}
+	}
+	c.Check(found, Equals, true)
+}
+
+func (s *GraphSuite) TestGraphDot(c *C) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/graph?format=dot&layout=vertical", nil)
+	s.router.ServeHTTP(w, req)
+	c.Check(w.Code, Equals, 200)
+	c.Check(w.Body.String(), Matches, `(?s)digraph aptly.*rankdir=LR.*`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/graph.dot", nil)
+	s.router.ServeHTTP(w, req)
+	c.Check(w.Code, Equals, 200)
+	c.Check(w.Body.String(), Matches, `(?s)digraph aptly.*`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/graph?format=svgz", nil)
+	s.router.ServeHTTP(w, req)
+	c.Check(w.Code, Equals, 400)
+}
@@ -0,0 +1,412 @@
+package api
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/query"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+)
+
+type graphQLContextKey struct{}
+
+// collectionFactory of the GraphQL request
+func graphQLFactory(p graphql.ResolveParams) *deb.CollectionFactory {
+	return p.Context.Value(graphQLContextKey{}).(*deb.CollectionFactory)
+}
+
+// graphQLPackages loads packages from reflist, optionally filtering them with query
+func graphQLPackages(p graphql.ResolveParams, reflist *deb.PackageRefList) (interface{}, error) {
+	list, err := deb.NewPackageListFromRefList(reflist, graphQLFactory(p).PackageCollection(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if queryS, ok := p.Args["query"].(string); ok && queryS != "" {
+		q, err := query.Parse(queryS)
+		if err != nil {
+			return nil, err
+		}
+
+		list.PrepareIndex()
+
+		list, err = list.Filter([]deb.PackageQuery{q}, false, nil, 0, nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to search: %s", err)
+		}
+	}
+
+	result := []*deb.Package{}
+	list.ForEach(func(p *deb.Package) error {
+		result = append(result, p)
+		return nil
+	})
+
+	return result, nil
+}
+
+var graphQLPackagesArgs = graphql.FieldConfigArgument{
+	"query": &graphql.ArgumentConfig{Type: graphql.String, Description: "package query"},
+}
+
+var graphQLNameArgs = graphql.FieldConfigArgument{
+	"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+}
+
+func graphQLStrings() *graphql.List {
+	return graphql.NewList(graphql.String)
+}
+
+func newGraphQLSchema() (graphql.Schema, error) {
+	packageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Package",
+		Fields: graphql.Fields{
+			"key": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return string(p.Source.(*deb.Package).Key("")), nil
+			}},
+			"name":         &graphql.Field{Type: graphql.String},
+			"version":      &graphql.Field{Type: graphql.String},
+			"architecture": &graphql.Field{Type: graphql.String},
+			"isSource":     &graphql.Field{Type: graphql.Boolean},
+			"field": &graphql.Field{
+				Type:        graphql.String,
+				Description: "value of control file field",
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*deb.Package).GetField(p.Args["name"].(string)), nil
+				},
+			},
+		},
+	})
+
+	mirrorType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mirror",
+		Fields: graphql.Fields{
+			"uuid":             &graphql.Field{Type: graphql.String},
+			"name":             &graphql.Field{Type: graphql.String},
+			"archiveRoot":      &graphql.Field{Type: graphql.String},
+			"distribution":     &graphql.Field{Type: graphql.String},
+			"components":       &graphql.Field{Type: graphQLStrings()},
+			"architectures":    &graphql.Field{Type: graphQLStrings()},
+			"filter":           &graphql.Field{Type: graphql.String},
+			"lastDownloadDate": &graphql.Field{Type: graphql.DateTime},
+			"packageCount": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				repo := p.Source.(*deb.RemoteRepo)
+				if err := graphQLFactory(p).RemoteRepoCollection().LoadComplete(repo); err != nil {
+					return nil, err
+				}
+				return repo.NumPackages(), nil
+			}},
+			"packages": &graphql.Field{Type: graphql.NewList(packageType), Args: graphQLPackagesArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				repo := p.Source.(*deb.RemoteRepo)
+				if err := graphQLFactory(p).RemoteRepoCollection().LoadComplete(repo); err != nil {
+					return nil, err
+				}
+				return graphQLPackages(p, repo.RefList())
+			}},
+		},
+	})
+
+	localRepoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "LocalRepo",
+		Fields: graphql.Fields{
+			"uuid":                &graphql.Field{Type: graphql.String},
+			"name":                &graphql.Field{Type: graphql.String},
+			"comment":             &graphql.Field{Type: graphql.String},
+			"defaultDistribution": &graphql.Field{Type: graphql.String},
+			"defaultComponent":    &graphql.Field{Type: graphql.String},
+			"packageCount": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				repo := p.Source.(*deb.LocalRepo)
+				if err := graphQLFactory(p).LocalRepoCollection().LoadComplete(repo); err != nil {
+					return nil, err
+				}
+				return repo.NumPackages(), nil
+			}},
+			"packages": &graphql.Field{Type: graphql.NewList(packageType), Args: graphQLPackagesArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				repo := p.Source.(*deb.LocalRepo)
+				if err := graphQLFactory(p).LocalRepoCollection().LoadComplete(repo); err != nil {
+					return nil, err
+				}
+				return graphQLPackages(p, repo.RefList())
+			}},
+		},
+	})
+
+	snapshotType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Snapshot",
+		Fields: graphql.Fields{
+			"uuid":        &graphql.Field{Type: graphql.String},
+			"name":        &graphql.Field{Type: graphql.String},
+			"createdAt":   &graphql.Field{Type: graphql.DateTime},
+			"description": &graphql.Field{Type: graphql.String},
+			"sourceKind":  &graphql.Field{Type: graphql.String},
+			"packageCount": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				snapshot := p.Source.(*deb.Snapshot)
+				if err := graphQLFactory(p).SnapshotCollection().LoadComplete(snapshot); err != nil {
+					return nil, err
+				}
+				return snapshot.NumPackages(), nil
+			}},
+			"packages": &graphql.Field{Type: graphql.NewList(packageType), Args: graphQLPackagesArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				snapshot := p.Source.(*deb.Snapshot)
+				if err := graphQLFactory(p).SnapshotCollection().LoadComplete(snapshot); err != nil {
+					return nil, err
+				}
+				return graphQLPackages(p, snapshot.RefList())
+			}},
+			"sourceMirrors": &graphql.Field{Type: graphql.NewList(mirrorType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				snapshot := p.Source.(*deb.Snapshot)
+				result := []*deb.RemoteRepo{}
+				if snapshot.SourceKind == deb.SourceRemoteRepo {
+					for _, uuid := range snapshot.SourceIDs {
+						if repo, err := graphQLFactory(p).RemoteRepoCollection().ByUUID(uuid); err == nil {
+							result = append(result, repo)
+						}
+					}
+				}
+				return result, nil
+			}},
+			"sourceLocalRepos": &graphql.Field{Type: graphql.NewList(localRepoType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				snapshot := p.Source.(*deb.Snapshot)
+				result := []*deb.LocalRepo{}
+				if snapshot.SourceKind == deb.SourceLocalRepo {
+					for _, uuid := range snapshot.SourceIDs {
+						if repo, err := graphQLFactory(p).LocalRepoCollection().ByUUID(uuid); err == nil {
+							result = append(result, repo)
+						}
+					}
+				}
+				return result, nil
+			}},
+		},
+	})
+
+	snapshotType.AddFieldConfig("sourceSnapshots", &graphql.Field{Type: graphql.NewList(snapshotType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		snapshot := p.Source.(*deb.Snapshot)
+		result := []*deb.Snapshot{}
+		if snapshot.SourceKind == deb.SourceSnapshot {
+			for _, uuid := range snapshot.SourceIDs {
+				if source, err := graphQLFactory(p).SnapshotCollection().ByUUID(uuid); err == nil {
+					result = append(result, source)
+				}
+			}
+		}
+		return result, nil
+	}})
+
+	publishedSourceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PublishedSource",
+		Fields: graphql.Fields{
+			"component": &graphql.Field{Type: graphql.String},
+			"name": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				source := p.Source.(*graphQLPublishedSource)
+				if source.snapshot != nil {
+					return source.snapshot.Name, nil
+				}
+				return source.localRepo.Name, nil
+			}},
+			"snapshot": &graphql.Field{Type: snapshotType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if snapshot := p.Source.(*graphQLPublishedSource).snapshot; snapshot != nil {
+					return snapshot, nil
+				}
+				return nil, nil
+			}},
+			"localRepo": &graphql.Field{Type: localRepoType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if repo := p.Source.(*graphQLPublishedSource).localRepo; repo != nil {
+					return repo, nil
+				}
+				return nil, nil
+			}},
+			"packageCount": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*graphQLPublishedSource).reflist.Len(), nil
+			}},
+		},
+	})
+
+	publishedType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Published",
+		Fields: graphql.Fields{
+			"uuid":          &graphql.Field{Type: graphql.String},
+			"storage":       &graphql.Field{Type: graphql.String},
+			"prefix":        &graphql.Field{Type: graphql.String},
+			"distribution":  &graphql.Field{Type: graphql.String},
+			"origin":        &graphql.Field{Type: graphql.String},
+			"label":         &graphql.Field{Type: graphql.String},
+			"suite":         &graphql.Field{Type: graphql.String},
+			"codename":      &graphql.Field{Type: graphql.String},
+			"sourceKind":    &graphql.Field{Type: graphql.String},
+			"architectures": &graphql.Field{Type: graphQLStrings()},
+			"sources": &graphql.Field{Type: graphql.NewList(publishedSourceType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphQLPublishedSources(graphQLFactory(p), p.Source.(*deb.PublishedRepo))
+			}},
+		},
+	})
+
+	taskType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Task",
+		Fields: graphql.Fields{
+			"id":   &graphql.Field{Type: graphql.Int},
+			"name": &graphql.Field{Type: graphql.String},
+			"state": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphQLTaskStates[p.Source.(task.Task).State], nil
+			}},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"mirrors": &graphql.Field{Type: graphql.NewList(mirrorType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				result := []*deb.RemoteRepo{}
+				err := graphQLFactory(p).RemoteRepoCollection().ForEach(func(repo *deb.RemoteRepo) error {
+					result = append(result, repo)
+					return nil
+				})
+				sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+				return result, err
+			}},
+			"mirror": &graphql.Field{Type: mirrorType, Args: graphQLNameArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphQLFactory(p).RemoteRepoCollection().ByName(p.Args["name"].(string))
+			}},
+			"localRepos": &graphql.Field{Type: graphql.NewList(localRepoType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				result := []*deb.LocalRepo{}
+				err := graphQLFactory(p).LocalRepoCollection().ForEach(func(repo *deb.LocalRepo) error {
+					result = append(result, repo)
+					return nil
+				})
+				sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+				return result, err
+			}},
+			"localRepo": &graphql.Field{Type: localRepoType, Args: graphQLNameArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphQLFactory(p).LocalRepoCollection().ByName(p.Args["name"].(string))
+			}},
+			"snapshots": &graphql.Field{Type: graphql.NewList(snapshotType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				result := []*deb.Snapshot{}
+				err := graphQLFactory(p).SnapshotCollection().ForEach(func(snapshot *deb.Snapshot) error {
+					result = append(result, snapshot)
+					return nil
+				})
+				sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+				return result, err
+			}},
+			"snapshot": &graphql.Field{Type: snapshotType, Args: graphQLNameArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphQLFactory(p).SnapshotCollection().ByName(p.Args["name"].(string))
+			}},
+			"published": &graphql.Field{Type: graphql.NewList(publishedType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				result := []*deb.PublishedRepo{}
+				err := graphQLFactory(p).PublishedRepoCollection().ForEach(func(published *deb.PublishedRepo) error {
+					result = append(result, published)
+					return nil
+				})
+				return result, err
+			}},
+			"tasks": &graphql.Field{Type: graphql.NewList(taskType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return context.TaskList().GetTasks(), nil
+			}},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+var graphQLTaskStates = map[task.State]string{
+	task.IDLE:      "IDLE",
+	task.RUNNING:   "RUNNING",
+	task.SUCCEEDED: "SUCCEEDED",
+	task.FAILED:    "FAILED",
+}
+
+// graphQLPublishedSource is a component of published repository with its source
+type graphQLPublishedSource struct {
+	Component string
+	snapshot  *deb.Snapshot
+	localRepo *deb.LocalRepo
+	reflist   *deb.PackageRefList
+}
+
+func graphQLPublishedSources(collectionFactory *deb.CollectionFactory, published *deb.PublishedRepo) ([]*graphQLPublishedSource, error) {
+	err := collectionFactory.PublishedRepoCollection().LoadComplete(published, collectionFactory)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*graphQLPublishedSource{}
+
+	for _, component := range published.Components() {
+		source := &graphQLPublishedSource{Component: component, reflist: published.RefList(component)}
+
+		if published.SourceKind == deb.SourceSnapshot {
+			source.snapshot, err = collectionFactory.SnapshotCollection().ByUUID(published.Sources[component])
+		} else {
+			source.localRepo, err = collectionFactory.LocalRepoCollection().ByUUID(published.Sources[component])
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, source)
+	}
+
+	return result, nil
+}
+
+var graphQLSchema graphql.Schema
+
+func init() {
+	var err error
+
+	graphQLSchema, err = newGraphQLSchema()
+	if err != nil {
+		panic(err)
+	}
+}
+
+type graphQLParams struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// @Summary GraphQL Query
+// @Description **Query mirrors, local repos, snapshots, published repositories and tasks with GraphQL**
+// @Description
+// @Description Nested data (e.g. published repositories with their source snapshots and package counts) could be fetched in one request.
+// @Tags Status
+// @Consume json
+// @Param request body graphQLParams true "Parameters"
+// @Produce json
+// @Success 200 {object} object "GraphQL result"
+// @Failure 400 {object} Error "Bad Request"
+// @Router /api/graphql [post]
+func apiGraphQL(c *gin.Context) {
+	var b graphQLParams
+
+	if c.Request.Method == http.MethodGet {
+		b.Query = c.Request.URL.Query().Get("query")
+		b.OperationName = c.Request.URL.Query().Get("operationName")
+	} else if c.Bind(&b) != nil {
+		return
+	}
+
+	if b.Query == "" {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("query is required"))
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphQLSchema,
+		RequestString:  b.Query,
+		VariableValues: b.Variables,
+		OperationName:  b.OperationName,
+		Context:        stdcontext.WithValue(c.Request.Context(), graphQLContextKey{}, context.NewCollectionFactory()),
+	})
+
+	c.JSON(http.StatusOK, result)
+}
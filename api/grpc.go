@@ -0,0 +1,345 @@
+package api
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/rpc"
+	"github.com/aptly-dev/aptly/task"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements gRPC API on top of REST API handlers, so that
+// both APIs share locking, background tasks and validation
+type grpcServer struct {
+	rpc.UnimplementedAptlyServer
+
+	router http.Handler
+}
+
+// NewGRPCServer creates gRPC server which serves requests with REST API router
+func NewGRPCServer(router http.Handler, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	rpc.RegisterAptlyServer(server, &grpcServer{router: router})
+
+	return server
+}
+
+// bufferedResponse collects response of REST API handler
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *bufferedResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *bufferedResponse) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
+
+func (r *bufferedResponse) WriteHeader(code int) {
+	r.code = code
+}
+
+func grpcCode(httpCode int) codes.Code {
+	switch httpCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	}
+
+	return codes.Internal
+}
+
+// call runs REST API request, decoding JSON response into result
+func (s *grpcServer) call(ctx stdcontext.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// credentials are passed as "authorization" metadata, same as HTTP header
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+		req.Header.Set("Authorization", md.Get("authorization")[0])
+	}
+
+	response := &bufferedResponse{header: http.Header{}, code: http.StatusOK}
+	s.router.ServeHTTP(response, req)
+
+	if response.code >= 400 {
+		var apiErr Error
+		if json.Unmarshal(response.body.Bytes(), &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = http.StatusText(response.code)
+		}
+		return status.Error(grpcCode(response.code), apiErr.Error)
+	}
+
+	if result != nil {
+		if err = json.Unmarshal(response.body.Bytes(), result); err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("unable to decode response: %s", err))
+		}
+	}
+
+	return nil
+}
+
+// callTask runs REST API request in background, returning started task
+func (s *grpcServer) callTask(ctx stdcontext.Context, method, path string, body interface{}) (*rpc.Task, error) {
+	var result task.Task
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	if err := s.call(ctx, method, path+separator+"_async=1", body, &result); err != nil {
+		return nil, err
+	}
+
+	return grpcTask(&result), nil
+}
+
+func grpcTask(t *task.Task) *rpc.Task {
+	return &rpc.Task{Id: int64(t.ID), Name: t.Name, State: rpc.TaskState(t.State)}
+}
+
+type grpcRepo struct {
+	Name                string
+	Comment             string
+	DefaultDistribution string
+	DefaultComponent    string
+}
+
+func (r *grpcRepo) proto() *rpc.Repo {
+	return &rpc.Repo{
+		Name:                r.Name,
+		Comment:             r.Comment,
+		DefaultDistribution: r.DefaultDistribution,
+		DefaultComponent:    r.DefaultComponent,
+	}
+}
+
+func (s *grpcServer) ListRepos(ctx stdcontext.Context, _ *rpc.ListReposRequest) (*rpc.ListReposResponse, error) {
+	var repos []grpcRepo
+
+	if err := s.call(ctx, http.MethodGet, "/api/repos", nil, &repos); err != nil {
+		return nil, err
+	}
+
+	result := &rpc.ListReposResponse{}
+	for i := range repos {
+		result.Repos = append(result.Repos, repos[i].proto())
+	}
+
+	return result, nil
+}
+
+func (s *grpcServer) CreateRepo(ctx stdcontext.Context, req *rpc.CreateRepoRequest) (*rpc.Repo, error) {
+	var repo grpcRepo
+
+	err := s.call(ctx, http.MethodPost, "/api/repos", repoCreateParams{
+		Name:                req.Name,
+		Comment:             req.Comment,
+		DefaultDistribution: req.DefaultDistribution,
+		DefaultComponent:    req.DefaultComponent,
+	}, &repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.proto(), nil
+}
+
+func (s *grpcServer) DropRepo(ctx stdcontext.Context, req *rpc.DropRepoRequest) (*rpc.Task, error) {
+	path := "/api/repos/" + url.PathEscape(req.Name)
+	if req.Force {
+		path += "?force=1"
+	}
+
+	return s.callTask(ctx, http.MethodDelete, path, nil)
+}
+
+func (s *grpcServer) ListSnapshots(ctx stdcontext.Context, _ *rpc.ListSnapshotsRequest) (*rpc.ListSnapshotsResponse, error) {
+	var snapshots []struct {
+		Name        string
+		Description string
+		CreatedAt   time.Time
+	}
+
+	if err := s.call(ctx, http.MethodGet, "/api/snapshots", nil, &snapshots); err != nil {
+		return nil, err
+	}
+
+	result := &rpc.ListSnapshotsResponse{}
+	for _, snapshot := range snapshots {
+		result.Snapshots = append(result.Snapshots, &rpc.Snapshot{
+			Name:        snapshot.Name,
+			Description: snapshot.Description,
+			CreatedAt:   snapshot.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return result, nil
+}
+
+func (s *grpcServer) CreateSnapshotFromRepo(ctx stdcontext.Context, req *rpc.CreateSnapshotFromRepoRequest) (*rpc.Task, error) {
+	return s.callTask(ctx, http.MethodPost, "/api/repos/"+url.PathEscape(req.Repo)+"/snapshots", map[string]string{
+		"Name":        req.Name,
+		"Description": req.Description,
+	})
+}
+
+func (s *grpcServer) ListPublished(ctx stdcontext.Context, _ *rpc.ListPublishedRequest) (*rpc.ListPublishedResponse, error) {
+	var published []struct {
+		Storage       string
+		Prefix        string
+		Distribution  string
+		SourceKind    string
+		Sources       []sourceParams
+		Architectures []string
+	}
+
+	if err := s.call(ctx, http.MethodGet, "/api/publish", nil, &published); err != nil {
+		return nil, err
+	}
+
+	result := &rpc.ListPublishedResponse{}
+	for _, p := range published {
+		item := &rpc.Published{
+			Storage:       p.Storage,
+			Prefix:        p.Prefix,
+			Distribution:  p.Distribution,
+			SourceKind:    p.SourceKind,
+			Architectures: p.Architectures,
+		}
+		for _, source := range p.Sources {
+			item.Sources = append(item.Sources, &rpc.PublishedSource{Component: source.Component, Name: source.Name})
+		}
+		result.Published = append(result.Published, item)
+	}
+
+	return result, nil
+}
+
+// slashEncode is reverse of slashEscape: encodes path for use in URL
+func slashEncode(path string) string {
+	return strings.Replace(strings.Replace(path, "_", "__", -1), "/", "_", -1)
+}
+
+func (s *grpcServer) UpdatePublished(ctx stdcontext.Context, req *rpc.UpdatePublishedRequest) (*rpc.Task, error) {
+	prefix := req.Prefix
+	if prefix == "" {
+		prefix = "."
+	}
+
+	b := publishedRepoUpdateSwitchParams{ForceOverwrite: req.ForceOverwrite}
+	b.Signing.Skip = req.SkipSigning
+	for _, snapshot := range req.Snapshots {
+		b.Snapshots = append(b.Snapshots, sourceParams{Component: snapshot.Component, Name: snapshot.Name})
+	}
+
+	return s.callTask(ctx, http.MethodPut, "/api/publish/"+url.PathEscape(req.Storage+":"+slashEncode(prefix))+
+		"/"+url.PathEscape(slashEncode(req.Distribution)), b)
+}
+
+func (s *grpcServer) ListTasks(ctx stdcontext.Context, _ *rpc.ListTasksRequest) (*rpc.ListTasksResponse, error) {
+	var tasks []task.Task
+
+	if err := s.call(ctx, http.MethodGet, "/api/tasks", nil, &tasks); err != nil {
+		return nil, err
+	}
+
+	result := &rpc.ListTasksResponse{}
+	for i := range tasks {
+		result.Tasks = append(result.Tasks, grpcTask(&tasks[i]))
+	}
+
+	return result, nil
+}
+
+func (s *grpcServer) GetTask(ctx stdcontext.Context, req *rpc.GetTaskRequest) (*rpc.Task, error) {
+	var t task.Task
+
+	if err := s.call(ctx, http.MethodGet, fmt.Sprintf("/api/tasks/%d", req.Id), nil, &t); err != nil {
+		return nil, err
+	}
+
+	return grpcTask(&t), nil
+}
+
+// grpcWatchInterval is how often task output is polled when streaming it
+var grpcWatchInterval = 500 * time.Millisecond
+
+func (s *grpcServer) WatchTask(req *rpc.WatchTaskRequest, stream rpc.Aptly_WatchTaskServer) error {
+	ctx := stream.Context()
+	sent := 0
+
+	for {
+		t, err := s.GetTask(ctx, &rpc.GetTaskRequest{Id: req.Id})
+		if err != nil {
+			return err
+		}
+
+		var output string
+		if err = s.call(ctx, http.MethodGet, fmt.Sprintf("/api/tasks/%d/output", req.Id), nil, &output); err != nil {
+			return err
+		}
+
+		finished := t.State == rpc.TaskState_TASK_STATE_SUCCEEDED || t.State == rpc.TaskState_TASK_STATE_FAILED
+
+		if len(output) > sent || finished {
+			progress := &rpc.TaskProgress{Task: t}
+			if len(output) > sent {
+				progress.Output = output[sent:]
+				sent = len(output)
+			}
+
+			if err = stream.Send(progress); err != nil {
+				return err
+			}
+		}
+
+		if finished {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(grpcWatchInterval):
+		}
+	}
+}
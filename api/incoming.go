@@ -0,0 +1,436 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/query"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List Incoming Uploads
+// @Description **Get list of uploads in incoming queue, in order of submission**
+// @Tags Incoming
+// @Produce json
+// @Param state query string false "filter by state: pending, approved or rejected"
+// @Success 200 {array} deb.IncomingItem
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/incoming [get]
+func apiIncomingList(c *gin.Context) {
+	state := c.Request.URL.Query().Get("state")
+
+	result := []*deb.IncomingItem{}
+	err := context.NewCollectionFactory().IncomingCollection().ForEach(func(item *deb.IncomingItem) error {
+		if state == "" || item.State == state {
+			result = append(result, item)
+		}
+		return nil
+	})
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type incomingQueueParams struct {
+	// Upload directory with .changes files
+	Dir string `binding:"required" json:"Dir"           example:"upload-1"`
+	// Queue single .changes file from the directory, all .changes files if empty
+	File string `                  json:"File"          example:"hello_1.0_amd64.changes"`
+	// Don't remove queued files from upload directory
+	NoRemoveFiles bool `           json:"NoRemoveFiles" example:"false"`
+}
+
+// @Summary Queue Uploads
+// @Description **Put .changes files with referenced files from upload directory into incoming queue for review**
+// @Description
+// @Description Checksums of referenced files are verified. Signature of .changes file is verified and the result
+// @Description is recorded, unsigned uploads are queued as well. Checks configured in `incoming` section of
+// @Description configuration are run for every queued upload.
+// @Tags Incoming
+// @Consume json
+// @Param request body incomingQueueParams true "Parameters"
+// @Produce json
+// @Success 200 {object} incomingQueueResult
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/incoming [post]
+func apiIncomingQueue(c *gin.Context) {
+	var b incomingQueueParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	b.Dir = utils.SanitizePath(b.Dir)
+	b.File = utils.SanitizePath(b.File)
+	if !verifyPath(b.Dir) || (b.File != "" && !verifyPath(b.File)) {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("wrong dir or file"))
+		return
+	}
+
+	source := filepath.Join(context.UploadPath(), b.Dir, b.File)
+	collection := context.NewCollectionFactory().IncomingCollection()
+
+	resources := []string{source}
+	taskName := fmt.Sprintf("Queue uploads from %s for review", filepath.Join(b.Dir, b.File))
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		reporter := &aptly.RecordingResultReporter{
+			Warnings:     []string{},
+			AddedLines:   []string{},
+			RemovedLines: []string{},
+		}
+
+		changesFiles, failedFiles := deb.CollectChangesFiles([]string{source}, reporter)
+		if failedFiles == nil {
+			failedFiles = []string{}
+		}
+
+		result := &incomingQueueResult{Items: []*deb.IncomingItem{}}
+
+		for _, path := range changesFiles {
+			item, err := deb.QueueChangesFile(path, context.IncomingPath(), b.NoRemoveFiles, context.GetVerifier())
+			if err != nil {
+				reporter.Warning("unable to queue file %s: %s", filepath.Base(path), err)
+				failedFiles = append(failedFiles, path)
+				continue
+			}
+
+			item.RunChecks(context.IncomingPath(), context.Config().Incoming.Checks)
+
+			err = collection.Add(item)
+			if err != nil {
+				item.RemoveFiles(context.IncomingPath())
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+			}
+
+			out.Printf("Queued %s as %s\n", item, item.ID)
+			reporter.Added("%s queued as %s", item, item.ID)
+			result.Items = append(result.Items, item)
+		}
+
+		if !b.NoRemoveFiles && b.File == "" {
+			// attempt to remove dir, if it fails, that's fine: probably it's not empty
+			os.Remove(filepath.Join(context.UploadPath(), b.Dir))
+		}
+
+		result.Report = reporter
+		result.FailedFiles = failedFiles
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: result}, nil
+	})
+}
+
+type incomingQueueResult struct {
+	// Queued uploads
+	Items []*deb.IncomingItem
+	// Report of queued and failed files
+	Report *aptly.RecordingResultReporter
+	// Files which couldn't be queued
+	FailedFiles []string
+}
+
+// loadIncomingItem looks up upload in incoming queue by ID from request
+func loadIncomingItem(c *gin.Context, collectionFactory *deb.CollectionFactory) (*deb.IncomingItem, bool) {
+	item, err := collectionFactory.IncomingCollection().ByID(c.Params.ByName("id"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	return item, true
+}
+
+// loadPendingIncomingItem looks up upload in incoming queue, checking that it's still pending review
+func loadPendingIncomingItem(c *gin.Context, collectionFactory *deb.CollectionFactory) (*deb.IncomingItem, bool) {
+	item, ok := loadIncomingItem(c, collectionFactory)
+	if !ok {
+		return nil, false
+	}
+
+	if item.State != deb.IncomingStatePending {
+		AbortWithJSONError(c, http.StatusConflict, fmt.Errorf("upload %s is already %s", item.ID, item.State))
+		return nil, false
+	}
+
+	return item, true
+}
+
+// @Summary Show Incoming Upload
+// @Description **Get details of upload in incoming queue: fields of .changes file, files, signature and check results**
+// @Tags Incoming
+// @Produce json
+// @Param id path string true "upload ID"
+// @Success 200 {object} deb.IncomingItem
+// @Failure 404 {object} Error "Upload not found"
+// @Router /api/incoming/{id} [get]
+func apiIncomingShow(c *gin.Context) {
+	item, ok := loadIncomingItem(c, context.NewCollectionFactory())
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// @Summary Re-run Checks
+// @Description **Run checks configured in `incoming` section of configuration again for pending upload**
+// @Tags Incoming
+// @Produce json
+// @Param id path string true "upload ID"
+// @Success 200 {object} deb.IncomingItem
+// @Failure 404 {object} Error "Upload not found"
+// @Failure 409 {object} Error "Upload is not pending"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/incoming/{id}/checks [post]
+func apiIncomingChecks(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+
+	item, ok := loadPendingIncomingItem(c, collectionFactory)
+	if !ok {
+		return
+	}
+
+	resources := []string{string(item.Key())}
+	maybeRunTaskInBackground(c, fmt.Sprintf("Run checks for upload %s", item), resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		item.RunChecks(context.IncomingPath(), context.Config().Incoming.Checks)
+
+		err := collectionFactory.IncomingCollection().Update(item)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: item}, nil
+	})
+}
+
+type incomingApproveParams struct {
+	// Local repository to include packages into, could be a template referencing fields of .changes file like `{{.Distribution}}`
+	Repo string `binding:"required" json:"Repo"            example:"unstable"`
+	// Replace packages with the same name, version and architecture, but different contents
+	ForceReplace bool `             json:"ForceReplace"    example:"false"`
+	// Accept unsigned .changes file
+	AcceptUnsigned bool `           json:"AcceptUnsigned"  example:"false"`
+	// Don't verify signature of .changes file
+	IgnoreSignature bool `          json:"IgnoreSignature" example:"false"`
+	// Approve even if some of the checks failed
+	IgnoreChecks bool `             json:"IgnoreChecks"    example:"false"`
+	// Reason recorded for the upload
+	Reason string `                 json:"Reason"          example:"reviewed by release team"`
+}
+
+// @Summary Approve Upload
+// @Description **Include packages from pending upload into local repository**
+// @Description
+// @Description Upload is rejected with 409 if some of the checks failed, unless `IgnoreChecks` is set.
+// @Description Signature of .changes file is verified again, unless `AcceptUnsigned` or `IgnoreSignature` is set.
+// @Description Files of the upload are removed from the queue once approved.
+// @Tags Incoming
+// @Consume json
+// @Param id path string true "upload ID"
+// @Param request body incomingApproveParams true "Parameters"
+// @Produce json
+// @Success 200 {object} incomingApproveResult
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 404 {object} Error "Upload or repository not found"
+// @Failure 409 {object} Error "Upload is not pending or checks failed"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/incoming/{id}/approve [post]
+func apiIncomingApprove(c *gin.Context) {
+	var b incomingApproveParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+
+	item, ok := loadPendingIncomingItem(c, collectionFactory)
+	if !ok {
+		return
+	}
+
+	if !b.IgnoreChecks && !item.ChecksPassed() {
+		AbortWithJSONError(c, http.StatusConflict, fmt.Errorf("some checks failed for upload %s", item.ID))
+		return
+	}
+
+	repoTemplate, err := template.New("repo").Parse(b.Repo)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("error parsing repo template: %s", err))
+		return
+	}
+
+	resources := []string{string(item.Key())}
+	if len(repoTemplate.Tree.Root.Nodes) > 1 {
+		resources = append(resources, task.AllLocalReposResourcesKey)
+	} else {
+		repo, err := collectionFactory.LocalRepoCollection().ByName(b.Repo)
+		if err != nil {
+			AbortWithJSONError(c, http.StatusNotFound, err)
+			return
+		}
+
+		resources = append(resources, string(repo.Key()))
+	}
+
+	taskName := fmt.Sprintf("Approve upload %s into repo matching template %s", item, b.Repo)
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		reporter := &aptly.RecordingResultReporter{
+			Warnings:     []string{},
+			AddedLines:   []string{},
+			RemovedLines: []string{},
+		}
+
+		changesPath := item.ChangesPath(context.IncomingPath())
+
+		_, failedFiles, err := deb.ImportChangesFiles(
+			[]string{changesPath}, reporter, b.AcceptUnsigned, b.IgnoreSignature, b.ForceReplace, false, true, context.GetVerifier(),
+			repoTemplate, out, collectionFactory.LocalRepoCollection(), collectionFactory.PackageCollection(),
+			context.PackagePool(), collectionFactory.ChecksumCollection, nil, query.Parse,
+			func(repo *deb.LocalRepo, files []string) { context.PackagesAdded(repo, files, out) })
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to import changes file: %s", err)
+		}
+
+		if failedFiles == nil {
+			failedFiles = []string{}
+		}
+
+		for _, path := range failedFiles {
+			if path == changesPath {
+				return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil},
+					fmt.Errorf("unable to import upload %s: %s", item.ID, strings.Join(reporter.Warnings, ", "))
+			}
+		}
+
+		item.State = deb.IncomingStateApproved
+		item.ReviewedAt = time.Now()
+		item.Repo = b.Repo
+		item.Reason = b.Reason
+
+		err = collectionFactory.IncomingCollection().Update(item)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+		}
+
+		err = item.RemoveFiles(context.IncomingPath())
+		if err != nil {
+			reporter.Warning("unable to remove files of upload %s: %s", item.ID, err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: &incomingApproveResult{
+			Item:        item,
+			Report:      reporter,
+			FailedFiles: failedFiles,
+		}}, nil
+	})
+}
+
+type incomingApproveResult struct {
+	// Approved upload
+	Item *deb.IncomingItem
+	// Report of added and removed packages
+	Report *aptly.RecordingResultReporter
+	// Files which couldn't be included
+	FailedFiles []string
+}
+
+type incomingRejectParams struct {
+	// Reason recorded for the upload
+	Reason string `json:"Reason" example:"fails to build on arm64"`
+}
+
+// @Summary Reject Upload
+// @Description **Reject pending upload, removing its files from the queue**
+// @Description
+// @Description Record of the upload with the reason is kept in the queue until deleted.
+// @Tags Incoming
+// @Consume json
+// @Param id path string true "upload ID"
+// @Param request body incomingRejectParams false "Parameters"
+// @Produce json
+// @Success 200 {object} deb.IncomingItem
+// @Failure 404 {object} Error "Upload not found"
+// @Failure 409 {object} Error "Upload is not pending"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/incoming/{id}/reject [post]
+func apiIncomingReject(c *gin.Context) {
+	var b incomingRejectParams
+
+	if c.Request.ContentLength != 0 && c.Bind(&b) != nil {
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+
+	item, ok := loadPendingIncomingItem(c, collectionFactory)
+	if !ok {
+		return
+	}
+
+	resources := []string{string(item.Key())}
+	maybeRunTaskInBackground(c, fmt.Sprintf("Reject upload %s", item), resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		item.State = deb.IncomingStateRejected
+		item.ReviewedAt = time.Now()
+		item.Reason = b.Reason
+
+		err := collectionFactory.IncomingCollection().Update(item)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+		}
+
+		err = item.RemoveFiles(context.IncomingPath())
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to remove files: %s", err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: item}, nil
+	})
+}
+
+// @Summary Delete Incoming Upload
+// @Description **Remove upload from incoming queue together with its files**
+// @Description
+// @Description Pending uploads are withdrawn without review.
+// @Tags Incoming
+// @Produce json
+// @Param id path string true "upload ID"
+// @Success 200
+// @Failure 404 {object} Error "Upload not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/incoming/{id} [delete]
+func apiIncomingDelete(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+
+	item, ok := loadIncomingItem(c, collectionFactory)
+	if !ok {
+		return
+	}
+
+	resources := []string{string(item.Key())}
+	maybeRunTaskInBackground(c, fmt.Sprintf("Delete upload %s", item), resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		err := item.RemoveFiles(context.IncomingPath())
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to remove files: %s", err)
+		}
+
+		err = collectionFactory.IncomingCollection().Drop(item)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to drop from DB: %s", err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{}}, nil
+	})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type IncomingSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&IncomingSuite{})
+
+func (s *IncomingSuite) queue(c *C, dir string) *deb.IncomingItem {
+	uploadDir := filepath.Join(s.context.UploadPath(), dir)
+	c.Assert(os.MkdirAll(uploadDir, 0755), IsNil)
+
+	for _, name := range []string{"hardlink_0.2.1_amd64.changes", "hardlink_0.2.1.dsc", "hardlink_0.2.1.tar.gz",
+		"hardlink_0.2.1_amd64.deb", "hardlink_0.2.0_i386.deb", "hardlink_0.2.1_amd64.buildinfo"} {
+		c.Assert(utils.CopyFile(filepath.Join("../deb/testdata/changes", name), filepath.Join(uploadDir, name)), IsNil)
+	}
+
+	response, err := s.HTTPRequest("POST", "/api/incoming", bytes.NewBufferString(fmt.Sprintf(`{"Dir": "%s"}`, dir)))
+	c.Assert(err, IsNil)
+	c.Assert(response.Code, Equals, 200)
+
+	var result incomingQueueResult
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Assert(result.Items, HasLen, 1)
+	c.Check(result.FailedFiles, HasLen, 0)
+
+	_, err = os.Stat(uploadDir)
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	return result.Items[0]
+}
+
+func (s *IncomingSuite) TestIncomingQueue(c *C) {
+	suffix := time.Now().UnixNano()
+	repoName := fmt.Sprintf("incoming-repo-%d", suffix)
+
+	collectionFactory := s.context.NewCollectionFactory()
+	repo := deb.NewLocalRepo(repoName, "")
+	c.Assert(collectionFactory.LocalRepoCollection().Add(repo), IsNil)
+	defer collectionFactory.LocalRepoCollection().Drop(repo)
+
+	s.context.Config().Incoming = utils.IncomingConfig{Checks: []utils.IncomingCheck{{Name: "fail", Command: []string{"false"}}}}
+	defer func() { s.context.Config().Incoming = utils.IncomingConfig{} }()
+
+	item := s.queue(c, fmt.Sprintf("incoming-%d", suffix))
+	defer s.HTTPRequest("DELETE", "/api/incoming/"+item.ID, nil)
+
+	c.Check(item.Source, Equals, "hardlink")
+	c.Check(item.State, Equals, deb.IncomingStatePending)
+	c.Check(item.Checks, DeepEquals, []deb.IncomingCheckResult{{Name: "fail", Passed: false, Output: ""}})
+
+	approve := fmt.Sprintf(`{"Repo": "%s", "AcceptUnsigned": true}`, repoName)
+
+	response, _ := s.HTTPRequest("POST", "/api/incoming/"+item.ID+"/approve", bytes.NewBufferString(approve))
+	c.Check(response.Code, Equals, 409)
+
+	s.context.Config().Incoming = utils.IncomingConfig{}
+	response, _ = s.HTTPRequest("POST", "/api/incoming/"+item.ID+"/checks", nil)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `.*"Checks":\[\].*`)
+
+	response, _ = s.HTTPRequest("POST", "/api/incoming/"+item.ID+"/approve", bytes.NewBufferString(`{"Repo": "no-such-repo"}`))
+	c.Check(response.Code, Equals, 404)
+
+	response, _ = s.HTTPRequest("POST", "/api/incoming/"+item.ID+"/approve", bytes.NewBufferString(approve))
+	c.Assert(response.Code, Equals, 200)
+
+	var approved incomingApproveResult
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &approved), IsNil)
+	c.Check(approved.Item.State, Equals, deb.IncomingStateApproved)
+	c.Check(approved.Item.Repo, Equals, repoName)
+	c.Check(approved.Report.AddedLines, DeepEquals, []string{"hardlink_0.2.1_source added", "hardlink_0.2.1_amd64 added"})
+
+	_, err := os.Stat(item.Dir(s.context.IncomingPath()))
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	response, _ = s.HTTPRequest("POST", "/api/incoming/"+item.ID+"/reject", nil)
+	c.Check(response.Code, Equals, 409)
+
+	item2 := s.queue(c, fmt.Sprintf("incoming-rejected-%d", suffix))
+
+	response, _ = s.HTTPRequest("POST", "/api/incoming/"+item2.ID+"/reject", bytes.NewBufferString(`{"Reason": "not now"}`))
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `.*"State":"rejected".*"Reason":"not now".*`)
+
+	response, _ = s.HTTPRequest("GET", "/api/incoming?state=rejected", nil)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `.*"ID":"`+item2.ID+`".*`)
+
+	response, _ = s.HTTPRequest("DELETE", "/api/incoming/"+item2.ID, nil)
+	c.Check(response.Code, Equals, 200)
+
+	response, _ = s.HTTPRequest("GET", "/api/incoming/"+item2.ID, nil)
+	c.Check(response.Code, Equals, 404)
+}
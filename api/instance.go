@@ -0,0 +1,151 @@
+package api
+
+import (
+	"os"
+	"sort"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type instanceFeatures struct {
+	// Configured published storages as "<type>:<name>"
+	PublishedStorages []string `json:"PublishedStorages"`
+	// Database backend: leveldb or etcd
+	DatabaseBackend string `json:"DatabaseBackend"     example:"leveldb"`
+	// Package pool storage: local or azure
+	PackagePool string `json:"PackagePool"             example:"local"`
+	// GPG implementation
+	GpgProvider string `json:"GpgProvider"             example:"gpg"`
+	// Authentication methods for served repositories: basic, token
+	ServeAuth []string `json:"ServeAuth"               example:"basic"`
+	// Authentication methods for web UI: basic, token
+	WebUIAuth []string `json:"WebUIAuth"               example:"token"`
+	// Names of inbound webhooks
+	Webhooks []string `json:"Webhooks"                 example:"upstream"`
+	// Optional features being enabled
+	AsyncAPI       bool `json:"AsyncAPI"`
+	Metrics        bool `json:"Metrics"`
+	Swagger        bool `json:"Swagger"`
+	WebUI          bool `json:"WebUI"`
+	ServeInAPIMode bool `json:"ServeInAPIMode"`
+	DownloadStats  bool `json:"DownloadStats"`
+	Tenancy        bool `json:"Tenancy"`
+	// State of experimental features (feature flags)
+	Experimental map[string]bool `json:"Experimental"`
+}
+
+type instanceCounts struct {
+	Mirrors        int `json:"Mirrors"`
+	LocalRepos     int `json:"LocalRepos"`
+	Snapshots      int `json:"Snapshots"`
+	PublishedRepos int `json:"PublishedRepos"`
+	Tasks          int `json:"Tasks"`
+}
+
+type instanceInfo struct {
+	// Stable ID of aptly instance
+	ID string `json:"ID"                         example:"1b4e28ba-2fa1-11d2-883f-0016d3cca427"`
+	// Version of aptly
+	Version string `json:"Version"               example:"1.6.0"`
+	// Host name of the server
+	Hostname string `json:"Hostname"             example:"aptly-1"`
+	// Features enabled in configuration
+	Features instanceFeatures `json:"Features"`
+	// Number of resources
+	Counts instanceCounts `json:"Counts"`
+}
+
+// aclMethods returns authentication methods used by ACLs
+func aclMethods(acls ...utils.ServeACL) []string {
+	var basic, token bool
+
+	for _, acl := range acls {
+		basic = basic || len(acl.Users) > 0
+		token = token || len(acl.Tokens) > 0
+	}
+
+	result := []string{}
+	if basic {
+		result = append(result, "basic")
+	}
+	if token {
+		result = append(result, "token")
+	}
+
+	return result
+}
+
+// @Summary Instance Info
+// @Description **Get identity and capabilities of aptly instance**
+// @Description
+// @Description Reports stable instance ID (generated on first request and stored in root directory), version,
+// @Description enabled features and number of resources, so that many aptly servers could be inventoried uniformly.
+// @Tags Status
+// @Produce json
+// @Success 200 {object} instanceInfo
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/instance [get]
+func apiInstance(c *gin.Context) {
+	id, err := context.InstanceID()
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	config := context.Config()
+
+	features := instanceFeatures{
+		PublishedStorages: context.PublishedStorageNames(),
+		DatabaseBackend:   config.DatabaseBackend.Type,
+		PackagePool:       "local",
+		GpgProvider:       config.GpgProvider,
+		WebUIAuth:         aclMethods(config.WebUIAccessControl),
+		Webhooks:          []string{},
+		AsyncAPI:          config.AsyncAPI,
+		Metrics:           config.EnableMetricsEndpoint,
+		Swagger:           config.EnableSwaggerEndpoint,
+		WebUI:             config.EnableWebUI,
+		ServeInAPIMode:    config.ServeInAPIMode,
+		DownloadStats:     config.EnableDownloadStats,
+		Tenancy:           config.Tenancy.Enabled,
+		Experimental:      config.EnabledFeatures(),
+	}
+
+	if features.DatabaseBackend == "" {
+		features.DatabaseBackend = "leveldb"
+	}
+	if config.PackagePoolStorage.Azure != nil {
+		features.PackagePool = "azure"
+	}
+
+	acls := []utils.ServeACL{}
+	for _, acl := range config.ServeAccessControl {
+		acls = append(acls, acl)
+	}
+	features.ServeAuth = aclMethods(acls...)
+
+	for name := range config.Webhooks {
+		features.Webhooks = append(features.Webhooks, name)
+	}
+	sort.Strings(features.Webhooks)
+
+	collectionFactory := context.NewCollectionFactory()
+	counts := instanceCounts{
+		Mirrors:        collectionFactory.RemoteRepoCollection().Len(),
+		LocalRepos:     collectionFactory.LocalRepoCollection().Len(),
+		Snapshots:      collectionFactory.SnapshotCollection().Len(),
+		PublishedRepos: collectionFactory.PublishedRepoCollection().Len(),
+		Tasks:          len(context.TaskList().GetTasks()),
+	}
+
+	c.JSON(200, instanceInfo{
+		ID:       id,
+		Version:  aptly.Version,
+		Hostname: hostname,
+		Features: features,
+		Counts:   counts,
+	})
+}
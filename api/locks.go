@@ -0,0 +1,180 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/gin-gonic/gin"
+)
+
+type lockResourceParams struct {
+	// Kind of resource: repo, mirror, snapshot or publish
+	Kind string `binding:"required" json:"Kind" example:"publish"`
+	// Name of local repository, mirror or snapshot, for published repository: [<storage>:]<prefix>/<distribution>
+	Name string `binding:"required" json:"Name" example:"s3:ppa/bookworm"`
+}
+
+type lockCreateParams struct {
+	// Reason of the lock, shown to conflicting tasks
+	Reason string `binding:"required"       json:"Reason"    example:"storage maintenance"`
+	// Resources to lock
+	Resources []lockResourceParams `binding:"required" json:"Resources"`
+}
+
+// lockResourceKey returns task resource key of resource to be locked
+func lockResourceKey(c *gin.Context, collectionFactory *deb.CollectionFactory, resource lockResourceParams) (string, error) {
+	switch resource.Kind {
+	case "repo":
+		if !tenantVisible(c, resource.Name) {
+			break
+		}
+		repo, err := collectionFactory.LocalRepoCollection().ByName(resource.Name)
+		if err != nil {
+			return "", err
+		}
+		return string(repo.Key()), nil
+	case "mirror":
+		if !tenantVisible(c, resource.Name) {
+			break
+		}
+		repo, err := collectionFactory.RemoteRepoCollection().ByName(resource.Name)
+		if err != nil {
+			return "", err
+		}
+		return string(repo.Key()), nil
+	case "snapshot":
+		if !tenantVisible(c, resource.Name) {
+			break
+		}
+		snapshot, err := collectionFactory.SnapshotCollection().ByName(resource.Name)
+		if err != nil {
+			return "", err
+		}
+		return string(snapshot.ResourceKey()), nil
+	case "publish":
+		storage, prefix := deb.ParsePrefix(resource.Name)
+		distribution := prefix
+		prefix = "."
+		if i := strings.LastIndex(distribution, "/"); i != -1 {
+			prefix, distribution = distribution[:i], distribution[i+1:]
+		}
+		if !tenantVisible(c, prefix) {
+			break
+		}
+		published, err := collectionFactory.PublishedRepoCollection().ByStoragePrefixDistribution(storage, prefix, distribution)
+		if err != nil {
+			return "", err
+		}
+		return string(published.Key()), nil
+	}
+
+	return "", fmt.Errorf("%s %s not found", resource.Kind, resource.Name)
+}
+
+// @Summary List Locks
+// @Description **Get list of resource locks currently held**
+// @Description
+// @Description Locks are shown as running tasks.
+// @Tags Tasks
+// @Produce json
+// @Success 200 {array} task.Task
+// @Router /api/locks [get]
+func apiLocksList(c *gin.Context) {
+	c.JSON(http.StatusOK, context.TaskList().GetResourceLocks())
+}
+
+// @Summary Lock Resources
+// @Description **Hold lock on local repositories, mirrors, snapshots or published repositories**
+// @Description
+// @Description Lock is held until it is released, e.g. during out-of-band maintenance of published storage.
+// @Description Tasks using any of locked resources wait until lock is released, their output shows reason
+// @Description of the lock. Lock is shown as running task named after the reason.
+// @Description
+// @Description Lock is not acquired (409 is returned) if resources are used by other tasks.
+// @Description
+// @Description Note: synchronous API calls using locked resources don't return until lock is released.
+// @Tags Tasks
+// @Consume json
+// @Param request body lockCreateParams true "Parameters"
+// @Produce json
+// @Success 201 {object} task.Task
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 404 {object} Error "Resource not found"
+// @Failure 409 {object} Error "Resources are used by other tasks"
+// @Router /api/locks [post]
+func apiLocksCreate(c *gin.Context) {
+	var b lockCreateParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	if len(b.Resources) == 0 {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("no resources to lock"))
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+
+	resources := make([]string, 0, len(b.Resources))
+	for _, resource := range b.Resources {
+		switch resource.Kind {
+		case "repo", "mirror", "snapshot", "publish":
+		default:
+			AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("unknown resource kind %q, expected repo, mirror, snapshot or publish", resource.Kind))
+			return
+		}
+
+		key, err := lockResourceKey(c, collectionFactory, resource)
+		if err != nil {
+			AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("unable to lock: %s", err))
+			return
+		}
+
+		resources = append(resources, key)
+	}
+
+	lock, conflictErr := context.TaskList().LockResources(b.Reason, resources)
+	if conflictErr != nil {
+		AbortWithJSONError(c, http.StatusConflict, fmt.Errorf("unable to lock: %s", conflictErr))
+		return
+	}
+
+	c.JSON(http.StatusCreated, lock)
+}
+
+// @Summary Unlock Resources
+// @Description **Release lock on resources**
+// @Description
+// @Description Tasks waiting for locked resources proceed.
+// @Tags Tasks
+// @Param id path int true "Lock ID"
+// @Produce json
+// @Success 200 {object} task.Task
+// @Failure 400 {object} Error "Not a lock or already released"
+// @Failure 404 {object} Error "Lock not found"
+// @Router /api/locks/{id} [delete]
+func apiLocksDelete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 0)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	list := context.TaskList()
+	if _, err = list.GetTaskByID(int(id)); err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	lock, err := list.UnlockResources(int(id))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lock)
+}
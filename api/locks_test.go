@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aptly-dev/aptly/task"
+
+	. "gopkg.in/check.v1"
+)
+
+type LockSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&LockSuite{})
+
+func (s *LockSuite) TestLocks(c *C) {
+	_, err := s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(`{"Name": "locked"}`))
+	c.Assert(err, IsNil)
+
+	response, _ := s.HTTPRequest("POST", "/api/locks", bytes.NewBufferString(`{"Reason": "maintenance", "Resources": [{"Kind": "repo", "Name": "missing"}]}`))
+	c.Check(response.Code, Equals, 404)
+
+	response, _ = s.HTTPRequest("POST", "/api/locks", bytes.NewBufferString(`{"Reason": "maintenance", "Resources": [{"Kind": "pool", "Name": "locked"}]}`))
+	c.Check(response.Code, Equals, 400)
+
+	response, _ = s.HTTPRequest("POST", "/api/locks", bytes.NewBufferString(`{"Reason": "maintenance", "Resources": [{"Kind": "repo", "Name": "locked"}]}`))
+	c.Assert(response.Code, Equals, 201)
+	var lock task.Task
+	err = json.Unmarshal(response.Body.Bytes(), &lock)
+	c.Assert(err, IsNil)
+	c.Check(lock.Name, Equals, "Lock: maintenance")
+	c.Check(lock.State, Equals, task.RUNNING)
+
+	response, _ = s.HTTPRequest("POST", "/api/locks", bytes.NewBufferString(`{"Reason": "again", "Resources": [{"Kind": "repo", "Name": "locked"}]}`))
+	c.Check(response.Code, Equals, 409)
+
+	response, _ = s.HTTPRequest("GET", "/api/locks", nil)
+	c.Check(response.Code, Equals, 200)
+	var locks []task.Task
+	err = json.Unmarshal(response.Body.Bytes(), &locks)
+	c.Assert(err, IsNil)
+	c.Check(locks, HasLen, 1)
+
+	response, _ = s.HTTPRequest("DELETE", fmt.Sprintf("/api/locks/%d", lock.ID), nil)
+	c.Check(response.Code, Equals, 200)
+
+	response, _ = s.HTTPRequest("DELETE", fmt.Sprintf("/api/locks/%d", lock.ID), nil)
+	c.Check(response.Code, Equals, 400)
+
+	response, _ = s.HTTPRequest("DELETE", "/api/locks/42", nil)
+	c.Check(response.Code, Equals, 404)
+}
@@ -2,10 +2,14 @@ package api
 
 import (
 	"fmt"
+	"io/fs"
+	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -62,6 +66,20 @@ var (
 		},
 		[]string{"directory"},
 	)
+	apiPublishedStorageHealthyGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aptly_published_storage_healthy",
+			Help: "Result of the last health check of published storage (1: healthy, 0: failed) labeled by storage.",
+		},
+		[]string{"storage"},
+	)
+	apiPublishedStorageHealthCheckTimestampGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aptly_published_storage_health_check_timestamp_seconds",
+			Help: "Time of the last health check of published storage labeled by storage.",
+		},
+		[]string{"storage"},
+	)
 	apiReposPackageCountGauge = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "aptly_repos_package_count",
@@ -69,6 +87,32 @@ var (
 		},
 		[]string{"source", "distribution", "component"},
 	)
+	apiTasksQueuedGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "aptly_tasks_queued",
+			Help: "Current number of background tasks waiting to be run.",
+		},
+	)
+	apiTasksRunningGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "aptly_tasks_running",
+			Help: "Current number of running background tasks.",
+		},
+	)
+	apiDatabaseSizeGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "aptly_database_size_bytes",
+			Help: "Current size of the local database on disk in bytes.",
+		},
+	)
+	apiMirrorUpdateDurationHistogram = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "aptly_mirror_update_duration_seconds",
+			Help:    "Duration of mirror updates in seconds labeled by result.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+		},
+		[]string{"result"},
+	)
 )
 
 type metricsCollectorRegistrar struct {
@@ -114,3 +158,71 @@ func countPackagesByRepos() {
 		log.Warn().Msg(msg)
 	}
 }
+
+func countTasks() {
+	queued, running := 0, 0
+	for _, t := range context.TaskList().GetTasks() {
+		switch t.State {
+		case task.IDLE:
+			queued++
+		case task.RUNNING:
+			running++
+		}
+	}
+
+	apiTasksQueuedGauge.Set(float64(queued))
+	apiTasksRunningGauge.Set(float64(running))
+}
+
+// localDatabasePath returns path to the database on disk, or "" if database is remote
+func localDatabasePath() string {
+	backend := context.Config().DatabaseBackend
+	switch backend.Type {
+	case "etcd":
+		return ""
+	case "leveldb":
+		return filepath.Join(context.Config().GetRootDir(), backend.DbPath)
+	default:
+		return context.DBPath()
+	}
+}
+
+func measureDatabaseSize() {
+	dbPath := localDatabasePath()
+	if dbPath == "" {
+		return
+	}
+
+	var size int64
+	err := filepath.WalkDir(dbPath, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				// files are removed by compaction while walking
+				return nil
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Warn().Msgf("Error %s found while measuring database size for metrics endpoint", err)
+		return
+	}
+
+	apiDatabaseSizeGauge.Set(float64(size))
+}
+
+// observeMirrorUpdate records duration of mirror update started at start
+func observeMirrorUpdate(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	apiMirrorUpdateDurationHistogram.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
@@ -1,12 +1,14 @@
 package api
 
 import (
+	stdcontext "context"
 	"fmt"
 	"net/http"
 	"os"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/deb"
@@ -17,6 +19,12 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// pause signals of running mirror updates, by mirror UUID
+var (
+	mirrorPauseSignals     = map[string]chan struct{}{}
+	mirrorPauseSignalsLock sync.Mutex
+)
+
 func getVerifier(keyRings []string) (pgp.Verifier, error) {
 	verifier := context.GetVerifier()
 	for _, keyRing := range keyRings {
@@ -31,6 +39,21 @@ func getVerifier(keyRings []string) (pgp.Verifier, error) {
 	return verifier, nil
 }
 
+// mirrorKeyRings fetches and verifies pinned keys of mirror, if configured, returning
+// keyring to verify mirror with
+func mirrorKeyRings(repo *deb.RemoteRepo) ([]string, error) {
+	if !repo.HasPinnedKeys() {
+		return nil, nil
+	}
+
+	keyRing, err := repo.FetchKeys(context.NewDownloader(nil), context.KeyringsPath())
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{keyRing}, nil
+}
+
 // @Summary Get mirrors
 // @Description **Show list of currently available mirrors**
 // @Description Each mirror is returned as in “show” API.
@@ -44,7 +67,9 @@ func apiMirrorsList(c *gin.Context) {
 
 	result := []*deb.RemoteRepo{}
 	collection.ForEach(func(repo *deb.RemoteRepo) error {
-		result = append(result, repo)
+		if tenantVisible(c, repo.Name) {
+			result = append(result, repo)
+		}
 		return nil
 	})
 
@@ -56,16 +81,28 @@ type mirrorCreateParams struct {
 	Name string `binding:"required"          json:"Name"              example:"mirror2"`
 	// Url of the archive to mirror
 	ArchiveURL string `binding:"required"    json:"ArchiveURL"        example:"http://deb.debian.org/debian"`
+	// Archive roots to download from (in order) when ArchiveURL fails
+	FallbackURLs []string `                  json:"FallbackURLs"      example:"http://ftp.de.debian.org/debian"`
+	// URL of list of archive roots (one per line) to download from when ArchiveURL and fallback URLs fail
+	MirrorListURL string `                   json:"MirrorListURL"     example:"http://mirrors.example.com/debian.list"`
 	// Distribution name to mirror
 	Distribution string `                    json:"Distribution"      example:"'buster', for flat repositories use './'"`
 	// Package query that is applied to mirror packages
 	Filter string `                          json:"Filter"            example:"xserver-xorg"`
 	// Components to mirror, if not specified aptly would fetch all components
 	Components []string `                    json:"Components"        example:"main"`
+	// Map upstream components to local component names, several components could be merged into one
+	ComponentMap map[string]string `         json:"ComponentMap"      example:"main:upstream,universe:upstream"`
 	// Limit mirror to those architectures, if not specified aptly would fetch all architectures
 	Architectures []string `                 json:"Architectures"     example:"amd64"`
 	// Gpg keyring(s) for verifying Release file
 	Keyrings []string `                      json:"Keyrings"          example:"trustedkeys.gpg"`
+	// URL to fetch public keys of repository from
+	KeyURL string `                          json:"KeyURL"            example:"https://deb.example.com/key.asc"`
+	// Keyserver to fetch public keys of repository from
+	KeyServer string `                       json:"KeyServer"         example:"keyserver.ubuntu.com"`
+	// Fingerprints of public keys to fetch and pin, fetched keys are stored in keyring of the mirror
+	KeyFingerprints []string `               json:"KeyFingerprints"   example:"6ED0E7B82643E131"`
 	// Set "true" to mirror source packages
 	DownloadSources bool `                   json:"DownloadSources"`
 	// Set "true" to mirror udeb files
@@ -80,6 +117,8 @@ type mirrorCreateParams struct {
 	SkipArchitectureCheck bool `             json:"SkipArchitectureCheck"`
 	// Set "true" to skip the verification of Release file signatures
 	IgnoreSignatures bool `                  json:"IgnoreSignatures"`
+	// Name of resource template with default settings
+	Template string `                        json:"Template"          example:"standard"`
 }
 
 // @Summary Create mirror
@@ -99,7 +138,7 @@ func apiMirrorsCreate(c *gin.Context) {
 	b.IgnoreSignatures = context.Config().GpgDisableVerify
 	b.Architectures = context.ArchitecturesList()
 
-	if c.Bind(&b) != nil {
+	if !bindWithTemplate(c, &b) {
 		return
 	}
 
@@ -137,7 +176,34 @@ func apiMirrorsCreate(c *gin.Context) {
 	repo.DownloadSources = b.DownloadSources
 	repo.DownloadUdebs = b.DownloadUdebs
 
-	verifier, err := getVerifier(b.Keyrings)
+	err = repo.SetPinnedKeys(b.KeyURL, b.KeyServer, b.KeyFingerprints)
+	if err != nil {
+		AbortWithJSONError(c, 400, fmt.Errorf("unable to create mirror: %s", err))
+		return
+	}
+
+	err = repo.SetComponentMap(b.ComponentMap)
+	if err != nil {
+		AbortWithJSONError(c, 400, fmt.Errorf("unable to create mirror: %s", err))
+		return
+	}
+
+	err = repo.SetFallbackURLs(b.FallbackURLs)
+	if err == nil {
+		err = repo.SetMirrorListURL(b.MirrorListURL)
+	}
+	if err != nil {
+		AbortWithJSONError(c, 400, fmt.Errorf("unable to create mirror: %s", err))
+		return
+	}
+
+	keyRings, err := mirrorKeyRings(repo)
+	if err != nil {
+		AbortWithJSONError(c, 400, fmt.Errorf("unable to fetch keys: %s", err))
+		return
+	}
+
+	verifier, err := getVerifier(append(b.Keyrings, keyRings...))
 	if err != nil {
 		AbortWithJSONError(c, 400, fmt.Errorf("unable to initialize GPG verifier: %s", err))
 		return
@@ -204,6 +270,15 @@ func apiMirrorsDrop(c *gin.Context) {
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to drop: %v", err)
 		}
+
+		err = collectionFactory.MirrorScheduleCollection().Drop(repo)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to drop: %v", err)
+		}
+
+		if repo.HasPinnedKeys() {
+			os.Remove(repo.KeyringPath(context.KeyringsPath()))
+		}
 		return &task.ProcessReturnValue{Code: http.StatusNoContent, Value: nil}, nil
 	})
 }
@@ -242,6 +317,7 @@ func apiMirrorsShow(c *gin.Context) {
 // @Param name path string true "mirror name"
 // @Param q query string false "search query"
 // @Param format query string false "format: `details` for more detailed information"
+// @Param explain query string false "set to 1 to return packages together with explanation of query execution"
 // @Produce json
 // @Success 200 {array} deb.Package "List of Packages"
 // @Failure 400 {object} Error "Unable to determine list of architectures"
@@ -270,7 +346,7 @@ func apiMirrorsPackages(c *gin.Context) {
 	}
 
 	reflist := repo.RefList()
-	result := []*deb.Package{}
+	var explain *deb.QueryExplain
 
 	list, err := deb.NewPackageListFromRefList(reflist, collectionFactory.PackageCollection(), nil)
 	if err != nil {
@@ -306,23 +382,19 @@ func apiMirrorsPackages(c *gin.Context) {
 
 		list.PrepareIndex()
 
+		q, explain = queryExplain(c, q)
 		list, err = list.Filter([]deb.PackageQuery{q}, withDeps,
 			nil, context.DependencyOptions(), architecturesList)
 		if err != nil {
 			AbortWithJSONError(c, 500, fmt.Errorf("unable to search: %s", err))
 		}
-	}
 
-	if c.Request.URL.Query().Get("format") == "details" {
-		list.ForEach(func(p *deb.Package) error {
-			result = append(result, p)
-			return nil
-		})
-
-		c.JSON(200, result)
-	} else {
-		c.JSON(200, list.Strings())
+		if explain != nil {
+			explain.Finish(list.Len())
+		}
 	}
+
+	renderPackages(c, list, explain)
 }
 
 type mirrorUpdateParams struct {
@@ -330,12 +402,18 @@ type mirrorUpdateParams struct {
 	Name string `                 json:"Name"                   example:"mirror1"`
 	// Url of the archive to mirror
 	ArchiveURL string `           json:"ArchiveURL"             example:"http://deb.debian.org/debian"`
+	// Archive roots to download from (in order) when ArchiveURL fails
+	FallbackURLs []string `        json:"FallbackURLs"           example:"http://ftp.de.debian.org/debian"`
+	// URL of list of archive roots (one per line) to download from when ArchiveURL and fallback URLs fail
+	MirrorListURL string `         json:"MirrorListURL"          example:"http://mirrors.example.com/debian.list"`
 	// Package query that is applied to mirror packages
 	Filter string `               json:"Filter"                 example:"xserver-xorg"`
 	// Limit mirror to those architectures, if not specified aptly would fetch all architectures
 	Architectures []string `      json:"Architectures"          example:"amd64"`
 	// Components to mirror, if not specified aptly would fetch all components
 	Components []string `         json:"Components"             example:"main"`
+	// Map upstream components to local component names, several components could be merged into one
+	ComponentMap map[string]string `json:"ComponentMap"         example:"main:upstream,universe:upstream"`
 	// Gpg keyring(s) for verifing Release file
 	Keyrings []string `           json:"Keyrings"               example:"trustedkeys.gpg"`
 	// Set "true" to include dependencies of matching packages when filtering
@@ -356,6 +434,8 @@ type mirrorUpdateParams struct {
 	ForceUpdate bool `            json:"ForceUpdate"`
 	// Set "true" to skip downloading already downloaded packages
 	SkipExistingPackages bool `   json:"SkipExistingPackages"`
+	// Set "true" to confirm update if estimated download size exceeds configured threshold
+	ConfirmEstimate bool `        json:"ConfirmEstimate"`
 }
 
 // @Summary Update Mirror
@@ -370,6 +450,7 @@ type mirrorUpdateParams struct {
 // @Failure 400 {object} Error "Unable to determine list of architectures"
 // @Failure 404 {object} Error "Mirror not found"
 // @Failure 500 {object} Error "Internal Error"
+// @Failure 412 {object} Error "Estimated size exceeds confirmation threshold"
 // @Router /api/mirrors/{name} [put]
 func apiMirrorsUpdate(c *gin.Context) {
 	var (
@@ -396,6 +477,9 @@ func apiMirrorsUpdate(c *gin.Context) {
 	b.Filter = remote.Filter
 	b.Architectures = remote.Architectures
 	b.Components = remote.Components
+	b.ComponentMap = remote.ComponentMap
+	b.FallbackURLs = remote.FallbackURLs
+	b.MirrorListURL = remote.MirrorListURL
 	b.IgnoreSignatures = context.Config().GpgDisableVerify
 
 	log.Info().Msgf("%s: Starting mirror update", b.Name)
@@ -433,17 +517,53 @@ func apiMirrorsUpdate(c *gin.Context) {
 	remote.Architectures = b.Architectures
 	remote.Components = b.Components
 
-	verifier, err := getVerifier(b.Keyrings)
+	err = remote.SetComponentMap(b.ComponentMap)
+	if err != nil {
+		AbortWithJSONError(c, 400, fmt.Errorf("unable to update: %s", err))
+		return
+	}
+
+	err = remote.SetFallbackURLs(b.FallbackURLs)
+	if err == nil {
+		err = remote.SetMirrorListURL(b.MirrorListURL)
+	}
+	if err != nil {
+		AbortWithJSONError(c, 400, fmt.Errorf("unable to update: %s", err))
+		return
+	}
+
+	keyRings, err := mirrorKeyRings(remote)
+	if err != nil {
+		AbortWithJSONError(c, 400, fmt.Errorf("unable to fetch keys: %s", err))
+		return
+	}
+
+	verifier, err := getVerifier(append(b.Keyrings, keyRings...))
 	if err != nil {
 		AbortWithJSONError(c, 400, fmt.Errorf("unable to initialize GPG verifier: %s", err))
 		return
 	}
 
 	resources := []string{string(remote.Key())}
-	maybeRunTaskInBackground(c, "Update mirror "+b.Name, resources, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, "Update mirror "+b.Name, resources, func(out aptly.Progress, detail *task.Detail) (_ *task.ProcessReturnValue, err error) {
+		start := time.Now()
+		defer func() {
+			observeMirrorUpdate(start, err)
+			if err != nil {
+				context.MirrorUpdateFailed(b.Name, err, out)
+			}
+		}()
+
+		err = collection.LoadComplete(remote)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
+		}
+		previous := remote.RefList()
 
 		downloader := context.NewDownloader(out)
-		err := remote.Fetch(downloader, verifier, b.IgnoreSignatures)
+		failover := remote.NewURLFailover(downloader)
+		downloader = failover.Wrap(downloader)
+		err = remote.Fetch(downloader, verifier, b.IgnoreSignatures)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
@@ -480,11 +600,45 @@ func apiMirrorsUpdate(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
 
+		// surface pre-flight estimation before any download starts
+		count := len(queue)
+		taskDetail := struct {
+			TotalDownloadSize         int64
+			RemainingDownloadSize     int64
+			TotalNumberOfPackages     int
+			RemainingNumberOfPackages int
+		}{
+			downloadSize, downloadSize, count, count,
+		}
+		detail.Store(taskDetail)
+
+		err = checkEstimate(downloadSize, b.ConfirmEstimate)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusPreconditionFailed, Value: taskDetail}, fmt.Errorf("unable to update: %s", err)
+		}
+
+		pause := make(chan struct{})
+		paused := false
+
+		mirrorPauseSignalsLock.Lock()
+		mirrorPauseSignals[remote.UUID] = pause
+		mirrorPauseSignalsLock.Unlock()
+
+		defer func() {
+			mirrorPauseSignalsLock.Lock()
+			delete(mirrorPauseSignals, remote.UUID)
+			mirrorPauseSignalsLock.Unlock()
+		}()
+
 		defer func() {
 			// on any interruption, unlock the mirror
 			e := context.ReOpenDatabase()
 			if e == nil {
-				remote.MarkAsIdle()
+				if paused {
+					remote.MarkAsPaused()
+				} else {
+					remote.MarkAsIdle()
+				}
 				collection.Update(remote)
 			}
 		}()
@@ -497,17 +651,13 @@ func apiMirrorsUpdate(c *gin.Context) {
 
 		context.GoContextHandleSignals()
 
-		count := len(queue)
-		taskDetail := struct {
-			TotalDownloadSize         int64
-			RemainingDownloadSize     int64
-			TotalNumberOfPackages     int
-			RemainingNumberOfPackages int
-		}{
-			downloadSize, downloadSize, count, count,
-		}
-		detail.Store(taskDetail)
+		// downloads are stopped when aptly is shut down or task is cancelled
+		ctx, cancel := stdcontext.WithCancel(context)
+		defer cancel()
+		stop := stdcontext.AfterFunc(out.Context(), cancel)
+		defer stop()
 
+		packageDownloader := failover.Wrap(context.Downloader())
 		downloadQueue := make(chan int)
 		taskFinished := make(chan *deb.PackageDownloadTask)
 
@@ -526,7 +676,12 @@ func apiMirrorsUpdate(c *gin.Context) {
 			for idx := range queue {
 				select {
 				case downloadQueue <- idx:
-				case <-context.Done():
+				case <-pause:
+					// stop feeding the queue, files in flight are finished by workers
+					paused = true
+					close(downloadQueue)
+					return
+				case <-ctx.Done():
 					return
 				}
 			}
@@ -582,8 +737,8 @@ func apiMirrorsUpdate(c *gin.Context) {
 						}
 
 						// download file...
-						e = context.Downloader().DownloadWithChecksum(
-							context,
+						e = packageDownloader.DownloadWithChecksum(
+							ctx,
 							remote.PackageURL(task.File.DownloadURL()).String(),
 							task.TempDownPath,
 							&task.File.Checksums,
@@ -609,7 +764,7 @@ func apiMirrorsUpdate(c *gin.Context) {
 
 						task.Done = true
 						taskFinished <- task
-					case <-context.Done():
+					case <-ctx.Done():
 						return
 					}
 
@@ -636,11 +791,20 @@ func apiMirrorsUpdate(c *gin.Context) {
 		}()
 
 		select {
-		case <-context.Done():
+		case <-ctx.Done():
+			if out.Context().Err() != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", task.ErrCancelled)
+			}
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: interrupted")
 		default:
 		}
 
+		if paused && len(errors) == 0 {
+			// files downloaded so far are already in the pool, they won't be downloaded again on resume
+			log.Info().Msgf("%s: Mirror update paused", b.Name)
+			return &task.ProcessReturnValue{Code: http.StatusAccepted, Value: detail.Load()}, nil
+		}
+
 		if len(errors) > 0 {
 			log.Info().Msgf("%s: Unable to update because of previous errors", b.Name)
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: download errors:\n  %s", strings.Join(errors, "\n  "))
@@ -653,7 +817,79 @@ func apiMirrorsUpdate(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
 
+		context.MirrorUpdated(remote, previous, collectionFactory, out)
+
 		log.Info().Msgf("%s: Mirror updated successfully", b.Name)
 		return &task.ProcessReturnValue{Code: http.StatusNoContent, Value: nil}, nil
 	})
 }
+
+// @Summary Pause Mirror Update
+// @Description **Pause running mirror update**
+// @Description
+// @Description Files being downloaded are finished and imported into the package pool, no new downloads are started.
+// @Description Paused update could be continued with `POST /api/mirrors/{name}/resume`, already downloaded files are not fetched again.
+// @Tags Mirrors
+// @Param name path string true "mirror name"
+// @Produce json
+// @Success 202
+// @Failure 404 {object} Error "Mirror not found"
+// @Failure 409 {object} Error "Mirror is not being updated"
+// @Router /api/mirrors/{name}/pause [post]
+func apiMirrorsPause(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.RemoteRepoCollection()
+
+	remote, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, 404, fmt.Errorf("unable to pause: %s", err))
+		return
+	}
+
+	mirrorPauseSignalsLock.Lock()
+	pause, ok := mirrorPauseSignals[remote.UUID]
+	if ok {
+		delete(mirrorPauseSignals, remote.UUID)
+		close(pause)
+	}
+	mirrorPauseSignalsLock.Unlock()
+
+	if !ok {
+		AbortWithJSONError(c, 409, fmt.Errorf("unable to pause: mirror %s is not being updated", remote.Name))
+		return
+	}
+
+	c.JSON(202, gin.H{})
+}
+
+// @Summary Resume Mirror Update
+// @Description **Resume paused mirror update**
+// @Description
+// @Description Accepts the same parameters as mirror update, files downloaded before the update was paused are reused.
+// @Tags Mirrors
+// @Param name path string true "mirror name"
+// @Consume json
+// @Param request body mirrorUpdateParams true "Parameters"
+// @Produce json
+// @Success 200 {object} task.ProcessReturnValue "Mirror was updated successfully"
+// @Success 202 {object} task.Task "Mirror is being updated"
+// @Failure 404 {object} Error "Mirror not found"
+// @Failure 409 {object} Error "Mirror update is not paused"
+// @Router /api/mirrors/{name}/resume [post]
+func apiMirrorsResume(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.RemoteRepoCollection()
+
+	remote, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, 404, fmt.Errorf("unable to resume: %s", err))
+		return
+	}
+
+	if !remote.IsPaused() {
+		AbortWithJSONError(c, 409, fmt.Errorf("unable to resume: update of mirror %s is not paused", remote.Name))
+		return
+	}
+
+	apiMirrorsUpdate(c)
+}
@@ -38,3 +38,15 @@ func (s *MirrorSuite) TestCreateMirror(c *C) {
 	c.Check(response.Code, Equals, 400)
 	c.Check(response.Body.String(), Equals, "")
 }
+
+func (s *MirrorSuite) TestPauseMirrorNonExisting(c *C) {
+	response, _ := s.HTTPRequest("POST", "/api/mirrors/does-not-exist/pause", nil)
+	c.Check(response.Code, Equals, 404)
+	c.Check(response.Body.String(), Equals, "{\"error\":\"unable to pause: mirror with name does-not-exist not found\"}")
+}
+
+func (s *MirrorSuite) TestResumeMirrorNonExisting(c *C) {
+	response, _ := s.HTTPRequest("POST", "/api/mirrors/does-not-exist/resume", nil)
+	c.Check(response.Code, Equals, 404)
+	c.Check(response.Body.String(), Equals, "{\"error\":\"unable to resume: mirror with name does-not-exist not found\"}")
+}
@@ -1,6 +1,11 @@
 package api
 
 import (
+	"fmt"
+	"net/http"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
 	"github.com/gin-gonic/gin"
 )
 
@@ -23,6 +28,7 @@ func apiPackagesShow(c *gin.Context) {
 // @Produce  json
 // @Param q query string false "search query"
 // @Param format query string false "format: `details` for more detailed information"
+// @Param explain query string false "set to 1 to return packages together with explanation of query execution"
 // @Success 200 {array} string "List of packages"
 // @Router /api/packages [get]
 func apiPackages(c *gin.Context) {
@@ -30,3 +36,110 @@ func apiPackages(c *gin.Context) {
 	collection := collectionFactory.PackageCollection()
 	showPackages(c, collection.AllPackageRefs(), collectionFactory)
 }
+
+// openPackageFile looks up package by key and opens its .deb file in the package pool
+func openPackageFile(c *gin.Context) (aptly.ReadSeekerCloser, string, bool) {
+	collectionFactory := context.NewCollectionFactory()
+	p, err := collectionFactory.PackageCollection().ByKey([]byte(c.Params.ByName("key")))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return nil, "", false
+	}
+
+	if p.IsSource {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("package %s is a source package, inspection is supported for binary packages only", p))
+		return nil, "", false
+	}
+
+	reader, filename, err := p.OpenPackageFile(context.PackagePool())
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("unable to open package file: %s", err))
+		return nil, "", false
+	}
+
+	return reader, filename, true
+}
+
+// @Summary Inspect Package Control File
+// @Description **Extract control file from .deb file of the package in the package pool**
+// @Description
+// @Description Unlike `GET /api/packages/{key}`, fields are read from the package file itself.
+// @Tags Packages
+// @Produce json
+// @Param key path string true "package key (unique package identifier)"
+// @Success 200 {object} map[string]string "Control file fields"
+// @Failure 400 {object} Error "Source package"
+// @Failure 404 {object} Error "Package or package file not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/packages/{key}/control [get]
+func apiPackagesControl(c *gin.Context) {
+	reader, filename, ok := openPackageFile(c)
+	if !ok {
+		return
+	}
+	defer reader.Close()
+
+	stanza, err := deb.GetControlFromDeb(reader, filename)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stanza)
+}
+
+// @Summary Inspect Package File List
+// @Description **List files installed by the package, with types, modes, owners and sizes**
+// @Description
+// @Description File list is extracted from .deb file of the package in the package pool.
+// @Tags Packages
+// @Produce json
+// @Param key path string true "package key (unique package identifier)"
+// @Success 200 {array} deb.PackageFileEntry
+// @Failure 400 {object} Error "Source package"
+// @Failure 404 {object} Error "Package or package file not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/packages/{key}/files [get]
+func apiPackagesFiles(c *gin.Context) {
+	reader, filename, ok := openPackageFile(c)
+	if !ok {
+		return
+	}
+	defer reader.Close()
+
+	files, err := deb.GetFileListFromDeb(reader, filename)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, files)
+}
+
+// @Summary Inspect Package Maintainer Scripts
+// @Description **Extract maintainer scripts (preinst, postinst, prerm, postrm, config) from the package**
+// @Description
+// @Description Scripts not shipped by the package are omitted from the response.
+// @Tags Packages
+// @Produce json
+// @Param key path string true "package key (unique package identifier)"
+// @Success 200 {object} map[string]string "Script name to contents"
+// @Failure 400 {object} Error "Source package"
+// @Failure 404 {object} Error "Package or package file not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/packages/{key}/scripts [get]
+func apiPackagesScripts(c *gin.Context) {
+	reader, filename, ok := openPackageFile(c)
+	if !ok {
+		return
+	}
+	defer reader.Close()
+
+	scripts, err := deb.GetMaintainerScriptsFromDeb(reader, filename)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, scripts)
+}
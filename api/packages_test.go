@@ -1,6 +1,16 @@
 package api
 
 import (
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/aptly-dev/aptly/client"
+	"github.com/aptly-dev/aptly/deb"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -16,3 +26,70 @@ func (s *PackagesSuite) TestPackagesGetMaximumVersion(c *C) {
 	c.Check(response.Code, Equals, 200)
 	c.Check(response.Body.String(), Equals, "[]")
 }
+
+func (s *PackagesSuite) TestPackagesExplain(c *C) {
+	response, err := s.HTTPRequest("GET", "/api/repos/dummy/packages?q=Name%20(~%20nginx)&explain=1", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `\{"Explain":\{"Query":"Name \(~ nginx\)","Plan":\{"Type":"field",.*"Strategy":"scan".*\},"Examined":0,"Matched":0,"Duration":\d+\},"Packages":\[\]\}`)
+
+	response, err = s.HTTPRequest("GET", "/api/repos/dummy/packages?q=Name%20(~%20nginx)", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Equals, "[]")
+}
+
+func (s *PackagesSuite) TestPackagesInspect(c *C) {
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	cl, err := client.NewClient(server.URL, nil)
+	c.Assert(err, IsNil)
+
+	ctx := stdcontext.Background()
+	suffix := time.Now().UnixNano()
+
+	repoName := fmt.Sprintf("inspect-repo-%d", suffix)
+	_, err = cl.CreateRepo(ctx, client.RepoCreateParams{Name: repoName})
+	c.Assert(err, IsNil)
+	defer func() {
+		t, _ := cl.DropRepo(ctx, repoName, true)
+		c.Check(cl.Wait(ctx, t, nil), IsNil)
+	}()
+
+	uploadDir := fmt.Sprintf("inspect-upload-%d", suffix)
+	_, err = cl.UploadPaths(ctx, uploadDir, "../system/changes/hardlink_0.2.1_amd64.deb")
+	c.Assert(err, IsNil)
+
+	t, err := cl.AddUploadedPackages(ctx, repoName, uploadDir, client.RepoAddOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(cl.Wait(ctx, t, nil), IsNil)
+
+	keys, err := cl.RepoPackages(ctx, repoName, "")
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 1)
+	prefix := "/api/packages/" + url.PathEscape(keys[0])
+
+	response, err := s.HTTPRequest("GET", prefix+"/control", nil)
+	c.Assert(err, IsNil)
+	c.Assert(response.Code, Equals, 200)
+	var control map[string]string
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &control), IsNil)
+	c.Check(control["Package"], Equals, "hardlink")
+
+	response, err = s.HTTPRequest("GET", prefix+"/files", nil)
+	c.Assert(err, IsNil)
+	c.Assert(response.Code, Equals, 200)
+	var files []deb.PackageFileEntry
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &files), IsNil)
+	c.Check(files[2], DeepEquals, deb.PackageFileEntry{Path: "usr/bin/hardlink", Type: "file", Mode: "0755", Size: 18792, Owner: "root/root"})
+
+	response, err = s.HTTPRequest("GET", prefix+"/scripts", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Equals, "{}")
+
+	response, err = s.HTTPRequest("GET", "/api/packages/"+url.PathEscape("Pamd64 no-such-package 1.0 0000")+"/files", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+)
+
+type pipelineParams struct {
+	// Description of the pipeline
+	Description string `json:"Description"   example:"nightly security refresh"`
+	// Steps run in order, pipeline stops at first failed step
+	Steps []deb.PipelineStep `json:"Steps"`
+}
+
+type pipelineCreateParams struct {
+	// Name of the pipeline
+	Name string `binding:"required" json:"Name" example:"nightly"`
+	pipelineParams
+}
+
+// pipelineStepRequest builds API request implementing pipeline step
+func pipelineStepRequest(step *deb.PipelineStep) (*http.Request, error) {
+	var (
+		method = http.MethodPost
+		path   string
+		body   interface{}
+	)
+
+	switch step.Action {
+	case deb.PipelineActionMirrorUpdate:
+		method, path, body = http.MethodPut, "/api/mirrors/"+url.PathEscape(step.Mirror), gin.H{}
+	case deb.PipelineActionMirrorSnapshot:
+		path, body = "/api/mirrors/"+url.PathEscape(step.Mirror)+"/snapshots", gin.H{"Name": step.Snapshot}
+	case deb.PipelineActionRepoSnapshot:
+		path, body = "/api/repos/"+url.PathEscape(step.Repo)+"/snapshots", gin.H{"Name": step.Snapshot}
+	case deb.PipelineActionSnapshotMerge:
+		path, body = "/api/snapshots/"+url.PathEscape(step.Snapshot)+"/merge", gin.H{"Sources": step.Sources}
+		if step.Latest {
+			path += "?latest=1"
+		}
+	case deb.PipelineActionPublishSwitch:
+		components := make([]string, 0, len(step.Snapshots))
+		for component := range step.Snapshots {
+			components = append(components, component)
+		}
+		sort.Strings(components)
+
+		snapshots := make([]sourceParams, len(components))
+		for i, component := range components {
+			snapshots[i] = sourceParams{Component: component, Name: step.Snapshots[component]}
+		}
+
+		method, path, body = http.MethodPut, publishPath(step.Prefix, step.Distribution), gin.H{"Snapshots": snapshots}
+	case deb.PipelineActionPublishUpdate:
+		method, path, body = http.MethodPut, publishPath(step.Prefix, step.Distribution), gin.H{}
+	default:
+		return nil, fmt.Errorf("unknown action %q", step.Action)
+	}
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// steps are run synchronously one after another within pipeline task
+	query := u.Query()
+	query.Set("_async", "0")
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// @Summary List Pipelines
+// @Description **Get list of pipelines**
+// @Tags Pipelines
+// @Produce json
+// @Success 200 {array} deb.Pipeline
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/pipelines [get]
+func apiPipelinesList(c *gin.Context) {
+	result := []*deb.Pipeline{}
+
+	err := context.NewCollectionFactory().PipelineCollection().ForEach(func(p *deb.Pipeline) error {
+		result = append(result, p)
+		return nil
+	})
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// @Summary Create Pipeline
+// @Description **Create pipeline**
+// @Description
+// @Description Pipeline is a sequence of steps run as single task. Each step is one of actions:
+// @Description `mirror-update`, `mirror-snapshot`, `repo-snapshot`, `snapshot-merge`, `publish-switch` or
+// @Description `publish-update`. Snapshot names could contain `{date}` and `{timestamp}` placeholders which
+// @Description are replaced with the time pipeline run was started.
+// @Tags Pipelines
+// @Consume json
+// @Produce json
+// @Param request body pipelineCreateParams true "Parameters"
+// @Success 201 {object} deb.Pipeline
+// @Failure 400 {object} Error "Invalid pipeline"
+// @Failure 409 {object} Error "Pipeline already exists"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/pipelines [post]
+func apiPipelinesCreate(c *gin.Context) {
+	var b pipelineCreateParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	pipeline := deb.NewPipeline(b.Name, b.Description, b.Steps)
+	if err := pipeline.Validate(); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	collection := context.NewCollectionFactory().PipelineCollection()
+
+	if _, err := collection.ByName(b.Name); err == nil {
+		AbortWithJSONError(c, http.StatusConflict, fmt.Errorf("pipeline with name %s already exists", b.Name))
+		return
+	}
+
+	if err := collection.Add(pipeline); err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, pipeline)
+}
+
+// @Summary Get Pipeline
+// @Description **Get pipeline with state of its last run**
+// @Tags Pipelines
+// @Produce json
+// @Param name path string true "Pipeline name"
+// @Success 200 {object} deb.Pipeline
+// @Failure 404 {object} Error "Pipeline not found"
+// @Router /api/pipelines/{name} [get]
+func apiPipelinesShow(c *gin.Context) {
+	pipeline, err := context.NewCollectionFactory().PipelineCollection().ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pipeline)
+}
+
+// @Summary Update Pipeline
+// @Description **Replace description and steps of pipeline**
+// @Tags Pipelines
+// @Consume json
+// @Produce json
+// @Param name path string true "Pipeline name"
+// @Param request body pipelineParams true "Parameters"
+// @Success 200 {object} deb.Pipeline
+// @Failure 400 {object} Error "Invalid pipeline"
+// @Failure 404 {object} Error "Pipeline not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/pipelines/{name} [put]
+func apiPipelinesUpdate(c *gin.Context) {
+	var b pipelineParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	collection := context.NewCollectionFactory().PipelineCollection()
+
+	pipeline, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	pipeline.Description = b.Description
+	pipeline.Steps = b.Steps
+
+	if err = pipeline.Validate(); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = collection.Update(pipeline); err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pipeline)
+}
+
+// @Summary Delete Pipeline
+// @Description **Delete pipeline**
+// @Tags Pipelines
+// @Produce json
+// @Param name path string true "Pipeline name"
+// @Success 200 ""
+// @Failure 404 {object} Error "Pipeline not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/pipelines/{name} [delete]
+func apiPipelinesDrop(c *gin.Context) {
+	collection := context.NewCollectionFactory().PipelineCollection()
+
+	pipeline, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	if err = collection.Drop(pipeline); err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// @Summary Run Pipeline
+// @Description **Run all steps of pipeline as single task**
+// @Description
+// @Description Steps are run in order, pipeline stops at the first failed step, reporting its error.
+// @Description Time and result of the run are recorded in the pipeline as `LastRun` and `LastError`.
+// @Tags Pipelines
+// @Produce json
+// @Param name path string true "Pipeline name"
+// @Param _async query bool false "Run in background and return task object"
+// @Success 200 {object} deb.Pipeline
+// @Failure 404 {object} Error "Pipeline not found"
+// @Failure 409 {object} Error "Pipeline is already running"
+// @Router /api/pipelines/{name}/run [post]
+func apiPipelinesRun(router http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection := context.NewCollectionFactory().PipelineCollection()
+
+		pipeline, err := collection.ByName(c.Params.ByName("name"))
+		if err != nil {
+			AbortWithJSONError(c, http.StatusNotFound, err)
+			return
+		}
+
+		resources := []string{string(pipeline.Key())}
+		taskName := fmt.Sprintf("Run pipeline %s", pipeline.Name)
+		maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+			pipeline.LastRun = time.Now()
+			code, err := runPipelineSteps(router, pipeline.ExpandSteps(pipeline.LastRun), out)
+
+			pipeline.LastError = ""
+			if err != nil {
+				pipeline.LastError = err.Error()
+			}
+
+			if e := collection.Update(pipeline); e != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, e
+			}
+
+			if err != nil {
+				return &task.ProcessReturnValue{Code: code, Value: nil}, err
+			}
+
+			return &task.ProcessReturnValue{Code: http.StatusOK, Value: pipeline}, nil
+		})
+	}
+}
+
+// runPipelineSteps runs steps one by one, stopping at first failure, which is
+// reported with status code of failed step
+func runPipelineSteps(router http.Handler, steps []deb.PipelineStep, out aptly.Progress) (int, error) {
+	for i := range steps {
+		step := &steps[i]
+		if out.Context().Err() != nil {
+			return http.StatusInternalServerError, fmt.Errorf("step %d (%s): %s", i+1, step.Action, task.ErrCancelled)
+		}
+
+		out.Printf("Step %d/%d: %s\n", i+1, len(steps), step.Action)
+
+		req, err := pipelineStepRequest(step)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("step %d (%s): %s", i+1, step.Action, err)
+		}
+
+		response := &bufferedResponse{header: http.Header{}, code: http.StatusOK}
+		router.ServeHTTP(response, trustedRequest(subtaskRequest(req, out)))
+
+		if response.code >= http.StatusBadRequest {
+			var e Error
+			if json.Unmarshal(response.body.Bytes(), &e) != nil || e.Error == "" {
+				e.Error = http.StatusText(response.code)
+			}
+
+			return response.code, fmt.Errorf("step %d (%s): %s", i+1, step.Action, e.Error)
+		}
+	}
+
+	return http.StatusOK, nil
+}
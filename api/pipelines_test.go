@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	. "gopkg.in/check.v1"
+)
+
+type PipelineSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&PipelineSuite{})
+
+func (s *PipelineSuite) pipelineRequest(c *C, method, url string, body interface{}) *httptest.ResponseRecorder {
+	encoded, err := json.Marshal(body)
+	c.Assert(err, IsNil)
+
+	response, err := s.HTTPRequest(method, url, bytes.NewReader(encoded))
+	c.Assert(err, IsNil)
+
+	return response
+}
+
+func (s *PipelineSuite) TestPipelines(c *C) {
+	collection := s.context.NewCollectionFactory().PipelineCollection()
+
+	response := s.pipelineRequest(c, "POST", "/api/pipelines", map[string]interface{}{
+		"Name":  "nightly",
+		"Steps": []map[string]interface{}{{"Action": "mirror-snapshot", "Mirror": "pipeline-mirror"}},
+	})
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Matches, `.*step 1: mirror and snapshot are required for mirror-snapshot.*`)
+
+	response = s.pipelineRequest(c, "POST", "/api/pipelines", map[string]interface{}{
+		"Name": "nightly",
+		"Steps": []map[string]interface{}{
+			{"Action": "mirror-update", "Mirror": "pipeline-mirror"},
+			{"Action": "mirror-snapshot", "Mirror": "pipeline-mirror", "Snapshot": "pipeline-{date}"},
+		},
+	})
+	c.Assert(response.Code, Equals, 201)
+	defer func() {
+		if pipeline, err := collection.ByName("nightly"); err == nil {
+			collection.Drop(pipeline)
+		}
+	}()
+
+	response = s.pipelineRequest(c, "POST", "/api/pipelines", map[string]interface{}{
+		"Name":  "nightly",
+		"Steps": []map[string]interface{}{{"Action": "mirror-update", "Mirror": "pipeline-mirror"}},
+	})
+	c.Check(response.Code, Equals, 409)
+
+	response = s.pipelineRequest(c, "GET", "/api/pipelines/missing", nil)
+	c.Check(response.Code, Equals, 404)
+
+	response = s.pipelineRequest(c, "PUT", "/api/pipelines/nightly", map[string]interface{}{
+		"Description": "nightly refresh",
+		"Steps":       []map[string]interface{}{{"Action": "mirror-update", "Mirror": "pipeline-mirror"}},
+	})
+	c.Check(response.Code, Equals, 200)
+
+	response = s.pipelineRequest(c, "POST", "/api/pipelines/nightly/run", nil)
+	c.Check(response.Code, Equals, 404)
+	c.Check(response.Body.String(), Matches, `.*step 1 \(mirror-update\): mirror with name pipeline-mirror not found.*`)
+
+	response = s.pipelineRequest(c, "GET", "/api/pipelines", nil)
+	c.Assert(response.Code, Equals, 200)
+
+	var pipelines []deb.Pipeline
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &pipelines), IsNil)
+	c.Assert(pipelines, HasLen, 1)
+	c.Check(pipelines[0].Description, Equals, "nightly refresh")
+	c.Check(pipelines[0].LastRun.IsZero(), Equals, false)
+	c.Check(pipelines[0].LastError, Matches, `step 1 \(mirror-update\): mirror with name pipeline-mirror not found`)
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type poolOrphans struct {
+	// Orphaned files
+	Files []deb.OrphanedPoolFile `json:"Files"`
+	// Number of orphaned files
+	Count int `json:"Count"         example:"2"`
+	// Total size of orphaned files, in bytes
+	TotalSize int64 `json:"TotalSize" example:"1048576"`
+}
+
+func newPoolOrphans(files []deb.OrphanedPoolFile) *poolOrphans {
+	result := &poolOrphans{Files: files, Count: len(files)}
+	for _, f := range files {
+		result.TotalSize += f.Size
+	}
+
+	return result
+}
+
+// @Summary List Orphaned Pool Files
+// @Description **Get list of files in package pool not used by packages of mirrors, local repos, snapshots and published repositories**
+// @Description
+// @Description Files of packages which are still in database, but are not referenced anymore are listed as well.
+// @Tags Pool
+// @Produce json
+// @Success 200 {object} poolOrphans
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/pool/orphans [get]
+func apiPoolOrphans(c *gin.Context) {
+	files, err := deb.OrphanedPoolFiles(context.NewCollectionFactory(), context.PackagePool(), nil)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPoolOrphans(files))
+}
+
+type poolOrphansPruneParams struct {
+	// Only report files which would be removed
+	DryRun bool `   json:"DryRun" example:"false"`
+	// Remove only these orphaned files (paths relative to package pool), all orphaned files if empty
+	Files []string `json:"Files"  example:"ab/cd/abcdef_package_1.0_amd64.deb"`
+}
+
+type poolOrphansPruneResult struct {
+	poolOrphans
+	// Files were not removed
+	DryRun bool `json:"DryRun" example:"false"`
+}
+
+// @Summary Prune Orphaned Pool Files
+// @Description **Remove files in package pool not used by packages of mirrors, local repos, snapshots and published repositories**
+// @Description
+// @Description Unlike `POST /api/db/cleanup`, packages in database are left intact and only selected files could be removed.
+// @Description Files which are not orphaned anymore are skipped.
+// @Tags Pool
+// @Consume json
+// @Param request body poolOrphansPruneParams true "Parameters"
+// @Produce json
+// @Success 200 {object} poolOrphansPruneResult
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/pool/orphans/prune [post]
+func apiPoolOrphansPrune(c *gin.Context) {
+	var b poolOrphansPruneParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	selected := map[string]bool{}
+	for _, path := range b.Files {
+		selected[path] = true
+	}
+
+	resources := []string{string(task.AllResourcesKey)}
+	maybeRunTaskInBackground(c, "Prune orphaned pool files", resources, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+		files, err := deb.OrphanedPoolFiles(context.NewCollectionFactory(), context.PackagePool(), out)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
+		if len(selected) > 0 {
+			filtered := []deb.OrphanedPoolFile{}
+			for _, f := range files {
+				if selected[f.Path] {
+					filtered = append(filtered, f)
+				}
+			}
+			files = filtered
+		}
+
+		result := &poolOrphansPruneResult{poolOrphans: *newPoolOrphans(files), DryRun: b.DryRun}
+		if b.DryRun {
+			return &task.ProcessReturnValue{Code: http.StatusOK, Value: result}, nil
+		}
+
+		out.Printf("Deleting orphaned files (%d)...", len(files))
+
+		taskDetail := struct {
+			TotalNumberOfFilesToDelete     int
+			RemainingNumberOfFilesToDelete int
+		}{
+			len(files), len(files),
+		}
+		detail.Store(taskDetail)
+
+		for _, f := range files {
+			if _, err = context.PackagePool().Remove(f.Path); err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to remove %s: %s", f.Path, err)
+			}
+
+			taskDetail.RemainingNumberOfFilesToDelete--
+			detail.Store(taskDetail)
+		}
+
+		out.Printf("Disk space freed: %s...", utils.HumanBytes(result.TotalSize))
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: result}, nil
+	})
+}
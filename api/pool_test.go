@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+
+	. "gopkg.in/check.v1"
+)
+
+type PoolSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&PoolSuite{})
+
+func (s *PoolSuite) TestOrphans(c *C) {
+	path := "zz/zz/api-orphan-test_1.0_all.deb"
+	fullPath := s.context.PackagePool().(aptly.LocalPackagePool).FullPath(path)
+	c.Assert(os.MkdirAll(filepath.Dir(fullPath), 0755), IsNil)
+	c.Assert(os.WriteFile(fullPath, []byte("orphan"), 0644), IsNil)
+	defer os.Remove(fullPath)
+
+	response, err := s.HTTPRequest("GET", "/api/pool/orphans", nil)
+	c.Assert(err, IsNil)
+	c.Assert(response.Code, Equals, 200)
+
+	var orphans poolOrphans
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &orphans), IsNil)
+	c.Check(orphans.Count, Equals, len(orphans.Files))
+
+	found := false
+	for _, f := range orphans.Files {
+		if f.Path == path {
+			found = true
+			c.Check(f.Size, Equals, int64(6))
+		}
+	}
+	c.Check(found, Equals, true)
+
+	var result poolOrphansPruneResult
+
+	response, err = s.HTTPRequest("POST", "/api/pool/orphans/prune", strings.NewReader(`{"DryRun": true, "Files": ["`+path+`"]}`))
+	c.Assert(err, IsNil)
+	c.Assert(response.Code, Equals, 200)
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result.DryRun, Equals, true)
+	c.Check(result.Count, Equals, 1)
+	c.Check(result.TotalSize, Equals, int64(6))
+	_, err = os.Stat(fullPath)
+	c.Check(err, IsNil)
+
+	response, err = s.HTTPRequest("POST", "/api/pool/orphans/prune", strings.NewReader(`{"Files": ["`+path+`"]}`))
+	c.Assert(err, IsNil)
+	c.Assert(response.Code, Equals, 200)
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result.DryRun, Equals, false)
+	c.Check(result.Count, Equals, 1)
+
+	_, err = os.Stat(fullPath)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
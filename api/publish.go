@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/deb"
 	"github.com/aptly-dev/aptly/pgp"
+	"github.com/aptly-dev/aptly/query"
 	"github.com/aptly-dev/aptly/task"
 	"github.com/aptly-dev/aptly/utils"
 	"github.com/gin-gonic/gin"
@@ -26,6 +28,23 @@ type signingParams struct {
 	Passphrase string `        json:"Passphrase"     example:"verysecure"`
 	// GPG passphrase file to unlock private key (possibly insecure)
 	PassphraseFile string `    json:"PassphraseFile" example:"/etc/aptly.passphrase"`
+	// Signing backend: gpg, vault, awskms or external-cmd, default from configuration if not specified
+	Backend string `           json:"Backend"        example:"vault"`
+	// Additional keys to sign the release with (e.g. during key rotation), signatures of all the keys are published
+	Keys []signingKeyParams `  json:"Keys"`
+}
+
+type signingKeyParams struct {
+	// GPG key ID to use when signing the release
+	GpgKey string `            json:"GpgKey"         example:"F30E8CB9CDDE2AF8"`
+	// GPG keyring to use, defaults to Keyring of signing options
+	Keyring string `           json:"Keyring"        example:"trustedkeys.gpg"`
+	// GPG secret keyring to use, defaults to SecretKeyring of signing options
+	SecretKeyring string `     json:"SecretKeyring"  example:""`
+	// GPG passphrase to unlock private key, defaults to Passphrase of signing options
+	Passphrase string `        json:"Passphrase"     example:"verysecure"`
+	// GPG passphrase file to unlock private key, defaults to PassphraseFile of signing options
+	PassphraseFile string `    json:"PassphraseFile" example:"/etc/aptly.passphrase"`
 }
 
 type sourceParams struct {
@@ -33,22 +52,77 @@ type sourceParams struct {
 	Component string `binding:"required"   json:"Component"  example:"main"`
 	// Name of the local repository/snapshot
 	Name string `binding:"required"        json:"Name"       example:"snap1"`
+	// Package query to publish only matching packages of the source in this component (optional)
+	Filter string `                        json:"Filter"     example:"Priority (required)"`
+}
+
+// checkSourceFilters verifies syntax of package queries filtering sources
+func checkSourceFilters(sources []sourceParams) error {
+	for _, source := range sources {
+		if source.Filter == "" {
+			continue
+		}
+
+		if _, err := query.Parse(source.Filter); err != nil {
+			return fmt.Errorf("unable to parse filter of component %s: %s", source.Component, err)
+		}
+	}
+
+	return nil
 }
 
-func getSigner(options *signingParams) (pgp.Signer, error) {
+func getSigner(options *signingParams) (pgp.FileSigner, error) {
 	if options.Skip {
 		return nil, nil
 	}
 
-	signer := context.GetSigner()
-	signer.SetKey(options.GpgKey)
-	signer.SetKeyRing(options.Keyring, options.SecretKeyring)
-	signer.SetPassphrase(options.Passphrase, options.PassphraseFile)
+	if len(options.Keys) == 0 {
+		return newSigner(options.Backend, &signingKeyParams{GpgKey: options.GpgKey, Keyring: options.Keyring,
+			SecretKeyring: options.SecretKeyring, Passphrase: options.Passphrase, PassphraseFile: options.PassphraseFile})
+	}
+
+	keys := options.Keys
+	if options.GpgKey != "" {
+		keys = append([]signingKeyParams{{GpgKey: options.GpgKey}}, keys...)
+	}
+
+	signers := make([]pgp.Signer, 0, len(keys))
+	for i := range keys {
+		key := keys[i]
+		if key.GpgKey == "" {
+			return nil, fmt.Errorf("GPG key should be specified for each of signing keys")
+		}
+		if key.Keyring == "" && key.SecretKeyring == "" {
+			key.Keyring, key.SecretKeyring = options.Keyring, options.SecretKeyring
+		}
+		if key.Passphrase == "" && key.PassphraseFile == "" {
+			key.Passphrase, key.PassphraseFile = options.Passphrase, options.PassphraseFile
+		}
+
+		signer, err := newSigner(options.Backend, &key)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	return pgp.NewMultiSigner(signers...), nil
+}
+
+func newSigner(backend string, key *signingKeyParams) (pgp.Signer, error) {
+	signer, err := context.GetSignerForBackend(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	signer.SetKey(key.GpgKey)
+	signer.SetKeyRing(key.Keyring, key.SecretKeyring)
+	signer.SetPassphrase(key.Passphrase, key.PassphraseFile)
 
 	// If Batch is false, GPG will ask for passphrase on stdin, which would block the api process
 	signer.SetBatch(true)
 
-	err := signer.Init()
+	err = signer.Init()
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +140,34 @@ func slashEscape(path string) string {
 	return result
 }
 
+// estimatePublish stores pre-flight estimation of files to be published in task detail
+// and checks it against confirmation threshold
+//
+// Estimation loads all the packages and probes published storage for every pool file, so it
+// is skipped unless it was requested or confirmation threshold is configured.
+func estimatePublish(published *deb.PublishedRepo, collectionFactory *deb.CollectionFactory,
+	publishOutput *task.PublishOutput, requested, confirmed bool) (*task.ProcessReturnValue, error) {
+	if !requested && context.Config().EstimateConfirmThreshold <= 0 {
+		return nil, nil
+	}
+
+	estimate, err := published.Estimate(collectionFactory, context)
+	if err != nil {
+		return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to estimate: %s", err)
+	}
+
+	publishOutput.EstimatedNumberOfFiles = estimate.NumberOfFiles
+	publishOutput.EstimatedSize = estimate.TotalSize
+	publishOutput.Store(publishOutput)
+
+	err = checkEstimate(estimate.TotalSize, confirmed)
+	if err != nil {
+		return &task.ProcessReturnValue{Code: http.StatusPreconditionFailed, Value: estimate}, err
+	}
+
+	return nil, nil
+}
+
 // @Summary List Published Repositories
 // @Description **Get list of published repositories**
 // @Description
@@ -84,6 +186,10 @@ func apiPublishList(c *gin.Context) {
 	repos := make([]*deb.PublishedRepo, 0, collection.Len())
 
 	err := collection.ForEach(func(repo *deb.PublishedRepo) error {
+		if !tenantVisible(c, repo.Prefix) {
+			return nil
+		}
+
 		err := collection.LoadShallow(repo, collectionFactory)
 		if err != nil {
 			return err
@@ -139,6 +245,35 @@ func apiPublishShow(c *gin.Context) {
 	c.JSON(http.StatusOK, published)
 }
 
+// GET /api/publish/:prefix/:distribution/vulnerabilities
+func apiPublishVulnerabilities(c *gin.Context) {
+	param := slashEscape(c.Params.ByName("prefix"))
+	storage, prefix := deb.ParsePrefix(param)
+	distribution := slashEscape(c.Params.ByName("distribution"))
+
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.PublishedRepoCollection()
+
+	published, err := collection.ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("unable to check: %s", err))
+		return
+	}
+
+	err = collection.LoadComplete(published, collectionFactory)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to check: %s", err))
+		return
+	}
+
+	reflists := []*deb.PackageRefList{}
+	for _, component := range published.Components() {
+		reflists = append(reflists, published.RefList(component))
+	}
+
+	showVulnerabilities(c, reflists, collectionFactory)
+}
+
 type publishedRepoCreateParams struct {
 	// 'local' for local repositories and 'snapshot' for snapshots
 	SourceKind string `binding:"required"         json:"SourceKind"    example:"snapshot"`
@@ -166,10 +301,38 @@ type publishedRepoCreateParams struct {
 	SkipCleanup *bool `                           json:"SkipCleanup"           example:"false"`
 	// Skip bz2 compression for index files
 	SkipBz2 *bool `                               json:"SkipBz2"               example:"false"`
+	// Generate zstd compressed index files (Packages.zst, Contents.zst)
+	EnableZst *bool `                             json:"EnableZst"             example:"false"`
 	// Provide index files by hash
 	AcquireByHash *bool `                         json:"AcquireByHash"         example:"false"`
+	// Number of previous generations of index files kept under by-hash (0 - default of 1)
+	ByHashDepth *int `                            json:"ByHashDepth"           example:"3"`
+	// Generate diffs of package indexes (pdiffs) for incremental updates by clients
+	GenerateDiffs *bool `                         json:"GenerateDiffs"         example:"false"`
+	// Number of patches kept in diffs of package indexes (0 - default of 20)
+	DiffsDepth *int `                             json:"DiffsDepth"            example:"20"`
 	// Enable multiple packages with the same filename in different distributions
 	MultiDist *bool `                             json:"MultiDist"             example:"false"`
+	// Publish new generation of indexes into separate directory and swap it into place atomically
+	BlueGreen *bool `                             json:"BlueGreen"             example:"false"`
+	// Publish flat repository without dists/<distribution> hierarchy, it should have exactly one component
+	Flat bool `                                   json:"Flat"                  example:"false"`
+	// Estimate number and size of files to be published before publishing, always done if confirmation threshold is configured
+	Estimate bool `                               json:"Estimate"              example:"false"`
+	// Confirm publishing if estimated size exceeds configured threshold
+	ConfirmEstimate bool `                        json:"ConfirmEstimate"       example:"false"`
+	// Overrides of binary package fields in published indexes: package name -> field -> value
+	Overrides map[string]map[string]string `      json:"Overrides"`
+	// Overrides of source package fields in published indexes: package name -> field -> value
+	SourceOverrides map[string]map[string]string `json:"SourceOverrides"`
+	// Handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only
+	ExtraSourceOnly string `                      json:"ExtraSourceOnly"       example:"keep"`
+	// Handling of source packages without binaries: keep, drop or keep-referenced-only
+	OrphanedSources string `                      json:"OrphanedSources"       example:"keep"`
+	// Placement of Architecture: all packages: duplicate (into every binary-<arch> index), separate (binary-all index only) or both
+	ArchitectureAll string `                      json:"ArchitectureAll"       example:"duplicate"`
+	// Name of resource template with default settings
+	Template string `                             json:"Template"              example:"standard"`
 }
 
 // @Summary Create Published Repository
@@ -179,6 +342,9 @@ type publishedRepoCreateParams struct {
 // @Description
 // @Description The prefix may contain a storage specifier, e.g. `s3:packages/`, or it may also be empty to publish to the root directory.
 // @Description
+// @Description Source could be published under any component name, and the same source could be split into several components
+// @Description by package query in `Filter`, without creating filtered snapshots.
+// @Description
 // @Description See also: `aptly publish create`
 // @Tags Publish
 // @Param prefix path string true "publishing prefix"
@@ -189,6 +355,7 @@ type publishedRepoCreateParams struct {
 // @Failure 400 {object} Error "Bad Request"
 // @Failure 404 {object} Error "Source not found"
 // @Failure 500 {object} Error "Internal Error"
+// @Failure 412 {object} Error "Estimated size exceeds confirmation threshold"
 // @Router /api/publish/{prefix} [post]
 func apiPublishRepoOrSnapshot(c *gin.Context) {
 	var (
@@ -202,7 +369,7 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 	param := slashEscape(c.Params.ByName("prefix"))
 	storage, prefix := deb.ParsePrefix(param)
 
-	if c.Bind(&b) != nil {
+	if !bindWithTemplate(c, &b) {
 		return
 	}
 
@@ -214,7 +381,19 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 	}
 	b.Architectures = archs
 
-	signer, err := getSigner(&b.Signing)
+	for _, mode := range []string{b.ExtraSourceOnly, b.OrphanedSources} {
+		if err := deb.ValidateSourceHandling(mode); err != nil {
+			AbortWithJSONError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if err := deb.ValidateArchitectureAllPlacement(b.ArchitectureAll); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	signer, err := getSigner(tenantSigning(prefix, &b.Signing))
 	if err != nil {
 		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
 		return
@@ -225,6 +404,11 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 		return
 	}
 
+	if err = checkSourceFilters(b.Sources); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("unable to publish: %s", err))
+		return
+	}
+
 	collectionFactory := context.NewCollectionFactory()
 
 	if b.SourceKind == deb.SourceSnapshot {
@@ -309,6 +493,12 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 
 		resources = append(resources, string(published.Key()))
 
+		for _, source := range b.Sources {
+			if err = published.SetComponentFilter(source.Component, source.Filter); err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("unable to publish: %s", err)
+			}
+		}
+
 		if b.Origin != "" {
 			published.Origin = b.Origin
 		}
@@ -330,16 +520,53 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 			published.SkipBz2 = *b.SkipBz2
 		}
 
+		published.EnableZst = context.Config().EnableZstPublishing
+		if b.EnableZst != nil {
+			published.EnableZst = *b.EnableZst
+		}
+
 		if b.AcquireByHash != nil {
 			published.AcquireByHash = *b.AcquireByHash
 		}
 
+		if b.ByHashDepth != nil {
+			published.ByHashDepth = *b.ByHashDepth
+		}
+
+		published.GenerateDiffs = context.Config().GenerateDiffs
+		if b.GenerateDiffs != nil {
+			published.GenerateDiffs = *b.GenerateDiffs
+		}
+
+		if b.DiffsDepth != nil {
+			published.DiffsDepth = *b.DiffsDepth
+		}
+
+		if b.BlueGreen != nil {
+			published.BlueGreen = *b.BlueGreen
+		}
+
+		published.Flat = b.Flat
+		if err = published.CheckFlat(); err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("unable to publish: %s", err)
+		}
+
+		published.Overrides = publishOverrides(b.Overrides, b.SourceOverrides)
+		published.ExtraSourceOnly = b.ExtraSourceOnly
+		published.OrphanedSources = b.OrphanedSources
+		published.ArchitectureAll = b.ArchitectureAll
+
 		duplicate := collection.CheckDuplicate(published)
 		if duplicate != nil {
 			collectionFactory.PublishedRepoCollection().LoadComplete(duplicate, collectionFactory)
 			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("prefix/distribution already used by another published repo: %s", duplicate)
 		}
 
+		retValue, err := estimatePublish(published, collectionFactory, publishOutput, b.Estimate, b.ConfirmEstimate)
+		if err != nil {
+			return retValue, err
+		}
+
 		err = published.Publish(context.PackagePool(), context, collectionFactory, signer, publishOutput, b.ForceOverwrite, context.SkelPath())
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to publish: %s", err)
@@ -350,10 +577,35 @@ func apiPublishRepoOrSnapshot(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
 		}
 
+		context.PublishChanged(utils.NotifyEventPublishCreated, published, out)
+
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: published}, nil
 	})
 }
 
+// publishOverrides converts inline overrides from API parameters, nil is returned if there are none
+func publishOverrides(binary, source map[string]map[string]string) *deb.PublishOverrides {
+	overrides := deb.NewPublishOverrides()
+
+	for name, fields := range binary {
+		for field, value := range fields {
+			overrides.SetBinaryField(name, field, value)
+		}
+	}
+
+	for name, fields := range source {
+		for field, value := range fields {
+			overrides.SetSourceField(name, field, value)
+		}
+	}
+
+	if overrides.Empty() {
+		return nil
+	}
+
+	return overrides
+}
+
 type publishedRepoUpdateSwitchParams struct {
 	// when publishing, overwrite files in pool/ directory without notice
 	ForceOverwrite bool `                         json:"ForceOverwrite" example:"false"`
@@ -363,14 +615,38 @@ type publishedRepoUpdateSwitchParams struct {
 	SkipContents *bool `                          json:"SkipContents"   example:"false"`
 	// Skip bz2 compression for index files
 	SkipBz2 *bool `                               json:"SkipBz2"        example:"false"`
+	// Generate zstd compressed index files (Packages.zst, Contents.zst)
+	EnableZst *bool `                             json:"EnableZst"      example:"false"`
 	// Don't remove unreferenced files in prefix/component
 	SkipCleanup *bool `                           json:"SkipCleanup"    example:"false"`
 	// only when updating published snapshots, list of objects 'Component/Name'
 	Snapshots []sourceParams `                    json:"Snapshots"`
 	// Provide index files by hash
 	AcquireByHash *bool `                         json:"AcquireByHash"  example:"false"`
+	// Number of previous generations of index files kept under by-hash (0 - default of 1)
+	ByHashDepth *int `                            json:"ByHashDepth"    example:"3"`
+	// Generate diffs of package indexes (pdiffs) for incremental updates by clients
+	GenerateDiffs *bool `                         json:"GenerateDiffs"  example:"false"`
+	// Number of patches kept in diffs of package indexes (0 - default of 20)
+	DiffsDepth *int `                             json:"DiffsDepth"     example:"20"`
 	// Enable multiple packages with the same filename in different distributions
 	MultiDist *bool `                             json:"MultiDist"      example:"false"`
+	// Publish new generation of indexes into separate directory and swap it into place atomically
+	BlueGreen *bool `                             json:"BlueGreen"      example:"false"`
+	// Estimate number and size of files to be published before publishing, always done if confirmation threshold is configured
+	Estimate bool `                               json:"Estimate"        example:"false"`
+	// Confirm publishing if estimated size exceeds configured threshold
+	ConfirmEstimate bool `                        json:"ConfirmEstimate" example:"false"`
+	// Replace overrides of binary package fields in published indexes: package name -> field -> value
+	Overrides map[string]map[string]string `      json:"Overrides"`
+	// Replace overrides of source package fields in published indexes: package name -> field -> value
+	SourceOverrides map[string]map[string]string `json:"SourceOverrides"`
+	// Handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only
+	ExtraSourceOnly *string `                     json:"ExtraSourceOnly" example:"keep"`
+	// Handling of source packages without binaries: keep, drop or keep-referenced-only
+	OrphanedSources *string `                     json:"OrphanedSources" example:"keep"`
+	// Placement of Architecture: all packages: duplicate (into every binary-<arch> index), separate (binary-all index only) or both
+	ArchitectureAll *string `                     json:"ArchitectureAll" example:"duplicate"`
 }
 
 // @Summary Update Published Repository
@@ -396,6 +672,8 @@ type publishedRepoUpdateSwitchParams struct {
 // @Failure 400 {object} Error "Bad Request"
 // @Failure 404 {object} Error "Published repository or source not found"
 // @Failure 500 {object} Error "Internal Error"
+// @Failure 412 {object} Error "Estimated size exceeds confirmation threshold"
+// @Failure 423 {object} Error "Published repository is frozen"
 // @Router /api/publish/{prefix}/{distribution} [put]
 func apiPublishUpdateSwitch(c *gin.Context) {
 	var b publishedRepoUpdateSwitchParams
@@ -408,9 +686,25 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 		return
 	}
 
-	signer, err := getSigner(&b.Signing)
-	if err != nil {
-		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+	for _, mode := range []*string{b.ExtraSourceOnly, b.OrphanedSources} {
+		if mode == nil {
+			continue
+		}
+		if err := deb.ValidateSourceHandling(*mode); err != nil {
+			AbortWithJSONError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if b.ArchitectureAll != nil {
+		if err := deb.ValidateArchitectureAllPlacement(*b.ArchitectureAll); err != nil {
+			AbortWithJSONError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if err := checkSourceFilters(b.Snapshots); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("unable to update: %s", err))
 		return
 	}
 
@@ -424,6 +718,10 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 		return
 	}
 
+	if abortIfFrozen(c, published) {
+		return
+	}
+
 	if published.SourceKind == deb.SourceLocalRepo {
 		if len(b.Snapshots) > 0 {
 			AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("snapshots shouldn't be given when updating local repo"))
@@ -450,17 +748,68 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 		published.SkipBz2 = *b.SkipBz2
 	}
 
+	if b.EnableZst != nil {
+		published.EnableZst = *b.EnableZst
+	}
+
 	if b.AcquireByHash != nil {
 		published.AcquireByHash = *b.AcquireByHash
 	}
 
+	if b.ByHashDepth != nil {
+		published.ByHashDepth = *b.ByHashDepth
+	}
+
+	if b.GenerateDiffs != nil {
+		published.GenerateDiffs = *b.GenerateDiffs
+	}
+
+	if b.DiffsDepth != nil {
+		published.DiffsDepth = *b.DiffsDepth
+	}
+
 	if b.MultiDist != nil {
 		published.MultiDist = *b.MultiDist
 	}
 
+	if b.BlueGreen != nil {
+		published.BlueGreen = *b.BlueGreen
+	}
+
+	if b.Overrides != nil || b.SourceOverrides != nil {
+		published.Overrides = publishOverrides(b.Overrides, b.SourceOverrides)
+	}
+
+	if b.ExtraSourceOnly != nil {
+		published.ExtraSourceOnly = *b.ExtraSourceOnly
+	}
+
+	if b.OrphanedSources != nil {
+		published.OrphanedSources = *b.OrphanedSources
+	}
+
+	if b.ArchitectureAll != nil {
+		published.ArchitectureAll = *b.ArchitectureAll
+	}
+
+	if stagePublishUpdate(c, published, collectionFactory, b.Snapshots) {
+		return
+	}
+
+	signer, err := getSigner(tenantSigning(published.Prefix, &b.Signing))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+		return
+	}
+
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+		publishOutput := &task.PublishOutput{
+			Progress:      out,
+			PublishDetail: task.PublishDetail{Detail: detail},
+		}
+
 		err = collection.LoadComplete(published, collectionFactory)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("Unable to update: %s", err)
@@ -482,7 +831,22 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("Unable to update: %s", err)
 		}
 
-		err = published.Publish(context.PackagePool(), context, collectionFactory, signer, out, b.ForceOverwrite, context.SkelPath())
+		// filters of components are kept when switching snapshots, unless new filter is given
+		for _, snapshotInfo := range b.Snapshots {
+			if snapshotInfo.Filter == "" {
+				continue
+			}
+			if err = published.SetComponentFilter(snapshotInfo.Component, snapshotInfo.Filter); err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("Unable to update: %s", err)
+			}
+		}
+
+		retValue, err := estimatePublish(published, collectionFactory, publishOutput, b.Estimate, b.ConfirmEstimate)
+		if err != nil {
+			return retValue, err
+		}
+
+		err = published.Publish(context.PackagePool(), context, collectionFactory, signer, publishOutput, b.ForceOverwrite, context.SkelPath())
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("Unable to update: %s", err)
 		}
@@ -495,12 +859,21 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 		if b.SkipCleanup == nil || !*b.SkipCleanup {
 			cleanComponents := make([]string, 0, len(result.UpdatedSources)+len(result.RemovedSources))
 			cleanComponents = append(append(cleanComponents, result.UpdatedComponents()...), result.RemovedComponents()...)
+			cleanupStart := time.Now()
 			err = collection.CleanupPrefixComponentFiles(context, published, cleanComponents, collectionFactory, out)
 			if err != nil {
 				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 			}
+
+			published.RecordCleanup(time.Since(cleanupStart))
+			err = collection.Update(published)
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+			}
 		}
 
+		context.PublishChanged(utils.NotifyEventPublishUpdated, published, out)
+
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: published}, nil
 	})
 }
@@ -523,6 +896,7 @@ func apiPublishUpdateSwitch(c *gin.Context) {
 // @Failure 400 {object} Error "Bad Request"
 // @Failure 404 {object} Error "Published repository not found"
 // @Failure 500 {object} Error "Internal Error"
+// @Failure 423 {object} Error "Published repository is frozen"
 // @Router /api/publish/{prefix}/{distribution} [delete]
 func apiPublishDrop(c *gin.Context) {
 	param := slashEscape(c.Params.ByName("prefix"))
@@ -541,6 +915,10 @@ func apiPublishDrop(c *gin.Context) {
 		return
 	}
 
+	if abortIfFrozen(c, published) {
+		return
+	}
+
 	resources := []string{string(published.Key())}
 	taskName := fmt.Sprintf("Delete published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
 	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
@@ -550,6 +928,8 @@ func apiPublishDrop(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to drop: %s", err)
 		}
 
+		context.PublishChanged(utils.NotifyEventPublishDropped, published, out)
+
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{}}, nil
 	})
 }
@@ -937,12 +1317,26 @@ type publishedRepoUpdateParams struct {
 	SkipContents *bool `                          json:"SkipContents"    example:"false"`
 	// Skip bz2 compression for index files
 	SkipBz2 *bool `                               json:"SkipBz2"         example:"false"`
+	// Generate zstd compressed index files (Packages.zst, Contents.zst)
+	EnableZst *bool `                             json:"EnableZst"       example:"false"`
 	// Don't remove unreferenced files in prefix/component
 	SkipCleanup *bool `                           json:"SkipCleanup"     example:"false"`
 	// Provide index files by hash
 	AcquireByHash *bool `                         json:"AcquireByHash"   example:"false"`
+	// Number of previous generations of index files kept under by-hash (0 - default of 1)
+	ByHashDepth *int `                            json:"ByHashDepth"     example:"3"`
+	// Generate diffs of package indexes (pdiffs) for incremental updates by clients
+	GenerateDiffs *bool `                         json:"GenerateDiffs"   example:"false"`
+	// Number of patches kept in diffs of package indexes (0 - default of 20)
+	DiffsDepth *int `                             json:"DiffsDepth"      example:"20"`
 	// Enable multiple packages with the same filename in different distributions
 	MultiDist *bool `                             json:"MultiDist"       example:"false"`
+	// Publish new generation of indexes into separate directory and swap it into place atomically
+	BlueGreen *bool `                             json:"BlueGreen"       example:"false"`
+	// Estimate number and size of files to be published before publishing, always done if confirmation threshold is configured
+	Estimate bool `                               json:"Estimate"        example:"false"`
+	// Confirm publishing if estimated size exceeds configured threshold
+	ConfirmEstimate bool `                        json:"ConfirmEstimate" example:"false"`
 }
 
 // @Summary Update Published Repository
@@ -950,6 +1344,8 @@ type publishedRepoUpdateParams struct {
 // @Description
 // @Description Publish pending source component changes which were added with `Add/Remove/Replace Source Components`
 // @Description
+// @Description If publish approval is enabled, changes are held until approved with `POST /api/publish/{prefix}/{distribution}/approve`.
+// @Description
 // @Description See also: `aptly publish update`
 // @Tags Publish
 // @Param prefix path string true "publishing prefix"
@@ -958,9 +1354,13 @@ type publishedRepoUpdateParams struct {
 // @Param request body publishedRepoUpdateParams true "Parameters"
 // @Produce json
 // @Success 200 {object} deb.PublishedRepo
+// @Success 202 {object} deb.PublishedRepo "Update held for approval"
 // @Failure 400 {object} Error "Bad Request"
+// @Failure 401 {object} Error "Not authenticated as publish approval user"
 // @Failure 404 {object} Error "Published repository/component not found"
 // @Failure 500 {object} Error "Internal Error"
+// @Failure 412 {object} Error "Estimated size exceeds confirmation threshold"
+// @Failure 423 {object} Error "Published repository is frozen"
 // @Router /api/publish/{prefix}/{distribution}/update [post]
 func apiPublishUpdate(c *gin.Context) {
 	var b publishedRepoUpdateParams
@@ -973,12 +1373,6 @@ func apiPublishUpdate(c *gin.Context) {
 		return
 	}
 
-	signer, err := getSigner(&b.Signing)
-	if err != nil {
-		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
-		return
-	}
-
 	collectionFactory := context.NewCollectionFactory()
 	collection := collectionFactory.PublishedRepoCollection()
 
@@ -994,6 +1388,30 @@ func apiPublishUpdate(c *gin.Context) {
 		return
 	}
 
+	if abortIfFrozen(c, published) {
+		return
+	}
+
+	if stagePublishUpdate(c, published, collectionFactory, nil) {
+		return
+	}
+
+	signer, err := getSigner(tenantSigning(published.Prefix, &b.Signing))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+		return
+	}
+
+	resources := []string{string(published.Key())}
+	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
+	maybeRunTaskInBackground(c, taskName, resources, publishUpdateProcess(published, collectionFactory, signer, &b))
+}
+
+// publishUpdateProcess returns task publishing pending changes of published repository
+func publishUpdateProcess(published *deb.PublishedRepo, collectionFactory *deb.CollectionFactory, signer pgp.FileSigner,
+	b *publishedRepoUpdateParams) task.Process {
+	collection := collectionFactory.PublishedRepoCollection()
+
 	if b.SkipContents != nil {
 		published.SkipContents = *b.SkipContents
 	}
@@ -1002,23 +1420,51 @@ func apiPublishUpdate(c *gin.Context) {
 		published.SkipBz2 = *b.SkipBz2
 	}
 
+	if b.EnableZst != nil {
+		published.EnableZst = *b.EnableZst
+	}
+
 	if b.AcquireByHash != nil {
 		published.AcquireByHash = *b.AcquireByHash
 	}
 
+	if b.ByHashDepth != nil {
+		published.ByHashDepth = *b.ByHashDepth
+	}
+
+	if b.GenerateDiffs != nil {
+		published.GenerateDiffs = *b.GenerateDiffs
+	}
+
+	if b.DiffsDepth != nil {
+		published.DiffsDepth = *b.DiffsDepth
+	}
+
 	if b.MultiDist != nil {
 		published.MultiDist = *b.MultiDist
 	}
 
-	resources := []string{string(published.Key())}
-	taskName := fmt.Sprintf("Update published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
-	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	if b.BlueGreen != nil {
+		published.BlueGreen = *b.BlueGreen
+	}
+
+	return func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+		publishOutput := &task.PublishOutput{
+			Progress:      out,
+			PublishDetail: task.PublishDetail{Detail: detail},
+		}
+
 		result, err := published.Update(collectionFactory, out)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
 
-		err = published.Publish(context.PackagePool(), context, collectionFactory, signer, out, b.ForceOverwrite, context.SkelPath())
+		retValue, err := estimatePublish(published, collectionFactory, publishOutput, b.Estimate, b.ConfirmEstimate)
+		if err != nil {
+			return retValue, err
+		}
+
+		err = published.Publish(context.PackagePool(), context, collectionFactory, signer, publishOutput, b.ForceOverwrite, context.SkelPath())
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 		}
@@ -1031,12 +1477,21 @@ func apiPublishUpdate(c *gin.Context) {
 		if b.SkipCleanup == nil || !*b.SkipCleanup {
 			cleanComponents := make([]string, 0, len(result.UpdatedSources)+len(result.RemovedSources))
 			cleanComponents = append(append(cleanComponents, result.UpdatedComponents()...), result.RemovedComponents()...)
+			cleanupStart := time.Now()
 			err = collection.CleanupPrefixComponentFiles(context, published, cleanComponents, collectionFactory, out)
 			if err != nil {
 				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
 			}
+
+			published.RecordCleanup(time.Since(cleanupStart))
+			err = collection.Update(published)
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+			}
 		}
 
+		context.PublishChanged(utils.NotifyEventPublishUpdated, published, out)
+
 		return &task.ProcessReturnValue{Code: http.StatusOK, Value: published}, nil
-	})
+	}
 }
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+)
+
+// stagePublishUpdate holds update of published repository for approval, if
+// approval is required by configuration
+//
+// Returns true if request was handled (either staged or rejected).
+func stagePublishUpdate(c *gin.Context, published *deb.PublishedRepo, collectionFactory *deb.CollectionFactory, snapshots []sourceParams) bool {
+	approval := context.Config().PublishApproval
+	if !approval.Enabled {
+		return false
+	}
+
+	principal := approval.Principal(c.Request)
+	if principal == "" {
+		c.Header("WWW-Authenticate", `Basic realm="aptly"`)
+		AbortWithJSONError(c, http.StatusUnauthorized, fmt.Errorf("publish approval is required, authenticate as one of publish approval users"))
+		return true
+	}
+
+	collection := collectionFactory.PublishedRepoCollection()
+
+	resources := []string{string(published.Key())}
+	taskName := fmt.Sprintf("Request update of published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
+	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		err := collection.LoadComplete(published, collectionFactory)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to update: %s", err)
+		}
+
+		revision := published.ObtainRevision()
+		for _, snapshotInfo := range snapshots {
+			revision.Sources[snapshotInfo.Component] = snapshotInfo.Name
+		}
+
+		sources := make(map[string]string, len(revision.Sources))
+		for component, name := range revision.Sources {
+			sources[component] = name
+		}
+
+		published.Approval = &deb.PublishApproval{
+			RequestedBy: principal,
+			RequestedAt: time.Now(),
+			Sources:     sources,
+		}
+
+		err = collection.Update(published)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusAccepted, Value: published}, nil
+	})
+
+	return true
+}
+
+// loadPendingApproval looks up published repository with pending update, checking that
+// request is authenticated as publish approval user
+func loadPendingApproval(c *gin.Context, collectionFactory *deb.CollectionFactory) (*deb.PublishedRepo, string, bool) {
+	approval := context.Config().PublishApproval
+	if !approval.Enabled {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("publish approval is not enabled"))
+		return nil, "", false
+	}
+
+	principal := approval.Principal(c.Request)
+	if principal == "" {
+		c.Header("WWW-Authenticate", `Basic realm="aptly"`)
+		AbortWithJSONError(c, http.StatusUnauthorized, fmt.Errorf("authenticate as one of publish approval users"))
+		return nil, "", false
+	}
+
+	param := slashEscape(c.Params.ByName("prefix"))
+	storage, prefix := deb.ParsePrefix(param)
+	distribution := slashEscape(c.Params.ByName("distribution"))
+
+	collection := collectionFactory.PublishedRepoCollection()
+
+	published, err := collection.ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return nil, "", false
+	}
+
+	if published.Approval == nil {
+		AbortWithJSONError(c, http.StatusConflict, fmt.Errorf("published repository %s/%s has no update pending approval",
+			published.StoragePrefix(), published.Distribution))
+		return nil, "", false
+	}
+
+	err = collection.LoadComplete(published, collectionFactory)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return nil, "", false
+	}
+
+	return published, principal, true
+}
+
+// @Summary Approve Update
+// @Description **Approve and publish update of published repository held for approval**
+// @Description
+// @Description If `publishApproval` is enabled in configuration, updates of published repositories via API
+// @Description (`PUT /api/publish/{prefix}/{distribution}` and `POST /api/publish/{prefix}/{distribution}/update`)
+// @Description are not published, but held as pending with `PendingApproval` set. Update should be approved
+// @Description by another user than the one who requested it, both users authenticate with basic auth.
+// @Description
+// @Description Update is rejected, if pending source changes were modified after approval was requested.
+// @Tags Publish
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Consume json
+// @Param request body publishedRepoUpdateParams true "Parameters"
+// @Produce json
+// @Success 200 {object} deb.PublishedRepo
+// @Failure 400 {object} Error "Publish approval is not enabled"
+// @Failure 401 {object} Error "Not authenticated as publish approval user"
+// @Failure 403 {object} Error "Update requested by the same user"
+// @Failure 404 {object} Error "Published repository not found"
+// @Failure 409 {object} Error "No update pending approval or pending changes modified"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/publish/{prefix}/{distribution}/approve [post]
+func apiPublishApprove(c *gin.Context) {
+	var b publishedRepoUpdateParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+
+	published, principal, ok := loadPendingApproval(c, collectionFactory)
+	if !ok {
+		return
+	}
+
+	if abortIfFrozen(c, published) {
+		return
+	}
+
+	if published.Approval.RequestedBy == principal {
+		AbortWithJSONError(c, http.StatusForbidden, fmt.Errorf("update requested by %s should be approved by another user", principal))
+		return
+	}
+
+	if !reflect.DeepEqual(published.ObtainRevision().Sources, published.Approval.Sources) {
+		AbortWithJSONError(c, http.StatusConflict, fmt.Errorf("pending changes were modified after approval was requested"))
+		return
+	}
+
+	signer, err := getSigner(tenantSigning(published.Prefix, &b.Signing))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+		return
+	}
+
+	published.Approval = nil
+
+	resources := []string{string(published.Key())}
+	taskName := fmt.Sprintf("Approve update of published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
+	maybeRunTaskInBackground(c, taskName, resources, publishUpdateProcess(published, collectionFactory, signer, &b))
+}
+
+// @Summary Reject Update
+// @Description **Reject update of published repository held for approval**
+// @Description
+// @Description Drops pending approval together with pending source changes. Update could be rejected
+// @Description (or withdrawn) by any publish approval user.
+// @Tags Publish
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Produce json
+// @Success 200
+// @Failure 400 {object} Error "Publish approval is not enabled"
+// @Failure 401 {object} Error "Not authenticated as publish approval user"
+// @Failure 404 {object} Error "Published repository not found"
+// @Failure 409 {object} Error "No update pending approval"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/publish/{prefix}/{distribution}/reject [post]
+func apiPublishReject(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.PublishedRepoCollection()
+
+	published, _, ok := loadPendingApproval(c, collectionFactory)
+	if !ok {
+		return
+	}
+
+	published.Approval = nil
+	published.DropRevision()
+
+	resources := []string{string(published.Key())}
+	taskName := fmt.Sprintf("Reject update of published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
+	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		err := collection.Update(published)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: gin.H{}}, nil
+	})
+}
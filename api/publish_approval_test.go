@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type PublishApprovalSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&PublishApprovalSuite{})
+
+func (s *PublishApprovalSuite) approvalRequest(method, url, user, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		req.SetBasicAuth(user, user+"-pass")
+	}
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *PublishApprovalSuite) TestPublishApproval(c *C) {
+	collectionFactory := s.context.NewCollectionFactory()
+
+	localRepo := deb.NewLocalRepo("approval-repo", "")
+	c.Assert(collectionFactory.LocalRepoCollection().Add(localRepo), IsNil)
+	defer collectionFactory.LocalRepoCollection().Drop(localRepo)
+
+	published, err := deb.NewPublishedRepo("", "approval", "stable", []string{"amd64"}, []string{"main"},
+		[]interface{}{localRepo}, collectionFactory, false)
+	c.Assert(err, IsNil)
+	c.Assert(collectionFactory.PublishedRepoCollection().Add(published), IsNil)
+	defer collectionFactory.PublishedRepoCollection().Remove(s.context, "", "approval", "stable", collectionFactory, nil, true, true)
+
+	c.Check(s.approvalRequest("POST", "/api/publish/approval/stable/approve", "alice", "{}").Code, Equals, 400)
+
+	s.context.Config().PublishApproval = utils.PublishApprovalConfig{Enabled: true, Users: map[string]string{
+		"alice": "alice-pass",
+		"bob":   "bob-pass",
+	}}
+	defer func() { s.context.Config().PublishApproval = utils.PublishApprovalConfig{} }()
+
+	c.Check(s.approvalRequest("POST", "/api/publish/approval/stable/update", "", "{}").Code, Equals, 401)
+	c.Check(s.approvalRequest("POST", "/api/publish/approval/stable/approve", "bob", "{}").Code, Equals, 409)
+
+	response := s.approvalRequest("POST", "/api/publish/approval/stable/update", "alice", "{}")
+	c.Check(response.Code, Equals, 202)
+	c.Check(response.Body.String(), Matches, `.*"PendingApproval":\{"RequestedBy":"alice".*`)
+
+	response = s.approvalRequest("POST", "/api/publish/approval/stable/approve", "alice", "{}")
+	c.Check(response.Code, Equals, 403)
+	c.Check(response.Body.String(), Matches, `.*update requested by alice should be approved by another user.*`)
+
+	response = s.approvalRequest("PUT", "/api/publish/approval/stable/sources", "", `[{"Component": "contrib", "Name": "approval-repo"}]`)
+	c.Check(response.Code, Equals, 200)
+
+	response = s.approvalRequest("POST", "/api/publish/approval/stable/approve", "bob", "{}")
+	c.Check(response.Code, Equals, 409)
+	c.Check(response.Body.String(), Matches, `.*pending changes were modified after approval was requested.*`)
+
+	c.Check(s.approvalRequest("POST", "/api/publish/approval/stable/reject", "bob", "").Code, Equals, 200)
+
+	published, err = collectionFactory.PublishedRepoCollection().ByStoragePrefixDistribution("", "approval", "stable")
+	c.Assert(err, IsNil)
+	c.Check(published.Approval, IsNil)
+	c.Check(published.Revision, IsNil)
+}
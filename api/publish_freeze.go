@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+)
+
+// abortIfFrozen responds with 423 Locked if published repository is frozen
+func abortIfFrozen(c *gin.Context, published *deb.PublishedRepo) bool {
+	if err := published.CheckFrozen(); err != nil {
+		AbortWithJSONError(c, http.StatusLocked, err)
+		return true
+	}
+
+	return false
+}
+
+type publishedRepoFreezeParams struct {
+	// Maintenance notice published in Release file while frozen (optional)
+	Notice string `        json:"Notice"  example:"release freeze until 2024-06-01"`
+	// GPG options
+	Signing signingParams `json:"Signing"`
+}
+
+// setFrozen freezes (or unfreezes) published repository, re-publishing it to update Release file
+func setFrozen(c *gin.Context, frozen bool) {
+	var b publishedRepoFreezeParams
+
+	param := slashEscape(c.Params.ByName("prefix"))
+	storage, prefix := deb.ParsePrefix(param)
+	distribution := slashEscape(c.Params.ByName("distribution"))
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.PublishedRepoCollection()
+
+	published, err := collection.ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	err = collection.LoadComplete(published, collectionFactory)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	signer, err := getSigner(tenantSigning(published.Prefix, &b.Signing))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+		return
+	}
+
+	action := "Unfreeze"
+	if frozen {
+		action = "Freeze"
+		published.Freeze(b.Notice)
+	} else {
+		published.Unfreeze()
+	}
+
+	resources := []string{string(published.Key())}
+	taskName := fmt.Sprintf("%s published %s repository %s/%s", action, published.SourceKind, published.StoragePrefix(), published.Distribution)
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, detail *task.Detail) (*task.ProcessReturnValue, error) {
+		publishOutput := &task.PublishOutput{
+			Progress:      out,
+			PublishDetail: task.PublishDetail{Detail: detail},
+		}
+
+		err := published.Publish(context.PackagePool(), context, collectionFactory, signer, publishOutput, false, context.SkelPath())
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to publish: %s", err)
+		}
+
+		err = collection.Update(published)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save to DB: %s", err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: published}, nil
+	})
+}
+
+// @Summary Freeze Published Repository
+// @Description **Freeze published repository for maintenance or release freeze**
+// @Description
+// @Description Frozen published repository can't be updated, switched or removed, such requests fail with 423 Locked.
+// @Description Repository is re-published with unchanged contents, optional notice is published as `Maintenance-Notice`
+// @Description field of Release file.
+// @Description
+// @Description See also: `aptly publish freeze`
+// @Tags Publish
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Consume json
+// @Param request body publishedRepoFreezeParams true "Parameters"
+// @Produce json
+// @Success 200 {object} deb.PublishedRepo
+// @Failure 404 {object} Error "Published repository not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/publish/{prefix}/{distribution}/freeze [post]
+func apiPublishFreeze(c *gin.Context) {
+	setFrozen(c, true)
+}
+
+// @Summary Unfreeze Published Repository
+// @Description **Lift freeze of published repository**
+// @Description
+// @Description Repository is re-published with unchanged contents to remove maintenance notice from Release file.
+// @Description
+// @Description See also: `aptly publish unfreeze`
+// @Tags Publish
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Consume json
+// @Param request body publishedRepoFreezeParams true "Parameters"
+// @Produce json
+// @Success 200 {object} deb.PublishedRepo
+// @Failure 404 {object} Error "Published repository not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/publish/{prefix}/{distribution}/unfreeze [post]
+func apiPublishUnfreeze(c *gin.Context) {
+	setFrozen(c, false)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	. "gopkg.in/check.v1"
+)
+
+type PublishFreezeSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&PublishFreezeSuite{})
+
+func (s *PublishFreezeSuite) TestFrozenPublishedRepoIsLocked(c *C) {
+	collectionFactory := s.context.NewCollectionFactory()
+
+	localRepo := deb.NewLocalRepo("frozen-repo", "")
+	c.Assert(collectionFactory.LocalRepoCollection().Add(localRepo), IsNil)
+	defer collectionFactory.LocalRepoCollection().Drop(localRepo)
+
+	published, err := deb.NewPublishedRepo("", "frozen", "stable", []string{"amd64"}, []string{"main"},
+		[]interface{}{localRepo}, collectionFactory, false)
+	c.Assert(err, IsNil)
+	published.Freeze("release freeze")
+	c.Assert(collectionFactory.PublishedRepoCollection().Add(published), IsNil)
+	defer collectionFactory.PublishedRepoCollection().Remove(s.context, "", "frozen", "stable", collectionFactory, nil, true, true)
+
+	for _, r := range []struct{ method, url string }{
+		{"PUT", "/api/publish/frozen/stable"},
+		{"POST", "/api/publish/frozen/stable/update"},
+		{"DELETE", "/api/publish/frozen/stable"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(r.method, r.url, bytes.NewBufferString("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(w, req)
+
+		c.Check(w.Code, Equals, 423, Commentf("%s %s", r.method, r.url))
+		c.Check(w.Body.String(), Matches, `.*published repository frozen/stable is frozen: release freeze.*`)
+	}
+
+	_, err = collectionFactory.PublishedRepoCollection().ByStoragePrefixDistribution("", "frozen", "stable")
+	c.Check(err, IsNil)
+}
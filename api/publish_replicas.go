@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+)
+
+type publishedRepoReplicasParams struct {
+	// Re-publish stale replicas with sources of reference replica
+	Resync bool `          json:"Resync"  example:"false"`
+	// GPG options
+	Signing signingParams `json:"Signing"`
+}
+
+// @Summary Check Replicas of Published Repository
+// @Description **Compare replicas of published repository on different published storages**
+// @Description
+// @Description Replicas are published repositories with the same prefix and distribution on different storages
+// @Description (storage part of prefix is ignored). Release files (ignoring dates) and lists of files under `dists/`
+// @Description and `pool/` are compared against the replica with the most recent Release file.
+// @Description
+// @Description With `Resync` enabled, stale replicas are re-published with sources of the reference replica.
+// @Description
+// @Description See also: `aptly publish replicas`
+// @Tags Publish
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Consume json
+// @Param request body publishedRepoReplicasParams true "Parameters"
+// @Produce json
+// @Success 200 {object} deb.ReplicaCheck
+// @Failure 404 {object} Error "Published repository not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/publish/{prefix}/{distribution}/replicas [post]
+func apiPublishReplicas(c *gin.Context) {
+	var b publishedRepoReplicasParams
+
+	param := slashEscape(c.Params.ByName("prefix"))
+	_, prefix := deb.ParsePrefix(param)
+	distribution := slashEscape(c.Params.ByName("distribution"))
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	replicas := collectionFactory.PublishedRepoCollection().ByPrefixDistribution(prefix, distribution)
+	if len(replicas) == 0 {
+		AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("published repository %s/%s not found", prefix, distribution))
+		return
+	}
+
+	signer, err := getSigner(tenantSigning(prefix, &b.Signing))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+		return
+	}
+
+	resources := []string{}
+	for _, published := range replicas {
+		resources = append(resources, string(published.Key()))
+	}
+
+	taskName := fmt.Sprintf("Check replicas of published repository %s/%s", prefix, distribution)
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		check, err := deb.CheckReplicas(context, replicas)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to check replicas: %s", err)
+		}
+
+		if b.Resync {
+			err = check.Resync(replicas, context.PackagePool(), context, collectionFactory, signer, out, context.SkelPath())
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to re-sync replicas: %s", err)
+			}
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: check}, nil
+	})
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type PublishReplicasSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&PublishReplicasSuite{})
+
+func (s *PublishReplicasSuite) TestReplicasNotFound(c *C) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/publish/no-such-prefix/stable/replicas", bytes.NewBufferString("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	s.router.ServeHTTP(w, req)
+
+	c.Check(w.Code, Equals, 404)
+	c.Check(w.Body.String(), Matches, `.*published repository no-such-prefix/stable not found.*`)
+}
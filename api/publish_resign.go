@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+)
+
+type publishedRepoResignParams struct {
+	// Set Date of Release file to current time
+	RefreshDate bool `      json:"RefreshDate"  example:"true"`
+	// Set Valid-Until of Release file to current time plus duration (e.g. 168h), empty keeps Valid-Until unchanged
+	ValidFor string `      json:"ValidFor"     example:"168h"`
+	// GPG options, e.g. new key to sign with
+	Signing signingParams `json:"Signing"`
+}
+
+// @Summary Re-sign Published Repository
+// @Description **Regenerate signatures of published Release file**
+// @Description
+// @Description Only InRelease and Release.gpg are regenerated (with new key, if specified in signing options), package
+// @Description indexes are neither regenerated nor re-uploaded, so key rotation takes seconds even for large repositories.
+// @Description Optionally Date and Valid-Until fields of Release file are refreshed.
+// @Description
+// @Description Note: Valid-Until is not kept on next publish of repository.
+// @Tags Publish
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Consume json
+// @Param request body publishedRepoResignParams true "Parameters"
+// @Produce json
+// @Success 200 {object} deb.PublishedRepo
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 404 {object} Error "Published repository not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/publish/{prefix}/{distribution}/resign [post]
+func apiPublishResign(c *gin.Context) {
+	var (
+		b   publishedRepoResignParams
+		err error
+	)
+
+	param := slashEscape(c.Params.ByName("prefix"))
+	storage, prefix := deb.ParsePrefix(param)
+	distribution := slashEscape(c.Params.ByName("distribution"))
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	options := deb.ResignOptions{RefreshDate: b.RefreshDate}
+	if b.ValidFor != "" {
+		options.ValidFor, err = time.ParseDuration(b.ValidFor)
+		if err != nil || options.ValidFor <= 0 {
+			AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("ValidFor should be positive duration, e.g. 168h"))
+			return
+		}
+	}
+
+	if b.Signing.Skip {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("signing can't be skipped when re-signing"))
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	published, err := collectionFactory.PublishedRepoCollection().ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	signer, err := getSigner(tenantSigning(published.Prefix, &b.Signing))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG signer: %s", err))
+		return
+	}
+
+	resources := []string{string(published.Key())}
+	taskName := fmt.Sprintf("Re-sign published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		err := published.Resign(context, signer, options, out)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to re-sign: %s", err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: published}, nil
+	})
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/pgp"
+	"github.com/gin-gonic/gin"
+)
+
+var sourcesConfigNameInvalid = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// publishedBaseURL guesses URL of the root of published storage, if it is served by API
+func publishedBaseURL(c *gin.Context, storage string) (string, error) {
+	if !context.Config().ServeInAPIMode || (storage != "" && !strings.HasPrefix(storage, "filesystem:")) {
+		return "", fmt.Errorf("url is required: published storage is not served by API")
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	storageName := "-"
+	if storage != "" {
+		storageName = strings.TrimPrefix(storage, "filesystem:")
+	}
+
+	return fmt.Sprintf("%s://%s/repos/%s", scheme, c.Request.Host, storageName), nil
+}
+
+// @Summary Get APT Client Configuration
+// @Description **Get APT sources configuration for clients of published repository**
+// @Description
+// @Description Returns deb822 `.sources` file with public key inlined as `Signed-By` and legacy one-line `.list`
+// @Description entries for published repository, ready to be installed on client machines.
+// @Description
+// @Description URL of the root of published storage should be given with `url`, unless published files are served by API
+// @Description (`serveInAPIMode`). Public key is exported from keyring used for signing (tenant key, if tenancy is enabled).
+// @Description
+// @Description With `format=sources` or `format=list` plain text is returned instead of JSON, e.g.
+// @Description `curl 'http://aptly/api/publish/:./stable/sources-config?format=sources' > /etc/apt/sources.list.d/aptly.sources`
+// @Tags Publish
+// @Produce json
+// @Produce plain
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Param url query string false "URL of the root of published storage"
+// @Param name query string false "name of configuration, used for file names on client"
+// @Param gpgKey query string false "GPG key ID Release files are signed with"
+// @Param keyring query string false "GPG keyring to export key from"
+// @Param signingBackend query string false "signing backend to export key from: gpg, vault or awskms"
+// @Param skipKey query string false "set to 1 to omit public key"
+// @Param format query string false "json (default), sources or list"
+// @Success 200 {object} deb.ClientSourcesConfig
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 404 {object} Error "Published repository not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/publish/{prefix}/{distribution}/sources-config [get]
+func apiPublishSourcesConfig(c *gin.Context) {
+	param := slashEscape(c.Params.ByName("prefix"))
+	storage, prefix := deb.ParsePrefix(param)
+	distribution := slashEscape(c.Params.ByName("distribution"))
+	query := c.Request.URL.Query()
+
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "sources" && format != "list" {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("unknown format %s", format))
+		return
+	}
+
+	collection := context.NewCollectionFactory().PublishedRepoCollection()
+	published, err := collection.ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	baseURL := query.Get("url")
+	if baseURL == "" {
+		baseURL, err = publishedBaseURL(c, published.Storage)
+		if err != nil {
+			AbortWithJSONError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	name := query.Get("name")
+	if name == "" {
+		name = strings.Trim(sourcesConfigNameInvalid.ReplaceAllString(strings.Join([]string{"aptly", published.Prefix, published.Distribution}, "-"), "-"), "-.")
+	} else if sourcesConfigNameInvalid.MatchString(name) {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("invalid name %s", name))
+		return
+	}
+
+	var key []byte
+	if query.Get("skipKey") != "1" {
+		signing := tenantSigning(published.Prefix, &signingParams{GpgKey: query.Get("gpgKey"), Keyring: query.Get("keyring")})
+
+		signer, err := context.GetSignerForBackend(query.Get("signingBackend"))
+		if err != nil {
+			AbortWithJSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		signer.SetKey(signing.GpgKey)
+		signer.SetKeyRing(signing.Keyring, "")
+
+		exporter, ok := signer.(pgp.PublicKeyExporter)
+		if !ok {
+			AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("GPG provider doesn't support exporting keys"))
+			return
+		}
+
+		key, err = exporter.ExportPublicKey()
+		if err != nil {
+			AbortWithJSONError(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	config := published.ClientConfig(baseURL, name, key)
+
+	switch format {
+	case "sources":
+		c.String(http.StatusOK, config.Sources)
+	case "list":
+		c.String(http.StatusOK, config.List)
+	default:
+		c.JSON(http.StatusOK, config)
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	. "gopkg.in/check.v1"
+)
+
+type PublishSourcesConfigSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&PublishSourcesConfigSuite{})
+
+func (s *PublishSourcesConfigSuite) TestSourcesConfig(c *C) {
+	collectionFactory := s.context.NewCollectionFactory()
+
+	localRepo := deb.NewLocalRepo("sources-config-repo", "")
+	c.Assert(collectionFactory.LocalRepoCollection().Add(localRepo), IsNil)
+	defer collectionFactory.LocalRepoCollection().Drop(localRepo)
+
+	published, err := deb.NewPublishedRepo("", "sources-config", "stable", []string{"amd64"}, []string{"main"},
+		[]interface{}{localRepo}, collectionFactory, false)
+	c.Assert(err, IsNil)
+	c.Assert(collectionFactory.PublishedRepoCollection().Add(published), IsNil)
+	defer collectionFactory.PublishedRepoCollection().Remove(s.context, "", "sources-config", "stable", collectionFactory, nil, true, true)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/publish/sources-config/stable/sources-config?url=https://apt.example.com&skipKey=1", nil)
+	s.router.ServeHTTP(w, req)
+	c.Assert(w.Code, Equals, 200)
+
+	var config deb.ClientSourcesConfig
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &config), IsNil)
+	c.Check(config.Name, Equals, "aptly-sources-config-stable")
+	c.Check(config.List, Equals, "deb [arch=amd64] https://apt.example.com/sources-config stable main\n")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/publish/sources-config/stable/sources-config?url=https://apt.example.com&skipKey=1&format=sources", nil)
+	s.router.ServeHTTP(w, req)
+	c.Assert(w.Code, Equals, 200)
+	c.Check(w.Body.String(), Equals, "Types: deb\nURIs: https://apt.example.com/sources-config\nSuites: stable\nComponents: main\nArchitectures: amd64\n")
+
+	for _, r := range []struct{ query, message string }{
+		{"?skipKey=1", ".*url is required.*"},
+		{"?url=https://apt.example.com&format=xml", ".*unknown format xml.*"},
+		{"?url=https://apt.example.com&name=../etc", ".*invalid name.*"},
+	} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/publish/sources-config/stable/sources-config"+r.query, nil)
+		s.router.ServeHTTP(w, req)
+		c.Check(w.Code, Equals, 400, Commentf("%s", r.query))
+		c.Check(w.Body.String(), Matches, r.message)
+	}
+}
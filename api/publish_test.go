@@ -0,0 +1,131 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/pgp"
+	"github.com/aptly-dev/aptly/task"
+
+	. "gopkg.in/check.v1"
+)
+
+type PublishSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&PublishSuite{})
+
+func (s *PublishSuite) TestPublishSourceFilters(c *C) {
+	for _, r := range []struct {
+		method  string
+		url     string
+		body    string
+		code    int
+		message string
+	}{
+		{"POST", "/api/publish/ppa", `{"SourceKind": "snapshot", "Sources": [{"Component": "main", "Name": "snap", "Filter": "nginx ("}]}`,
+			400, `.*unable to parse filter of component main.*`},
+		{"POST", "/api/publish/ppa", `{"SourceKind": "snapshot", "Sources": [{"Component": "main", "Name": "no-such-snapshot", "Filter": "Priority (required)"}]}`,
+			404, `.*snapshot with name no-such-snapshot not found.*`},
+		{"PUT", "/api/publish/ppa/stable", `{"Snapshots": [{"Component": "main", "Name": "snap", "Filter": "|"}]}`,
+			400, `.*unable to parse filter of component main.*`},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(r.method, r.url, bytes.NewBufferString(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(w, req)
+
+		c.Check(w.Code, Equals, r.code)
+		c.Check(w.Body.String(), Matches, r.message)
+	}
+}
+
+func (s *PublishSuite) TestGetSignerMultipleKeys(c *C) {
+	provider := s.context.Config().GpgProvider
+	s.context.Config().GpgProvider = "internal"
+	defer func() { s.context.Config().GpgProvider = provider }()
+
+	_, err := getSigner(&signingParams{Keys: []signingKeyParams{{Keyring: "old.gpg"}}})
+	c.Check(err, ErrorMatches, "GPG key should be specified for each of signing keys")
+
+	signer, err := getSigner(&signingParams{
+		GpgKey:  "21DBB89C16DB3E6D",
+		Keyring: "../system/files/aptly.pub", SecretKeyring: "../system/files/aptly.sec",
+		Keys: []signingKeyParams{{
+			GpgKey:  "F30E8CB9CDDE2AF8",
+			Keyring: "../system/files/aptly_passphrase.pub", SecretKeyring: "../system/files/aptly_passphrase.sec",
+			Passphrase: "verysecret",
+		}},
+	})
+	c.Assert(err, IsNil)
+	c.Check(signer, FitsTypeOf, &pgp.MultiSigner{})
+	_, configurable := signer.(pgp.Signer)
+	c.Check(configurable, Equals, false)
+
+	_, err = getSigner(&signingParams{
+		Keyring: "../system/files/aptly_passphrase.pub", SecretKeyring: "../system/files/aptly_passphrase.sec",
+		Keys: []signingKeyParams{{GpgKey: "F30E8CB9CDDE2AF8"}},
+	})
+	c.Check(err, ErrorMatches, ".*passphrase.*")
+}
+
+func (s *PublishSuite) TestPublishFlatSingleComponent(c *C) {
+	name := fmt.Sprintf("flat-%d", time.Now().UnixNano())
+
+	response, _ := s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(`{"Name": "`+name+`"}`))
+	c.Assert(response.Code, Equals, 201)
+	defer s.HTTPRequest("DELETE", "/api/repos/"+name+"?force=1", nil)
+
+	response, _ = s.HTTPRequest("POST", "/api/publish/"+name, bytes.NewBufferString(`{"SourceKind": "local", "Flat": true,
+		"Distribution": "feed", "Signing": {"Skip": true},
+		"Sources": [{"Component": "main", "Name": "`+name+`"}, {"Component": "extra", "Name": "`+name+`"}]}`))
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Matches, ".*flat repository should have exactly one component.*")
+}
+
+func (s *PublishSuite) TestEstimatePublish(c *C) {
+	collectionFactory := s.context.NewCollectionFactory()
+
+	p := deb.NewPackageFromControlFile(deb.Stanza{"Package": "estimated", "Version": "1.0", "Architecture": "amd64",
+		"Filename": "pool/main/e/estimated/estimated_1.0_amd64.deb", "Size": "100", "MD5sum": "5c0f0c6ce8f5b3e5e3ec9f1a6ac29ac0"})
+	c.Assert(collectionFactory.PackageCollection().Update(p), IsNil)
+
+	list := deb.NewPackageList()
+	c.Assert(list.Add(p), IsNil)
+	repo := deb.NewLocalRepo(fmt.Sprintf("estimate-%d", time.Now().UnixNano()), "")
+	repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
+	c.Assert(collectionFactory.LocalRepoCollection().Add(repo), IsNil)
+	defer collectionFactory.LocalRepoCollection().Drop(repo)
+
+	published, err := deb.NewPublishedRepo("", "estimate", "stable", []string{"amd64"}, []string{"main"}, []interface{}{repo}, collectionFactory, false)
+	c.Assert(err, IsNil)
+
+	threshold := s.context.Config().EstimateConfirmThreshold
+	defer func() { s.context.Config().EstimateConfirmThreshold = threshold }()
+
+	// estimation is skipped unless requested or threshold is configured
+	s.context.Config().EstimateConfirmThreshold = 0
+	output := &task.PublishOutput{PublishDetail: task.PublishDetail{Detail: &task.Detail{}}}
+	_, err = estimatePublish(published, collectionFactory, output, false, false)
+	c.Check(err, IsNil)
+	c.Check(output.Detail.Load(), IsNil)
+
+	_, err = estimatePublish(published, collectionFactory, output, true, false)
+	c.Check(err, IsNil)
+	c.Check(output.EstimatedNumberOfFiles, Equals, int64(1))
+	c.Check(output.EstimatedSize, Equals, int64(100))
+
+	s.context.Config().EstimateConfirmThreshold = 50
+	output = &task.PublishOutput{PublishDetail: task.PublishDetail{Detail: &task.Detail{}}}
+	retValue, err := estimatePublish(published, collectionFactory, output, false, false)
+	c.Check(err, ErrorMatches, "estimated size 100 B exceeds confirmation threshold 50 B.*")
+	c.Check(retValue.Code, Equals, http.StatusPreconditionFailed)
+
+	_, err = estimatePublish(published, collectionFactory, output, false, true)
+	c.Check(err, IsNil)
+}
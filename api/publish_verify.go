@@ -0,0 +1,94 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/pgp"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+)
+
+type publishedRepoVerifyParams struct {
+	// Don't verify signature of Release file
+	SkipSignature bool `json:"SkipSignature"  example:"false"`
+	// Keyrings with keys to verify signature (in addition to default keyring)
+	Keyrings []string `json:"Keyrings"       example:"trustedkeys.gpg"`
+	// Check checksums of package files in pool
+	Pool bool `json:"Pool"                   example:"true"`
+	// Check only random sample of package files in pool (0 - check all files)
+	PoolSample int `json:"PoolSample"        example:"100"`
+}
+
+// @Summary Verify Published Repository
+// @Description **Verify published files against Release file**
+// @Description
+// @Description Published Release file is read back from published storage, its signature (InRelease and Release.gpg)
+// @Description is verified and checksums of all index files listed in it are checked. Optionally package files in pool
+// @Description referenced by indexes (or random sample of them) are checked as well.
+// @Description
+// @Description Health report is returned with all problems found, e.g. files modified or removed outside of aptly.
+// @Tags Publish
+// @Param prefix path string true "publishing prefix"
+// @Param distribution path string true "distribution name"
+// @Consume json
+// @Param request body publishedRepoVerifyParams true "Parameters"
+// @Produce json
+// @Success 200 {object} deb.VerifyReport
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 404 {object} Error "Published repository not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/publish/{prefix}/{distribution}/verify [post]
+func apiPublishVerify(c *gin.Context) {
+	var b publishedRepoVerifyParams
+
+	param := slashEscape(c.Params.ByName("prefix"))
+	storage, prefix := deb.ParsePrefix(param)
+	distribution := slashEscape(c.Params.ByName("distribution"))
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	if b.PoolSample < 0 {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("PoolSample should be positive"))
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	published, err := collectionFactory.PublishedRepoCollection().ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	var verifier pgp.Verifier
+	if !b.SkipSignature {
+		verifier, err = getVerifier(b.Keyrings)
+		if err != nil {
+			AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to initialize GPG verifier: %s", err))
+			return
+		}
+	}
+
+	poolSample := 0
+	if b.Pool {
+		poolSample = b.PoolSample
+		if poolSample == 0 {
+			poolSample = -1
+		}
+	}
+
+	resources := []string{string(published.Key())}
+	taskName := fmt.Sprintf("Verify published %s repository %s/%s", published.SourceKind, published.StoragePrefix(), published.Distribution)
+	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		report, err := published.Verify(context, verifier, poolSample)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to verify: %s", err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: report}, nil
+	})
+}
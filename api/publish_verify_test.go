@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type PublishVerifySuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&PublishVerifySuite{})
+
+func (s *PublishVerifySuite) TestVerifyErrors(c *C) {
+	for _, r := range []struct {
+		body    string
+		code    int
+		message string
+	}{
+		{`{"Pool": true, "PoolSample": -1}`, 400, `.*PoolSample should be positive.*`},
+		{`{}`, 404, `.*published repo with storage:prefix/distribution no-such-prefix/stable not found.*`},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/publish/no-such-prefix/stable/verify", bytes.NewBufferString(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(w, req)
+
+		c.Check(w.Code, Equals, r.code)
+		c.Check(w.Body.String(), Matches, r.message)
+	}
+}
+
+func (s *PublishVerifySuite) TestResignErrors(c *C) {
+	for _, r := range []struct {
+		body    string
+		code    int
+		message string
+	}{
+		{`{"ValidFor": "1 week"}`, 400, `.*ValidFor should be positive duration.*`},
+		{`{"ValidFor": "-1h"}`, 400, `.*ValidFor should be positive duration.*`},
+		{`{"Signing": {"Skip": true}}`, 400, `.*signing can't be skipped.*`},
+		{`{"RefreshDate": true}`, 404, `.*published repo with storage:prefix/distribution no-such-prefix/stable not found.*`},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/publish/no-such-prefix/stable/resign", bytes.NewBufferString(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		s.router.ServeHTTP(w, req)
+
+		c.Check(w.Code, Equals, r.code)
+		c.Check(w.Body.String(), Matches, r.message)
+	}
+}
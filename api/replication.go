@@ -0,0 +1,436 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/notify"
+	"github.com/aptly-dev/aptly/pgp"
+	"github.com/aptly-dev/aptly/replication"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// replicaStatus is runtime state of replica
+type replicaStatus struct {
+	sync.Mutex
+
+	// Time of last sync attempt
+	LastAttempt time.Time
+	// Error of last sync attempt, empty if it succeeded
+	LastError string
+	// Time replica was in sync with primary last time
+	InSyncAt time.Time
+	// Position in journal of primary and last change in it, as of last sync
+	Seq  uint64
+	Head uint64
+
+	lagAlerted bool
+}
+
+var replica = &replicaStatus{InSyncAt: time.Now()}
+
+type replicationStatus struct {
+	// Role of this instance: primary or replica
+	Role string
+	// Journal status (primary)
+	Journal *replication.Status `json:",omitempty"`
+	// Base URL of primary (replica)
+	PrimaryURL string `json:",omitempty"`
+	// Time of last sync attempt (replica)
+	LastAttempt time.Time `json:",omitempty"`
+	// Error of last sync attempt (replica)
+	LastError string `json:",omitempty"`
+	// Position in journal of primary and last change in it (replica)
+	Seq  uint64 `json:",omitempty"`
+	Head uint64 `json:",omitempty"`
+	// Seconds since replica was in sync with primary (replica)
+	Lag int64 `json:",omitempty"`
+}
+
+// @Summary Replication Status
+// @Description **Get replication status**
+// @Description
+// @Description For primary it reports journal of changes, for replica position in the journal of primary
+// @Description and replication lag (seconds since replica was in sync with primary).
+// @Tags Replication
+// @Produce json
+// @Success 200 {object} replicationStatus
+// @Failure 404 {object} Error "Replication is not configured"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/replication/status [get]
+func apiReplicationStatus(c *gin.Context) {
+	config := context.Config().Replication
+	result := replicationStatus{Role: config.Role}
+
+	switch config.Role {
+	case utils.ReplicationRolePrimary:
+		db, err := context.Database()
+		if err == nil {
+			result.Journal, err = replication.ReadStatus(db)
+		}
+		if err != nil {
+			AbortWithJSONError(c, http.StatusInternalServerError, err)
+			return
+		}
+	case utils.ReplicationRoleReplica:
+		replica.Lock()
+		result.PrimaryURL = config.PrimaryURL
+		result.LastAttempt = replica.LastAttempt
+		result.LastError = replica.LastError
+		result.Seq, result.Head = replica.Seq, replica.Head
+		result.Lag = int64(time.Since(replica.InSyncAt) / time.Second)
+		replica.Unlock()
+	default:
+		AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("replication is not configured"))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// replicationPrimaryDB returns database of primary or aborts request
+func replicationPrimaryDB(c *gin.Context) *replication.Journal {
+	if context.Config().Replication.Role != utils.ReplicationRolePrimary {
+		AbortWithJSONError(c, http.StatusNotFound, replication.ErrNoJournal)
+		return nil
+	}
+
+	db, err := context.Database()
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return nil
+	}
+
+	journal, ok := db.(*replication.Journal)
+	if !ok {
+		AbortWithJSONError(c, http.StatusNotFound, replication.ErrNoJournal)
+		return nil
+	}
+
+	return journal
+}
+
+// @Summary Replication Changes
+// @Description **Get changes from the journal of primary**
+// @Description
+// @Description Returns changes of database keys done after change `since` with the current values of keys.
+// @Description Replicas follow primary by polling this endpoint. If changes are no longer in the journal,
+// @Description replica should resync using `/api/replication/dump`.
+// @Tags Replication
+// @Produce json
+// @Param since query int false "sequence number of last change seen by replica"
+// @Param limit query int false "maximum number of changes to return"
+// @Success 200 {object} replication.Changes
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 404 {object} Error "Not a primary"
+// @Failure 410 {object} Error "Changes are no longer in the journal"
+// @Router /api/replication/changes [get]
+func apiReplicationChanges(c *gin.Context) {
+	db := replicationPrimaryDB(c)
+	if db == nil {
+		return
+	}
+
+	since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("wrong since: %s", err))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("wrong limit: %s", err))
+		return
+	}
+
+	changes, err := replication.ReadChanges(db, since, limit)
+	if err == replication.ErrJournalTruncated {
+		AbortWithJSONError(c, http.StatusGone, err)
+		return
+	}
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// @Summary Replication Dump
+// @Description **Get dump of the whole database of primary**
+// @Description
+// @Description Dump is a stream of JSON objects: header with journal ID and sequence number of the last change
+// @Description included, followed by all the database keys with values.
+// @Tags Replication
+// @Produce json
+// @Success 200 {object} replication.DumpHeader
+// @Failure 404 {object} Error "Not a primary"
+// @Router /api/replication/dump [get]
+func apiReplicationDump(c *gin.Context) {
+	db := replicationPrimaryDB(c)
+	if db == nil {
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	if err := replication.Dump(db, c.Writer); err != nil {
+		// headers are already sent, replica detects truncated dump
+		log.Error().Msgf("replication dump failed: %s", err)
+	}
+}
+
+// @Summary Replication Pool File
+// @Description **Download file from the package pool of primary**
+// @Tags Replication
+// @Produce octet-stream
+// @Param path path string true "path to file in the pool"
+// @Success 200 {file} file
+// @Failure 404 {object} Error "File not found"
+// @Router /api/replication/pool/{path} [get]
+func apiReplicationPoolFile(c *gin.Context) {
+	if replicationPrimaryDB(c) == nil {
+		return
+	}
+
+	path := strings.TrimPrefix(c.Params.ByName("path"), "/")
+	if path == "" || !verifyPath(path) {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("wrong path"))
+		return
+	}
+
+	file, err := context.PackagePool().Open(path)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+	defer file.Close()
+
+	http.ServeContent(c.Writer, c.Request, path, time.Time{}, file)
+}
+
+// @Summary Replication Sync
+// @Description **Sync replica with primary now**
+// @Description
+// @Description Replica syncs with primary periodically, this triggers sync immediately.
+// @Tags Replication
+// @Produce json
+// @Success 200 {object} replication.SyncResult
+// @Failure 404 {object} Error "Not a replica"
+// @Failure 500 {object} Error "Sync failed"
+// @Router /api/replication/sync [post]
+func apiReplicationSync(c *gin.Context) {
+	if !context.Config().Replication.IsReplica() {
+		AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("not a replica"))
+		return
+	}
+
+	maybeRunTaskInBackground(c, "Sync with primary", nil, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		result, err := replicaSync(out)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: result}, nil
+	})
+}
+
+// replicaSync syncs replica with primary and publishes changed published repositories
+func replicaSync(out aptly.Progress) (*replication.SyncResult, error) {
+	replica.Lock()
+	defer replica.Unlock()
+
+	replica.LastAttempt = time.Now()
+
+	result, err := replicaSyncDatabase(out)
+	if err != nil {
+		replica.LastError = err.Error()
+		return result, fmt.Errorf("unable to sync with primary: %s", err)
+	}
+
+	replica.LastError = ""
+	replica.Seq, replica.Head = result.Seq, result.Head
+	if result.Seq >= result.Head {
+		replica.InSyncAt = time.Now()
+	}
+
+	return result, nil
+}
+
+func replicaSyncDatabase(out aptly.Progress) (*replication.SyncResult, error) {
+	config := context.Config().Replication
+
+	err := acquireDatabaseConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer releaseDatabaseConnection()
+
+	db, err := context.Database()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &replication.Replica{
+		PrimaryURL: config.PrimaryURL,
+		Token:      config.PrimaryToken,
+		DB:         db,
+		Pool:       context.PackagePool(),
+	}
+
+	result, err := r.Sync(context)
+	if err != nil {
+		return result, err
+	}
+
+	if result.Changes > 0 {
+		out.Printf("Synced with primary: %d changes, %d files downloaded\n", result.Changes, result.Files)
+	}
+
+	if config.Publish && (len(result.Published) > 0 || len(result.Dropped) > 0) {
+		err = replicaPublish(result, out)
+	}
+
+	return result, err
+}
+
+// replicaPublish publishes locally repositories changed on primary
+func replicaPublish(result *replication.SyncResult, out aptly.Progress) error {
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.PublishedRepoCollection()
+
+	for _, published := range result.Dropped {
+		out.Printf("Removing published %s/%s...\n", published.StoragePrefix(), published.Distribution)
+		if err := published.RemoveFiles(context, false, nil, out); err != nil {
+			return fmt.Errorf("unable to remove published %s/%s: %s", published.StoragePrefix(), published.Distribution, err)
+		}
+	}
+
+	var signer pgp.Signer
+	if !context.Config().GpgDisableSign {
+		var err error
+		signer, err = context.GetSignerForBackend("")
+		if err != nil {
+			return fmt.Errorf("unable to initialize signer: %s", err)
+		}
+
+		signer.SetKey(context.Config().Replication.GpgKey)
+		signer.SetBatch(true)
+
+		if err := signer.Init(); err != nil {
+			return fmt.Errorf("unable to initialize GPG signer: %s", err)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, changed := range result.Published {
+		if seen[string(changed.Key())] {
+			continue
+		}
+		seen[string(changed.Key())] = true
+
+		published, err := collection.ByStoragePrefixDistribution(changed.Storage, changed.Prefix, changed.Distribution)
+		if err != nil {
+			// published repository has been dropped later on
+			continue
+		}
+
+		err = collection.LoadComplete(published, collectionFactory)
+		if err == nil {
+			out.Printf("Publishing %s/%s...\n", published.StoragePrefix(), published.Distribution)
+			err = published.Publish(context.PackagePool(), context, collectionFactory, signer, out, true, context.SkelPath())
+		}
+		if err != nil {
+			return fmt.Errorf("unable to publish %s/%s: %s", published.StoragePrefix(), published.Distribution, err)
+		}
+	}
+
+	return nil
+}
+
+// checkReplicationLag notifies if replica is not in sync with primary for too long
+// and when it catches up again
+func checkReplicationLag() {
+	config := context.Config().Replication
+
+	replica.Lock()
+	defer replica.Unlock()
+
+	lag := time.Since(replica.InSyncAt)
+	fields := map[string]string{"primary": config.PrimaryURL}
+
+	if config.LagAlert > 0 && lag > time.Duration(config.LagAlert)*time.Second && !replica.lagAlerted {
+		replica.lagAlerted = true
+
+		message := fmt.Sprintf("Replica is at change %d, primary at %d", replica.Seq, replica.Head)
+		if replica.LastError != "" {
+			message += "\nLast error: " + replica.LastError
+		}
+
+		context.Notify(notify.NewEvent(utils.NotifyEventReplicationLag, utils.NotifySeverityWarning,
+			fmt.Sprintf("Replica is %s behind primary", lag.Truncate(time.Second)), message, fields), nil)
+	} else if replica.lagAlerted && lag < time.Duration(config.LagAlert)*time.Second {
+		replica.lagAlerted = false
+
+		context.Notify(notify.NewEvent(utils.NotifyEventReplicationLag, utils.NotifySeverityInfo,
+			"Replica caught up with primary", "", fields), nil)
+	}
+}
+
+// RunReplica syncs replica with primary periodically, it returns immediately
+// if this instance is not a replica
+func RunReplica() {
+	config := context.Config().Replication
+	if !config.IsReplica() {
+		return
+	}
+
+	interval := time.Duration(config.Interval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := replicaSync(context.Progress()); err != nil {
+			log.Warn().Msgf("%s", err)
+		}
+		checkReplicationLag()
+
+		select {
+		case <-context.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replicaReadOnlyMiddleware rejects requests which modify anything on replica,
+// changes should be done on primary
+func replicaReadOnlyMiddleware(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+
+	// GraphQL API has queries only
+	if strings.HasPrefix(c.Request.URL.Path, "/api/replication/") || c.Request.URL.Path == "/api/graphql" {
+		c.Next()
+		return
+	}
+
+	AbortWithJSONError(c, http.StatusForbidden, fmt.Errorf("this instance is read-only replica of %s, changes should be done on primary",
+		context.Config().Replication.PrimaryURL))
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReplicationSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&ReplicationSuite{})
+
+func (s *ReplicationSuite) TestNotConfigured(c *C) {
+	response, err := s.HTTPRequest("GET", "/api/replication/status", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+
+	response, err = s.HTTPRequest("GET", "/api/replication/changes?since=0", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+
+	response, err = s.HTTPRequest("GET", "/api/replication/pool/a/b/c.deb", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+
+	response, err = s.HTTPRequest("POST", "/api/replication/sync", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 404)
+}
+
+func (s *ReplicationSuite) TestReplicaStatus(c *C) {
+	config := s.context.Config()
+	config.Replication = utils.ReplicationConfig{Role: utils.ReplicationRoleReplica, PrimaryURL: "http://primary:8080"}
+	defer func() { config.Replication = utils.ReplicationConfig{} }()
+
+	response, err := s.HTTPRequest("GET", "/api/replication/status", nil)
+	c.Assert(err, IsNil)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `.*"Role":"replica","PrimaryURL":"http://primary:8080".*`)
+}
+
+func (s *ReplicationSuite) TestReadOnlyMiddleware(c *C) {
+	router := gin.New()
+	router.Use(replicaReadOnlyMiddleware)
+	router.Any("/api/*path", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, t := range []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/api/repos", 204},
+		{"POST", "/api/repos", 403},
+		{"DELETE", "/api/publish/:./wheezy", 403},
+		{"POST", "/api/replication/sync", 204},
+		{"POST", "/api/graphql", 204},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(t.method, t.path, nil)
+		router.ServeHTTP(w, req)
+		c.Check(w.Code, Equals, t.code, Commentf("%s %s", t.method, t.path))
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/database"
@@ -18,23 +19,39 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// GET /repos
-func reposListInAPIMode(localRepos map[string]utils.FileSystemPublishRoot) gin.HandlerFunc {
+// reposAccessLog writes access log entries for published files served in API mode
+func reposAccessLog(accessLog *utils.AccessLog) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
-		c.Writer.Flush()
-		c.Writer.WriteString("<pre>\n")
-		if len(localRepos) == 0 {
-			c.Writer.WriteString("<a href=\"-/\">default</a>\n")
-		}
-		for publishPrefix := range localRepos {
-			c.Writer.WriteString(fmt.Sprintf("<a href=\"%[1]s/\">%[1]s</a>\n", publishPrefix))
+		start := time.Now()
+
+		c.Next()
+
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
 		}
-		c.Writer.WriteString("</pre>")
-		c.Writer.Flush()
+
+		accessLog.Log(utils.NewAccessLogEntry(c.Request, c.Writer.Status(), int64(size), start))
 	}
 }
 
+// GET /repos
+func reposListInAPIMode(c *gin.Context) {
+	localRepos := context.Config().FileSystemPublishRoots
+
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Writer.Flush()
+	c.Writer.WriteString("<pre>\n")
+	if len(localRepos) == 0 {
+		c.Writer.WriteString("<a href=\"-/\">default</a>\n")
+	}
+	for publishPrefix := range localRepos {
+		c.Writer.WriteString(fmt.Sprintf("<a href=\"%[1]s/\">%[1]s</a>\n", publishPrefix))
+	}
+	c.Writer.WriteString("</pre>")
+	c.Writer.Flush()
+}
+
 // GET /repos/:storage/*pkgPath
 func reposServeInAPIMode(c *gin.Context) {
 	pkgpath := c.Param("pkgPath")
@@ -46,8 +63,18 @@ func reposServeInAPIMode(c *gin.Context) {
 		storage = "filesystem:" + storage
 	}
 
+	if !context.Config().ServeAccessControl.Authorize(c.Writer, c.Request, storage, pkgpath) {
+		c.Abort()
+		return
+	}
+
 	publicPath := context.GetPublishedStorage(storage).(aptly.FileSystemPublishedStorage).PublicPath()
 	c.FileFromFS(pkgpath, http.Dir(publicPath))
+
+	if context.Config().EnableDownloadStats && c.Request.Method == http.MethodGet && c.Writer.Status() == http.StatusOK &&
+		deb.NewPackageDownloadsFromPath(pkgpath) != nil {
+		recordDownload(pkgpath)
+	}
 }
 
 // @Summary Get repos
@@ -62,7 +89,9 @@ func apiReposList(c *gin.Context) {
 	collectionFactory := context.NewCollectionFactory()
 	collection := collectionFactory.LocalRepoCollection()
 	collection.ForEach(func(r *deb.LocalRepo) error {
-		result = append(result, r)
+		if tenantVisible(c, r.Name) {
+			result = append(result, r)
+		}
 		return nil
 	})
 
@@ -80,6 +109,12 @@ type repoCreateParams struct {
 	DefaultComponent string `        json:"DefaultComponent"     example:"main"`
 	// Snapshot name to create repoitory from (optional)
 	FromSnapshot string `            json:"FromSnapshot"         example:"snapshot1"`
+	// Policy for versions of packages being added: no-downgrade or increasing (optional)
+	VersionPolicy string `           json:"VersionPolicy"        example:"no-downgrade"`
+	// Policy for pruning old versions of packages (optional)
+	Retention *deb.RetentionPolicy `json:"Retention"`
+	// Name of resource template with default settings (optional)
+	Template string `                json:"Template"             example:"standard"`
 }
 
 // @Summary Create repository
@@ -89,6 +124,7 @@ type repoCreateParams struct {
 // @Consume  json
 // @Param request body repoCreateParams true "Parameters"
 // @Success 201 {object} deb.LocalRepo
+// @Failure 400 {object} Error "Unknown version policy or invalid retention policy"
 // @Failure 404 {object} Error "Source snapshot not found"
 // @Failure 409 {object} Error "Local repo already exists"
 // @Failure 500 {object} Error "Internal error"
@@ -96,13 +132,27 @@ type repoCreateParams struct {
 func apiReposCreate(c *gin.Context) {
 	var b repoCreateParams
 
-	if c.Bind(&b) != nil {
+	if !bindWithTemplate(c, &b) {
 		return
 	}
 
 	repo := deb.NewLocalRepo(b.Name, b.Comment)
 	repo.DefaultComponent = b.DefaultComponent
 	repo.DefaultDistribution = b.DefaultDistribution
+	repo.VersionPolicy = b.VersionPolicy
+	repo.Retention = b.Retention
+
+	if err := deb.ValidateVersionPolicy(repo.VersionPolicy); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if repo.Retention != nil {
+		if err := repo.Retention.Validate(); err != nil {
+			AbortWithJSONError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
 
 	collectionFactory := context.NewCollectionFactory()
 
@@ -149,6 +199,9 @@ func apiReposEdit(c *gin.Context) {
 		Comment             *string
 		DefaultDistribution *string
 		DefaultComponent    *string
+		VersionPolicy       *string
+		// Retention policy without limits removes the policy
+		Retention *deb.RetentionPolicy
 	}
 
 	if c.Bind(&b) != nil {
@@ -182,6 +235,30 @@ func apiReposEdit(c *gin.Context) {
 	if b.DefaultComponent != nil {
 		repo.DefaultComponent = *b.DefaultComponent
 	}
+	if b.VersionPolicy != nil {
+		err = deb.ValidateVersionPolicy(*b.VersionPolicy)
+		if err != nil {
+			AbortWithJSONError(c, 400, err)
+			return
+		}
+		repo.VersionPolicy = *b.VersionPolicy
+	}
+	if b.Retention != nil {
+		retention := b.Retention
+		if retention.KeepVersions == 0 && retention.MaxAgeDays == 0 {
+			retention = nil
+		} else if err = retention.Validate(); err != nil {
+			AbortWithJSONError(c, 400, err)
+			return
+		}
+
+		err = collection.LoadComplete(repo)
+		if err != nil {
+			AbortWithJSONError(c, 500, err)
+			return
+		}
+		repo.SetRetention(retention)
+	}
 
 	err = collection.Update(repo)
 	if err != nil {
@@ -269,8 +346,54 @@ func apiReposPackagesShow(c *gin.Context) {
 	showPackages(c, repo.RefList(), collectionFactory)
 }
 
+// GET /api/repos/:name/multiarch
+func apiReposMultiArch(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.LocalRepoCollection()
+
+	repo, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, 404, err)
+		return
+	}
+
+	err = collection.LoadComplete(repo)
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	problems, err := deb.NewMultiArchReport(repo.RefList(), collectionFactory.PackageCollection())
+	if err != nil {
+		AbortWithJSONError(c, 500, fmt.Errorf("unable to check Multi-Arch consistency: %s", err))
+		return
+	}
+
+	c.JSON(200, problems)
+}
+
+// GET /api/repos/:name/licenses
+func apiReposLicenses(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.LocalRepoCollection()
+
+	repo, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, 404, err)
+		return
+	}
+
+	err = collection.LoadComplete(repo)
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	showLicenses(c, repo.RefList(), collectionFactory)
+}
+
 // Handler for both add and delete
-func apiReposPackagesAddDelete(c *gin.Context, taskNamePrefix string, cb func(list *deb.PackageList, p *deb.Package, out aptly.Progress) error) {
+func apiReposPackagesAddDelete(c *gin.Context, taskNamePrefix string, cb func(list *deb.PackageList, p *deb.Package, out aptly.Progress, repo *deb.LocalRepo) error) {
 	var b struct {
 		PackageRefs []string
 	}
@@ -314,7 +437,7 @@ func apiReposPackagesAddDelete(c *gin.Context, taskNamePrefix string, cb func(li
 
 				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 			}
-			err = cb(list, p, out)
+			err = cb(list, p, out, repo)
 			if err != nil {
 				return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, err
 			}
@@ -332,7 +455,10 @@ func apiReposPackagesAddDelete(c *gin.Context, taskNamePrefix string, cb func(li
 
 // POST /repos/:name/packages
 func apiReposPackagesAdd(c *gin.Context) {
-	apiReposPackagesAddDelete(c, "Add packages to repo ", func(list *deb.PackageList, p *deb.Package, out aptly.Progress) error {
+	apiReposPackagesAddDelete(c, "Add packages to repo ", func(list *deb.PackageList, p *deb.Package, out aptly.Progress, repo *deb.LocalRepo) error {
+		if err := repo.CheckVersionPolicy(list, p); err != nil {
+			return err
+		}
 		out.Printf("Adding package %s\n", p.Name)
 		return list.Add(p)
 	})
@@ -340,7 +466,12 @@ func apiReposPackagesAdd(c *gin.Context) {
 
 // DELETE /repos/:name/packages
 func apiReposPackagesDelete(c *gin.Context) {
-	apiReposPackagesAddDelete(c, "Delete packages from repo ", func(list *deb.PackageList, p *deb.Package, out aptly.Progress) error {
+	forceHolds := c.Request.URL.Query().Get("forceHolds") == "1"
+
+	apiReposPackagesAddDelete(c, "Delete packages from repo ", func(list *deb.PackageList, p *deb.Package, out aptly.Progress, repo *deb.LocalRepo) error {
+		if !forceHolds && repo.IsHeld(p) {
+			return fmt.Errorf("package %s is held, use forceHolds=1 to remove it", p)
+		}
 		out.Printf("Removing package %s\n", p.Name)
 		list.Remove(p)
 		return nil
@@ -363,6 +494,7 @@ func apiReposPackageFromFile(c *gin.Context) {
 // @Consume  json
 // @Param noRemove query string false "when value is set to 1, don’t remove any files"
 // @Param forceReplace query string false "when value is set to 1, remove packages conflicting with package being added (in local repository)"
+// @Param forceHolds query string false "when value is set to 1, allow replacing held packages"
 // @Produce  json
 // @Success 200 {string} string "OK"
 // @Failure 400 {object} Error "wrong file"
@@ -371,6 +503,7 @@ func apiReposPackageFromFile(c *gin.Context) {
 // @Router /api/repos/{name}/{dir} [post]
 func apiReposPackageFromDir(c *gin.Context) {
 	forceReplace := c.Request.URL.Query().Get("forceReplace") == "1"
+	forceHolds := c.Request.URL.Query().Get("forceHolds") == "1"
 	noRemove := c.Request.URL.Query().Get("noRemove") == "1"
 
 	if !verifyDir(c) {
@@ -433,15 +566,22 @@ func apiReposPackageFromDir(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to load packages: %s", err)
 		}
 
+		var isHeld func(*deb.Package) bool
+		if !forceHolds {
+			isHeld = repo.IsHeld
+		}
+
 		processedFiles, failedFiles2, err = deb.ImportPackageFiles(list, packageFiles, forceReplace, verifier, context.PackagePool(),
-			collectionFactory.PackageCollection(), reporter, nil, collectionFactory.ChecksumCollection)
+			collectionFactory.PackageCollection(), reporter, nil, collectionFactory.ChecksumCollection, isHeld, repo.CheckVersionPolicy)
 		failedFiles = append(failedFiles, failedFiles2...)
+		addedFiles := processedFiles
 		processedFiles = append(processedFiles, otherFiles...)
 
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to import package files: %s", err)
 		}
 
+		repo.AutoPrune(list, reporter)
 		repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
 
 		err = collectionFactory.LocalRepoCollection().Update(repo)
@@ -449,6 +589,8 @@ func apiReposPackageFromDir(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save: %s", err)
 		}
 
+		context.PackagesAdded(repo, addedFiles, out)
+
 		if !noRemove {
 			processedFiles = utils.StrSliceDeduplicate(processedFiles)
 
@@ -596,6 +738,11 @@ func apiReposCopyPackage(c *gin.Context) {
 		}
 
 		err = toProcess.ForEach(func(p *deb.Package) error {
+			err = dstRepo.CheckVersionPolicy(dstList, p)
+			if err != nil {
+				return err
+			}
+
 			err = dstList.Add(p)
 			if err != nil {
 				return err
@@ -635,6 +782,7 @@ func apiReposIncludePackageFromFile(c *gin.Context) {
 // POST /repos/:name/include/:dir
 func apiReposIncludePackageFromDir(c *gin.Context) {
 	forceReplace := c.Request.URL.Query().Get("forceReplace") == "1"
+	forceHolds := c.Request.URL.Query().Get("forceHolds") == "1"
 	noRemoveFiles := c.Request.URL.Query().Get("noRemoveFiles") == "1"
 	acceptUnsigned := c.Request.URL.Query().Get("acceptUnsigned") == "1"
 	ignoreSignature := c.Request.URL.Query().Get("ignoreSignature") == "1"
@@ -699,9 +847,10 @@ func apiReposIncludePackageFromDir(c *gin.Context) {
 
 		changesFiles, failedFiles = deb.CollectChangesFiles(sources, reporter)
 		_, failedFiles2, err = deb.ImportChangesFiles(
-			changesFiles, reporter, acceptUnsigned, ignoreSignature, forceReplace, noRemoveFiles, verifier,
+			changesFiles, reporter, acceptUnsigned, ignoreSignature, forceReplace, forceHolds, noRemoveFiles, verifier,
 			repoTemplate, context.Progress(), collectionFactory.LocalRepoCollection(), collectionFactory.PackageCollection(),
-			context.PackagePool(), collectionFactory.ChecksumCollection, nil, query.Parse)
+			context.PackagePool(), collectionFactory.ChecksumCollection, nil, query.Parse,
+			func(repo *deb.LocalRepo, files []string) { context.PackagesAdded(repo, files, out) })
 		failedFiles = append(failedFiles, failedFiles2...)
 
 		if err != nil {
@@ -737,3 +886,91 @@ func apiReposIncludePackageFromDir(c *gin.Context) {
 
 	})
 }
+
+// GET /repos/:name/holds
+func apiReposHoldsShow(c *gin.Context) {
+	collection := context.NewCollectionFactory().LocalRepoCollection()
+
+	repo, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, 404, err)
+		return
+	}
+
+	holds := repo.Holds
+	if holds == nil {
+		holds = []string{}
+	}
+
+	c.JSON(200, holds)
+}
+
+// Handler for both hold and unhold
+func apiReposHoldsAddDelete(c *gin.Context, taskNamePrefix string, cb func(repo *deb.LocalRepo, p *deb.Package, out aptly.Progress)) {
+	var b struct {
+		PackageRefs []string
+	}
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.LocalRepoCollection()
+
+	repo, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, 404, err)
+		return
+	}
+
+	resources := []string{string(repo.Key())}
+
+	maybeRunTaskInBackground(c, taskNamePrefix+repo.Name, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		err = collection.LoadComplete(repo)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
+		for _, ref := range b.PackageRefs {
+			var p *deb.Package
+
+			p, err = collectionFactory.PackageCollection().ByKey([]byte(ref))
+			if err != nil {
+				if err == database.ErrNotFound {
+					return &task.ProcessReturnValue{Code: http.StatusNotFound, Value: nil}, fmt.Errorf("packages %s: %s", ref, err)
+				}
+
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+			}
+
+			if repo.RefList() == nil || !repo.RefList().Has(p) {
+				return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("package %s is not part of local repo %s", p, repo.Name)
+			}
+
+			cb(repo, p, out)
+		}
+
+		err = collection.Update(repo)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save: %s", err)
+		}
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: repo}, nil
+	})
+}
+
+// POST /repos/:name/holds
+func apiReposHoldsAdd(c *gin.Context) {
+	apiReposHoldsAddDelete(c, "Hold packages in repo ", func(repo *deb.LocalRepo, p *deb.Package, out aptly.Progress) {
+		out.Printf("Holding package %s\n", p)
+		repo.Hold(p)
+	})
+}
+
+// DELETE /repos/:name/holds
+func apiReposHoldsDelete(c *gin.Context) {
+	apiReposHoldsAddDelete(c, "Unhold packages in repo ", func(repo *deb.LocalRepo, p *deb.Package, out aptly.Progress) {
+		out.Printf("Unholding package %s\n", p)
+		repo.Unhold(p)
+	})
+}
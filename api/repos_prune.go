@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+)
+
+type repoPruneParams struct {
+	// Only report packages which would be removed
+	DryRun bool `json:"DryRun" example:"false"`
+}
+
+type repoPruneResult struct {
+	// Keys of packages removed by retention policy
+	Removed []string `json:"Removed"`
+	// Packages were not removed
+	DryRun bool `json:"DryRun" example:"false"`
+}
+
+// @Summary Prune Repository
+// @Description **Remove packages not retained by retention policy of local repository**
+// @Description
+// @Description Packages are grouped by name and architecture, only `KeepVersions` newest versions in each group are kept
+// @Description and versions added more than `MaxAgeDays` days ago are removed. The newest version of each package
+// @Description and held packages are never removed.
+// @Tags Repos
+// @Param name path string true "Repository name"
+// @Consume json
+// @Param request body repoPruneParams true "Parameters"
+// @Produce json
+// @Success 200 {object} repoPruneResult
+// @Failure 400 {object} Error "Repository has no retention policy"
+// @Failure 404 {object} Error "Repository not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/repos/{name}/prune [post]
+func apiReposPrune(c *gin.Context) {
+	var b repoPruneParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.LocalRepoCollection()
+
+	repo, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	if repo.Retention == nil {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("local repo %s has no retention policy", repo.Name))
+		return
+	}
+
+	resources := []string{string(repo.Key())}
+	maybeRunTaskInBackground(c, "Prune repo "+repo.Name, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		err = collection.LoadComplete(repo)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
+		out.Printf("Loading packages...\n")
+		list, err := deb.NewPackageListFromRefList(repo.RefList(), collectionFactory.PackageCollection(), nil)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
+		result := &repoPruneResult{Removed: []string{}, DryRun: b.DryRun}
+		for _, p := range repo.Prune(list, time.Now()) {
+			result.Removed = append(result.Removed, string(p.Key("")))
+		}
+
+		if b.DryRun {
+			return &task.ProcessReturnValue{Code: http.StatusOK, Value: result}, nil
+		}
+
+		out.Printf("Removing packages (%d)...\n", len(result.Removed))
+		repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
+
+		err = collection.Update(repo)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save: %s", err)
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: result}, nil
+	})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReposPruneSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&ReposPruneSuite{})
+
+func (s *ReposPruneSuite) TestPrune(c *C) {
+	name := fmt.Sprintf("prune-%d", time.Now().UnixNano())
+
+	response, _ := s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(`{"Name": "`+name+`", "Retention": {"AutoPrune": true}}`))
+	c.Check(response.Code, Equals, 400)
+
+	response, _ = s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(`{"Name": "`+name+`"}`))
+	c.Assert(response.Code, Equals, 201)
+	defer s.HTTPRequest("DELETE", "/api/repos/"+name+"?force=1", nil)
+
+	response, _ = s.HTTPRequest("POST", "/api/repos/"+name+"/prune", bytes.NewBufferString(`{}`))
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Matches, ".*has no retention policy.*")
+
+	collectionFactory := s.context.NewCollectionFactory()
+	list := deb.NewPackageList()
+	for _, version := range []string{"1.0~nightly1", "1.0~nightly2", "1.0~nightly3"} {
+		p := &deb.Package{Name: "prune-app", Version: version, Architecture: "amd64"}
+		c.Assert(collectionFactory.PackageCollection().Update(p), IsNil)
+		c.Assert(list.Add(p), IsNil)
+	}
+
+	repo, err := collectionFactory.LocalRepoCollection().ByName(name)
+	c.Assert(err, IsNil)
+	repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
+	c.Assert(collectionFactory.LocalRepoCollection().Update(repo), IsNil)
+
+	response, _ = s.HTTPRequest("PUT", "/api/repos/"+name, bytes.NewBufferString(`{"Retention": {"KeepVersions": 2}}`))
+	c.Assert(response.Code, Equals, 200)
+
+	var result repoPruneResult
+
+	response, _ = s.HTTPRequest("POST", "/api/repos/"+name+"/prune", bytes.NewBufferString(`{"DryRun": true}`))
+	c.Assert(response.Code, Equals, 200)
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result, DeepEquals, repoPruneResult{Removed: []string{"Pamd64 prune-app 1.0~nightly1"}, DryRun: true})
+
+	response, _ = s.HTTPRequest("POST", "/api/repos/"+name+"/prune", bytes.NewBufferString(`{}`))
+	c.Assert(response.Code, Equals, 200)
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &result), IsNil)
+	c.Check(result, DeepEquals, repoPruneResult{Removed: []string{"Pamd64 prune-app 1.0~nightly1"}, DryRun: false})
+
+	response, _ = s.HTTPRequest("GET", "/api/repos/"+name+"/packages", nil)
+	c.Assert(response.Code, Equals, 200)
+
+	var refs []string
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &refs), IsNil)
+	sort.Strings(refs)
+	c.Check(refs, DeepEquals, []string{"Pamd64 prune-app 1.0~nightly2", "Pamd64 prune-app 1.0~nightly3"})
+
+	// retention policy without limits is removed
+	response, _ = s.HTTPRequest("PUT", "/api/repos/"+name, bytes.NewBufferString(`{"Retention": {}}`))
+	c.Assert(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Not(Matches), ".*Retention.*")
+}
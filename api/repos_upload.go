@@ -0,0 +1,294 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/query"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// receiveUpload streams request body to files in directory dir, returning names of stored files
+//
+// Multipart bodies might contain several files (e.g. .changes file with files it lists), any other
+// body is single package file named by query parameter filename.
+func receiveUpload(c *gin.Context, dir string) ([]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+
+	if mediaType != "multipart/form-data" {
+		filename := c.Query("filename")
+		if filename == "" {
+			return nil, fmt.Errorf("filename is required for non-multipart upload")
+		}
+
+		if err := storeUploadedFile(dir, filename, c.Request.Body); err != nil {
+			return nil, err
+		}
+
+		return []string{filepath.Base(filename)}, nil
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []string
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		err = storeUploadedFile(dir, part.FileName(), part)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		stored = append(stored, filepath.Base(part.FileName()))
+	}
+
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("no files uploaded")
+	}
+
+	return stored, nil
+}
+
+// storeUploadedFile copies src to file filename in directory dir
+func storeUploadedFile(dir, filename string, src io.Reader) error {
+	filename = filepath.Base(filename)
+	if !verifyPath(filename) {
+		return fmt.Errorf("wrong file name %q", filename)
+	}
+
+	dst, err := os.OpenFile(filepath.Join(dir, filename), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+// @Summary Upload and Add Packages
+// @Description **Upload package files and add them to local repository in one call**
+// @Description
+// @Description Request body is either single package file (`.deb`, `.udeb`, `.ddeb`), its name passed as `filename` query parameter,
+// @Description or `multipart/form-data` with set of files: source package (`.dsc` and files it references), or `.changes` file
+// @Description together with files it lists. Body is streamed to temporary directory private to the request, which is
+// @Description removed when request completes, no matter if it succeeds or fails.
+// @Description
+// @Description Unlike add from upload directory, operation is atomic: if any of uploaded packages fails to import,
+// @Description local repository is not modified.
+// @Description
+// @Description `.changes` file is verified the same way as with include API, packages are restricted to ones listed
+// @Description in `.changes` file and uploaders config of local repository is applied. Only one `.changes` file
+// @Description might be uploaded at once.
+// @Tags Repos
+// @Param name path string true "Repository name"
+// @Param filename query string false "name of package file, when body is not multipart"
+// @Param forceReplace query string false "when value is set to 1, remove packages conflicting with package being added (in local repository)"
+// @Param forceHolds query string false "when value is set to 1, allow replacing held packages"
+// @Param acceptUnsigned query string false "when value is set to 1, accept unsigned .changes files"
+// @Param ignoreSignature query string false "when value is set to 1, disable verification of .changes file signature"
+// @Consume application/octet-stream
+// @Consume multipart/form-data
+// @Produce json
+// @Success 200 {object} aptly.RecordingResultReporter
+// @Failure 400 {object} Error "Bad Request or package import failed"
+// @Failure 403 {object} Error "Changes file not allowed by uploaders config"
+// @Failure 404 {object} Error "Repository not found"
+// @Failure 413 {object} Error "Upload exceeds maxUploadSize"
+// @Failure 500 {object} Error "Internal Server Error"
+// @Router /api/repos/{name}/packages/upload [post]
+func apiReposPackagesUpload(c *gin.Context) {
+	forceReplace := c.Request.URL.Query().Get("forceReplace") == "1"
+	forceHolds := c.Request.URL.Query().Get("forceHolds") == "1"
+	acceptUnsigned := c.Request.URL.Query().Get("acceptUnsigned") == "1"
+	ignoreSignature := c.Request.URL.Query().Get("ignoreSignature") == "1"
+
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.LocalRepoCollection()
+
+	name := c.Params.ByName("name")
+	repo, err := collection.ByName(name)
+	if err != nil {
+		AbortWithJSONError(c, 404, err)
+		return
+	}
+
+	tempDir, err := os.MkdirTemp("", "aptly-upload")
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	// removed by the task, unless request fails before task is started
+	taskStarted := false
+	defer func() {
+		if !taskStarted {
+			os.RemoveAll(tempDir)
+		}
+	}()
+
+	if limit := context.Config().MaxUploadSize; limit > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+
+	files, err := receiveUpload(c, tempDir)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			AbortWithJSONError(c, http.StatusRequestEntityTooLarge, fmt.Errorf("upload exceeds limit of %s", utils.HumanBytes(tooLarge.Limit)))
+			return
+		}
+
+		AbortWithJSONError(c, 400, fmt.Errorf("unable to receive upload: %s", err))
+		return
+	}
+
+	var changesFiles []string
+	for _, file := range files {
+		if strings.HasSuffix(file, ".changes") {
+			changesFiles = append(changesFiles, filepath.Join(tempDir, file))
+		}
+	}
+
+	if len(changesFiles) > 1 {
+		AbortWithJSONError(c, 400, fmt.Errorf("only one .changes file might be uploaded at once"))
+		return
+	}
+
+	taskName := fmt.Sprintf("Upload and add packages %s to repo %s", strings.Join(files, ", "), name)
+	resources := []string{string(repo.Key())}
+
+	taskStarted = true
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		defer os.RemoveAll(tempDir)
+
+		err := collection.LoadComplete(repo)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
+		verifier := context.GetVerifier()
+		reporter := &aptly.RecordingResultReporter{
+			Warnings:     []string{},
+			AddedLines:   []string{},
+			RemovedLines: []string{},
+		}
+
+		source := tempDir
+		var restriction deb.PackageQuery
+
+		if len(changesFiles) == 1 {
+			changes, err := deb.NewChanges(changesFiles[0])
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("unable to process changes file: %s", err)
+			}
+			defer changes.Cleanup()
+
+			err = changes.VerifyAndParse(acceptUnsigned, ignoreSignature, verifier)
+			if err == nil {
+				err = changes.Prepare()
+			}
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("unable to process changes file %s: %s", changes.ChangesName, err)
+			}
+
+			if repo.Uploaders != nil {
+				for i := range repo.Uploaders.Rules {
+					repo.Uploaders.Rules[i].CompiledCondition, err = query.Parse(repo.Uploaders.Rules[i].Condition)
+					if err != nil {
+						return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("error parsing query %s: %s", repo.Uploaders.Rules[i].Condition, err)
+					}
+				}
+
+				if err = repo.Uploaders.IsAllowed(changes); err != nil {
+					return &task.ProcessReturnValue{Code: http.StatusForbidden, Value: nil}, fmt.Errorf("changes file %s not allowed by uploaders config: %s", changes.ChangesName, err)
+				}
+			}
+
+			source = changes.TempDir
+			restriction = changes.PackageQuery()
+		}
+
+		packageFiles, _, failedFiles := deb.CollectPackageFiles([]string{source}, reporter)
+		if len(packageFiles) == 0 && len(failedFiles) == 0 {
+			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("no package files uploaded")
+		}
+
+		list, err := deb.NewPackageListFromRefList(repo.RefList(), collectionFactory.PackageCollection(), nil)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to load packages: %s", err)
+		}
+
+		var isHeld func(*deb.Package) bool
+		if !forceHolds {
+			isHeld = repo.IsHeld
+		}
+
+		addedFiles, failedFiles2, err := deb.ImportPackageFiles(list, packageFiles, forceReplace, verifier, context.PackagePool(),
+			collectionFactory.PackageCollection(), reporter, restriction, collectionFactory.ChecksumCollection, isHeld, repo.CheckVersionPolicy)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to import package files: %s", err)
+		}
+		failedFiles = append(failedFiles, failedFiles2...)
+
+		if len(failedFiles) > 0 {
+			for i := range failedFiles {
+				failedFiles[i] = filepath.Base(failedFiles[i])
+			}
+			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, fmt.Errorf("repo %s not modified, failed files: %s (%s)",
+				name, strings.Join(failedFiles, ", "), strings.Join(reporter.Warnings, ", "))
+		}
+
+		repo.AutoPrune(list, reporter)
+		repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
+
+		err = collection.Update(repo)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to save: %s", err)
+		}
+
+		context.PackagesAdded(repo, addedFiles, out)
+
+		if len(reporter.AddedLines) > 0 {
+			out.Printf("Added: %s\n", strings.Join(reporter.AddedLines, ", "))
+		}
+		if len(reporter.RemovedLines) > 0 {
+			out.Printf("Removed: %s\n", strings.Join(reporter.RemovedLines, ", "))
+		}
+		if len(reporter.Warnings) > 0 {
+			out.Printf("Warnings: %s\n", strings.Join(reporter.Warnings, ", "))
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: reporter}, nil
+	})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReposUploadSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&ReposUploadSuite{})
+
+func (s *ReposUploadSuite) createRepo(c *C, prefix string) string {
+	name := fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+	response, _ := s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(`{"Name": "`+name+`"}`))
+	c.Assert(response.Code, Equals, 201)
+	return name
+}
+
+func (s *ReposUploadSuite) dropRepo(c *C, name string) {
+	response, _ := s.HTTPRequest("DELETE", "/api/repos/"+name+"?force=1", nil)
+	c.Check(response.Code, Equals, 200)
+}
+
+func (s *ReposUploadSuite) packages(c *C, repo string) []string {
+	response, _ := s.HTTPRequest("GET", "/api/repos/"+repo+"/packages", nil)
+	c.Assert(response.Code, Equals, 200)
+
+	var keys []string
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &keys), IsNil)
+	return keys
+}
+
+func (s *ReposUploadSuite) TestUploadDeb(c *C) {
+	repo := s.createRepo(c, "upload-deb")
+	defer s.dropRepo(c, repo)
+
+	deb, err := os.ReadFile("../system/files/libboost-program-options-dev_1.49.0.1_i386.deb")
+	c.Assert(err, IsNil)
+
+	response, _ := s.HTTPRequest("POST", "/api/repos/missing/packages/upload?filename=a.deb", bytes.NewReader(deb))
+	c.Check(response.Code, Equals, 404)
+
+	response, _ = s.HTTPRequest("POST", "/api/repos/"+repo+"/packages/upload", bytes.NewReader(deb))
+	c.Check(response.Code, Equals, 400)
+
+	// broken package doesn't modify repo
+	response, _ = s.HTTPRequest("POST", "/api/repos/"+repo+"/packages/upload?filename=broken.deb", bytes.NewBufferString("not a deb"))
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Matches, ".*repo "+repo+" not modified, failed files: broken.deb.*")
+	c.Check(s.packages(c, repo), HasLen, 0)
+
+	events, unsubscribe := s.context.Events().Subscribe()
+	defer unsubscribe()
+
+	response, _ = s.HTTPRequest("POST", "/api/repos/"+repo+"/packages/upload?filename=libboost-program-options-dev_1.49.0.1_i386.deb", bytes.NewReader(deb))
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, ".*\"Added\":\\[\"libboost-program-options-dev_1.49.0.1_i386 added\"\\].*")
+	c.Check(s.packages(c, repo), DeepEquals, []string{"Pi386 libboost-program-options-dev 1.49.0.1 918d2f433384e378"})
+
+	for event := range events {
+		if event.Type != utils.NotifyEventPackagesUploaded {
+			continue
+		}
+
+		c.Check(event.Fields, DeepEquals, map[string]string{"repo": repo})
+		c.Check(event.Title, Equals, "1 file(s) added to repo "+repo)
+		c.Check(event.Message, Equals, "libboost-program-options-dev_1.49.0.1_i386.deb")
+		break
+	}
+}
+
+func (s *ReposUploadSuite) TestUploadChanges(c *C) {
+	repo := s.createRepo(c, "upload-changes")
+	defer s.dropRepo(c, repo)
+
+	upload := func(query string, files ...string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for _, file := range files {
+			part, err := writer.CreateFormFile("file", filepath.Base(file))
+			c.Assert(err, IsNil)
+			src, err := os.Open(file)
+			c.Assert(err, IsNil)
+			_, err = io.Copy(part, src)
+			c.Assert(err, IsNil)
+			src.Close()
+		}
+		c.Assert(writer.Close(), IsNil)
+
+		req, err := http.NewRequest("POST", "/api/repos/"+repo+"/packages/upload"+query, body)
+		c.Assert(err, IsNil)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// files listed in .changes are missing
+	response := upload("?ignoreSignature=1", "../system/changes/hardlink_0.2.1_amd64.changes", "../system/changes/hardlink_0.2.1_amd64.deb")
+	c.Check(response.Code, Equals, 400)
+	c.Check(s.packages(c, repo), HasLen, 0)
+
+	response = upload("?ignoreSignature=1", "../system/changes/hardlink_0.2.1_amd64.changes", "../system/changes/hardlink_0.2.1_amd64.deb",
+		"../system/changes/hardlink_0.2.1.dsc", "../system/changes/hardlink_0.2.1.tar.gz")
+	c.Check(response.Code, Equals, 200)
+	c.Check(s.packages(c, repo), HasLen, 2)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/aptly-dev/aptly/aptly"
 	ctx "github.com/aptly-dev/aptly/context"
+	"github.com/aptly-dev/aptly/deb"
 	"github.com/aptly-dev/aptly/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -22,6 +23,8 @@ var context *ctx.AptlyContext
 func apiMetricsGet() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		countPackagesByRepos()
+		countTasks()
+		measureDatabaseSize()
 		promhttp.Handler().ServeHTTP(c.Writer, c.Request)
 	}
 }
@@ -83,8 +86,21 @@ func Router(c *ctx.AptlyContext) http.Handler {
 	}
 
 	if c.Config().ServeInAPIMode {
-		router.GET("/repos/", reposListInAPIMode(c.Config().FileSystemPublishRoots))
-		router.GET("/repos/:storage/*pkgPath", reposServeInAPIMode)
+		repos := router.Group("/repos")
+
+		accessLog, err := utils.OpenAccessLog(c.Config().ServeAccessLog)
+		if err != nil {
+			log.Error().Msgf("%s", err)
+		} else if accessLog != nil {
+			repos.Use(reposAccessLog(accessLog))
+		}
+
+		if downloadsRecorder == nil {
+			downloadsRecorder = deb.NewDownloadStatsRecorder(downloadStatsInterval, writeDownloads)
+		}
+
+		repos.GET("/", reposListInAPIMode)
+		repos.GET("/:storage/*pkgPath", reposServeInAPIMode)
 	}
 
 	api := router.Group("/api")
@@ -96,28 +112,12 @@ func Router(c *ctx.AptlyContext) http.Handler {
 
 		go acquireDatabase()
 
-		api.Use(func(c *gin.Context) {
-			var err error
-
-			errCh := make(chan error)
-			dbRequests <- dbRequest{acquiredb, errCh}
-
-			err = <-errCh
-			if err != nil {
-				AbortWithJSONError(c, 500, err)
-				return
-			}
-
-			defer func() {
-				dbRequests <- dbRequest{releasedb, errCh}
-				err = <-errCh
-				if err != nil {
-					AbortWithJSONError(c, 500, err)
-				}
-			}()
-
-			c.Next()
-		})
+		api.Use(databaseMiddleware)
+	}
+	api.Use(apiAuthMiddleware)
+	api.Use(tenancyMiddleware)
+	if c.Config().Replication.IsReplica() {
+		api.Use(replicaReadOnlyMiddleware)
 	}
 
 	{
@@ -125,7 +125,12 @@ func Router(c *ctx.AptlyContext) http.Handler {
 			api.GET("/metrics", apiMetricsGet())
 		}
 		api.GET("/version", apiVersion)
+		api.GET("/instance", apiInstance)
 		api.GET("/storage", apiDiskFree)
+		api.GET("/storage/health", apiStorageHealth)
+		api.GET("/config", apiConfigShow)
+		api.PATCH("/config", apiConfigUpdate)
+		api.POST("/config/reload", apiConfigReload)
 
 		isReady := &atomic.Value{}
 		isReady.Store(false)
@@ -142,9 +147,18 @@ func Router(c *ctx.AptlyContext) http.Handler {
 		api.DELETE("/repos/:name", apiReposDrop)
 
 		api.GET("/repos/:name/packages", apiReposPackagesShow)
+		api.GET("/repos/:name/multiarch", apiReposMultiArch)
+		api.GET("/repos/:name/licenses", apiReposLicenses)
 		api.POST("/repos/:name/packages", apiReposPackagesAdd)
+		api.POST("/repos/:name/packages/upload", apiReposPackagesUpload)
 		api.DELETE("/repos/:name/packages", apiReposPackagesDelete)
 
+		api.GET("/repos/:name/holds", apiReposHoldsShow)
+		api.POST("/repos/:name/holds", apiReposHoldsAdd)
+		api.DELETE("/repos/:name/holds", apiReposHoldsDelete)
+
+		api.POST("/repos/:name/prune", apiReposPrune)
+
 		api.POST("/repos/:name/file/:dir/:file", apiReposPackageFromFile)
 		api.POST("/repos/:name/file/:dir", apiReposPackageFromDir)
 		api.POST("/repos/:name/copy/:src/:file", apiReposCopyPackage)
@@ -165,7 +179,12 @@ func Router(c *ctx.AptlyContext) http.Handler {
 		api.GET("/mirrors/:name/packages", apiMirrorsPackages)
 		api.POST("/mirrors", apiMirrorsCreate)
 		api.PUT("/mirrors/:name", apiMirrorsUpdate)
+		api.POST("/mirrors/:name/pause", apiMirrorsPause)
+		api.POST("/mirrors/:name/resume", apiMirrorsResume)
 		api.DELETE("/mirrors/:name", apiMirrorsDrop)
+		api.GET("/mirrors/:name/schedule", apiMirrorsScheduleShow)
+		api.PUT("/mirrors/:name/schedule", apiMirrorsScheduleUpdate)
+		api.DELETE("/mirrors/:name/schedule", apiMirrorsScheduleDrop)
 	}
 
 	{
@@ -187,6 +206,8 @@ func Router(c *ctx.AptlyContext) http.Handler {
 	{
 		api.GET("/publish", apiPublishList)
 		api.GET("/publish/:prefix/:distribution", apiPublishShow)
+		api.GET("/publish/:prefix/:distribution/vulnerabilities", apiPublishVulnerabilities)
+		api.GET("/publish/:prefix/:distribution/sources-config", apiPublishSourcesConfig)
 		api.POST("/publish", apiPublishRepoOrSnapshot)
 		api.POST("/publish/:prefix", apiPublishRepoOrSnapshot)
 		api.PUT("/publish/:prefix/:distribution", apiPublishUpdateSwitch)
@@ -198,6 +219,13 @@ func Router(c *ctx.AptlyContext) http.Handler {
 		api.PUT("/publish/:prefix/:distribution/sources/:component", apiPublishUpdateSource)
 		api.DELETE("/publish/:prefix/:distribution/sources/:component", apiPublishRemoveSource)
 		api.POST("/publish/:prefix/:distribution/update", apiPublishUpdate)
+		api.POST("/publish/:prefix/:distribution/approve", apiPublishApprove)
+		api.POST("/publish/:prefix/:distribution/reject", apiPublishReject)
+		api.POST("/publish/:prefix/:distribution/freeze", apiPublishFreeze)
+		api.POST("/publish/:prefix/:distribution/unfreeze", apiPublishUnfreeze)
+		api.POST("/publish/:prefix/:distribution/replicas", apiPublishReplicas)
+		api.POST("/publish/:prefix/:distribution/verify", apiPublishVerify)
+		api.POST("/publish/:prefix/:distribution/resign", apiPublishResign)
 	}
 
 	{
@@ -206,23 +234,94 @@ func Router(c *ctx.AptlyContext) http.Handler {
 		api.PUT("/snapshots/:name", apiSnapshotsUpdate)
 		api.GET("/snapshots/:name", apiSnapshotsShow)
 		api.GET("/snapshots/:name/packages", apiSnapshotsSearchPackages)
+		api.GET("/snapshots/:name/multiarch", apiSnapshotsMultiArch)
+		api.GET("/snapshots/:name/licenses", apiSnapshotsLicenses)
+		api.GET("/snapshots/:name/vulnerabilities", apiSnapshotsVulnerabilities)
 		api.DELETE("/snapshots/:name", apiSnapshotsDrop)
 		api.GET("/snapshots/:name/diff/:withSnapshot", apiSnapshotsDiff)
 		api.POST("/snapshots/:name/merge", apiSnapshotsMerge)
 		api.POST("/snapshots/:name/pull", apiSnapshotsPull)
+		api.POST("/snapshots/:name/rebase", apiSnapshotsRebase)
 	}
 
 	{
 		api.GET("/packages/:key", apiPackagesShow)
+		api.GET("/packages/:key/control", apiPackagesControl)
+		api.GET("/packages/:key/files", apiPackagesFiles)
+		api.GET("/packages/:key/scripts", apiPackagesScripts)
 		api.GET("/packages", apiPackages)
 	}
 
 	{
+		api.GET("/incoming", apiIncomingList)
+		api.POST("/incoming", apiIncomingQueue)
+		api.GET("/incoming/:id", apiIncomingShow)
+		api.DELETE("/incoming/:id", apiIncomingDelete)
+		api.POST("/incoming/:id/checks", apiIncomingChecks)
+		api.POST("/incoming/:id/approve", apiIncomingApprove)
+		api.POST("/incoming/:id/reject", apiIncomingReject)
+	}
+
+	{
+		api.GET("/replication/status", apiReplicationStatus)
+		api.GET("/replication/changes", apiReplicationChanges)
+		api.GET("/replication/dump", apiReplicationDump)
+		api.GET("/replication/pool/*path", apiReplicationPoolFile)
+		api.POST("/replication/sync", apiReplicationSync)
+	}
+
+	{
+		api.GET("/security/trackers", apiSecurityTrackersList)
+	}
+
+	{
+		api.GET("/graphql", apiGraphQL)
+		api.POST("/graphql", apiGraphQL)
+	}
+
+	{
+		api.POST("/webhooks/:name", apiWebhook(router))
+	}
+
+	{
+		api.GET("/pipelines", apiPipelinesList)
+		api.POST("/pipelines", apiPipelinesCreate)
+		api.GET("/pipelines/:name", apiPipelinesShow)
+		api.PUT("/pipelines/:name", apiPipelinesUpdate)
+		api.DELETE("/pipelines/:name", apiPipelinesDrop)
+		api.POST("/pipelines/:name/run", apiPipelinesRun(router))
+	}
+
+	{
+		api.GET("/tenants", apiTenantsList)
+		api.GET("/tenants/:name", apiTenantsShow)
+	}
+
+	{
+		api.GET("/tokens", apiTokensList)
+		api.POST("/tokens", apiTokensCreate)
+		api.DELETE("/tokens/:name", apiTokensDrop)
+	}
+
+	{
+		api.GET("/downloads/top", apiDownloadsTop)
+		api.GET("/downloads/stale", apiDownloadsStale)
+	}
+
+	{
+		api.GET("/graph", apiGraphData)
 		api.GET("/graph.:ext", apiGraph)
 	}
 	{
 		api.POST("/db/cleanup", apiDbCleanup)
 	}
+	{
+		api.GET("/pool/orphans", apiPoolOrphans)
+		api.POST("/pool/orphans/prune", apiPoolOrphansPrune)
+	}
+	{
+		api.GET("/events", apiEvents)
+	}
 	{
 		api.GET("/tasks", apiTasksList)
 		api.POST("/tasks-clear", apiTasksClear)
@@ -235,6 +334,15 @@ func Router(c *ctx.AptlyContext) http.Handler {
 		api.DELETE("/tasks/:id", apiTasksDelete)
 		api.POST("/tasks-dummy", apiTasksDummy)
 	}
+	{
+		api.GET("/locks", apiLocksList)
+		api.POST("/locks", apiLocksCreate)
+		api.DELETE("/locks/:id", apiLocksDelete)
+	}
+
+	if c.Config().EnableWebUI {
+		registerWebUI(router, func() utils.ServeACL { return context.Config().WebUIAccessControl })
+	}
 
 	return router
 }
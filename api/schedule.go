@@ -0,0 +1,298 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// schedulerInterval is how often scheduler checks for due mirror updates
+var schedulerInterval = 15 * time.Second
+
+// scheduleLock serializes changes of mirror schedules, so that scheduler, scheduled updates
+// and API requests don't overwrite each other's changes
+var scheduleLock sync.Mutex
+
+// updateSchedule re-reads schedule of the mirror, applies change to it and stores it back
+//
+// If change returns false, schedule is not stored and nil is returned.
+func updateSchedule(collection *deb.MirrorScheduleCollection, repo *deb.RemoteRepo, change func(*deb.MirrorSchedule) bool) (*deb.MirrorSchedule, error) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	schedule, err := collection.ByMirror(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if !change(schedule) {
+		return nil, nil
+	}
+
+	return schedule, collection.Update(schedule)
+}
+
+type mirrorScheduleParams struct {
+	// Cron expression (minute, hour, day of month, month, day of week) in local time of API server
+	Cron string `json:"Cron"          example:"30 2 * * *"`
+	// Interval between updates in seconds, if cron expression is not set
+	Interval int `json:"Interval"     example:"0"`
+	// Steps run after successful update (same as pipeline steps), available to admins only
+	Actions []deb.PipelineStep `json:"Actions"`
+}
+
+// @Summary Get Mirror Schedule
+// @Description **Get schedule of automatic mirror updates with state of the last update**
+// @Tags Mirrors
+// @Param name path string true "mirror name"
+// @Produce json
+// @Success 200 {object} deb.MirrorSchedule
+// @Failure 404 {object} Error "Mirror not found or mirror has no schedule"
+// @Router /api/mirrors/{name}/schedule [get]
+func apiMirrorsScheduleShow(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+
+	repo, err := collectionFactory.RemoteRepoCollection().ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	schedule, err := collectionFactory.MirrorScheduleCollection().ByMirror(repo)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// @Summary Set Mirror Schedule
+// @Description **Create or replace schedule of automatic mirror updates**
+// @Description
+// @Description Mirror is updated by API server either according to `Cron` expression (e.g. `30 2 * * *` or `@daily`)
+// @Description or every `Interval` seconds. Updates are run as tasks, waiting for resources used by other tasks.
+// @Description
+// @Description `Actions` are run after successful update, each action is one of pipeline steps: `mirror-snapshot`,
+// @Description `repo-snapshot`, `snapshot-merge`, `publish-switch` or `publish-update`. Snapshot names could contain
+// @Description `{date}` and `{timestamp}` placeholders, replaced with the time update was started.
+// @Description Actions could be set by admins only.
+// @Tags Mirrors
+// @Param name path string true "mirror name"
+// @Consume json
+// @Param request body mirrorScheduleParams true "Parameters"
+// @Produce json
+// @Success 200 {object} deb.MirrorSchedule
+// @Failure 400 {object} Error "Invalid schedule"
+// @Failure 403 {object} Error "Actions are not allowed"
+// @Failure 404 {object} Error "Mirror not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/mirrors/{name}/schedule [put]
+func apiMirrorsScheduleUpdate(c *gin.Context) {
+	var b mirrorScheduleParams
+
+	if c.Bind(&b) != nil {
+		return
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+
+	repo, err := collectionFactory.RemoteRepoCollection().ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	// actions are run as trusted requests, so they could touch resources of any tenant
+	if len(b.Actions) > 0 && !adminRequest(c) {
+		AbortWithJSONError(c, http.StatusForbidden, fmt.Errorf("only admins are allowed to set actions of mirror schedule"))
+		return
+	}
+
+	schedule := deb.NewMirrorSchedule(repo, b.Cron, b.Interval, b.Actions)
+	if err = schedule.Validate(); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	collection := collectionFactory.MirrorScheduleCollection()
+
+	scheduleLock.Lock()
+	if previous, e := collection.ByMirror(repo); e == nil {
+		schedule.LastRun, schedule.LastError = previous.LastRun, previous.LastError
+	}
+	schedule.NextRun = schedule.Next(time.Now())
+
+	err = collection.Update(schedule)
+	scheduleLock.Unlock()
+
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// @Summary Delete Mirror Schedule
+// @Description **Stop automatic updates of mirror**
+// @Description
+// @Description Update already started is not interrupted.
+// @Tags Mirrors
+// @Param name path string true "mirror name"
+// @Produce json
+// @Success 200 ""
+// @Failure 404 {object} Error "Mirror not found or mirror has no schedule"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/mirrors/{name}/schedule [delete]
+func apiMirrorsScheduleDrop(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+
+	repo, err := collectionFactory.RemoteRepoCollection().ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	collection := collectionFactory.MirrorScheduleCollection()
+
+	if _, err = collection.ByMirror(repo); err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	scheduleLock.Lock()
+	err = collection.Drop(repo)
+	scheduleLock.Unlock()
+
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// RunScheduler starts scheduled mirror updates when they are due, until aptly is shut down
+//
+// Scheduler doesn't run on replica, as it is read-only.
+func RunScheduler(router http.Handler) {
+	if context.Config().Replication.IsReplica() {
+		return
+	}
+
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := startDueUpdates(router, time.Now()); err != nil {
+			log.Warn().Msgf("scheduler: %s", err)
+		}
+
+		select {
+		case <-context.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startDueUpdates starts tasks updating mirrors which are due at time now
+func startDueUpdates(router http.Handler, now time.Time) error {
+	err := acquireDatabaseConnection()
+	if err != nil {
+		return err
+	}
+	defer releaseDatabaseConnection()
+
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.MirrorScheduleCollection()
+
+	var due []*deb.MirrorSchedule
+	err = collection.ForEach(func(schedule *deb.MirrorSchedule) error {
+		if schedule.Due(now) {
+			due = append(due, schedule)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range due {
+		repo, err := collectionFactory.RemoteRepoCollection().ByUUID(schedule.MirrorUUID)
+		if err != nil {
+			log.Warn().Msgf("scheduler: %s", err)
+			continue
+		}
+
+		// next update is scheduled right away, if previous update is still queued or running,
+		// due update is coalesced with it, so that slow updates don't pile up
+		//
+		// schedule is re-read, as it might have been changed by finished update or replaced meanwhile
+		schedule, err = updateSchedule(collection, repo, func(current *deb.MirrorSchedule) bool {
+			if !current.Due(now) {
+				return false
+			}
+			current.NextRun = current.Next(now)
+			return true
+		})
+		if err != nil {
+			log.Warn().Msgf("scheduler: %s", err)
+			continue
+		}
+		if schedule == nil {
+			continue
+		}
+
+		if pending := context.TaskList().PendingTasks([]string{string(schedule.Key())}); len(pending) > 0 {
+			log.Info().Msgf("scheduler: skipping update of mirror %s, task %d is still pending", repo.Name, pending[0].ID)
+			continue
+		}
+
+		startScheduledUpdate(router, repo, schedule)
+	}
+
+	return nil
+}
+
+// startScheduledUpdate starts task updating mirror and running actions of its schedule
+func startScheduledUpdate(router http.Handler, repo *deb.RemoteRepo, schedule *deb.MirrorSchedule) {
+	resources := []string{string(schedule.Key())}
+	taskName := fmt.Sprintf("Scheduled update of mirror %s", repo.Name)
+
+	runTaskInBackground(taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		started := time.Now()
+
+		steps := append([]deb.PipelineStep{{Action: deb.PipelineActionMirrorUpdate, Mirror: repo.Name}},
+			deb.ExpandPipelineSteps(schedule.Actions, started)...)
+		code, err := runPipelineSteps(router, steps, out)
+
+		// schedule might have been replaced or removed while update was running
+		collection := context.NewCollectionFactory().MirrorScheduleCollection()
+		current, e := updateSchedule(collection, repo, func(current *deb.MirrorSchedule) bool {
+			current.LastRun = started
+			current.LastError = ""
+			if err != nil {
+				current.LastError = err.Error()
+			}
+			return true
+		})
+		if e != nil && current != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, e
+		}
+
+		if err != nil {
+			return &task.ProcessReturnValue{Code: code, Value: nil}, err
+		}
+
+		return &task.ProcessReturnValue{Code: http.StatusOK, Value: current}, nil
+	})
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/task"
+
+	. "gopkg.in/check.v1"
+)
+
+type ScheduleSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&ScheduleSuite{})
+
+func (s *ScheduleSuite) TestMirrorSchedule(c *C) {
+	response, _ := s.HTTPRequest("GET", "/api/mirrors/does-not-exist/schedule", nil)
+	c.Check(response.Code, Equals, 404)
+
+	collectionFactory := s.context.NewCollectionFactory()
+	repo, err := deb.NewRemoteRepo("scheduled", "http://127.0.0.1:1/debian/", "bookworm", []string{"main"}, []string{"amd64"}, false, false, false)
+	c.Assert(err, IsNil)
+	c.Assert(collectionFactory.RemoteRepoCollection().Add(repo), IsNil)
+	defer func() {
+		s.context.NewCollectionFactory().MirrorScheduleCollection().Drop(repo)
+		s.context.NewCollectionFactory().RemoteRepoCollection().Drop(repo)
+	}()
+
+	response, _ = s.HTTPRequest("GET", "/api/mirrors/scheduled/schedule", nil)
+	c.Check(response.Code, Equals, 404)
+	c.Check(response.Body.String(), Matches, ".*mirror scheduled has no schedule.*")
+
+	response, _ = s.HTTPRequest("PUT", "/api/mirrors/scheduled/schedule", bytes.NewReader([]byte(`{"Interval": 10}`)))
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Matches, ".*interval should be at least 60 seconds.*")
+
+	response, _ = s.HTTPRequest("PUT", "/api/mirrors/scheduled/schedule", bytes.NewReader([]byte(
+		`{"Cron": "@daily", "Actions": [{"Action": "mirror-snapshot", "Mirror": "scheduled", "Snapshot": "scheduled-{date}"}]}`)))
+	c.Assert(response.Code, Equals, 200)
+
+	var schedule deb.MirrorSchedule
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &schedule), IsNil)
+	c.Check(schedule.Mirror, Equals, "scheduled")
+	c.Check(schedule.Actions, HasLen, 1)
+	c.Check(schedule.NextRun.After(time.Now()), Equals, true)
+	c.Check(schedule.NextRun.Hour(), Equals, 0)
+
+	response, _ = s.HTTPRequest("GET", "/api/mirrors/scheduled/schedule", nil)
+	c.Check(response.Code, Equals, 200)
+
+	// update isn't due yet
+	c.Assert(startDueUpdates(s.router, time.Now()), IsNil)
+	s.context.TaskList().Wait()
+	current, err := s.context.NewCollectionFactory().MirrorScheduleCollection().ByMirror(repo)
+	c.Assert(err, IsNil)
+	c.Check(current.LastRun.IsZero(), Equals, true)
+
+	// due update fails, as mirror is not reachable, actions are not run
+	later := schedule.NextRun.Add(time.Minute)
+	c.Assert(startDueUpdates(s.router, later), IsNil)
+	s.context.TaskList().Wait()
+	s.context.TaskList().Clear()
+
+	current, err = s.context.NewCollectionFactory().MirrorScheduleCollection().ByMirror(repo)
+	c.Assert(err, IsNil)
+	c.Check(current.LastRun.IsZero(), Equals, false)
+	c.Check(current.LastError, Matches, "step 1 \\(mirror-update\\): .*")
+	c.Check(current.NextRun.After(later), Equals, true)
+
+	_, err = s.context.NewCollectionFactory().SnapshotCollection().ByName("scheduled-" + current.LastRun.UTC().Format("20060102"))
+	c.Check(err, NotNil)
+
+	response, _ = s.HTTPRequest("DELETE", "/api/mirrors/scheduled/schedule", nil)
+	c.Check(response.Code, Equals, 200)
+	response, _ = s.HTTPRequest("DELETE", "/api/mirrors/scheduled/schedule", nil)
+	c.Check(response.Code, Equals, 404)
+}
+
+func (s *ScheduleSuite) TestMirrorScheduleCoalesce(c *C) {
+	collectionFactory := s.context.NewCollectionFactory()
+	repo, err := deb.NewRemoteRepo("coalesced", "http://127.0.0.1:1/debian/", "bookworm", []string{"main"}, []string{"amd64"}, false, false, false)
+	c.Assert(err, IsNil)
+	c.Assert(collectionFactory.RemoteRepoCollection().Add(repo), IsNil)
+	defer func() {
+		s.context.NewCollectionFactory().MirrorScheduleCollection().Drop(repo)
+		s.context.NewCollectionFactory().RemoteRepoCollection().Drop(repo)
+	}()
+
+	response, _ := s.HTTPRequest("PUT", "/api/mirrors/coalesced/schedule", bytes.NewReader([]byte(`{"Interval": 3600}`)))
+	c.Assert(response.Code, Equals, 200)
+
+	schedule, err := collectionFactory.MirrorScheduleCollection().ByMirror(repo)
+	c.Assert(err, IsNil)
+
+	// previous update of the mirror is still running
+	release := make(chan struct{})
+	running, conflictErr := s.context.TaskList().RunTaskInBackground("Scheduled update of mirror coalesced", []string{string(schedule.Key())},
+		func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+			<-release
+			return nil, nil
+		})
+	c.Assert(conflictErr, IsNil)
+
+	later := schedule.NextRun.Add(time.Minute)
+	c.Assert(startDueUpdates(s.router, later), IsNil)
+
+	pending := s.context.TaskList().PendingTasks([]string{string(schedule.Key())})
+	c.Check(pending, HasLen, 1)
+	c.Check(pending[0].ID, Equals, running.ID)
+
+	current, err := s.context.NewCollectionFactory().MirrorScheduleCollection().ByMirror(repo)
+	c.Assert(err, IsNil)
+	c.Check(current.NextRun.After(later), Equals, true)
+	c.Check(current.LastRun.IsZero(), Equals, true)
+
+	close(release)
+	s.context.TaskList().Wait()
+	s.context.TaskList().Clear()
+}
+
+func (s *ScheduleSuite) TestMirrorScheduleConcurrentUpdates(c *C) {
+	collectionFactory := s.context.NewCollectionFactory()
+	repo, err := deb.NewRemoteRepo("concurrent", "http://127.0.0.1:1/debian/", "bookworm", []string{"main"}, []string{"amd64"}, false, false, false)
+	c.Assert(err, IsNil)
+	c.Assert(collectionFactory.RemoteRepoCollection().Add(repo), IsNil)
+	defer func() {
+		s.context.NewCollectionFactory().MirrorScheduleCollection().Drop(repo)
+		s.context.NewCollectionFactory().RemoteRepoCollection().Drop(repo)
+	}()
+
+	response, _ := s.HTTPRequest("PUT", "/api/mirrors/concurrent/schedule", bytes.NewReader([]byte(`{"Interval": 3600}`)))
+	c.Assert(response.Code, Equals, 200)
+
+	// scheduler and finished updates change the same schedule, none of the changes is lost
+	const updates = 20
+
+	var wg sync.WaitGroup
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			collection := s.context.NewCollectionFactory().MirrorScheduleCollection()
+			_, e := updateSchedule(collection, repo, func(current *deb.MirrorSchedule) bool {
+				// give other updates a chance to interleave
+				time.Sleep(time.Millisecond)
+				current.LastError += "x"
+				return true
+			})
+			c.Check(e, IsNil)
+		}()
+	}
+	wg.Wait()
+
+	current, err := collectionFactory.MirrorScheduleCollection().ByMirror(repo)
+	c.Assert(err, IsNil)
+	c.Check(current.LastError, HasLen, updates)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/security/trackers
+func apiSecurityTrackersList(c *gin.Context) {
+	trackers := []*deb.SecurityTracker{}
+
+	err := context.NewCollectionFactory().SecurityTrackerCollection().ForEach(func(t *deb.SecurityTracker) error {
+		trackers = append(trackers, t)
+		return nil
+	})
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, trackers)
+}
+
+// Common piece of code to report vulnerable packages against
+// security tracker specified with tracker query parameter
+func showVulnerabilities(c *gin.Context, reflists []*deb.PackageRefList, collectionFactory *deb.CollectionFactory) {
+	trackerName := c.Request.URL.Query().Get("tracker")
+	if trackerName == "" {
+		AbortWithJSONError(c, http.StatusBadRequest, fmt.Errorf("security tracker should be specified with tracker parameter"))
+		return
+	}
+
+	tracker, err := collectionFactory.SecurityTrackerCollection().ByName(trackerName)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusNotFound, err)
+		return
+	}
+
+	report, err := deb.NewSecurityReport(reflists, collectionFactory.PackageCollection(), tracker)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("unable to check: %s", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Tracker":  tracker,
+		"Packages": report,
+	})
+}
@@ -32,13 +32,46 @@ func apiSnapshotsList(c *gin.Context) {
 
 	result := []*deb.Snapshot{}
 	collection.ForEachSorted(SortMethodString, func(snapshot *deb.Snapshot) error {
-		result = append(result, snapshot)
+		if tenantVisible(c, snapshot.Name) {
+			result = append(result, snapshot)
+		}
 		return nil
 	})
 
 	c.JSON(200, result)
 }
 
+// checkSourceHandling validates handling modes of source packages, aborting request on error
+func checkSourceHandling(c *gin.Context, modes ...string) bool {
+	for _, mode := range modes {
+		if err := deb.ValidateSourceHandling(mode); err != nil {
+			AbortWithJSONError(c, http.StatusBadRequest, err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterSnapshotSources drops source packages from new snapshot according to handling modes
+func filterSnapshotSources(snapshot *deb.Snapshot, collectionFactory *deb.CollectionFactory,
+	extraSourceOnly, orphanedSources string, out aptly.Progress) error {
+	if extraSourceOnly == "" && orphanedSources == "" {
+		return nil
+	}
+
+	dropped, err := snapshot.FilterSources(collectionFactory.PackageCollection(), extraSourceOnly, orphanedSources)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range dropped {
+		out.Printf("Dropped %s\n", p)
+	}
+
+	return nil
+}
+
 // POST /api/mirrors/:name/snapshots/
 func apiSnapshotsCreateFromMirror(c *gin.Context) {
 	var (
@@ -50,9 +83,13 @@ func apiSnapshotsCreateFromMirror(c *gin.Context) {
 	var b struct {
 		Name        string `binding:"required"`
 		Description string
+		// Handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only
+		ExtraSourceOnly string
+		// Handling of source packages without binaries: keep, drop or keep-referenced-only
+		OrphanedSources string
 	}
 
-	if c.Bind(&b) != nil {
+	if c.Bind(&b) != nil || !checkSourceHandling(c, b.ExtraSourceOnly, b.OrphanedSources) {
 		return
 	}
 
@@ -70,7 +107,7 @@ func apiSnapshotsCreateFromMirror(c *gin.Context) {
 	// including snapshot resource key
 	resources := []string{string(repo.Key()), "S" + b.Name}
 	taskName := fmt.Sprintf("Create snapshot of mirror %s", name)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err := repo.CheckLock()
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusConflict, Value: nil}, err
@@ -90,10 +127,17 @@ func apiSnapshotsCreateFromMirror(c *gin.Context) {
 			snapshot.Description = b.Description
 		}
 
+		err = filterSnapshotSources(snapshot, collectionFactory, b.ExtraSourceOnly, b.OrphanedSources, out)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
 		err = snapshotCollection.Add(snapshot)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, err
 		}
+
+		context.SnapshotCreated(snapshot, out)
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: snapshot}, nil
 	})
 }
@@ -110,9 +154,13 @@ func apiSnapshotsCreate(c *gin.Context) {
 		Description     string
 		SourceSnapshots []string
 		PackageRefs     []string
+		// Handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only
+		ExtraSourceOnly string
+		// Handling of source packages without binaries: keep, drop or keep-referenced-only
+		OrphanedSources string
 	}
 
-	if c.Bind(&b) != nil {
+	if c.Bind(&b) != nil || !checkSourceHandling(c, b.ExtraSourceOnly, b.OrphanedSources) {
 		return
 	}
 
@@ -138,7 +186,7 @@ func apiSnapshotsCreate(c *gin.Context) {
 		resources = append(resources, string(sources[i].ResourceKey()))
 	}
 
-	maybeRunTaskInBackground(c, "Create snapshot "+b.Name, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, "Create snapshot "+b.Name, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		for i := range sources {
 			err = snapshotCollection.LoadComplete(sources[i])
 			if err != nil {
@@ -165,10 +213,17 @@ func apiSnapshotsCreate(c *gin.Context) {
 
 		snapshot = deb.NewSnapshotFromRefList(b.Name, sources, deb.NewPackageRefListFromPackageList(list), b.Description)
 
+		err = filterSnapshotSources(snapshot, collectionFactory, b.ExtraSourceOnly, b.OrphanedSources, out)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
 		err = snapshotCollection.Add(snapshot)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, err
 		}
+
+		context.SnapshotCreated(snapshot, out)
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: snapshot}, nil
 	})
 }
@@ -184,9 +239,13 @@ func apiSnapshotsCreateFromRepository(c *gin.Context) {
 	var b struct {
 		Name        string `binding:"required"`
 		Description string
+		// Handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only
+		ExtraSourceOnly string
+		// Handling of source packages without binaries: keep, drop or keep-referenced-only
+		OrphanedSources string
 	}
 
-	if c.Bind(&b) != nil {
+	if c.Bind(&b) != nil || !checkSourceHandling(c, b.ExtraSourceOnly, b.OrphanedSources) {
 		return
 	}
 
@@ -204,7 +263,7 @@ func apiSnapshotsCreateFromRepository(c *gin.Context) {
 	// including snapshot resource key
 	resources := []string{string(repo.Key()), "S" + b.Name}
 	taskName := fmt.Sprintf("Create snapshot of repo %s", name)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err := collection.LoadComplete(repo)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
@@ -219,10 +278,17 @@ func apiSnapshotsCreateFromRepository(c *gin.Context) {
 			snapshot.Description = b.Description
 		}
 
+		err = filterSnapshotSources(snapshot, collectionFactory, b.ExtraSourceOnly, b.OrphanedSources, out)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
 		err = snapshotCollection.Add(snapshot)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, err
 		}
+
+		context.SnapshotCreated(snapshot, out)
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: snapshot}, nil
 	})
 }
@@ -387,6 +453,72 @@ func apiSnapshotsDiff(c *gin.Context) {
 	c.JSON(200, result)
 }
 
+// GET /api/snapshots/:name/multiarch
+func apiSnapshotsMultiArch(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.SnapshotCollection()
+
+	snapshot, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, 404, err)
+		return
+	}
+
+	err = collection.LoadComplete(snapshot)
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	problems, err := deb.NewMultiArchReport(snapshot.RefList(), collectionFactory.PackageCollection())
+	if err != nil {
+		AbortWithJSONError(c, 500, fmt.Errorf("unable to check Multi-Arch consistency: %s", err))
+		return
+	}
+
+	c.JSON(200, problems)
+}
+
+// GET /api/snapshots/:name/licenses
+func apiSnapshotsLicenses(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.SnapshotCollection()
+
+	snapshot, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, 404, err)
+		return
+	}
+
+	err = collection.LoadComplete(snapshot)
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	showLicenses(c, snapshot.RefList(), collectionFactory)
+}
+
+// GET /api/snapshots/:name/vulnerabilities
+func apiSnapshotsVulnerabilities(c *gin.Context) {
+	collectionFactory := context.NewCollectionFactory()
+	collection := collectionFactory.SnapshotCollection()
+
+	snapshot, err := collection.ByName(c.Params.ByName("name"))
+	if err != nil {
+		AbortWithJSONError(c, 404, err)
+		return
+	}
+
+	err = collection.LoadComplete(snapshot)
+	if err != nil {
+		AbortWithJSONError(c, 500, err)
+		return
+	}
+
+	showVulnerabilities(c, []*deb.PackageRefList{snapshot.RefList()}, collectionFactory)
+}
+
 // GET /api/snapshots/:name/packages
 func apiSnapshotsSearchPackages(c *gin.Context) {
 	collectionFactory := context.NewCollectionFactory()
@@ -472,7 +604,7 @@ func apiSnapshotsMerge(c *gin.Context) {
 		resources[i] = string(sources[i].ResourceKey())
 	}
 
-	maybeRunTaskInBackground(c, "Merge snapshot "+name, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, "Merge snapshot "+name, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = snapshotCollection.LoadComplete(sources[0])
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
@@ -503,6 +635,8 @@ func apiSnapshotsMerge(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to create snapshot: %s", err)
 		}
 
+		context.SnapshotCreated(snapshot, out)
+
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: snapshot}, nil
 	})
 }
@@ -516,6 +650,17 @@ type snapshotsPullParams struct {
 	Queries []string `binding:"required"   json:"Queries"           example:"xserver-xorg"`
 	// List of architectures (optional)
 	Architectures []string `               json:"Architectures"     example:"amd64, armhf"`
+	// Ordered list of additional providers to resolve dependencies against: [snapshot:|mirror:|repo:]<name>
+	Providers []string `                   json:"Providers"         example:"snapshot:wheezy-main"`
+}
+
+type snapshotsPullResolution struct {
+	// Dependency being resolved
+	Dependency string `json:"dependency"`
+	// Package which satisfied dependency, empty if unsatisfied
+	Package string `json:"package,omitempty"`
+	// Provider which supplied the package
+	Provider string `json:"provider,omitempty"`
 }
 
 // @Summary Snapshot Pull
@@ -580,7 +725,7 @@ func apiSnapshotsPull(c *gin.Context) {
 
 	resources := []string{string(sourceSnapshot.ResourceKey()), string(toSnapshot.ResourceKey())}
 	taskName := fmt.Sprintf("Pull snapshot %s into %s and save as %s", body.Source, name, body.Destination)
-	maybeRunTaskInBackground(c, taskName, resources, func(_ aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
 		err = collectionFactory.SnapshotCollection().LoadComplete(toSnapshot)
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
@@ -635,13 +780,28 @@ func apiSnapshotsPull(c *gin.Context) {
 			queries[i] = &deb.AndQuery{L: queries[i], R: archQuery}
 		}
 
+		providers, providerSnapshots, err := deb.LoadDependencyProviders(collectionFactory, body.Providers, context.Progress())
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusBadRequest, Value: nil}, err
+		}
+		providers = append([]deb.DependencyProvider{{Name: sourceSnapshot.Name, List: sourcePackageList}}, providers...)
+
 		// Filter with dependencies as requested
-		destinationPackageList, err := sourcePackageList.FilterWithProgress(queries, !noDeps, toPackageList, context.DependencyOptions(), architecturesList, context.Progress())
+		destinationPackageList, resolutions, err := sourcePackageList.FilterWithProviders(queries, !noDeps, toPackageList, providers, context.DependencyOptions(), architecturesList, context.Progress())
 		if err != nil {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 		}
 		destinationPackageList.PrepareIndex()
 
+		resolvedDependencies := []snapshotsPullResolution{}
+		for _, r := range resolutions {
+			resolution := snapshotsPullResolution{Dependency: r.Dependency.String(), Provider: r.Provider}
+			if r.Package != nil {
+				resolution.Package = r.Package.String()
+			}
+			resolvedDependencies = append(resolvedDependencies, resolution)
+		}
+
 		removedPackages := []string{}
 		addedPackages := []string{}
 		alreadySeen := map[string]bool{}
@@ -674,18 +834,20 @@ func apiSnapshotsPull(c *gin.Context) {
 
 		if dryRun {
 			response := struct {
-				AddedPackages   []string `json:"added_packages"`
-				RemovedPackages []string `json:"removed_packages"`
+				AddedPackages        []string                  `json:"added_packages"`
+				RemovedPackages      []string                  `json:"removed_packages"`
+				ResolvedDependencies []snapshotsPullResolution `json:"resolved_dependencies"`
 			}{
-				AddedPackages:   addedPackages,
-				RemovedPackages: removedPackages,
+				AddedPackages:        addedPackages,
+				RemovedPackages:      removedPackages,
+				ResolvedDependencies: resolvedDependencies,
 			}
 
 			return &task.ProcessReturnValue{Code: http.StatusOK, Value: response}, nil
 		}
 
 		// Create <destination> snapshot
-		destinationSnapshot = deb.NewSnapshotFromPackageList(body.Destination, []*deb.Snapshot{toSnapshot, sourceSnapshot}, toPackageList,
+		destinationSnapshot = deb.NewSnapshotFromPackageList(body.Destination, append([]*deb.Snapshot{toSnapshot, sourceSnapshot}, providerSnapshots...), toPackageList,
 			fmt.Sprintf("Pulled into '%s' with '%s' as source, pull request was: '%s'", toSnapshot.Name, sourceSnapshot.Name, strings.Join(body.Queries, ", ")))
 
 		err = collectionFactory.SnapshotCollection().Add(destinationSnapshot)
@@ -693,6 +855,120 @@ func apiSnapshotsPull(c *gin.Context) {
 			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
 		}
 
+		context.SnapshotCreated(destinationSnapshot, out)
+
 		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: destinationSnapshot}, nil
 	})
 }
+
+type snapshotsRebaseParams struct {
+	// Name of snapshot `name` was derived from
+	Base string `binding:"required"        json:"Base"          example:"wheezy-main-2024-01"`
+	// Name of snapshot to re-apply changes to
+	NewBase string `binding:"required"     json:"NewBase"       example:"wheezy-main-2024-02"`
+	// Name of the snapshot to be created
+	Destination string `binding:"required" json:"Destination"   example:"wheezy-curated-2024-02"`
+	// Resolve conflicts by keeping packages from new base
+	PreferBase bool `                      json:"PreferBase"`
+}
+
+type snapshotsRebaseResult struct {
+	// Created snapshot, not set for dry run
+	Snapshot *deb.Snapshot `json:",omitempty"`
+	// Changes re-applied cleanly
+	Applied deb.PackageDiffs
+	// Changes conflicting with new base
+	Conflicts []deb.RebaseConflict
+}
+
+// @Summary Snapshot Rebase
+// @Description **Recreate snapshot derived from base snapshot on top of newer base**
+// @Description
+// @Description Changes which distinguish snapshot `name` from snapshot `Base` (packages added, removed or replaced) are re-applied
+// @Description on top of snapshot `NewBase`, e.g. newer snapshot of the same mirror. New snapshot `Destination` is created as result.
+// @Description
+// @Description Change is a conflict if `NewBase` changed the same package (name and architecture) compared to `Base`. Conflicts are reported,
+// @Description and by default change from snapshot `name` wins. With `PreferBase`, packages from `NewBase` win instead.
+// @Tags Snapshots
+// @Param name path string true "Name of the derived snapshot"
+// @Param dry-run query int false "don’t create destination snapshot, just show what would be changed: 1 to enable"
+// @Consume json
+// @Param request body snapshotsRebaseParams true "Parameters"
+// @Produce json
+// @Success 200 {object} snapshotsRebaseResult "Dry run result"
+// @Success 201 {object} snapshotsRebaseResult "Snapshot created"
+// @Failure 400 {object} Error "Bad Request"
+// @Failure 404 {object} Error "Not Found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/snapshots/{name}/rebase [post]
+func apiSnapshotsRebase(c *gin.Context) {
+	var body snapshotsRebaseParams
+
+	name := c.Params.ByName("name")
+
+	if err := c.BindJSON(&body); err != nil {
+		AbortWithJSONError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	dryRun := c.Request.URL.Query().Get("dry-run") == "1"
+
+	collectionFactory := context.NewCollectionFactory()
+	snapshotCollection := collectionFactory.SnapshotCollection()
+
+	snapshots := make([]*deb.Snapshot, 3)
+	resources := make([]string, 3)
+	for i, snapshotName := range []string{name, body.Base, body.NewBase} {
+		snapshot, err := snapshotCollection.ByName(snapshotName)
+		if err != nil {
+			AbortWithJSONError(c, http.StatusNotFound, err)
+			return
+		}
+
+		snapshots[i] = snapshot
+		resources[i] = string(snapshot.ResourceKey())
+	}
+
+	snapshot, base, newBase := snapshots[0], snapshots[1], snapshots[2]
+
+	taskName := fmt.Sprintf("Rebase snapshot %s from %s onto %s and save as %s", name, body.Base, body.NewBase, body.Destination)
+	maybeRunTaskInBackground(c, taskName, resources, func(out aptly.Progress, _ *task.Detail) (*task.ProcessReturnValue, error) {
+		for _, s := range snapshots {
+			err := snapshotCollection.LoadComplete(s)
+			if err != nil {
+				return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+			}
+		}
+
+		result, applied, conflicts, err := deb.Rebase(snapshot.RefList(), base.RefList(), newBase.RefList(),
+			collectionFactory.PackageCollection(), body.PreferBase, out)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, err
+		}
+
+		for _, conflict := range conflicts {
+			out.Printf("Conflict: %s\n", conflict)
+		}
+
+		response := snapshotsRebaseResult{Applied: applied, Conflicts: conflicts}
+		if response.Conflicts == nil {
+			response.Conflicts = []deb.RebaseConflict{}
+		}
+
+		if dryRun {
+			return &task.ProcessReturnValue{Code: http.StatusOK, Value: response}, nil
+		}
+
+		response.Snapshot = deb.NewSnapshotFromRefList(body.Destination, []*deb.Snapshot{newBase, snapshot}, result,
+			fmt.Sprintf("Rebased '%s' from '%s' onto '%s'", snapshot.Name, base.Name, newBase.Name))
+
+		err = snapshotCollection.Add(response.Snapshot)
+		if err != nil {
+			return &task.ProcessReturnValue{Code: http.StatusInternalServerError, Value: nil}, fmt.Errorf("unable to create snapshot: %s", err)
+		}
+
+		context.SnapshotCreated(response.Snapshot, out)
+
+		return &task.ProcessReturnValue{Code: http.StatusCreated, Value: response}, nil
+	})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	. "gopkg.in/check.v1"
+)
+
+type SnapshotSuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&SnapshotSuite{})
+
+func (s *SnapshotSuite) TestCreateSourceHandling(c *C) {
+	name := fmt.Sprintf("sources-%d", time.Now().UnixNano())
+
+	response, _ := s.HTTPRequest("POST", "/api/repos", bytes.NewBufferString(`{"Name": "`+name+`"}`))
+	c.Assert(response.Code, Equals, 201)
+	defer s.HTTPRequest("DELETE", "/api/repos/"+name+"?force=1", nil)
+
+	collectionFactory := s.context.NewCollectionFactory()
+	list := deb.NewPackageList()
+
+	binary := deb.NewPackageFromControlFile(deb.Stanza{"Package": "app", "Version": "1.0", "Architecture": "amd64"})
+	c.Assert(collectionFactory.PackageCollection().Update(binary), IsNil)
+	c.Assert(list.Add(binary), IsNil)
+
+	sources := map[string]string{}
+	for _, stanza := range []deb.Stanza{
+		{"Package": "app", "Version": "1.0", "Architecture": "any"},
+		{"Package": "orphan", "Version": "1.0", "Architecture": "any"},
+		{"Package": "extra", "Version": "1.0", "Architecture": "any", "Extra-Source-Only": "yes"},
+	} {
+		p, err := deb.NewSourcePackageFromControlFile(stanza)
+		c.Assert(err, IsNil)
+		c.Assert(collectionFactory.PackageCollection().Update(p), IsNil)
+		c.Assert(list.Add(p), IsNil)
+		sources[p.Name] = string(p.Key(""))
+	}
+	app := string(binary.Key(""))
+
+	repo, err := collectionFactory.LocalRepoCollection().ByName(name)
+	c.Assert(err, IsNil)
+	repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
+	c.Assert(collectionFactory.LocalRepoCollection().Update(repo), IsNil)
+
+	response, _ = s.HTTPRequest("POST", "/api/repos/"+name+"/snapshots", bytes.NewBufferString(`{"Name": "`+name+`", "OrphanedSources": "maybe"}`))
+	c.Check(response.Code, Equals, 400)
+	c.Check(response.Body.String(), Matches, ".*unknown source handling mode.*")
+
+	response, _ = s.HTTPRequest("POST", "/api/repos/"+name+"/snapshots", bytes.NewBufferString(`{"Name": "`+name+`", "OrphanedSources": "drop"}`))
+	c.Assert(response.Code, Equals, 201)
+	defer s.HTTPRequest("DELETE", "/api/snapshots/"+name, nil)
+
+	c.Check(s.snapshotPackages(c, name), DeepEquals, []string{app, sources["app"], sources["extra"]})
+
+	response, _ = s.HTTPRequest("POST", "/api/snapshots", bytes.NewBufferString(`{"Name": "`+name+`-filtered", "PackageRefs": ["`+app+`", "`+sources["app"]+`", "`+sources["extra"]+`"], "ExtraSourceOnly": "drop"}`))
+	c.Assert(response.Code, Equals, 201)
+	defer s.HTTPRequest("DELETE", "/api/snapshots/"+name+"-filtered", nil)
+
+	c.Check(s.snapshotPackages(c, name+"-filtered"), DeepEquals, []string{app, sources["app"]})
+}
+
+func (s *SnapshotSuite) snapshotPackages(c *C, name string) []string {
+	response, _ := s.HTTPRequest("GET", "/api/snapshots/"+name+"/packages", nil)
+	c.Assert(response.Code, Equals, 200)
+
+	var refs []string
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &refs), IsNil)
+	sort.Strings(refs)
+	return refs
+}
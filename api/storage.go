@@ -2,9 +2,13 @@ package api
 
 import (
 	"fmt"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/aptly-dev/aptly/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 )
 
 type diskFree struct {
@@ -41,3 +45,98 @@ func apiDiskFree(c *gin.Context) {
 
 	c.JSON(200, df)
 }
+
+type storageHealth struct {
+	// Published storage name, e.g. `s3:test`
+	Storage string
+	// Whether storage passed the check
+	Healthy bool
+	// Error, if check failed
+	Error string `json:",omitempty"`
+	// Time of the check
+	Checked time.Time
+	// Duration of the check [s]
+	Duration float64
+}
+
+// checkPublishedStorages checks published storages concurrently, updating metrics
+func checkPublishedStorages(names []string) []storageHealth {
+	result := make([]storageHealth, len(names))
+
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(health *storageHealth, name string) {
+			defer wg.Done()
+
+			health.Storage = name
+			health.Checked = time.Now()
+
+			err := context.CheckPublishedStorage(name)
+
+			health.Duration = time.Since(health.Checked).Seconds()
+			health.Healthy = err == nil
+			if err != nil {
+				health.Error = err.Error()
+			}
+
+			healthy := 0.0
+			if health.Healthy {
+				healthy = 1.0
+			}
+			apiPublishedStorageHealthyGauge.WithLabelValues(name).Set(healthy)
+			apiPublishedStorageHealthCheckTimestampGauge.WithLabelValues(name).Set(float64(health.Checked.Unix()))
+		}(&result[i], names[i])
+	}
+	wg.Wait()
+
+	return result
+}
+
+// CheckPublishedStorages checks all configured published storages, logging failures
+//
+// It is run on API server startup, so that broken credentials are detected before publishing
+func CheckPublishedStorages() {
+	for _, health := range checkPublishedStorages(context.PublishedStorageNames()) {
+		if health.Healthy {
+			log.Info().Msgf("published storage %s is healthy", health.Storage)
+		} else {
+			log.Warn().Msgf("published storage %s health check failed: %s", health.Storage, health.Error)
+		}
+	}
+}
+
+// @Summary Published Storage Health
+// @Description **Check published storages**
+// @Description
+// @Description Every configured published storage (or the one specified with `storage`) is checked by writing
+// @Description and removing probe file in `.aptly-health` directory (or with storage specific check).
+// @Tags Status
+// @Produce json
+// @Param storage query string false "check only this published storage, e.g. `s3:test`"
+// @Success 200 {array} storageHealth "All storages are healthy"
+// @Failure 404 {object} Error "Storage not configured"
+// @Failure 503 {array} storageHealth "Some storages failed the check"
+// @Router /api/storage/health [get]
+func apiStorageHealth(c *gin.Context) {
+	names := context.PublishedStorageNames()
+
+	if storage := c.Query("storage"); storage != "" {
+		if !utils.StrSliceHasItem(names, storage) {
+			AbortWithJSONError(c, 404, fmt.Errorf("published storage %s not configured", storage))
+			return
+		}
+		names = []string{storage}
+	}
+
+	result := checkPublishedStorages(names)
+
+	status := 200
+	for _, health := range result {
+		if !health.Healthy {
+			status = 503
+		}
+	}
+
+	c.JSON(status, result)
+}
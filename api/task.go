@@ -1,10 +1,12 @@
 package api
 
 import (
+	stdcontext "context"
 	"net/http"
 	"strconv"
 
 	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
 	"github.com/aptly-dev/aptly/task"
 	"github.com/gin-gonic/gin"
 )
@@ -127,7 +129,18 @@ func apiTasksReturnValueShow(c *gin.Context) {
 	c.JSON(200, output)
 }
 
-// DELETE /tasks/:id
+// @Summary Delete or cancel task
+// @Description **Delete finished task or cancel queued or running task**
+// @Description
+// @Description Queued task is marked as failed right away. Running task is asked to stop and fails once it stops,
+// @Description operations which can't be interrupted safely (e.g. finalizing of publishing) are completed first.
+// @Tags Tasks
+// @Param id path int true "Task ID"
+// @Produce json
+// @Success 200 {object} task.Task "Task deleted"
+// @Success 202 {object} task.Task "Task cancelled"
+// @Failure 400 {object} Error "Task not found or task is a lock"
+// @Router /api/tasks/{id} [delete]
 func apiTasksDelete(c *gin.Context) {
 	list := context.TaskList()
 	id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 0)
@@ -137,6 +150,18 @@ func apiTasksDelete(c *gin.Context) {
 	}
 
 	var delTask task.Task
+	delTask, err = list.GetTaskByID(int(id))
+	if err == nil && (delTask.State == task.IDLE || delTask.State == task.RUNNING) {
+		delTask, err = list.CancelTaskByID(int(id))
+		if err != nil {
+			AbortWithJSONError(c, 400, err)
+			return
+		}
+
+		c.JSON(202, delTask)
+		return
+	}
+
 	delTask, err = list.DeleteTaskByID(int(id))
 	if err != nil {
 		AbortWithJSONError(c, 400, err)
@@ -157,3 +182,54 @@ func apiTasksDummy(c *gin.Context) {
 		return &task.ProcessReturnValue{Code: http.StatusTeapot, Value: []int{1, 2, 3}}, nil
 	})
 }
+
+type subtaskRequestKey struct{}
+
+// subtaskRequest makes task started by request dispatched internally from within other task
+// (e.g. pipeline step) cancelled together with that task
+func subtaskRequest(req *http.Request, out aptly.Progress) *http.Request {
+	return req.WithContext(stdcontext.WithValue(out.Context(), subtaskRequestKey{}, true))
+}
+
+// taskStore persists tasks in database, acquiring database connection for each change
+type taskStore struct{}
+
+func (taskStore) Put(record *task.Record) error {
+	return withTaskRecords(func(collection *deb.TaskRecordCollection) error {
+		return collection.Put(record)
+	})
+}
+
+func (taskStore) Delete(ID int) error {
+	return withTaskRecords(func(collection *deb.TaskRecordCollection) error {
+		return collection.Delete(ID)
+	})
+}
+
+func (taskStore) ForEach(handler func(*task.Record) error) error {
+	return withTaskRecords(func(collection *deb.TaskRecordCollection) error {
+		return collection.ForEach(handler)
+	})
+}
+
+func withTaskRecords(handler func(collection *deb.TaskRecordCollection) error) error {
+	err := acquireDatabaseConnection()
+	if err != nil {
+		return err
+	}
+	defer releaseDatabaseConnection()
+
+	return handler(context.NewCollectionFactory().TaskRecordCollection())
+}
+
+// RestoreTasks makes API server persist tasks in database and restores tasks of the previous run
+//
+// Tasks which were queued or running when API server was stopped are marked as failed.
+// Tasks are not persisted on replica, as its database follows primary.
+func RestoreTasks() error {
+	if context.Config().Replication.IsReplica() {
+		return nil
+	}
+
+	return context.TaskList().SetStore(taskStore{})
+}
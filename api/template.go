@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// templateParams is part of request referencing resource template
+type templateParams struct {
+	// Name of resource template with default settings
+	Template string `json:"Template"`
+}
+
+// templatedParams are request parameters which could be pre-filled from resource template
+type templatedParams interface {
+	applyTemplate(template *utils.ResourceTemplate)
+}
+
+// bindWithTemplate binds request body to params, pre-filling them with settings
+// of resource template referenced in the request, so that settings in request
+// take precedence
+func bindWithTemplate(c *gin.Context, params templatedParams) bool {
+	var t templateParams
+
+	if err := c.ShouldBindBodyWith(&t, binding.JSON); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypeBind)
+		return false
+	}
+
+	if t.Template != "" {
+		template, err := context.Config().GetTemplate(t.Template)
+		if err != nil {
+			AbortWithJSONError(c, http.StatusBadRequest, err)
+			return false
+		}
+
+		params.applyTemplate(template)
+	}
+
+	if err := c.ShouldBindBodyWith(params, binding.JSON); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err).SetType(gin.ErrorTypeBind)
+		return false
+	}
+
+	return true
+}
+
+// copyBool returns copy of optional bool, so that binding doesn't modify template
+func copyBool(value *bool) *bool {
+	if value == nil {
+		return nil
+	}
+
+	result := *value
+	return &result
+}
+
+// copyStrings returns copy of list, so that binding doesn't modify template
+func copyStrings(value []string) []string {
+	return append([]string(nil), value...)
+}
+
+func (b *mirrorCreateParams) applyTemplate(template *utils.ResourceTemplate) {
+	if len(template.Architectures) > 0 {
+		b.Architectures = copyStrings(template.Architectures)
+	}
+	if template.Filter != "" {
+		b.Filter = template.Filter
+	}
+	if template.FilterWithDeps != nil {
+		b.FilterWithDeps = *template.FilterWithDeps
+	}
+	if template.WithSources != nil {
+		b.DownloadSources = *template.WithSources
+	}
+	if template.WithUdebs != nil {
+		b.DownloadUdebs = *template.WithUdebs
+	}
+	if len(template.VerifyKeyrings) > 0 {
+		b.Keyrings = copyStrings(template.VerifyKeyrings)
+	}
+}
+
+func (b *repoCreateParams) applyTemplate(template *utils.ResourceTemplate) {
+	if template.Distribution != "" {
+		b.DefaultDistribution = template.Distribution
+	}
+	if template.Component != "" {
+		b.DefaultComponent = template.Component
+	}
+	if template.VersionPolicy != "" {
+		b.VersionPolicy = template.VersionPolicy
+	}
+}
+
+func (b *publishedRepoCreateParams) applyTemplate(template *utils.ResourceTemplate) {
+	if len(template.Architectures) > 0 {
+		b.Architectures = copyStrings(template.Architectures)
+	}
+	if template.Origin != "" {
+		b.Origin = template.Origin
+	}
+	if template.Label != "" {
+		b.Label = template.Label
+	}
+	if template.SkipContents != nil {
+		b.SkipContents = copyBool(template.SkipContents)
+	}
+	if template.SkipBz2 != nil {
+		b.SkipBz2 = copyBool(template.SkipBz2)
+	}
+	if template.EnableZst != nil {
+		b.EnableZst = copyBool(template.EnableZst)
+	}
+	if template.AcquireByHash != nil {
+		b.AcquireByHash = copyBool(template.AcquireByHash)
+	}
+	if template.MultiDist != nil {
+		b.MultiDist = copyBool(template.MultiDist)
+	}
+	if template.SkipSigning != nil {
+		b.Signing.Skip = *template.SkipSigning
+	}
+	if template.GpgKey != "" {
+		b.Signing.GpgKey = template.GpgKey
+	}
+	if template.Keyring != "" {
+		b.Signing.Keyring = template.Keyring
+	}
+	if template.SecretKeyring != "" {
+		b.Signing.SecretKeyring = template.SecretKeyring
+	}
+	if template.PassphraseFile != "" {
+		b.Signing.PassphraseFile = template.PassphraseFile
+	}
+}
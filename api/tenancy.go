@@ -0,0 +1,328 @@
+package api
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type trustedRequestKey struct{}
+
+// trustedRequest marks request dispatched internally (by webhooks or pipelines) as authorized
+func trustedRequest(req *http.Request) *http.Request {
+	return req.WithContext(stdcontext.WithValue(req.Context(), trustedRequestKey{}, true))
+}
+
+// publicRoutes are available without authentication
+var publicRoutes = map[string]bool{
+	"/api/version":        true,
+	"/api/ready":          true,
+	"/api/healthy":        true,
+	"/api/metrics":        true,
+	"/api/webhooks/:name": true,
+}
+
+// tenantRoutePrefixes are API routes tenants have access to, all other routes are limited to admins
+var tenantRoutePrefixes = []string{
+	"/api/repos",
+	"/api/mirrors",
+	"/api/snapshots",
+	"/api/publish",
+	"/api/files/:dir",
+	"/api/tasks/:id",
+	"/api/tenants/:name",
+}
+
+// tenantNameParams are route parameters which hold names of resources
+var tenantNameParams = []string{"name", "src", "withSnapshot", "dir"}
+
+// tenantNameFields are fields of request body which hold names of resources
+var tenantNameFields = []string{"Name", "FromSnapshot", "SourceSnapshots", "Sources", "Source", "Destination", "Snapshots"}
+
+// tenantQuotaRoutes are routes adding packages to local repos and mirrors, checked against quota
+var tenantQuotaRoutes = map[string]bool{
+	"POST /api/repos/:name/packages":           true,
+	"POST /api/repos/:name/packages/upload":    true,
+	"POST /api/repos/:name/file/:dir/:file":    true,
+	"POST /api/repos/:name/file/:dir":          true,
+	"POST /api/repos/:name/copy/:src/:file":    true,
+	"POST /api/repos/:name/include/:dir/:file": true,
+	"POST /api/repos/:name/include/:dir":       true,
+	"PUT /api/mirrors/:name":                   true,
+}
+
+// tenantOf returns tenant request was authenticated as, or empty string for
+// admin (or if tenancy is disabled)
+func tenantOf(c *gin.Context) string {
+	return c.GetString("tenant")
+}
+
+// tenantVisible checks whether resource should be listed in response to request
+func tenantVisible(c *gin.Context, name string) bool {
+	tenant := tenantOf(c)
+	return tenant == "" || utils.InNamespace(tenant, name)
+}
+
+// tenantSigning defaults GPG key to the key of tenant owning published prefix
+func tenantSigning(prefix string, options *signingParams) *signingParams {
+	tenancy := context.Config().Tenancy
+	if !tenancy.Enabled || options.GpgKey != "" || len(options.Keys) > 0 {
+		return options
+	}
+
+	tenant, ok := tenancy.Tenants[tenancy.Namespace(prefix)]
+	if !ok || tenant.GpgKey == "" {
+		return options
+	}
+
+	result := *options
+	result.GpgKey = tenant.GpgKey
+	return &result
+}
+
+// collectNames finds names of resources in decoded request body
+func collectNames(value interface{}, isName bool, names *[]string) {
+	switch v := value.(type) {
+	case string:
+		if isName {
+			*names = append(*names, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectNames(item, isName, names)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			field := false
+			for _, f := range tenantNameFields {
+				field = field || strings.EqualFold(key, f)
+			}
+			collectNames(item, field, names)
+		}
+	}
+}
+
+// tenantBodyNames returns names of resources referenced in JSON request body, leaving
+// body intact for the handler
+//
+// Uploaded files (multipart or raw package file) are not read, so that they are streamed
+// to the handler. Any other body is rejected, as names in it can't be checked.
+func tenantBodyNames(c *gin.Context) ([]string, error) {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody || c.Request.ContentLength == 0 {
+		return nil, nil
+	}
+
+	switch contentType := c.ContentType(); {
+	case contentType == gin.MIMEJSON:
+	case contentType == "application/octet-stream" || strings.HasPrefix(contentType, "multipart/"):
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("request body of type %q is not allowed for tenant, use %s", contentType, gin.MIMEJSON)
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if json.Unmarshal(body, &decoded) != nil {
+		return nil, nil
+	}
+
+	var names []string
+	collectNames(decoded, false, &names)
+	return names, nil
+}
+
+// tenantAllowed checks that request of tenant only references resources in its namespace
+func tenantAllowed(c *gin.Context, tenant string) error {
+	route := c.FullPath()
+
+	allowed := false
+	for _, prefix := range tenantRoutePrefixes {
+		allowed = allowed || route == prefix || strings.HasPrefix(route, prefix+"/")
+	}
+	if !allowed {
+		return fmt.Errorf("access to %s is not allowed for tenant %s", route, tenant)
+	}
+
+	if route == "/api/publish" && c.Request.Method != http.MethodGet {
+		return fmt.Errorf("publishing prefix is outside of namespace %s", tenant)
+	}
+
+	if param, ok := c.Params.Get("prefix"); ok {
+		_, prefix := deb.ParsePrefix(slashEscape(param))
+		if !utils.InNamespace(tenant, prefix) {
+			return fmt.Errorf("publishing prefix %s is outside of namespace %s", prefix, tenant)
+		}
+	}
+
+	names, err := tenantBodyNames(c)
+	if err != nil {
+		return err
+	}
+
+	for _, param := range tenantNameParams {
+		if value, ok := c.Params.Get(param); ok {
+			names = append(names, value)
+		}
+	}
+
+	for _, name := range names {
+		if !utils.InNamespace(tenant, name) {
+			return fmt.Errorf("%s is outside of namespace %s", name, tenant)
+		}
+	}
+
+	return nil
+}
+
+// checkTenantQuota checks that tenant owning local repo or mirror hasn't exceeded its quota
+func checkTenantQuota(c *gin.Context, tenancy *utils.TenancyConfig) error {
+	if !tenantQuotaRoutes[c.Request.Method+" "+c.FullPath()] {
+		return nil
+	}
+
+	namespace := tenancy.Namespace(c.Params.ByName("name"))
+	quota := tenancy.Tenants[namespace].Quota
+	if namespace == "" || quota <= 0 {
+		return nil
+	}
+
+	usage, err := deb.NamespaceUsage(context.NewCollectionFactory(), namespace)
+	if err != nil {
+		return err
+	}
+
+	if usage >= quota {
+		return fmt.Errorf("quota of tenant %s exceeded: %s used of %s", namespace, utils.HumanBytes(usage), utils.HumanBytes(quota))
+	}
+
+	return nil
+}
+
+// tenancyMiddleware authenticates API requests and restricts tenants to their namespaces,
+// if tenancy is enabled
+func tenancyMiddleware(c *gin.Context) {
+	tenancy := context.Config().Tenancy
+	if !tenancy.Enabled || publicRoutes[c.FullPath()] {
+		c.Next()
+		return
+	}
+
+	// requests authenticated with API token aren't restricted to tenant namespace
+	if trusted, _ := c.Request.Context().Value(trustedRequestKey{}).(bool); !trusted && c.GetString("apiToken") == "" {
+		tenant, admin := tenancy.Authenticate(c.Request)
+		if !admin && tenant == "" {
+			c.Header("WWW-Authenticate", `Basic realm="aptly"`)
+			AbortWithJSONError(c, http.StatusUnauthorized, fmt.Errorf("authentication required"))
+			return
+		}
+
+		if tenant != "" {
+			if err := tenantAllowed(c, tenant); err != nil {
+				AbortWithJSONError(c, http.StatusForbidden, err)
+				return
+			}
+			c.Set("tenant", tenant)
+		}
+	}
+
+	if err := checkTenantQuota(c, &tenancy); err != nil {
+		AbortWithJSONError(c, http.StatusInsufficientStorage, err)
+		return
+	}
+
+	c.Next()
+}
+
+type tenantInfo struct {
+	// Name of tenant namespace
+	Name string `json:"Name"       example:"team-a"`
+	// Default GPG key to sign repositories published under tenant prefix
+	GpgKey string `json:"GpgKey"   example:"A0546A43624A8331"`
+	// Limit of total size of package files, in bytes (0 - unlimited)
+	Quota int64 `json:"Quota"      example:"10737418240"`
+	// Total size of package files in tenant local repos, mirrors and snapshots, in bytes
+	Usage int64 `json:"Usage"      example:"1073741824"`
+}
+
+func getTenantInfo(collectionFactory *deb.CollectionFactory, tenancy *utils.TenancyConfig, name string) (*tenantInfo, error) {
+	usage, err := deb.NamespaceUsage(collectionFactory, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tenantInfo{
+		Name:   name,
+		GpgKey: tenancy.Tenants[name].GpgKey,
+		Quota:  tenancy.Tenants[name].Quota,
+		Usage:  usage,
+	}, nil
+}
+
+// @Summary List Tenants
+// @Description **Get list of tenants with their storage usage**
+// @Description
+// @Description Tenants are configured in `tenancy` section of configuration file. Local repos, mirrors,
+// @Description snapshots, upload directories and published prefixes belong to namespace of tenant, if
+// @Description their names start with `<tenant>/`. Requests authenticated with token of tenant are restricted
+// @Description to its namespace, admin tokens have unrestricted access.
+// @Tags Tenants
+// @Produce json
+// @Success 200 {array} tenantInfo
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/tenants [get]
+func apiTenantsList(c *gin.Context) {
+	tenancy := context.Config().Tenancy
+	collectionFactory := context.NewCollectionFactory()
+
+	result := []*tenantInfo{}
+	for _, name := range tenancy.TenantNames() {
+		info, err := getTenantInfo(collectionFactory, &tenancy, name)
+		if err != nil {
+			AbortWithJSONError(c, http.StatusInternalServerError, err)
+			return
+		}
+		result = append(result, info)
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// @Summary Get Tenant
+// @Description **Get tenant with its storage usage**
+// @Tags Tenants
+// @Produce json
+// @Param name path string true "Tenant name"
+// @Success 200 {object} tenantInfo
+// @Failure 404 {object} Error "Tenant not found"
+// @Failure 500 {object} Error "Internal Error"
+// @Router /api/tenants/{name} [get]
+func apiTenantsShow(c *gin.Context) {
+	tenancy := context.Config().Tenancy
+	name := c.Params.ByName("name")
+
+	if _, ok := tenancy.Tenants[name]; !ok {
+		AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("tenant %s not found", name))
+		return
+	}
+
+	info, err := getTenantInfo(context.NewCollectionFactory(), &tenancy, name)
+	if err != nil {
+		AbortWithJSONError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type TenancySuite struct {
+	ApiSuite
+}
+
+var _ = Suite(&TenancySuite{})
+
+func (s *TenancySuite) enableTenancy() {
+	s.context.Config().Tenancy = utils.TenancyConfig{
+		Enabled:     true,
+		AdminTokens: []string{"root"},
+		Tenants: map[string]utils.TenantConfig{
+			"team-a": {GpgKey: "A0546A43624A8331", Tokens: []string{"a-token"}},
+			"team-b": {Tokens: []string{"b-token"}},
+		},
+	}
+}
+
+func (s *TenancySuite) disableTenancy() {
+	s.context.Config().Tenancy = utils.TenancyConfig{}
+}
+
+func (s *TenancySuite) tenantRequest(method, url, token, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *TenancySuite) TestTenancy(c *C) {
+	s.enableTenancy()
+	defer s.disableTenancy()
+
+	collectionFactory := s.context.NewCollectionFactory()
+
+	for _, name := range []string{"team-a/main", "team-b/main"} {
+		repo := deb.NewLocalRepo(name, "")
+		c.Assert(collectionFactory.LocalRepoCollection().Add(repo), IsNil)
+		defer collectionFactory.LocalRepoCollection().Drop(repo)
+	}
+
+	c.Check(s.tenantRequest("GET", "/api/version", "", "").Code, Equals, 200)
+	c.Check(s.tenantRequest("GET", "/api/repos", "", "").Code, Equals, 401)
+	c.Check(s.tenantRequest("GET", "/api/repos", "wrong", "").Code, Equals, 401)
+
+	response := s.tenantRequest("GET", "/api/repos", "a-token", "")
+	c.Assert(response.Code, Equals, 200)
+	var repos []map[string]interface{}
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &repos), IsNil)
+	c.Assert(repos, HasLen, 1)
+	c.Check(repos[0]["Name"], Equals, "team-a/main")
+
+	response = s.tenantRequest("GET", "/api/repos", "root", "")
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `.*"Name":"team-b/main".*`)
+
+	c.Check(s.tenantRequest("GET", "/api/repos/team-a%2Fmain", "a-token", "").Code, Equals, 200)
+	response = s.tenantRequest("GET", "/api/repos/team-b%2Fmain", "a-token", "")
+	c.Check(response.Code, Equals, 403)
+	c.Check(response.Body.String(), Matches, `.*team-b/main is outside of namespace team-a.*`)
+
+	c.Check(s.tenantRequest("POST", "/api/repos", "a-token", `{"Name": "team-b/stolen"}`).Code, Equals, 403)
+	response = s.tenantRequest("POST", "/api/repos", "a-token", `{"Name": "team-a/testing"}`)
+	c.Check(response.Code, Equals, 201)
+	created, err := collectionFactory.LocalRepoCollection().ByName("team-a/testing")
+	c.Assert(err, IsNil)
+	c.Assert(collectionFactory.LocalRepoCollection().Drop(created), IsNil)
+
+	c.Check(s.tenantRequest("POST", "/api/publish/team-b", "a-token", `{}`).Code, Equals, 403)
+	c.Check(s.tenantRequest("GET", "/api/config", "a-token", "").Code, Equals, 403)
+	c.Check(s.tenantRequest("GET", "/api/config", "root", "").Code, Equals, 200)
+
+	c.Check(s.tenantRequest("GET", "/api/tenants", "a-token", "").Code, Equals, 403)
+	c.Check(s.tenantRequest("GET", "/api/tenants/team-b", "a-token", "").Code, Equals, 403)
+
+	response = s.tenantRequest("GET", "/api/tenants/team-a", "a-token", "")
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Equals, `{"Name":"team-a","GpgKey":"A0546A43624A8331","Quota":0,"Usage":0}`)
+
+	response = s.tenantRequest("GET", "/api/tenants", "root", "")
+	c.Check(response.Code, Equals, 200)
+	var tenants []tenantInfo
+	c.Assert(json.Unmarshal(response.Body.Bytes(), &tenants), IsNil)
+	c.Check(tenants, HasLen, 2)
+}
+
+func (s *TenancySuite) TestTenantSigning(c *C) {
+	s.enableTenancy()
+	defer s.disableTenancy()
+
+	c.Check(tenantSigning("team-a/stable", &signingParams{}).GpgKey, Equals, "A0546A43624A8331")
+	c.Check(tenantSigning("team-a/stable", &signingParams{GpgKey: "explicit"}).GpgKey, Equals, "explicit")
+	c.Check(tenantSigning("team-b", &signingParams{}).GpgKey, Equals, "")
+	c.Check(tenantSigning("other", &signingParams{}).GpgKey, Equals, "")
+	c.Check(tenantSigning("team-a/stable", &signingParams{Keys: []signingKeyParams{{GpgKey: "rotated"}}}).GpgKey, Equals, "")
+}
+
+func (s *TenancySuite) TestTenantUpload(c *C) {
+	s.enableTenancy()
+	defer s.disableTenancy()
+
+	upload := func(url, token, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	c.Assert(s.tenantRequest("POST", "/api/repos", "a-token", `{"Name": "team-a/uploads"}`).Code, Equals, 201)
+	defer s.tenantRequest("DELETE", "/api/repos/team-a%2Fuploads?force=1", "root", "")
+
+	// names in non-JSON bodies can't be checked
+	response := upload("/api/repos", "a-token", "text/plain", `{"Name": "team-b/stolen"}`)
+	c.Check(response.Code, Equals, 403)
+	c.Check(response.Body.String(), Matches, `.*request body of type \\"text/plain\\" is not allowed.*`)
+
+	// uploads are streamed, limited by maxUploadSize
+	maxUploadSize := s.context.Config().MaxUploadSize
+	s.context.Config().MaxUploadSize = 10
+	defer func() { s.context.Config().MaxUploadSize = maxUploadSize }()
+
+	response = upload("/api/repos/team-a%2Fuploads/packages/upload?filename=app_1.0_amd64.deb", "a-token", "application/octet-stream", "not a package file")
+	c.Check(response.Code, Equals, 413)
+	c.Check(response.Body.String(), Matches, ".*upload exceeds limit of 10 B.*")
+
+	// upload is checked against quota
+	collectionFactory := s.context.NewCollectionFactory()
+	p := deb.NewPackageFromControlFile(deb.Stanza{"Package": "app", "Version": "1.0", "Architecture": "amd64",
+		"Filename": "pool/main/a/app/app_1.0_amd64.deb", "Size": "100", "MD5sum": "5c0f0c6ce8f5b3e5e3ec9f1a6ac29ac0"})
+	c.Assert(collectionFactory.PackageCollection().Update(p), IsNil)
+
+	list := deb.NewPackageList()
+	c.Assert(list.Add(p), IsNil)
+	repo, err := collectionFactory.LocalRepoCollection().ByName("team-a/uploads")
+	c.Assert(err, IsNil)
+	repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
+	c.Assert(collectionFactory.LocalRepoCollection().Update(repo), IsNil)
+
+	tenant := s.context.Config().Tenancy.Tenants["team-a"]
+	tenant.Quota = 50
+	s.context.Config().Tenancy.Tenants["team-a"] = tenant
+
+	response = upload("/api/repos/team-a%2Fuploads/packages/upload?filename=app_1.1_amd64.deb", "a-token", "application/octet-stream", "deb")
+	c.Check(response.Code, Equals, 507)
+	c.Check(response.Body.String(), Matches, ".*quota of tenant team-a exceeded.*")
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// publishPath returns API path of published repository, prefix could be
+// prefixed with storage as "storage:prefix"
+func publishPath(prefix, distribution string) string {
+	storage := ""
+	if i := strings.LastIndex(prefix, ":"); i != -1 {
+		storage, prefix = prefix[:i], prefix[i+1:]
+	}
+	if prefix == "" {
+		prefix = "."
+	}
+
+	return "/api/publish/" + url.PathEscape(storage+":"+slashEncode(prefix)) + "/" +
+		url.PathEscape(slashEncode(distribution))
+}
+
+// webhookRequest builds API request implementing webhook action
+func webhookRequest(webhook *utils.Webhook) (*http.Request, error) {
+	var path string
+
+	switch webhook.Action {
+	case utils.WebhookActionMirrorUpdate:
+		path = "/api/mirrors/" + url.PathEscape(webhook.Mirror)
+	case utils.WebhookActionPublishUpdate:
+		path = publishPath(webhook.Prefix, webhook.Distribution)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, path+"?_async=1", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// @Summary Trigger Webhook
+// @Description **Run action configured for inbound webhook**
+// @Description
+// @Description Webhooks are configured in `webhooks` section of configuration file, each webhook maps to
+// @Description action (`mirror-update` or `publish-update`). Request should either carry shared secret in
+// @Description `X-Aptly-Token` (or `X-Gitlab-Token`) header, or HMAC-SHA256 signature of the body in
+// @Description `X-Hub-Signature-256` header. Action is always run as background task.
+// @Tags Webhooks
+// @Param name path string true "Webhook name"
+// @Produce json
+// @Success 202 {object} task.Task
+// @Failure 401 {object} Error "Invalid secret or signature"
+// @Failure 404 {object} Error "Webhook not found"
+// @Failure 409 {object} Error "Conflicting task is running"
+// @Router /api/webhooks/{name} [post]
+func apiWebhook(router http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Params.ByName("name")
+
+		webhook, ok := context.Config().Webhooks[name]
+		if !ok {
+			AbortWithJSONError(c, http.StatusNotFound, fmt.Errorf("webhook %s not found", name))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1024*1024))
+		if err != nil {
+			AbortWithJSONError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if !webhook.Verify(c.Request, body) {
+			AbortWithJSONError(c, http.StatusUnauthorized, fmt.Errorf("invalid webhook secret or signature"))
+			return
+		}
+
+		if err = webhook.Validate(); err != nil {
+			AbortWithJSONError(c, http.StatusInternalServerError, fmt.Errorf("webhook %s: %s", name, err))
+			return
+		}
+
+		req, err := webhookRequest(&webhook)
+		if err != nil {
+			AbortWithJSONError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := &bufferedResponse{header: http.Header{}, code: http.StatusOK}
+		router.ServeHTTP(response, trustedRequest(req.WithContext(c.Request.Context())))
+
+		c.Data(response.code, "application/json; charset=utf-8", response.body.Bytes())
+	}
+}
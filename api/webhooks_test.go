@@ -0,0 +1,56 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ApiSuite) webhookRequest(name string, body []byte, setup func(r *http.Request)) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/webhooks/"+name, bytes.NewReader(body))
+	if setup != nil {
+		setup(req)
+	}
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *ApiSuite) TestWebhooks(c *C) {
+	s.context.Config().Webhooks = map[string]utils.Webhook{
+		"upstream": {Secret: "s3cret", Action: utils.WebhookActionMirrorUpdate, Mirror: "webhook-mirror"},
+		"ci":       {Secret: "t0ken", Action: utils.WebhookActionPublishUpdate, Prefix: "ppa/dev_1", Distribution: "stable"},
+		"broken":   {Secret: "t0ken", Action: "run-job"},
+	}
+	defer func() { s.context.Config().Webhooks = nil }()
+
+	c.Check(s.webhookRequest("missing", nil, nil).Code, Equals, 404)
+	c.Check(s.webhookRequest("upstream", nil, nil).Code, Equals, 401)
+	c.Check(s.webhookRequest("upstream", nil, func(r *http.Request) { r.Header.Set("X-Aptly-Token", "wrong") }).Code, Equals, 401)
+
+	response := s.webhookRequest("upstream", nil, func(r *http.Request) { r.Header.Set("X-Aptly-Token", "s3cret") })
+	c.Check(response.Code, Equals, 404)
+	c.Check(response.Body.String(), Matches, `.*mirror with name webhook-mirror not found.*`)
+
+	body := []byte(`{"ref": "refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("t0ken"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	c.Check(s.webhookRequest("ci", []byte(`{}`), func(r *http.Request) { r.Header.Set("X-Hub-Signature-256", signature) }).Code, Equals, 401)
+
+	response = s.webhookRequest("ci", body, func(r *http.Request) { r.Header.Set("X-Hub-Signature-256", signature) })
+	c.Check(response.Code, Equals, 404)
+	c.Check(response.Body.String(), Matches, `.*published repo with storage:prefix/distribution ppa/dev_1/stable not found.*`)
+
+	response = s.webhookRequest("broken", nil, func(r *http.Request) { r.Header.Set("X-Gitlab-Token", "t0ken") })
+	c.Check(response.Code, Equals, 500)
+	c.Check(response.Body.String(), Matches, `.*unknown webhook action .*run-job.*`)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed webui
+var webUIFiles embed.FS
+
+// webUIAuth checks access to web UI and actions performed from it
+func webUIAuth(acl func() utils.ServeACL) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if current := acl(); !current.Allowed(c.Request) {
+			c.Header("WWW-Authenticate", `Basic realm="aptly"`)
+			AbortWithJSONError(c, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// registerWebUI serves web UI under /ui/
+//
+// Web UI talks to the subset of the API mounted under /ui/api/, so that
+// both browsing and actions are subject to web UI access control.
+//
+// acl returns current access control settings, as they could be reloaded.
+func registerWebUI(router *gin.Engine, acl func() utils.ServeACL) {
+	assets, _ := fs.Sub(webUIFiles, "webui")
+	index, _ := fs.ReadFile(assets, "index.html")
+
+	ui := router.Group("/ui", webUIAuth(acl))
+	ui.GET("/", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
+	})
+	ui.StaticFS("/static", http.FS(assets))
+
+	uiAPI := ui.Group("/api")
+	if dbRequests != nil {
+		uiAPI.Use(databaseMiddleware)
+	}
+
+	uiAPI.GET("/mirrors", apiMirrorsList)
+	uiAPI.GET("/mirrors/:name", apiMirrorsShow)
+	uiAPI.PUT("/mirrors/:name", apiMirrorsUpdate)
+
+	uiAPI.GET("/snapshots", apiSnapshotsList)
+	uiAPI.GET("/snapshots/:name", apiSnapshotsShow)
+
+	uiAPI.GET("/repos", apiReposList)
+	uiAPI.GET("/repos/:name", apiReposShow)
+
+	uiAPI.GET("/publish", apiPublishList)
+	uiAPI.PUT("/publish/:prefix/:distribution", apiPublishUpdateSwitch)
+
+	uiAPI.GET("/tasks", apiTasksList)
+	uiAPI.GET("/tasks/:id", apiTasksShow)
+	uiAPI.GET("/tasks/:id/output", apiTasksOutputShow)
+}
@@ -0,0 +1,205 @@
+'use strict';
+
+// Web UI talks to the subset of aptly API mounted under ui/api/
+const API = 'api';
+
+const taskStates = ['idle', 'running', 'succeeded', 'failed'];
+
+function status(message, error) {
+  const el = document.getElementById('status');
+  el.textContent = message || '';
+  el.className = error ? 'error' : '';
+}
+
+async function request(method, path, body) {
+  const options = {method: method, headers: {'Content-Type': 'application/json'}};
+  if (body !== undefined) {
+    options.body = JSON.stringify(body);
+  }
+
+  const response = await fetch(API + path, options);
+  const data = await response.json().catch(() => null);
+  if (!response.ok) {
+    throw new Error((data && data.error) || response.statusText);
+  }
+  return data;
+}
+
+function escapeHTML(value) {
+  return String(value === undefined || value === null ? '' : value)
+    .replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;');
+}
+
+function table(columns, rows, actions) {
+  let html = '<table><tr>';
+  for (const column of columns) {
+    html += '<th>' + escapeHTML(column.title) + '</th>';
+  }
+  if (actions) {
+    html += '<th></th>';
+  }
+  html += '</tr>';
+
+  rows.forEach((row, i) => {
+    html += '<tr>';
+    for (const column of columns) {
+      html += '<td>' + escapeHTML(column.value(row)) + '</td>';
+    }
+    if (actions) {
+      html += '<td>' + actions(row, i) + '</td>';
+    }
+    html += '</tr>';
+  });
+
+  return html + '</table>';
+}
+
+// publishPath encodes storage and prefix of published repository for API URL
+function publishPath(published) {
+  const prefix = published.Prefix.replace(/_/g, '__').replace(/\//g, '_');
+  return '/publish/' + encodeURIComponent(published.Storage + ':' + prefix) + '/' +
+    encodeURIComponent(published.Distribution.replace(/_/g, '__').replace(/\//g, '_'));
+}
+
+async function runTask(method, path, body, description) {
+  status(description + '...');
+  const task = await request(method, path + '?_async=1', body);
+  status(description + ': task #' + task.ID + ' started, see Tasks');
+}
+
+const views = {
+  async mirrors(content) {
+    const mirrors = await request('GET', '/mirrors');
+    content.innerHTML = table([
+      {title: 'Name', value: m => m.Name},
+      {title: 'Archive', value: m => m.ArchiveRoot},
+      {title: 'Distribution', value: m => m.Distribution},
+      {title: 'Components', value: m => (m.Components || []).join(', ')},
+      {title: 'Architectures', value: m => (m.Architectures || []).join(', ')},
+      {title: 'Last update', value: m => m.LastDownloadDate},
+    ], mirrors, (m, i) => '<button data-action="update" data-index="' + i + '">Update</button>');
+
+    content.onclick = event => {
+      const button = event.target.closest('button[data-action="update"]');
+      if (!button) {
+        return;
+      }
+      const mirror = mirrors[button.dataset.index];
+      if (confirm('Update mirror ' + mirror.Name + '?')) {
+        runTask('PUT', '/mirrors/' + encodeURIComponent(mirror.Name), {}, 'Updating mirror ' + mirror.Name)
+          .catch(err => status(err.message, true));
+      }
+    };
+  },
+
+  async snapshots(content) {
+    const snapshots = await request('GET', '/snapshots');
+    content.innerHTML = table([
+      {title: 'Name', value: s => s.Name},
+      {title: 'Created at', value: s => s.CreatedAt},
+      {title: 'Description', value: s => s.Description},
+    ], snapshots);
+  },
+
+  async repos(content) {
+    const repos = await request('GET', '/repos');
+    content.innerHTML = table([
+      {title: 'Name', value: r => r.Name},
+      {title: 'Comment', value: r => r.Comment},
+      {title: 'Default distribution', value: r => r.DefaultDistribution},
+      {title: 'Default component', value: r => r.DefaultComponent},
+    ], repos);
+  },
+
+  async publish(content) {
+    const published = await request('GET', '/publish');
+    content.innerHTML = table([
+      {title: 'Storage', value: p => p.Storage},
+      {title: 'Prefix', value: p => p.Prefix},
+      {title: 'Distribution', value: p => p.Distribution},
+      {title: 'Kind', value: p => p.SourceKind},
+      {title: 'Sources', value: p => (p.Sources || []).map(s => s.Component + ': ' + s.Name).join(', ')},
+      {title: 'Architectures', value: p => (p.Architectures || []).join(', ')},
+    ], published, (p, i) => p.SourceKind === 'snapshot' ?
+      '<button data-action="switch" data-index="' + i + '">Switch</button>' :
+      '<button data-action="update" data-index="' + i + '">Update</button>');
+
+    content.onclick = event => {
+      const button = event.target.closest('button[data-action]');
+      if (!button) {
+        return;
+      }
+      const p = published[button.dataset.index];
+      const name = p.Storage + ':' + p.Prefix + '/' + p.Distribution;
+      let body = {};
+
+      if (button.dataset.action === 'switch') {
+        const snapshots = [];
+        for (const source of p.Sources || []) {
+          const snapshot = prompt('New snapshot for component ' + source.Component, source.Name);
+          if (snapshot === null) {
+            return;
+          }
+          snapshots.push({Component: source.Component, Name: snapshot});
+        }
+        body = {Snapshots: snapshots};
+      } else if (!confirm('Update published repository ' + name + '?')) {
+        return;
+      }
+
+      runTask('PUT', publishPath(p), body, 'Updating published repository ' + name)
+        .catch(err => status(err.message, true));
+    };
+  },
+
+  async tasks(content) {
+    const tasks = await request('GET', '/tasks');
+    tasks.sort((a, b) => b.ID - a.ID);
+    content.innerHTML = table([
+      {title: 'ID', value: t => t.ID},
+      {title: 'Name', value: t => t.Name},
+      {title: 'State', value: t => taskStates[t.State] || t.State},
+    ], tasks, (t, i) => '<button data-action="output" data-index="' + i + '">Output</button>') +
+      '<pre id="output" hidden></pre>';
+
+    content.onclick = event => {
+      const button = event.target.closest('button[data-action="output"]');
+      if (!button) {
+        return;
+      }
+      const task = tasks[button.dataset.index];
+      request('GET', '/tasks/' + task.ID + '/output').then(output => {
+        const el = document.getElementById('output');
+        el.hidden = false;
+        el.textContent = output;
+      }).catch(err => status(err.message, true));
+    };
+  },
+};
+
+async function render() {
+  const view = location.hash.replace('#', '') || 'mirrors';
+  const content = document.getElementById('content');
+
+  for (const link of document.querySelectorAll('nav a')) {
+    link.classList.toggle('active', link.getAttribute('href') === '#' + view);
+  }
+
+  content.onclick = null;
+  content.innerHTML = '';
+  status('');
+
+  if (!views[view]) {
+    status('Unknown view ' + view, true);
+    return;
+  }
+
+  try {
+    await views[view](content);
+  } catch (err) {
+    status(err.message, true);
+  }
+}
+
+window.addEventListener('hashchange', render);
+render();
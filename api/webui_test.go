@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/gin-gonic/gin"
+
+	. "gopkg.in/check.v1"
+)
+
+type WebUISuite struct {
+	router *gin.Engine
+}
+
+var _ = Suite(&WebUISuite{})
+
+func (s *WebUISuite) SetUpTest(c *C) {
+	s.router = gin.New()
+	registerWebUI(s.router, func() utils.ServeACL {
+		return utils.ServeACL{Users: map[string]string{"admin": "secret"}}
+	})
+}
+
+func (s *WebUISuite) request(path string, auth bool) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	if auth {
+		req.SetBasicAuth("admin", "secret")
+	}
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *WebUISuite) TestAccess(c *C) {
+	response := s.request("/ui/", false)
+	c.Check(response.Code, Equals, 401)
+	c.Check(response.Header().Get("WWW-Authenticate"), Equals, `Basic realm="aptly"`)
+
+	c.Check(s.request("/ui/api/mirrors", false).Code, Equals, 401)
+
+	response = s.request("/ui/", true)
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, "(?s).*static/app.js.*")
+
+	c.Check(s.request("/ui/static/app.js", true).Code, Equals, 200)
+	c.Check(s.request("/ui/static/style.css", true).Code, Equals, 200)
+}
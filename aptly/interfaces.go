@@ -93,12 +93,62 @@ type FileSystemPublishedStorage interface {
 	PublicPath() string
 }
 
+// IndexPagesPublishedStorage is published storage serving static website,
+// which needs generated index.html directory listings
+type IndexPagesPublishedStorage interface {
+	// IndexPages returns true if index.html pages should be generated
+	IndexPages() bool
+}
+
+// FlushablePublishedStorage is published storage which accumulates changes,
+// so they should be flushed when publishing operation is complete
+type FlushablePublishedStorage interface {
+	// Flush writes out pending changes
+	Flush() error
+}
+
+// HealthCheckedPublishedStorage is published storage which implements its own
+// health check, instead of writing and removing probe file
+type HealthCheckedPublishedStorage interface {
+	// HealthCheck verifies that storage is accessible and writable
+	HealthCheck() error
+}
+
+// SwappablePublishedStorage is published storage which could atomically switch
+// directory to another one (e.g. by replacing symbolic link)
+type SwappablePublishedStorage interface {
+	// SwapDir atomically replaces path with reference to directory target
+	SwapDir(target, path string) error
+}
+
+// ReadablePublishedStorage is published storage which allows to read back published files
+type ReadablePublishedStorage interface {
+	// ReadFile returns contents of file under public path
+	ReadFile(path string) ([]byte, error)
+}
+
 // PublishedStorageProvider is a thing that returns PublishedStorage by name
 type PublishedStorageProvider interface {
 	// GetPublishedStorage returns PublishedStorage by name
 	GetPublishedStorage(name string) PublishedStorage
 }
 
+// PublishNotifier is PublishedStorageProvider which should be notified when
+// distribution was published (e.g. to invalidate caches)
+type PublishNotifier interface {
+	// PublishComplete is called after distribution was successfully published to storage
+	PublishComplete(storage, prefix, distribution string, progress Progress)
+}
+
+// PublishConcurrencyProvider is PublishedStorageProvider which allows package files
+// to be uploaded to published storage and indexes to be generated concurrently
+type PublishConcurrencyProvider interface {
+	// PublishConcurrency returns number of files uploaded concurrently to published storage
+	PublishConcurrency(storage string) int
+	// PublishIndexConcurrency returns number of workers generating indexes concurrently
+	PublishIndexConcurrency() int
+}
+
 // BarType used to differentiate between different progress bars
 type BarType int
 
@@ -153,6 +203,8 @@ type Progress interface {
 	ColoredPrintf(msg string, a ...interface{})
 	// PrintfStdErr does printf but in safe manner to stderr
 	PrintfStdErr(msg string, a ...interface{})
+	// Context is cancelled when operation reporting progress should be cancelled
+	Context() context.Context
 }
 
 // Downloader is parallel HTTP fetcher
@@ -167,6 +219,12 @@ type Downloader interface {
 	GetLength(ctx context.Context, url string) (int64, error)
 }
 
+// ChecksumIndex is ChecksumStorage which could find files in package pool by their contents
+type ChecksumIndex interface {
+	// PathBySHA256 returns path to file in package pool with given SHA256 checksum, or empty string
+	PathBySHA256(sha256 string) (string, error)
+}
+
 // ChecksumStorageProvider creates ChecksumStorage based on DB
 type ChecksumStorageProvider func(db database.ReaderWriter) ChecksumStorage
 
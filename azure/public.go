@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
@@ -18,9 +19,12 @@ import (
 
 // PublishedStorage abstract file system with published files (actually hosted on Azure)
 type PublishedStorage struct {
-	prefix    string
-	az        *azContext
-	pathCache map[string]map[string]string
+	prefix string
+	az     *azContext
+
+	// pathCacheLock protects pathCache, as files might be uploaded concurrently
+	pathCacheLock sync.Mutex
+	pathCache     map[string]map[string]string
 }
 
 // Check interface
@@ -119,6 +123,7 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	prefixRelFilePath := filepath.Join(publishedPrefix, relFilePath)
 	poolPath := storage.az.blobPath(prefixRelFilePath)
 
+	storage.pathCacheLock.Lock()
 	if storage.pathCache == nil {
 		storage.pathCache = make(map[string]map[string]string)
 	}
@@ -126,6 +131,7 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	if pathCache == nil {
 		paths, md5s, err := storage.az.internalFilelist(publishedPrefix, nil)
 		if err != nil {
+			storage.pathCacheLock.Unlock()
 			return fmt.Errorf("error caching paths under prefix: %s", err)
 		}
 
@@ -138,6 +144,7 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	}
 
 	destinationMD5, exists := pathCache[relFilePath]
+	storage.pathCacheLock.Unlock()
 	sourceMD5 := sourceChecksums.MD5
 
 	if exists {
@@ -162,7 +169,9 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 
 	err = storage.az.putFile(relFilePath, source, sourceMD5)
 	if err == nil {
+		storage.pathCacheLock.Lock()
 		pathCache[relFilePath] = sourceMD5
+		storage.pathCacheLock.Unlock()
 	} else {
 		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s: %s", sourcePath, storage, poolPath))
 	}
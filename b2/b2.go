@@ -0,0 +1,2 @@
+// Package b2 handles publishing to Backblaze B2 using native API
+package b2
@@ -0,0 +1,533 @@
+package b2
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// apiURL is B2 authorization endpoint, replaced in tests
+var apiURL = "https://api.backblazeb2.com"
+
+// uploadRetries is number of attempts to upload file (or part), as B2
+// might ask to retry upload with another upload URL
+const uploadRetries = 3
+
+// apiError is error returned by B2 API
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("B2 API error %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// fileInfo is B2 file (version) description
+type fileInfo struct {
+	FileID      string            `json:"fileId"`
+	FileName    string            `json:"fileName"`
+	ContentSHA1 string            `json:"contentSha1"`
+	Action      string            `json:"action"`
+	FileInfo    map[string]string `json:"fileInfo"`
+}
+
+// sha1 returns SHA1 checksum of file contents, as large files don't have it in contentSha1
+func (f *fileInfo) sha1() string {
+	if f.ContentSHA1 != "" && f.ContentSHA1 != "none" {
+		return strings.TrimPrefix(f.ContentSHA1, "unverified:")
+	}
+	return f.FileInfo["large_file_sha1"]
+}
+
+// client is minimal client of B2 native API
+type client struct {
+	keyID          string
+	applicationKey string
+	bucketName     string
+	httpClient     *http.Client
+
+	lock      sync.Mutex
+	apiURL    string
+	authToken string
+	bucketID  string
+	partSize  int64
+}
+
+func newClient(keyID, applicationKey, bucketName string) *client {
+	return &client{
+		keyID:          keyID,
+		applicationKey: applicationKey,
+		bucketName:     bucketName,
+		httpClient:     http.DefaultClient,
+	}
+}
+
+// decodeResponse decodes JSON response or B2 error
+func decodeResponse(resp *http.Response, result interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &apiError{Status: resp.StatusCode}
+		if json.NewDecoder(resp.Body).Decode(apiErr) != nil || apiErr.Code == "" {
+			apiErr.Code = "unknown"
+			apiErr.Message = resp.Status
+		}
+		return apiErr
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// authorize obtains account authorization token, API URL and bucket ID, lock should be held
+func (c *client) authorize() error {
+	req, err := http.NewRequest(http.MethodGet, apiURL+"/b2api/v3/b2_authorize_account", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.keyID, c.applicationKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	var auth struct {
+		AccountID          string `json:"accountId"`
+		AuthorizationToken string `json:"authorizationToken"`
+		APIInfo            struct {
+			StorageAPI struct {
+				APIURL              string `json:"apiUrl"`
+				RecommendedPartSize int64  `json:"recommendedPartSize"`
+				BucketID            string `json:"bucketId"`
+				BucketName          string `json:"bucketName"`
+			} `json:"storageApi"`
+		} `json:"apiInfo"`
+	}
+	if err = decodeResponse(resp, &auth); err != nil {
+		return fmt.Errorf("unable to authorize B2 account: %s", err)
+	}
+
+	c.apiURL = auth.APIInfo.StorageAPI.APIURL
+	c.authToken = auth.AuthorizationToken
+	c.partSize = auth.APIInfo.StorageAPI.RecommendedPartSize
+
+	if c.bucketID != "" {
+		return nil
+	}
+
+	if auth.APIInfo.StorageAPI.BucketName == c.bucketName && auth.APIInfo.StorageAPI.BucketID != "" {
+		// key restricted to the bucket
+		c.bucketID = auth.APIInfo.StorageAPI.BucketID
+		return nil
+	}
+
+	var buckets struct {
+		Buckets []struct {
+			BucketID   string `json:"bucketId"`
+			BucketName string `json:"bucketName"`
+		} `json:"buckets"`
+	}
+	err = c.callLocked("b2_list_buckets", map[string]interface{}{
+		"accountId":  auth.AccountID,
+		"bucketName": c.bucketName,
+	}, &buckets)
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range buckets.Buckets {
+		if bucket.BucketName == c.bucketName {
+			c.bucketID = bucket.BucketID
+			return nil
+		}
+	}
+
+	return fmt.Errorf("B2 bucket %s not found", c.bucketName)
+}
+
+// callLocked calls API method with current authorization, lock should be held
+func (c *client) callLocked(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.apiURL+"/b2api/v3/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.authToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	return decodeResponse(resp, result)
+}
+
+// call calls API method, authorizing (or re-authorizing when token expires) as needed
+func (c *client) call(method string, params func(bucketID string) interface{}, result interface{}) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.authToken == "" {
+		if err := c.authorize(); err != nil {
+			return err
+		}
+	}
+
+	err := c.callLocked(method, params(c.bucketID), result)
+	if apiErr, ok := err.(*apiError); ok && apiErr.Status == http.StatusUnauthorized && apiErr.Code == "expired_auth_token" {
+		if err = c.authorize(); err != nil {
+			return err
+		}
+		err = c.callLocked(method, params(c.bucketID), result)
+	}
+
+	return err
+}
+
+// recommendedPartSize returns part size for large file API, authorizing as needed
+func (c *client) recommendedPartSize() (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.authToken == "" {
+		if err := c.authorize(); err != nil {
+			return 0, err
+		}
+	}
+
+	return c.partSize, nil
+}
+
+// uploadTarget is upload URL with its authorization token
+type uploadTarget struct {
+	UploadURL          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// upload sends data to upload URL, retrying with new upload URL when B2 asks to do so
+//
+// getTarget returns new upload URL, open returns data to upload, headers are
+// request headers
+func upload(httpClient *http.Client, getTarget func() (*uploadTarget, error), open func() (io.ReadCloser, error),
+	size int64, headers map[string]string, result interface{}) error {
+	var err error
+
+	for attempt := 0; attempt < uploadRetries; attempt++ {
+		var target *uploadTarget
+
+		target, err = getTarget()
+		if err != nil {
+			return err
+		}
+
+		var body io.ReadCloser
+		body, err = open()
+		if err != nil {
+			return err
+		}
+
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodPost, target.UploadURL, body)
+		if err != nil {
+			body.Close()
+			return err
+		}
+		req.ContentLength = size
+		req.Header.Set("Authorization", target.AuthorizationToken)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		var resp *http.Response
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			// network errors: retry with another upload URL
+			continue
+		}
+
+		err = decodeResponse(resp, result)
+		if apiErr, ok := err.(*apiError); ok &&
+			(apiErr.Status == http.StatusUnauthorized || apiErr.Status == http.StatusRequestTimeout ||
+				apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= 500) {
+			continue
+		}
+
+		return err
+	}
+
+	return err
+}
+
+// fileNameHeader encodes file name for X-Bz-File-Name header
+func fileNameHeader(name string) string {
+	return strings.ReplaceAll(url.PathEscape(name), "%2F", "/")
+}
+
+// uploadFile uploads small file in single request
+func (c *client) uploadFile(name string, open func() (io.ReadCloser, error), size int64, sha1sum string, info map[string]string) (*fileInfo, error) {
+	headers := map[string]string{
+		"X-Bz-File-Name":    fileNameHeader(name),
+		"Content-Type":      "b2/x-auto",
+		"X-Bz-Content-Sha1": sha1sum,
+	}
+	for key, value := range info {
+		headers["X-Bz-Info-"+key] = url.QueryEscape(value)
+	}
+
+	result := &fileInfo{}
+	err := upload(c.httpClient, func() (*uploadTarget, error) {
+		target := &uploadTarget{}
+		return target, c.call("b2_get_upload_url", func(bucketID string) interface{} {
+			return map[string]string{"bucketId": bucketID}
+		}, target)
+	}, open, size, headers, result)
+
+	return result, err
+}
+
+// uploadLargeFile uploads file using large file API, in parts of partSize
+func (c *client) uploadLargeFile(name string, open func() (io.ReadSeekCloser, error), size int64, sha1sum string, info map[string]string) (*fileInfo, error) {
+	fileInfoParams := map[string]string{"large_file_sha1": sha1sum}
+	for key, value := range info {
+		fileInfoParams[key] = value
+	}
+
+	var started fileInfo
+	err := c.call("b2_start_large_file", func(bucketID string) interface{} {
+		return map[string]interface{}{
+			"bucketId":    bucketID,
+			"fileName":    name,
+			"contentType": "b2/x-auto",
+			"fileInfo":    fileInfoParams,
+		}
+	}, &started)
+	if err != nil {
+		return nil, err
+	}
+
+	cancel := func() {
+		_ = c.call("b2_cancel_large_file", func(string) interface{} {
+			return map[string]string{"fileId": started.FileID}
+		}, nil)
+	}
+
+	c.lock.Lock()
+	partSize := c.partSize
+	c.lock.Unlock()
+
+	getTarget := func() (*uploadTarget, error) {
+		target := &uploadTarget{}
+		return target, c.call("b2_get_upload_part_url", func(string) interface{} {
+			return map[string]string{"fileId": started.FileID}
+		}, target)
+	}
+
+	partSHA1s := []string{}
+
+	for offset, part := int64(0), 1; offset < size; offset, part = offset+partSize, part+1 {
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		// checksum of the part is required upfront
+		source, err := open()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		hash := sha1.New()
+		_, err = source.Seek(offset, io.SeekStart)
+		if err == nil {
+			_, err = io.Copy(hash, io.LimitReader(source, length))
+		}
+		source.Close()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		partSHA1 := hex.EncodeToString(hash.Sum(nil))
+
+		err = upload(c.httpClient, getTarget, func() (io.ReadCloser, error) {
+			source, err := open()
+			if err != nil {
+				return nil, err
+			}
+			if _, err = source.Seek(offset, io.SeekStart); err != nil {
+				source.Close()
+				return nil, err
+			}
+			return struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(source, length), source}, nil
+		}, length, map[string]string{
+			"X-Bz-Part-Number":  fmt.Sprintf("%d", part),
+			"X-Bz-Content-Sha1": partSHA1,
+		}, nil)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		partSHA1s = append(partSHA1s, partSHA1)
+	}
+
+	result := &fileInfo{}
+	err = c.call("b2_finish_large_file", func(string) interface{} {
+		return map[string]interface{}{"fileId": started.FileID, "partSha1Array": partSHA1s}
+	}, result)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// listFiles lists latest versions of files under prefix
+func (c *client) listFiles(prefix string) ([]fileInfo, error) {
+	result := []fileInfo{}
+	startFileName := ""
+
+	for {
+		var page struct {
+			Files        []fileInfo `json:"files"`
+			NextFileName *string    `json:"nextFileName"`
+		}
+
+		err := c.call("b2_list_file_names", func(bucketID string) interface{} {
+			return map[string]interface{}{
+				"bucketId":      bucketID,
+				"prefix":        prefix,
+				"startFileName": startFileName,
+				"maxFileCount":  1000,
+			}
+		}, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range page.Files {
+			if file.Action == "upload" {
+				result = append(result, file)
+			}
+		}
+
+		if page.NextFileName == nil {
+			return result, nil
+		}
+		startFileName = *page.NextFileName
+	}
+}
+
+// getFile returns latest version of file, nil if it doesn't exist
+func (c *client) getFile(name string) (*fileInfo, error) {
+	var page struct {
+		Files []fileInfo `json:"files"`
+	}
+
+	err := c.call("b2_list_file_names", func(bucketID string) interface{} {
+		return map[string]interface{}{
+			"bucketId":      bucketID,
+			"prefix":        name,
+			"startFileName": name,
+			"maxFileCount":  1,
+		}
+	}, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(page.Files) == 0 || page.Files[0].FileName != name || page.Files[0].Action != "upload" {
+		return nil, nil
+	}
+
+	return &page.Files[0], nil
+}
+
+// deleteFiles deletes all versions of files under prefix, exact is true
+// to delete only file named prefix
+func (c *client) deleteFiles(prefix string, exact bool) error {
+	startFileName := ""
+	var startFileID *string
+
+	for {
+		var page struct {
+			Files        []fileInfo `json:"files"`
+			NextFileName *string    `json:"nextFileName"`
+			NextFileID   *string    `json:"nextFileId"`
+		}
+
+		err := c.call("b2_list_file_versions", func(bucketID string) interface{} {
+			params := map[string]interface{}{
+				"bucketId":      bucketID,
+				"prefix":        prefix,
+				"startFileName": startFileName,
+				"maxFileCount":  1000,
+			}
+			if startFileID != nil {
+				params["startFileId"] = *startFileID
+			}
+			return params
+		}, &page)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range page.Files {
+			if exact && file.FileName != prefix {
+				continue
+			}
+
+			err = c.call("b2_delete_file_version", func(string) interface{} {
+				return map[string]string{"fileName": file.FileName, "fileId": file.FileID}
+			}, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		if page.NextFileName == nil {
+			return nil
+		}
+		startFileName, startFileID = *page.NextFileName, page.NextFileID
+	}
+}
+
+// copyFile copies file server-side, replacing file info if info is not nil
+func (c *client) copyFile(source *fileInfo, name string, info map[string]string) (*fileInfo, error) {
+	result := &fileInfo{}
+
+	err := c.call("b2_copy_file", func(string) interface{} {
+		params := map[string]interface{}{
+			"sourceFileId":      source.FileID,
+			"fileName":          name,
+			"metadataDirective": "COPY",
+		}
+		if info != nil {
+			params["metadataDirective"] = "REPLACE"
+			params["contentType"] = "b2/x-auto"
+			params["fileInfo"] = info
+		}
+		return params
+	}, result)
+
+	return result, err
+}
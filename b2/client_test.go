@@ -0,0 +1,342 @@
+package b2
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+// fakeFile is file version stored in fakeB2
+type fakeFile struct {
+	fileInfo
+	data []byte
+}
+
+// fakeB2 is in-memory B2 API server
+type fakeB2 struct {
+	sync.Mutex
+	server *httptest.Server
+
+	token    string
+	partSize int64
+	// files are all file versions, oldest first
+	files []*fakeFile
+	// large files being uploaded: file ID -> parts
+	large map[string]map[int][]byte
+
+	nextID       int
+	uploads      int
+	failUploads  int
+	expireTokens bool
+}
+
+func newFakeB2() *fakeB2 {
+	b := &fakeB2{token: "t0ken", partSize: 1000, large: map[string]map[int][]byte{}}
+	b.server = httptest.NewServer(b)
+	return b
+}
+
+func sha1Hex(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (b *fakeB2) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&apiError{Status: status, Code: code, Message: code})
+}
+
+func (b *fakeB2) newID() string {
+	b.nextID++
+	return fmt.Sprintf("id%d", b.nextID)
+}
+
+// latest returns latest versions of files sorted by name
+func (b *fakeB2) latest() []*fakeFile {
+	latest := map[string]*fakeFile{}
+	for _, f := range b.files {
+		latest[f.FileName] = f
+	}
+
+	result := []*fakeFile{}
+	for _, f := range latest {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].FileName < result[j].FileName })
+
+	return result
+}
+
+// contents returns contents of the latest version of file
+func (b *fakeB2) contents(name string) []byte {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, f := range b.latest() {
+		if f.FileName == name {
+			return f.data
+		}
+	}
+	return nil
+}
+
+func (b *fakeB2) store(name string, data []byte, info map[string]string) *fakeFile {
+	f := &fakeFile{fileInfo: fileInfo{FileID: b.newID(), FileName: name, ContentSHA1: sha1Hex(data), Action: "upload", FileInfo: info}, data: data}
+	if info["large_file_sha1"] != "" {
+		f.ContentSHA1 = "none"
+	}
+	b.files = append(b.files, f)
+	return f
+}
+
+func (b *fakeB2) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b.Lock()
+	defer b.Unlock()
+
+	if req.URL.Path == "/b2api/v3/b2_authorize_account" {
+		keyID, key, _ := req.BasicAuth()
+		if keyID != "keyID" || key != "secret" {
+			b.error(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		b.token = b.newID()
+		fmt.Fprintf(w, `{"accountId": "account", "authorizationToken": %q,
+			"apiInfo": {"storageApi": {"apiUrl": %q, "recommendedPartSize": %d}}}`, b.token, b.server.URL, b.partSize)
+		return
+	}
+
+	if req.Header.Get("Authorization") != b.token || b.expireTokens {
+		b.expireTokens = false
+		b.error(w, http.StatusUnauthorized, "expired_auth_token")
+		return
+	}
+
+	if strings.HasPrefix(req.URL.Path, "/upload/") {
+		b.upload(w, req)
+		return
+	}
+
+	var params struct {
+		BucketID          string            `json:"bucketId"`
+		FileID            string            `json:"fileId"`
+		FileName          string            `json:"fileName"`
+		Prefix            string            `json:"prefix"`
+		StartFileName     string            `json:"startFileName"`
+		MaxFileCount      int               `json:"maxFileCount"`
+		SourceFileID      string            `json:"sourceFileId"`
+		MetadataDirective string            `json:"metadataDirective"`
+		FileInfo          map[string]string `json:"fileInfo"`
+		PartSHA1Array     []string          `json:"partSha1Array"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		b.error(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	switch strings.TrimPrefix(req.URL.Path, "/b2api/v3/") {
+	case "b2_list_buckets":
+		fmt.Fprintf(w, `{"buckets": [{"bucketId": "bucket1", "bucketName": "repo"}]}`)
+	case "b2_get_upload_url":
+		fmt.Fprintf(w, `{"uploadUrl": "%s/upload/file", "authorizationToken": %q}`, b.server.URL, b.token)
+	case "b2_get_upload_part_url":
+		fmt.Fprintf(w, `{"uploadUrl": "%s/upload/part/%s", "authorizationToken": %q}`, b.server.URL, params.FileID, b.token)
+	case "b2_start_large_file":
+		id := b.newID()
+		b.large[id] = map[int][]byte{}
+		json.NewEncoder(w).Encode(&fileInfo{FileID: id, FileName: params.FileName, FileInfo: params.FileInfo})
+		// remember requested name and info in the first "part"
+		encoded, _ := json.Marshal(params)
+		b.large[id][0] = encoded
+	case "b2_finish_large_file":
+		parts, ok := b.large[params.FileID]
+		if !ok {
+			b.error(w, http.StatusBadRequest, "bad_request")
+			return
+		}
+		var started struct {
+			FileName string            `json:"fileName"`
+			FileInfo map[string]string `json:"fileInfo"`
+		}
+		json.Unmarshal(parts[0], &started)
+		data := []byte{}
+		for i, partSHA1 := range params.PartSHA1Array {
+			if sha1Hex(parts[i+1]) != partSHA1 {
+				b.error(w, http.StatusBadRequest, "bad_request")
+				return
+			}
+			data = append(data, parts[i+1]...)
+		}
+		delete(b.large, params.FileID)
+		f := b.store(started.FileName, data, started.FileInfo)
+		json.NewEncoder(w).Encode(&f.fileInfo)
+	case "b2_cancel_large_file":
+		delete(b.large, params.FileID)
+		fmt.Fprintf(w, `{}`)
+	case "b2_list_file_names", "b2_list_file_versions":
+		files := b.latest()
+		if strings.HasSuffix(req.URL.Path, "versions") {
+			files = b.files
+		}
+		result := []fileInfo{}
+		for _, f := range files {
+			if strings.HasPrefix(f.FileName, params.Prefix) && f.FileName >= params.StartFileName {
+				result = append(result, f.fileInfo)
+			}
+		}
+		sort.SliceStable(result, func(i, j int) bool { return result[i].FileName < result[j].FileName })
+		if params.MaxFileCount > 0 && len(result) > params.MaxFileCount {
+			result = result[:params.MaxFileCount]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": result})
+	case "b2_delete_file_version":
+		for i, f := range b.files {
+			if f.FileID == params.FileID && f.FileName == params.FileName {
+				b.files = append(b.files[:i], b.files[i+1:]...)
+				fmt.Fprintf(w, `{}`)
+				return
+			}
+		}
+		b.error(w, http.StatusBadRequest, "file_not_present")
+	case "b2_copy_file":
+		for _, f := range b.files {
+			if f.FileID == params.SourceFileID {
+				info := f.FileInfo
+				if params.MetadataDirective == "REPLACE" {
+					info = params.FileInfo
+				}
+				copied := b.store(params.FileName, f.data, info)
+				json.NewEncoder(w).Encode(&copied.fileInfo)
+				return
+			}
+		}
+		b.error(w, http.StatusBadRequest, "bad_request")
+	default:
+		b.error(w, http.StatusBadRequest, "bad_request")
+	}
+}
+
+func (b *fakeB2) upload(w http.ResponseWriter, req *http.Request) {
+	if b.failUploads > 0 {
+		b.failUploads--
+		b.error(w, http.StatusServiceUnavailable, "service_unavailable")
+		return
+	}
+
+	data, _ := io.ReadAll(req.Body)
+	if sha1Hex(data) != req.Header.Get("X-Bz-Content-Sha1") {
+		b.error(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+	b.uploads++
+
+	if fileID := strings.TrimPrefix(req.URL.Path, "/upload/part/"); fileID != req.URL.Path {
+		var part int
+		fmt.Sscanf(req.Header.Get("X-Bz-Part-Number"), "%d", &part)
+		b.large[fileID][part] = data
+		fmt.Fprintf(w, `{}`)
+		return
+	}
+
+	name, _ := url.PathUnescape(req.Header.Get("X-Bz-File-Name"))
+	info := map[string]string{}
+	for header := range req.Header {
+		if strings.HasPrefix(header, "X-Bz-Info-") {
+			info[strings.ToLower(strings.TrimPrefix(header, "X-Bz-Info-"))], _ = url.QueryUnescape(req.Header.Get(header))
+		}
+	}
+
+	f := b.store(name, data, info)
+	json.NewEncoder(w).Encode(&f.fileInfo)
+}
+
+type ClientSuite struct {
+	fake   *fakeB2
+	client *client
+}
+
+var _ = Suite(&ClientSuite{})
+
+func (s *ClientSuite) SetUpTest(c *C) {
+	s.fake = newFakeB2()
+	apiURL = s.fake.server.URL
+	s.client = newClient("keyID", "secret", "repo")
+}
+
+func (s *ClientSuite) TearDownTest(c *C) {
+	s.fake.server.Close()
+}
+
+func (s *ClientSuite) uploadFile(name, contents string, sha1sum string) (*fileInfo, error) {
+	return s.client.uploadFile(name, func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(contents)), nil
+	}, int64(len(contents)), sha1sum, nil)
+}
+
+func (s *ClientSuite) TestAuthorize(c *C) {
+	_, err := s.client.listFiles("")
+	c.Check(err, IsNil)
+	c.Check(s.client.bucketID, Equals, "bucket1")
+	c.Check(s.client.partSize, Equals, int64(1000))
+
+	s.client = newClient("keyID", "wrong", "repo")
+	_, err = s.client.listFiles("")
+	c.Check(err, ErrorMatches, "unable to authorize B2 account: B2 API error 401 unauthorized: unauthorized")
+
+	s.client = newClient("keyID", "secret", "missing")
+	_, err = s.client.listFiles("")
+	c.Check(err, ErrorMatches, "B2 bucket missing not found")
+}
+
+func (s *ClientSuite) TestExpiredToken(c *C) {
+	_, err := s.client.listFiles("")
+	c.Assert(err, IsNil)
+	token := s.client.authToken
+
+	s.fake.expireTokens = true
+	_, err = s.client.listFiles("")
+	c.Check(err, IsNil)
+	c.Check(s.client.authToken, Not(Equals), token)
+}
+
+func (s *ClientSuite) TestUploadFile(c *C) {
+	file, err := s.uploadFile("dists/stable/Release", "release", sha1Hex([]byte("release")))
+	c.Check(err, IsNil)
+	c.Check(file.FileName, Equals, "dists/stable/Release")
+	c.Check(file.sha1(), Equals, sha1Hex([]byte("release")))
+
+	// checksum mismatch
+	_, err = s.uploadFile("dists/stable/Release", "release", sha1Hex([]byte("other")))
+	c.Check(err, ErrorMatches, "B2 API error 400 bad_request: bad_request")
+
+	// transient failures are retried
+	s.fake.failUploads = 2
+	_, err = s.uploadFile("dists/stable/InRelease", "inrelease", sha1Hex([]byte("inrelease")))
+	c.Check(err, IsNil)
+
+	s.fake.failUploads = uploadRetries
+	_, err = s.uploadFile("dists/stable/InRelease", "inrelease", sha1Hex([]byte("inrelease")))
+	c.Check(err, ErrorMatches, "B2 API error 503 service_unavailable: .*")
+}
+
+func (s *ClientSuite) TestDeleteFiles(c *C) {
+	_, _ = s.uploadFile("dists/stable/Release", "release", sha1Hex([]byte("release")))
+	_, _ = s.uploadFile("dists/stable/Release", "release2", sha1Hex([]byte("release2")))
+	_, _ = s.uploadFile("dists/stable/Release.gpg", "signature", sha1Hex([]byte("signature")))
+
+	c.Check(s.client.deleteFiles("dists/stable/Release", true), IsNil)
+	c.Check(s.fake.files, HasLen, 1)
+	c.Check(s.fake.files[0].FileName, Equals, "dists/stable/Release.gpg")
+
+	c.Check(s.client.deleteFiles("dists/", false), IsNil)
+	c.Check(s.fake.files, HasLen, 0)
+}
@@ -0,0 +1,289 @@
+package b2
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/pkg/errors"
+)
+
+// PublishedStorage abstract file system with published files (actually hosted on Backblaze B2)
+type PublishedStorage struct {
+	client *client
+	bucket string
+	prefix string
+
+	// pathCacheLock protects pathCache, as files might be uploaded concurrently
+	pathCacheLock sync.Mutex
+	// path -> SHA1 for published pool files
+	pathCache map[string]string
+}
+
+// Check interface
+var (
+	_ aptly.PublishedStorage = (*PublishedStorage)(nil)
+)
+
+// NewPublishedStorage creates published storage from B2 application key
+func NewPublishedStorage(keyID, applicationKey, bucket, prefix string) (*PublishedStorage, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("B2 bucket not specified")
+	}
+
+	return &PublishedStorage{
+		client: newClient(keyID, applicationKey, bucket),
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+// String
+func (storage *PublishedStorage) String() string {
+	return fmt.Sprintf("B2: %s/%s", storage.bucket, storage.prefix)
+}
+
+// fileName returns B2 file name for path
+func (storage *PublishedStorage) fileName(path string) string {
+	return filepath.ToSlash(filepath.Join(storage.prefix, path))
+}
+
+// MkDir creates directory recursively under public path
+func (storage *PublishedStorage) MkDir(_ string) error {
+	// no op for B2
+	return nil
+}
+
+// PutFile puts file into published storage at specified path
+func (storage *PublishedStorage) PutFile(path string, sourceFilename string) error {
+	checksums, err := utils.ChecksumsForFile(sourceFilename)
+	if err != nil {
+		return err
+	}
+
+	err = storage.putFile(path, func() (io.ReadSeekCloser, error) {
+		return os.Open(sourceFilename)
+	}, checksums.Size, checksums.SHA1)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s", sourceFilename, storage))
+	}
+
+	return err
+}
+
+// putFile uploads file, B2 verifies uploaded content against SHA1 checksum
+//
+// Files bigger than recommended part size are uploaded with large file API
+func (storage *PublishedStorage) putFile(path string, open func() (io.ReadSeekCloser, error), size int64, sha1sum string) error {
+	partSize, err := storage.client.recommendedPartSize()
+	if err != nil {
+		return err
+	}
+
+	if partSize > 0 && size > partSize {
+		_, err = storage.client.uploadLargeFile(storage.fileName(path), open, size, sha1sum, nil)
+	} else {
+		_, err = storage.client.uploadFile(storage.fileName(path), func() (io.ReadCloser, error) {
+			return open()
+		}, size, sha1sum, nil)
+	}
+
+	return err
+}
+
+// Remove removes single file under public path
+func (storage *PublishedStorage) Remove(path string) error {
+	err := storage.client.deleteFiles(storage.fileName(path), true)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error deleting %s from %s", path, storage))
+	}
+
+	storage.pathCacheLock.Lock()
+	delete(storage.pathCache, path)
+	storage.pathCacheLock.Unlock()
+
+	return nil
+}
+
+// RemoveDirs removes directory structure under public path
+func (storage *PublishedStorage) RemoveDirs(path string, _ aptly.Progress) error {
+	err := storage.client.deleteFiles(storage.fileName(path)+"/", false)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error deleting %s from %s", path, storage))
+	}
+
+	storage.pathCacheLock.Lock()
+	for cachedPath := range storage.pathCache {
+		if strings.HasPrefix(cachedPath, path+"/") {
+			delete(storage.pathCache, cachedPath)
+		}
+	}
+	storage.pathCacheLock.Unlock()
+
+	return nil
+}
+
+// LinkFromPool links package file from pool to dist's pool location
+//
+// publishedPrefix is desired prefix for the location in the pool.
+// publishedRelPath is desired location in pool (like pool/component/liba/libav/)
+// sourcePool is instance of aptly.PackagePool
+// sourcePath is filepath to package file in package pool
+//
+// LinkFromPool returns relative path for the published file to be included in package index
+func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+
+	relPath := filepath.Join(publishedPrefix, publishedRelPath, fileName)
+	poolPath := storage.fileName(relPath)
+
+	storage.pathCacheLock.Lock()
+	if storage.pathCache == nil {
+		files, err := storage.client.listFiles(storage.fileName(filepath.Join(publishedPrefix, "pool")) + "/")
+		if err != nil {
+			storage.pathCacheLock.Unlock()
+			return errors.Wrap(err, "error caching paths under prefix")
+		}
+
+		storage.pathCache = make(map[string]string, len(files))
+		for i := range files {
+			storage.pathCache[strings.TrimPrefix(files[i].FileName, storage.fileName("")+"/")] = files[i].sha1()
+		}
+	}
+	destinationSHA1, exists := storage.pathCache[relPath]
+	storage.pathCacheLock.Unlock()
+
+	sourceSHA1, size := sourceChecksums.SHA1, sourceChecksums.Size
+	if sourceSHA1 == "" || size == 0 {
+		source, err := sourcePool.Open(sourcePath)
+		if err != nil {
+			return err
+		}
+
+		hash := sha1.New()
+		size, err = io.Copy(hash, source)
+		source.Close()
+		if err != nil {
+			return err
+		}
+		sourceSHA1 = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	if exists {
+		if destinationSHA1 == sourceSHA1 {
+			return nil
+		}
+
+		if !force {
+			return fmt.Errorf("error putting file to %s: file already exists and is different: %s", poolPath, storage)
+		}
+	}
+
+	err := storage.putFile(relPath, func() (io.ReadSeekCloser, error) {
+		return sourcePool.Open(sourcePath)
+	}, size, sourceSHA1)
+	if err == nil {
+		storage.pathCacheLock.Lock()
+		storage.pathCache[relPath] = sourceSHA1
+		storage.pathCacheLock.Unlock()
+	} else {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s: %s", sourcePath, storage, poolPath))
+	}
+
+	return err
+}
+
+// Filelist returns list of files under prefix
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	listPrefix := storage.fileName(prefix)
+	if listPrefix != "" && listPrefix != "." {
+		listPrefix += "/"
+	} else {
+		listPrefix = ""
+	}
+
+	files, err := storage.client.listFiles(listPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("error listing under prefix %s in %s: %s", prefix, storage, err)
+	}
+
+	result := make([]string, len(files))
+	for i := range files {
+		result[i] = files[i].FileName[len(listPrefix):]
+	}
+
+	return result, nil
+}
+
+// copyFile copies file server-side, optionally replacing file info
+func (storage *PublishedStorage) copyFile(src, dst string, info map[string]string) error {
+	source, err := storage.client.getFile(storage.fileName(src))
+	if err != nil {
+		return err
+	}
+	if source == nil {
+		return fmt.Errorf("%s not found", src)
+	}
+
+	if info != nil && source.FileInfo["large_file_sha1"] != "" {
+		info["large_file_sha1"] = source.FileInfo["large_file_sha1"]
+	}
+
+	_, err = storage.client.copyFile(source, storage.fileName(dst), info)
+	return err
+}
+
+// RenameFile renames (moves) file
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	err := storage.copyFile(oldName, newName, nil)
+	if err != nil {
+		return fmt.Errorf("error copying %s -> %s in %s: %s", oldName, newName, storage, err)
+	}
+
+	return storage.Remove(oldName)
+}
+
+// SymLink creates a copy of src file and adds link information as file info
+func (storage *PublishedStorage) SymLink(src string, dst string) error {
+	err := storage.copyFile(src, dst, map[string]string{"symlink": src})
+	if err != nil {
+		return fmt.Errorf("error symlinking %s -> %s in %s: %s", src, dst, storage, err)
+	}
+
+	return nil
+}
+
+// HardLink using symlink functionality as hard links do not exist
+func (storage *PublishedStorage) HardLink(src string, dst string) error {
+	return storage.SymLink(src, dst)
+}
+
+// FileExists returns true if path exists
+func (storage *PublishedStorage) FileExists(path string) (bool, error) {
+	file, err := storage.client.getFile(storage.fileName(path))
+	if err != nil {
+		return false, err
+	}
+
+	return file != nil, nil
+}
+
+// ReadLink returns the symbolic link pointed to by path
+func (storage *PublishedStorage) ReadLink(path string) (string, error) {
+	file, err := storage.client.getFile(storage.fileName(path))
+	if err != nil {
+		return "", err
+	}
+	if file == nil {
+		return "", fmt.Errorf("error reading symlink %s in %s: not found", path, storage)
+	}
+
+	return file.FileInfo["symlink"], nil
+}
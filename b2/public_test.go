@@ -0,0 +1,191 @@
+package b2
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+type PublishedStorageSuite struct {
+	fake                     *fakeB2
+	storage, prefixedStorage *PublishedStorage
+}
+
+var _ = Suite(&PublishedStorageSuite{})
+
+func (s *PublishedStorageSuite) SetUpTest(c *C) {
+	var err error
+
+	s.fake = newFakeB2()
+	apiURL = s.fake.server.URL
+
+	s.storage, err = NewPublishedStorage("keyID", "secret", "repo", "")
+	c.Assert(err, IsNil)
+	s.prefixedStorage, err = NewPublishedStorage("keyID", "secret", "repo", "lala")
+	c.Assert(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TearDownTest(c *C) {
+	s.fake.server.Close()
+}
+
+func (s *PublishedStorageSuite) putFile(c *C, storage *PublishedStorage, path, contents string) {
+	tmp := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(tmp, []byte(contents), 0644), IsNil)
+	c.Assert(storage.PutFile(path, tmp), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestNewPublishedStorage(c *C) {
+	_, err := NewPublishedStorage("keyID", "secret", "", "")
+	c.Check(err, ErrorMatches, "B2 bucket not specified")
+
+	c.Check(s.prefixedStorage.String(), Equals, "B2: repo/lala")
+}
+
+func (s *PublishedStorageSuite) TestPutFile(c *C) {
+	s.putFile(c, s.storage, "a/b.txt", "welcome to b2!")
+	c.Check(s.fake.contents("a/b.txt"), DeepEquals, []byte("welcome to b2!"))
+
+	s.putFile(c, s.prefixedStorage, "a/b.txt", "welcome to b2!")
+	c.Check(s.fake.contents("lala/a/b.txt"), DeepEquals, []byte("welcome to b2!"))
+}
+
+func (s *PublishedStorageSuite) TestPutLargeFile(c *C) {
+	contents := strings.Repeat("0123456789", 250)
+	s.putFile(c, s.storage, "pool/main/a/a.deb", contents)
+
+	c.Check(s.fake.uploads, Equals, 3)
+	c.Check(s.fake.contents("pool/main/a/a.deb"), DeepEquals, []byte(contents))
+	c.Check(s.fake.files[0].sha1(), Equals, sha1Hex([]byte(contents)))
+
+	// failed upload is cancelled
+	s.fake.failUploads = uploadRetries
+	tmp := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(tmp, []byte(contents), 0644), IsNil)
+	c.Check(s.storage.PutFile("pool/main/b/b.deb", tmp), ErrorMatches, "error uploading .* to B2: repo/: B2 API error 503 .*")
+	c.Check(s.fake.large, HasLen, 0)
+}
+
+func (s *PublishedStorageSuite) TestFilelist(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.putFile(c, s.storage, path, "test")
+	}
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "test/a", "test/b", "testa"})
+
+	list, err = s.storage.Filelist("test")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b"})
+
+	list, err = s.prefixedStorage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *PublishedStorageSuite) TestRemove(c *C) {
+	s.putFile(c, s.storage, "a/b", "test")
+	s.putFile(c, s.storage, "a/b", "test2")
+
+	c.Check(s.storage.Remove("a/b"), IsNil)
+	c.Check(s.fake.files, HasLen, 0)
+
+	c.Check(s.storage.Remove("a/missing"), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestRemoveDirs(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.putFile(c, s.storage, path, "test")
+	}
+
+	c.Check(s.storage.RemoveDirs("test", nil), IsNil)
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "testa"})
+}
+
+func (s *PublishedStorageSuite) TestRenameFile(c *C) {
+	s.putFile(c, s.storage, "dists/stable/Release.tmp", "release")
+
+	c.Check(s.storage.RenameFile("dists/stable/Release.tmp", "dists/stable/Release"), IsNil)
+
+	list, _ := s.storage.Filelist("")
+	c.Check(list, DeepEquals, []string{"dists/stable/Release"})
+	c.Check(s.fake.contents("dists/stable/Release"), DeepEquals, []byte("release"))
+
+	c.Check(s.storage.RenameFile("dists/stable/Missing", "dists/stable/Release"), ErrorMatches, "error copying .*: dists/stable/Missing not found")
+}
+
+func (s *PublishedStorageSuite) TestSymLink(c *C) {
+	s.putFile(c, s.storage, "a/b", "test")
+
+	c.Check(s.storage.SymLink("a/b", "a/b.link"), IsNil)
+
+	link, err := s.storage.ReadLink("a/b.link")
+	c.Check(err, IsNil)
+	c.Check(link, Equals, "a/b")
+	c.Check(s.fake.contents("a/b.link"), DeepEquals, []byte("test"))
+
+	exists, err := s.storage.FileExists("a/b.link")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+
+	exists, err = s.storage.FileExists("a/b.lin")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile1 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err := os.WriteFile(tmpFile1, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum1 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	tmpFile2 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err = os.WriteFile(tmpFile2, []byte("Spam"), 0644)
+	c.Assert(err, IsNil)
+	cksum2 := utils.ChecksumInfo{MD5: "e9dfd31cc505d51fc26975250750deab"}
+
+	src1, err := pool.Import(tmpFile1, "mars-invaders_1.03.deb", &cksum1, true, cs)
+	c.Assert(err, IsNil)
+	src2, err := pool.Import(tmpFile2, "mars-invaders_1.03.deb", &cksum2, true, cs)
+	c.Assert(err, IsNil)
+
+	// first link from pool
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+	c.Check(s.fake.contents("pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+
+	// duplicate link from pool
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+	c.Check(s.fake.uploads, Equals, 1)
+
+	// link from pool with conflict
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, false)
+	c.Check(err, ErrorMatches, ".*file already exists and is different.*")
+
+	// link from pool with conflict and force
+	err = s.storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, true)
+	c.Check(err, IsNil)
+	c.Check(s.fake.contents("pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Spam"))
+
+	// existing files are picked up by new storage
+	storage, _ := NewPublishedStorage("keyID", "secret", "repo", "")
+	err = storage.LinkFromPool("", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, false)
+	c.Check(err, IsNil)
+	c.Check(s.fake.uploads, Equals, 2)
+}
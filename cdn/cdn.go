@@ -0,0 +1,62 @@
+// Package cdn implements CDN cache invalidation after publishing
+package cdn
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// Invalidation types
+const (
+	TypeCloudFront = "cloudfront"
+	TypeFastly     = "fastly"
+	TypeHTTP       = "http"
+)
+
+// httpClient is used for all the CDN API requests
+var httpClient = http.DefaultClient
+
+// Invalidate invalidates CDN caches for published files
+//
+// dir is the directory (relative to published storage root) which changed, files is
+// the list of files in it (relative to published storage root). CDNs supporting
+// wildcards invalidate whole dir, other invalidate each file.
+func Invalidate(config *utils.CDNInvalidation, dir string, files []string) error {
+	pathPrefix := "/" + strings.Trim(config.PathPrefix, "/")
+
+	dir = path.Join(pathPrefix, dir)
+
+	paths := make([]string, len(files))
+	for i := range files {
+		paths[i] = path.Join(pathPrefix, files[i])
+	}
+
+	switch config.Type {
+	case TypeCloudFront:
+		return invalidateCloudFront(config, []string{dir + "/*"})
+	case TypeFastly:
+		return purgeFastly(config, paths)
+	case TypeHTTP:
+		return purgeHTTP(config, dir, paths)
+	}
+
+	return fmt.Errorf("unknown CDN invalidation type: %q", config.Type)
+}
+
+// checkResponse returns error for unsuccessful response
+func checkResponse(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: unexpected response %s", resp.Request.Method, resp.Request.URL, resp.Status)
+	}
+
+	return nil
+}
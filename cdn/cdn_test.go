@@ -0,0 +1,115 @@
+package cdn
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+// Launch gocheck tests
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type request struct {
+	method, path, body string
+	header             http.Header
+}
+
+type CDNSuite struct {
+	server   *httptest.Server
+	requests []request
+	status   int
+}
+
+var _ = Suite(&CDNSuite{})
+
+func (s *CDNSuite) SetUpTest(c *C) {
+	s.requests = nil
+	s.status = http.StatusCreated
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.requests = append(s.requests, request{method: r.Method, path: r.URL.Path, body: string(body), header: r.Header})
+		w.WriteHeader(s.status)
+	}))
+
+	cloudFrontURL = s.server.URL
+	fastlyURL = s.server.URL
+}
+
+func (s *CDNSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+var files = []string{"dists/stable/Release", "dists/stable/InRelease"}
+
+func (s *CDNSuite) TestCloudFront(c *C) {
+	err := Invalidate(&utils.CDNInvalidation{Type: TypeCloudFront, DistributionID: "E2EXAMPLE",
+		AccessKeyID: "AKID", SecretAccessKey: "secret", PathPrefix: "apt"}, "dists/stable", files)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.requests, HasLen, 1)
+	c.Check(s.requests[0].method, Equals, http.MethodPost)
+	c.Check(s.requests[0].path, Equals, "/2020-05-31/distribution/E2EXAMPLE/invalidation")
+	c.Check(s.requests[0].body, Matches, `<InvalidationBatch xmlns="http://cloudfront.amazonaws.com/doc/2020-05-31/"><Paths><Quantity>1</Quantity><Items><Path>/apt/dists/stable/\*</Path></Items></Paths><CallerReference>aptly-\d+</CallerReference></InvalidationBatch>`)
+	c.Check(s.requests[0].header.Get("Authorization"), Matches, "AWS4-HMAC-SHA256 Credential=AKID/\\d+/us-east-1/cloudfront/aws4_request, .*")
+
+	err = Invalidate(&utils.CDNInvalidation{Type: TypeCloudFront}, "dists/stable", files)
+	c.Check(err, ErrorMatches, "CloudFront distribution ID not specified")
+}
+
+func (s *CDNSuite) TestFastly(c *C) {
+	s.status = http.StatusOK
+
+	err := Invalidate(&utils.CDNInvalidation{Type: TypeFastly, APIToken: "t0ken", BaseURL: "https://apt.example.com/"}, "dists/stable", files)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.requests, HasLen, 2)
+	c.Check(s.requests[0].path, Equals, "/purge/apt.example.com/dists/stable/Release")
+	c.Check(s.requests[0].header.Get("Fastly-Key"), Equals, "t0ken")
+	c.Check(s.requests[1].path, Equals, "/purge/apt.example.com/dists/stable/InRelease")
+
+	err = Invalidate(&utils.CDNInvalidation{Type: TypeFastly}, "dists/stable", files)
+	c.Check(err, ErrorMatches, "base URL not specified")
+}
+
+func (s *CDNSuite) TestHTTP(c *C) {
+	s.status = http.StatusOK
+
+	err := Invalidate(&utils.CDNInvalidation{Type: TypeHTTP, URL: s.server.URL + "/purge",
+		Headers: map[string]string{"Authorization": "Bearer t0ken"}}, "dists/stable", files)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.requests, HasLen, 1)
+	c.Check(s.requests[0].method, Equals, http.MethodPost)
+	c.Check(s.requests[0].path, Equals, "/purge")
+	c.Check(s.requests[0].header.Get("Authorization"), Equals, "Bearer t0ken")
+	c.Check(s.requests[0].body, Equals, `{"dir":"/dists/stable","paths":["/dists/stable/Release","/dists/stable/InRelease"]}`)
+
+	s.requests = nil
+	err = Invalidate(&utils.CDNInvalidation{Type: TypeHTTP, URL: s.server.URL + "/{path}", PathPrefix: "/apt/"}, "dists/stable", files)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.requests, HasLen, 2)
+	c.Check(s.requests[0].method, Equals, "PURGE")
+	c.Check(s.requests[0].path, Equals, "/apt/dists/stable/Release")
+	c.Check(s.requests[1].path, Equals, "/apt/dists/stable/InRelease")
+}
+
+func (s *CDNSuite) TestErrors(c *C) {
+	s.status = http.StatusForbidden
+
+	err := Invalidate(&utils.CDNInvalidation{Type: TypeHTTP, URL: s.server.URL + "/purge"}, "dists/stable", files)
+	c.Check(err, ErrorMatches, "POST .*/purge: unexpected response 403 Forbidden")
+
+	err = Invalidate(&utils.CDNInvalidation{Type: TypeHTTP}, "dists/stable", files)
+	c.Check(err, ErrorMatches, "purge URL not specified")
+
+	err = Invalidate(&utils.CDNInvalidation{Type: "akamai"}, "dists/stable", files)
+	c.Check(err, ErrorMatches, `unknown CDN invalidation type: "akamai"`)
+}
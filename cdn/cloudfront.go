@@ -0,0 +1,83 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// cloudFrontURL is CloudFront API endpoint
+var cloudFrontURL = "https://cloudfront.amazonaws.com"
+
+type cloudFrontInvalidationBatch struct {
+	XMLName         xml.Name `xml:"http://cloudfront.amazonaws.com/doc/2020-05-31/ InvalidationBatch"`
+	Quantity        int      `xml:"Paths>Quantity"`
+	Items           []string `xml:"Paths>Items>Path"`
+	CallerReference string   `xml:"CallerReference"`
+}
+
+// cloudFrontCredentials returns AWS credentials, either configured or default ones
+func cloudFrontCredentials(ctx context.Context, cfg *utils.CDNInvalidation) (aws.Credentials, error) {
+	opts := []func(*config.LoadOptions) error{}
+	if cfg.AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.SessionToken)))
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	return awsConfig.Credentials.Retrieve(ctx)
+}
+
+// invalidateCloudFront creates CloudFront invalidation for paths
+func invalidateCloudFront(cfg *utils.CDNInvalidation, paths []string) error {
+	if cfg.DistributionID == "" {
+		return fmt.Errorf("CloudFront distribution ID not specified")
+	}
+
+	body, err := xml.Marshal(&cloudFrontInvalidationBatch{
+		Quantity:        len(paths),
+		Items:           paths,
+		CallerReference: fmt.Sprintf("aptly-%d", time.Now().UnixNano()),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	creds, err := cloudFrontCredentials(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("error loading AWS credentials: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/2020-05-31/distribution/%s/invalidation", cloudFrontURL, cfg.DistributionID), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+
+	payloadHash := sha256.Sum256(body)
+	err = v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "cloudfront", "us-east-1", time.Now())
+	if err != nil {
+		return err
+	}
+
+	return checkResponse(httpClient.Do(req))
+}
@@ -0,0 +1,40 @@
+package cdn
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// fastlyURL is Fastly API endpoint
+var fastlyURL = "https://api.fastly.com"
+
+// purgeFastly purges each of paths (under baseURL) from Fastly cache
+func purgeFastly(cfg *utils.CDNInvalidation, paths []string) error {
+	if cfg.BaseURL == "" {
+		return fmt.Errorf("base URL not specified")
+	}
+
+	// Fastly expects cached URL without scheme
+	base := strings.TrimRight(cfg.BaseURL, "/")
+	if i := strings.Index(base, "://"); i != -1 {
+		base = base[i+3:]
+	}
+
+	for _, p := range paths {
+		req, err := http.NewRequest(http.MethodPost, fastlyURL+"/purge/"+base+p, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Fastly-Key", cfg.APIToken)
+		req.Header.Set("Accept", "application/json")
+
+		if err = checkResponse(httpClient.Do(req)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
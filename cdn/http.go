@@ -0,0 +1,67 @@
+package cdn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// purgeHTTP calls generic purge API
+//
+// If URL contains {path} placeholder, request is sent for each path (e.g. PURGE
+// requests to Varnish or nginx), otherwise single request with JSON body listing
+// paths is sent
+func purgeHTTP(cfg *utils.CDNInvalidation, dir string, paths []string) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("purge URL not specified")
+	}
+
+	send := func(method, url string, body []byte) error {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for name, value := range cfg.Headers {
+			req.Header.Set(name, value)
+		}
+
+		return checkResponse(httpClient.Do(req))
+	}
+
+	if strings.Contains(cfg.URL, "{path}") {
+		method := cfg.Method
+		if method == "" {
+			method = "PURGE"
+		}
+
+		for _, p := range paths {
+			if err := send(method, strings.ReplaceAll(cfg.URL, "{path}", strings.TrimPrefix(p, "/")), nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	method := cfg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	body, err := json.Marshal(struct {
+		Dir   string   `json:"dir"`
+		Paths []string `json:"paths"`
+	}{Dir: dir, Paths: paths})
+	if err != nil {
+		return err
+	}
+
+	return send(method, cfg.URL, body)
+}
@@ -0,0 +1,145 @@
+// Package client implements Go client for aptly REST API
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client talks to aptly REST API
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+}
+
+// Error is returned when API responds with error status
+type Error struct {
+	// HTTP status code
+	StatusCode int
+	// Error message reported by aptly
+	Message string
+}
+
+// Error returns error message
+func (e *Error) Error() string {
+	return fmt.Sprintf("aptly API error %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound checks whether error is API "not found" error
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// NewClient creates client for aptly API listening at baseURL (e.g. http://localhost:8080),
+// httpClient could be used to configure timeouts, TLS or authentication (http.DefaultClient
+// is used if nil)
+func NewClient(baseURL string, httpClient *http.Client) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse API URL: %s", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported API URL scheme: %#v", u.Scheme)
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{baseURL: u, httpClient: httpClient}, nil
+}
+
+// pathEscape escapes path segments
+func pathEscape(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i := range segments {
+		escaped[i] = url.PathEscape(segments[i])
+	}
+
+	return strings.Join(escaped, "/")
+}
+
+// newRequest builds API request, path is relative to /api
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := *c.baseURL
+	u.RawPath = u.EscapedPath() + "/api/" + path
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = query.Encode()
+
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+// send performs request and decodes JSON response into result
+func (c *Client) send(req *http.Request, result interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(data))
+		}
+
+		return &Error{StatusCode: resp.StatusCode, Message: apiErr.Error}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("unable to decode API response: %s", err)
+	}
+
+	return nil
+}
+
+// do performs JSON API request
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(ctx, method, path, query, reader)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.send(req, result)
+}
+
+// Version returns aptly version of the server
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var result struct {
+		Version string
+	}
+
+	err := c.do(ctx, http.MethodGet, "version", nil, nil, &result)
+
+	return result.Version, err
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type ClientSuite struct{}
+
+var _ = Suite(&ClientSuite{})
+
+func (s *ClientSuite) TestNewClient(c *C) {
+	_, err := NewClient("ftp://localhost", nil)
+	c.Check(err, ErrorMatches, "unsupported API URL scheme.*")
+
+	cl, err := NewClient("http://localhost:8080/aptly/", nil)
+	c.Assert(err, IsNil)
+
+	req, err := cl.newRequest(context.Background(), http.MethodGet, publishPath("s3:packages", "ubuntu/dev_test", "stable"), nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(req.URL.String(), Equals, "http://localhost:8080/aptly/api/publish/s3:packages:ubuntu_dev__test/stable")
+
+	req, err = cl.newRequest(context.Background(), http.MethodGet, publishPath("", "", "my/dist"), nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(req.URL.String(), Equals, "http://localhost:8080/aptly/api/publish/:./my_dist")
+
+	req, err = cl.newRequest(context.Background(), http.MethodGet, pathEscape("repos", "a b/c"), nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(req.URL.String(), Equals, "http://localhost:8080/aptly/api/repos/a%20b%2Fc")
+}
+
+func (s *ClientSuite) TestError(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/repos/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"local repo with name missing not found"}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("bad gateway"))
+	}))
+	defer server.Close()
+
+	cl, err := NewClient(server.URL, nil)
+	c.Assert(err, IsNil)
+
+	_, err = cl.GetRepo(context.Background(), "missing")
+	c.Check(err, ErrorMatches, "aptly API error 404: local repo with name missing not found")
+	c.Check(IsNotFound(err), Equals, true)
+
+	_, err = cl.ListRepos(context.Background())
+	c.Check(err, ErrorMatches, "aptly API error 502: bad gateway")
+	c.Check(IsNotFound(err), Equals, false)
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// UploadFile is a file to be uploaded
+type UploadFile struct {
+	// Name of the file in upload directory
+	Name string
+	// File contents
+	Reader io.Reader
+}
+
+// UploadFiles uploads files to directory dir on the server, contents is streamed
+// without buffering whole request in memory; names of stored files are returned
+func (c *Client) UploadFiles(ctx context.Context, dir string, files ...UploadFile) ([]string, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		for _, file := range files {
+			part, err := mw.CreateFormFile("file", filepath.Base(file.Name))
+			if err == nil {
+				_, err = io.Copy(part, file.Reader)
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+
+		pw.CloseWithError(mw.Close())
+	}()
+
+	req, err := c.newRequest(ctx, http.MethodPost, pathEscape("files", dir), nil, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var result []string
+
+	err = c.send(req, &result)
+	pr.Close()
+
+	return result, err
+}
+
+// UploadPaths uploads local files to directory dir on the server
+func (c *Client) UploadPaths(ctx context.Context, dir string, paths ...string) ([]string, error) {
+	files := make([]UploadFile, 0, len(paths))
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open file: %s", err)
+		}
+		defer f.Close()
+
+		files = append(files, UploadFile{Name: filepath.Base(path), Reader: f})
+	}
+
+	return c.UploadFiles(ctx, dir, files...)
+}
+
+// ListUploadDirs returns directories in upload directory on the server
+func (c *Client) ListUploadDirs(ctx context.Context) ([]string, error) {
+	var result []string
+
+	err := c.do(ctx, http.MethodGet, "files", nil, nil, &result)
+
+	return result, err
+}
+
+// ListUploadedFiles returns files uploaded to directory dir
+func (c *Client) ListUploadedFiles(ctx context.Context, dir string) ([]string, error) {
+	var result []string
+
+	err := c.do(ctx, http.MethodGet, pathEscape("files", dir), nil, nil, &result)
+
+	return result, err
+}
+
+// DeleteUploadDir removes directory dir with all uploaded files
+func (c *Client) DeleteUploadDir(ctx context.Context, dir string) error {
+	return c.do(ctx, http.MethodDelete, pathEscape("files", dir), nil, nil, nil)
+}
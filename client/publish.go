@@ -0,0 +1,259 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aptly-dev/aptly/task"
+)
+
+// SigningParams are GPG options for publishing
+type SigningParams struct {
+	// Don't sign published repository
+	Skip bool `json:"Skip"`
+	// GPG key ID to use when signing the release, if not specified default key is used
+	GpgKey string `json:"GpgKey"`
+	// GPG keyring to use (instead of default)
+	Keyring string `json:"Keyring"`
+	// GPG secret keyring to use (instead of default)
+	SecretKeyring string `json:"SecretKeyring"`
+	// GPG passphrase to unlock private key (possibly insecure)
+	Passphrase string `json:"Passphrase"`
+	// GPG passphrase file to unlock private key (possibly insecure)
+	PassphraseFile string `json:"PassphraseFile"`
+	// Signing backend: gpg, vault, awskms or external-cmd, default from server configuration if not set
+	Backend string `json:"Backend"`
+	// Additional keys to sign the release with (e.g. during key rotation)
+	Keys []SigningKeyParams `json:"Keys"`
+}
+
+// SigningKeyParams is additional key to sign published repository with
+type SigningKeyParams struct {
+	// GPG key ID to use when signing the release
+	GpgKey string `json:"GpgKey"`
+	// GPG keyring to use, defaults to Keyring of signing params
+	Keyring string `json:"Keyring"`
+	// GPG secret keyring to use, defaults to SecretKeyring of signing params
+	SecretKeyring string `json:"SecretKeyring"`
+	// GPG passphrase to unlock private key, defaults to Passphrase of signing params
+	Passphrase string `json:"Passphrase"`
+	// GPG passphrase file to unlock private key, defaults to PassphraseFile of signing params
+	PassphraseFile string `json:"PassphraseFile"`
+}
+
+// SourceParams is component of published repository
+type SourceParams struct {
+	// Name of the component
+	Component string `json:"Component"`
+	// Name of the local repository/snapshot
+	Name string `json:"Name"`
+	// Package query to publish only matching packages of the source in this component
+	Filter string `json:"Filter"`
+}
+
+// PublishedRepo is published repository
+type PublishedRepo struct {
+	Storage              string
+	Prefix               string
+	Path                 string
+	Distribution         string
+	SourceKind           string
+	Sources              []SourceParams
+	Architectures        []string
+	Label                string
+	Origin               string
+	Suite                string
+	Codename             string
+	NotAutomatic         string
+	ButAutomaticUpgrades string
+	SkipContents         bool
+	AcquireByHash        bool
+	ByHashDepth          int
+	EnableZst            bool
+	GenerateDiffs        bool
+	DiffsDepth           int
+	MultiDist            bool
+	BlueGreen            bool
+	Flat                 bool
+}
+
+// PublishParams are parameters for publishing local repositories or snapshots
+type PublishParams struct {
+	// 'local' for local repositories and 'snapshot' for snapshots
+	SourceKind string `json:"SourceKind"`
+	// List of 'Component/Name' objects, 'Name' is either local repository or snapshot name
+	Sources []SourceParams `json:"Sources"`
+	// Distribution name, if missing aptly would try to guess from sources
+	Distribution string `json:"Distribution"`
+	// Value of Label: field in published repository stanza
+	Label string `json:"Label"`
+	// Value of Origin: field in published repository stanza
+	Origin string `json:"Origin"`
+	// when publishing, overwrite files in pool/ directory without notice
+	ForceOverwrite bool `json:"ForceOverwrite"`
+	// Override list of published architectures
+	Architectures []string `json:"Architectures"`
+	// GPG options
+	Signing SigningParams `json:"Signing"`
+	// Setting to yes indicates to the package manager to not install or upgrade packages from the repository without user consent
+	NotAutomatic string `json:"NotAutomatic"`
+	// setting to yes excludes upgrades from the NotAutomic setting
+	ButAutomaticUpgrades string `json:"ButAutomaticUpgrades"`
+	// Don't generate contents indexes
+	SkipContents *bool `json:"SkipContents"`
+	// Don't remove unreferenced files in prefix/component
+	SkipCleanup *bool `json:"SkipCleanup"`
+	// Skip bz2 compression for index files
+	SkipBz2 *bool `json:"SkipBz2"`
+	// Generate zstd compressed index files (Packages.zst, Contents.zst)
+	EnableZst *bool `json:"EnableZst"`
+	// Provide index files by hash
+	AcquireByHash *bool `json:"AcquireByHash"`
+	// Number of previous generations of index files kept under by-hash (0 - default of 1)
+	ByHashDepth *int `json:"ByHashDepth"`
+	// Generate diffs of package indexes (pdiffs) for incremental updates by clients
+	GenerateDiffs *bool `json:"GenerateDiffs"`
+	// Number of patches kept in diffs of package indexes (0 - default of 20)
+	DiffsDepth *int `json:"DiffsDepth"`
+	// Enable multiple packages with the same filename in different distributions
+	MultiDist *bool `json:"MultiDist"`
+	// Publish new generation of indexes into separate directory and swap it into place atomically
+	BlueGreen *bool `json:"BlueGreen"`
+	// Publish flat repository without dists/<distribution> hierarchy, it should have exactly one component
+	Flat bool `json:"Flat"`
+	// Estimate number and size of files to be published before publishing, always done if confirmation threshold is configured
+	Estimate bool `json:"Estimate"`
+	// Confirm publishing if estimated size exceeds configured threshold
+	ConfirmEstimate bool `json:"ConfirmEstimate"`
+	// Overrides of binary package fields in published indexes: package name -> field -> value
+	Overrides map[string]map[string]string `json:"Overrides"`
+	// Overrides of source package fields in published indexes: package name -> field -> value
+	SourceOverrides map[string]map[string]string `json:"SourceOverrides"`
+	// Handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only
+	ExtraSourceOnly string `json:"ExtraSourceOnly"`
+	// Handling of source packages without binaries: keep, drop or keep-referenced-only
+	OrphanedSources string `json:"OrphanedSources"`
+	// Placement of Architecture: all packages: duplicate, separate or both
+	ArchitectureAll string `json:"ArchitectureAll"`
+	// Name of resource template with default settings
+	Template string `json:"Template"`
+}
+
+// PublishUpdateParams are parameters for updating published repository or switching
+// published snapshots
+type PublishUpdateParams struct {
+	// when publishing, overwrite files in pool/ directory without notice
+	ForceOverwrite bool `json:"ForceOverwrite"`
+	// GPG options
+	Signing SigningParams `json:"Signing"`
+	// Don't generate contents indexes
+	SkipContents *bool `json:"SkipContents"`
+	// Skip bz2 compression for index files
+	SkipBz2 *bool `json:"SkipBz2"`
+	// Generate zstd compressed index files (Packages.zst, Contents.zst)
+	EnableZst *bool `json:"EnableZst"`
+	// Don't remove unreferenced files in prefix/component
+	SkipCleanup *bool `json:"SkipCleanup"`
+	// only when updating published snapshots, list of objects 'Component/Name'
+	Snapshots []SourceParams `json:"Snapshots"`
+	// Provide index files by hash
+	AcquireByHash *bool `json:"AcquireByHash"`
+	// Number of previous generations of index files kept under by-hash (0 - default of 1)
+	ByHashDepth *int `json:"ByHashDepth"`
+	// Generate diffs of package indexes (pdiffs) for incremental updates by clients
+	GenerateDiffs *bool `json:"GenerateDiffs"`
+	// Number of patches kept in diffs of package indexes (0 - default of 20)
+	DiffsDepth *int `json:"DiffsDepth"`
+	// Enable multiple packages with the same filename in different distributions
+	MultiDist *bool `json:"MultiDist"`
+	// Publish new generation of indexes into separate directory and swap it into place atomically
+	BlueGreen *bool `json:"BlueGreen"`
+	// Estimate number and size of files to be published before publishing, always done if confirmation threshold is configured
+	Estimate bool `json:"Estimate"`
+	// Confirm publishing if estimated size exceeds configured threshold
+	ConfirmEstimate bool `json:"ConfirmEstimate"`
+	// Replace overrides of binary package fields in published indexes: package name -> field -> value
+	Overrides map[string]map[string]string `json:"Overrides"`
+	// Replace overrides of source package fields in published indexes: package name -> field -> value
+	SourceOverrides map[string]map[string]string `json:"SourceOverrides"`
+	// Handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only
+	ExtraSourceOnly *string `json:"ExtraSourceOnly"`
+	// Handling of source packages without binaries: keep, drop or keep-referenced-only
+	OrphanedSources *string `json:"OrphanedSources"`
+	// Placement of Architecture: all packages: duplicate, separate or both
+	ArchitectureAll *string `json:"ArchitectureAll"`
+}
+
+// PublishDropOptions control removal of published repository
+type PublishDropOptions struct {
+	// Remove published repository even if some files could not be cleaned up
+	Force bool
+	// Don't remove unreferenced files in prefix/component
+	SkipCleanup bool
+}
+
+// publishPath escapes storage, prefix and distribution as expected by API
+// ('_' is doubled and '/' replaced with '_')
+func publishPath(storage, prefix string, segments ...string) string {
+	escape := func(s string) string {
+		return strings.Replace(strings.Replace(s, "_", "__", -1), "/", "_", -1)
+	}
+
+	if prefix == "" {
+		prefix = "."
+	}
+	prefix = storage + ":" + escape(prefix)
+
+	for i := range segments {
+		segments[i] = escape(segments[i])
+	}
+
+	return pathEscape(append([]string{"publish", prefix}, segments...)...)
+}
+
+// ListPublished returns all published repositories
+func (c *Client) ListPublished(ctx context.Context) ([]PublishedRepo, error) {
+	var result []PublishedRepo
+
+	err := c.do(ctx, http.MethodGet, "publish", nil, nil, &result)
+
+	return result, err
+}
+
+// GetPublished returns published repository
+func (c *Client) GetPublished(ctx context.Context, storage, prefix, distribution string) (*PublishedRepo, error) {
+	var result PublishedRepo
+
+	if err := c.do(ctx, http.MethodGet, publishPath(storage, prefix, distribution), nil, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Publish starts publishing of local repositories or snapshots under prefix,
+// result of the task is PublishedRepo
+func (c *Client) Publish(ctx context.Context, storage, prefix string, params PublishParams) (*task.Task, error) {
+	return c.doTask(ctx, http.MethodPost, publishPath(storage, prefix), nil, params)
+}
+
+// UpdatePublished starts update of published local repository or switch of
+// published snapshots, result of the task is PublishedRepo
+func (c *Client) UpdatePublished(ctx context.Context, storage, prefix, distribution string, params PublishUpdateParams) (*task.Task, error) {
+	return c.doTask(ctx, http.MethodPut, publishPath(storage, prefix, distribution), nil, params)
+}
+
+// DropPublished starts removal of published repository
+func (c *Client) DropPublished(ctx context.Context, storage, prefix, distribution string, options PublishDropOptions) (*task.Task, error) {
+	query := url.Values{}
+	if options.Force {
+		query.Set("force", "1")
+	}
+	if options.SkipCleanup {
+		query.Set("skipCleanup", "1")
+	}
+
+	return c.doTask(ctx, http.MethodDelete, publishPath(storage, prefix, distribution), query, nil)
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/task"
+)
+
+// LocalRepo is local package repository
+type LocalRepo struct {
+	Name                string
+	Comment             string
+	DefaultDistribution string
+	DefaultComponent    string
+	Holds               []string
+	VersionPolicy       string
+	Retention           *RetentionPolicy
+}
+
+// RetentionPolicy limits versions of packages kept in local repository
+type RetentionPolicy struct {
+	// Number of newest versions kept for each package name and architecture, 0 for no limit
+	KeepVersions int `json:"KeepVersions"`
+	// Versions added to the repo more than MaxAgeDays days ago are pruned, 0 for no limit
+	MaxAgeDays int `json:"MaxAgeDays"`
+	// Prune repo automatically after packages are added to it
+	AutoPrune bool `json:"AutoPrune"`
+}
+
+// RepoCreateParams are parameters for creating local repository
+type RepoCreateParams struct {
+	// Name of repository to create
+	Name string `json:"Name"`
+	// Text describing the repository (optional)
+	Comment string `json:"Comment"`
+	// Default distribution when publishing from this local repo
+	DefaultDistribution string `json:"DefaultDistribution"`
+	// Default component when publishing from this local repo
+	DefaultComponent string `json:"DefaultComponent"`
+	// Snapshot name to create repository from (optional)
+	FromSnapshot string `json:"FromSnapshot"`
+	// Policy for versions of packages being added: no-downgrade or increasing (optional)
+	VersionPolicy string `json:"VersionPolicy"`
+	// Policy for pruning old versions of packages (optional)
+	Retention *RetentionPolicy `json:"Retention"`
+	// Name of resource template with default settings (optional)
+	Template string `json:"Template"`
+}
+
+// RepoAddOptions control import of uploaded packages into local repository
+type RepoAddOptions struct {
+	// Don't remove files after successful import
+	NoRemove bool
+	// Remove packages conflicting with package being added
+	ForceReplace bool
+	// Allow replacing held packages
+	ForceHolds bool
+}
+
+// RepoPruneParams are parameters for pruning local repository
+type RepoPruneParams struct {
+	// Only report packages which would be removed
+	DryRun bool `json:"DryRun"`
+}
+
+// RepoPruneResult is result of pruning local repository
+type RepoPruneResult struct {
+	// Keys of packages removed by retention policy
+	Removed []string
+	// Packages were not removed
+	DryRun bool
+}
+
+// RepoAddResult is result of package import
+type RepoAddResult struct {
+	FailedFiles []string
+	Report      aptly.RecordingResultReporter
+}
+
+// ListRepos returns all local repositories
+func (c *Client) ListRepos(ctx context.Context) ([]LocalRepo, error) {
+	var result []LocalRepo
+
+	err := c.do(ctx, http.MethodGet, "repos", nil, nil, &result)
+
+	return result, err
+}
+
+// GetRepo returns local repository by name
+func (c *Client) GetRepo(ctx context.Context, name string) (*LocalRepo, error) {
+	var result LocalRepo
+
+	if err := c.do(ctx, http.MethodGet, pathEscape("repos", name), nil, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// CreateRepo creates local repository
+func (c *Client) CreateRepo(ctx context.Context, params RepoCreateParams) (*LocalRepo, error) {
+	var result LocalRepo
+
+	if err := c.do(ctx, http.MethodPost, "repos", nil, params, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// DropRepo starts removal of local repository
+func (c *Client) DropRepo(ctx context.Context, name string, force bool) (*task.Task, error) {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+
+	return c.doTask(ctx, http.MethodDelete, pathEscape("repos", name), query, nil)
+}
+
+// RepoPackages returns package keys in local repository, optionally filtered with package query
+func (c *Client) RepoPackages(ctx context.Context, name, q string) ([]string, error) {
+	var result []string
+
+	query := url.Values{}
+	if q != "" {
+		query.Set("q", q)
+	}
+
+	err := c.do(ctx, http.MethodGet, pathEscape("repos", name, "packages"), query, nil, &result)
+
+	return result, err
+}
+
+// AddUploadedPackages starts import of packages uploaded to directory dir (see UploadFiles)
+// into local repository, result of the task is RepoAddResult
+func (c *Client) AddUploadedPackages(ctx context.Context, name, dir string, options RepoAddOptions) (*task.Task, error) {
+	query := url.Values{}
+	if options.NoRemove {
+		query.Set("noRemove", "1")
+	}
+	if options.ForceReplace {
+		query.Set("forceReplace", "1")
+	}
+	if options.ForceHolds {
+		query.Set("forceHolds", "1")
+	}
+
+	return c.doTask(ctx, http.MethodPost, pathEscape("repos", name, "file", dir), query, nil)
+}
+
+// PruneRepo starts removal of packages not retained by retention policy of local repository,
+// result of the task is RepoPruneResult
+func (c *Client) PruneRepo(ctx context.Context, name string, params RepoPruneParams) (*task.Task, error) {
+	return c.doTask(ctx, http.MethodPost, pathEscape("repos", name, "prune"), nil, params)
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aptly-dev/aptly/task"
+)
+
+// Snapshot is immutable list of packages
+type Snapshot struct {
+	Name                 string
+	Description          string
+	CreatedAt            time.Time
+	SourceKind           string
+	Origin               string
+	NotAutomatic         string
+	ButAutomaticUpgrades string
+}
+
+// SnapshotCreateParams are parameters for creating snapshot from repository or mirror
+type SnapshotCreateParams struct {
+	// Name of snapshot to create
+	Name string `json:"Name"`
+	// Text describing the snapshot (optional)
+	Description string `json:"Description"`
+}
+
+// ListSnapshots returns all snapshots
+func (c *Client) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
+	var result []Snapshot
+
+	err := c.do(ctx, http.MethodGet, "snapshots", nil, nil, &result)
+
+	return result, err
+}
+
+// GetSnapshot returns snapshot by name
+func (c *Client) GetSnapshot(ctx context.Context, name string) (*Snapshot, error) {
+	var result Snapshot
+
+	if err := c.do(ctx, http.MethodGet, pathEscape("snapshots", name), nil, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// CreateSnapshotFromRepo starts creation of snapshot from local repository,
+// result of the task is Snapshot
+func (c *Client) CreateSnapshotFromRepo(ctx context.Context, repo string, params SnapshotCreateParams) (*task.Task, error) {
+	return c.doTask(ctx, http.MethodPost, pathEscape("repos", repo, "snapshots"), nil, params)
+}
+
+// CreateSnapshotFromMirror starts creation of snapshot from mirror,
+// result of the task is Snapshot
+func (c *Client) CreateSnapshotFromMirror(ctx context.Context, mirror string, params SnapshotCreateParams) (*task.Task, error) {
+	return c.doTask(ctx, http.MethodPost, pathEscape("mirrors", mirror, "snapshots"), nil, params)
+}
+
+// SnapshotPackages returns package keys in snapshot, optionally filtered with package query
+func (c *Client) SnapshotPackages(ctx context.Context, name, q string) ([]string, error) {
+	var result []string
+
+	query := url.Values{}
+	if q != "" {
+		query.Set("q", q)
+	}
+
+	err := c.do(ctx, http.MethodGet, pathEscape("snapshots", name, "packages"), query, nil, &result)
+
+	return result, err
+}
+
+// DropSnapshot starts removal of snapshot
+func (c *Client) DropSnapshot(ctx context.Context, name string, force bool) (*task.Task, error) {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+
+	return c.doTask(ctx, http.MethodDelete, pathEscape("snapshots", name), query, nil)
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aptly-dev/aptly/task"
+)
+
+// async adds background execution flag to the query
+func async(query url.Values) url.Values {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("_async", "1")
+
+	return query
+}
+
+// doTask starts API operation as background task
+func (c *Client) doTask(ctx context.Context, method, path string, query url.Values, body interface{}) (*task.Task, error) {
+	var result task.Task
+
+	if err := c.do(ctx, method, path, async(query), body, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ListTasks returns all the tasks known to the server
+func (c *Client) ListTasks(ctx context.Context) ([]task.Task, error) {
+	var result []task.Task
+
+	err := c.do(ctx, http.MethodGet, "tasks", nil, nil, &result)
+
+	return result, err
+}
+
+// GetTask returns task by ID
+func (c *Client) GetTask(ctx context.Context, id int) (*task.Task, error) {
+	var result task.Task
+
+	if err := c.do(ctx, http.MethodGet, "tasks/"+strconv.Itoa(id), nil, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// TaskOutput returns output of the task
+func (c *Client) TaskOutput(ctx context.Context, id int) (string, error) {
+	var result string
+
+	err := c.do(ctx, http.MethodGet, "tasks/"+strconv.Itoa(id)+"/output", nil, nil, &result)
+
+	return result, err
+}
+
+// TaskReturnValue decodes value returned by the finished task into result
+func (c *Client) TaskReturnValue(ctx context.Context, id int, result interface{}) error {
+	var returnValue struct {
+		Code  int
+		Value json.RawMessage
+	}
+
+	if err := c.do(ctx, http.MethodGet, "tasks/"+strconv.Itoa(id)+"/return_value", nil, nil, &returnValue); err != nil {
+		return err
+	}
+
+	if len(returnValue.Value) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(returnValue.Value, result); err != nil {
+		return fmt.Errorf("unable to decode task return value: %s", err)
+	}
+
+	return nil
+}
+
+// DeleteTask removes finished task from the server
+func (c *Client) DeleteTask(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "tasks/"+strconv.Itoa(id), nil, nil, nil)
+}
+
+// WaitForTask blocks until task is finished, error is returned if task failed
+func (c *Client) WaitForTask(ctx context.Context, id int) (*task.Task, error) {
+	var result task.Task
+
+	if err := c.do(ctx, http.MethodGet, "tasks/"+strconv.Itoa(id)+"/wait", nil, nil, &result); err != nil {
+		return nil, err
+	}
+
+	if result.State == task.FAILED {
+		output, _ := c.TaskOutput(ctx, id)
+		return &result, fmt.Errorf("task %d (%s) failed: %s", result.ID, result.Name, output)
+	}
+
+	return &result, nil
+}
+
+// Wait waits for task started by other calls and decodes its return value
+// into result (if not nil), task is removed from the server afterwards
+func (c *Client) Wait(ctx context.Context, t *task.Task, result interface{}) error {
+	_, err := c.WaitForTask(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+
+	if result != nil {
+		if err = c.TaskReturnValue(ctx, t.ID, result); err != nil {
+			return err
+		}
+	}
+
+	return c.DeleteTask(ctx, t.ID)
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	stdcontext "context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -16,6 +17,8 @@ import (
 	"github.com/aptly-dev/aptly/utils"
 	"github.com/smira/commander"
 	"github.com/smira/flag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func aptlyAPIServe(cmd *commander.Command, args []string) error {
@@ -39,6 +42,42 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 		return err
 	}
 
+	tlsConfig, err := getTLSConfig(context.Flags())
+	if err != nil {
+		return fmt.Errorf("unable to serve: %s", err)
+	}
+
+	err = context.Config().Replication.Validate()
+	if err != nil {
+		return fmt.Errorf("unable to serve: %s", err)
+	}
+
+	router := api.Router(context)
+
+	// persist tasks, so that tasks interrupted by restart are reported as failed
+	err = api.RestoreTasks()
+	if err != nil {
+		return fmt.Errorf("unable to serve: %s", err)
+	}
+
+	// check published storages in background, so that broken credentials
+	// are reported before the first publish fails
+	go api.CheckPublishedStorages()
+
+	// follow primary, if this instance is a replica
+	go api.RunReplica()
+
+	// run scheduled mirror updates
+	go api.RunScheduler(router)
+
+	grpcServer, err := startGRPCServer(router, context.Flags().Lookup("grpc-listen").Value.String(), tlsConfig)
+	if err != nil {
+		return err
+	}
+	if grpcServer != nil {
+		defer grpcServer.Stop()
+	}
+
 	// Try to recycle systemd fds for listening
 	listeners, err := activation.Listeners(true)
 	if len(listeners) > 1 {
@@ -47,8 +86,11 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 	if err == nil && len(listeners) == 1 {
 		listener := listeners[0]
 		defer listener.Close()
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
 		fmt.Printf("\nTaking over web server at: %s (press Ctrl+C to quit)...\n", listener.Addr().String())
-		err = http.Serve(listener, api.Router(context))
+		err = http.Serve(listener, router)
 		if err != nil {
 			return fmt.Errorf("unable to serve: %s", err)
 		}
@@ -59,7 +101,7 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 	listen := context.Flags().Lookup("listen").Value.String()
 	fmt.Printf("\nStarting web server at: %s (press Ctrl+C to quit)...\n", listen)
 
-	server := http.Server{Handler: api.Router(context)}
+	server := http.Server{Handler: router, TLSConfig: tlsConfig}
 
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
@@ -67,11 +109,25 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 		if _, ok := <-sigchan; ok {
 			fmt.Printf("\nShutdown signal received, waiting for background tasks...\n")
 			context.TaskList().Wait()
+			api.FlushDownloadStats()
+			if grpcServer != nil {
+				grpcServer.GracefulStop()
+			}
 			server.Shutdown(stdcontext.Background())
 		}
 	})()
 	defer close(sigchan)
 
+	hupchan := make(chan os.Signal, 1)
+	signal.Notify(hupchan, syscall.SIGHUP)
+	go (func() {
+		for range hupchan {
+			api.ReloadConfig()
+		}
+	})()
+	defer close(hupchan)
+	defer signal.Stop(hupchan)
+
 	listenURL, err := url.Parse(listen)
 	if err == nil && listenURL.Scheme == "unix" {
 		file := listenURL.Path
@@ -84,10 +140,18 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 		}
 		defer listener.Close()
 
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+
 		err = server.Serve(listener)
 	} else {
 		server.Addr = listen
-		err = server.ListenAndServe()
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
 	}
 
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -97,6 +161,34 @@ func aptlyAPIServe(cmd *commander.Command, args []string) error {
 	return nil
 }
 
+// startGRPCServer starts gRPC API on listen address in background, if enabled
+func startGRPCServer(router http.Handler, listen string, tlsConfig *tls.Config) (*grpc.Server, error) {
+	if listen == "" {
+		return nil, nil
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on: %s\n%s", listen, err)
+	}
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := api.NewGRPCServer(router, opts...)
+
+	fmt.Printf("\nStarting gRPC server at: %s...\n", listen)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			fmt.Fprintf(os.Stderr, "gRPC server failed: %s\n", err)
+		}
+	}()
+
+	return server, nil
+}
+
 func makeCmdAPIServe() *commander.Command {
 	cmd := &commander.Command{
 		Run:       aptlyAPIServe,
@@ -108,16 +200,45 @@ or Unix domain socket. When using a socket, Aptly will fully manage the socket
 file. This command also supports taking over from a systemd file descriptors to
 enable systemd socket activation.
 
+HTTPS is enabled either with certificate and key files (reloaded automatically
+when they change) or with certificates obtained via ACME (Let's Encrypt).
+
+If enableWebUI is set in the configuration, web UI for browsing mirrors, snapshots,
+local repos, published repositories and tasks is available at /ui/, access to it
+could be restricted with webUIAccessControl.
+
+With -grpc-listen, gRPC API (see rpc/aptly.proto) is served in addition to
+REST API: it covers local repos, snapshots, published repositories and tasks,
+progress of background tasks could be streamed with WatchTask call.
+
+Inbound webhooks configured in webhooks section of configuration file are
+served at /api/webhooks/<name>, each webhook maps external event to mirror
+update or published repository update after verifying shared secret.
+
+On startup all configured published storages are checked (probe file is written
+to and removed from .aptly-health directory), failures are logged. Checks could
+be run on demand with GET /api/storage/health, results are also exported as
+metrics (aptly_published_storage_healthy).
+
+Configuration file is reloaded on SIGHUP or with POST /api/config/reload without
+interrupting running tasks. Published storage endpoints, signing and download
+settings, access control, webhooks and publish concurrency are applied to new
+requests, other changed settings are reported and require restart.
+
 Example:
 
   $ aptly api serve -listen=:8080
   $ aptly api serve -listen=unix:///tmp/aptly.sock
+  $ aptly api serve -listen=:443 -acme-domains=aptly.example.com
+  $ aptly api serve -listen=:8080 -grpc-listen=:8081
 `,
 		Flag: *flag.NewFlagSet("aptly-serve", flag.ExitOnError),
 	}
 
 	cmd.Flag.String("listen", ":8080", "host:port for HTTP listening or unix://path to listen on a Unix domain socket")
 	cmd.Flag.Bool("no-lock", false, "don't lock the database")
+	cmd.Flag.String("grpc-listen", "", "host:port for gRPC API listening, gRPC API is disabled if empty")
+	addTLSFlags(&cmd.Flag)
 
 	return cmd
 
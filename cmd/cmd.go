@@ -65,6 +65,27 @@ func PrintPackageList(result *deb.PackageList, format, prefix string) error {
 
 }
 
+// PrintQueryExplain shows how package query was parsed and executed
+func PrintQueryExplain(explain *deb.QueryExplain) {
+	var printNode func(node *deb.QueryPlanNode, indent string)
+	printNode = func(node *deb.QueryPlanNode, indent string) {
+		context.Progress().Printf("%s%s %s [%s]: evaluated %d, matched %d", indent, node.Type, node.Query, node.Strategy, node.Evaluated, node.Matched)
+		if node.Strategy != deb.QueryStrategyPredicate {
+			context.Progress().Printf(", results %d", node.Results)
+		}
+		context.Progress().Printf("\n")
+
+		for _, child := range node.Children {
+			printNode(child, indent+"  ")
+		}
+	}
+
+	context.Progress().Printf("Query: %s\n", explain.Query)
+	context.Progress().Printf("Plan:\n")
+	printNode(explain.Plan, "  ")
+	context.Progress().Printf("Examined: %d packages, matched: %d packages, took %s\n\n", explain.Examined, explain.Matched, explain.Duration)
+}
+
 // LookupOption checks boolean flag with default (usually config) and command-line
 // setting
 func LookupOption(defaultValue bool, flags *flag.FlagSet, name string) (result bool) {
@@ -98,9 +119,11 @@ package environment to new version.`,
 		Subcommands: []*commander.Command{
 			makeCmdConfig(),
 			makeCmdDb(),
+			makeCmdFsck(),
 			makeCmdGraph(),
 			makeCmdMirror(),
 			makeCmdRepo(),
+			makeCmdSecurity(),
 			makeCmdServe(),
 			makeCmdSnapshot(),
 			makeCmdTask(),
@@ -119,6 +142,7 @@ package environment to new version.`,
 	cmd.Flag.Bool("dep-verbose-resolve", false, "when processing dependencies, print detailed logs")
 	cmd.Flag.String("architectures", "", "list of architectures to consider during (comma-separated), default to all available")
 	cmd.Flag.String("config", "", "location of configuration file (default locations in order: ~/.aptly.conf, /usr/local/etc/aptly.conf, /etc/aptly.conf)")
+	cmd.Flag.String("context", "", "name of configuration context (from contexts section of configuration file) to use")
 	cmd.Flag.String("gpg-provider", "", "PGP implementation (\"gpg\", \"gpg1\", \"gpg2\" for external gpg or \"internal\" for Go internal implementation)")
 
 	if aptly.EnableDebug {
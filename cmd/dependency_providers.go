@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+)
+
+type providersFlag struct {
+	providers []string
+}
+
+func (p *providersFlag) Set(value string) error {
+	p.providers = append(p.providers, value)
+	return nil
+}
+
+func (p *providersFlag) Get() interface{} {
+	return p.providers
+}
+
+func (p *providersFlag) String() string {
+	return strings.Join(p.providers, ",")
+}
+
+// printDependencyResolutions reports which provider satisfied each dependency
+func printDependencyResolutions(resolutions []deb.DependencyResolution) {
+	if len(resolutions) == 0 {
+		return
+	}
+
+	context.Progress().Printf("Dependencies resolved:\n")
+	for _, r := range resolutions {
+		if r.Package == nil {
+			context.Progress().ColoredPrintf("  @r%s@|: unsatisfied", r.Dependency.String())
+		} else {
+			context.Progress().ColoredPrintf("  %s: %s from @{y}%s@|", r.Dependency.String(), r.Package, r.Provider)
+		}
+	}
+}
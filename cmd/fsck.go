@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlyFsck(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 0 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	options := deb.FsckOptions{
+		Checksums: context.Flags().Lookup("checksums").Value.Get().(bool),
+		Repair:    context.Flags().Lookup("repair").Value.Get().(bool),
+		SkelDir:   context.SkelPath(),
+	}
+
+	if options.Repair {
+		options.Signer, err = getSigner(context.Flags())
+		if err != nil {
+			return fmt.Errorf("unable to initialize GPG signer: %s", err)
+		}
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+
+	report, err := deb.Fsck(collectionFactory, context.PackagePool(), context, options, context.Progress())
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	context.Progress().Printf("\nChecked %d packages, %d files in package pool, %d published repositories\n",
+		report.Packages, report.PoolFiles, report.Published)
+
+	if len(report.Problems) == 0 {
+		context.Progress().ColoredPrintf("@{g!}No problems found.@|")
+		return nil
+	}
+
+	byCategory := report.ByCategory()
+	categories := make([]string, 0, len(byCategory))
+	for category := range byCategory {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	for _, category := range categories {
+		context.Progress().ColoredPrintf("\n@{y!}%s@| (%d):", category, byCategory[category])
+
+		for _, problem := range report.Problems {
+			if problem.Category != category {
+				continue
+			}
+
+			if problem.Repaired {
+				context.Progress().ColoredPrintf("  * %s: %s: %s @{g}[repaired]@|", problem.Object, problem.Path, problem.Details)
+			} else {
+				context.Progress().ColoredPrintf("  * %s: %s: %s", problem.Object, problem.Path, problem.Details)
+			}
+		}
+	}
+
+	unrepaired := len(report.Problems) - report.Repaired()
+	if unrepaired > 0 {
+		return fmt.Errorf("found %d problems, %d repaired", len(report.Problems), report.Repaired())
+	}
+
+	context.Progress().ColoredPrintf("\n@{g!}All %d problems repaired.@|", report.Repaired())
+	return nil
+}
+
+func makeCmdFsck() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyFsck,
+		UsageLine: "fsck",
+		Short:     "check consistency of DB, package pool and published repositories",
+		Long: `
+Command fsck checks that aptly database, package pool and published repositories
+on all storages agree with each other. Problems are reported by category:
+
+  missing-package            package referenced by mirror, repo, snapshot or
+                             published repository is missing in DB
+  broken-source              source of published repository is missing in DB
+  missing-pool-file          package file is missing in package pool
+  pool-checksum-drift        file in package pool differs from DB
+  orphaned-pool-file         file in package pool isn't used by any package
+  missing-published-file     published index or package file is missing
+  published-checksum-drift   published file differs from Release file or index
+  broken-published-index     published Release file or index can't be parsed
+  orphaned-published-file    file in published pool isn't used by any
+                             published repository
+
+With -repair flag orphaned files are removed and published repositories with
+missing or broken files are re-published. Missing packages and package files
+can't be repaired: mirrors should be updated and packages re-imported.
+
+Command fails if some problems were found, but not repaired.
+
+Example:
+
+    $ aptly fsck -checksums
+`,
+		Flag: *flag.NewFlagSet("aptly-fsck", flag.ExitOnError),
+	}
+
+	cmd.Flag.Bool("checksums", false, "verify checksums of package files (slow)")
+	cmd.Flag.Bool("repair", false, "remove orphaned files and re-publish broken published repositories")
+	cmd.Flag.String("gpg-key", "", "GPG key ID to use when signing the release")
+	cmd.Flag.Var(&keyRingsFlag{}, "extra-gpg-key", "additional GPG key ID to sign the release with, e.g. during key rotation (could be specified multiple times, all the keys share keyring and passphrase options)")
+	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "GPG keyring to use (instead of default)")
+	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
+	cmd.Flag.String("passphrase", "", "GPG passphrase for the key (warning: could be insecure)")
+	cmd.Flag.String("passphrase-file", "", "GPG passphrase-file for the key (warning: could be insecure)")
+	cmd.Flag.String("signing-backend", "", "signing backend: gpg, vault, awskms or external-cmd (default from configuration)")
+	cmd.Flag.Bool("batch", false, "run GPG with detached tty")
+	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
+
+	return cmd
+}
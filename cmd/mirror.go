@@ -1,15 +1,17 @@
 package cmd
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/aptly-dev/aptly/deb"
 	"github.com/aptly-dev/aptly/pgp"
 	"github.com/smira/commander"
 	"github.com/smira/flag"
 )
 
-func getVerifier(flags *flag.FlagSet) (pgp.Verifier, error) {
-	keyRings := flags.Lookup("keyring").Value.Get().([]string)
+func getVerifier(flags *flag.FlagSet, extraKeyRings ...string) (pgp.Verifier, error) {
+	keyRings := append(flags.Lookup("keyring").Value.Get().([]string), extraKeyRings...)
 	ignoreSignatures := context.Config().GpgDisableVerify
 	if context.Flags().IsSet("ignore-signatures") {
 		ignoreSignatures = context.Flags().Lookup("ignore-signatures").Value.Get().(bool)
@@ -28,6 +30,47 @@ func getVerifier(flags *flag.FlagSet) (pgp.Verifier, error) {
 	return verifier, nil
 }
 
+// mirrorKeyRings fetches and verifies pinned keys of mirror, if configured, returning
+// keyring to verify mirror with
+func mirrorKeyRings(repo *deb.RemoteRepo) ([]string, error) {
+	if !repo.HasPinnedKeys() {
+		return nil, nil
+	}
+
+	keyRing, err := repo.FetchKeys(context.Downloader(), context.KeyringsPath())
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{keyRing}, nil
+}
+
+// parseComponentMap parses component mapping specified as <upstream>[,<upstream>...]=<local>
+func parseComponentMap(values []string) (map[string]string, error) {
+	result := map[string]string{}
+
+	for _, value := range values {
+		if value == "" {
+			// empty mapping clears it
+			continue
+		}
+
+		upstreams, local, found := strings.Cut(value, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid component mapping %#v, expected <upstream>[,<upstream>...]=<local>", value)
+		}
+
+		for _, upstream := range strings.Split(upstreams, ",") {
+			if _, exists := result[upstream]; exists {
+				return nil, fmt.Errorf("component %s is mapped more than once", upstream)
+			}
+			result[upstream] = local
+		}
+	}
+
+	return result, nil
+}
+
 type keyRingsFlag struct {
 	keyRings []string
 }
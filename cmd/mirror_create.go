@@ -17,6 +17,11 @@ func aptlyMirrorCreate(cmd *commander.Command, args []string) error {
 		return commander.ErrCommandError
 	}
 
+	err = applyTemplate(context.Flags(), "mirror")
+	if err != nil {
+		return fmt.Errorf("unable to create mirror: %s", err)
+	}
+
 	downloadSources := LookupOption(context.Config().DownloadSourcePackages, context.Flags(), "with-sources")
 	downloadUdebs := context.Flags().Lookup("with-udebs").Value.Get().(bool)
 	downloadInstaller := context.Flags().Lookup("with-installer").Value.Get().(bool)
@@ -58,7 +63,34 @@ func aptlyMirrorCreate(cmd *commander.Command, args []string) error {
 		}
 	}
 
-	verifier, err := getVerifier(context.Flags())
+	componentMap, err := parseComponentMap(context.Flags().Lookup("component-map").Value.Get().([]string))
+	if err == nil {
+		err = repo.SetComponentMap(componentMap)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create mirror: %s", err)
+	}
+
+	err = repo.SetFallbackURLs(context.Flags().Lookup("fallback-url").Value.Get().([]string))
+	if err == nil {
+		err = repo.SetMirrorListURL(context.Flags().Lookup("mirror-list").Value.String())
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create mirror: %s", err)
+	}
+
+	err = repo.SetPinnedKeys(context.Flags().Lookup("key-url").Value.String(), context.Flags().Lookup("keyserver").Value.String(),
+		context.Flags().Lookup("key-fingerprint").Value.Get().([]string))
+	if err != nil {
+		return fmt.Errorf("unable to create mirror: %s", err)
+	}
+
+	keyRings, err := mirrorKeyRings(repo)
+	if err != nil {
+		return fmt.Errorf("unable to fetch keys: %s", err)
+	}
+
+	verifier, err := getVerifier(context.Flags(), keyRings...)
 	if err != nil {
 		return fmt.Errorf("unable to initialize GPG verifier: %s", err)
 	}
@@ -92,9 +124,22 @@ PPA urls could specified in short format:
 
   $ aptly mirror create <name> ppa:<user>/<project>
 
+Public keys of repository could be fetched automatically from URL (-key-url) or keyserver (-keyserver),
+keys are verified against pinned fingerprints (-key-fingerprint) and stored in keyring of the mirror.
+Keys are fetched and verified again on each mirror update.
+
+Upstream components could be renamed or merged into one local component (-component-map),
+e.g. to publish snapshots of the mirror with simplified component scheme.
+
+Fallback archive roots (-fallback-url) and URL of mirror list (-mirror-list, one archive
+root per line) could be specified: when upstream URL fails during mirror update, downloads
+switch over to the next URL.
+
 Example:
 
   $ aptly mirror create wheezy-main http://mirror.yandex.ru/debian/ wheezy main
+
+  $ aptly mirror create -component-map=main,universe=upstream jammy http://archive.ubuntu.com/ubuntu/ jammy main universe
 `,
 		Flag: *flag.NewFlagSet("aptly-mirror-create", flag.ExitOnError),
 	}
@@ -109,6 +154,13 @@ Example:
 	cmd.Flag.Bool("force-architectures", false, "(only with architecture list) skip check that requested architectures are listed in Release file")
 	cmd.Flag.Int("max-tries", 1, "max download tries till process fails with download error")
 	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "gpg keyring to use when verifying Release file (could be specified multiple times)")
+	cmd.Flag.String("key-url", "", "URL to fetch public keys of repository from")
+	cmd.Flag.String("keyserver", "", "keyserver to fetch public keys of repository from")
+	cmd.Flag.Var(&keyRingsFlag{}, "key-fingerprint", "fingerprint of public key to fetch and pin (could be specified multiple times)")
+	cmd.Flag.Var(&keyRingsFlag{}, "component-map", "map upstream components to local component: <upstream>[,<upstream>...]=<local> (could be specified multiple times)")
+	cmd.Flag.Var(&keyRingsFlag{}, "fallback-url", "archive root to download from when upstream URL fails (could be specified multiple times)")
+	cmd.Flag.String("mirror-list", "", "URL of list of archive roots to download from when upstream URL fails")
+	cmd.Flag.String("template", "", "name of resource template with default settings")
 
 	return cmd
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/smira/commander"
 	"github.com/smira/flag"
@@ -46,6 +47,15 @@ func aptlyMirrorDrop(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to drop: %s", err)
 	}
 
+	err = collectionFactory.MirrorScheduleCollection().Drop(repo)
+	if err != nil {
+		return fmt.Errorf("unable to drop: %s", err)
+	}
+
+	if repo.HasPinnedKeys() {
+		os.Remove(repo.KeyringPath(context.KeyringsPath()))
+	}
+
 	fmt.Printf("Mirror `%s` has been removed.\n", repo.Name)
 
 	return err
@@ -49,6 +49,32 @@ func aptlyMirrorEdit(cmd *commander.Command, args []string) error {
 		}
 	})
 
+	if context.Flags().IsSet("component-map") {
+		var componentMap map[string]string
+
+		componentMap, err = parseComponentMap(context.Flags().Lookup("component-map").Value.Get().([]string))
+		if err == nil {
+			err = repo.SetComponentMap(componentMap)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to edit: %s", err)
+		}
+	}
+
+	if context.Flags().IsSet("fallback-url") {
+		err = repo.SetFallbackURLs(context.Flags().Lookup("fallback-url").Value.Get().([]string))
+		if err != nil {
+			return fmt.Errorf("unable to edit: %s", err)
+		}
+	}
+
+	if context.Flags().IsSet("mirror-list") {
+		err = repo.SetMirrorListURL(context.Flags().Lookup("mirror-list").Value.String())
+		if err != nil {
+			return fmt.Errorf("unable to edit: %s", err)
+		}
+	}
+
 	if repo.IsFlat() && repo.DownloadUdebs {
 		return fmt.Errorf("unable to edit: flat mirrors don't support udebs")
 	}
@@ -66,8 +92,14 @@ func aptlyMirrorEdit(cmd *commander.Command, args []string) error {
 	}
 
 	if fetchMirror {
+		var keyRings []string
+		keyRings, err = mirrorKeyRings(repo)
+		if err != nil {
+			return fmt.Errorf("unable to edit: %s", err)
+		}
+
 		var verifier pgp.Verifier
-		verifier, err = getVerifier(context.Flags())
+		verifier, err = getVerifier(context.Flags(), keyRings...)
 		if err != nil {
 			return fmt.Errorf("unable to initialize GPG verifier: %s", err)
 		}
@@ -94,7 +126,7 @@ func makeCmdMirrorEdit() *commander.Command {
 		Short:     "edit mirror settings",
 		Long: `
 Command edit allows one to change settings of mirror:
-filters, list of architectures.
+filters, list of architectures, component mapping, fallback URLs.
 
 Example:
 
@@ -111,6 +143,9 @@ Example:
 	cmd.Flag.Bool("with-sources", false, "download source packages in addition to binary packages")
 	cmd.Flag.Bool("with-udebs", false, "download .udeb packages (Debian installer support)")
 	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "gpg keyring to use when verifying Release file (could be specified multiple times)")
+	cmd.Flag.Var(&keyRingsFlag{}, "component-map", "map upstream components to local component: <upstream>[,<upstream>...]=<local> (could be specified multiple times)")
+	cmd.Flag.Var(&keyRingsFlag{}, "fallback-url", "archive root to download from when upstream URL fails (could be specified multiple times)")
+	cmd.Flag.String("mirror-list", "", "URL of list of archive roots to download from when upstream URL fails")
 
 	return cmd
 }
@@ -46,10 +46,27 @@ func aptlyMirrorShowTxt(_ *commander.Command, args []string) error {
 	fmt.Printf("Name: %s\n", repo.Name)
 	if repo.Status == deb.MirrorUpdating {
 		fmt.Printf("Status: In Update (PID %d)\n", repo.WorkerPID)
+	} else if repo.IsPaused() {
+		fmt.Printf("Status: Update Paused\n")
 	}
 	fmt.Printf("Archive Root URL: %s\n", repo.ArchiveRoot)
+	if len(repo.FallbackURLs) > 0 {
+		fmt.Printf("Fallback URLs: %s\n", strings.Join(repo.FallbackURLs, ", "))
+	}
+	if repo.MirrorListURL != "" {
+		fmt.Printf("Mirror List URL: %s\n", repo.MirrorListURL)
+	}
 	fmt.Printf("Distribution: %s\n", repo.Distribution)
 	fmt.Printf("Components: %s\n", strings.Join(repo.Components, ", "))
+	if len(repo.ComponentMap) > 0 {
+		mapping := make([]string, 0, len(repo.ComponentMap))
+		for _, component := range repo.Components {
+			if local, ok := repo.ComponentMap[component]; ok {
+				mapping = append(mapping, component+" -> "+local)
+			}
+		}
+		fmt.Printf("Component Mapping: %s\n", strings.Join(mapping, ", "))
+	}
 	fmt.Printf("Architectures: %s\n", strings.Join(repo.Architectures, ", "))
 	downloadSources := No
 	if repo.DownloadSources {
@@ -69,12 +86,36 @@ func aptlyMirrorShowTxt(_ *commander.Command, args []string) error {
 		}
 		fmt.Printf("Filter With Deps: %s\n", filterWithDeps)
 	}
+	if repo.HasPinnedKeys() {
+		source := repo.KeyURL
+		if source == "" {
+			source = repo.KeyServer
+		}
+		fmt.Printf("Pinned Keys: %s (from %s)\n", strings.Join(repo.KeyFingerprints, ", "), source)
+	}
 	if repo.LastDownloadDate.IsZero() {
 		fmt.Printf("Last update: never\n")
 	} else {
 		fmt.Printf("Last update: %s\n", repo.LastDownloadDate.Format("2006-01-02 15:04:05 MST"))
 		fmt.Printf("Number of packages: %d\n", repo.NumPackages())
 	}
+	if len(repo.URLHealth) > 0 {
+		fmt.Printf("Upstream URL health (last update):\n")
+		roots := make([]string, 0, len(repo.URLHealth))
+		for root := range repo.URLHealth {
+			roots = append(roots, root)
+		}
+		sort.Strings(roots)
+
+		for _, root := range roots {
+			health := repo.URLHealth[root]
+			fmt.Printf("  %s: %d succeeded, %d failed", root, health.Successes, health.Failures)
+			if health.LastError != "" {
+				fmt.Printf(", last error: %s", health.LastError)
+			}
+			fmt.Printf("\n")
+		}
+	}
 
 	fmt.Printf("\nInformation from release file:\n")
 	for _, k := range utils.StrMapSortedKeys(repo.Meta) {
@@ -14,8 +14,7 @@ import (
 	"github.com/smira/flag"
 )
 
-func aptlyMirrorUpdate(cmd *commander.Command, args []string) error {
-	var err error
+func aptlyMirrorUpdate(cmd *commander.Command, args []string) (err error) {
 	if len(args) != 1 {
 		cmd.Usage()
 		return commander.ErrCommandError
@@ -23,6 +22,12 @@ func aptlyMirrorUpdate(cmd *commander.Command, args []string) error {
 
 	name := args[0]
 
+	defer func() {
+		if err != nil {
+			context.MirrorUpdateFailed(name, err, context.Progress())
+		}
+	}()
+
 	collectionFactory := context.NewCollectionFactory()
 	repo, err := collectionFactory.RemoteRepoCollection().ByName(name)
 	if err != nil {
@@ -48,18 +53,25 @@ func aptlyMirrorUpdate(cmd *commander.Command, args []string) error {
 	}
 	ignoreChecksums := context.Flags().Lookup("ignore-checksums").Value.Get().(bool)
 
-	verifier, err := getVerifier(context.Flags())
+	keyRings, err := mirrorKeyRings(repo)
+	if err != nil {
+		return fmt.Errorf("unable to update: %s", err)
+	}
+
+	verifier, err := getVerifier(context.Flags(), keyRings...)
 	if err != nil {
 		return fmt.Errorf("unable to initialize GPG verifier: %s", err)
 	}
 
-	err = repo.Fetch(context.Downloader(), verifier, ignoreSignatures)
+	downloader := repo.NewURLFailover(context.Downloader()).Wrap(context.Downloader())
+
+	err = repo.Fetch(downloader, verifier, ignoreSignatures)
 	if err != nil {
 		return fmt.Errorf("unable to update: %s", err)
 	}
 
 	context.Progress().Printf("Downloading & parsing package files...\n")
-	err = repo.DownloadPackageIndexes(context.Progress(), context.Downloader(), verifier, collectionFactory, ignoreSignatures, ignoreChecksums)
+	err = repo.DownloadPackageIndexes(context.Progress(), downloader, verifier, collectionFactory, ignoreSignatures, ignoreChecksums)
 	if err != nil {
 		return fmt.Errorf("unable to update: %s", err)
 	}
@@ -182,7 +194,7 @@ func aptlyMirrorUpdate(cmd *commander.Command, args []string) error {
 					}
 
 					// download file...
-					e = context.Downloader().DownloadWithChecksum(
+					e = downloader.DownloadWithChecksum(
 						context,
 						repo.PackageURL(task.File.DownloadURL()).String(),
 						task.TempDownPath,
@@ -261,12 +273,15 @@ func aptlyMirrorUpdate(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to update: download errors:\n  %s", strings.Join(errors, "\n  "))
 	}
 
+	previous := repo.RefList()
 	repo.FinalizeDownload(collectionFactory, context.Progress())
 	err = collectionFactory.RemoteRepoCollection().Update(repo)
 	if err != nil {
 		return fmt.Errorf("unable to update: %s", err)
 	}
 
+	context.MirrorUpdated(repo, previous, collectionFactory, context.Progress())
+
 	context.Progress().Printf("\nMirror `%s` has been updated successfully.\n", repo.Name)
 	return err
 }
@@ -30,7 +30,16 @@ func aptlyPackageSearch(cmd *commander.Command, args []string) error {
 	}
 
 	collectionFactory := context.NewCollectionFactory()
-	result := q.Query(collectionFactory.PackageCollection())
+
+	var result *deb.PackageList
+	if context.Flags().Lookup("explain").Value.Get().(bool) {
+		var explain *deb.QueryExplain
+		result, explain = deb.ExplainQuery(q, collectionFactory.PackageCollection())
+		PrintQueryExplain(explain)
+	} else {
+		result = q.Query(collectionFactory.PackageCollection())
+	}
+
 	if result.Len() == 0 {
 		return fmt.Errorf("no results")
 	}
@@ -51,6 +60,10 @@ Command search displays list of packages in whole DB that match package query.
 
 If query is not specified, all the packages are displayed.
 
+With -explain flag, command shows how query was parsed, which strategy
+(index lookup or full scan) was used for each part of the query and how
+many packages were examined.
+
 Example:
 
     $ aptly package search '$Architecture (i386), Name (% *-dev)'
@@ -59,6 +72,7 @@ Example:
 	}
 
 	cmd.Flag.String("format", "", "custom format for result printing")
+	cmd.Flag.Bool("explain", false, "show how query was parsed and executed")
 
 	return cmd
 }
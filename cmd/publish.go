@@ -6,24 +6,52 @@ import (
 	"github.com/smira/flag"
 )
 
-func getSigner(flags *flag.FlagSet) (pgp.Signer, error) {
+func getSigner(flags *flag.FlagSet) (pgp.FileSigner, error) {
 	if LookupOption(context.Config().GpgDisableSign, flags, "skip-signing") {
 		return nil, nil
 	}
 
-	signer := context.GetSigner()
-	signer.SetKey(flags.Lookup("gpg-key").Value.String())
+	extraKeys := flags.Lookup("extra-gpg-key").Value.Get().([]string)
+	if len(extraKeys) == 0 {
+		return newSigner(flags, flags.Lookup("gpg-key").Value.String())
+	}
+
+	// all keys are looked up in the same keyring and unlocked with the same passphrase,
+	// keys with their own keyrings and passphrases could be configured via API only
+	keys := extraKeys
+	if key := flags.Lookup("gpg-key").Value.String(); key != "" {
+		keys = append([]string{key}, keys...)
+	}
+
+	signers := make([]pgp.Signer, 0, len(keys))
+	for _, key := range keys {
+		signer, err := newSigner(flags, key)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	return pgp.NewMultiSigner(signers...), nil
+}
+
+func newSigner(flags *flag.FlagSet, key string) (pgp.Signer, error) {
+	signer, err := context.GetSignerForBackend(flags.Lookup("signing-backend").Value.String())
+	if err != nil {
+		return nil, err
+	}
+
+	signer.SetKey(key)
 	signer.SetKeyRing(flags.Lookup("keyring").Value.String(), flags.Lookup("secret-keyring").Value.String())
 	signer.SetPassphrase(flags.Lookup("passphrase").Value.String(), flags.Lookup("passphrase-file").Value.String())
 	signer.SetBatch(flags.Lookup("batch").Value.Get().(bool))
 
-	err := signer.Init()
+	err = signer.Init()
 	if err != nil {
 		return nil, err
 	}
 
 	return signer, nil
-
 }
 
 func makeCmdPublish() *commander.Command {
@@ -31,13 +59,17 @@ func makeCmdPublish() *commander.Command {
 		UsageLine: "publish",
 		Short:     "manage published repositories",
 		Subcommands: []*commander.Command{
+			makeCmdPublishCheckClient(),
 			makeCmdPublishDrop(),
+			makeCmdPublishFreeze(),
 			makeCmdPublishList(),
+			makeCmdPublishReplicas(),
 			makeCmdPublishRepo(),
 			makeCmdPublishShow(),
 			makeCmdPublishSnapshot(),
 			makeCmdPublishSource(),
 			makeCmdPublishSwitch(),
+			makeCmdPublishUnfreeze(),
 			makeCmdPublishUpdate(),
 		},
 	}
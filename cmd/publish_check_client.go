@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+// parseCheckClientTarget returns fetcher and distribution for argument of publish check-client:
+// either URL <url>/dists/<distribution> or [<endpoint>:]<prefix>/<distribution>
+func parseCheckClientTarget(param string) (deb.ClientCheckFetcher, string, error) {
+	if strings.HasPrefix(param, "http://") || strings.HasPrefix(param, "https://") {
+		i := strings.LastIndex(param, "/dists/")
+		if i == -1 {
+			return nil, "", fmt.Errorf("URL should point to distribution: <url>/dists/<distribution>")
+		}
+
+		return deb.NewHTTPClientCheckFetcher(param[:i]), strings.Trim(param[i+len("/dists/"):], "/"), nil
+	}
+
+	storageName, prefix := deb.ParsePrefix(param)
+
+	distribution := prefix
+	prefix = "."
+	if i := strings.LastIndex(distribution, "/"); i != -1 {
+		prefix, distribution = distribution[:i], distribution[i+1:]
+	}
+
+	storage, ok := context.GetPublishedStorage(storageName).(aptly.ReadablePublishedStorage)
+	if !ok {
+		return nil, "", fmt.Errorf("published storage %s doesn't support reading files, check it by URL instead", storageName)
+	}
+
+	fetcher := func(path string) (io.ReadCloser, error) {
+		contents, err := storage.ReadFile(filepath.Join(prefix, path))
+		if err != nil {
+			return nil, err
+		}
+
+		return io.NopCloser(bytes.NewReader(contents)), nil
+	}
+
+	return fetcher, distribution, nil
+}
+
+func aptlyPublishCheckClient(cmd *commander.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	fetcher, distribution, err := parseCheckClientTarget(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	verifier, err := getVerifier(context.Flags())
+	if err != nil {
+		return fmt.Errorf("unable to initialize GPG verifier: %s", err)
+	}
+
+	options := deb.ClientCheckOptions{
+		Distribution:     distribution,
+		Verifier:         verifier,
+		IgnoreSignatures: context.Flags().Lookup("ignore-signatures").Value.Get().(bool),
+		Sample:           context.Flags().Lookup("sample").Value.Get().(int),
+	}
+
+	result, err := deb.CheckClient(fetcher, options, context.Progress())
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	context.Progress().Flush()
+
+	fmt.Printf("Release file: %s\n", result.ReleaseFile)
+	if len(result.SignedBy) > 0 {
+		fmt.Printf("Signed by: %s\n", strings.Join(result.SignedBy, ", "))
+	}
+	fmt.Printf("Verified %d index files, %d package files\n", result.Indexes, result.Packages)
+
+	if len(result.Problems) > 0 {
+		fmt.Printf("Problems:\n")
+		for _, problem := range result.Problems {
+			fmt.Printf("  * %s\n", problem)
+		}
+
+		return fmt.Errorf("apt clients will fail to use %s: %d problem(s) found", args[0], len(result.Problems))
+	}
+
+	fmt.Printf("No problems found.\n")
+
+	return nil
+}
+
+func makeCmdPublishCheckClient() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPublishCheckClient,
+		UsageLine: "check-client <url>/dists/<distribution> | [<endpoint>:]<prefix>/<distribution>",
+		Short:     "check published repository the way apt client would use it",
+		Long: `
+Command simulates apt client: it fetches InRelease (or Release and Release.gpg)
+file and verifies its signature, dates and distribution, verifies all index
+files listed in Release file (including by-hash paths) against their checksums
+and downloads sample of package files verifying them against checksums in
+package indexes.
+
+Repository could be checked either by URL (to catch problems introduced by
+web servers, proxies and CDNs) or directly in published storage. Command fails
+if any problem is found.
+
+Example:
+
+    $ aptly publish check-client http://repo.example.com/debian/dists/bookworm
+
+    $ aptly publish check-client s3:test:ppa/bookworm
+`,
+		Flag: *flag.NewFlagSet("aptly-publish-check-client", flag.ExitOnError),
+	}
+	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "gpg keyring to use when verifying Release file (could be specified multiple times)")
+	cmd.Flag.Bool("ignore-signatures", false, "disable verification of Release file signatures")
+	cmd.Flag.Int("sample", 5, "number of package files to download and verify from every package index")
+
+	return cmd
+}
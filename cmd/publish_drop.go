@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
 	"github.com/smira/commander"
 )
 
@@ -24,6 +25,16 @@ func aptlyPublishDrop(cmd *commander.Command, args []string) error {
 	storage, prefix := deb.ParsePrefix(param)
 
 	collectionFactory := context.NewCollectionFactory()
+
+	published, err := collectionFactory.PublishedRepoCollection().ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		return fmt.Errorf("unable to remove: %s", err)
+	}
+
+	if err = published.CheckFrozen(); err != nil {
+		return fmt.Errorf("unable to remove: %s", err)
+	}
+
 	err = collectionFactory.PublishedRepoCollection().Remove(context, storage, prefix, distribution,
 		collectionFactory, context.Progress(),
 		context.Flags().Lookup("force-drop").Value.Get().(bool),
@@ -32,6 +43,8 @@ func aptlyPublishDrop(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to remove: %s", err)
 	}
 
+	context.PublishChanged(utils.NotifyEventPublishDropped, published, context.Progress())
+
 	context.Progress().Printf("\nPublished repository has been removed successfully.\n")
 
 	return err
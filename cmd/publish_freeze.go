@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlyPublishFreeze(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) < 1 || len(args) > 2 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	distribution := args[0]
+	param := "."
+
+	if len(args) == 2 {
+		param = args[1]
+	}
+	storage, prefix := deb.ParsePrefix(param)
+
+	frozen := cmd.Name() == "freeze"
+
+	collectionFactory := context.NewCollectionFactory()
+	published, err := collectionFactory.PublishedRepoCollection().ByStoragePrefixDistribution(storage, prefix, distribution)
+	if err != nil {
+		return fmt.Errorf("unable to %s: %s", cmd.Name(), err)
+	}
+
+	err = collectionFactory.PublishedRepoCollection().LoadComplete(published, collectionFactory)
+	if err != nil {
+		return fmt.Errorf("unable to %s: %s", cmd.Name(), err)
+	}
+
+	signer, err := getSigner(context.Flags())
+	if err != nil {
+		return fmt.Errorf("unable to initialize GPG signer: %s", err)
+	}
+
+	if frozen {
+		published.Freeze(context.Flags().Lookup("notice").Value.String())
+	} else {
+		published.Unfreeze()
+	}
+
+	err = published.Publish(context.PackagePool(), context, collectionFactory, signer, context.Progress(), false, context.SkelPath())
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	err = collectionFactory.PublishedRepoCollection().Update(published)
+	if err != nil {
+		return fmt.Errorf("unable to save to DB: %s", err)
+	}
+
+	if frozen {
+		context.Progress().Printf("\nPublished %s repository %s has been frozen.\n", published.SourceKind, published.String())
+	} else {
+		context.Progress().Printf("\nPublished %s repository %s has been unfrozen.\n", published.SourceKind, published.String())
+	}
+
+	return err
+}
+
+func addPublishFreezeSigningFlags(cmd *commander.Command) {
+	cmd.Flag.String("gpg-key", "", "GPG key ID to use when signing the release")
+	cmd.Flag.Var(&keyRingsFlag{}, "extra-gpg-key", "additional GPG key ID to sign the release with, e.g. during key rotation (could be specified multiple times, all the keys share keyring and passphrase options)")
+	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "GPG keyring to use (instead of default)")
+	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
+	cmd.Flag.String("passphrase", "", "GPG passphrase for the key (warning: could be insecure)")
+	cmd.Flag.String("passphrase-file", "", "GPG passphrase-file for the key (warning: could be insecure)")
+	cmd.Flag.String("signing-backend", "", "signing backend: gpg, vault, awskms or external-cmd (default from configuration)")
+	cmd.Flag.Bool("batch", false, "run GPG with detached tty")
+	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
+}
+
+func makeCmdPublishFreeze() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPublishFreeze,
+		UsageLine: "freeze <distribution> [[<endpoint>:]<prefix>]",
+		Short:     "freeze published repository",
+		Long: `
+Command freezes published repository for maintenance or release freeze:
+frozen published repository can't be updated, switched or removed until
+it is unfrozen with aptly publish unfreeze.
+
+Repository is re-published with unchanged contents, notice set with -notice
+flag is published as Maintenance-Notice field of Release file.
+
+Example:
+
+    $ aptly publish freeze -notice="release freeze until 2024-06-01" wheezy ppa
+`,
+		Flag: *flag.NewFlagSet("aptly-publish-freeze", flag.ExitOnError),
+	}
+	addPublishFreezeSigningFlags(cmd)
+	cmd.Flag.String("notice", "", "maintenance notice to publish in Release file")
+
+	return cmd
+}
+
+func makeCmdPublishUnfreeze() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPublishFreeze,
+		UsageLine: "unfreeze <distribution> [[<endpoint>:]<prefix>]",
+		Short:     "unfreeze published repository",
+		Long: `
+Command lifts freeze of published repository, re-publishing it with unchanged
+contents to remove maintenance notice from Release file.
+
+Example:
+
+    $ aptly publish unfreeze wheezy ppa
+`,
+		Flag: *flag.NewFlagSet("aptly-publish-unfreeze", flag.ExitOnError),
+	}
+	addPublishFreezeSigningFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlyPublishReplicas(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) < 1 || len(args) > 2 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	distribution := args[0]
+	param := "."
+
+	if len(args) == 2 {
+		param = args[1]
+	}
+	_, prefix := deb.ParsePrefix(param)
+
+	collectionFactory := context.NewCollectionFactory()
+	replicas := collectionFactory.PublishedRepoCollection().ByPrefixDistribution(prefix, distribution)
+	if len(replicas) == 0 {
+		return fmt.Errorf("unable to check replicas: published repository %s/%s not found", prefix, distribution)
+	}
+
+	check, err := deb.CheckReplicas(context, replicas)
+	if err != nil {
+		return fmt.Errorf("unable to check replicas: %s", err)
+	}
+
+	if context.Flags().Lookup("resync").Value.Get().(bool) {
+		signer, err := getSigner(context.Flags())
+		if err != nil {
+			return fmt.Errorf("unable to initialize GPG signer: %s", err)
+		}
+
+		err = check.Resync(replicas, context.PackagePool(), context, collectionFactory, signer, context.Progress(), context.SkelPath())
+		if err != nil {
+			return fmt.Errorf("unable to re-sync replicas: %s", err)
+		}
+	}
+
+	fmt.Printf("Replicas of %s/%s:\n", check.Prefix, check.Distribution)
+
+	for i, status := range check.Replicas {
+		state := "in sync"
+		switch {
+		case status.Error != "":
+			state = "error: " + status.Error
+		case status.Resynced:
+			state = "re-synced"
+		case status.Stale:
+			state = "stale"
+		case len(status.ExtraFiles) > 0:
+			state = "diverged"
+		}
+
+		if status.Storage == check.Reference {
+			state = "reference"
+		}
+
+		fmt.Printf("  * %s: %s, %d files", replicas[i].StoragePrefix(), state, status.Files)
+		if len(status.MissingFiles) > 0 || len(status.ExtraFiles) > 0 {
+			fmt.Printf(", %d missing, %d extra", len(status.MissingFiles), len(status.ExtraFiles))
+		}
+		fmt.Printf("\n")
+
+		for _, f := range status.MissingFiles {
+			fmt.Printf("      - %s\n", f)
+		}
+		for _, f := range status.ExtraFiles {
+			fmt.Printf("      + %s\n", f)
+		}
+	}
+
+	if !check.Consistent {
+		return fmt.Errorf("replicas of %s/%s are not consistent", check.Prefix, check.Distribution)
+	}
+
+	return err
+}
+
+func makeCmdPublishReplicas() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyPublishReplicas,
+		UsageLine: "replicas <distribution> [[<endpoint>:]<prefix>]",
+		Short:     "check consistency of published repository replicas",
+		Long: `
+Command compares replicas of published repository: repositories published with
+the same prefix and distribution to different published storages (e.g. S3 buckets
+in several regions). Release files (ignoring dates) and lists of files under dists/
+and pool/ are compared against the replica with the most recent Release file.
+
+With -resync flag stale replicas (with different Release file or missing files)
+are re-published with sources of the reference replica. Command fails if replicas
+are still not consistent.
+
+Example:
+
+    $ aptly publish replicas wheezy ppa
+`,
+		Flag: *flag.NewFlagSet("aptly-publish-replicas", flag.ExitOnError),
+	}
+	cmd.Flag.Bool("resync", false, "re-publish stale replicas")
+	cmd.Flag.String("gpg-key", "", "GPG key ID to use when signing the release")
+	cmd.Flag.Var(&keyRingsFlag{}, "extra-gpg-key", "additional GPG key ID to sign the release with, e.g. during key rotation (could be specified multiple times, all the keys share keyring and passphrase options)")
+	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "GPG keyring to use (instead of default)")
+	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
+	cmd.Flag.String("passphrase", "", "GPG passphrase for the key (warning: could be insecure)")
+	cmd.Flag.String("passphrase-file", "", "GPG passphrase-file for the key (warning: could be insecure)")
+	cmd.Flag.String("signing-backend", "", "signing backend: gpg, vault, awskms or external-cmd (default from configuration)")
+	cmd.Flag.Bool("batch", false, "run GPG with detached tty")
+	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
+
+	return cmd
+}
@@ -26,6 +26,19 @@ repository is for testing purposes and changes happen frequently. For
 production usage please take snapshot of repository and publish it
 using publish snapshot command.
 
+With -blue-green flag, every publish generates complete new generation of
+dists/<distribution> under dists/.generations/ and swaps it into place at once,
+so that clients never observe half-updated indexes. On filesystem dists/<distribution>
+becomes symbolic link to the current generation, object storages can't swap
+directories, so file dists/.generations/<distribution>/current pointing to the current
+generation is written instead, it should be resolved by CDN or proxy.
+
+With -flat flag, repository is published in flat layout: Packages, Sources and
+Release files are placed directly under the prefix without dists/<distribution>
+hierarchy, so that it could be consumed as "deb http://your-server/<prefix> ./".
+Flat repository should have exactly one component, there could be only one flat
+repository in a prefix.
+
 Example:
 
     $ aptly publish repo testing
@@ -35,14 +48,17 @@ Example:
 	cmd.Flag.String("distribution", "", "distribution name to publish")
 	cmd.Flag.String("component", "", "component name to publish (for multi-component publishing, separate components with commas)")
 	cmd.Flag.String("gpg-key", "", "GPG key ID to use when signing the release")
+	cmd.Flag.Var(&keyRingsFlag{}, "extra-gpg-key", "additional GPG key ID to sign the release with, e.g. during key rotation (could be specified multiple times, all the keys share keyring and passphrase options)")
 	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "GPG keyring to use (instead of default)")
 	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
 	cmd.Flag.String("passphrase", "", "GPG passphrase for the key (warning: could be insecure)")
 	cmd.Flag.String("passphrase-file", "", "GPG passphrase-file for the key (warning: could be insecure)")
+	cmd.Flag.String("signing-backend", "", "signing backend: gpg, vault, awskms or external-cmd (default from configuration)")
 	cmd.Flag.Bool("batch", false, "run GPG with detached tty")
 	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
 	cmd.Flag.Bool("skip-contents", false, "don't generate Contents indexes")
 	cmd.Flag.Bool("skip-bz2", false, "don't generate bzipped indexes")
+	cmd.Flag.Bool("enable-zst", false, "generate zstd compressed indexes")
 	cmd.Flag.String("origin", "", "origin name to publish")
 	cmd.Flag.String("notautomatic", "", "set value for NotAutomatic field")
 	cmd.Flag.String("butautomaticupgrades", "", "set  value for ButAutomaticUpgrades field")
@@ -51,7 +67,19 @@ Example:
 	cmd.Flag.String("codename", "", "codename to publish (defaults to distribution)")
 	cmd.Flag.Bool("force-overwrite", false, "overwrite files in package pool in case of mismatch")
 	cmd.Flag.Bool("acquire-by-hash", false, "provide index files by hash")
+	cmd.Flag.Int("acquire-by-hash-depth", 0, "number of previous generations of index files to keep by hash (default 1)")
+	cmd.Flag.Bool("generate-diffs", false, "generate diffs of package indexes (pdiffs) for incremental updates")
+	cmd.Flag.Int("diffs-depth", 0, "number of patches to keep in diffs of package indexes (default 20)")
 	cmd.Flag.Bool("multi-dist", false, "enable multiple packages with the same filename in different distributions")
+	cmd.Flag.Bool("blue-green", false, "publish new generation of indexes into separate directory and swap it into place")
+	cmd.Flag.Bool("flat", false, "publish flat repository without dists/<distribution> hierarchy")
+	cmd.Flag.String("override-file", "", "apt-ftparchive override file adjusting Priority, Section and Maintainer of binary packages")
+	cmd.Flag.String("source-override-file", "", "apt-ftparchive source override file adjusting Section of source packages")
+	cmd.Flag.String("extra-override-file", "", "apt-ftparchive extra override file setting arbitrary fields of binary packages")
+	cmd.Flag.String("extra-source-only", "", "handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only")
+	cmd.Flag.String("orphaned-sources", "", "handling of source packages without binaries: keep, drop or keep-referenced-only")
+	cmd.Flag.String("architecture-all", "", "placement of Architecture: all packages: duplicate (into every binary-<arch> index), separate (binary-all index only) or both")
+	cmd.Flag.String("template", "", "name of resource template with default settings")
 
 	return cmd
 }
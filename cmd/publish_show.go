@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aptly-dev/aptly/deb"
 	"github.com/smira/commander"
@@ -50,6 +51,25 @@ func aptlyPublishShowTxt(_ *commander.Command, args []string) error {
 		fmt.Printf("Distribution: %s\n", repo.Distribution)
 	}
 	fmt.Printf("Architectures: %s\n", strings.Join(repo.Architectures, " "))
+	if repo.Flat {
+		fmt.Printf("Flat: yes\n")
+	}
+	if !repo.Overrides.Empty() {
+		fmt.Printf("Overrides: %d binary, %d source packages\n", len(repo.Overrides.Binary), len(repo.Overrides.Source))
+	}
+	if repo.ExtraSourceOnly != "" {
+		fmt.Printf("Extra-Source-Only: %s\n", repo.ExtraSourceOnly)
+	}
+	if repo.OrphanedSources != "" {
+		fmt.Printf("Orphaned sources: %s\n", repo.OrphanedSources)
+	}
+	if repo.ArchitectureAll != "" {
+		fmt.Printf("Architecture all placement: %s\n", repo.ArchitectureAll)
+	}
+	if stats := repo.LastPublishStats(); stats != nil {
+		fmt.Printf("Last published: %s in %s (%d package files, %d index files, %d bytes uploaded)\n",
+			stats.StartedAt.Format(time.RFC3339), stats.Total, stats.PackageFiles, stats.IndexFiles, stats.PackageBytes+stats.IndexBytes)
+	}
 
 	fmt.Printf("Sources:\n")
 	for _, component := range repo.Components() {
@@ -70,7 +90,11 @@ func aptlyPublishShowTxt(_ *commander.Command, args []string) error {
 		}
 
 		if name != "" {
-			fmt.Printf("  %s: %s [%s]\n", component, name, repo.SourceKind)
+			fmt.Printf("  %s: %s [%s]", component, name, repo.SourceKind)
+			if filter := repo.Filters[component]; filter != "" {
+				fmt.Printf(" filtered by %s", filter)
+			}
+			fmt.Printf("\n")
 		}
 	}
 
@@ -14,6 +14,11 @@ import (
 func aptlyPublishSnapshotOrRepo(cmd *commander.Command, args []string) error {
 	var err error
 
+	err = applyTemplate(context.Flags(), "publish")
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
 	components := strings.Split(context.Flags().Lookup("component").Value.String(), ",")
 	collectionFactory := context.NewCollectionFactory()
 
@@ -146,14 +151,64 @@ func aptlyPublishSnapshotOrRepo(cmd *commander.Command, args []string) error {
 		published.SkipBz2 = context.Flags().Lookup("skip-bz2").Value.Get().(bool)
 	}
 
+	published.EnableZst = context.Config().EnableZstPublishing
+	if context.Flags().IsSet("enable-zst") {
+		published.EnableZst = context.Flags().Lookup("enable-zst").Value.Get().(bool)
+	}
+
 	if context.Flags().IsSet("acquire-by-hash") {
 		published.AcquireByHash = context.Flags().Lookup("acquire-by-hash").Value.Get().(bool)
 	}
 
+	if context.Flags().IsSet("acquire-by-hash-depth") {
+		published.ByHashDepth = context.Flags().Lookup("acquire-by-hash-depth").Value.Get().(int)
+	}
+
+	published.GenerateDiffs = context.Config().GenerateDiffs
+	if context.Flags().IsSet("generate-diffs") {
+		published.GenerateDiffs = context.Flags().Lookup("generate-diffs").Value.Get().(bool)
+	}
+
+	if context.Flags().IsSet("diffs-depth") {
+		published.DiffsDepth = context.Flags().Lookup("diffs-depth").Value.Get().(int)
+	}
+
 	if context.Flags().IsSet("multi-dist") {
 		published.MultiDist = context.Flags().Lookup("multi-dist").Value.Get().(bool)
 	}
 
+	if context.Flags().IsSet("blue-green") {
+		published.BlueGreen = context.Flags().Lookup("blue-green").Value.Get().(bool)
+	}
+
+	published.Flat = context.Flags().Lookup("flat").Value.Get().(bool)
+	if err = published.CheckFlat(); err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
+	overrides, err := deb.ParseOverrideFiles(context.Flags().Lookup("override-file").Value.String(),
+		context.Flags().Lookup("source-override-file").Value.String(),
+		context.Flags().Lookup("extra-override-file").Value.String())
+	if err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+	if !overrides.Empty() {
+		published.Overrides = overrides
+	}
+
+	published.ExtraSourceOnly = context.Flags().Lookup("extra-source-only").Value.String()
+	published.OrphanedSources = context.Flags().Lookup("orphaned-sources").Value.String()
+	for _, mode := range []string{published.ExtraSourceOnly, published.OrphanedSources} {
+		if err = deb.ValidateSourceHandling(mode); err != nil {
+			return fmt.Errorf("unable to publish: %s", err)
+		}
+	}
+
+	published.ArchitectureAll = context.Flags().Lookup("architecture-all").Value.String()
+	if err = deb.ValidateArchitectureAllPlacement(published.ArchitectureAll); err != nil {
+		return fmt.Errorf("unable to publish: %s", err)
+	}
+
 	duplicate := collectionFactory.PublishedRepoCollection().CheckDuplicate(published)
 	if duplicate != nil {
 		collectionFactory.PublishedRepoCollection().LoadComplete(duplicate, collectionFactory)
@@ -180,8 +235,13 @@ func aptlyPublishSnapshotOrRepo(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to save to DB: %s", err)
 	}
 
+	context.PublishChanged(utils.NotifyEventPublishCreated, published, context.Progress())
+
 	var repoComponents string
 	prefix, repoComponents, distribution = published.Prefix, strings.Join(published.Components(), " "), published.Distribution
+	if published.Flat {
+		repoComponents, distribution = "", "./"
+	}
 	if prefix == "." {
 		prefix = ""
 	} else if !strings.HasSuffix(prefix, "/") {
@@ -196,9 +256,9 @@ func aptlyPublishSnapshotOrRepo(cmd *commander.Command, args []string) error {
 	}
 
 	context.Progress().Printf("Now you can add following line to apt sources:\n")
-	context.Progress().Printf("  deb http://your-server/%s %s %s\n", prefix, distribution, repoComponents)
+	context.Progress().Printf("  deb http://your-server/%s %s\n", prefix, strings.TrimSpace(distribution+" "+repoComponents))
 	if utils.StrSliceHasItem(published.Architectures, deb.ArchitectureSource) {
-		context.Progress().Printf("  deb-src http://your-server/%s %s %s\n", prefix, distribution, repoComponents)
+		context.Progress().Printf("  deb-src http://your-server/%s %s\n", prefix, strings.TrimSpace(distribution+" "+repoComponents))
 	}
 	context.Progress().Printf("Don't forget to add your GPG key to apt with apt-key.\n")
 	context.Progress().Printf("\nYou can also use `aptly serve` to publish your repositories over HTTP quickly.\n")
@@ -222,6 +282,19 @@ as the arguments:
 
     aptly publish snapshot -component=main,contrib snap-main snap-contrib
 
+With -blue-green flag, every publish generates complete new generation of
+dists/<distribution> under dists/.generations/ and swaps it into place at once,
+so that clients never observe half-updated indexes. On filesystem dists/<distribution>
+becomes symbolic link to the current generation, object storages can't swap
+directories, so file dists/.generations/<distribution>/current pointing to the current
+generation is written instead, it should be resolved by CDN or proxy.
+
+With -flat flag, repository is published in flat layout: Packages, Sources and
+Release files are placed directly under the prefix without dists/<distribution>
+hierarchy, so that it could be consumed as "deb http://your-server/<prefix> ./".
+Flat repository should have exactly one component, there could be only one flat
+repository in a prefix.
+
 Example:
 
     $ aptly publish snapshot wheezy-main
@@ -231,14 +304,17 @@ Example:
 	cmd.Flag.String("distribution", "", "distribution name to publish")
 	cmd.Flag.String("component", "", "component name to publish (for multi-component publishing, separate components with commas)")
 	cmd.Flag.String("gpg-key", "", "GPG key ID to use when signing the release")
+	cmd.Flag.Var(&keyRingsFlag{}, "extra-gpg-key", "additional GPG key ID to sign the release with, e.g. during key rotation (could be specified multiple times, all the keys share keyring and passphrase options)")
 	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "GPG keyring to use (instead of default)")
 	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
 	cmd.Flag.String("passphrase", "", "GPG passphrase for the key (warning: could be insecure)")
 	cmd.Flag.String("passphrase-file", "", "GPG passphrase-file for the key (warning: could be insecure)")
+	cmd.Flag.String("signing-backend", "", "signing backend: gpg, vault, awskms or external-cmd (default from configuration)")
 	cmd.Flag.Bool("batch", false, "run GPG with detached tty")
 	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
 	cmd.Flag.Bool("skip-contents", false, "don't generate Contents indexes")
 	cmd.Flag.Bool("skip-bz2", false, "don't generate bzipped indexes")
+	cmd.Flag.Bool("enable-zst", false, "generate zstd compressed indexes")
 	cmd.Flag.String("origin", "", "overwrite origin name to publish")
 	cmd.Flag.String("notautomatic", "", "overwrite value for NotAutomatic field")
 	cmd.Flag.String("butautomaticupgrades", "", "overwrite value for ButAutomaticUpgrades field")
@@ -247,7 +323,19 @@ Example:
 	cmd.Flag.String("codename", "", "codename to publish (defaults to distribution)")
 	cmd.Flag.Bool("force-overwrite", false, "overwrite files in package pool in case of mismatch")
 	cmd.Flag.Bool("acquire-by-hash", false, "provide index files by hash")
+	cmd.Flag.Int("acquire-by-hash-depth", 0, "number of previous generations of index files to keep by hash (default 1)")
+	cmd.Flag.Bool("generate-diffs", false, "generate diffs of package indexes (pdiffs) for incremental updates")
+	cmd.Flag.Int("diffs-depth", 0, "number of patches to keep in diffs of package indexes (default 20)")
 	cmd.Flag.Bool("multi-dist", false, "enable multiple packages with the same filename in different distributions")
+	cmd.Flag.Bool("blue-green", false, "publish new generation of indexes into separate directory and swap it into place")
+	cmd.Flag.Bool("flat", false, "publish flat repository without dists/<distribution> hierarchy")
+	cmd.Flag.String("override-file", "", "apt-ftparchive override file adjusting Priority, Section and Maintainer of binary packages")
+	cmd.Flag.String("source-override-file", "", "apt-ftparchive source override file adjusting Section of source packages")
+	cmd.Flag.String("extra-override-file", "", "apt-ftparchive extra override file setting arbitrary fields of binary packages")
+	cmd.Flag.String("extra-source-only", "", "handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only")
+	cmd.Flag.String("orphaned-sources", "", "handling of source packages without binaries: keep, drop or keep-referenced-only")
+	cmd.Flag.String("architecture-all", "", "placement of Architecture: all packages: duplicate (into every binary-<arch> index), separate (binary-all index only) or both")
+	cmd.Flag.String("template", "", "name of resource template with default settings")
 
 	return cmd
 }
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aptly-dev/aptly/deb"
 	"github.com/aptly-dev/aptly/utils"
@@ -43,6 +44,10 @@ func aptlyPublishSwitch(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to switch: %s", err)
 	}
 
+	if err = published.CheckFrozen(); err != nil {
+		return fmt.Errorf("unable to switch: %s", err)
+	}
+
 	if published.SourceKind != deb.SourceSnapshot {
 		return fmt.Errorf("unable to switch: not a published snapshot repository")
 	}
@@ -99,10 +104,30 @@ func aptlyPublishSwitch(cmd *commander.Command, args []string) error {
 		published.SkipBz2 = context.Flags().Lookup("skip-bz2").Value.Get().(bool)
 	}
 
+	if context.Flags().IsSet("enable-zst") {
+		published.EnableZst = context.Flags().Lookup("enable-zst").Value.Get().(bool)
+	}
+
+	if context.Flags().IsSet("acquire-by-hash-depth") {
+		published.ByHashDepth = context.Flags().Lookup("acquire-by-hash-depth").Value.Get().(int)
+	}
+
+	if context.Flags().IsSet("generate-diffs") {
+		published.GenerateDiffs = context.Flags().Lookup("generate-diffs").Value.Get().(bool)
+	}
+
+	if context.Flags().IsSet("diffs-depth") {
+		published.DiffsDepth = context.Flags().Lookup("diffs-depth").Value.Get().(int)
+	}
+
 	if context.Flags().IsSet("multi-dist") {
 		published.MultiDist = context.Flags().Lookup("multi-dist").Value.Get().(bool)
 	}
 
+	if context.Flags().IsSet("blue-green") {
+		published.BlueGreen = context.Flags().Lookup("blue-green").Value.Get().(bool)
+	}
+
 	err = published.Publish(context.PackagePool(), context, collectionFactory, signer, context.Progress(), forceOverwrite, context.SkelPath())
 	if err != nil {
 		return fmt.Errorf("unable to publish: %s", err)
@@ -115,12 +140,21 @@ func aptlyPublishSwitch(cmd *commander.Command, args []string) error {
 
 	skipCleanup := context.Flags().Lookup("skip-cleanup").Value.Get().(bool)
 	if !skipCleanup {
+		cleanupStart := time.Now()
 		err = collectionFactory.PublishedRepoCollection().CleanupPrefixComponentFiles(context, published, components, collectionFactory, context.Progress())
 		if err != nil {
 			return fmt.Errorf("unable to switch: %s", err)
 		}
+
+		published.RecordCleanup(time.Since(cleanupStart))
+		err = collectionFactory.PublishedRepoCollection().Update(published)
+		if err != nil {
+			return fmt.Errorf("unable to save to DB: %s", err)
+		}
 	}
 
+	context.PublishChanged(utils.NotifyEventPublishUpdated, published, context.Progress())
+
 	context.Progress().Printf("\nPublished %s repository %s has been successfully switched to new source.\n", published.SourceKind, published.String())
 
 	return err
@@ -152,18 +186,25 @@ This command would switch published repository (with one component) named ppa/wh
 		Flag: *flag.NewFlagSet("aptly-publish-switch", flag.ExitOnError),
 	}
 	cmd.Flag.String("gpg-key", "", "GPG key ID to use when signing the release")
+	cmd.Flag.Var(&keyRingsFlag{}, "extra-gpg-key", "additional GPG key ID to sign the release with, e.g. during key rotation (could be specified multiple times, all the keys share keyring and passphrase options)")
 	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "GPG keyring to use (instead of default)")
 	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
 	cmd.Flag.String("passphrase", "", "GPG passphrase for the key (warning: could be insecure)")
 	cmd.Flag.String("passphrase-file", "", "GPG passphrase-file for the key (warning: could be insecure)")
+	cmd.Flag.String("signing-backend", "", "signing backend: gpg, vault, awskms or external-cmd (default from configuration)")
 	cmd.Flag.Bool("batch", false, "run GPG with detached tty")
 	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
 	cmd.Flag.Bool("skip-contents", false, "don't generate Contents indexes")
 	cmd.Flag.Bool("skip-bz2", false, "don't generate bzipped indexes")
+	cmd.Flag.Bool("enable-zst", false, "generate zstd compressed indexes")
 	cmd.Flag.String("component", "", "component names to update (for multi-component publishing, separate components with commas)")
 	cmd.Flag.Bool("force-overwrite", false, "overwrite files in package pool in case of mismatch")
 	cmd.Flag.Bool("skip-cleanup", false, "don't remove unreferenced files in prefix/component")
+	cmd.Flag.Int("acquire-by-hash-depth", 0, "number of previous generations of index files to keep by hash (default 1)")
+	cmd.Flag.Bool("generate-diffs", false, "generate diffs of package indexes (pdiffs) for incremental updates")
+	cmd.Flag.Int("diffs-depth", 0, "number of patches to keep in diffs of package indexes (default 20)")
 	cmd.Flag.Bool("multi-dist", false, "enable multiple packages with the same filename in different distributions")
+	cmd.Flag.Bool("blue-green", false, "publish new generation of indexes into separate directory and swap it into place")
 
 	return cmd
 }
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
 	"github.com/smira/commander"
 	"github.com/smira/flag"
 )
@@ -31,6 +33,10 @@ func aptlyPublishUpdate(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to update: %s", err)
 	}
 
+	if err = published.CheckFrozen(); err != nil {
+		return fmt.Errorf("unable to update: %s", err)
+	}
+
 	err = collectionFactory.PublishedRepoCollection().LoadComplete(published, collectionFactory)
 	if err != nil {
 		return fmt.Errorf("unable to update: %s", err)
@@ -60,10 +66,30 @@ func aptlyPublishUpdate(cmd *commander.Command, args []string) error {
 		published.SkipBz2 = context.Flags().Lookup("skip-bz2").Value.Get().(bool)
 	}
 
+	if context.Flags().IsSet("enable-zst") {
+		published.EnableZst = context.Flags().Lookup("enable-zst").Value.Get().(bool)
+	}
+
+	if context.Flags().IsSet("acquire-by-hash-depth") {
+		published.ByHashDepth = context.Flags().Lookup("acquire-by-hash-depth").Value.Get().(int)
+	}
+
+	if context.Flags().IsSet("generate-diffs") {
+		published.GenerateDiffs = context.Flags().Lookup("generate-diffs").Value.Get().(bool)
+	}
+
+	if context.Flags().IsSet("diffs-depth") {
+		published.DiffsDepth = context.Flags().Lookup("diffs-depth").Value.Get().(int)
+	}
+
 	if context.Flags().IsSet("multi-dist") {
 		published.MultiDist = context.Flags().Lookup("multi-dist").Value.Get().(bool)
 	}
 
+	if context.Flags().IsSet("blue-green") {
+		published.BlueGreen = context.Flags().Lookup("blue-green").Value.Get().(bool)
+	}
+
 	err = published.Publish(context.PackagePool(), context, collectionFactory, signer, context.Progress(), forceOverwrite, context.SkelPath())
 	if err != nil {
 		return fmt.Errorf("unable to publish: %s", err)
@@ -78,12 +104,21 @@ func aptlyPublishUpdate(cmd *commander.Command, args []string) error {
 	if !skipCleanup {
 		cleanComponents := make([]string, 0, len(result.UpdatedSources)+len(result.RemovedSources))
 		cleanComponents = append(append(cleanComponents, result.UpdatedComponents()...), result.RemovedComponents()...)
+		cleanupStart := time.Now()
 		err = collectionFactory.PublishedRepoCollection().CleanupPrefixComponentFiles(context, published, cleanComponents, collectionFactory, context.Progress())
 		if err != nil {
 			return fmt.Errorf("unable to update: %s", err)
 		}
+
+		published.RecordCleanup(time.Since(cleanupStart))
+		err = collectionFactory.PublishedRepoCollection().Update(published)
+		if err != nil {
+			return fmt.Errorf("unable to save to DB: %s", err)
+		}
 	}
 
+	context.PublishChanged(utils.NotifyEventPublishUpdated, published, context.Progress())
+
 	context.Progress().Printf("\nPublished %s repository %s has been updated successfully.\n", published.SourceKind, published.String())
 
 	return err
@@ -116,17 +151,24 @@ Example:
 		Flag: *flag.NewFlagSet("aptly-publish-update", flag.ExitOnError),
 	}
 	cmd.Flag.String("gpg-key", "", "GPG key ID to use when signing the release")
+	cmd.Flag.Var(&keyRingsFlag{}, "extra-gpg-key", "additional GPG key ID to sign the release with, e.g. during key rotation (could be specified multiple times, all the keys share keyring and passphrase options)")
 	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "GPG keyring to use (instead of default)")
 	cmd.Flag.String("secret-keyring", "", "GPG secret keyring to use (instead of default)")
 	cmd.Flag.String("passphrase", "", "GPG passphrase for the key (warning: could be insecure)")
 	cmd.Flag.String("passphrase-file", "", "GPG passphrase-file for the key (warning: could be insecure)")
+	cmd.Flag.String("signing-backend", "", "signing backend: gpg, vault, awskms or external-cmd (default from configuration)")
 	cmd.Flag.Bool("batch", false, "run GPG with detached tty")
 	cmd.Flag.Bool("skip-signing", false, "don't sign Release files with GPG")
 	cmd.Flag.Bool("skip-contents", false, "don't generate Contents indexes")
 	cmd.Flag.Bool("skip-bz2", false, "don't generate bzipped indexes")
+	cmd.Flag.Bool("enable-zst", false, "generate zstd compressed indexes")
 	cmd.Flag.Bool("force-overwrite", false, "overwrite files in package pool in case of mismatch")
 	cmd.Flag.Bool("skip-cleanup", false, "don't remove unreferenced files in prefix/component")
+	cmd.Flag.Int("acquire-by-hash-depth", 0, "number of previous generations of index files to keep by hash (default 1)")
+	cmd.Flag.Bool("generate-diffs", false, "generate diffs of package indexes (pdiffs) for incremental updates")
+	cmd.Flag.Int("diffs-depth", 0, "number of patches to keep in diffs of package indexes (default 20)")
 	cmd.Flag.Bool("multi-dist", false, "enable multiple packages with the same filename in different distributions")
+	cmd.Flag.Bool("blue-green", false, "publish new generation of indexes into separate directory and swap it into place")
 
 	return cmd
 }
@@ -14,11 +14,16 @@ func makeCmdRepo() *commander.Command {
 			makeCmdRepoCreate(),
 			makeCmdRepoDrop(),
 			makeCmdRepoEdit(),
+			makeCmdRepoHold(),
 			makeCmdRepoImport(),
 			makeCmdRepoList(),
+			makeCmdRepoMultiArchCheck(),
+			makeCmdRepoLicenses(),
 			makeCmdRepoMove(),
+			makeCmdRepoPrune(),
 			makeCmdRepoRemove(),
 			makeCmdRepoShow(),
+			makeCmdRepoUnhold(),
 			makeCmdRepoRename(),
 			makeCmdRepoSearch(),
 			makeCmdRepoInclude(),
@@ -42,6 +42,11 @@ func aptlyRepoAdd(cmd *commander.Command, args []string) error {
 
 	forceReplace := context.Flags().Lookup("force-replace").Value.Get().(bool)
 
+	var isHeld func(*deb.Package) bool
+	if !context.Flags().Lookup("force-holds").Value.Get().(bool) {
+		isHeld = repo.IsHeld
+	}
+
 	var packageFiles, otherFiles, failedFiles []string
 
 	packageFiles, otherFiles, failedFiles = deb.CollectPackageFiles(args[1:], &aptly.ConsoleResultReporter{Progress: context.Progress()})
@@ -50,14 +55,17 @@ func aptlyRepoAdd(cmd *commander.Command, args []string) error {
 
 	processedFiles, failedFiles2, err = deb.ImportPackageFiles(list, packageFiles, forceReplace, verifier, context.PackagePool(),
 		collectionFactory.PackageCollection(), &aptly.ConsoleResultReporter{Progress: context.Progress()}, nil,
-		collectionFactory.ChecksumCollection)
+		collectionFactory.ChecksumCollection, isHeld, repo.CheckVersionPolicy)
 	failedFiles = append(failedFiles, failedFiles2...)
 	if err != nil {
 		return fmt.Errorf("unable to import package files: %s", err)
 	}
 
+	addedFiles := processedFiles
 	processedFiles = append(processedFiles, otherFiles...)
 
+	repo.AutoPrune(list, &aptly.ConsoleResultReporter{Progress: context.Progress()})
+
 	repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
 
 	err = collectionFactory.LocalRepoCollection().Update(repo)
@@ -65,6 +73,8 @@ func aptlyRepoAdd(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to save: %s", err)
 	}
 
+	context.PackagesAdded(repo, addedFiles, context.Progress())
+
 	if context.Flags().Lookup("remove-files").Value.Get().(bool) {
 		processedFiles = utils.StrSliceDeduplicate(processedFiles)
 
@@ -109,6 +119,7 @@ Example:
 
 	cmd.Flag.Bool("remove-files", false, "remove files that have been imported successfully into repository")
 	cmd.Flag.Bool("force-replace", false, "when adding package that conflicts with existing package, remove existing package")
+	cmd.Flag.Bool("force-holds", false, "allow replacing held packages")
 
 	return cmd
 }
@@ -15,9 +15,35 @@ func aptlyRepoCreate(cmd *commander.Command, args []string) error {
 		return commander.ErrCommandError
 	}
 
+	err = applyTemplate(context.Flags(), "repo")
+	if err != nil {
+		return fmt.Errorf("unable to create: %s", err)
+	}
+
 	repo := deb.NewLocalRepo(args[0], context.Flags().Lookup("comment").Value.String())
 	repo.DefaultDistribution = context.Flags().Lookup("distribution").Value.String()
 	repo.DefaultComponent = context.Flags().Lookup("component").Value.String()
+	repo.VersionPolicy = context.Flags().Lookup("version-policy").Value.String()
+
+	err = deb.ValidateVersionPolicy(repo.VersionPolicy)
+	if err != nil {
+		return fmt.Errorf("unable to create: %s", err)
+	}
+
+	keepVersions := context.Flags().Lookup("keep-versions").Value.Get().(int)
+	maxAgeDays := context.Flags().Lookup("max-age-days").Value.Get().(int)
+	if keepVersions != 0 || maxAgeDays != 0 {
+		repo.Retention = &deb.RetentionPolicy{
+			KeepVersions: keepVersions,
+			MaxAgeDays:   maxAgeDays,
+			AutoPrune:    context.Flags().Lookup("auto-prune").Value.Get().(bool),
+		}
+
+		err = repo.Retention.Validate()
+		if err != nil {
+			return fmt.Errorf("unable to create: %s", err)
+		}
+	}
 
 	uploadersFile := context.Flags().Lookup("uploaders-file").Value.Get().(string)
 	if uploadersFile != "" {
@@ -78,7 +104,12 @@ Example:
 	cmd.Flag.String("comment", "", "any text that would be used to described local repository")
 	cmd.Flag.String("distribution", "", "default distribution when publishing")
 	cmd.Flag.String("component", "main", "default component when publishing")
+	cmd.Flag.String("version-policy", "", "policy for versions of packages being added: no-downgrade or increasing")
+	cmd.Flag.Int("keep-versions", 0, "retention policy: number of newest versions kept for each package")
+	cmd.Flag.Int("max-age-days", 0, "retention policy: remove versions added more than this number of days ago")
+	cmd.Flag.Bool("auto-prune", false, "retention policy: prune repository automatically after packages are added")
 	cmd.Flag.String("uploaders-file", "", "uploaders.json to be used when including .changes into this repository")
+	cmd.Flag.String("template", "", "name of resource template with default settings")
 
 	return cmd
 }
@@ -29,6 +29,12 @@ func aptlyRepoEdit(cmd *commander.Command, args []string) error {
 
 	var uploadersFile *string
 
+	retention := &deb.RetentionPolicy{}
+	if repo.Retention != nil {
+		*retention = *repo.Retention
+	}
+	retentionChanged := false
+
 	context.Flags().Visit(func(flag *flag.Flag) {
 		switch flag.Name {
 		case "comment":
@@ -39,9 +45,37 @@ func aptlyRepoEdit(cmd *commander.Command, args []string) error {
 			repo.DefaultComponent = flag.Value.String()
 		case "uploaders-file":
 			uploadersFile = pointer.ToString(flag.Value.String())
+		case "version-policy":
+			repo.VersionPolicy = flag.Value.String()
+		case "keep-versions":
+			retention.KeepVersions = flag.Value.Get().(int)
+			retentionChanged = true
+		case "max-age-days":
+			retention.MaxAgeDays = flag.Value.Get().(int)
+			retentionChanged = true
+		case "auto-prune":
+			retention.AutoPrune = flag.Value.Get().(bool)
+			retentionChanged = true
 		}
 	})
 
+	err = deb.ValidateVersionPolicy(repo.VersionPolicy)
+	if err != nil {
+		return fmt.Errorf("unable to edit: %s", err)
+	}
+
+	if retentionChanged {
+		if retention.KeepVersions == 0 && retention.MaxAgeDays == 0 {
+			retention = nil
+		} else {
+			err = retention.Validate()
+			if err != nil {
+				return fmt.Errorf("unable to edit: %s", err)
+			}
+		}
+		repo.SetRetention(retention)
+	}
+
 	if uploadersFile != nil {
 		if *uploadersFile != "" {
 			repo.Uploaders, err = deb.NewUploadersFromFile(*uploadersFile)
@@ -69,7 +103,9 @@ func makeCmdRepoEdit() *commander.Command {
 		Short:     "edit properties of local repository",
 		Long: `
 Command edit allows one to change metadata of local repository:
-comment, default distribution and component.
+comment, default distribution and component, version policy and
+retention policy. Retention policy is removed when both -keep-versions
+and -max-age-days are set to 0.
 
 Example:
 
@@ -82,6 +118,10 @@ Example:
 	cmd.Flag.String("distribution", "", "default distribution when publishing")
 	cmd.Flag.String("component", "", "default component when publishing")
 	cmd.Flag.String("uploaders-file", "", "uploaders.json to be used when including .changes into this repository")
+	cmd.Flag.String("version-policy", "", "policy for versions of packages being added: no-downgrade, increasing or empty to disable")
+	cmd.Flag.Int("keep-versions", 0, "retention policy: number of newest versions kept for each package, 0 for no limit")
+	cmd.Flag.Int("max-age-days", 0, "retention policy: remove versions added more than this number of days ago, 0 for no limit")
+	cmd.Flag.Bool("auto-prune", false, "retention policy: prune repository automatically after packages are added")
 
 	return cmd
 }
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/query"
+	"github.com/smira/commander"
+)
+
+func aptlyRepoHoldUnhold(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) < 2 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	command := cmd.Name()
+	name := args[0]
+
+	collectionFactory := context.NewCollectionFactory()
+	repo, err := collectionFactory.LocalRepoCollection().ByName(name)
+	if err != nil {
+		return fmt.Errorf("unable to %s: %s", command, err)
+	}
+
+	err = collectionFactory.LocalRepoCollection().LoadComplete(repo)
+	if err != nil {
+		return fmt.Errorf("unable to %s: %s", command, err)
+	}
+
+	context.Progress().Printf("Loading packages...\n")
+
+	list, err := deb.NewPackageListFromRefList(repo.RefList(), collectionFactory.PackageCollection(), context.Progress())
+	if err != nil {
+		return fmt.Errorf("unable to load packages: %s", err)
+	}
+
+	queries := make([]deb.PackageQuery, len(args)-1)
+	for i := 0; i < len(args)-1; i++ {
+		queries[i], err = query.Parse(args[i+1])
+		if err != nil {
+			return fmt.Errorf("unable to %s: %s", command, err)
+		}
+	}
+
+	list.PrepareIndex()
+	toProcess, err := list.Filter(queries, false, nil, 0, nil)
+	if err != nil {
+		return fmt.Errorf("unable to %s: %s", command, err)
+	}
+
+	toProcess.ForEach(func(p *deb.Package) error {
+		if command == "hold" { // nolint: goconst
+			if repo.Hold(p) {
+				context.Progress().ColoredPrintf("@g[+]@| %s held", p)
+			}
+		} else {
+			if repo.Unhold(p) {
+				context.Progress().ColoredPrintf("@r[-]@| %s unheld", p)
+			}
+		}
+		return nil
+	})
+
+	err = collectionFactory.LocalRepoCollection().Update(repo)
+	if err != nil {
+		return fmt.Errorf("unable to save: %s", err)
+	}
+
+	return err
+}
+
+func makeCmdRepoHold() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyRepoHoldUnhold,
+		UsageLine: "hold <name> <package-query> ...",
+		Short:     "hold packages in local repository",
+		Long: `
+Command hold marks packages matching <package-query> in local repository
+<name> as held. Held packages can't be removed from the repository, moved
+out of it or replaced with 'aptly repo add' or 'aptly repo include' unless
+-force-holds flag is specified.
+
+Example:
+
+  $ aptly repo hold testing 'myapp (=0.1.12)'
+`,
+	}
+
+	return cmd
+}
@@ -28,6 +28,7 @@ func aptlyRepoInclude(cmd *commander.Command, args []string) error {
 	}
 
 	forceReplace := context.Flags().Lookup("force-replace").Value.Get().(bool)
+	forceHolds := context.Flags().Lookup("force-holds").Value.Get().(bool)
 	acceptUnsigned := context.Flags().Lookup("accept-unsigned").Value.Get().(bool)
 	ignoreSignatures := context.Config().GpgDisableVerify
 	if context.Flags().IsSet("ignore-signatures") {
@@ -65,10 +66,11 @@ func aptlyRepoInclude(cmd *commander.Command, args []string) error {
 
 	changesFiles, failedFiles = deb.CollectChangesFiles(args, reporter)
 	_, failedFiles2, err = deb.ImportChangesFiles(
-		changesFiles, reporter, acceptUnsigned, ignoreSignatures, forceReplace, noRemoveFiles, verifier, repoTemplate,
+		changesFiles, reporter, acceptUnsigned, ignoreSignatures, forceReplace, forceHolds, noRemoveFiles, verifier, repoTemplate,
 		context.Progress(), collectionFactory.LocalRepoCollection(), collectionFactory.PackageCollection(),
 		context.PackagePool(), collectionFactory.ChecksumCollection,
-		uploaders, query.Parse)
+		uploaders, query.Parse,
+		func(repo *deb.LocalRepo, files []string) { context.PackagesAdded(repo, files, context.Progress()) })
 	failedFiles = append(failedFiles, failedFiles2...)
 
 	if len(failedFiles) > 0 {
@@ -105,6 +107,7 @@ Example:
 
 	cmd.Flag.Bool("no-remove-files", false, "don't remove files that have been imported successfully into repository")
 	cmd.Flag.Bool("force-replace", false, "when adding package that conflicts with existing package, remove existing package")
+	cmd.Flag.Bool("force-holds", false, "allow replacing held packages")
 	cmd.Flag.String("repo", "{{.Distribution}}", "which repo should files go to, defaults to Distribution field of .changes file")
 	cmd.Flag.Var(&keyRingsFlag{}, "keyring", "gpg keyring to use when verifying Release file (could be specified multiple times)")
 	cmd.Flag.Bool("ignore-signatures", false, "disable verification of .changes file signature")
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlyRepoLicenses(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 1 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	repo, err := collectionFactory.LocalRepoCollection().ByName(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to show licenses: %s", err)
+	}
+
+	err = collectionFactory.LocalRepoCollection().LoadComplete(repo)
+	if err != nil {
+		return fmt.Errorf("unable to show licenses: %s", err)
+	}
+
+	return printLicenseReport(repo.RefList(), collectionFactory)
+}
+
+func makeCmdRepoLicenses() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyRepoLicenses,
+		UsageLine: "licenses <name>",
+		Short:     "show licenses of packages in local repository",
+		Long: `
+Command licenses shows licenses of binary packages in local repository
+<name>, see 'aptly snapshot licenses' for details.
+
+Example:
+
+    $ aptly repo licenses -license=MIT testing
+`,
+		Flag: *flag.NewFlagSet("aptly-repo-licenses", flag.ExitOnError),
+	}
+
+	cmd.Flag.String("license", "", "show only packages with specified license")
+
+	return cmd
+}
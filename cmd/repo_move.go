@@ -121,6 +121,13 @@ func aptlyRepoMoveCopyImport(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to %s: %s", command, err)
 	}
 
+	if command == "move" && !context.Flags().Lookup("force-holds").Value.Get().(bool) { // nolint: goconst
+		err = srcRepo.CheckHolds(toProcess)
+		if err != nil {
+			return fmt.Errorf("unable to %s: %s, use -force-holds to override", command, err)
+		}
+	}
+
 	var verb string
 
 	if command == "move" { // nolint: goconst
@@ -132,6 +139,11 @@ func aptlyRepoMoveCopyImport(cmd *commander.Command, args []string) error {
 	}
 
 	err = toProcess.ForEach(func(p *deb.Package) error {
+		err = dstRepo.CheckVersionPolicy(dstList, p)
+		if err != nil {
+			return err
+		}
+
 		err = dstList.Add(p)
 		if err != nil {
 			return err
@@ -188,6 +200,7 @@ Example:
 
 	cmd.Flag.Bool("dry-run", false, "don't move, just show what would be moved")
 	cmd.Flag.Bool("with-deps", false, "follow dependencies when processing package-spec")
+	cmd.Flag.Bool("force-holds", false, "move packages held in source repository")
 
 	return cmd
 }
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/smira/commander"
+)
+
+func aptlyRepoMultiArchCheck(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 1 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	repo, err := collectionFactory.LocalRepoCollection().ByName(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	err = collectionFactory.LocalRepoCollection().LoadComplete(repo)
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	return printMultiArchReport(repo.RefList(), collectionFactory)
+}
+
+func makeCmdRepoMultiArchCheck() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyRepoMultiArchCheck,
+		UsageLine: "multiarch-check <name>",
+		Short:     "check Multi-Arch consistency of local repository",
+		Long: `
+Command multiarch-check analyzes packages in local repository <name> for
+Multi-Arch violations, see 'aptly snapshot multiarch-check' for details.
+
+Example:
+
+    $ aptly repo multiarch-check testing
+`,
+	}
+
+	return cmd
+}
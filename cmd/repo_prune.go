@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlyRepoPrune(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 1 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	repo, err := collectionFactory.LocalRepoCollection().ByName(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to prune: %s", err)
+	}
+
+	if repo.Retention == nil {
+		return fmt.Errorf("unable to prune: local repo %s has no retention policy", repo.Name)
+	}
+
+	err = collectionFactory.LocalRepoCollection().LoadComplete(repo)
+	if err != nil {
+		return fmt.Errorf("unable to prune: %s", err)
+	}
+
+	context.Progress().Printf("Loading packages...\n")
+
+	list, err := deb.NewPackageListFromRefList(repo.RefList(), collectionFactory.PackageCollection(), context.Progress())
+	if err != nil {
+		return fmt.Errorf("unable to load packages: %s", err)
+	}
+
+	for _, p := range repo.Prune(list, time.Now()) {
+		context.Progress().ColoredPrintf("@r[-]@| %s removed", p)
+	}
+
+	if context.Flags().Lookup("dry-run").Value.Get().(bool) {
+		context.Progress().Printf("\nChanges not saved, as dry run has been requested.\n")
+	} else {
+		repo.UpdateRefList(deb.NewPackageRefListFromPackageList(list))
+
+		err = collectionFactory.LocalRepoCollection().Update(repo)
+		if err != nil {
+			return fmt.Errorf("unable to save: %s", err)
+		}
+	}
+
+	return err
+}
+
+func makeCmdRepoPrune() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyRepoPrune,
+		UsageLine: "prune <name>",
+		Short:     "remove old versions of packages according to retention policy",
+		Long: `
+Command prune removes packages which are not retained by retention policy
+of local repository <name> (set with 'aptly repo edit -keep-versions' or
+'-max-age-days'). Packages are grouped by name and architecture, the newest
+version of each package and held packages are never removed. If removed
+packages are not referenced by other repos or snapshots, they can be removed
+completely (including files) by running 'aptly db cleanup'.
+
+Example:
+
+  $ aptly repo prune nightly
+`,
+		Flag: *flag.NewFlagSet("aptly-repo-prune", flag.ExitOnError),
+	}
+
+	cmd.Flag.Bool("dry-run", false, "don't remove, just show what would be removed")
+
+	return cmd
+}
@@ -50,6 +50,13 @@ func aptlyRepoRemove(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to remove: %s", err)
 	}
 
+	if !context.Flags().Lookup("force-holds").Value.Get().(bool) {
+		err = repo.CheckHolds(toRemove)
+		if err != nil {
+			return fmt.Errorf("unable to remove: %s, use -force-holds to override", err)
+		}
+	}
+
 	toRemove.ForEach(func(p *deb.Package) error {
 		list.Remove(p)
 		context.Progress().ColoredPrintf("@r[-]@| %s removed", p)
@@ -79,7 +86,8 @@ func makeCmdRepoRemove() *commander.Command {
 Commands removes packages matching <package-query> from local repository
 <name>. If removed packages are not referenced by other repos or
 snapshots, they can be removed completely (including files) by running
-'aptly db cleanup'.
+'aptly db cleanup'. Held packages are not removed unless -force-holds
+is specified.
 
 Example:
 
@@ -89,6 +97,7 @@ Example:
 	}
 
 	cmd.Flag.Bool("dry-run", false, "don't remove, just show what would be removed")
+	cmd.Flag.Bool("force-holds", false, "remove held packages")
 
 	return cmd
 }
@@ -13,7 +13,8 @@ func makeCmdRepoSearch() *commander.Command {
 		Long: `
 Command search displays list of packages in local repository that match package query
 
-If query is not specified, all the packages are displayed.
+If query is not specified, all the packages are displayed. With -explain
+flag, query plan and number of packages examined are displayed as well.
 
 Example:
 
@@ -24,6 +25,7 @@ Example:
 
 	cmd.Flag.Bool("with-deps", false, "include dependencies into search results")
 	cmd.Flag.String("format", "", "custom format for result printing")
+	cmd.Flag.Bool("explain", false, "show how query was parsed and executed")
 
 	return cmd
 }
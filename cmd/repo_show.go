@@ -48,7 +48,16 @@ func aptlyRepoShowTxt(_ *commander.Command, args []string) error {
 	if repo.Uploaders != nil {
 		fmt.Printf("Uploaders: %s\n", repo.Uploaders)
 	}
+	if repo.VersionPolicy != deb.VersionPolicyNone {
+		fmt.Printf("Version Policy: %s\n", repo.VersionPolicy)
+	}
+	if repo.Retention != nil {
+		fmt.Printf("Retention Policy: %s\n", repo.Retention)
+	}
 	fmt.Printf("Number of packages: %d\n", repo.NumPackages())
+	if len(repo.Holds) > 0 {
+		fmt.Printf("Number of held packages: %d\n", len(repo.Holds))
+	}
 
 	withPackages := context.Flags().Lookup("with-packages").Value.Get().(bool)
 	if withPackages {
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/smira/commander"
+)
+
+func makeCmdRepoUnhold() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlyRepoHoldUnhold,
+		UsageLine: "unhold <name> <package-query> ...",
+		Short:     "remove holds from packages in local repository",
+		Long: `
+Command unhold removes holds from packages matching <package-query> in
+local repository <name>.
+
+Example:
+
+  $ aptly repo unhold testing 'myapp (=0.1.12)'
+`,
+	}
+
+	return cmd
+}
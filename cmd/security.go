@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/smira/commander"
+)
+
+func makeCmdSecurity() *commander.Command {
+	return &commander.Command{
+		UsageLine: "security",
+		Short:     "manage security tracker data",
+		Subcommands: []*commander.Command{
+			makeCmdSecurityImport(),
+			makeCmdSecurityList(),
+			makeCmdSecurityDrop(),
+		},
+	}
+}
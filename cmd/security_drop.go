@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/smira/commander"
+)
+
+func aptlySecurityDrop(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 1 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	collection := context.NewCollectionFactory().SecurityTrackerCollection()
+	tracker, err := collection.ByName(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to drop: %s", err)
+	}
+
+	err = collection.Drop(tracker)
+	if err != nil {
+		return fmt.Errorf("unable to drop: %s", err)
+	}
+
+	fmt.Printf("Security tracker `%s` has been removed.\n", tracker.Name)
+
+	return err
+}
+
+func makeCmdSecurityDrop() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlySecurityDrop,
+		UsageLine: "drop <name>",
+		Short:     "delete security tracker",
+		Long: `
+Command drop deletes information about imported security tracker.
+
+Example:
+
+  $ aptly security drop debian-bookworm
+`,
+	}
+
+	return cmd
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlySecurityImport(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 2 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	name, filename := args[0], args[1]
+
+	tracker := deb.NewSecurityTracker(name, context.Flags().Lookup("format").Value.String(),
+		context.Flags().Lookup("release").Value.String())
+
+	var input io.ReadCloser
+	if filename == "-" {
+		input = os.Stdin
+	} else {
+		input, err = os.Open(filename)
+		if err != nil {
+			return fmt.Errorf("unable to import: %s", err)
+		}
+		defer input.Close()
+	}
+
+	context.Progress().Printf("Importing security tracker data...\n")
+
+	err = tracker.Parse(input)
+	if err != nil {
+		return fmt.Errorf("unable to import: %s", err)
+	}
+
+	err = context.NewCollectionFactory().SecurityTrackerCollection().Update(tracker)
+	if err != nil {
+		return fmt.Errorf("unable to save: %s", err)
+	}
+
+	fmt.Printf("\nSecurity tracker %s successfully imported, %d package vulnerabilities.\n", tracker.Name, tracker.NumVulnerabilities())
+
+	return err
+}
+
+func makeCmdSecurityImport() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlySecurityImport,
+		UsageLine: "import <name> <file>",
+		Short:     "import security tracker data",
+		Long: `
+Command import loads known vulnerabilities from security tracker data <file>
+and saves them as security tracker <name>, replacing previously imported
+data with the same name. Use '-' as <file> to read from standard input.
+
+Supported formats are 'debian' (JSON of Debian security tracker, requires
+-release to select distribution) and 'oval' (OVAL definitions as published
+by Debian or Ubuntu for a single release).
+
+Security trackers are used to report vulnerable packages with 'aptly
+snapshot vulnerabilities'.
+
+Example:
+
+  $ curl -s https://security-tracker.debian.org/tracker/data/json | aptly security import -release=bookworm debian-bookworm -
+`,
+		Flag: *flag.NewFlagSet("aptly-security-import", flag.ExitOnError),
+	}
+
+	cmd.Flag.String("format", deb.SecurityFormatDebian, "format of security tracker data: debian or oval")
+	cmd.Flag.String("release", "", "distribution release to import data for (required for debian format)")
+
+	return cmd
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlySecurityList(cmd *commander.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	trackers := []*deb.SecurityTracker{}
+	err := context.NewCollectionFactory().SecurityTrackerCollection().ForEach(func(t *deb.SecurityTracker) error {
+		trackers = append(trackers, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if cmd.Flag.Lookup("json").Value.Get().(bool) {
+		output, e := json.MarshalIndent(trackers, "", "  ")
+		if e != nil {
+			return e
+		}
+		fmt.Println(string(output))
+		return nil
+	}
+
+	if cmd.Flag.Lookup("raw").Value.Get().(bool) {
+		for _, t := range trackers {
+			fmt.Printf("%s\n", t.Name)
+		}
+		return nil
+	}
+
+	if len(trackers) == 0 {
+		fmt.Printf("No security trackers found, import one with `aptly security import...`.\n")
+		return nil
+	}
+
+	fmt.Printf("List of security trackers:\n")
+	for _, t := range trackers {
+		fmt.Printf(" * %s, %d package vulnerabilities\n", t, t.NumVulnerabilities())
+	}
+
+	return nil
+}
+
+func makeCmdSecurityList() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlySecurityList,
+		UsageLine: "list",
+		Short:     "list security trackers",
+		Long: `
+Command list displays list of imported security trackers.
+
+Example:
+
+  $ aptly security list
+`,
+		Flag: *flag.NewFlagSet("aptly-security-list", flag.ExitOnError),
+	}
+
+	cmd.Flag.Bool("json", false, "display list in JSON format")
+	cmd.Flag.Bool("raw", false, "display list in machine-readable format")
+
+	return cmd
+}
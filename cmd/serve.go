@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	stdcontext "context"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/deb"
@@ -55,6 +59,16 @@ func aptlyServe(cmd *commander.Command, args []string) error {
 		}
 	}
 
+	tlsConfig, err := getTLSConfig(context.Flags())
+	if err != nil {
+		return fmt.Errorf("unable to serve: %s", err)
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
 	fmt.Printf("Serving published repositories, recommended apt sources list:\n\n")
 
 	sources := make(sort.StringSlice, 0, collectionFactory.PublishedRepoCollection().Len())
@@ -88,12 +102,12 @@ func aptlyServe(cmd *commander.Command, args []string) error {
 			prefix += "/"
 		}
 
-		fmt.Printf("# %s\ndeb http://%s:%s/%s %s %s\n",
-			repo, listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
+		fmt.Printf("# %s\ndeb %s://%s:%s/%s %s %s\n",
+			repo, scheme, listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
 
 		if utils.StrSliceHasItem(repo.Architectures, deb.ArchitectureSource) {
-			fmt.Printf("deb-src http://%s:%s/%s %s %s\n",
-				listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
+			fmt.Printf("deb-src %s://%s:%s/%s %s %s\n",
+				scheme, listenHost, listenPort, prefix, repo.Distribution, strings.Join(repo.Components(), " "))
 		}
 	}
 
@@ -102,13 +116,140 @@ func aptlyServe(cmd *commander.Command, args []string) error {
 
 	fmt.Printf("\nStarting web server at: %s (press Ctrl+C to quit)...\n", listen)
 
-	err = http.ListenAndServe(listen, http.FileServer(http.Dir(publicPath)))
+	var handler http.Handler = http.FileServer(http.Dir(publicPath))
+	if context.Config().EnableDownloadStats {
+		recorder := deb.NewDownloadStatsRecorder(downloadStatsInterval, recordDownloads)
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to record downloads: %s\n", err)
+			}
+		}()
+		handler = &downloadStatsHandler{handler: handler, recorder: recorder}
+	}
+	acls := context.Config().ServeAccessControl
+	if len(acls) > 0 {
+		handler = &accessControlHandler{handler: handler, acls: acls}
+	}
+
+	if context.Flags().Lookup("browse").Value.Get().(bool) {
+		browse := deb.NewBrowseHandler(publicPath, "/")
+
+		var browseHandler http.Handler = browse
+		if len(acls) > 0 {
+			browse.Filter = func(r *http.Request, d *deb.BrowsedDistribution) bool {
+				acl := acls.Match("", "/"+d.Path()+"/")
+				return acl == nil || acl.Allowed(r)
+			}
+			browseHandler = &accessControlHandler{handler: browseHandler, acls: acls}
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(browsePath, http.StripPrefix(strings.TrimSuffix(browsePath, "/"), browseHandler))
+		mux.Handle("/", handler)
+		handler = mux
+
+		fmt.Printf("\nBrowse published repositories at: %s://%s:%s%s\n", scheme, listenHost, listenPort, browsePath)
+	}
+
+	accessLog, err := utils.OpenAccessLog(context.Config().ServeAccessLog)
 	if err != nil {
 		return fmt.Errorf("unable to serve: %s", err)
 	}
+	if accessLog != nil {
+		defer accessLog.Close()
+		handler = accessLog.Handler(handler)
+	}
+
+	server := &http.Server{Addr: listen, Handler: handler, TLSConfig: tlsConfig}
+
+	// shut server down gracefully, so that pending download statistics are written
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigchan)
+	go func() {
+		if _, ok := <-sigchan; ok {
+			server.Shutdown(stdcontext.Background())
+		}
+	}()
+	defer close(sigchan)
+
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("unable to serve: %s", err)
+	}
 	return nil
 }
 
+// browsePath is URL path browse pages are served under
+const browsePath = "/_browse/"
+
+// accessControlHandler restricts access to published prefixes
+type accessControlHandler struct {
+	handler http.Handler
+	acls    utils.ServeAccessControl
+}
+
+func (h *accessControlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.acls.Authorize(w, r, "", r.URL.Path) {
+		h.handler.ServeHTTP(w, r)
+	}
+}
+
+// statusRecorder captures HTTP status of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// downloadStatsInterval is how often download statistics collected by serve are written
+const downloadStatsInterval = 10 * time.Second
+
+// recordDownloads writes batch of download statistics
+//
+// Database is opened only for the time of update, so that other aptly
+// commands could run while serving.
+func recordDownloads(downloads []*deb.PackageDownloads) error {
+	db, err := context.Database()
+	if err != nil {
+		return err
+	}
+	defer context.CloseDatabase()
+
+	_, err = deb.NewDownloadStatsCollection(db).RecordBatch(downloads)
+	return err
+}
+
+// downloadStatsHandler records download statistics for package files served
+//
+// Downloads are collected in memory and written by recorder in background.
+type downloadStatsHandler struct {
+	handler  http.Handler
+	recorder *deb.DownloadStatsRecorder
+}
+
+func (h *downloadStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || deb.NewPackageDownloadsFromPath(r.URL.Path) == nil {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	h.handler.ServeHTTP(recorder, r)
+
+	if recorder.status == http.StatusOK {
+		h.recorder.Record(r.URL.Path, time.Now())
+	}
+}
+
 func makeCmdServe() *commander.Command {
 	cmd := &commander.Command{
 		Run:       aptlyServe,
@@ -118,14 +259,34 @@ func makeCmdServe() *commander.Command {
 Command serve starts embedded HTTP server (not suitable for real production usage) to serve
 contents of public/ subdirectory of aptly's root that contains published repositories.
 
+HTTPS is enabled either with certificate and key files (reloaded automatically when
+they change, e.g. after renewal) or with certificates obtained via ACME (Let's Encrypt)
+for the list of domains.
+
+Access to published prefixes could be restricted with basic auth users or tokens
+configured in serveAccessControl section of the configuration.
+
+Requests could be logged in combined log format or as JSON, see serveAccessLog
+section of the configuration.
+
+With -browse, HTML pages listing published distributions and packages in them
+(with versions and descriptions) are served under /_browse/.
+
+If enableDownloadStats is set in the configuration, downloads of package files are
+recorded and could be queried with the API (/api/downloads/top, /api/downloads/stale).
+
 Example:
 
   $ aptly serve -listen=:8080
+  $ aptly serve -listen=:8443 -tls-cert=/etc/ssl/aptly.pem -tls-key=/etc/ssl/aptly.key
+  $ aptly serve -listen=:8080 -browse
 `,
 		Flag: *flag.NewFlagSet("aptly-serve", flag.ExitOnError),
 	}
 
 	cmd.Flag.String("listen", ":8080", "host:port for HTTP listening")
+	cmd.Flag.Bool("browse", false, "serve HTML pages for browsing published repositories under /_browse/")
+	addTLSFlags(&cmd.Flag)
 
 	return cmd
 }
@@ -13,9 +13,13 @@ func makeCmdSnapshot() *commander.Command {
 			makeCmdSnapshotList(),
 			makeCmdSnapshotShow(),
 			makeCmdSnapshotVerify(),
+			makeCmdSnapshotMultiArchCheck(),
+			makeCmdSnapshotLicenses(),
+			makeCmdSnapshotVulnerabilities(),
 			makeCmdSnapshotPull(),
 			makeCmdSnapshotDiff(),
 			makeCmdSnapshotMerge(),
+			makeCmdSnapshotRebase(),
 			makeCmdSnapshotDrop(),
 			makeCmdSnapshotRename(),
 			makeCmdSnapshotSearch(),
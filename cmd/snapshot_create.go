@@ -5,6 +5,7 @@ import (
 
 	"github.com/aptly-dev/aptly/deb"
 	"github.com/smira/commander"
+	"github.com/smira/flag"
 )
 
 func aptlySnapshotCreate(cmd *commander.Command, args []string) error {
@@ -71,11 +72,28 @@ func aptlySnapshotCreate(cmd *commander.Command, args []string) error {
 		return commander.ErrCommandError
 	}
 
+	extraSourceOnly := context.Flags().Lookup("extra-source-only").Value.String()
+	orphanedSources := context.Flags().Lookup("orphaned-sources").Value.String()
+	if extraSourceOnly != "" || orphanedSources != "" {
+		var dropped []*deb.Package
+
+		dropped, err = snapshot.FilterSources(collectionFactory.PackageCollection(), extraSourceOnly, orphanedSources)
+		if err != nil {
+			return fmt.Errorf("unable to create snapshot: %s", err)
+		}
+
+		for _, p := range dropped {
+			context.Progress().ColoredPrintf("@r[-]@| %s dropped", p)
+		}
+	}
+
 	err = collectionFactory.SnapshotCollection().Add(snapshot)
 	if err != nil {
 		return fmt.Errorf("unable to add snapshot: %s", err)
 	}
 
+	context.SnapshotCreated(snapshot, context.Progress())
+
 	fmt.Printf("\nSnapshot %s successfully created.\nYou can run 'aptly publish snapshot %s' to publish snapshot as Debian repository.\n", snapshot.Name, snapshot.Name)
 
 	return err
@@ -99,12 +117,21 @@ Command create <name> empty creates empty snapshot that could be used as a
 basis for snapshot pull operations, for example. As snapshots are immutable,
 creating one empty snapshot should be enough.
 
+Flags -extra-source-only and -orphaned-sources control handling of source
+packages marked with Extra-Source-Only: yes and source packages without
+binary packages built from them: keep (default), drop, or keep-referenced-only
+(keep only if referenced by binary packages, including via Built-Using).
+
 Example:
 
   $ aptly snapshot create wheezy-main-today from mirror wheezy-main
 `,
+		Flag: *flag.NewFlagSet("aptly-snapshot-create", flag.ExitOnError),
 	}
 
+	cmd.Flag.String("extra-source-only", "", "handling of Extra-Source-Only source packages: keep, drop or keep-referenced-only")
+	cmd.Flag.String("orphaned-sources", "", "handling of source packages without binaries: keep, drop or keep-referenced-only")
+
 	return cmd
 
 }
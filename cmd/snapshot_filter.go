@@ -66,14 +66,25 @@ func aptlySnapshotFilter(cmd *commander.Command, args []string) error {
 		}
 	}
 
+	// Load additional providers to resolve dependencies against
+	providers, providerSnapshots, err := deb.LoadDependencyProviders(collectionFactory, context.Flags().Lookup("provider").Value.Get().([]string), context.Progress())
+	if err != nil {
+		return fmt.Errorf("unable to filter: %s", err)
+	}
+	providers = append([]deb.DependencyProvider{{Name: source.Name, List: packageList}}, providers...)
+
 	// Filter with dependencies as requested
-	result, err := packageList.FilterWithProgress(queries, withDeps, nil, context.DependencyOptions(), architecturesList, context.Progress())
+	result, resolutions, err := packageList.FilterWithProviders(queries, withDeps, nil, providers, context.DependencyOptions(), architecturesList, context.Progress())
 	if err != nil {
 		return fmt.Errorf("unable to filter: %s", err)
 	}
 
+	if len(providers) > 1 {
+		printDependencyResolutions(resolutions)
+	}
+
 	// Create <destination> snapshot
-	destination := deb.NewSnapshotFromPackageList(args[1], []*deb.Snapshot{source}, result,
+	destination := deb.NewSnapshotFromPackageList(args[1], append([]*deb.Snapshot{source}, providerSnapshots...), result,
 		fmt.Sprintf("Filtered '%s', query was: '%s'", source.Name, strings.Join(args[2:], " ")))
 
 	err = collectionFactory.SnapshotCollection().Add(destination)
@@ -81,6 +92,8 @@ func aptlySnapshotFilter(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to create snapshot: %s", err)
 	}
 
+	context.SnapshotCreated(destination, context.Progress())
+
 	context.Progress().Printf("\nSnapshot %s successfully filtered.\nYou can run 'aptly publish snapshot %s' to publish snapshot as Debian repository.\n", destination.Name, destination.Name)
 
 	return err
@@ -96,14 +109,23 @@ Command filter does filtering in snapshot <source>, producing another
 snapshot <destination>. Packages could be specified simply
 as 'package-name' or as package queries.
 
+With -with-deps, dependencies are looked up in <source> first and then
+in providers specified with -provider (in order). Provider could be
+specified as 'snapshot:<name>', 'mirror:<name>' or 'repo:<name>', plain
+name refers to snapshot. Provider which satisfied each dependency
+is reported.
+
 Example:
 
     $ aptly snapshot filter wheezy-main wheezy-required 'Priority (required)'
+
+    $ aptly snapshot filter -with-deps -provider=wheezy-main myapp-snap myapp-minimal myapp
 `,
 		Flag: *flag.NewFlagSet("aptly-snapshot-filter", flag.ExitOnError),
 	}
 
 	cmd.Flag.Bool("with-deps", false, "include dependent packages as well")
+	cmd.Flag.Var(&providersFlag{}, "provider", "snapshot, mirror or repo to resolve dependencies against (could be specified multiple times)")
 
 	return cmd
 }
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlySnapshotLicenses(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 1 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	snapshot, err := collectionFactory.SnapshotCollection().ByName(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to show licenses: %s", err)
+	}
+
+	err = collectionFactory.SnapshotCollection().LoadComplete(snapshot)
+	if err != nil {
+		return fmt.Errorf("unable to show licenses: %s", err)
+	}
+
+	return printLicenseReport(snapshot.RefList(), collectionFactory)
+}
+
+// printLicenseReport prints licenses of packages and number of packages per license
+func printLicenseReport(reflist *deb.PackageRefList, collectionFactory *deb.CollectionFactory) error {
+	report, err := deb.NewLicenseReport(reflist, collectionFactory.PackageCollection(), context.PackagePool(),
+		context.Flags().Lookup("license").Value.String(), context.Progress())
+	if err != nil {
+		return fmt.Errorf("unable to show licenses: %s", err)
+	}
+
+	if len(report) == 0 {
+		fmt.Printf("No packages found.\n")
+		return nil
+	}
+
+	for _, item := range report {
+		fmt.Printf("%s: %s\n", item.Package, strings.Join(item.Licenses, ", "))
+	}
+
+	summary := deb.LicenseSummary(report)
+	licenses := make([]string, 0, len(summary))
+	for license := range summary {
+		licenses = append(licenses, license)
+	}
+	sort.Strings(licenses)
+
+	fmt.Printf("\nLicenses:\n")
+	for _, license := range licenses {
+		fmt.Printf("  %s: %d\n", license, summary[license])
+	}
+
+	return nil
+}
+
+func makeCmdSnapshotLicenses() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlySnapshotLicenses,
+		UsageLine: "licenses <name>",
+		Short:     "show licenses of packages in snapshot",
+		Long: `
+Command licenses shows licenses of binary packages in snapshot <name>
+followed by number of packages per license. Licenses are detected in
+usr/share/doc/*/copyright files of the packages: machine-readable (DEP-5)
+copyright files are parsed for License fields, for other files references
+to /usr/share/common-licenses are detected. Packages without detectable
+license are reported as 'unknown'.
+
+Licenses are detected when package is imported into local repository
+or on first use, and cached in the database.
+
+Example:
+
+    $ aptly snapshot licenses -license=GPL-3+ wheezy-main
+`,
+		Flag: *flag.NewFlagSet("aptly-snapshot-licenses", flag.ExitOnError),
+	}
+
+	cmd.Flag.String("license", "", "show only packages with specified license")
+
+	return cmd
+}
@@ -62,6 +62,8 @@ func aptlySnapshotMerge(cmd *commander.Command, args []string) error {
 		return fmt.Errorf("unable to create snapshot: %s", err)
 	}
 
+	context.SnapshotCreated(destination, context.Progress())
+
 	fmt.Printf("\nSnapshot %s successfully created.\nYou can run 'aptly publish snapshot %s' to publish snapshot as Debian repository.\n", destination.Name, destination.Name)
 
 	return err
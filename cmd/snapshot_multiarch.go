@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+)
+
+func aptlySnapshotMultiArchCheck(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 1 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	snapshot, err := collectionFactory.SnapshotCollection().ByName(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	err = collectionFactory.SnapshotCollection().LoadComplete(snapshot)
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	return printMultiArchReport(snapshot.RefList(), collectionFactory)
+}
+
+// printMultiArchReport runs Multi-Arch consistency check and prints found problems
+func printMultiArchReport(reflist *deb.PackageRefList, collectionFactory *deb.CollectionFactory) error {
+	context.Progress().Printf("Checking Multi-Arch consistency...\n")
+
+	problems, err := deb.NewMultiArchReport(reflist, collectionFactory.PackageCollection())
+	if err != nil {
+		return fmt.Errorf("unable to check Multi-Arch consistency: %s", err)
+	}
+
+	if len(problems) == 0 {
+		context.Progress().Printf("No Multi-Arch problems found.\n")
+		return nil
+	}
+
+	context.Progress().Printf("Multi-Arch problems (%d):\n", len(problems))
+	for _, problem := range problems {
+		context.Progress().Printf("  %s\n", problem)
+		for _, p := range problem.Packages {
+			context.Progress().Printf("    %s\n", p)
+		}
+	}
+
+	return fmt.Errorf("found %d Multi-Arch problem(s)", len(problems))
+}
+
+func makeCmdSnapshotMultiArchCheck() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlySnapshotMultiArchCheck,
+		UsageLine: "multiarch-check <name>",
+		Short:     "check Multi-Arch consistency of snapshot",
+		Long: `
+Command multiarch-check analyzes packages in snapshot <name> for Multi-Arch
+violations: Multi-Arch: same packages which have different versions across
+architectures, packages with the same name, version and architecture but
+different checksums, and invalid Multi-Arch values. Publishing such
+package sets breaks apt on multi-arch enabled systems.
+
+Command exits with error if any problem is found.
+
+Example:
+
+    $ aptly snapshot multiarch-check wheezy-main
+`,
+	}
+
+	return cmd
+}
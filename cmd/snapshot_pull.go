@@ -96,13 +96,24 @@ func aptlySnapshotPull(cmd *commander.Command, args []string) error {
 		queries[i] = &deb.AndQuery{L: queries[i], R: archQuery}
 	}
 
+	// Load additional providers to resolve dependencies against
+	providers, providerSnapshots, err := deb.LoadDependencyProviders(collectionFactory, context.Flags().Lookup("provider").Value.Get().([]string), context.Progress())
+	if err != nil {
+		return fmt.Errorf("unable to pull: %s", err)
+	}
+	providers = append([]deb.DependencyProvider{{Name: source.Name, List: sourcePackageList}}, providers...)
+
 	// Filter with dependencies as requested
-	result, err := sourcePackageList.FilterWithProgress(queries, !noDeps, packageList, context.DependencyOptions(), architecturesList, context.Progress())
+	result, resolutions, err := sourcePackageList.FilterWithProviders(queries, !noDeps, packageList, providers, context.DependencyOptions(), architecturesList, context.Progress())
 	if err != nil {
 		return fmt.Errorf("unable to pull: %s", err)
 	}
 	result.PrepareIndex()
 
+	if len(providers) > 1 {
+		printDependencyResolutions(resolutions)
+	}
+
 	alreadySeen := map[string]bool{}
 
 	result.ForEachIndexed(func(pkg *deb.Package) error {
@@ -135,7 +146,7 @@ func aptlySnapshotPull(cmd *commander.Command, args []string) error {
 		context.Progress().Printf("\nNot creating snapshot, as dry run was requested.\n")
 	} else {
 		// Create <destination> snapshot
-		destination := deb.NewSnapshotFromPackageList(args[2], []*deb.Snapshot{snapshot, source}, packageList,
+		destination := deb.NewSnapshotFromPackageList(args[2], append([]*deb.Snapshot{snapshot, source}, providerSnapshots...), packageList,
 			fmt.Sprintf("Pulled into '%s' with '%s' as source, pull request was: '%s'", snapshot.Name, source.Name, strings.Join(args[3:], " ")))
 
 		err = collectionFactory.SnapshotCollection().Add(destination)
@@ -143,6 +154,8 @@ func aptlySnapshotPull(cmd *commander.Command, args []string) error {
 			return fmt.Errorf("unable to create snapshot: %s", err)
 		}
 
+		context.SnapshotCreated(destination, context.Progress())
+
 		context.Progress().Printf("\nSnapshot %s successfully created.\nYou can run 'aptly publish snapshot %s' to publish snapshot as Debian repository.\n", destination.Name, destination.Name)
 	}
 	return err
@@ -160,6 +173,11 @@ versions from <source> following dependencies. New snapshot <destination>
 is created as a result of this process. Packages could be specified simply
 as 'package-name' or as package queries.
 
+Dependencies are looked up in <source> first and then in providers
+specified with -provider (in order). Provider could be specified as
+'snapshot:<name>', 'mirror:<name>' or 'repo:<name>', plain name refers
+to snapshot. Provider which satisfied each dependency is reported.
+
 Example:
 
     $ aptly snapshot pull wheezy-main wheezy-backports wheezy-new-xorg xorg-server-server
@@ -171,6 +189,7 @@ Example:
 	cmd.Flag.Bool("no-deps", false, "don't process dependencies, just pull listed packages")
 	cmd.Flag.Bool("no-remove", false, "don't remove other package versions when pulling package")
 	cmd.Flag.Bool("all-matches", false, "pull all the packages that satisfy the dependency version requirements")
+	cmd.Flag.Var(&providersFlag{}, "provider", "snapshot, mirror or repo to resolve dependencies against (could be specified multiple times)")
 
 	return cmd
 }
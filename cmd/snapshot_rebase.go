@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlySnapshotRebase(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 4 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	dryRun := context.Flags().Lookup("dry-run").Value.Get().(bool)
+	preferBase := context.Flags().Lookup("prefer-base").Value.Get().(bool)
+
+	collectionFactory := context.NewCollectionFactory()
+
+	snapshots := make([]*deb.Snapshot, 3)
+	for i, name := range args[:3] {
+		snapshots[i], err = collectionFactory.SnapshotCollection().ByName(name)
+		if err != nil {
+			return fmt.Errorf("unable to rebase: %s", err)
+		}
+
+		err = collectionFactory.SnapshotCollection().LoadComplete(snapshots[i])
+		if err != nil {
+			return fmt.Errorf("unable to rebase: %s", err)
+		}
+	}
+
+	snapshot, base, newBase := snapshots[0], snapshots[1], snapshots[2]
+
+	context.Progress().Printf("Rebasing snapshot %s from %s onto %s...\n", snapshot.Name, base.Name, newBase.Name)
+
+	result, applied, conflicts, err := deb.Rebase(snapshot.RefList(), base.RefList(), newBase.RefList(),
+		collectionFactory.PackageCollection(), preferBase, context.Progress())
+	if err != nil {
+		return fmt.Errorf("unable to rebase: %s", err)
+	}
+
+	for _, change := range applied {
+		switch {
+		case change.Left == nil:
+			context.Progress().ColoredPrintf("@g[+]@| %s added", change.Right)
+		case change.Right == nil:
+			context.Progress().ColoredPrintf("@r[-]@| %s removed", change.Left)
+		default:
+			context.Progress().ColoredPrintf("@y[!]@| %s replaced with %s", change.Left, change.Right)
+		}
+	}
+
+	for _, conflict := range conflicts {
+		context.Progress().ColoredPrintf("@r[C]@| @!%s@|", conflict)
+	}
+
+	resolution := "re-applied"
+	if preferBase {
+		resolution = "kept as in new base"
+	}
+	context.Progress().Printf("\n%d changes re-applied, %d conflicts (%s).\n", len(applied), len(conflicts), resolution)
+
+	if dryRun {
+		context.Progress().Printf("\nNot creating snapshot, as dry run was requested.\n")
+		return nil
+	}
+
+	destination := deb.NewSnapshotFromRefList(args[3], []*deb.Snapshot{newBase, snapshot}, result,
+		fmt.Sprintf("Rebased '%s' from '%s' onto '%s'", snapshot.Name, base.Name, newBase.Name))
+
+	err = collectionFactory.SnapshotCollection().Add(destination)
+	if err != nil {
+		return fmt.Errorf("unable to create snapshot: %s", err)
+	}
+
+	context.SnapshotCreated(destination, context.Progress())
+
+	context.Progress().Printf("\nSnapshot %s successfully created.\nYou can run 'aptly publish snapshot %s' to publish snapshot as Debian repository.\n", destination.Name, destination.Name)
+
+	return err
+}
+
+func makeCmdSnapshotRebase() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlySnapshotRebase,
+		UsageLine: "rebase <name> <base> <new-base> <destination>",
+		Short:     "recreate derived snapshot on top of newer base",
+		Long: `
+Command rebase re-applies changes which distinguish snapshot <name> from
+snapshot <base> it was derived from (packages added, removed or replaced)
+on top of snapshot <new-base>, e.g. newer snapshot of the same mirror. Result
+is saved as new snapshot <destination>.
+
+Change is a conflict if <new-base> changed the same package (name and
+architecture) compared to <base>. Conflicts are reported, and by default
+change from <name> wins (packages with the same name and architecture in
+<new-base> are replaced). With flag -prefer-base, <new-base> wins instead.
+
+Example:
+
+    $ aptly snapshot rebase wheezy-curated wheezy-main-2024-01 wheezy-main-2024-02 wheezy-curated-2024-02
+`,
+		Flag: *flag.NewFlagSet("aptly-snapshot-rebase", flag.ExitOnError),
+	}
+
+	cmd.Flag.Bool("dry-run", false, "don't create destination snapshot, just show what would be changed")
+	cmd.Flag.Bool("prefer-base", false, "resolve conflicts by keeping packages from new base")
+
+	return cmd
+}
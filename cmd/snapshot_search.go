@@ -103,12 +103,23 @@ func aptlySnapshotMirrorRepoSearch(cmd *commander.Command, args []string) error
 		}
 	}
 
+	var explain *deb.QueryExplain
+	if context.Flags().Lookup("explain").Value.Get().(bool) {
+		explain = deb.NewQueryExplain(q)
+		q = explain.PackageQuery()
+	}
+
 	result, err := list.FilterWithProgress([]deb.PackageQuery{q}, withDeps,
 		nil, context.DependencyOptions(), architecturesList, context.Progress())
 	if err != nil {
 		return fmt.Errorf("unable to search: %s", err)
 	}
 
+	if explain != nil {
+		explain.Finish(result.Len())
+		PrintQueryExplain(explain)
+	}
+
 	if result.Len() == 0 {
 		return fmt.Errorf("no results")
 	}
@@ -127,7 +138,8 @@ func makeCmdSnapshotSearch() *commander.Command {
 		Long: `
 Command search displays list of packages in snapshot that match package query
 
-If query is not specified, all the packages are displayed.
+If query is not specified, all the packages are displayed. With -explain
+flag, query plan and number of packages examined are displayed as well.
 
 Example:
 
@@ -138,6 +150,7 @@ Example:
 
 	cmd.Flag.Bool("with-deps", false, "include dependencies into search results")
 	cmd.Flag.String("format", "", "custom format for result printing")
+	cmd.Flag.Bool("explain", false, "show how query was parsed and executed")
 
 	return cmd
 }
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/smira/commander"
+	"github.com/smira/flag"
+)
+
+func aptlySnapshotVulnerabilities(cmd *commander.Command, args []string) error {
+	var err error
+	if len(args) != 1 {
+		cmd.Usage()
+		return commander.ErrCommandError
+	}
+
+	trackerName := context.Flags().Lookup("tracker").Value.String()
+	if trackerName == "" {
+		return fmt.Errorf("unable to check: security tracker should be specified with -tracker")
+	}
+
+	collectionFactory := context.NewCollectionFactory()
+	snapshot, err := collectionFactory.SnapshotCollection().ByName(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	err = collectionFactory.SnapshotCollection().LoadComplete(snapshot)
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	tracker, err := collectionFactory.SecurityTrackerCollection().ByName(trackerName)
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	report, err := deb.NewSecurityReport([]*deb.PackageRefList{snapshot.RefList()}, collectionFactory.PackageCollection(), tracker)
+	if err != nil {
+		return fmt.Errorf("unable to check: %s", err)
+	}
+
+	if len(report) == 0 {
+		fmt.Printf("No known vulnerabilities found.\n")
+		return nil
+	}
+
+	for _, item := range report {
+		fmt.Printf("%s:\n", item.Package)
+		for _, v := range item.Vulnerabilities {
+			fixed := "not fixed"
+			if v.FixedVersion != "" {
+				fixed = "fixed in " + v.FixedVersion
+			}
+			if v.Urgency != "" {
+				fmt.Printf("  %s (%s, %s)\n", v.ID, v.Urgency, fixed)
+			} else {
+				fmt.Printf("  %s (%s)\n", v.ID, fixed)
+			}
+		}
+	}
+
+	return fmt.Errorf("found %d vulnerable package(s)", len(report))
+}
+
+func makeCmdSnapshotVulnerabilities() *commander.Command {
+	cmd := &commander.Command{
+		Run:       aptlySnapshotVulnerabilities,
+		UsageLine: "vulnerabilities -tracker=<tracker> <name>",
+		Short:     "report known vulnerabilities of packages in snapshot",
+		Long: `
+Command vulnerabilities lists packages in snapshot <name> affected by
+vulnerabilities known to security tracker imported with 'aptly security
+import'. Vulnerabilities are matched against exact package versions by
+source package name and binary package name.
+
+Command exits with error if any vulnerable package is found.
+
+Example:
+
+    $ aptly snapshot vulnerabilities -tracker=debian-bookworm bookworm-main
+`,
+		Flag: *flag.NewFlagSet("aptly-snapshot-vulnerabilities", flag.ExitOnError),
+	}
+
+	cmd.Flag.String("tracker", "", "name of security tracker")
+
+	return cmd
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/smira/flag"
+)
+
+// templateFlags maps settings of resource template to command flags for kind of resource
+// being created: "mirror", "repo" or "publish"
+func templateFlags(template *utils.ResourceTemplate, kind string) map[string][]string {
+	result := map[string][]string{}
+
+	setString := func(name, value string) {
+		if value != "" {
+			result[name] = []string{value}
+		}
+	}
+
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			result[name] = []string{strconv.FormatBool(*value)}
+		}
+	}
+
+	switch kind {
+	case "mirror":
+		setString("architectures", strings.Join(template.Architectures, ","))
+		setString("filter", template.Filter)
+		setBool("filter-with-deps", template.FilterWithDeps)
+		setBool("with-sources", template.WithSources)
+		setBool("with-udebs", template.WithUdebs)
+		if len(template.VerifyKeyrings) > 0 {
+			result["keyring"] = template.VerifyKeyrings
+		}
+	case "repo":
+		setString("distribution", template.Distribution)
+		setString("component", template.Component)
+		setString("version-policy", template.VersionPolicy)
+	case "publish":
+		setString("architectures", strings.Join(template.Architectures, ","))
+		setString("origin", template.Origin)
+		setString("label", template.Label)
+		setBool("skip-contents", template.SkipContents)
+		setBool("skip-bz2", template.SkipBz2)
+		setBool("enable-zst", template.EnableZst)
+		setBool("acquire-by-hash", template.AcquireByHash)
+		setBool("multi-dist", template.MultiDist)
+		setBool("skip-signing", template.SkipSigning)
+		setString("gpg-key", template.GpgKey)
+		setString("keyring", template.Keyring)
+		setString("secret-keyring", template.SecretKeyring)
+		setString("passphrase-file", template.PassphraseFile)
+	}
+
+	return result
+}
+
+// applyTemplate sets flags which were not specified on command line from
+// resource template selected with -template flag
+func applyTemplate(flags *flag.FlagSet, kind string) error {
+	name := flags.Lookup("template").Value.String()
+	if name == "" {
+		return nil
+	}
+
+	template, err := context.Config().GetTemplate(name)
+	if err != nil {
+		return err
+	}
+
+	for flagName, values := range templateFlags(template, kind) {
+		if flags.Lookup(flagName) == nil || flags.IsSet(flagName) {
+			continue
+		}
+
+		for _, value := range values {
+			if err = flags.Set(flagName, value); err != nil {
+				return fmt.Errorf("unable to apply template %s: %s", name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/smira/flag"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func addTLSFlags(flags *flag.FlagSet) {
+	flags.String("tls-cert", "", "path to TLS certificate file (PEM), enables HTTPS; certificate is reloaded when file changes")
+	flags.String("tls-key", "", "path to TLS private key file (PEM)")
+	flags.String("acme-domains", "", "comma-separated list of domains to obtain certificates for via ACME (Let's Encrypt), enables HTTPS")
+	flags.String("acme-email", "", "contact email for ACME account")
+	flags.String("acme-cache", "", "directory to cache ACME certificates in (default: acme/ subdirectory of aptly's root)")
+}
+
+// getTLSConfig builds TLS configuration from flags, returns nil if HTTPS is not enabled
+func getTLSConfig(flags *flag.FlagSet) (*tls.Config, error) {
+	certFile := flags.Lookup("tls-cert").Value.String()
+	keyFile := flags.Lookup("tls-key").Value.String()
+	acmeDomains := flags.Lookup("acme-domains").Value.String()
+
+	if acmeDomains != "" {
+		if certFile != "" || keyFile != "" {
+			return nil, fmt.Errorf("-acme-domains can't be used together with -tls-cert/-tls-key")
+		}
+
+		cacheDir := flags.Lookup("acme-cache").Value.String()
+		if cacheDir == "" {
+			cacheDir = filepath.Join(context.Config().GetRootDir(), "acme")
+		}
+
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(acmeDomains, ",")...),
+			Cache:      autocert.DirCache(cacheDir),
+			Email:      flags.Lookup("acme-email").Value.String(),
+		}
+
+		return manager.TLSConfig(), nil
+	}
+
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("both -tls-cert and -tls-key should be specified")
+	}
+
+	reloader, err := utils.NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader.TLSConfig(), nil
+}
@@ -1,6 +1,7 @@
 package console
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -139,6 +140,11 @@ func (p *Progress) PrintfStdErr(msg string, a ...interface{}) {
 	p.queue <- printTask{code: codePrintStdErr, message: fmt.Sprintf(msg, a...)}
 }
 
+// Context is never cancelled, as console operations are interrupted by signals
+func (p *Progress) Context() context.Context {
+	return context.Background()
+}
+
 // ColoredPrintf does printf in colored way + newline
 func (p *Progress) ColoredPrintf(msg string, a ...interface{}) {
 	if RunningOnTerminal() {
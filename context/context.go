@@ -3,6 +3,7 @@ package context
 
 import (
 	gocontext "context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -11,25 +12,36 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/azure"
+	"github.com/aptly-dev/aptly/b2"
+	"github.com/aptly-dev/aptly/cdn"
 	"github.com/aptly-dev/aptly/console"
 	"github.com/aptly-dev/aptly/database"
 	"github.com/aptly-dev/aptly/database/etcddb"
 	"github.com/aptly-dev/aptly/database/goleveldb"
 	"github.com/aptly-dev/aptly/deb"
 	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/gs"
 	"github.com/aptly-dev/aptly/http"
+	"github.com/aptly-dev/aptly/notify"
+	"github.com/aptly-dev/aptly/oci"
 	"github.com/aptly-dev/aptly/pgp"
+	"github.com/aptly-dev/aptly/replication"
+	"github.com/aptly-dev/aptly/rsync"
 	"github.com/aptly-dev/aptly/s3"
 	"github.com/aptly-dev/aptly/swift"
 	"github.com/aptly-dev/aptly/task"
 	"github.com/aptly-dev/aptly/utils"
+	"github.com/rs/zerolog/log"
 	"github.com/smira/commander"
 	"github.com/smira/flag"
 )
@@ -41,17 +53,24 @@ type AptlyContext struct {
 	gocontext.Context
 
 	flags, globalFlags *flag.FlagSet
-	configLoaded       bool
+	// currentConfig is loaded configuration, it is replaced as a whole on reload
+	// and never modified afterwards, so it could be read without holding the lock
+	currentConfig atomic.Pointer[utils.ConfigStructure]
+	// configFile is location of loaded configuration file
+	configFile string
 
 	progress          aptly.Progress
 	downloader        aptly.Downloader
 	taskList          *task.List
+	events            *notify.Bus
+	notifications     *notify.Dispatcher
 	database          database.Storage
 	packagePool       aptly.PackagePool
 	publishedStorages map[string]aptly.PublishedStorage
 	dependencyOptions int
 	architecturesList []string
 	structuredLogging bool
+	instanceID        string
 	// Debug features
 	fileCPUProfile *os.File
 	fileMemProfile *os.File
@@ -59,7 +78,11 @@ type AptlyContext struct {
 }
 
 // Check interface
-var _ aptly.PublishedStorageProvider = &AptlyContext{}
+var (
+	_ aptly.PublishedStorageProvider   = &AptlyContext{}
+	_ aptly.PublishNotifier            = &AptlyContext{}
+	_ aptly.PublishConcurrencyProvider = &AptlyContext{}
+)
 
 // FatalError is type for panicking to abort execution with non-zero
 // exit code and print meaningful explanation
@@ -78,7 +101,14 @@ func Fatal(err error) {
 }
 
 // Config loads and returns current configuration
+//
+// Returned configuration is not changed by reloads, so callers should call Config
+// again to pick up new settings.
 func (context *AptlyContext) Config() *utils.ConfigStructure {
+	if config := context.currentConfig.Load(); config != nil {
+		return config
+	}
+
 	context.Lock()
 	defer context.Unlock()
 
@@ -86,7 +116,7 @@ func (context *AptlyContext) Config() *utils.ConfigStructure {
 }
 
 func (context *AptlyContext) config() *utils.ConfigStructure {
-	if !context.configLoaded {
+	if context.currentConfig.Load() == nil {
 		var err error
 
 		configLocation := context.globalFlags.Lookup("config").Value.String()
@@ -96,6 +126,7 @@ func (context *AptlyContext) config() *utils.ConfigStructure {
 			if err != nil {
 				Fatal(err)
 			}
+			context.configFile = configLocation
 		} else {
 			homeLocation := filepath.Join(os.Getenv("HOME"), ".aptly.conf")
 			configLocations := []string{homeLocation, "/usr/local/etc/aptly.conf", "/etc/aptly.conf"}
@@ -106,6 +137,7 @@ func (context *AptlyContext) config() *utils.ConfigStructure {
 					continue
 				}
 				if err == nil {
+					context.configFile = configLocation
 					break
 				}
 				if !os.IsNotExist(err) {
@@ -119,13 +151,79 @@ func (context *AptlyContext) config() *utils.ConfigStructure {
 				// as this is fresh aptly installation, we don't need to support legacy pool locations
 				utils.Config.SkipLegacyPool = true
 				utils.SaveConfig(configLocations[0], &utils.Config)
+				context.configFile = configLocations[0]
 			}
 		}
 
-		context.configLoaded = true
+		if name := context.configContext(); name != "" {
+			if err = utils.Config.ApplyContext(name); err != nil {
+				Fatal(err)
+			}
+		}
+
+		if err = utils.Config.ValidateFeatures(); err != nil {
+			Fatal(err)
+		}
+
+		context.currentConfig.Store(&utils.Config)
+	}
+
+	return context.currentConfig.Load()
+}
 
+// configContext returns name of configuration context selected with -context flag
+func (context *AptlyContext) configContext() string {
+	flag := context.globalFlags.Lookup("context")
+	if flag == nil {
+		return ""
 	}
-	return &utils.Config
+
+	return flag.Value.String()
+}
+
+// ReloadConfig reloads configuration file, applying settings which could be changed
+// without restart, and returns list of changed settings which were not applied
+//
+// New settings are used for downloaders and published storages created afterwards,
+// running tasks keep using current ones.
+func (context *AptlyContext) ReloadConfig() ([]string, error) {
+	context.Lock()
+	defer context.Unlock()
+
+	config, ignored, err := utils.ReloadConfig(context.configFile, context.configContext(), context.config())
+	if err != nil {
+		return nil, err
+	}
+
+	context.currentConfig.Store(config)
+
+	context.downloader = nil
+	context.publishedStorages = map[string]aptly.PublishedStorage{}
+
+	return ignored, nil
+}
+
+// UpdateConfig changes runtime settings (see utils.RuntimeSettings) and persists
+// them to configuration file
+func (context *AptlyContext) UpdateConfig(settings map[string]json.RawMessage) error {
+	context.Lock()
+	defer context.Unlock()
+
+	config := context.config()
+
+	updated := *config
+	if err := utils.ValidateRuntimeSettings(&updated, settings); err != nil {
+		return err
+	}
+
+	if err := utils.UpdateConfigFile(context.configFile, context.configContext(), settings); err != nil {
+		return fmt.Errorf("unable to update config file: %s", err)
+	}
+
+	context.currentConfig.Store(&updated)
+	context.downloader = nil
+
+	return nil
 }
 
 // LookupOption checks boolean flag with default (usually config) and command-line
@@ -263,10 +361,46 @@ func (context *AptlyContext) TaskList() *task.List {
 
 	if context.taskList == nil {
 		context.taskList = task.NewList()
+		context.taskList.SetCompletionHandler(context.taskCompleted)
 	}
 	return context.taskList
 }
 
+// Events returns bus broadcasting all the events to live subscribers
+func (context *AptlyContext) Events() *notify.Bus {
+	context.Lock()
+	defer context.Unlock()
+
+	if context.events == nil {
+		context.events = notify.NewBus()
+	}
+	return context.events
+}
+
+// notificationDispatcher returns dispatcher delivering events to notifiers in background
+func (context *AptlyContext) notificationDispatcher() *notify.Dispatcher {
+	context.Lock()
+	defer context.Unlock()
+
+	if context.notifications == nil {
+		context.notifications = notify.NewDispatcher(notify.DefaultQueueSize)
+	}
+	return context.notifications
+}
+
+// taskCompleted sends notifications about finished task
+func (context *AptlyContext) taskCompleted(t task.Task, err error) {
+	fields := map[string]string{"task": fmt.Sprintf("%d", t.ID)}
+
+	if err != nil {
+		context.Notify(notify.NewEvent(utils.NotifyEventTaskFailed, utils.NotifySeverityError,
+			fmt.Sprintf("Task %d \"%s\" failed", t.ID, t.Name), err.Error(), fields), nil)
+	} else {
+		context.Notify(notify.NewEvent(utils.NotifyEventTaskSucceeded, utils.NotifySeverityInfo,
+			fmt.Sprintf("Task %d \"%s\" succeeded", t.ID, t.Name), "", fields), nil)
+	}
+}
+
 // DBPath builds path to database
 func (context *AptlyContext) DBPath() string {
 	context.Lock()
@@ -306,6 +440,10 @@ func (context *AptlyContext) _database() (database.Storage, error) {
 		if err != nil {
 			return nil, fmt.Errorf("can't instantiate database: %s", err)
 		}
+
+		if context.config().Replication.Role == utils.ReplicationRolePrimary {
+			context.database = replication.NewJournal(context.database, context.config().Replication.JournalSize)
+		}
 	}
 
 	var tries int
@@ -424,7 +562,8 @@ func (context *AptlyContext) GetPublishedStorage(name string) aptly.PublishedSto
 				params.AccessKeyID, params.SecretAccessKey, params.SessionToken,
 				params.Region, params.Endpoint, params.Bucket, params.ACL, params.Prefix, params.StorageClass,
 				params.EncryptionMethod, params.PlusWorkaround, params.DisableMultiDel,
-				params.ForceSigV2, params.ForceVirtualHostedStyle, params.Debug)
+				params.ForceSigV2, params.ForceVirtualHostedStyle, params.Debug, params.GenerateIndexPages,
+				params.PathClasses)
 			if err != nil {
 				Fatal(err)
 			}
@@ -452,6 +591,63 @@ func (context *AptlyContext) GetPublishedStorage(name string) aptly.PublishedSto
 			if err != nil {
 				Fatal(err)
 			}
+		} else if strings.HasPrefix(name, "oci:") {
+			params, ok := context.config().OCIPublishRoots[name[4:]]
+			if !ok {
+				Fatal(fmt.Errorf("published OCI storage %v not configured", name[4:]))
+			}
+
+			var err error
+			publishedStorage, err = oci.NewPublishedStorage(params.Registry, params.Repository,
+				params.Username, params.Password, params.PlainHTTP, params.Prefixes)
+			if err != nil {
+				Fatal(err)
+			}
+		} else if strings.HasPrefix(name, "rsync:") {
+			params, ok := context.config().RsyncPublishRoots[name[6:]]
+			if !ok {
+				Fatal(fmt.Errorf("published rsync storage %v not configured", name[6:]))
+			}
+
+			stagingDir := params.StagingDir
+			if stagingDir == "" {
+				stagingDir = filepath.Join(context.config().GetRootDir(), "rsync", name[6:])
+			}
+
+			var err error
+			publishedStorage, err = rsync.NewPublishedStorage(stagingDir, params.LinkMethod,
+				params.Host, params.Path, params.SSHCommand, params.RsyncOptions)
+			if err != nil {
+				Fatal(err)
+			}
+		} else if strings.HasPrefix(name, "b2:") {
+			if !context.config().FeatureEnabled(utils.FeatureB2Publishing) {
+				Fatal(fmt.Errorf("publishing to B2 is experimental, enable it with %s feature flag", utils.FeatureB2Publishing))
+			}
+
+			params, ok := context.config().B2PublishRoots[name[3:]]
+			if !ok {
+				Fatal(fmt.Errorf("published B2 storage %v not configured", name[3:]))
+			}
+
+			var err error
+			publishedStorage, err = b2.NewPublishedStorage(params.ApplicationKeyID, params.ApplicationKey,
+				params.Bucket, params.Prefix)
+			if err != nil {
+				Fatal(err)
+			}
+		} else if strings.HasPrefix(name, "gs:") {
+			params, ok := context.config().GCSPublishRoots[name[3:]]
+			if !ok {
+				Fatal(fmt.Errorf("published GCS storage %v not configured", name[3:]))
+			}
+
+			var err error
+			publishedStorage, err = gs.NewPublishedStorage(params.Bucket, params.Prefix, params.ACL,
+				params.CredentialsFile, params.Endpoint)
+			if err != nil {
+				Fatal(err)
+			}
 		} else {
 			Fatal(fmt.Errorf("unknown published storage format: %v", name))
 		}
@@ -461,11 +657,226 @@ func (context *AptlyContext) GetPublishedStorage(name string) aptly.PublishedSto
 	return publishedStorage
 }
 
+// PublishConcurrency returns number of files uploaded concurrently to published storage
+//
+// Files are linked to local filesystem (also staging directory of rsync storage) sequentially.
+func (context *AptlyContext) PublishConcurrency(storage string) int {
+	if storage == "" || strings.HasPrefix(storage, "filesystem:") || strings.HasPrefix(storage, "rsync:") {
+		return 1
+	}
+
+	return context.Config().PublishConcurrency
+}
+
+// PublishIndexConcurrency returns number of workers generating indexes concurrently
+func (context *AptlyContext) PublishIndexConcurrency() int {
+	if concurrency := context.Config().PublishIndexConcurrency; concurrency > 0 {
+		return concurrency
+	}
+
+	return runtime.NumCPU()
+}
+
+// PublishComplete invalidates CDN caches configured for published storage
+// and sends notifications after distribution was published
+//
+// Invalidation failures are reported as warnings, as publishing itself has succeeded.
+func (context *AptlyContext) PublishComplete(storage, prefix, distribution string, progress aptly.Progress) {
+	context.invalidateCDN(storage, prefix, distribution, progress)
+
+	title := fmt.Sprintf("Published %s/%s", prefix, distribution)
+	if storage != "" {
+		title = fmt.Sprintf("Published %s:%s/%s", storage, prefix, distribution)
+	}
+
+	context.Notify(notify.NewEvent(utils.NotifyEventPublishComplete, utils.NotifySeverityInfo, title, "",
+		map[string]string{"storage": storage, "prefix": prefix, "distribution": distribution}), progress)
+}
+
+// invalidateCDN invalidates CDN cache for published distribution
+func (context *AptlyContext) invalidateCDN(storage, prefix, distribution string, progress aptly.Progress) {
+	config, ok := context.Config().CDNInvalidation[storage]
+	if !ok {
+		return
+	}
+
+	if prefix == "." {
+		prefix = ""
+	}
+	dir := filepath.Join(prefix, "dists", distribution)
+
+	files, err := context.GetPublishedStorage(storage).Filelist(dir)
+	if err == nil {
+		for i := range files {
+			files[i] = filepath.Join(dir, files[i])
+		}
+
+		if progress != nil {
+			progress.Printf("Invalidating CDN cache (%s) for %s...\n", config.Type, dir)
+		}
+
+		err = cdn.Invalidate(&config, dir, files)
+	}
+
+	if err != nil && progress != nil {
+		progress.ColoredPrintf("@y[!]@| @!CDN cache invalidation failed: @| %s", err)
+	}
+}
+
+// Notify broadcasts event to live subscribers and queues it for all the configured notifiers
+// interested in it
+//
+// Notifications are delivered in background, delivery failures are logged. If too many
+// notifications are pending, event is dropped, which is reported as warning (or logged,
+// if progress is nil).
+func (context *AptlyContext) Notify(event *notify.Event, progress aptly.Progress) {
+	context.Events().Publish(event)
+
+	notifiers := context.Config().Notifiers
+	if len(notifiers) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(notifiers))
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dispatcher := context.notificationDispatcher()
+
+	for _, name := range names {
+		notifier := notifiers[name]
+		if !notifier.Matches(event.Type, event.Severity) {
+			continue
+		}
+
+		if !dispatcher.Dispatch(name, notifier, event) {
+			if progress != nil {
+				progress.ColoredPrintf("@y[!]@| @!Notification (%s) dropped: @| too many pending notifications", name)
+			} else {
+				log.Warn().Msgf("notification (%s) dropped: too many pending notifications", name)
+			}
+		}
+	}
+}
+
+// MirrorUpdated sends notification about mirror update and another one if mirror update
+// brought security updates, previous is the list of packages in the mirror before update
+func (context *AptlyContext) MirrorUpdated(repo *deb.RemoteRepo, previous *deb.PackageRefList,
+	collectionFactory *deb.CollectionFactory, progress aptly.Progress) {
+	context.Notify(notify.NewEvent(utils.NotifyEventMirrorUpdated, utils.NotifySeverityInfo,
+		fmt.Sprintf("Mirror %s updated", repo.Name), "",
+		map[string]string{"mirror": repo.Name, "packages": strconv.Itoa(repo.NumPackages())}), progress)
+
+	if len(context.Config().Notifiers) == 0 {
+		return
+	}
+
+	trackers := []*deb.SecurityTracker{}
+	err := collectionFactory.SecurityTrackerCollection().ForEach(func(tracker *deb.SecurityTracker) error {
+		trackers = append(trackers, tracker)
+		return nil
+	})
+
+	var updates []string
+	if err == nil {
+		updates, err = deb.SecurityUpdates(repo, previous, collectionFactory.PackageCollection(), trackers)
+	}
+
+	if err != nil {
+		if progress != nil {
+			progress.ColoredPrintf("@y[!]@| @!Unable to find security updates: @| %s", err)
+		}
+		return
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+
+	context.Notify(notify.NewEvent(utils.NotifyEventMirrorSecurity, utils.NotifySeverityWarning,
+		fmt.Sprintf("Mirror %s: %d security update(s)", repo.Name, len(updates)), strings.Join(updates, "\n"),
+		map[string]string{"mirror": repo.Name}), progress)
+}
+
+// MirrorUpdateFailed sends notification about failed mirror update
+func (context *AptlyContext) MirrorUpdateFailed(name string, err error, progress aptly.Progress) {
+	context.Notify(notify.NewEvent(utils.NotifyEventMirrorUpdateFailed, utils.NotifySeverityError,
+		fmt.Sprintf("Mirror %s update failed", name), err.Error(), map[string]string{"mirror": name}), progress)
+}
+
+// PublishChanged sends notification about published repository being created, updated
+// (or switched) or dropped
+func (context *AptlyContext) PublishChanged(eventType string, published *deb.PublishedRepo, progress aptly.Progress) {
+	action := map[string]string{
+		utils.NotifyEventPublishCreated: "created",
+		utils.NotifyEventPublishUpdated: "updated",
+		utils.NotifyEventPublishDropped: "dropped",
+	}[eventType]
+
+	fields := map[string]string{
+		"storage":      published.Storage,
+		"prefix":       published.Prefix,
+		"distribution": published.Distribution,
+		"sourceKind":   published.SourceKind,
+	}
+	if eventType != utils.NotifyEventPublishDropped {
+		// sources are not loaded for dropped published repository
+		fields["sources"] = strings.Join(published.SourceNames(), " ")
+	}
+
+	context.Notify(notify.NewEvent(eventType, utils.NotifySeverityInfo,
+		fmt.Sprintf("Published repository %s/%s %s", published.StoragePrefix(), published.Distribution, action), "",
+		fields), progress)
+}
+
+// SnapshotCreated sends notification about new snapshot
+func (context *AptlyContext) SnapshotCreated(snapshot *deb.Snapshot, progress aptly.Progress) {
+	context.Notify(notify.NewEvent(utils.NotifyEventSnapshotCreated, utils.NotifySeverityInfo,
+		fmt.Sprintf("Snapshot %s created", snapshot.Name), snapshot.Description,
+		map[string]string{"snapshot": snapshot.Name, "sourceKind": snapshot.SourceKind,
+			"packages": strconv.Itoa(snapshot.NumPackages())}), progress)
+}
+
+// PackagesUploaded sends notification about package files uploaded to upload directory
+func (context *AptlyContext) PackagesUploaded(dir string, files []string) {
+	context.Notify(notify.NewEvent(utils.NotifyEventPackagesUploaded, utils.NotifySeverityInfo,
+		fmt.Sprintf("%d file(s) uploaded to %s", len(files), dir), strings.Join(files, "\n"),
+		map[string]string{"dir": dir}), nil)
+}
+
+// PackagesAdded sends notification about package files added to local repo
+func (context *AptlyContext) PackagesAdded(repo *deb.LocalRepo, files []string, progress aptly.Progress) {
+	if len(files) == 0 {
+		return
+	}
+
+	names := make([]string, len(files))
+	for i := range files {
+		names[i] = filepath.Base(files[i])
+	}
+
+	context.Notify(notify.NewEvent(utils.NotifyEventPackagesUploaded, utils.NotifySeverityInfo,
+		fmt.Sprintf("%d file(s) added to repo %s", len(files), repo.Name), strings.Join(names, "\n"),
+		map[string]string{"repo": repo.Name}), progress)
+}
+
+// KeyringsPath builds path to keyrings with pinned keys of mirrors
+func (context *AptlyContext) KeyringsPath() string {
+	return filepath.Join(context.Config().GetRootDir(), "keyrings")
+}
+
 // UploadPath builds path to upload storage
 func (context *AptlyContext) UploadPath() string {
 	return filepath.Join(context.Config().GetRootDir(), "upload")
 }
 
+// IncomingPath builds path to incoming queue of uploads waiting for review
+func (context *AptlyContext) IncomingPath() string {
+	return filepath.Join(context.Config().GetRootDir(), "incoming")
+}
+
 func (context *AptlyContext) pgpProvider() string {
 	var provider string
 
@@ -513,6 +924,37 @@ func (context *AptlyContext) GetSigner() pgp.Signer {
 	return pgp.NewGpgSigner(context.getGPGFinder())
 }
 
+// GetSignerForBackend returns Signer for signing backend, empty backend selects
+// default backend from configuration
+func (context *AptlyContext) GetSignerForBackend(backend string) (pgp.Signer, error) {
+	config := context.Config().Signing
+	if backend == "" {
+		backend = config.Backend
+	}
+
+	switch backend {
+	case "", utils.SigningBackendGpg:
+		return context.GetSigner(), nil
+	case utils.SigningBackendVault:
+		vault, err := pgp.NewVaultTransit(config.Vault.Address, config.Vault.Token, config.Vault.TokenFile,
+			config.Vault.Mount, config.Vault.Key)
+		if err != nil {
+			return nil, err
+		}
+		return pgp.NewRemoteSigner("vault", vault, config.Vault.Keyring), nil
+	case utils.SigningBackendAWSKMS:
+		kms, err := pgp.NewAWSKMS(config.AWSKMS.Region, config.AWSKMS.Endpoint, config.AWSKMS.Key)
+		if err != nil {
+			return nil, err
+		}
+		return pgp.NewRemoteSigner("awskms", kms, config.AWSKMS.Keyring), nil
+	case utils.SigningBackendExternalCmd:
+		return pgp.NewExternalSigner(config.ExternalCommand), nil
+	}
+
+	return nil, fmt.Errorf("unknown signing backend: %s", backend)
+}
+
 // GetVerifier returns Verifier with respect to provider
 func (context *AptlyContext) GetVerifier() pgp.Verifier {
 	context.Lock()
@@ -605,6 +1047,11 @@ func (context *AptlyContext) Shutdown() {
 	if context.taskList != nil {
 		context.taskList.Stop()
 	}
+	if context.notifications != nil {
+		// pending notifications are delivered before exit
+		context.notifications.Close()
+		context.notifications = nil
+	}
 	if context.database != nil {
 		context.database.Close()
 		context.database = nil
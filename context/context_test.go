@@ -1,9 +1,14 @@
 package context
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
 	"github.com/smira/flag"
 
 	. "gopkg.in/check.v1"
@@ -84,3 +89,141 @@ func (s *AptlyContextSuite) TestGetPublishedStorageBadFS(c *C) {
 		FatalErrorPanicMatches,
 		&FatalError{ReturnCode: 1, Message: "published local storage fuji not configured"})
 }
+
+func (s *AptlyContextSuite) TestCheckPublishedStorage(c *C) {
+	root := c.MkDir()
+
+	config := s.context.Config()
+	fsRoots, b2Roots, features := config.FileSystemPublishRoots, config.B2PublishRoots, config.Features
+	defer func() {
+		config.FileSystemPublishRoots, config.B2PublishRoots, config.Features = fsRoots, b2Roots, features
+	}()
+
+	s.context.Config().FileSystemPublishRoots = map[string]utils.FileSystemPublishRoot{
+		"test": {RootDir: root}, "another": {RootDir: root}}
+	s.context.Config().B2PublishRoots = map[string]utils.B2PublishRoot{"test": {}}
+
+	c.Check(s.context.PublishedStorageNames(), DeepEquals, []string{"filesystem:another", "filesystem:test", "b2:test"})
+
+	c.Check(s.context.CheckPublishedStorage("filesystem:test"), IsNil)
+	c.Check(s.context.CheckPublishedStorage("filesystem:fuji"), ErrorMatches, "published local storage fuji not configured")
+	c.Check(s.context.CheckPublishedStorage("b2:test"), ErrorMatches, "publishing to B2 is experimental, enable it with b2Publishing feature flag")
+
+	config.Features = map[string]bool{utils.FeatureB2Publishing: true}
+	c.Check(s.context.CheckPublishedStorage("b2:test"), ErrorMatches, "B2 bucket not specified")
+
+	// probe files are cleaned up
+	entries, err := os.ReadDir(root)
+	c.Check(err, IsNil)
+	c.Check(entries, HasLen, 0)
+}
+
+func (s *AptlyContextSuite) TestReloadConfig(c *C) {
+	configFile := filepath.Join(c.MkDir(), "aptly.conf")
+	c.Assert(os.WriteFile(configFile, []byte(`{"rootDir": "/tmp/aptly-reload", "skipLegacyPool": false}`), 0644), IsNil)
+
+	flags := flag.NewFlagSet("fakeFlags", flag.ContinueOnError)
+	flags.String("config", configFile, "")
+	context, err := NewContext(flags)
+	c.Assert(err, IsNil)
+
+	config := context.Config()
+	saved := *config
+	defer func() {
+		*config = saved
+	}()
+
+	c.Assert(os.WriteFile(configFile, []byte(`{"rootDir": "/tmp/aptly-other", "skipLegacyPool": false,
+		"FileSystemPublishEndpoints": {"test": {"rootDir": "/tmp/aptly-public"}}}`), 0644), IsNil)
+
+	ignored, err := context.ReloadConfig()
+	c.Check(err, IsNil)
+	c.Check(ignored, DeepEquals, []string{"rootDir"})
+	c.Check(context.Config().GetRootDir(), Equals, "/tmp/aptly-reload")
+	c.Check(context.GetPublishedStorage("filesystem:test").(aptly.FileSystemPublishedStorage).PublicPath(), Equals, "/tmp/aptly-public")
+}
+
+func (s *AptlyContextSuite) TestReloadConfigConcurrentReads(c *C) {
+	configFile := filepath.Join(c.MkDir(), "aptly.conf")
+	c.Assert(os.WriteFile(configFile, []byte(`{"rootDir": "/tmp/aptly-reload", "skipLegacyPool": false}`), 0644), IsNil)
+
+	flags := flag.NewFlagSet("fakeFlags", flag.ContinueOnError)
+	flags.String("config", configFile, "")
+	context, err := NewContext(flags)
+	c.Assert(err, IsNil)
+
+	config := context.Config()
+	saved := *config
+	defer func() {
+		*config = saved
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = context.Config().DownloadConcurrency
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		c.Assert(os.WriteFile(configFile, []byte(fmt.Sprintf(`{"rootDir": "/tmp/aptly-reload", "skipLegacyPool": false,
+			"downloadConcurrency": %d}`, i+1)), 0644), IsNil)
+		_, err = context.ReloadConfig()
+		c.Assert(err, IsNil)
+	}
+	<-done
+
+	c.Check(context.Config().DownloadConcurrency, Equals, 10)
+	// configuration handed out before reload is not modified
+	c.Check(config.DownloadConcurrency, Equals, saved.DownloadConcurrency)
+}
+
+func (s *AptlyContextSuite) TestConfigContext(c *C) {
+	configFile := filepath.Join(c.MkDir(), "aptly.conf")
+	c.Assert(os.WriteFile(configFile, []byte(`{"rootDir": "/tmp/aptly-production", "skipLegacyPool": false,
+		"contexts": {"staging": {"rootDir": "/tmp/aptly-staging"}}}`), 0644), IsNil)
+
+	saved := utils.Config
+	defer func() {
+		utils.Config = saved
+	}()
+
+	flags := flag.NewFlagSet("fakeFlags", flag.ContinueOnError)
+	flags.String("config", configFile, "")
+	flags.String("context", "staging", "")
+	context, err := NewContext(flags)
+	c.Assert(err, IsNil)
+
+	c.Check(context.Config().GetRootDir(), Equals, "/tmp/aptly-staging")
+
+	ignored, err := context.ReloadConfig()
+	c.Check(err, IsNil)
+	c.Check(ignored, DeepEquals, []string{})
+	c.Check(context.Config().GetRootDir(), Equals, "/tmp/aptly-staging")
+}
+
+func (s *AptlyContextSuite) TestInstanceID(c *C) {
+	root := c.MkDir()
+
+	config := s.context.Config()
+	rootDir := config.RootDir
+	defer func() {
+		config.RootDir = rootDir
+	}()
+	config.RootDir = filepath.Join(root, "aptly")
+
+	id, err := s.context.InstanceID()
+	c.Assert(err, IsNil)
+	c.Check(id, Matches, "[0-9a-f-]{36}")
+
+	contents, err := os.ReadFile(filepath.Join(root, "aptly", "instance-id"))
+	c.Assert(err, IsNil)
+	c.Check(string(contents), Equals, id+"\n")
+
+	// ID is preserved on restart
+	s.context.instanceID = ""
+	again, err := s.context.InstanceID()
+	c.Assert(err, IsNil)
+	c.Check(again, Equals, id)
+}
@@ -0,0 +1,143 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+)
+
+// healthPrefix is directory in published storage for health check probe files
+const healthPrefix = ".aptly-health"
+
+// PublishedStorageNames returns names of all configured published storages
+func (context *AptlyContext) PublishedStorageNames() []string {
+	context.Lock()
+	defer context.Unlock()
+
+	config := context.config()
+	result := []string{}
+
+	add := func(kind string, names []string) {
+		sort.Strings(names)
+		for _, name := range names {
+			result = append(result, kind+":"+name)
+		}
+	}
+
+	names := []string{}
+	for name := range config.FileSystemPublishRoots {
+		names = append(names, name)
+	}
+	add("filesystem", names)
+
+	names = []string{}
+	for name := range config.S3PublishRoots {
+		names = append(names, name)
+	}
+	add("s3", names)
+
+	names = []string{}
+	for name := range config.SwiftPublishRoots {
+		names = append(names, name)
+	}
+	add("swift", names)
+
+	names = []string{}
+	for name := range config.AzurePublishRoots {
+		names = append(names, name)
+	}
+	add("azure", names)
+
+	names = []string{}
+	for name := range config.OCIPublishRoots {
+		names = append(names, name)
+	}
+	add("oci", names)
+
+	names = []string{}
+	for name := range config.RsyncPublishRoots {
+		names = append(names, name)
+	}
+	add("rsync", names)
+
+	names = []string{}
+	for name := range config.B2PublishRoots {
+		names = append(names, name)
+	}
+	add("b2", names)
+
+	names = []string{}
+	for name := range config.GCSPublishRoots {
+		names = append(names, name)
+	}
+	add("gs", names)
+
+	return result
+}
+
+// CheckPublishedStorage verifies that published storage is accessible and writable
+func (context *AptlyContext) CheckPublishedStorage(name string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fatal, ok := r.(*FatalError)
+			if !ok {
+				panic(r)
+			}
+			err = errors.New(fatal.Message)
+		}
+	}()
+
+	return checkPublishedStorage(context.GetPublishedStorage(name))
+}
+
+// checkPublishedStorage writes, checks and removes probe file, unless storage
+// implements its own health check
+func checkPublishedStorage(storage aptly.PublishedStorage) error {
+	if checked, ok := storage.(aptly.HealthCheckedPublishedStorage); ok {
+		return checked.HealthCheck()
+	}
+
+	tempDir, err := os.MkdirTemp("", "aptly-health")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempFile := filepath.Join(tempDir, "probe")
+	if err = os.WriteFile(tempFile, []byte("aptly health check\n"), 0644); err != nil {
+		return err
+	}
+
+	probe := filepath.Join(healthPrefix, fmt.Sprintf("probe-%d-%d", os.Getpid(), time.Now().UnixNano()))
+
+	if err = storage.MkDir(healthPrefix); err != nil {
+		return fmt.Errorf("unable to create %s: %s", healthPrefix, err)
+	}
+
+	if err = storage.PutFile(probe, tempFile); err != nil {
+		return fmt.Errorf("unable to write probe file: %s", err)
+	}
+
+	exists, err := storage.FileExists(probe)
+	if err != nil {
+		return fmt.Errorf("unable to check probe file: %s", err)
+	}
+	if !exists {
+		return fmt.Errorf("probe file %s not found after upload", probe)
+	}
+
+	if err = storage.Remove(probe); err != nil {
+		return fmt.Errorf("unable to remove probe file: %s", err)
+	}
+
+	if err = storage.RemoveDirs(healthPrefix, nil); err != nil {
+		return fmt.Errorf("unable to remove %s: %s", healthPrefix, err)
+	}
+
+	return nil
+}
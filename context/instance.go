@@ -0,0 +1,50 @@
+package context
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pborman/uuid"
+)
+
+// instanceIDFile is name of file in root directory holding instance ID
+const instanceIDFile = "instance-id"
+
+// InstanceID returns stable ID of aptly instance
+//
+// ID is generated on first call and stored in root directory, so it persists across
+// restarts and upgrades.
+func (context *AptlyContext) InstanceID() (string, error) {
+	context.Lock()
+	defer context.Unlock()
+
+	if context.instanceID != "" {
+		return context.instanceID, nil
+	}
+
+	rootDir := context.config().GetRootDir()
+	path := filepath.Join(rootDir, instanceIDFile)
+
+	contents, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	id := strings.TrimSpace(string(contents))
+	if id == "" {
+		id = uuid.New()
+
+		if err = os.MkdirAll(rootDir, 0777); err != nil {
+			return "", err
+		}
+
+		if err = os.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	context.instanceID = id
+
+	return id, nil
+}
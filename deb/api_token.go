@@ -0,0 +1,192 @@
+package deb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/ugorji/go/codec"
+)
+
+// APIToken is API token managed with /api/tokens, only SHA256 hash of the token is stored
+type APIToken struct {
+	// Name of the token
+	Name string
+	// Scope: read-only, repo-admin, publish-admin or admin
+	Scope string
+	// Published prefixes token is allowed to modify, all prefixes if empty
+	Prefixes []string
+	// SHA256 hash of the token
+	Hash string
+	// Time token was created
+	CreatedAt time.Time
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIToken generates new random API token, returning token itself along with
+// its stored representation
+func NewAPIToken(name, scope string, prefixes []string) (*APIToken, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+
+	if err := utils.ValidateAPIScope(scope); err != nil {
+		return nil, "", err
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	token := hex.EncodeToString(random)
+
+	return &APIToken{
+		Name:      name,
+		Scope:     scope,
+		Prefixes:  prefixes,
+		Hash:      hashAPIToken(token),
+		CreatedAt: time.Now(),
+	}, token, nil
+}
+
+// Matches checks whether token matches stored hash
+func (t *APIToken) Matches(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hashAPIToken(token))) == 1
+}
+
+// String interface
+func (t *APIToken) String() string {
+	return fmt.Sprintf("[%s]: %s", t.Name, t.Scope)
+}
+
+// Encode does msgpack encoding of APIToken
+func (t *APIToken) Encode() []byte {
+	var buf bytes.Buffer
+
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	encoder.Encode(t)
+
+	return buf.Bytes()
+}
+
+// Decode decodes msgpack representation into APIToken
+func (t *APIToken) Decode(input []byte) error {
+	decoder := codec.NewDecoderBytes(input, &codec.MsgpackHandle{})
+	return decoder.Decode(t)
+}
+
+// Key is a unique id in DB
+func (t *APIToken) Key() []byte {
+	return []byte("T" + t.Name)
+}
+
+// APITokenCollection does listing, adding and deleting of APITokens
+type APITokenCollection struct {
+	db database.Storage
+}
+
+// NewAPITokenCollection creates new APITokenCollection and binds it to database
+func NewAPITokenCollection(db database.Storage) *APITokenCollection {
+	return &APITokenCollection{
+		db: db,
+	}
+}
+
+// Add appends new token to collection and saves it
+func (collection *APITokenCollection) Add(token *APIToken) error {
+	_, err := collection.db.Get(token.Key())
+	if err == nil {
+		return fmt.Errorf("token with name %s already exists", token.Name)
+	}
+	if err != database.ErrNotFound {
+		return err
+	}
+
+	return collection.db.Put(token.Key(), token.Encode())
+}
+
+// ByName looks up token by name
+func (collection *APITokenCollection) ByName(name string) (*APIToken, error) {
+	token := &APIToken{Name: name}
+
+	encoded, err := collection.db.Get(token.Key())
+	if err == database.ErrNotFound {
+		return nil, fmt.Errorf("token with name %s not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = token.Decode(encoded); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// ByToken looks up stored token matching token presented by client
+func (collection *APITokenCollection) ByToken(value string) (*APIToken, error) {
+	var result *APIToken
+
+	err := collection.ForEach(func(t *APIToken) error {
+		if result == nil && t.Matches(value) {
+			result = t
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, database.ErrNotFound
+	}
+
+	return result, nil
+}
+
+// ForEach runs method for each token, sorted by name
+func (collection *APITokenCollection) ForEach(handler func(*APIToken) error) error {
+	tokens := []*APIToken{}
+
+	err := collection.db.ProcessByPrefix([]byte("T"), func(_, blob []byte) error {
+		t := &APIToken{}
+		if err := t.Decode(blob); err != nil {
+			log.Printf("Error decoding API token: %s\n", err)
+			return nil
+		}
+
+		tokens = append(tokens, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+
+	for _, t := range tokens {
+		if err = handler(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Drop removes token from DB
+func (collection *APITokenCollection) Drop(token *APIToken) error {
+	return collection.db.Delete(token.Key())
+}
@@ -0,0 +1,76 @@
+package deb
+
+import (
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+type APITokenSuite struct {
+	db         database.Storage
+	collection *APITokenCollection
+}
+
+var _ = Suite(&APITokenSuite{})
+
+func (s *APITokenSuite) SetUpTest(c *C) {
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.collection = NewAPITokenCollection(s.db)
+}
+
+func (s *APITokenSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *APITokenSuite) TestNewAPIToken(c *C) {
+	_, _, err := NewAPIToken("", "admin", nil)
+	c.Check(err, ErrorMatches, "token name is required")
+
+	_, _, err = NewAPIToken("ci", "superuser", nil)
+	c.Check(err, ErrorMatches, `unknown scope "superuser", should be one of: .*`)
+
+	token, secret, err := NewAPIToken("ci", "publish-admin", []string{"ppa"})
+	c.Assert(err, IsNil)
+	c.Check(secret, HasLen, 64)
+	c.Check(token.Hash, Not(Equals), secret)
+	c.Check(token.Matches(secret), Equals, true)
+	c.Check(token.Matches(token.Hash), Equals, false)
+	c.Check(token.String(), Equals, "[ci]: publish-admin")
+}
+
+func (s *APITokenSuite) TestCollection(c *C) {
+	ci, ciSecret, _ := NewAPIToken("ci", "publish-admin", []string{"ppa"})
+	ro, roSecret, _ := NewAPIToken("dashboard", "read-only", nil)
+
+	c.Assert(s.collection.Add(ci), IsNil)
+	c.Assert(s.collection.Add(ro), IsNil)
+	c.Check(s.collection.Add(ci), ErrorMatches, "token with name ci already exists")
+
+	token, err := s.collection.ByName("ci")
+	c.Assert(err, IsNil)
+	c.Check(token.Prefixes, DeepEquals, []string{"ppa"})
+	c.Check(token.CreatedAt.Equal(ci.CreatedAt), Equals, true)
+
+	token, err = s.collection.ByToken(roSecret)
+	c.Assert(err, IsNil)
+	c.Check(token.Name, Equals, "dashboard")
+
+	token, err = s.collection.ByToken(ciSecret)
+	c.Assert(err, IsNil)
+	c.Check(token.Name, Equals, "ci")
+
+	_, err = s.collection.ByToken("wrong")
+	c.Check(err, Equals, database.ErrNotFound)
+
+	var names []string
+	c.Assert(s.collection.ForEach(func(t *APIToken) error {
+		names = append(names, t.Name)
+		return nil
+	}), IsNil)
+	c.Check(names, DeepEquals, []string{"ci", "dashboard"})
+
+	c.Assert(s.collection.Drop(ci), IsNil)
+	_, err = s.collection.ByName("ci")
+	c.Check(err, ErrorMatches, "token with name ci not found")
+}
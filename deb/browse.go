@@ -0,0 +1,338 @@
+package deb
+
+import (
+	"compress/gzip"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// BrowsedDistribution is published distribution found in public directory
+type BrowsedDistribution struct {
+	// Prefix and distribution, as in the URL
+	Prefix       string
+	Distribution string
+	// Release file contents
+	Release Stanza
+}
+
+// Path returns path to distribution directory (dists/<distribution>) relative to public directory
+func (d *BrowsedDistribution) Path() string {
+	return path.Join(d.Prefix, "dists", d.Distribution)
+}
+
+// Components returns components listed in Release file
+func (d *BrowsedDistribution) Components() []string {
+	return strings.Fields(d.Release["Components"])
+}
+
+// Architectures returns architectures listed in Release file
+func (d *BrowsedDistribution) Architectures() []string {
+	return strings.Fields(d.Release["Architectures"])
+}
+
+// BrowseHandler serves human-friendly HTML pages for published repositories in public directory:
+// list of published distributions, distribution overview and package tables per component
+// and architecture
+//
+// Pages are built from published Release and Packages/Sources files, so no database access
+// is required.
+type BrowseHandler struct {
+	root     string
+	filesURL string
+	// Filter hides distributions from the list, if set
+	Filter func(r *http.Request, d *BrowsedDistribution) bool
+}
+
+// NewBrowseHandler creates handler browsing published repositories under root,
+// filesURL is URL path under which contents of root is served (used for package links)
+func NewBrowseHandler(root, filesURL string) *BrowseHandler {
+	return &BrowseHandler{root: root, filesURL: strings.TrimSuffix(filesURL, "/") + "/"}
+}
+
+// Distributions finds all published distributions (directories with Release files)
+func (h *BrowseHandler) Distributions() ([]*BrowsedDistribution, error) {
+	result := []*BrowsedDistribution{}
+
+	err := filepath.WalkDir(h.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if entry.Name() == "pool" {
+			return fs.SkipDir
+		}
+
+		if entry.Name() != "dists" {
+			return nil
+		}
+
+		prefix, _ := filepath.Rel(h.root, filepath.Dir(p))
+
+		err = filepath.WalkDir(p, func(dp string, dentry fs.DirEntry, err error) error {
+			if err != nil || dentry.IsDir() || dentry.Name() != "Release" {
+				return err
+			}
+
+			distribution, _ := filepath.Rel(p, filepath.Dir(dp))
+
+			release, err := readBrowseStanza(dp, true)
+			if err != nil || release == nil {
+				// not a Release file of distribution (e.g. component Release)
+				return nil
+			}
+			if release["Components"] == "" {
+				return nil
+			}
+
+			result = append(result, &BrowsedDistribution{
+				Prefix:       filepath.ToSlash(prefix),
+				Distribution: filepath.ToSlash(distribution),
+				Release:      release,
+			})
+
+			return fs.SkipDir
+		})
+		if err != nil {
+			return err
+		}
+
+		return fs.SkipDir
+	})
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path() < result[j].Path()
+	})
+
+	return result, err
+}
+
+func readBrowseStanza(filename string, isRelease bool) (Stanza, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return NewControlFileReader(f, isRelease, false).ReadStanza()
+}
+
+// browseIndex reads all the stanzas from Packages or Sources index, plain or gzipped
+func (h *BrowseHandler) browseIndex(basePath string) ([]Stanza, error) {
+	var r io.Reader
+
+	f, err := os.Open(basePath)
+	if os.IsNotExist(err) {
+		f, err = os.Open(basePath + ".gz")
+		if err == nil {
+			defer f.Close()
+			r, err = gzip.NewReader(f)
+		}
+	} else if err == nil {
+		defer f.Close()
+		r = f
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Stanza{}
+	reader := NewControlFileReader(r, false, false)
+
+	for {
+		stanza, err := reader.ReadStanza()
+		if err != nil {
+			return nil, err
+		}
+		if stanza == nil {
+			break
+		}
+		result = append(result, stanza)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i]["Package"] < result[j]["Package"]
+	})
+
+	return result, nil
+}
+
+// BrowsedPackage is a row in package table
+type BrowsedPackage struct {
+	Name         string
+	Version      string
+	Architecture string
+	Description  string
+	Link         string
+}
+
+var browseTemplates = template.Must(template.New("browse").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; border-bottom: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>{{.}}</h1>
+{{end}}
+{{define "footer"}}</body>
+</html>
+{{end}}
+{{define "list"}}{{template "header" "Published repositories"}}
+<table>
+<tr><th>Prefix</th><th>Distribution</th><th>Origin</th><th>Label</th><th>Components</th><th>Architectures</th></tr>
+{{range .}}<tr><td>{{.Prefix}}</td><td><a href="{{.Path}}/">{{.Distribution}}</a></td><td>{{.Release.Origin}}</td><td>{{.Release.Label}}</td><td>{{join .Components " "}}</td><td>{{join .Architectures " "}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+{{define "distribution"}}{{template "header" .Path}}
+<p><a href="{{.Base}}">All repositories</a></p>
+<table>
+{{range $field := .Fields}}{{with index $.Release $field}}<tr><th>{{$field}}</th><td>{{.}}</td></tr>
+{{end}}{{end}}</table>
+<h2>Packages</h2>
+<table>
+<tr><th>Component</th><th>Architectures</th></tr>
+{{range $component := .Components}}<tr><td>{{$component}}</td><td>{{range $.Architectures}}<a href="{{$component}}/{{.}}/">{{.}}</a> {{end}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+{{define "packages"}}{{template "header" .Title}}
+<p><a href="../../">{{.Distribution}}</a></p>
+<table>
+<tr><th>Package</th><th>Version</th><th>Architecture</th><th>Description</th></tr>
+{{range .Packages}}<tr><td>{{if .Link}}<a href="{{.Link}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td><td>{{.Version}}</td><td>{{.Architecture}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+`))
+
+func (h *BrowseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	distributions, err := h.Distributions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if h.Filter != nil {
+		filtered := distributions[:0]
+		for _, d := range distributions {
+			if h.Filter(r, d) {
+				filtered = append(filtered, d)
+			}
+		}
+		distributions = filtered
+	}
+
+	requestPath := strings.Trim(r.URL.Path, "/")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if requestPath == "" {
+		browseTemplates.ExecuteTemplate(w, "list", distributions)
+		return
+	}
+
+	// find longest matching distribution path
+	var distribution *BrowsedDistribution
+	for _, d := range distributions {
+		if (requestPath == d.Path() || strings.HasPrefix(requestPath, d.Path()+"/")) &&
+			(distribution == nil || len(d.Path()) > len(distribution.Path())) {
+			distribution = d
+		}
+	}
+
+	if distribution == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// pages use relative links, so directory-style URLs are required
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		// relative Location, as handler might be mounted under some path
+		w.Header().Set("Location", path.Base(r.URL.Path)+"/")
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
+	base := strings.Repeat("../", strings.Count(distribution.Path(), "/")+1)
+	rest := strings.Trim(strings.TrimPrefix(requestPath, distribution.Path()), "/")
+
+	if rest == "" {
+		browseTemplates.ExecuteTemplate(w, "distribution", map[string]interface{}{
+			"Path":          distribution.Path(),
+			"Base":          base,
+			"Release":       distribution.Release,
+			"Fields":        []string{"Origin", "Label", "Suite", "Codename", "Version", "Date", "Description"},
+			"Components":    distribution.Components(),
+			"Architectures": distribution.Architectures(),
+		})
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || !utils.StrSliceHasItem(distribution.Components(), parts[0]) ||
+		!utils.StrSliceHasItem(distribution.Architectures(), parts[1]) {
+		http.NotFound(w, r)
+		return
+	}
+
+	component, architecture := parts[0], parts[1]
+
+	indexPath := filepath.Join(h.root, filepath.FromSlash(distribution.Path()), component, "binary-"+architecture, "Packages")
+	if architecture == ArchitectureSource {
+		indexPath = filepath.Join(h.root, filepath.FromSlash(distribution.Path()), component, "source", "Sources")
+	}
+
+	stanzas, err := h.browseIndex(indexPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// package files are served by file server
+	prefixLink := h.filesURL
+	if distribution.Prefix != "." {
+		prefixLink += distribution.Prefix + "/"
+	}
+
+	packages := make([]BrowsedPackage, 0, len(stanzas))
+	for _, stanza := range stanzas {
+		p := BrowsedPackage{
+			Name:         stanza["Package"],
+			Version:      stanza["Version"],
+			Architecture: stanza["Architecture"],
+			Description:  strings.SplitN(strings.TrimSpace(stanza["Description"]), "\n", 2)[0],
+		}
+		if stanza["Filename"] != "" {
+			p.Link = prefixLink + stanza["Filename"]
+		}
+		packages = append(packages, p)
+	}
+
+	browseTemplates.ExecuteTemplate(w, "packages", map[string]interface{}{
+		"Title":        distribution.Path() + " " + component + "/" + architecture,
+		"Distribution": distribution.Distribution,
+		"Packages":     packages,
+	})
+}
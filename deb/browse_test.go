@@ -0,0 +1,86 @@
+package deb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type BrowseSuite struct {
+	root    string
+	handler *BrowseHandler
+}
+
+var _ = Suite(&BrowseSuite{})
+
+func (s *BrowseSuite) SetUpTest(c *C) {
+	s.root = c.MkDir()
+
+	write := func(path, contents string) {
+		path = filepath.Join(s.root, path)
+		c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+		c.Assert(os.WriteFile(path, []byte(contents), 0644), IsNil)
+	}
+
+	write("dists/stable/Release", "Origin: Example\nLabel: Example\nCodename: stable\nArchitectures: amd64 source\nComponents: main\n")
+	write("dists/stable/main/binary-amd64/Release", "Archive: stable\nComponent: main\nArchitecture: amd64\n")
+	write("dists/stable/main/binary-amd64/Packages",
+		"Package: zsh\nVersion: 5.9-4\nArchitecture: amd64\nFilename: pool/main/z/zsh/zsh_5.9-4_amd64.deb\nDescription: shell with lots of features\n more text\n\n"+
+			"Package: aptly\nVersion: 1.5.0\nArchitecture: amd64\nFilename: pool/main/a/aptly/aptly_1.5.0_amd64.deb\nDescription: Debian repository management tool\n")
+	write("ppa/dists/dev/Release", "Origin: PPA\nArchitectures: i386\nComponents: contrib\n")
+	write("pool/main/a/aptly/aptly_1.5.0_amd64.deb", "")
+
+	s.handler = NewBrowseHandler(s.root, "/")
+}
+
+func (s *BrowseSuite) get(path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func (s *BrowseSuite) TestDistributions(c *C) {
+	distributions, err := s.handler.Distributions()
+	c.Assert(err, IsNil)
+	c.Assert(distributions, HasLen, 2)
+	c.Check(distributions[0].Path(), Equals, "dists/stable")
+	c.Check(distributions[0].Components(), DeepEquals, []string{"main"})
+	c.Check(distributions[1].Path(), Equals, "ppa/dists/dev")
+	c.Check(distributions[1].Prefix, Equals, "ppa")
+}
+
+func (s *BrowseSuite) TestPages(c *C) {
+	response := s.get("/")
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `(?s).*<a href="dists/stable/">stable</a>.*<a href="ppa/dists/dev/">dev</a>.*`)
+
+	response = s.get("/dists/stable")
+	c.Check(response.Code, Equals, http.StatusMovedPermanently)
+	c.Check(response.Header().Get("Location"), Equals, "stable/")
+
+	response = s.get("/dists/stable/")
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `(?s).*<th>Origin</th><td>Example</td>.*<a href="main/amd64/">amd64</a>.*`)
+
+	response = s.get("/dists/stable/main/amd64/")
+	c.Check(response.Code, Equals, 200)
+	c.Check(response.Body.String(), Matches, `(?s).*<a href="/pool/main/a/aptly/aptly_1.5.0_amd64.deb">aptly</a></td><td>1.5.0</td>.*`+
+		`<a href="/pool/main/z/zsh/zsh_5.9-4_amd64.deb">zsh</a></td><td>5.9-4</td><td>amd64</td><td>shell with lots of features</td>.*`)
+
+	c.Check(s.get("/dists/stable/main/i386/").Code, Equals, 404)
+	c.Check(s.get("/dists/stable/main/source/").Code, Equals, 404)
+	c.Check(s.get("/dists/unstable/").Code, Equals, 404)
+	c.Check(s.get("/../etc/").Code, Equals, 404)
+}
+
+func (s *BrowseSuite) TestFilter(c *C) {
+	s.handler.Filter = func(r *http.Request, d *BrowsedDistribution) bool {
+		return d.Prefix != "ppa"
+	}
+
+	c.Check(s.get("/").Body.String(), Not(Matches), `(?s).*ppa/dists/dev.*`)
+	c.Check(s.get("/ppa/dists/dev/").Code, Equals, 404)
+}
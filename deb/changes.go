@@ -289,9 +289,12 @@ func CollectChangesFiles(locations []string, reporter aptly.ResultReporter) (cha
 }
 
 // ImportChangesFiles imports referenced files in changes files into local repository
-func ImportChangesFiles(changesFiles []string, reporter aptly.ResultReporter, acceptUnsigned, ignoreSignatures, forceReplace, noRemoveFiles bool,
+//
+// If set, added is called with package files imported into each repository.
+func ImportChangesFiles(changesFiles []string, reporter aptly.ResultReporter, acceptUnsigned, ignoreSignatures, forceReplace, forceHolds, noRemoveFiles bool,
 	verifier pgp.Verifier, repoTemplate *template.Template, progress aptly.Progress, localRepoCollection *LocalRepoCollection, packageCollection *PackageCollection,
-	pool aptly.PackagePool, checksumStorageProvider aptly.ChecksumStorageProvider, uploaders *Uploaders, parseQuery parseQuery) (processedFiles []string, failedFiles []string, err error) {
+	pool aptly.PackagePool, checksumStorageProvider aptly.ChecksumStorageProvider, uploaders *Uploaders, parseQuery parseQuery,
+	added func(repo *LocalRepo, files []string)) (processedFiles []string, failedFiles []string, err error) {
 
 	for _, path := range changesFiles {
 		var changes *Changes
@@ -375,13 +378,19 @@ func ImportChangesFiles(changesFiles []string, reporter aptly.ResultReporter, ac
 		restriction := changes.PackageQuery()
 		var processedFiles2, failedFiles2 []string
 
+		var isHeld func(*Package) bool
+		if !forceHolds {
+			isHeld = repo.IsHeld
+		}
+
 		processedFiles2, failedFiles2, err = ImportPackageFiles(list, packageFiles, forceReplace, verifier, pool,
-			packageCollection, reporter, restriction, checksumStorageProvider)
+			packageCollection, reporter, restriction, checksumStorageProvider, isHeld, repo.CheckVersionPolicy)
 
 		if err != nil {
 			return nil, nil, fmt.Errorf("unable to import package files: %s", err)
 		}
 
+		repo.AutoPrune(list, reporter)
 		repo.UpdateRefList(NewPackageRefListFromPackageList(list))
 
 		err = localRepoCollection.Update(repo)
@@ -389,6 +398,10 @@ func ImportChangesFiles(changesFiles []string, reporter aptly.ResultReporter, ac
 			return nil, nil, fmt.Errorf("unable to save: %s", err)
 		}
 
+		if added != nil {
+			added(repo, processedFiles2)
+		}
+
 		err = changes.Cleanup()
 		if err != nil {
 			return nil, nil, err
@@ -121,12 +121,17 @@ func (s *ChangesSuite) TestImportChangesFiles(c *C) {
 	changesFiles, failedFiles := CollectChangesFiles([]string{s.Dir}, s.Reporter)
 	c.Check(failedFiles, HasLen, 0)
 
+	added := 0
 	processedFiles, failedFiles, err := ImportChangesFiles(
 		append(changesFiles, "testdata/changes/notexistent.changes"),
-		s.Reporter, true, true, false, false, &NullVerifier{},
+		s.Reporter, true, true, false, false, false, &NullVerifier{},
 		template.Must(template.New("test").Parse("test")), s.progress, s.localRepoCollection, s.packageCollection, s.packagePool, func(database.ReaderWriter) aptly.ChecksumStorage { return s.checksumStorage },
-		nil, nil)
+		nil, nil, func(r *LocalRepo, files []string) {
+			c.Check(r.Name, Equals, "test")
+			added += len(files)
+		})
 	c.Assert(err, IsNil)
+	c.Check(added > 0, Equals, true)
 	c.Check(failedFiles, DeepEquals, append(expectedFailedFiles, "testdata/changes/notexistent.changes"))
 	c.Check(processedFiles, DeepEquals, expectedProcessedFiles)
 }
@@ -141,13 +146,99 @@ func (s *ChangesSuite) TestImportDbgsymWithVersionedSourceField(c *C) {
 	c.Check(failedFiles, HasLen, 0)
 
 	_, failedFiles, err := ImportChangesFiles(
-		changesFiles, s.Reporter, true, true, false, true, &NullVerifier{},
+		changesFiles, s.Reporter, true, true, false, false, true, &NullVerifier{},
 		template.Must(template.New("test").Parse("test")), s.progress, s.localRepoCollection, s.packageCollection, s.packagePool, func(database.ReaderWriter) aptly.ChecksumStorage { return s.checksumStorage },
-		nil, nil)
+		nil, nil, nil)
 	c.Assert(err, IsNil)
 	c.Check(failedFiles, IsNil)
 }
 
+func (s *ChangesSuite) TestImportReusesOrigFromPool(c *C) {
+	// previous upload of the same source package has tarball stored in custom pool location
+	stanza, err := GetControlFileFromDsc("testdata/changes/hardlink_0.2.1.dsc", &NullVerifier{})
+	c.Assert(err, IsNil)
+	stanza["Package"] = stanza["Source"]
+	delete(stanza, "Source")
+	stanza["Version"] = "0.2.0"
+
+	previous, err := NewSourcePackageFromControlFile(stanza)
+	c.Assert(err, IsNil)
+
+	poolPath := "custom/hardlink_0.2.1.tar.gz"
+	c.Assert(os.MkdirAll(filepath.Join(s.Dir, "custom"), 0755), IsNil)
+	c.Assert(utils.CopyFile("testdata/changes/hardlink_0.2.1.tar.gz", filepath.Join(s.Dir, poolPath)), IsNil)
+
+	files := previous.Files()
+	files[0].PoolPath = poolPath
+	previous.UpdateFiles(files)
+	c.Assert(s.packageCollection.Update(previous), IsNil)
+
+	// source-only upload without tarball
+	uploadDir := c.MkDir()
+	dsc := filepath.Join(uploadDir, "hardlink_0.2.1.dsc")
+	c.Assert(utils.CopyFile("testdata/changes/hardlink_0.2.1.dsc", dsc), IsNil)
+
+	list := NewPackageList()
+	processedFiles, failedFiles, err := ImportPackageFiles(list, []string{dsc}, false, &NullVerifier{}, s.packagePool,
+		s.packageCollection, s.Reporter, nil, func(database.ReaderWriter) aptly.ChecksumStorage { return s.checksumStorage }, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(failedFiles, HasLen, 0)
+	c.Check(processedFiles, DeepEquals, []string{dsc})
+	c.Assert(list.Len(), Equals, 1)
+
+	var tarball PackageFile
+	list.ForEach(func(p *Package) error {
+		for _, f := range p.Files() {
+			if f.Filename == "hardlink_0.2.1.tar.gz" {
+				tarball = f
+			}
+		}
+		return nil
+	})
+	c.Check(tarball.PoolPath, Equals, poolPath)
+}
+
+func (s *ChangesSuite) TestImportKeepsHeldPackages(c *C) {
+	stanza, err := GetControlFileFromDsc("testdata/changes/hardlink_0.2.1.dsc", &NullVerifier{})
+	c.Assert(err, IsNil)
+	stanza["Package"] = stanza["Source"]
+	delete(stanza, "Source")
+	stanza["Files"] = " 00000000000000000000000000000000 12516 hardlink_0.2.1.tar.gz\n"
+	delete(stanza, "Checksums-Sha1")
+	delete(stanza, "Checksums-Sha256")
+
+	held, err := NewSourcePackageFromControlFile(stanza)
+	c.Assert(err, IsNil)
+
+	list := NewPackageList()
+	c.Assert(list.Add(held), IsNil)
+
+	uploadDir := c.MkDir()
+	for _, name := range []string{"hardlink_0.2.1.dsc", "hardlink_0.2.1.tar.gz"} {
+		c.Assert(utils.CopyFile(filepath.Join("testdata/changes", name), filepath.Join(uploadDir, name)), IsNil)
+	}
+	dsc := filepath.Join(uploadDir, "hardlink_0.2.1.dsc")
+
+	isHeld := func(p *Package) bool { return p == held }
+
+	_, failedFiles, err := ImportPackageFiles(list, []string{dsc}, true, &NullVerifier{}, s.packagePool,
+		s.packageCollection, s.Reporter, nil, func(database.ReaderWriter) aptly.ChecksumStorage { return s.checksumStorage }, isHeld, nil)
+	c.Assert(err, IsNil)
+	c.Check(failedFiles, DeepEquals, []string{dsc})
+	c.Check(list.Len(), Equals, 1)
+	c.Check(list.Has(held), Equals, true)
+
+	_, failedFiles, err = ImportPackageFiles(list, []string{dsc}, true, &NullVerifier{}, s.packagePool,
+		s.packageCollection, s.Reporter, nil, func(database.ReaderWriter) aptly.ChecksumStorage { return s.checksumStorage }, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(failedFiles, HasLen, 0)
+	c.Check(list.Len(), Equals, 1)
+	list.ForEach(func(p *Package) error {
+		c.Check(p == held, Equals, false)
+		return nil
+	})
+}
+
 func (s *ChangesSuite) TestPrepare(c *C) {
 	changes, err := NewChanges("testdata/changes/hardlink_0.2.1_amd64.changes")
 	c.Assert(err, IsNil)
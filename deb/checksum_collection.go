@@ -48,6 +48,10 @@ func (collection *ChecksumCollection) Get(path string) (*utils.ChecksumInfo, err
 	return c, nil
 }
 
+func (collection *ChecksumCollection) indexKey(sha256 string) []byte {
+	return []byte("H" + sha256)
+}
+
 // Update adds or updates information about checksum in DB
 func (collection *ChecksumCollection) Update(path string, c *utils.ChecksumInfo) error {
 	var encodeBuffer bytes.Buffer
@@ -58,10 +62,36 @@ func (collection *ChecksumCollection) Update(path string, c *utils.ChecksumInfo)
 		return err
 	}
 
-	return collection.db.Put(collection.dbKey(path), encodeBuffer.Bytes())
+	err = collection.db.Put(collection.dbKey(path), encodeBuffer.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if c.SHA256 == "" {
+		return nil
+	}
+
+	return collection.db.Put(collection.indexKey(c.SHA256), []byte(path))
+}
+
+// PathBySHA256 returns path to file in package pool with given SHA256 checksum
+//
+// Only files which had their checksums updated are indexed, path might point to file
+// which has been already removed from package pool.
+func (collection *ChecksumCollection) PathBySHA256(sha256 string) (string, error) {
+	path, err := collection.db.Get(collection.indexKey(sha256))
+	if err != nil {
+		if err == database.ErrNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return string(path), nil
 }
 
 // Check interface
 var (
 	_ aptly.ChecksumStorage = &ChecksumCollection{}
+	_ aptly.ChecksumIndex   = &ChecksumCollection{}
 )
@@ -46,3 +46,24 @@ func (s *ChecksumCollectionSuite) TestFlow(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(*checksum, DeepEquals, s.c)
 }
+
+func (s *ChecksumCollectionSuite) TestPathBySHA256(c *C) {
+	path, err := s.collection.PathBySHA256(s.c.SHA256)
+	c.Assert(err, IsNil)
+	c.Check(path, Equals, "")
+
+	err = s.collection.Update("some/path", &s.c)
+	c.Assert(err, IsNil)
+
+	path, err = s.collection.PathBySHA256(s.c.SHA256)
+	c.Assert(err, IsNil)
+	c.Check(path, Equals, "some/path")
+
+	// checksums without SHA256 are not indexed
+	err = s.collection.Update("other/path", &utils.ChecksumInfo{Size: 5, MD5: "ab56b4d92b40713acc5af89985d4b786"})
+	c.Assert(err, IsNil)
+
+	path, err = s.collection.PathBySHA256("")
+	c.Assert(err, IsNil)
+	c.Check(path, Equals, "")
+}
@@ -0,0 +1,512 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/pgp"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// ClientCheckFetcher returns contents of file of published repository, path is relative
+// to the root of repository (published prefix), e.g. dists/bookworm/InRelease
+type ClientCheckFetcher func(path string) (io.ReadCloser, error)
+
+// NewHTTPClientCheckFetcher fetches files of repository published at baseURL
+func NewHTTPClientCheckFetcher(baseURL string) ClientCheckFetcher {
+	return func(p string) (io.ReadCloser, error) {
+		u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/" + p)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := http.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("HTTP %s", resp.Status)
+		}
+
+		return resp.Body, nil
+	}
+}
+
+// ClientCheckOptions configures simulation of apt client
+type ClientCheckOptions struct {
+	// Distribution to check
+	Distribution string
+	// Verifier of Release signatures, also used to extract InRelease contents
+	Verifier pgp.Verifier
+	// Don't verify signatures
+	IgnoreSignatures bool
+	// Number of packages to download from every package index
+	Sample int
+}
+
+// ClientCheckResult is the outcome of apt client simulation
+type ClientCheckResult struct {
+	// Release file which was used: InRelease or Release
+	ReleaseFile string
+	// Keys Release file is signed with
+	SignedBy []string
+	// Number of verified index files
+	Indexes int
+	// Number of downloaded and verified package files
+	Packages int
+	// Problems apt clients would run into
+	Problems []string
+}
+
+// clientChecker simulates apt client
+type clientChecker struct {
+	fetch    ClientCheckFetcher
+	options  ClientCheckOptions
+	progress aptly.Progress
+	result   *ClientCheckResult
+	byHash   bool
+	dists    string
+	seen     map[string]bool
+}
+
+// indexCompressions lists extensions of package indexes in the order of apt preference
+var indexCompressions = []string{".xz", ".gz", ".bz2", ".zst", ".lzma", ""}
+
+// CheckClient simulates apt client fetching repository: Release file is fetched and its
+// signature is verified, index files are verified against checksums in Release file (including
+// by-hash paths) and sample of package files is downloaded and verified against checksums
+// in package indexes
+//
+// Error is returned only if check can't be done at all, problems clients would run into are
+// reported in the result.
+func CheckClient(fetch ClientCheckFetcher, options ClientCheckOptions, progress aptly.Progress) (*ClientCheckResult, error) {
+	checker := &clientChecker{
+		fetch:    fetch,
+		options:  options,
+		progress: progress,
+		result:   &ClientCheckResult{Problems: []string{}},
+		dists:    path.Join("dists", options.Distribution),
+		seen:     map[string]bool{},
+	}
+
+	release, err := checker.fetchRelease()
+	if err != nil {
+		return nil, err
+	}
+
+	stanza, err := NewControlFileReader(bytes.NewReader(release), true, false).ReadStanza()
+	if err != nil || stanza == nil {
+		checker.problem("%s: unable to parse Release file: %v", checker.result.ReleaseFile, err)
+		return checker.result, nil
+	}
+
+	checker.checkReleaseFields(stanza)
+
+	sums, err := checker.parseSums(stanza)
+	if err != nil {
+		checker.problem("%s: %s", checker.result.ReleaseFile, err)
+		return checker.result, nil
+	}
+
+	checker.checkIndexes(stanza, sums)
+
+	return checker.result, nil
+}
+
+func (checker *clientChecker) problem(msg string, a ...interface{}) {
+	problem := fmt.Sprintf(msg, a...)
+	checker.result.Problems = append(checker.result.Problems, problem)
+
+	if checker.progress != nil {
+		checker.progress.ColoredPrintf("@r[!]@| %s", problem)
+	}
+}
+
+func (checker *clientChecker) read(p string) ([]byte, error) {
+	r, err := checker.fetch(p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// fetchRelease fetches InRelease (or Release + Release.gpg) and verifies signature,
+// returning text of Release file
+func (checker *clientChecker) fetchRelease() ([]byte, error) {
+	inReleasePath := path.Join(checker.dists, "InRelease")
+
+	inRelease, inReleaseErr := checker.read(inReleasePath)
+	if inReleaseErr == nil {
+		checker.result.ReleaseFile = inReleasePath
+
+		if !checker.options.IgnoreSignatures {
+			keyInfo, err := checker.options.Verifier.VerifyClearsigned(bytes.NewReader(inRelease), false)
+			if err != nil {
+				checker.problem("%s: signature verification failed: %s (clients need public key the repository is signed with)",
+					inReleasePath, err)
+			} else {
+				for _, key := range keyInfo.GoodKeys {
+					checker.result.SignedBy = append(checker.result.SignedBy, string(key))
+				}
+			}
+		}
+
+		text, err := checker.options.Verifier.ExtractClearsigned(bytes.NewReader(inRelease))
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to extract signed text: %s", inReleasePath, err)
+		}
+		defer text.Close()
+
+		return io.ReadAll(text)
+	}
+
+	releasePath := path.Join(checker.dists, "Release")
+
+	release, err := checker.read(releasePath)
+	if err != nil {
+		return nil, fmt.Errorf("neither %s (%s) nor %s (%s) could be fetched: is distribution %s published?",
+			inReleasePath, inReleaseErr, releasePath, err, checker.options.Distribution)
+	}
+	checker.result.ReleaseFile = releasePath
+
+	if checker.options.IgnoreSignatures {
+		return release, nil
+	}
+
+	signature, err := checker.read(releasePath + ".gpg")
+	if err != nil {
+		checker.problem("%s: repository is not signed, neither InRelease nor Release.gpg could be fetched (%s): "+
+			"clients will refuse it unless marked as trusted", releasePath, err)
+		return release, nil
+	}
+
+	err = checker.options.Verifier.VerifyDetachedSignature(bytes.NewReader(signature), bytes.NewReader(release), false)
+	if err != nil {
+		checker.problem("%s.gpg: signature verification failed: %s (clients need public key the repository is signed with)",
+			releasePath, err)
+	}
+
+	return release, nil
+}
+
+// parseReleaseDate parses date in Release file, apt accepts several variants of RFC 1123
+func parseReleaseDate(value string) (time.Time, error) {
+	var err error
+
+	for _, layout := range []string{time.RFC1123, time.RFC1123Z, "Mon, 2 Jan 2006 15:04:05 MST", "Mon, 2 Jan 2006 15:04:05 -0700"} {
+		var t time.Time
+
+		t, err = time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+func (checker *clientChecker) checkReleaseFields(stanza Stanza) {
+	releaseFile := checker.result.ReleaseFile
+	distribution := checker.options.Distribution
+
+	if stanza["Suite"] == "" && stanza["Codename"] == "" {
+		checker.problem("%s: neither Suite nor Codename is set", releaseFile)
+	} else if !strings.HasPrefix(distribution, ".") && stanza["Suite"] != distribution && stanza["Codename"] != distribution &&
+		path.Base(distribution) != stanza["Suite"] && path.Base(distribution) != stanza["Codename"] {
+		checker.problem("%s: distribution %s doesn't match Suite %q or Codename %q: clients will report conflicting distribution",
+			releaseFile, distribution, stanza["Suite"], stanza["Codename"])
+	}
+
+	now := time.Now()
+
+	if date := stanza["Date"]; date == "" {
+		checker.problem("%s: Date is not set", releaseFile)
+	} else if t, err := parseReleaseDate(date); err != nil {
+		checker.problem("%s: unable to parse Date %q: %s", releaseFile, date, err)
+	} else if t.After(now.Add(time.Minute)) {
+		checker.problem("%s: Date %s is in the future: clients will reject Release file as not valid yet (check clock of publishing host)",
+			releaseFile, date)
+	}
+
+	if validUntil := stanza["Valid-Until"]; validUntil != "" {
+		if t, err := parseReleaseDate(validUntil); err != nil {
+			checker.problem("%s: unable to parse Valid-Until %q: %s", releaseFile, validUntil, err)
+		} else if t.Before(now) {
+			checker.problem("%s: Release file expired at %s: re-publish to refresh it", releaseFile, validUntil)
+		}
+	}
+
+	checker.byHash = stanza["Acquire-By-Hash"] == "yes"
+}
+
+// parseSums returns SHA256 (or weaker, if missing) checksums of files listed in Release file
+func (checker *clientChecker) parseSums(stanza Stanza) (map[string]utils.ChecksumInfo, error) {
+	sums := map[string]utils.ChecksumInfo{}
+
+	field, setter := "SHA256", func(sum *utils.ChecksumInfo, data string) { sum.SHA256 = data }
+	if stanza["SHA256"] == "" {
+		checker.problem("%s: SHA256 checksums are missing, clients reject weaker checksums", checker.result.ReleaseFile)
+		field, setter = "MD5Sum", func(sum *utils.ChecksumInfo, data string) { sum.MD5 = data }
+	}
+
+	for _, line := range strings.Split(stanza[field], "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("unparseable %s line: %#v", field, line)
+		}
+
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse size in %s line %#v: %s", field, line, err)
+		}
+
+		sum := utils.ChecksumInfo{Size: size}
+		setter(&sum, parts[0])
+		sums[parts[2]] = sum
+	}
+
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("no index files listed")
+	}
+
+	return sums, nil
+}
+
+// verify fetches file and compares it with expected checksums, returning contents
+// if file matches
+func (checker *clientChecker) verify(p, listedIn string, expected utils.ChecksumInfo) ([]byte, bool) {
+	contents, err := checker.read(p)
+	if err != nil {
+		checker.problem("%s: listed in %s, but can't be fetched: %s", p, listedIn, err)
+		return nil, false
+	}
+
+	actual, _ := utils.ChecksumsForReader(bytes.NewReader(contents))
+
+	hint := "file was changed after it was indexed: re-publish or purge CDN/proxy cache"
+	if actual.Size != expected.Size {
+		checker.problem("%s: size mismatch, %s says %d, got %d: %s", p, listedIn, expected.Size, actual.Size, hint)
+		return nil, false
+	}
+	if expected.SHA256 != "" && actual.SHA256 != expected.SHA256 {
+		checker.problem("%s: SHA256 mismatch, %s says %s, got %s: %s", p, listedIn, expected.SHA256, actual.SHA256, hint)
+		return nil, false
+	}
+	if expected.SHA256 == "" && expected.MD5 != "" && actual.MD5 != expected.MD5 {
+		checker.problem("%s: MD5 mismatch, %s says %s, got %s: %s", p, listedIn, expected.MD5, actual.MD5, hint)
+		return nil, false
+	}
+
+	return contents, true
+}
+
+// splitIndexName splits index file name into base name (Packages) and compression extension (.gz)
+func splitIndexName(name string) (string, string) {
+	for _, ext := range indexCompressions {
+		if ext != "" && strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext), ext
+		}
+	}
+
+	return name, ""
+}
+
+func (checker *clientChecker) checkIndexes(stanza Stanza, sums map[string]utils.ChecksumInfo) {
+	releaseFile := checker.result.ReleaseFile
+
+	// index files by directory, e.g. main/binary-amd64 -> Packages.gz
+	indexes := map[string]map[string]utils.ChecksumInfo{}
+	for name, sum := range sums {
+		base, _ := splitIndexName(path.Base(name))
+		if base != "Packages" && base != "Sources" && base != "Release" {
+			continue
+		}
+
+		dir := path.Dir(name)
+		if indexes[dir] == nil {
+			indexes[dir] = map[string]utils.ChecksumInfo{}
+		}
+		indexes[dir][path.Base(name)] = sum
+	}
+
+	// every component and architecture should have an index
+	for _, component := range strings.Fields(stanza["Components"]) {
+		component = strings.TrimPrefix(component, path.Base(checker.options.Distribution)+"/")
+		for _, arch := range strings.Fields(stanza["Architectures"]) {
+			dir, kind := path.Join(component, "binary-"+arch), "Packages"
+			if arch == ArchitectureSource {
+				dir, kind = path.Join(component, "source"), "Sources"
+			}
+
+			found := false
+			for name := range indexes[dir] {
+				if base, _ := splitIndexName(name); base == kind {
+					found = true
+				}
+			}
+			if !found {
+				checker.problem("%s: no %s index for component %s, architecture %s: clients will fail to update",
+					releaseFile, kind, component, arch)
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(indexes))
+	for dir := range indexes {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		var (
+			parsed              bool
+			parsedName, content string
+		)
+
+		for _, ext := range indexCompressions {
+			for _, kind := range []string{"Packages", "Sources", "Release"} {
+				name := kind + ext
+				sum, ok := indexes[dir][name]
+				if !ok {
+					continue
+				}
+
+				p := path.Join(checker.dists, dir, name)
+				contents, ok := checker.verify(p, releaseFile, sum)
+				checker.result.Indexes++
+				if !ok {
+					continue
+				}
+
+				if checker.byHash && sum.SHA256 != "" {
+					checker.verify(path.Join(checker.dists, dir, "by-hash", "SHA256", sum.SHA256), releaseFile, sum)
+				}
+
+				if kind != "Release" && !parsed {
+					parsed, parsedName, content = true, name, string(contents)
+				}
+			}
+		}
+
+		if parsed {
+			checker.checkPackages(path.Join(checker.dists, dir, parsedName), content)
+		}
+	}
+}
+
+// checkPackages downloads sample of packages from index and verifies their checksums
+func (checker *clientChecker) checkPackages(indexPath, contents string) {
+	base, ext := splitIndexName(path.Base(indexPath))
+
+	r, err := openCompressed(strings.NewReader(contents), ext)
+	if err != nil {
+		checker.problem("%s: %s", indexPath, err)
+		return
+	}
+	defer r.Close()
+
+	reader := NewControlFileReader(r, false, false)
+	stanzas := []Stanza{}
+
+	for {
+		var stanza Stanza
+
+		stanza, err = reader.ReadStanza()
+		if err != nil {
+			checker.problem("%s: unable to parse index: %s", indexPath, err)
+			return
+		}
+		if stanza == nil {
+			break
+		}
+
+		stanzas = append(stanzas, stanza)
+	}
+
+	if checker.progress != nil {
+		checker.progress.Printf("%s: %d packages\n", indexPath, len(stanzas))
+	}
+
+	sample := checker.options.Sample
+	if sample > len(stanzas) {
+		sample = len(stanzas)
+	}
+
+	for i := 0; i < sample; i++ {
+		stanza := stanzas[i*len(stanzas)/sample]
+
+		p, expected, err := packageFileFromIndex(base, stanza)
+		if err != nil {
+			checker.problem("%s: package %s: %s", indexPath, stanza["Package"], err)
+			continue
+		}
+
+		if checker.seen[p] {
+			continue
+		}
+		checker.seen[p] = true
+
+		if _, ok := checker.verify(p, indexPath, expected); ok {
+			checker.result.Packages++
+		}
+	}
+}
+
+// packageFileFromIndex returns path and checksums of package file (.deb or .dsc) from index stanza
+func packageFileFromIndex(kind string, stanza Stanza) (string, utils.ChecksumInfo, error) {
+	if kind == "Packages" {
+		size, err := strconv.ParseInt(stanza["Size"], 10, 64)
+		if err != nil {
+			return "", utils.ChecksumInfo{}, fmt.Errorf("unable to parse Size: %s", err)
+		}
+		if stanza["Filename"] == "" {
+			return "", utils.ChecksumInfo{}, fmt.Errorf("Filename is missing")
+		}
+
+		return stanza["Filename"], utils.ChecksumInfo{Size: size, SHA256: stanza["SHA256"], MD5: stanza["MD5sum"]}, nil
+	}
+
+	field, sha256 := "Checksums-Sha256", true
+	if stanza[field] == "" {
+		field, sha256 = "Files", false
+	}
+
+	for _, line := range strings.Split(stanza[field], "\n") {
+		parts := strings.Fields(line)
+		if len(parts) != 3 || !strings.HasSuffix(parts[2], ".dsc") {
+			continue
+		}
+
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return "", utils.ChecksumInfo{}, fmt.Errorf("unable to parse size: %s", err)
+		}
+
+		sum := utils.ChecksumInfo{Size: size}
+		if sha256 {
+			sum.SHA256 = parts[0]
+		} else {
+			sum.MD5 = parts[0]
+		}
+
+		return path.Join(stanza["Directory"], parts[2]), sum, nil
+	}
+
+	return "", utils.ChecksumInfo{}, fmt.Errorf(".dsc file is not listed")
+}
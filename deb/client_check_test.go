@@ -0,0 +1,45 @@
+package deb
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *PublishedRepoSuite) TestCheckClient(c *C) {
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, nil, nil, false, ""), IsNil)
+
+	root := filepath.Join(s.publishedStorage.PublicPath(), "ppa")
+	fetcher := func(path string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(root, path))
+	}
+
+	options := ClientCheckOptions{Distribution: "squeeze", IgnoreSignatures: true, Sample: 5}
+
+	result, err := CheckClient(fetcher, options, nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Problems, DeepEquals, []string{})
+	c.Check(result.ReleaseFile, Equals, "dists/squeeze/Release")
+	c.Check(result.Indexes > 0, Equals, true)
+	c.Check(result.Packages, Equals, 1)
+
+	options.IgnoreSignatures = false
+	result, err = CheckClient(fetcher, options, nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Problems, HasLen, 1)
+	c.Check(result.Problems[0], Matches, "dists/squeeze/Release: repository is not signed.*")
+
+	options.IgnoreSignatures = true
+	c.Assert(os.WriteFile(filepath.Join(root, "dists/squeeze/main/binary-i386/Packages"), []byte("tampered\n"), 0644), IsNil)
+
+	result, err = CheckClient(fetcher, options, nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Problems, HasLen, 1)
+	c.Check(result.Problems[0], Matches, "dists/squeeze/main/binary-i386/Packages: size mismatch.*re-publish.*")
+
+	options.Distribution = "wheezy"
+	_, err = CheckClient(fetcher, options, nil)
+	c.Check(err, ErrorMatches, "neither dists/wheezy/InRelease .* is distribution wheezy published\\?")
+}
@@ -17,6 +17,13 @@ type CollectionFactory struct {
 	localRepos     *LocalRepoCollection
 	publishedRepos *PublishedRepoCollection
 	checksums      *ChecksumCollection
+	trackers       *SecurityTrackerCollection
+	downloads      *DownloadStatsCollection
+	pipelines      *PipelineCollection
+	schedules      *MirrorScheduleCollection
+	taskRecords    *TaskRecordCollection
+	incoming       *IncomingCollection
+	apiTokens      *APITokenCollection
 }
 
 // NewCollectionFactory creates new factory
@@ -107,6 +114,90 @@ func (factory *CollectionFactory) ChecksumCollection(db database.ReaderWriter) a
 	return factory.checksums
 }
 
+// SecurityTrackerCollection returns (or creates) new SecurityTrackerCollection
+func (factory *CollectionFactory) SecurityTrackerCollection() *SecurityTrackerCollection {
+	factory.Lock()
+	defer factory.Unlock()
+
+	if factory.trackers == nil {
+		factory.trackers = NewSecurityTrackerCollection(factory.db)
+	}
+
+	return factory.trackers
+}
+
+// PipelineCollection returns (or creates) new PipelineCollection
+func (factory *CollectionFactory) PipelineCollection() *PipelineCollection {
+	factory.Lock()
+	defer factory.Unlock()
+
+	if factory.pipelines == nil {
+		factory.pipelines = NewPipelineCollection(factory.db)
+	}
+
+	return factory.pipelines
+}
+
+// MirrorScheduleCollection returns (or creates) new MirrorScheduleCollection
+func (factory *CollectionFactory) MirrorScheduleCollection() *MirrorScheduleCollection {
+	factory.Lock()
+	defer factory.Unlock()
+
+	if factory.schedules == nil {
+		factory.schedules = NewMirrorScheduleCollection(factory.db)
+	}
+
+	return factory.schedules
+}
+
+// IncomingCollection returns (or creates) new IncomingCollection
+func (factory *CollectionFactory) IncomingCollection() *IncomingCollection {
+	factory.Lock()
+	defer factory.Unlock()
+
+	if factory.incoming == nil {
+		factory.incoming = NewIncomingCollection(factory.db)
+	}
+
+	return factory.incoming
+}
+
+// APITokenCollection returns (or creates) new APITokenCollection
+func (factory *CollectionFactory) APITokenCollection() *APITokenCollection {
+	factory.Lock()
+	defer factory.Unlock()
+
+	if factory.apiTokens == nil {
+		factory.apiTokens = NewAPITokenCollection(factory.db)
+	}
+
+	return factory.apiTokens
+}
+
+// TaskRecordCollection returns (or creates) new TaskRecordCollection
+func (factory *CollectionFactory) TaskRecordCollection() *TaskRecordCollection {
+	factory.Lock()
+	defer factory.Unlock()
+
+	if factory.taskRecords == nil {
+		factory.taskRecords = NewTaskRecordCollection(factory.db)
+	}
+
+	return factory.taskRecords
+}
+
+// DownloadStatsCollection returns (or creates) new DownloadStatsCollection
+func (factory *CollectionFactory) DownloadStatsCollection() *DownloadStatsCollection {
+	factory.Lock()
+	defer factory.Unlock()
+
+	if factory.downloads == nil {
+		factory.downloads = NewDownloadStatsCollection(factory.db)
+	}
+
+	return factory.downloads
+}
+
 // Flush removes all references to collections, so that memory could be reclaimed
 func (factory *CollectionFactory) Flush() {
 	factory.Lock()
@@ -118,4 +209,10 @@ func (factory *CollectionFactory) Flush() {
 	factory.publishedRepos = nil
 	factory.packages = nil
 	factory.checksums = nil
+	factory.trackers = nil
+	factory.downloads = nil
+	factory.pipelines = nil
+	factory.schedules = nil
+	factory.taskRecords = nil
+	factory.apiTokens = nil
 }
@@ -2,22 +2,15 @@ package deb
 
 import (
 	"archive/tar"
-	"bufio"
-	"compress/bzip2"
-	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
-	"github.com/h2non/filetype/matchers"
 	ar "github.com/mkrautz/goar"
 	"github.com/pkg/errors"
 
 	"github.com/aptly-dev/aptly/pgp"
-	"github.com/kjk/lzma"
-	"github.com/klauspost/compress/zstd"
-	"github.com/smira/go-xz"
 )
 
 // Source kinds
@@ -48,43 +41,14 @@ func GetControlFileFromDeb(packageFile string) (Stanza, error) {
 			return nil, fmt.Errorf("unable to read .deb archive %s: %s", packageFile, err)
 		}
 
-		// As per deb(5) version 1.19.0.4 the control file may be:
-		// - control.tar (since 1.17.6)
-		// - control.tar.gz
-		// - control.tar.xz (since 1.17.6)
-		// Look for all of the above and uncompress as necessary.
+		// As per deb(5) the control file may be control.tar (since 1.17.6), control.tar.gz,
+		// control.tar.xz (since 1.17.6) or control.tar.zst, compression is autodetected
 		if strings.HasPrefix(header.Name, "control.tar") {
-			bufReader := bufio.NewReader(library)
-
-			var tarInput io.Reader
-
-			switch header.Name {
-			case "control.tar":
-				tarInput = bufReader
-			case "control.tar.gz":
-				ungzip, err := gzip.NewReader(bufReader)
-				if err != nil {
-					return nil, errors.Wrapf(err, "unable to ungzip %s from %s", header.Name, packageFile)
-				}
-				defer ungzip.Close()
-				tarInput = ungzip
-			case "control.tar.xz":
-				unxz, err := xz.NewReader(bufReader)
-				if err != nil {
-					return nil, errors.Wrapf(err, "unable to unxz %s from %s", header.Name, packageFile)
-				}
-				defer unxz.Close()
-				tarInput = unxz
-			case "control.tar.zst":
-				unzstd, err := zstd.NewReader(bufReader)
-				if err != nil {
-					return nil, errors.Wrapf(err, "unable to unzstd %s from %s", header.Name, packageFile)
-				}
-				defer unzstd.Close()
-				tarInput = unzstd
-			default:
-				return nil, fmt.Errorf("unsupported tar compression in %s: %s", packageFile, header.Name)
+			tarInput, err := openDebMember(library, header.Name, "control.tar")
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to read %s from %s", header.Name, packageFile)
 			}
+			defer tarInput.Close()
 
 			untar := tar.NewReader(tarInput)
 			for {
@@ -149,82 +113,67 @@ func GetControlFileFromDsc(dscFile string, verifier pgp.Verifier) (Stanza, error
 
 // GetContentsFromDeb returns list of files installed by .deb package
 func GetContentsFromDeb(file io.Reader, packageFile string) ([]string, error) {
+	var results []string
+
+	err := walkDebData(file, packageFile, func(tarHeader *tar.Header, _ io.Reader) error {
+		if tarHeader.Typeflag == tar.TypeDir {
+			return nil
+		}
+
+		tarHeader.Name = strings.TrimPrefix(tarHeader.Name[2:], "./")
+		results = append(results, tarHeader.Name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// walkDebData calls handler for every entry of data.tar.* part of .deb package
+func walkDebData(file io.Reader, packageFile string, handler func(*tar.Header, io.Reader) error) error {
+	return walkDebMember(file, packageFile, "data.tar", handler)
+}
+
+// walkDebControl calls handler for every entry of control.tar.* part of .deb package
+func walkDebControl(file io.Reader, packageFile string, handler func(*tar.Header, io.Reader) error) error {
+	return walkDebMember(file, packageFile, "control.tar", handler)
+}
+
+// walkDebMember calls handler for every entry of tar archive stored as ar member
+// with specified prefix (e.g. data.tar) in .deb package
+func walkDebMember(file io.Reader, packageFile string, prefix string, handler func(*tar.Header, io.Reader) error) error {
 	library := ar.NewReader(file)
 	for {
 		header, err := library.Next()
 		if err == io.EOF {
-			return nil, fmt.Errorf("unable to find data.tar.* part in %s", packageFile)
+			return fmt.Errorf("unable to find %s.* part in %s", prefix, packageFile)
 		}
 		if err != nil {
-			return nil, errors.Wrapf(err, "unable to read .deb archive from %s", packageFile)
+			return errors.Wrapf(err, "unable to read .deb archive from %s", packageFile)
 		}
 
-		if strings.HasPrefix(header.Name, "data.tar") {
-			bufReader := bufio.NewReader(library)
-			signature, err := bufReader.Peek(270)
-
-			var isTar bool
-			if err == nil {
-				isTar = matchers.Tar(signature)
-			}
-
-			var tarInput io.Reader
-
-			switch header.Name {
-			case "data.tar":
-				tarInput = bufReader
-			case "data.tar.gz":
-				if isTar {
-					tarInput = bufReader
-				} else {
-					ungzip, err := gzip.NewReader(bufReader)
-					if err != nil {
-						return nil, errors.Wrapf(err, "unable to ungzip data.tar.gz from %s", packageFile)
-					}
-					defer ungzip.Close()
-					tarInput = ungzip
-				}
-			case "data.tar.bz2":
-				tarInput = bzip2.NewReader(bufReader)
-			case "data.tar.xz":
-				unxz, err := xz.NewReader(bufReader)
-				if err != nil {
-					return nil, errors.Wrapf(err, "unable to unxz data.tar.xz from %s", packageFile)
-				}
-				defer unxz.Close()
-				tarInput = unxz
-			case "data.tar.lzma":
-				unlzma := lzma.NewReader(bufReader)
-				defer unlzma.Close()
-				tarInput = unlzma
-			case "data.tar.zst":
-				unzstd, err := zstd.NewReader(bufReader)
-				if err != nil {
-					return nil, errors.Wrapf(err, "unable to unzstd %s from %s", header.Name, packageFile)
-				}
-				defer unzstd.Close()
-				tarInput = unzstd
-			default:
-				return nil, fmt.Errorf("unsupported tar compression in %s: %s", packageFile, header.Name)
+		if strings.HasPrefix(header.Name, prefix) {
+			tarInput, err := openDebMember(library, header.Name, prefix)
+			if err != nil {
+				return errors.Wrapf(err, "unable to read %s from %s", header.Name, packageFile)
 			}
+			defer tarInput.Close()
 
 			untar := tar.NewReader(tarInput)
-			var results []string
 			for {
 				tarHeader, err := untar.Next()
 				if err == io.EOF {
-					return results, nil
+					return nil
 				}
 				if err != nil {
-					return nil, errors.Wrapf(err, "unable to read .tar archive from %s", packageFile)
+					return errors.Wrapf(err, "unable to read .tar archive from %s", packageFile)
 				}
 
-				if tarHeader.Typeflag == tar.TypeDir {
-					continue
+				if err = handler(tarHeader, untar); err != nil {
+					return err
 				}
-
-				tarHeader.Name = strings.TrimPrefix(tarHeader.Name[2:], "./")
-				results = append(results, tarHeader.Name)
 			}
 		}
 	}
@@ -0,0 +1,195 @@
+package deb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/h2non/filetype/matchers"
+	"github.com/kjk/lzma"
+	"github.com/klauspost/compress/zstd"
+	"github.com/smira/go-xz"
+)
+
+// Decompressor describes compression format which might be used for
+// control.tar.* and data.tar.* members of .deb packages
+type Decompressor struct {
+	// Name of compression format, used in error messages
+	Name string
+	// Extensions of ar member name (e.g. ".gz"), used if format can't be detected by contents
+	Extensions []string
+	// Magic byte sequences compressed stream starts with
+	Magic [][]byte
+	// Open wraps compressed stream with decompressing reader
+	Open func(io.Reader) (io.ReadCloser, error)
+}
+
+// size of prefix peeked from ar member for format autodetection, tar header is 512 bytes
+const decompressorPeekSize = 512
+
+var (
+	decompressorsMu sync.RWMutex
+	decompressors   []Decompressor
+
+	zstdDictionaries [][]byte
+)
+
+// RegisterDecompressor adds support for new compression format of .deb members
+//
+// Decompressors registered later take precedence over earlier ones with the same
+// magic or extension.
+func RegisterDecompressor(decompressor Decompressor) {
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+
+	decompressors = append([]Decompressor{decompressor}, decompressors...)
+}
+
+// RegisterZstdDictionary makes zstd dictionary available for decompressing .deb members
+// compressed with dictionary (dictionaries are matched by ID stored in zstd frame)
+func RegisterZstdDictionary(dict []byte) {
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+
+	zstdDictionaries = append(zstdDictionaries, dict)
+}
+
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
+
+func openZstd(r io.Reader) (io.ReadCloser, error) {
+	decompressorsMu.RLock()
+	dicts := zstdDictionaries
+	decompressorsMu.RUnlock()
+
+	var options []zstd.DOption
+	if len(dicts) > 0 {
+		options = append(options, zstd.WithDecoderDicts(dicts...))
+	}
+
+	decoder, err := zstd.NewReader(r, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return zstdReadCloser{decoder}, nil
+}
+
+func init() {
+	// built-in formats, decompressors registered later take precedence
+	RegisterDecompressor(Decompressor{
+		Name:       "lzma",
+		Extensions: []string{".lzma"},
+		Open: func(r io.Reader) (io.ReadCloser, error) {
+			return lzma.NewReader(r), nil
+		},
+	})
+	RegisterDecompressor(Decompressor{
+		Name:       "bzip2",
+		Extensions: []string{".bz2"},
+		Magic:      [][]byte{[]byte("BZh")},
+		Open: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		},
+	})
+	RegisterDecompressor(Decompressor{
+		Name:       "gzip",
+		Extensions: []string{".gz"},
+		Magic:      [][]byte{{0x1f, 0x8b}},
+		Open: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	})
+	RegisterDecompressor(Decompressor{
+		Name:       "xz",
+		Extensions: []string{".xz"},
+		Magic:      [][]byte{{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+		Open: func(r io.Reader) (io.ReadCloser, error) {
+			return xz.NewReader(r)
+		},
+	})
+	RegisterDecompressor(Decompressor{
+		Name:       "zstd",
+		Extensions: []string{".zst", ".zstd"},
+		// regular frame and skippable frame (used by some tools for metadata)
+		Magic: [][]byte{{0x28, 0xb5, 0x2f, 0xfd}, {0x50, 0x2a, 0x4d, 0x18}},
+		Open:  openZstd,
+	})
+}
+
+// detectDecompressor finds decompressor by signature of the stream, falling back to extension
+//
+// Nil decompressor is returned for uncompressed tar.
+func detectDecompressor(signature []byte, extension string) (*Decompressor, error) {
+	if len(signature) >= 262 && matchers.Tar(signature) {
+		return nil, nil
+	}
+
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+
+	for i := range decompressors {
+		for _, magic := range decompressors[i].Magic {
+			if bytes.HasPrefix(signature, magic) {
+				return &decompressors[i], nil
+			}
+		}
+	}
+
+	for i := range decompressors {
+		for _, ext := range decompressors[i].Extensions {
+			if ext == extension {
+				return &decompressors[i], nil
+			}
+		}
+	}
+
+	if extension == "" {
+		// plain .tar member which doesn't look like tar, let tar reader report the problem
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported compression %s", extension)
+}
+
+// openDebMember returns reader of uncompressed tar stream for ar member like control.tar.*
+// or data.tar.*, autodetecting compression format
+func openDebMember(member io.Reader, name, prefix string) (io.ReadCloser, error) {
+	return openCompressed(member, strings.TrimPrefix(name, prefix))
+}
+
+// openCompressed returns reader of uncompressed stream, autodetecting compression format
+// by signature of the stream or by extension (like .gz)
+func openCompressed(r io.Reader, extension string) (io.ReadCloser, error) {
+	bufReader := bufio.NewReaderSize(r, 64*1024)
+
+	// error is ignored here: short streams are still fine for detection
+	signature, _ := bufReader.Peek(decompressorPeekSize)
+
+	decompressor, err := detectDecompressor(signature, extension)
+	if err != nil {
+		return nil, err
+	}
+
+	if decompressor == nil {
+		return io.NopCloser(bufReader), nil
+	}
+
+	reader, err := decompressor.Open(bufReader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress (%s): %s", decompressor.Name, err)
+	}
+
+	return reader, nil
+}
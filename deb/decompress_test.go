@@ -0,0 +1,123 @@
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	ar "github.com/mkrautz/goar"
+
+	. "gopkg.in/check.v1"
+)
+
+type DecompressSuite struct {
+	control []byte
+}
+
+var _ = Suite(&DecompressSuite{})
+
+func (s *DecompressSuite) SetUpTest(c *C) {
+	s.control = []byte("Package: test\nVersion: 1.0\nArchitecture: all\n")
+}
+
+func (s *DecompressSuite) controlTar(c *C) []byte {
+	var buf bytes.Buffer
+
+	w := tar.NewWriter(&buf)
+	c.Assert(w.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(s.control))}), IsNil)
+	_, err := w.Write(s.control)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	return buf.Bytes()
+}
+
+func (s *DecompressSuite) buildDeb(c *C, memberName string, member []byte) string {
+	path := filepath.Join(c.MkDir(), "test_1.0_all.deb")
+
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	w := ar.NewWriter(f)
+	for _, m := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{memberName, member},
+	} {
+		c.Assert(w.WriteHeader(&ar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.data))}), IsNil)
+		_, err = w.Write(m.data)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(w.Close(), IsNil)
+
+	return path
+}
+
+func (s *DecompressSuite) TestUncompressed(c *C) {
+	st, err := GetControlFileFromDeb(s.buildDeb(c, "control.tar", s.controlTar(c)))
+	c.Assert(err, IsNil)
+	c.Check(st["Package"], Equals, "test")
+}
+
+func (s *DecompressSuite) TestDetectByMagic(c *C) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(s.controlTar(c))
+	c.Assert(err, IsNil)
+	c.Assert(gz.Close(), IsNil)
+
+	// extension doesn't match contents
+	st, err := GetControlFileFromDeb(s.buildDeb(c, "control.tar.xz", buf.Bytes()))
+	c.Assert(err, IsNil)
+	c.Check(st["Version"], Equals, "1.0")
+
+	// uncompressed tar with compression extension
+	st, err = GetControlFileFromDeb(s.buildDeb(c, "control.tar.gz", s.controlTar(c)))
+	c.Assert(err, IsNil)
+	c.Check(st["Version"], Equals, "1.0")
+}
+
+func (s *DecompressSuite) TestZstd(c *C) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	c.Assert(err, IsNil)
+	compressed := enc.EncodeAll(s.controlTar(c), nil)
+	c.Assert(enc.Close(), IsNil)
+
+	st, err := GetControlFileFromDeb(s.buildDeb(c, "control.tar.zst", compressed))
+	c.Assert(err, IsNil)
+	c.Check(st["Architecture"], Equals, "all")
+}
+
+func (s *DecompressSuite) TestUnsupported(c *C) {
+	_, err := GetControlFileFromDeb(s.buildDeb(c, "control.tar.foo", []byte("some random garbage")))
+	c.Assert(err, ErrorMatches, "unable to read control.tar.foo from .*: unsupported compression .foo")
+}
+
+func (s *DecompressSuite) TestRegisterDecompressor(c *C) {
+	saved := decompressors
+	defer func() { decompressors = saved }()
+
+	// trivial "compression": magic prefix followed by plain tar
+	RegisterDecompressor(Decompressor{
+		Name:       "test",
+		Extensions: []string{".test"},
+		Magic:      [][]byte{[]byte("TEST")},
+		Open: func(r io.Reader) (io.ReadCloser, error) {
+			if _, err := io.ReadFull(r, make([]byte, 4)); err != nil {
+				return nil, err
+			}
+			return io.NopCloser(r), nil
+		},
+	})
+
+	st, err := GetControlFileFromDeb(s.buildDeb(c, "control.tar.test", append([]byte("TEST"), s.controlTar(c)...)))
+	c.Assert(err, IsNil)
+	c.Check(st["Package"], Equals, "test")
+}
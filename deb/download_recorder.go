@@ -0,0 +1,129 @@
+package deb
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// DownloadStatsRecorder collects downloads of package files in memory and writes
+// them in batches in background, so that serving files isn't slowed down by database
+type DownloadStatsRecorder struct {
+	mu      sync.Mutex
+	pending map[string]*PackageDownloads
+	write   func(downloads []*PackageDownloads) error
+	flushMu sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewDownloadStatsRecorder creates recorder which calls write with collected downloads every interval
+//
+// If write fails, downloads are kept and written with the next batch.
+func NewDownloadStatsRecorder(interval time.Duration, write func(downloads []*PackageDownloads) error) *DownloadStatsRecorder {
+	recorder := &DownloadStatsRecorder{
+		pending: make(map[string]*PackageDownloads),
+		write:   write,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go recorder.run(interval)
+
+	return recorder
+}
+
+// Record queues download of file at path at specified time
+//
+// Downloads of files which are not package files are ignored, in that case
+// false is returned.
+func (recorder *DownloadStatsRecorder) Record(path string, at time.Time) bool {
+	download := NewPackageDownloadsFromPath(path)
+	if download == nil {
+		return false
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	pending, ok := recorder.pending[download.Filename]
+	if !ok {
+		pending = download
+		recorder.pending[download.Filename] = pending
+	}
+
+	pending.Count++
+	if at.After(pending.LastAccess) {
+		pending.LastAccess = at
+	}
+
+	return true
+}
+
+// Flush writes downloads collected so far
+func (recorder *DownloadStatsRecorder) Flush() error {
+	recorder.flushMu.Lock()
+	defer recorder.flushMu.Unlock()
+
+	recorder.mu.Lock()
+	batch := recorder.pending
+	recorder.pending = make(map[string]*PackageDownloads)
+	recorder.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	downloads := make([]*PackageDownloads, 0, len(batch))
+	for _, download := range batch {
+		downloads = append(downloads, download)
+	}
+
+	err := recorder.write(downloads)
+	if err != nil {
+		// put downloads back, so that they are retried later
+		recorder.mu.Lock()
+		for _, download := range downloads {
+			pending, ok := recorder.pending[download.Filename]
+			if !ok {
+				recorder.pending[download.Filename] = download
+				continue
+			}
+
+			pending.Count += download.Count
+			if download.LastAccess.After(pending.LastAccess) {
+				pending.LastAccess = download.LastAccess
+			}
+		}
+		recorder.mu.Unlock()
+	}
+
+	return err
+}
+
+// Close stops background writes and writes remaining downloads
+func (recorder *DownloadStatsRecorder) Close() error {
+	close(recorder.stop)
+	<-recorder.done
+
+	return recorder.Flush()
+}
+
+func (recorder *DownloadStatsRecorder) run(interval time.Duration) {
+	defer close(recorder.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := recorder.Flush(); err != nil {
+				log.Printf("Unable to record downloads: %s\n", err)
+			}
+		case <-recorder.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package deb
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/ugorji/go/codec"
+)
+
+// PackageDownloads is download statistics for package file served from published repositories
+type PackageDownloads struct {
+	// Filename of package file (name_version_arch.deb)
+	Filename string
+	// Name of the package
+	Name string
+	// Version of the package
+	Version string
+	// Architecture of the package, empty for source packages
+	Architecture string `codec:",omitempty" json:",omitempty"`
+	// Number of downloads
+	Count int64
+	// Time of last download
+	LastAccess time.Time
+}
+
+// NewPackageDownloadsFromPath creates empty download statistics for package file at path
+//
+// If path doesn't point to package file (.deb, .udeb, .ddeb or .dsc), nil is returned.
+func NewPackageDownloadsFromPath(path string) *PackageDownloads {
+	filename := filepath.Base(path)
+	ext := filepath.Ext(filename)
+
+	switch ext {
+	case ".deb", ".udeb", ".ddeb", ".dsc":
+	default:
+		return nil
+	}
+
+	parts := strings.Split(strings.TrimSuffix(filename, ext), "_")
+
+	result := &PackageDownloads{Filename: filename}
+
+	if ext == ".dsc" {
+		if len(parts) != 2 {
+			return nil
+		}
+		result.Name, result.Version = parts[0], parts[1]
+	} else {
+		if len(parts) != 3 {
+			return nil
+		}
+		result.Name, result.Version, result.Architecture = parts[0], parts[1], parts[2]
+	}
+
+	if result.Name == "" || result.Version == "" {
+		return nil
+	}
+
+	return result
+}
+
+// Key is a unique id in DB
+func (d *PackageDownloads) Key() []byte {
+	return []byte("D" + d.Filename)
+}
+
+// Encode does msgpack encoding of PackageDownloads
+func (d *PackageDownloads) Encode() []byte {
+	var buf bytes.Buffer
+
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	encoder.Encode(d)
+
+	return buf.Bytes()
+}
+
+// Decode decodes msgpack representation into PackageDownloads
+func (d *PackageDownloads) Decode(input []byte) error {
+	decoder := codec.NewDecoderBytes(input, &codec.MsgpackHandle{})
+	return decoder.Decode(d)
+}
+
+// DownloadStatsCollection records and queries package download statistics
+type DownloadStatsCollection struct {
+	db database.Storage
+}
+
+// NewDownloadStatsCollection creates new DownloadStatsCollection and binds it to database
+func NewDownloadStatsCollection(db database.Storage) *DownloadStatsCollection {
+	return &DownloadStatsCollection{
+		db: db,
+	}
+}
+
+// Record registers download of file at path at specified time
+//
+// Downloads of files which are not package files are ignored, in that case
+// nil is returned.
+func (collection *DownloadStatsCollection) Record(path string, at time.Time) (*PackageDownloads, error) {
+	stats := NewPackageDownloadsFromPath(path)
+	if stats == nil {
+		return nil, nil
+	}
+
+	stats.Count = 1
+	stats.LastAccess = at
+
+	result, err := collection.RecordBatch([]*PackageDownloads{stats})
+	if err != nil {
+		return nil, err
+	}
+
+	return result[0], nil
+}
+
+// RecordBatch adds counts of downloads to statistics of package files in single transaction
+//
+// Updated statistics are returned in the same order.
+func (collection *DownloadStatsCollection) RecordBatch(downloads []*PackageDownloads) ([]*PackageDownloads, error) {
+	transaction, err := collection.db.OpenTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer transaction.Discard()
+
+	result := make([]*PackageDownloads, len(downloads))
+
+	for i, download := range downloads {
+		stats := &PackageDownloads{Filename: download.Filename, Name: download.Name,
+			Version: download.Version, Architecture: download.Architecture}
+
+		encoded, err := transaction.Get(stats.Key())
+		if err == nil {
+			if err = stats.Decode(encoded); err != nil {
+				return nil, err
+			}
+		} else if err != database.ErrNotFound {
+			return nil, err
+		}
+
+		stats.Count += download.Count
+		if download.LastAccess.After(stats.LastAccess) {
+			stats.LastAccess = download.LastAccess
+		}
+
+		if err = transaction.Put(stats.Key(), stats.Encode()); err != nil {
+			return nil, err
+		}
+
+		result[i] = stats
+	}
+
+	return result, transaction.Commit()
+}
+
+// ForEach runs method for download statistics of each package file
+func (collection *DownloadStatsCollection) ForEach(handler func(*PackageDownloads) error) error {
+	return collection.db.ProcessByPrefix([]byte("D"), func(_, blob []byte) error {
+		d := &PackageDownloads{}
+		if err := d.Decode(blob); err != nil {
+			log.Printf("Error decoding download statistics: %s\n", err)
+			return nil
+		}
+
+		return handler(d)
+	})
+}
+
+// Top returns limit most downloaded package files (all of them if limit is zero)
+func (collection *DownloadStatsCollection) Top(limit int) ([]*PackageDownloads, error) {
+	result := []*PackageDownloads{}
+
+	err := collection.ForEach(func(d *PackageDownloads) error {
+		result = append(result, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Count > result[j].Count })
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+// Stale returns package files which were not downloaded since specified time,
+// least recently downloaded first
+//
+// Only package files which were downloaded at least once are known to the statistics.
+func (collection *DownloadStatsCollection) Stale(since time.Time) ([]*PackageDownloads, error) {
+	result := []*PackageDownloads{}
+
+	err := collection.ForEach(func(d *PackageDownloads) error {
+		if d.LastAccess.Before(since) {
+			result = append(result, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].LastAccess.Before(result[j].LastAccess) })
+
+	return result, nil
+}
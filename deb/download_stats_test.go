@@ -0,0 +1,114 @@
+package deb
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+type DownloadStatsSuite struct {
+	db         database.Storage
+	collection *DownloadStatsCollection
+}
+
+var _ = Suite(&DownloadStatsSuite{})
+
+func (s *DownloadStatsSuite) SetUpTest(c *C) {
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.collection = NewDownloadStatsCollection(s.db)
+}
+
+func (s *DownloadStatsSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *DownloadStatsSuite) TestNewPackageDownloadsFromPath(c *C) {
+	d := NewPackageDownloadsFromPath("/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb")
+	c.Assert(d, NotNil)
+	c.Check(d.Filename, Equals, "alien-arena-common_7.40-2_i386.deb")
+	c.Check(d.Name, Equals, "alien-arena-common")
+	c.Check(d.Version, Equals, "7.40-2")
+	c.Check(d.Architecture, Equals, "i386")
+
+	d = NewPackageDownloadsFromPath("pool/main/a/alien-arena/alien-arena_7.40-2.dsc")
+	c.Assert(d, NotNil)
+	c.Check(d.Name, Equals, "alien-arena")
+	c.Check(d.Architecture, Equals, "")
+
+	c.Check(NewPackageDownloadsFromPath("dists/stable/Release"), IsNil)
+	c.Check(NewPackageDownloadsFromPath("pool/main/a/alien-arena/alien-arena_7.40.orig.tar.gz"), IsNil)
+	c.Check(NewPackageDownloadsFromPath("pool/main/a/alien-arena/broken.deb"), IsNil)
+}
+
+func (s *DownloadStatsSuite) TestRecord(c *C) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	d, err := s.collection.Record("dists/stable/InRelease", now)
+	c.Check(err, IsNil)
+	c.Check(d, IsNil)
+
+	_, err = s.collection.Record("pool/main/a/a_1.0_amd64.deb", now.Add(-48*time.Hour))
+	c.Assert(err, IsNil)
+	_, err = s.collection.Record("pool/main/b/b_2.0_all.deb", now.Add(-time.Hour))
+	c.Assert(err, IsNil)
+	d, err = s.collection.Record("other/prefix/pool/main/b/b_2.0_all.deb", now)
+	c.Assert(err, IsNil)
+	c.Check(d.Count, Equals, int64(2))
+	c.Check(d.LastAccess.Equal(now), Equals, true)
+
+	top, err := s.collection.Top(1)
+	c.Assert(err, IsNil)
+	c.Assert(top, HasLen, 1)
+	c.Check(top[0].Filename, Equals, "b_2.0_all.deb")
+
+	top, err = s.collection.Top(0)
+	c.Assert(err, IsNil)
+	c.Check(top, HasLen, 2)
+
+	stale, err := s.collection.Stale(now.Add(-24 * time.Hour))
+	c.Assert(err, IsNil)
+	c.Assert(stale, HasLen, 1)
+	c.Check(stale[0].Filename, Equals, "a_1.0_amd64.deb")
+	c.Check(stale[0].Count, Equals, int64(1))
+}
+
+func (s *DownloadStatsSuite) TestRecorder(c *C) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	fail := true
+	recorder := NewDownloadStatsRecorder(time.Hour, func(downloads []*PackageDownloads) error {
+		if fail {
+			return errors.New("database locked")
+		}
+		_, err := s.collection.RecordBatch(downloads)
+		return err
+	})
+
+	c.Check(recorder.Record("dists/stable/InRelease", now), Equals, false)
+	c.Check(recorder.Record("pool/main/a/a_1.0_amd64.deb", now.Add(-time.Hour)), Equals, true)
+	c.Check(recorder.Record("pool/main/a/a_1.0_amd64.deb", now), Equals, true)
+
+	// failed batch is kept for the next one
+	c.Check(recorder.Flush(), ErrorMatches, "database locked")
+	c.Check(recorder.Record("pool/main/b/b_2.0_all.deb", now), Equals, true)
+
+	top, err := s.collection.Top(0)
+	c.Assert(err, IsNil)
+	c.Check(top, HasLen, 0)
+
+	fail = false
+	c.Check(recorder.Record("pool/main/a/a_1.0_amd64.deb", now.Add(-2*time.Hour)), Equals, true)
+	c.Check(recorder.Close(), IsNil)
+
+	top, err = s.collection.Top(0)
+	c.Assert(err, IsNil)
+	c.Assert(top, HasLen, 2)
+	c.Check(top[0].Filename, Equals, "a_1.0_amd64.deb")
+	c.Check(top[0].Count, Equals, int64(3))
+	c.Check(top[0].LastAccess.Equal(now), Equals, true)
+	c.Check(top[1].Count, Equals, int64(1))
+}
@@ -26,6 +26,7 @@ var (
 		"Version",
 		"Codename",
 		"Date",
+		"Valid-Until",
 		"NotAutomatic",
 		"ButAutomaticUpgrades",
 		"Architectures",
@@ -220,6 +221,8 @@ func canonicalCase(field string) string {
 		return "NotAutomatic"
 	case "BUTAUTOMATICUPGRADES":
 		return "ButAutomaticUpgrades"
+	case "NO-SUPPORT-FOR-ARCHITECTURE-ALL":
+		return "No-Support-for-Architecture-all"
 	}
 
 	startOfWord := true
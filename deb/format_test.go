@@ -157,6 +157,7 @@ func (s *ControlFileSuite) TestCanonicalCase(c *C) {
 	c.Check(canonicalCase("SHA256"), Equals, "SHA256")
 	c.Check(canonicalCase("Package-List"), Equals, "Package-List")
 	c.Check(canonicalCase("package-list"), Equals, "Package-List")
+	c.Check(canonicalCase("No-Support-for-Architecture-all"), Equals, "No-Support-for-Architecture-all")
 	c.Check(canonicalCase("packaGe-lIst"), Equals, "Package-List")
 }
 
@@ -0,0 +1,497 @@
+package deb
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/pgp"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// Categories of problems found by Fsck
+const (
+	// package referenced by mirror, local repo, snapshot or published repository is missing in DB
+	FsckMissingPackage = "missing-package"
+	// source of published repository is missing in DB
+	FsckBrokenSource = "broken-source"
+	// file of package is missing in package pool
+	FsckMissingPoolFile = "missing-pool-file"
+	// file in package pool has size or checksum different from DB
+	FsckPoolChecksumDrift = "pool-checksum-drift"
+	// file in package pool isn't referenced by any package
+	FsckOrphanedPoolFile = "orphaned-pool-file"
+	// published index or package file is missing
+	FsckMissingPublishedFile = "missing-published-file"
+	// published index or package file has size or checksum different from Release file or index
+	FsckPublishedChecksumDrift = "published-checksum-drift"
+	// published Release file or index can't be parsed
+	FsckBrokenPublishedIndex = "broken-published-index"
+	// file in pool of published prefix isn't referenced by any published repository
+	FsckOrphanedPublishedFile = "orphaned-published-file"
+)
+
+// FsckProblem is a single inconsistency found by Fsck
+type FsckProblem struct {
+	// Category of problem
+	Category string `json:"Category"`
+	// Object problem was found in: package, mirror, local repo, snapshot, published repository or prefix
+	Object string `json:"Object"`
+	// Path of file (or package key) related to problem
+	Path string `json:"Path"`
+	// Details of problem
+	Details string `json:"Details,omitempty"`
+	// Problem was fixed by repair action
+	Repaired bool `json:"Repaired"`
+}
+
+// FsckReport is result of checking consistency of DB, package pool and published repositories
+type FsckReport struct {
+	// Number of packages checked
+	Packages int `json:"Packages"`
+	// Number of files in package pool checked
+	PoolFiles int `json:"PoolFiles"`
+	// Number of published repositories checked
+	Published int `json:"Published"`
+	// Problems found
+	Problems []*FsckProblem `json:"Problems"`
+}
+
+// FsckOptions controls checks and repair actions of Fsck
+type FsckOptions struct {
+	// Verify checksums of files in package pool and published package files (slow)
+	Checksums bool
+	// Remove orphaned files and re-publish published repositories with missing or broken files
+	Repair bool
+	// Signer used to re-publish published repositories
+	Signer pgp.FileSigner
+	// Skeleton files directory used to re-publish published repositories
+	SkelDir string
+}
+
+func (report *FsckReport) problem(category, object, path, format string, args ...interface{}) *FsckProblem {
+	problem := &FsckProblem{Category: category, Object: object, Path: path, Details: fmt.Sprintf(format, args...)}
+	report.Problems = append(report.Problems, problem)
+
+	return problem
+}
+
+// Repaired returns number of problems which were fixed
+func (report *FsckReport) Repaired() (count int) {
+	for _, problem := range report.Problems {
+		if problem.Repaired {
+			count++
+		}
+	}
+
+	return
+}
+
+// ByCategory returns number of problems in each category
+func (report *FsckReport) ByCategory() map[string]int {
+	result := map[string]int{}
+	for _, problem := range report.Problems {
+		result[problem.Category]++
+	}
+
+	return result
+}
+
+// fsckRefList reports packages referenced by reflist which are missing in DB
+func fsckRefList(report *FsckReport, object string, reflist, allRefs *PackageRefList) {
+	if reflist == nil {
+		return
+	}
+
+	reflist.Subtract(allRefs).ForEach(func(key []byte) error {
+		report.problem(FsckMissingPackage, object, string(key), "package is missing in DB")
+		return nil
+	})
+}
+
+// fsckDatabase checks that all packages referenced by mirrors, local repos, snapshots
+// and published repositories are present in DB
+func fsckDatabase(collectionFactory *CollectionFactory, allRefs *PackageRefList, report *FsckReport) error {
+	err := collectionFactory.RemoteRepoCollection().ForEach(func(repo *RemoteRepo) error {
+		if e := collectionFactory.RemoteRepoCollection().LoadComplete(repo); e != nil {
+			return e
+		}
+
+		fsckRefList(report, fmt.Sprintf("mirror %s", repo.Name), repo.RefList(), allRefs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = collectionFactory.LocalRepoCollection().ForEach(func(repo *LocalRepo) error {
+		if e := collectionFactory.LocalRepoCollection().LoadComplete(repo); e != nil {
+			return e
+		}
+
+		fsckRefList(report, fmt.Sprintf("local repo %s", repo.Name), repo.RefList(), allRefs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return collectionFactory.SnapshotCollection().ForEach(func(snapshot *Snapshot) error {
+		if e := collectionFactory.SnapshotCollection().LoadComplete(snapshot); e != nil {
+			return e
+		}
+
+		fsckRefList(report, fmt.Sprintf("snapshot %s", snapshot.Name), snapshot.RefList(), allRefs)
+		return nil
+	})
+}
+
+// fsckPool checks that files of all packages are present in the package pool with
+// expected size (and checksums), and finds files in the pool not referenced by any package
+func fsckPool(collectionFactory *CollectionFactory, allRefs *PackageRefList, packagePool aptly.PackagePool,
+	options FsckOptions, report *FsckReport, progress aptly.Progress) error {
+	referencedFiles := []string{}
+
+	err := allRefs.ForEach(func(key []byte) error {
+		pkg, err := collectionFactory.PackageCollection().ByKey(key)
+		if err != nil {
+			report.problem(FsckMissingPackage, "package pool", string(key), "unable to load package: %s", err)
+			return nil
+		}
+		report.Packages++
+
+		for _, f := range pkg.Files() {
+			poolPath, err := f.GetPoolPath(packagePool)
+			if err != nil {
+				report.problem(FsckMissingPoolFile, pkg.String(), f.Filename, "unable to find pool path: %s", err)
+				continue
+			}
+
+			referencedFiles = append(referencedFiles, poolPath)
+			report.PoolFiles++
+
+			size, err := packagePool.Size(poolPath)
+			if err != nil {
+				report.problem(FsckMissingPoolFile, pkg.String(), poolPath, "%s", err)
+				continue
+			}
+
+			if size != f.Checksums.Size {
+				report.problem(FsckPoolChecksumDrift, pkg.String(), poolPath, "size mismatch: expected %d, got %d", f.Checksums.Size, size)
+				continue
+			}
+
+			if options.Checksums {
+				if problem := fsckPoolChecksums(packagePool, poolPath, f.Checksums); problem != "" {
+					report.problem(FsckPoolChecksumDrift, pkg.String(), poolPath, "%s", problem)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(referencedFiles)
+	referencedFiles = utils.StrSliceDeduplicate(referencedFiles)
+
+	existingFiles, err := packagePool.FilepathList(progress)
+	if err != nil {
+		return fmt.Errorf("unable to collect file paths: %s", err)
+	}
+	sort.Strings(existingFiles)
+
+	for _, file := range utils.StrSlicesSubstract(existingFiles, referencedFiles) {
+		problem := report.problem(FsckOrphanedPoolFile, "package pool", file, "file isn't referenced by any package")
+
+		if options.Repair {
+			if _, err = packagePool.Remove(file); err != nil {
+				problem.Details = fmt.Sprintf("unable to remove: %s", err)
+				continue
+			}
+			problem.Repaired = true
+		}
+	}
+
+	return nil
+}
+
+// fsckPoolChecksums compares checksums of file in the pool with expected ones
+func fsckPoolChecksums(packagePool aptly.PackagePool, poolPath string, expected utils.ChecksumInfo) string {
+	file, err := packagePool.Open(poolPath)
+	if err != nil {
+		return fmt.Sprintf("unable to open: %s", err)
+	}
+	defer file.Close()
+
+	actual, err := utils.ChecksumsForReader(file)
+	if err != nil {
+		return fmt.Sprintf("unable to read: %s", err)
+	}
+
+	if expected.SHA256 != "" && actual.SHA256 != expected.SHA256 {
+		return fmt.Sprintf("SHA256 mismatch: expected %s, got %s", expected.SHA256, actual.SHA256)
+	}
+
+	if expected.MD5 != "" && actual.MD5 != expected.MD5 {
+		return fmt.Sprintf("MD5 mismatch: expected %s, got %s", expected.MD5, actual.MD5)
+	}
+
+	return ""
+}
+
+// publishedPoolFiles returns package files published repository links into pool of its prefix
+func publishedPoolFiles(p *PublishedRepo, collectionFactory *CollectionFactory) ([]string, error) {
+	result := []string{}
+
+	for _, component := range p.Components() {
+		list, err := NewPackageListFromRefList(p.RefList(component), collectionFactory.PackageCollection(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		poolBase := component
+		if p.MultiDist {
+			poolBase = filepath.Join(p.Distribution, component)
+		}
+
+		err = list.ForEach(func(pkg *Package) error {
+			if pkg.IsInstaller {
+				return nil
+			}
+
+			for _, arch := range p.Architectures {
+				if pkg.MatchesArchitecture(arch) {
+					poolDir, err := pkg.PoolDirectory()
+					if err != nil {
+						return err
+					}
+
+					for _, f := range pkg.Files() {
+						result = append(result, filepath.Join(poolBase, poolDir, f.Filename))
+					}
+					break
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// fsckPublished checks published repositories on all storages: files listed in Release
+// files and indexes, package files linked from package pool and orphaned files in pool of
+// published prefixes
+func fsckPublished(collectionFactory *CollectionFactory, packagePool aptly.PackagePool, publishedStorageProvider aptly.PublishedStorageProvider,
+	options FsckOptions, report *FsckReport, progress aptly.Progress) error {
+	collection := collectionFactory.PublishedRepoCollection()
+
+	type prefixKey struct{ storage, prefix string }
+
+	prefixes := map[prefixKey][]*PublishedRepo{}
+	keys := []prefixKey{}
+
+	err := collection.ForEach(func(p *PublishedRepo) error {
+		key := prefixKey{p.Storage, p.Prefix}
+		if _, exists := prefixes[key]; !exists {
+			keys = append(keys, key)
+		}
+		prefixes[key] = append(prefixes[key], p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].storage < keys[j].storage || keys[i].storage == keys[j].storage && keys[i].prefix < keys[j].prefix
+	})
+
+	allRefs := collectionFactory.PackageCollection().AllPackageRefs()
+
+	for _, key := range keys {
+		storage := publishedStorageProvider.GetPublishedStorage(key.storage)
+		object := strings.TrimPrefix(key.storage+":"+key.prefix, ":")
+
+		if progress != nil {
+			progress.Printf("Checking published repositories in %s...\n", object)
+		}
+
+		existingFiles, err := storage.Filelist(filepath.Join(key.prefix, "pool"))
+		if err != nil {
+			return fmt.Errorf("unable to list files of %s: %s", object, err)
+		}
+		sort.Strings(existingFiles)
+
+		referencedFiles := []string{}
+		republish := map[*PublishedRepo][]*FsckProblem{}
+
+		for _, p := range prefixes[key] {
+			report.Published++
+
+			if err = collection.LoadComplete(p, collectionFactory); err != nil {
+				report.problem(FsckBrokenSource, p.String(), "", "unable to load sources: %s", err)
+				continue
+			}
+
+			for _, component := range p.Components() {
+				fsckRefList(report, fmt.Sprintf("published repository %s component %s", p.String(), component), p.RefList(component), allRefs)
+			}
+
+			files, err := publishedPoolFiles(p, collectionFactory)
+			if err != nil {
+				report.problem(FsckMissingPackage, p.String(), "", "unable to load packages: %s", err)
+				continue
+			}
+			referencedFiles = append(referencedFiles, files...)
+
+			sort.Strings(files)
+			for _, file := range utils.StrSlicesSubstract(utils.StrSliceDeduplicate(files), existingFiles) {
+				republish[p] = append(republish[p], report.problem(FsckMissingPublishedFile, p.String(),
+					filepath.Join("pool", file), "package file is missing"))
+			}
+
+			if _, readable := storage.(aptly.ReadablePublishedStorage); !readable {
+				// published storage doesn't allow to read Release files back
+				continue
+			}
+
+			poolSample := 0
+			if options.Checksums {
+				poolSample = -1
+			}
+
+			verify, err := p.Verify(publishedStorageProvider, nil, poolSample)
+			if err != nil {
+				republish[p] = append(republish[p], report.problem(FsckMissingPublishedFile, p.String(),
+					filepath.Join(p.releaseDir(), "Release"), "%s", err))
+				continue
+			}
+
+			for _, verifyProblem := range verify.Problems {
+				var category string
+
+				switch verifyProblem.Kind {
+				case VerifyProblemMissing:
+					if strings.HasPrefix(verifyProblem.Path, "pool/") {
+						// already reported from pool file list
+						continue
+					}
+					category = FsckMissingPublishedFile
+				case VerifyProblemChecksum:
+					category = FsckPublishedChecksumDrift
+				default:
+					category = FsckBrokenPublishedIndex
+				}
+
+				republish[p] = append(republish[p], report.problem(category, p.String(), verifyProblem.Path, "%s", verifyProblem.Problem))
+			}
+		}
+
+		sort.Strings(referencedFiles)
+		referencedFiles = utils.StrSliceDeduplicate(referencedFiles)
+
+		for _, file := range utils.StrSlicesSubstract(existingFiles, referencedFiles) {
+			if filepath.Base(file) == IndexPageName {
+				continue
+			}
+
+			problem := report.problem(FsckOrphanedPublishedFile, object, filepath.Join("pool", file), "file isn't referenced by any published repository")
+
+			if options.Repair {
+				if err = storage.Remove(filepath.Join(key.prefix, "pool", file)); err != nil {
+					problem.Details = fmt.Sprintf("unable to remove: %s", err)
+					continue
+				}
+				problem.Repaired = true
+			}
+		}
+
+		if !options.Repair {
+			continue
+		}
+
+		for _, p := range prefixes[key] {
+			problems := republish[p]
+			if len(problems) == 0 {
+				continue
+			}
+
+			err = p.CheckFrozen()
+			if err == nil {
+				if progress != nil {
+					progress.Printf("Re-publishing %s...\n", p.String())
+				}
+
+				p.rePublishing = true
+				err = p.Publish(packagePool, publishedStorageProvider, collectionFactory, options.Signer, progress, true, options.SkelDir)
+			}
+			if err == nil {
+				err = collection.Update(p)
+			}
+
+			for _, problem := range problems {
+				if err != nil {
+					problem.Details = fmt.Sprintf("%s (unable to re-publish: %s)", problem.Details, err)
+				} else {
+					problem.Repaired = true
+				}
+			}
+		}
+
+		if err = flushPublishedStorage(storage); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fsck checks that aptly DB, package pool and published repositories agree with each other:
+//
+//   - all packages referenced by mirrors, local repos, snapshots and published repositories exist in DB
+//   - all files of packages exist in package pool with expected size (and checksums)
+//   - package pool doesn't have files not referenced by packages
+//   - files of published repositories match their Release files and indexes, package files
+//     are linked into pool of publishing prefix, which doesn't have unreferenced files
+//
+// With Repair option orphaned files are removed and published repositories with missing
+// or broken files are re-published. Missing packages and pool files can't be repaired,
+// mirrors should be updated and packages re-imported instead.
+func Fsck(collectionFactory *CollectionFactory, packagePool aptly.PackagePool, publishedStorageProvider aptly.PublishedStorageProvider,
+	options FsckOptions, progress aptly.Progress) (*FsckReport, error) {
+	report := &FsckReport{Problems: []*FsckProblem{}}
+
+	if progress != nil {
+		progress.Printf("Checking packages referenced by mirrors, local repos and snapshots...\n")
+	}
+
+	allRefs := collectionFactory.PackageCollection().AllPackageRefs()
+
+	if err := fsckDatabase(collectionFactory, allRefs, report); err != nil {
+		return nil, err
+	}
+
+	if progress != nil {
+		progress.Printf("Checking package pool...\n")
+	}
+
+	if err := fsckPool(collectionFactory, allRefs, packagePool, options, report, progress); err != nil {
+		return nil, err
+	}
+
+	if err := fsckPublished(collectionFactory, packagePool, publishedStorageProvider, options, report, progress); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
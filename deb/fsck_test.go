@@ -0,0 +1,71 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/aptly-dev/aptly/files"
+	. "gopkg.in/check.v1"
+)
+
+func (s *PublishedRepoSuite) TestFsck(c *C) {
+	// package pool of suite shares root with published storage
+	poolRoot := c.MkDir()
+	packagePool := files.NewPackagePool(poolRoot, false)
+
+	tmpFilepath := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(tmpFilepath, nil, 0777), IsNil)
+	_, err := packagePool.Import(tmpFilepath, s.p1.Files()[0].Filename, &s.p1.Files()[0].Checksums, false, s.cs)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.repo.Publish(packagePool, s.provider, s.factory, nil, nil, false, ""), IsNil)
+	c.Assert(s.factory.PublishedRepoCollection().Add(s.repo), IsNil)
+
+	report, err := Fsck(s.factory, packagePool, s.provider, FsckOptions{Checksums: true}, nil)
+	c.Assert(err, IsNil)
+	c.Check(report.Problems, DeepEquals, []*FsckProblem{})
+	c.Check(report.Packages, Equals, 3)
+	c.Check(report.Published, Equals, 1)
+
+	published, err := s.publishedStorage.Filelist("ppa/pool")
+	c.Assert(err, IsNil)
+	c.Assert(published, HasLen, 1)
+
+	// break published pool file, add orphaned files to published and package pool
+	c.Assert(os.Remove(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool", published[0])), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main/orphan.deb"), []byte("orphan"), 0644), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(poolRoot, "pool/00/00"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(poolRoot, "pool/00/00/orphan.deb"), []byte("orphan"), 0644), IsNil)
+
+	// reference package missing in DB
+	list := NewPackageList()
+	c.Assert(list.Add(&Package{Name: "ghost", Version: "1.0", Architecture: "i386"}), IsNil)
+	ghost := NewLocalRepo("ghost", "")
+	ghost.UpdateRefList(NewPackageRefListFromPackageList(list))
+	c.Assert(s.factory.LocalRepoCollection().Add(ghost), IsNil)
+
+	report, err = Fsck(s.factory, packagePool, s.provider, FsckOptions{}, nil)
+	c.Assert(err, IsNil)
+	c.Check(report.ByCategory(), DeepEquals, map[string]int{
+		FsckMissingPackage:        1,
+		FsckMissingPublishedFile:  1,
+		FsckOrphanedPoolFile:      1,
+		FsckOrphanedPublishedFile: 1,
+	})
+	c.Check(report.Repaired(), Equals, 0)
+
+	report, err = Fsck(s.factory, packagePool, s.provider, FsckOptions{Repair: true}, nil)
+	c.Assert(err, IsNil)
+	c.Check(report.Problems, HasLen, 4)
+	c.Check(report.Repaired(), Equals, 3)
+
+	for _, problem := range report.Problems {
+		c.Check(problem.Repaired, Equals, problem.Category != FsckMissingPackage)
+	}
+
+	c.Assert(s.factory.LocalRepoCollection().Drop(ghost), IsNil)
+
+	report, err = Fsck(s.factory, packagePool, s.provider, FsckOptions{Checksums: true}, nil)
+	c.Assert(err, IsNil)
+	c.Check(report.Problems, DeepEquals, []*FsckProblem{})
+}
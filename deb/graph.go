@@ -7,44 +7,87 @@ import (
 	"github.com/awalterschulze/gographviz"
 )
 
-// BuildGraph generates graph contents from aptly object database
-func BuildGraph(collectionFactory *CollectionFactory, layout string) (gographviz.Interface, error) {
-	var err error
+// Resource graph node types
+const (
+	GraphNodeMirror    = "mirror"
+	GraphNodeRepo      = "repo"
+	GraphNodeSnapshot  = "snapshot"
+	GraphNodePublished = "published"
+)
 
-	graph := gographviz.NewEscape()
-	graph.SetDir(true)
-	graph.SetName("aptly")
+// Resource graph edge types
+const (
+	// mirror or local repo -> snapshot
+	GraphEdgeSnapshot = "snapshot"
+	// snapshot -> snapshot created from one (filter, pull) or several (merge) snapshots
+	GraphEdgeDerive = "derive"
+	GraphEdgeMerge  = "merge"
+	// mirror, local repo or snapshot -> published repository
+	GraphEdgePublish = "publish"
+)
 
-	var labelStart string
-	var labelEnd string
+// GraphNode is a resource in resource graph
+type GraphNode struct {
+	// UUID of resource
+	ID string `json:"ID"`
+	// Type of resource: mirror, repo, snapshot or published
+	Type string `json:"Type"`
+	// Name of resource (path for published repositories)
+	Name string `json:"Name"`
+	// Snapshot description or local repo comment
+	Description string `json:"Description,omitempty"`
+	// Archive URL of mirror
+	URL string `json:"URL,omitempty"`
+	// Distribution of mirror or published repository
+	Distribution string `json:"Distribution,omitempty"`
+	// Published storage of published repository
+	Storage string `json:"Storage,omitempty"`
+	// Prefix of published repository
+	Prefix        string   `json:"Prefix,omitempty"`
+	Components    []string `json:"Components,omitempty"`
+	Architectures []string `json:"Architectures,omitempty"`
+	// Number of packages in mirror, local repo or snapshot
+	Packages int `json:"Packages"`
 
-	switch layout {
-	case "vertical":
-		graph.AddAttr("aptly", "rankdir", "LR")
-		labelStart = ""
-		labelEnd = ""
-	case "horizontal":
-		fallthrough
-	default:
-		labelStart = "{"
-		labelEnd = "}"
-	}
+	snapshotFromMirror bool
+}
+
+// GraphEdge is a relationship between resources: data flows from source to target
+type GraphEdge struct {
+	From string `json:"From"`
+	To   string `json:"To"`
+	// Type of relationship: snapshot, derive, merge or publish
+	Type string `json:"Type"`
+	// Published component, for publish edges
+	Component string `json:"Component,omitempty"`
+}
+
+// ResourceGraph is graph of data flow between mirrors, local repos, snapshots and published repositories
+type ResourceGraph struct {
+	Nodes []*GraphNode `json:"Nodes"`
+	Edges []*GraphEdge `json:"Edges"`
+}
 
+// BuildResourceGraph collects resources and relationships between them from aptly object database
+func BuildResourceGraph(collectionFactory *CollectionFactory) (*ResourceGraph, error) {
+	result := &ResourceGraph{Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
 	existingNodes := map[string]bool{}
 
-	err = collectionFactory.RemoteRepoCollection().ForEach(func(repo *RemoteRepo) error {
+	err := collectionFactory.RemoteRepoCollection().ForEach(func(repo *RemoteRepo) error {
 		e := collectionFactory.RemoteRepoCollection().LoadComplete(repo)
 		if e != nil {
 			return e
 		}
 
-		graph.AddNode("aptly", repo.UUID, map[string]string{
-			"shape":     "Mrecord",
-			"style":     "filled",
-			"fillcolor": "darkgoldenrod1",
-			"label": fmt.Sprintf("%sMirror %s|url: %s|dist: %s|comp: %s|arch: %s|pkgs: %d%s", labelStart, repo.Name, repo.ArchiveRoot,
-				repo.Distribution, strings.Join(repo.Components, ", "),
-				strings.Join(repo.Architectures, ", "), repo.NumPackages(), labelEnd),
+		result.Nodes = append(result.Nodes, &GraphNode{
+			ID:            repo.UUID,
+			Type:          GraphNodeMirror,
+			Name:          repo.Name,
+			URL:           repo.ArchiveRoot,
+			Distribution:  repo.Distribution,
+			Components:    repo.Components,
+			Architectures: repo.Architectures,
+			Packages:      repo.NumPackages(),
 		})
 		existingNodes[repo.UUID] = true
 		return nil
@@ -60,12 +103,12 @@ func BuildGraph(collectionFactory *CollectionFactory, layout string) (gographviz
 			return e
 		}
 
-		graph.AddNode("aptly", repo.UUID, map[string]string{
-			"shape":     "Mrecord",
-			"style":     "filled",
-			"fillcolor": "mediumseagreen",
-			"label": fmt.Sprintf("%sRepo %s|comment: %s|pkgs: %d%s", labelStart,
-				repo.Name, repo.Comment, repo.NumPackages(), labelEnd),
+		result.Nodes = append(result.Nodes, &GraphNode{
+			ID:          repo.UUID,
+			Type:        GraphNodeRepo,
+			Name:        repo.Name,
+			Description: repo.Comment,
+			Packages:    repo.NumPackages(),
 		})
 		existingNodes[repo.UUID] = true
 		return nil
@@ -86,24 +129,28 @@ func BuildGraph(collectionFactory *CollectionFactory, layout string) (gographviz
 			return e
 		}
 
-		description := snapshot.Description
-		if snapshot.SourceKind == SourceRemoteRepo {
-			description = "Snapshot from repo"
-		}
-
-		graph.AddNode("aptly", snapshot.UUID, map[string]string{
-			"shape":     "Mrecord",
-			"style":     "filled",
-			"fillcolor": "cadetblue1",
-			"label": fmt.Sprintf("%sSnapshot %s|%s|pkgs: %d%s", labelStart,
-				snapshot.Name, description, snapshot.NumPackages(), labelEnd),
+		result.Nodes = append(result.Nodes, &GraphNode{
+			ID:                 snapshot.UUID,
+			Type:               GraphNodeSnapshot,
+			Name:               snapshot.Name,
+			Description:        snapshot.Description,
+			Packages:           snapshot.NumPackages(),
+			snapshotFromMirror: snapshot.SourceKind == SourceRemoteRepo,
 		})
 
+		edgeType := GraphEdgeSnapshot
+		if snapshot.SourceKind == SourceSnapshot {
+			edgeType = GraphEdgeDerive
+			if len(snapshot.SourceIDs) > 1 {
+				edgeType = GraphEdgeMerge
+			}
+		}
+
 		if snapshot.SourceKind == SourceRemoteRepo || snapshot.SourceKind == SourceLocalRepo || snapshot.SourceKind == SourceSnapshot {
 			for _, uuid := range snapshot.SourceIDs {
 				_, exists := existingNodes[uuid]
 				if exists {
-					graph.AddEdge(uuid, snapshot.UUID, true, nil)
+					result.Edges = append(result.Edges, &GraphEdge{From: uuid, To: snapshot.UUID, Type: edgeType})
 				}
 			}
 		}
@@ -115,24 +162,102 @@ func BuildGraph(collectionFactory *CollectionFactory, layout string) (gographviz
 	}
 
 	collectionFactory.PublishedRepoCollection().ForEach(func(repo *PublishedRepo) error {
-		graph.AddNode("aptly", repo.UUID, map[string]string{
-			"shape":     "Mrecord",
-			"style":     "filled",
-			"fillcolor": "darkolivegreen1",
-			"label": fmt.Sprintf("%sPublished %s|comp: %s|arch: %s%s", labelStart,
-				repo.GetPath(), strings.Join(repo.Components(), " "),
-				strings.Join(repo.Architectures, ", "), labelEnd),
+		result.Nodes = append(result.Nodes, &GraphNode{
+			ID:            repo.UUID,
+			Type:          GraphNodePublished,
+			Name:          repo.GetPath(),
+			Distribution:  repo.Distribution,
+			Storage:       repo.Storage,
+			Prefix:        repo.Prefix,
+			Components:    repo.Components(),
+			Architectures: repo.Architectures,
 		})
 
-		for _, uuid := range repo.Sources {
+		for _, component := range repo.Components() {
+			uuid := repo.Sources[component]
 			_, exists := existingNodes[uuid]
 			if exists {
-				graph.AddEdge(uuid, repo.UUID, true, nil)
+				result.Edges = append(result.Edges, &GraphEdge{From: uuid, To: repo.UUID, Type: GraphEdgePublish, Component: component})
 			}
 		}
 
 		return nil
 	})
 
-	return graph, nil
+	return result, nil
+}
+
+// Dot renders resource graph in graphviz format
+func (graph *ResourceGraph) Dot(layout string) gographviz.Interface {
+	dot := gographviz.NewEscape()
+	dot.SetDir(true)
+	dot.SetName("aptly")
+
+	var labelStart string
+	var labelEnd string
+
+	switch layout {
+	case "vertical":
+		dot.AddAttr("aptly", "rankdir", "LR")
+		labelStart = ""
+		labelEnd = ""
+	case "horizontal":
+		fallthrough
+	default:
+		labelStart = "{"
+		labelEnd = "}"
+	}
+
+	for _, node := range graph.Nodes {
+		var fillcolor, label string
+
+		switch node.Type {
+		case GraphNodeMirror:
+			fillcolor = "darkgoldenrod1"
+			label = fmt.Sprintf("%sMirror %s|url: %s|dist: %s|comp: %s|arch: %s|pkgs: %d%s", labelStart, node.Name, node.URL,
+				node.Distribution, strings.Join(node.Components, ", "),
+				strings.Join(node.Architectures, ", "), node.Packages, labelEnd)
+		case GraphNodeRepo:
+			fillcolor = "mediumseagreen"
+			label = fmt.Sprintf("%sRepo %s|comment: %s|pkgs: %d%s", labelStart,
+				node.Name, node.Description, node.Packages, labelEnd)
+		case GraphNodeSnapshot:
+			description := node.Description
+			if node.snapshotFromMirror {
+				description = "Snapshot from repo"
+			}
+
+			fillcolor = "cadetblue1"
+			label = fmt.Sprintf("%sSnapshot %s|%s|pkgs: %d%s", labelStart,
+				node.Name, description, node.Packages, labelEnd)
+		case GraphNodePublished:
+			fillcolor = "darkolivegreen1"
+			label = fmt.Sprintf("%sPublished %s|comp: %s|arch: %s%s", labelStart,
+				node.Name, strings.Join(node.Components, " "),
+				strings.Join(node.Architectures, ", "), labelEnd)
+		}
+
+		dot.AddNode("aptly", node.ID, map[string]string{
+			"shape":     "Mrecord",
+			"style":     "filled",
+			"fillcolor": fillcolor,
+			"label":     label,
+		})
+	}
+
+	for _, edge := range graph.Edges {
+		dot.AddEdge(edge.From, edge.To, true, nil)
+	}
+
+	return dot
+}
+
+// BuildGraph generates graph contents from aptly object database
+func BuildGraph(collectionFactory *CollectionFactory, layout string) (gographviz.Interface, error) {
+	graph, err := BuildResourceGraph(collectionFactory)
+	if err != nil {
+		return nil, err
+	}
+
+	return graph.Dot(layout), nil
 }
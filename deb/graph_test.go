@@ -0,0 +1,91 @@
+package deb
+
+import (
+	"strings"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+type GraphSuite struct {
+	PackageListMixinSuite
+	db      database.Storage
+	factory *CollectionFactory
+}
+
+var _ = Suite(&GraphSuite{})
+
+func (s *GraphSuite) SetUpTest(c *C) {
+	s.SetUpPackages()
+
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.factory = NewCollectionFactory(s.db)
+}
+
+func (s *GraphSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *GraphSuite) TestBuildResourceGraph(c *C) {
+	mirror, _ := NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian/", "squeeze", []string{"main"}, []string{"i386"}, false, false, false)
+	mirror.packageRefs = s.reflist
+	c.Assert(s.factory.RemoteRepoCollection().Add(mirror), IsNil)
+
+	repo := NewLocalRepo("local", "my comment")
+	repo.UpdateRefList(s.reflist)
+	c.Assert(s.factory.LocalRepoCollection().Add(repo), IsNil)
+
+	snap1, _ := NewSnapshotFromRepository("snap1", mirror)
+	c.Assert(s.factory.SnapshotCollection().Add(snap1), IsNil)
+
+	snap2, _ := NewSnapshotFromLocalRepo("snap2", repo)
+	c.Assert(s.factory.SnapshotCollection().Add(snap2), IsNil)
+
+	merged := NewSnapshotFromRefList("merged", []*Snapshot{snap1, snap2}, s.reflist, "Merged from sources")
+	c.Assert(s.factory.SnapshotCollection().Add(merged), IsNil)
+
+	published, err := NewPublishedRepo("", "ppa", "squeeze", nil, []string{"main", "contrib"}, []interface{}{merged, snap2}, s.factory, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.factory.PublishedRepoCollection().Add(published), IsNil)
+
+	graph, err := BuildResourceGraph(s.factory)
+	c.Assert(err, IsNil)
+
+	nodes := map[string]*GraphNode{}
+	for _, node := range graph.Nodes {
+		nodes[node.ID] = node
+	}
+	c.Assert(nodes, HasLen, 6)
+
+	c.Check(nodes[mirror.UUID].Type, Equals, GraphNodeMirror)
+	c.Check(nodes[mirror.UUID].URL, Equals, "http://mirror.yandex.ru/debian/")
+	c.Check(nodes[repo.UUID].Type, Equals, GraphNodeRepo)
+	c.Check(nodes[repo.UUID].Description, Equals, "my comment")
+	c.Check(nodes[repo.UUID].Packages, Equals, 3)
+	c.Check(nodes[merged.UUID].Type, Equals, GraphNodeSnapshot)
+	c.Check(nodes[merged.UUID].Packages, Equals, 3)
+	c.Check(nodes[published.UUID].Type, Equals, GraphNodePublished)
+	c.Check(nodes[published.UUID].Name, Equals, "ppa/squeeze")
+	c.Check(nodes[published.UUID].Components, DeepEquals, []string{"contrib", "main"})
+
+	edges := map[GraphEdge]bool{}
+	for _, edge := range graph.Edges {
+		edges[*edge] = true
+	}
+
+	c.Check(edges, DeepEquals, map[GraphEdge]bool{
+		{From: mirror.UUID, To: snap1.UUID, Type: GraphEdgeSnapshot}:                         true,
+		{From: repo.UUID, To: snap2.UUID, Type: GraphEdgeSnapshot}:                           true,
+		{From: snap1.UUID, To: merged.UUID, Type: GraphEdgeMerge}:                            true,
+		{From: snap2.UUID, To: merged.UUID, Type: GraphEdgeMerge}:                            true,
+		{From: snap2.UUID, To: published.UUID, Type: GraphEdgePublish, Component: "contrib"}: true,
+		{From: merged.UUID, To: published.UUID, Type: GraphEdgePublish, Component: "main"}:   true,
+	})
+
+	dot := graph.Dot("vertical").String()
+	c.Check(strings.Contains(dot, "rankdir=LR"), Equals, true)
+	c.Check(strings.Contains(dot, "Snapshot from repo"), Equals, true)
+	c.Check(strings.Contains(dot, "Published ppa/squeeze"), Equals, true)
+}
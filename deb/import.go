@@ -70,9 +70,13 @@ func CollectPackageFiles(locations []string, reporter aptly.ResultReporter) (pac
 }
 
 // ImportPackageFiles imports files into local repository
+//
+// If isHeld is not nil, packages for which it returns true are never replaced.
+// If checkPolicy is not nil, packages which don't pass the check are not added
 func ImportPackageFiles(list *PackageList, packageFiles []string, forceReplace bool, verifier pgp.Verifier,
 	pool aptly.PackagePool, collection *PackageCollection, reporter aptly.ResultReporter, restriction PackageQuery,
-	checksumStorageProvider aptly.ChecksumStorageProvider) (processedFiles []string, failedFiles []string, err error) {
+	checksumStorageProvider aptly.ChecksumStorageProvider, isHeld func(*Package) bool,
+	checkPolicy func(*PackageList, *Package) error) (processedFiles []string, failedFiles []string, err error) {
 	if forceReplace {
 		list.PrepareIndex()
 	}
@@ -174,6 +178,14 @@ func ImportPackageFiles(list *PackageList, packageFiles []string, forceReplace b
 				)
 
 				files[i].PoolPath, found, err2 = pool.Verify("", files[i].Filename, &files[i].Checksums, checksumStorage)
+				if err2 == nil && !found && isSourcePackage {
+					// file might have been uploaded with another version of the same source
+					// package (e.g. orig tarball), so look up its pool path in the DB
+					if existing := collection.SearchSourceFile(p.Name, files[i]); existing != nil {
+						files[i].PoolPath, found, err2 = pool.Verify(existing.PoolPath, files[i].Filename, &files[i].Checksums, checksumStorage)
+					}
+				}
+
 				if err2 != nil {
 					err = err2
 				} else if found {
@@ -201,6 +213,14 @@ func ImportPackageFiles(list *PackageList, packageFiles []string, forceReplace b
 			continue
 		}
 
+		if checkPolicy != nil {
+			if policyErr := checkPolicy(list, p); policyErr != nil {
+				reporter.Warning("Unable to add package %s: %s", p, policyErr)
+				failedFiles = append(failedFiles, file)
+				continue
+			}
+		}
+
 		err = collection.Update(p)
 		if err != nil {
 			reporter.Warning("Unable to save package %s: %s", p, err)
@@ -208,8 +228,26 @@ func ImportPackageFiles(list *PackageList, packageFiles []string, forceReplace b
 			continue
 		}
 
+		// detect licenses while package file is at hand, result is cached in the DB
+		p.Licenses(pool, nil)
+
 		if forceReplace {
 			conflictingPackages := list.Search(Dependency{Pkg: p.Name, Version: p.Version, Relation: VersionEqual, Architecture: p.Architecture}, true, false)
+
+			held := false
+			if isHeld != nil {
+				for _, cp := range conflictingPackages {
+					if isHeld(cp) && !cp.Equals(p) {
+						reporter.Warning("Unable to replace package %s as it is held", cp)
+						held = true
+					}
+				}
+			}
+			if held {
+				failedFiles = append(failedFiles, file)
+				continue
+			}
+
 			for _, cp := range conflictingPackages {
 				reporter.Removed("%s removed due to conflict with package being added", cp)
 				list.Remove(cp)
@@ -0,0 +1,388 @@
+package deb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/pgp"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/pborman/uuid"
+	"github.com/ugorji/go/codec"
+)
+
+// States of uploads in the incoming queue
+const (
+	IncomingStatePending  = "pending"
+	IncomingStateApproved = "approved"
+	IncomingStateRejected = "rejected"
+)
+
+// maxIncomingCheckOutput limits size of check output stored in the queue
+const maxIncomingCheckOutput = 64 * 1024
+
+// IncomingFile is file referenced by .changes file in the incoming queue
+type IncomingFile struct {
+	// File name
+	Filename string
+	// Size in bytes
+	Size int64
+	// SHA256 checksum
+	SHA256 string
+}
+
+// IncomingSignature is result of signature verification of .changes file
+type IncomingSignature struct {
+	// .changes file is clearsigned
+	Signed bool
+	// Signature is valid and made by one of trusted keys
+	Verified bool
+	// Keys which made good signatures
+	Keys []string
+	// Verification error
+	Error string `json:",omitempty"`
+}
+
+// IncomingCheckResult is result of running configured check for the upload
+type IncomingCheckResult struct {
+	// Name of the check
+	Name string
+	// Check passed (command exited with zero status)
+	Passed bool
+	// Combined output of the command (truncated)
+	Output string
+}
+
+// IncomingItem is upload (.changes file with referenced files) waiting in the
+// incoming queue for review
+type IncomingItem struct {
+	// Unique ID of the upload
+	ID string
+	// Name of .changes file
+	ChangesName string
+	// Fields of .changes file
+	Source        string
+	Version       string
+	Distribution  string
+	Architectures []string
+	Binary        []string
+	Maintainer    string
+	ChangedBy     string
+	Changes       string
+	// Files referenced by .changes file
+	Files []IncomingFile
+	// Signature verification of .changes file
+	Signature IncomingSignature
+	// Results of configured checks
+	Checks []IncomingCheckResult
+	// State: pending, approved or rejected
+	State string
+	// Time upload was queued
+	SubmittedAt time.Time
+	// Time upload was approved or rejected
+	ReviewedAt time.Time `codec:",omitempty"`
+	// Local repository upload was approved into
+	Repo string `codec:",omitempty" json:",omitempty"`
+	// Reason of approval or rejection
+	Reason string `codec:",omitempty" json:",omitempty"`
+}
+
+// String interface
+func (item *IncomingItem) String() string {
+	return fmt.Sprintf("%s (%s %s)", item.ChangesName, item.Source, item.Version)
+}
+
+// Key is a unique id in DB
+func (item *IncomingItem) Key() []byte {
+	return []byte("I" + item.ID)
+}
+
+// Encode does msgpack encoding of IncomingItem
+func (item *IncomingItem) Encode() []byte {
+	var buf bytes.Buffer
+
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	encoder.Encode(item)
+
+	return buf.Bytes()
+}
+
+// Decode decodes msgpack representation into IncomingItem
+func (item *IncomingItem) Decode(input []byte) error {
+	decoder := codec.NewDecoderBytes(input, &codec.MsgpackHandle{})
+	return decoder.Decode(item)
+}
+
+// Dir returns directory with files of the upload
+func (item *IncomingItem) Dir(queueDir string) string {
+	return filepath.Join(queueDir, item.ID)
+}
+
+// ChangesPath returns path to .changes file of the upload
+func (item *IncomingItem) ChangesPath(queueDir string) string {
+	return filepath.Join(item.Dir(queueDir), item.ChangesName)
+}
+
+// ChecksPassed is true if all the checks passed
+func (item *IncomingItem) ChecksPassed() bool {
+	for _, check := range item.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RemoveFiles removes files of the upload from the queue
+func (item *IncomingItem) RemoveFiles(queueDir string) error {
+	return os.RemoveAll(item.Dir(queueDir))
+}
+
+// RunChecks runs configured checks for the upload, replacing previous results
+func (item *IncomingItem) RunChecks(queueDir string, checks []utils.IncomingCheck) {
+	item.Checks = make([]IncomingCheckResult, 0, len(checks))
+
+	for i := range checks {
+		item.Checks = append(item.Checks, runIncomingCheck(&checks[i], item.Dir(queueDir), item.ChangesPath(queueDir)))
+	}
+}
+
+func runIncomingCheck(check *utils.IncomingCheck, dir, changesPath string) IncomingCheckResult {
+	result := IncomingCheckResult{Name: check.Name}
+
+	if err := check.Validate(); err != nil {
+		result.Output = err.Error()
+		return result
+	}
+
+	ctx := context.Background()
+	if check.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(check.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	args := append(append([]string{}, check.Command[1:]...), changesPath)
+	cmd := exec.CommandContext(ctx, check.Command[0], args...)
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if len(output) > maxIncomingCheckOutput {
+		output = output[:maxIncomingCheckOutput]
+	}
+	result.Output = string(output)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		result.Output += fmt.Sprintf("\ncheck timed out after %d seconds", check.Timeout)
+	} else if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			result.Output += err.Error()
+		}
+	}
+
+	result.Passed = err == nil
+
+	return result
+}
+
+func verifyIncomingSignature(path string, verifier pgp.Verifier) (IncomingSignature, error) {
+	result := IncomingSignature{}
+
+	input, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer input.Close()
+
+	result.Signed, err = verifier.IsClearSigned(input)
+	if err != nil || !result.Signed {
+		return result, err
+	}
+
+	_, err = input.Seek(0, 0)
+	if err != nil {
+		return result, err
+	}
+
+	keyInfo, err := verifier.VerifyClearsigned(input, false)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	result.Verified = true
+	for _, key := range keyInfo.GoodKeys {
+		result.Keys = append(result.Keys, string(key))
+	}
+
+	return result, nil
+}
+
+// QueueChangesFile puts .changes file with referenced files into incoming queue
+//
+// Checksums of referenced files are verified, signature of .changes file is verified
+// and the result is recorded, but unsigned or badly signed uploads are still queued.
+// Unless noRemoveFiles is set, queued files are removed from original location.
+func QueueChangesFile(path, queueDir string, noRemoveFiles bool, verifier pgp.Verifier) (*IncomingItem, error) {
+	changes, err := NewChanges(path)
+	if err != nil {
+		return nil, err
+	}
+	defer changes.Cleanup()
+
+	signature, err := verifyIncomingSignature(filepath.Join(changes.TempDir, changes.ChangesName), verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	err = changes.VerifyAndParse(true, true, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	err = changes.Prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	item := &IncomingItem{
+		ID:            uuid.New(),
+		ChangesName:   changes.ChangesName,
+		Source:        changes.Source,
+		Version:       changes.Stanza["Version"],
+		Distribution:  changes.Distribution,
+		Architectures: changes.Architectures,
+		Binary:        changes.Binary,
+		Maintainer:    changes.Stanza["Maintainer"],
+		ChangedBy:     changes.Stanza["Changed-By"],
+		Changes:       changes.Changes,
+		Signature:     signature,
+		State:         IncomingStatePending,
+		SubmittedAt:   time.Now(),
+	}
+
+	err = os.MkdirAll(item.Dir(queueDir), 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{changes.ChangesName}
+	for _, file := range changes.Files {
+		item.Files = append(item.Files, IncomingFile{
+			Filename: file.Filename,
+			Size:     file.Checksums.Size,
+			SHA256:   file.Checksums.SHA256,
+		})
+		names = append(names, file.Filename)
+	}
+
+	for _, name := range names {
+		err = utils.CopyFile(filepath.Join(changes.TempDir, name), filepath.Join(item.Dir(queueDir), name))
+		if err != nil {
+			item.RemoveFiles(queueDir)
+			return nil, err
+		}
+	}
+
+	if !noRemoveFiles {
+		for _, name := range names {
+			err = os.Remove(filepath.Join(changes.BasePath, name))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+
+	return item, nil
+}
+
+// IncomingCollection does listing, updating/adding/deleting of uploads in incoming queue
+type IncomingCollection struct {
+	db database.Storage
+}
+
+// NewIncomingCollection creates new IncomingCollection and binds it to database
+func NewIncomingCollection(db database.Storage) *IncomingCollection {
+	return &IncomingCollection{
+		db: db,
+	}
+}
+
+// Add appends new upload to collection and saves it
+func (collection *IncomingCollection) Add(item *IncomingItem) error {
+	_, err := collection.db.Get(item.Key())
+	if err == nil {
+		return fmt.Errorf("upload with id %s already exists", item.ID)
+	}
+	if err != database.ErrNotFound {
+		return err
+	}
+
+	return collection.Update(item)
+}
+
+// Update stores updated information about upload in DB
+func (collection *IncomingCollection) Update(item *IncomingItem) error {
+	return collection.db.Put(item.Key(), item.Encode())
+}
+
+// ByID looks up upload by ID
+func (collection *IncomingCollection) ByID(id string) (*IncomingItem, error) {
+	item := &IncomingItem{ID: id}
+
+	encoded, err := collection.db.Get(item.Key())
+	if err == database.ErrNotFound {
+		return nil, fmt.Errorf("upload with id %s not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = item.Decode(encoded); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ForEach runs method for each upload, in order of submission
+func (collection *IncomingCollection) ForEach(handler func(*IncomingItem) error) error {
+	items := []*IncomingItem{}
+
+	err := collection.db.ProcessByPrefix([]byte("I"), func(_, blob []byte) error {
+		item := &IncomingItem{}
+		if err := item.Decode(blob); err != nil {
+			log.Printf("Error decoding upload: %s\n", err)
+			return nil
+		}
+
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].SubmittedAt.Before(items[j].SubmittedAt) })
+
+	for _, item := range items {
+		if err = handler(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Drop removes upload from DB
+func (collection *IncomingCollection) Drop(item *IncomingItem) error {
+	return collection.db.Delete(item.Key())
+}
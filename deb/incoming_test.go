@@ -0,0 +1,124 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+type IncomingSuite struct {
+	uploadDir, queueDir string
+	db                  database.Storage
+	collection          *IncomingCollection
+}
+
+var _ = Suite(&IncomingSuite{})
+
+func (s *IncomingSuite) SetUpTest(c *C) {
+	s.uploadDir = c.MkDir()
+	s.queueDir = c.MkDir()
+
+	for _, name := range []string{"hardlink_0.2.1_amd64.changes", "hardlink_0.2.1.dsc", "hardlink_0.2.1.tar.gz",
+		"hardlink_0.2.1_amd64.deb", "hardlink_0.2.0_i386.deb", "hardlink_0.2.1_amd64.buildinfo"} {
+		c.Assert(utils.CopyFile(filepath.Join("testdata/changes", name), filepath.Join(s.uploadDir, name)), IsNil)
+	}
+
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.collection = NewIncomingCollection(s.db)
+}
+
+func (s *IncomingSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *IncomingSuite) TestQueueChangesFile(c *C) {
+	item, err := QueueChangesFile(filepath.Join(s.uploadDir, "hardlink_0.2.1_amd64.changes"), s.queueDir, false, &NullVerifier{})
+	c.Assert(err, IsNil)
+
+	c.Check(item.ID, Not(Equals), "")
+	c.Check(item.State, Equals, IncomingStatePending)
+	c.Check(item.Source, Equals, "hardlink")
+	c.Check(item.Version, Equals, "0.2.1")
+	c.Check(item.Distribution, Equals, "unstable")
+	c.Check(item.ChangedBy, Equals, "Aptly Tester (don't use it) <test@aptly.info>")
+	c.Check(item.Signature, DeepEquals, IncomingSignature{})
+	c.Check(item.Files, HasLen, 5)
+	c.Check(item.Files[2], DeepEquals, IncomingFile{Filename: "hardlink_0.2.1_amd64.deb", Size: 12468,
+		SHA256: item.Files[2].SHA256})
+
+	queued, _ := filepath.Glob(filepath.Join(item.Dir(s.queueDir), "*"))
+	c.Check(queued, HasLen, 6)
+
+	left, _ := filepath.Glob(filepath.Join(s.uploadDir, "*"))
+	c.Check(left, HasLen, 0)
+
+	c.Assert(item.RemoveFiles(s.queueDir), IsNil)
+	_, err = os.Stat(item.Dir(s.queueDir))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *IncomingSuite) TestQueueChecksumMismatch(c *C) {
+	c.Assert(os.WriteFile(filepath.Join(s.uploadDir, "hardlink_0.2.1.dsc"), []byte("tampered"), 0644), IsNil)
+
+	_, err := QueueChangesFile(filepath.Join(s.uploadDir, "hardlink_0.2.1_amd64.changes"), s.queueDir, false, &NullVerifier{})
+	c.Check(err, ErrorMatches, "size mismatch.*")
+
+	queued, _ := filepath.Glob(filepath.Join(s.queueDir, "*"))
+	c.Check(queued, HasLen, 0)
+}
+
+func (s *IncomingSuite) TestRunChecks(c *C) {
+	item, err := QueueChangesFile(filepath.Join(s.uploadDir, "hardlink_0.2.1_amd64.changes"), s.queueDir, true, &NullVerifier{})
+	c.Assert(err, IsNil)
+
+	item.RunChecks(s.queueDir, []utils.IncomingCheck{
+		{Name: "exists", Command: []string{"test", "-f"}},
+		{Name: "echo", Command: []string{"sh", "-c", "echo checking $(basename $0); exit 2"}},
+		{Name: "broken"},
+	})
+
+	c.Check(item.Checks, HasLen, 3)
+	c.Check(item.Checks[0], DeepEquals, IncomingCheckResult{Name: "exists", Passed: true})
+	c.Check(item.Checks[1], DeepEquals, IncomingCheckResult{Name: "echo", Output: "checking hardlink_0.2.1_amd64.changes\n"})
+	c.Check(item.Checks[2], DeepEquals, IncomingCheckResult{Name: "broken", Output: "command is not configured for incoming check broken"})
+	c.Check(item.ChecksPassed(), Equals, false)
+
+	item.RunChecks(s.queueDir, nil)
+	c.Check(item.ChecksPassed(), Equals, true)
+}
+
+func (s *IncomingSuite) TestCollection(c *C) {
+	_, err := s.collection.ByID("no-such-id")
+	c.Check(err, ErrorMatches, "upload with id no-such-id not found")
+
+	item, err := QueueChangesFile(filepath.Join(s.uploadDir, "hardlink_0.2.1_amd64.changes"), s.queueDir, true, &NullVerifier{})
+	c.Assert(err, IsNil)
+	c.Assert(s.collection.Add(item), IsNil)
+	c.Check(s.collection.Add(item), ErrorMatches, "upload with id .* already exists")
+
+	item2, err := QueueChangesFile(filepath.Join(s.uploadDir, "hardlink_0.2.1_amd64.changes"), s.queueDir, true, &NullVerifier{})
+	c.Assert(err, IsNil)
+	item2.State = IncomingStateRejected
+	c.Assert(s.collection.Add(item2), IsNil)
+
+	loaded, err := s.collection.ByID(item.ID)
+	c.Assert(err, IsNil)
+	c.Check(loaded.Source, Equals, "hardlink")
+	c.Check(loaded.Files, DeepEquals, item.Files)
+
+	ids := []string{}
+	c.Check(s.collection.ForEach(func(i *IncomingItem) error {
+		ids = append(ids, i.ID)
+		return nil
+	}), IsNil)
+	c.Check(ids, DeepEquals, []string{item.ID, item2.ID})
+
+	c.Assert(s.collection.Drop(item), IsNil)
+	_, err = s.collection.ByID(item.ID)
+	c.Check(err, NotNil)
+}
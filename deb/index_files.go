@@ -6,7 +6,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/pgp"
@@ -22,7 +25,25 @@ type indexFiles struct {
 	suffix           string
 	indexes          map[string]*indexFile
 	acquireByHash    bool
+	byHashDepth      int
+	byHashHistory    map[string][]string
 	skipBz2          bool
+	enableZst        bool
+	stats            PublishStats
+	// number of index files finalized (compressed and uploaded) concurrently
+	concurrency int
+	// flat repository has single Packages and Sources index in the root
+	flat bool
+
+	// lock protects maps and statistics, as index files are generated and finalized concurrently
+	lock sync.Mutex
+	// signLock serializes signing, signers are not safe for concurrent use
+	signLock sync.Mutex
+
+	// diffs of package indexes (pdiffs), generated if diffsStorage is set
+	diffsStorage  aptly.ReadablePublishedStorage
+	diffsBasePath string
+	diffsDepth    int
 }
 
 type indexFile struct {
@@ -33,6 +54,7 @@ type indexFile struct {
 	clearSign     bool
 	detachedSign  bool
 	acquireByHash bool
+	diffable      bool
 	relativePath  string
 	tempFilename  string
 	tempFile      *os.File
@@ -54,7 +76,7 @@ func (file *indexFile) BufWriter() (*bufio.Writer, error) {
 	return file.w, nil
 }
 
-func (file *indexFile) Finalize(signer pgp.Signer) error {
+func (file *indexFile) Finalize(signer pgp.FileSigner) error {
 	if file.w == nil {
 		if file.discardable {
 			return nil
@@ -74,6 +96,14 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 			file.tempFile.Close()
 			return fmt.Errorf("unable to compress index file: %s", err)
 		}
+
+		if file.parent.enableZst {
+			err = utils.CompressFileZstd(file.tempFile)
+			if err != nil {
+				file.tempFile.Close()
+				return fmt.Errorf("unable to compress index file: %s", err)
+			}
+		}
 	}
 
 	file.tempFile.Close()
@@ -83,13 +113,19 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 	if file.compressable {
 		if file.onlyGzip {
 			exts = []string{".gz"}
-			cksumExts = []string{"", ".gz"}
 		} else {
 			exts = append(exts, ".gz")
 			if !file.parent.skipBz2 {
 				exts = append(exts, ".bz2")
 			}
-			cksumExts = exts
+		}
+		if file.parent.enableZst {
+			exts = append(exts, ".zst")
+		}
+		cksumExts = exts
+		if file.onlyGzip {
+			// uncompressed file is not published, but listed in Release file
+			cksumExts = append([]string{""}, exts...)
 		}
 	}
 
@@ -100,7 +136,9 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 		if err != nil {
 			return fmt.Errorf("unable to collect checksums: %s", err)
 		}
+		file.parent.lock.Lock()
 		file.parent.generatedFiles[file.relativePath+ext] = checksumInfo
+		file.parent.lock.Unlock()
 	}
 
 	filedir := filepath.Dir(filepath.Join(file.parent.basePath, file.relativePath))
@@ -120,19 +158,19 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 	}
 
 	for _, ext := range exts {
-		err = file.parent.publishedStorage.PutFile(filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+ext),
+		err = file.parent.putFile(filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+ext),
 			file.tempFilename+ext)
 		if err != nil {
 			return fmt.Errorf("unable to publish file: %s", err)
 		}
 
-		if file.parent.suffix != "" {
-			file.parent.renameMap[filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+ext)] =
-				filepath.Join(file.parent.basePath, file.relativePath+ext)
-		}
+		file.parent.rename(filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+ext),
+			filepath.Join(file.parent.basePath, file.relativePath+ext))
 
 		if file.acquireByHash {
+			file.parent.lock.Lock()
 			sums := file.parent.generatedFiles[file.relativePath+ext]
+			file.parent.lock.Unlock()
 			for hash, sum := range map[string]string{"SHA512": sums.SHA512, "SHA256": sums.SHA256, "SHA1": sums.SHA1, "MD5Sum": sums.MD5} {
 				err = packageIndexByHash(file, ext, hash, sum)
 				if err != nil {
@@ -145,17 +183,17 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 	if signer != nil {
 		gpgExt := ".gpg"
 		if file.detachedSign {
-			err = signer.DetachedSign(file.tempFilename, file.tempFilename+gpgExt)
+			err = file.parent.sign(func() error {
+				return signer.DetachedSign(file.tempFilename, file.tempFilename+gpgExt)
+			})
 			if err != nil {
 				return fmt.Errorf("unable to detached sign file: %s", err)
 			}
 
-			if file.parent.suffix != "" {
-				file.parent.renameMap[filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+gpgExt)] =
-					filepath.Join(file.parent.basePath, file.relativePath+gpgExt)
-			}
+			file.parent.rename(filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+gpgExt),
+				filepath.Join(file.parent.basePath, file.relativePath+gpgExt))
 
-			err = file.parent.publishedStorage.PutFile(filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+gpgExt),
+			err = file.parent.putFile(filepath.Join(file.parent.basePath, file.relativePath+file.parent.suffix+gpgExt),
 				file.tempFilename+gpgExt)
 			if err != nil {
 				return fmt.Errorf("unable to publish file: %s", err)
@@ -164,17 +202,17 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 		}
 
 		if file.clearSign {
-			err = signer.ClearSign(file.tempFilename, filepath.Join(filepath.Dir(file.tempFilename), "In"+filepath.Base(file.tempFilename)))
+			err = file.parent.sign(func() error {
+				return signer.ClearSign(file.tempFilename, filepath.Join(filepath.Dir(file.tempFilename), "In"+filepath.Base(file.tempFilename)))
+			})
 			if err != nil {
 				return fmt.Errorf("unable to clearsign file: %s", err)
 			}
 
-			if file.parent.suffix != "" {
-				file.parent.renameMap[filepath.Join(file.parent.basePath, "In"+file.relativePath+file.parent.suffix)] =
-					filepath.Join(file.parent.basePath, "In"+file.relativePath)
-			}
+			file.parent.rename(filepath.Join(file.parent.basePath, "In"+file.relativePath+file.parent.suffix),
+				filepath.Join(file.parent.basePath, "In"+file.relativePath))
 
-			err = file.parent.publishedStorage.PutFile(filepath.Join(file.parent.basePath, "In"+file.relativePath+file.parent.suffix),
+			err = file.parent.putFile(filepath.Join(file.parent.basePath, "In"+file.relativePath+file.parent.suffix),
 				filepath.Join(filepath.Dir(file.tempFilename), "In"+filepath.Base(file.tempFilename)))
 			if err != nil {
 				return fmt.Errorf("unable to publish file: %s", err)
@@ -185,6 +223,55 @@ func (file *indexFile) Finalize(signer pgp.Signer) error {
 	return nil
 }
 
+// putFile uploads index file to published storage, collecting statistics
+func (files *indexFiles) putFile(path, sourceFilename string) error {
+	start := time.Now()
+	err := files.publishedStorage.PutFile(path, sourceFilename)
+	duration := time.Since(start)
+
+	files.lock.Lock()
+	defer files.lock.Unlock()
+
+	files.stats.Upload += duration
+	if err != nil {
+		publishedStorageErrorsCounter.WithLabelValues("upload").Inc()
+		return err
+	}
+
+	files.stats.IndexFiles++
+	if info, e := os.Stat(sourceFilename); e == nil {
+		files.stats.IndexBytes += info.Size()
+	}
+
+	return nil
+}
+
+// sign runs signing, collecting statistics
+func (files *indexFiles) sign(signing func() error) error {
+	files.signLock.Lock()
+	defer files.signLock.Unlock()
+
+	start := time.Now()
+	err := signing()
+
+	files.lock.Lock()
+	files.stats.Signing += time.Since(start)
+	files.lock.Unlock()
+
+	return err
+}
+
+// rename records file published under temporary name to be renamed by RenameFiles
+func (files *indexFiles) rename(oldName, newName string) {
+	if files.suffix == "" {
+		return
+	}
+
+	files.lock.Lock()
+	files.renameMap[oldName] = newName
+	files.lock.Unlock()
+}
+
 func packageIndexByHash(file *indexFile, ext string, hash string, sum string) error {
 	src := filepath.Join(file.parent.basePath, file.relativePath)
 	indexfile := path.Base(src + ext)
@@ -192,6 +279,7 @@ func packageIndexByHash(file *indexFile, ext string, hash string, sum string) er
 	filedir := filepath.Dir(filepath.Join(file.parent.basePath, file.relativePath))
 	dst := filepath.Join(filedir, "by-hash", hash)
 	sumfilePath := filepath.Join(dst, sum)
+	historyKey := filepath.Join(filepath.Dir(file.relativePath), "by-hash", hash, indexfile)
 
 	// link already exists? do nothing
 	exists, err := file.parent.publishedStorage.FileExists(sumfilePath)
@@ -199,6 +287,9 @@ func packageIndexByHash(file *indexFile, ext string, hash string, sum string) er
 		return fmt.Errorf("Acquire-By-Hash: error checking exists of file %s: %s", sumfilePath, err)
 	}
 	if exists {
+		file.parent.lock.Lock()
+		file.parent.trackByHash(historyKey, dst, indexfile, sum)
+		file.parent.lock.Unlock()
 		return nil
 	}
 
@@ -208,20 +299,15 @@ func packageIndexByHash(file *indexFile, ext string, hash string, sum string) er
 		return fmt.Errorf("Acquire-By-Hash: error creating hardlink %s: %s", sumfilePath, err)
 	}
 
+	file.parent.lock.Lock()
+	file.parent.trackByHash(historyKey, dst, indexfile, sum)
+	file.parent.lock.Unlock()
+
 	// if a previous index file already exists exists, backup symlink
 	indexPath := filepath.Join(dst, indexfile)
 	oldIndexPath := filepath.Join(dst, indexfile+".old")
 	if exists, _ = file.parent.publishedStorage.FileExists(indexPath); exists {
-		// if exists, remove old symlink
 		if exists, _ = file.parent.publishedStorage.FileExists(oldIndexPath); exists {
-			var linkTarget string
-			linkTarget, err = file.parent.publishedStorage.ReadLink(oldIndexPath)
-			if err == nil {
-				// If we managed to resolve the link target: delete it. This is the
-				// oldest physical index file we no longer need. Once we drop our
-				// old symlink we'll essentially forget about it existing at all.
-				file.parent.publishedStorage.Remove(linkTarget)
-			}
 			file.parent.publishedStorage.Remove(oldIndexPath)
 		}
 		file.parent.publishedStorage.RenameFile(indexPath, oldIndexPath)
@@ -235,6 +321,61 @@ func packageIndexByHash(file *indexFile, ext string, hash string, sum string) er
 	return nil
 }
 
+// trackByHash records new generation of index file under by-hash and removes generations
+// beyond configured history depth, should be called with files locked
+//
+// History of generations is kept in the DB, for published repositories without history
+// it is recovered from index file symlinks.
+func (files *indexFiles) trackByHash(historyKey, dst, indexfile, sum string) {
+	history, tracked := files.byHashHistory[historyKey]
+	if !tracked {
+		for _, link := range []string{indexfile, indexfile + ".old"} {
+			if target, err := files.publishedStorage.ReadLink(filepath.Join(dst, link)); err == nil {
+				history = append(history, filepath.Base(target))
+			}
+		}
+	}
+
+	generations := []string{sum}
+	for _, old := range history {
+		if old != sum {
+			generations = append(generations, old)
+		}
+	}
+
+	depth := files.byHashDepth
+	if depth <= 0 {
+		depth = DefaultByHashDepth
+	}
+
+	if len(generations) > depth+1 {
+		for _, old := range generations[depth+1:] {
+			if !files.byHashReferenced(historyKey, filepath.Dir(historyKey), old) {
+				files.publishedStorage.Remove(filepath.Join(dst, old))
+			}
+		}
+		generations = generations[:depth+1]
+	}
+
+	files.byHashHistory[historyKey] = generations
+}
+
+// byHashReferenced checks whether file under by-hash is still referenced by other index file
+func (files *indexFiles) byHashReferenced(historyKey, dir, sum string) bool {
+	for key, generations := range files.byHashHistory {
+		if key == historyKey || filepath.Dir(key) != dir {
+			continue
+		}
+		for _, generation := range generations {
+			if generation == sum {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func newIndexFiles(publishedStorage aptly.PublishedStorage, basePath, tempDir, suffix string, acquireByHash bool, skipBz2 bool) *indexFiles {
 	return &indexFiles{
 		publishedStorage: publishedStorage,
@@ -245,20 +386,33 @@ func newIndexFiles(publishedStorage aptly.PublishedStorage, basePath, tempDir, s
 		suffix:           suffix,
 		indexes:          make(map[string]*indexFile),
 		acquireByHash:    acquireByHash,
+		byHashHistory:    make(map[string][]string),
 		skipBz2:          skipBz2,
 	}
 }
 
 func (files *indexFiles) PackageIndex(component, arch string, udeb bool, installer bool, distribution string) *indexFile {
+	files.lock.Lock()
+	defer files.lock.Unlock()
+
 	if arch == ArchitectureSource {
 		udeb = false
 	}
 	key := fmt.Sprintf("pi-%s-%s-%v-%v", component, arch, udeb, installer)
+	if files.flat {
+		key = fmt.Sprintf("pi-flat-%v", arch == ArchitectureSource)
+	}
 	file, ok := files.indexes[key]
 	if !ok {
 		var relativePath string
 
-		if arch == ArchitectureSource {
+		if files.flat {
+			if arch == ArchitectureSource {
+				relativePath = "Sources"
+			} else {
+				relativePath = "Packages"
+			}
+		} else if arch == ArchitectureSource {
 			relativePath = filepath.Join(component, "source", "Sources")
 		} else {
 			if udeb {
@@ -281,6 +435,7 @@ func (files *indexFiles) PackageIndex(component, arch string, udeb bool, install
 			detachedSign:  installer,
 			clearSign:     false,
 			acquireByHash: files.acquireByHash,
+			diffable:      !installer,
 			relativePath:  relativePath,
 		}
 
@@ -291,6 +446,9 @@ func (files *indexFiles) PackageIndex(component, arch string, udeb bool, install
 }
 
 func (files *indexFiles) ReleaseIndex(component, arch string, udeb bool) *indexFile {
+	files.lock.Lock()
+	defer files.lock.Unlock()
+
 	if arch == ArchitectureSource {
 		udeb = false
 	}
@@ -326,6 +484,9 @@ func (files *indexFiles) ReleaseIndex(component, arch string, udeb bool) *indexF
 }
 
 func (files *indexFiles) ContentsIndex(component, arch string, udeb bool) *indexFile {
+	files.lock.Lock()
+	defer files.lock.Unlock()
+
 	if arch == ArchitectureSource {
 		udeb = false
 	}
@@ -358,6 +519,9 @@ func (files *indexFiles) ContentsIndex(component, arch string, udeb bool) *index
 }
 
 func (files *indexFiles) LegacyContentsIndex(arch string, udeb bool) *indexFile {
+	files.lock.Lock()
+	defer files.lock.Unlock()
+
 	if arch == ArchitectureSource {
 		udeb = false
 	}
@@ -389,12 +553,42 @@ func (files *indexFiles) LegacyContentsIndex(arch string, udeb bool) *indexFile
 	return file
 }
 
+// DiffIndex is Index of diffs (pdiffs) of package index at relativePath
+func (files *indexFiles) DiffIndex(relativePath string) *indexFile {
+	files.lock.Lock()
+	defer files.lock.Unlock()
+
+	key := fmt.Sprintf("di-%s", relativePath)
+	file, ok := files.indexes[key]
+	if !ok {
+		file = &indexFile{
+			parent:        files,
+			discardable:   false,
+			compressable:  false,
+			detachedSign:  false,
+			clearSign:     false,
+			acquireByHash: files.acquireByHash,
+			relativePath:  filepath.Join(relativePath+".diff", "Index"),
+		}
+
+		files.indexes[key] = file
+	}
+
+	return file
+}
+
 func (files *indexFiles) SkelIndex(component, path string) *indexFile {
+	files.lock.Lock()
+	defer files.lock.Unlock()
+
 	key := fmt.Sprintf("si-%s-%s", component, path)
 	file, ok := files.indexes[key]
 
 	if !ok {
 		relativePath := filepath.Join(component, path)
+		if files.flat {
+			relativePath = path
+		}
 
 		file = &indexFile{
 			parent:       files,
@@ -421,20 +615,82 @@ func (files *indexFiles) ReleaseFile() *indexFile {
 	}
 }
 
-func (files *indexFiles) FinalizeAll(progress aptly.Progress, signer pgp.Signer) (err error) {
+func (files *indexFiles) FinalizeAll(progress aptly.Progress, signer pgp.FileSigner) (err error) {
+	if files.diffsStorage != nil {
+		var diffable []*indexFile
+		for _, file := range files.indexes {
+			if file.diffable {
+				diffable = append(diffable, file)
+			}
+		}
+
+		for _, file := range diffable {
+			if _, err = file.BufWriter(); err != nil {
+				return err
+			}
+
+			err = files.generateDiff(file)
+			if err != nil {
+				return fmt.Errorf("unable to generate diffs of %s: %s", file.relativePath, err)
+			}
+		}
+	}
+
 	if progress != nil {
 		progress.InitBar(int64(len(files.indexes)), false, aptly.BarPublishFinalizeIndexes)
 		defer progress.ShutdownBar()
 	}
 
+	concurrency := files.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// index files are compressed and uploaded by several workers, Release file is finalized separately
+	// after all index files are in place
+	var (
+		wg      sync.WaitGroup
+		errLock sync.Mutex
+	)
+	queue := make(chan *indexFile)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for file := range queue {
+				errLock.Lock()
+				failed := err != nil
+				errLock.Unlock()
+				if failed {
+					// drain the queue after failure
+					continue
+				}
+
+				if e := file.Finalize(signer); e != nil {
+					errLock.Lock()
+					if err == nil {
+						err = e
+					}
+					errLock.Unlock()
+					continue
+				}
+				if progress != nil {
+					progress.AddBar(1)
+				}
+			}
+		}()
+	}
+
 	for _, file := range files.indexes {
-		err = file.Finalize(signer)
-		if err != nil {
-			return
-		}
-		if progress != nil {
-			progress.AddBar(1)
-		}
+		queue <- file
+	}
+	close(queue)
+	wg.Wait()
+
+	if err != nil {
+		return
 	}
 
 	files.indexes = make(map[string]*indexFile)
@@ -442,11 +698,28 @@ func (files *indexFiles) FinalizeAll(progress aptly.Progress, signer pgp.Signer)
 	return
 }
 
+// RenameFiles moves files published under temporary names in place
+//
+// Release files are renamed last, so that clients never see Release referencing indexes
+// which are not in place yet.
 func (files *indexFiles) RenameFiles() error {
 	var err error
 
-	for oldName, newName := range files.renameMap {
-		err = files.publishedStorage.RenameFile(oldName, newName)
+	oldNames := make([]string, 0, len(files.renameMap))
+	for oldName := range files.renameMap {
+		oldNames = append(oldNames, oldName)
+	}
+
+	isRelease := func(name string) bool {
+		return filepath.Dir(files.renameMap[name]) == files.basePath &&
+			strings.Contains(filepath.Base(files.renameMap[name]), "Release")
+	}
+	sort.SliceStable(oldNames, func(i, j int) bool {
+		return !isRelease(oldNames[i]) && isRelease(oldNames[j])
+	})
+
+	for _, oldName := range oldNames {
+		err = files.publishedStorage.RenameFile(oldName, files.renameMap[oldName])
 		if err != nil {
 			return fmt.Errorf("unable to rename: %s", err)
 		}
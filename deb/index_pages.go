@@ -0,0 +1,130 @@
+package deb
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+)
+
+// IndexPageName is the name of generated directory listing
+const IndexPageName = "index.html"
+
+var indexPageTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of /{{.Path}}</title>
+</head>
+<body>
+<h1>Index of /{{.Path}}</h1>
+<hr>
+<pre>
+{{if .Path}}<a href="../">../</a>
+{{end}}{{range .Entries}}<a href="{{.}}">{{.}}</a>
+{{end}}</pre>
+<hr>
+</body>
+</html>
+`))
+
+// indexPageTree builds directory -> entries map from list of files,
+// directory entries end with "/"
+func indexPageTree(files []string) map[string][]string {
+	tree := map[string]map[string]struct{}{"": {}}
+
+	for _, file := range files {
+		if filepath.Base(file) == IndexPageName {
+			continue
+		}
+
+		parts := strings.Split(strings.Trim(file, "/"), "/")
+		dir := ""
+		for i, part := range parts {
+			entry := part
+			if i < len(parts)-1 {
+				entry += "/"
+			}
+
+			if tree[dir] == nil {
+				tree[dir] = map[string]struct{}{}
+			}
+			tree[dir][entry] = struct{}{}
+
+			dir = filepath.Join(dir, part)
+		}
+	}
+
+	result := make(map[string][]string, len(tree))
+	for dir, entries := range tree {
+		list := make([]string, 0, len(entries))
+		for entry := range entries {
+			list = append(list, entry)
+		}
+		sort.Strings(list)
+		result[dir] = list
+	}
+
+	return result
+}
+
+// GenerateIndexPages writes index.html directory listings for all the directories
+// under published prefix, if published storage requires that
+func GenerateIndexPages(publishedStorage aptly.PublishedStorage, prefix string, progress aptly.Progress) error {
+	indexStorage, ok := publishedStorage.(aptly.IndexPagesPublishedStorage)
+	if !ok || !indexStorage.IndexPages() {
+		return nil
+	}
+
+	if prefix == "." {
+		prefix = ""
+	}
+
+	if progress != nil {
+		progress.Printf("Generating index pages...\n")
+	}
+
+	files, err := publishedStorage.Filelist(prefix)
+	if err != nil {
+		return err
+	}
+
+	tempDir, err := os.MkdirTemp("", "aptly")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempPath := filepath.Join(tempDir, IndexPageName)
+
+	for dir, entries := range indexPageTree(files) {
+		f, err := os.Create(tempPath)
+		if err != nil {
+			return err
+		}
+
+		err = indexPageTemplate.Execute(f, struct {
+			Path    string
+			Entries []string
+		}{
+			Path:    filepath.Join(prefix, dir),
+			Entries: entries,
+		})
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			return err
+		}
+
+		err = publishedStorage.PutFile(filepath.Join(prefix, dir, IndexPageName), tempPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
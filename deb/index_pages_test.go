@@ -0,0 +1,62 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/aptly-dev/aptly/files"
+
+	. "gopkg.in/check.v1"
+)
+
+type indexPagesStorage struct {
+	*files.PublishedStorage
+}
+
+func (s indexPagesStorage) IndexPages() bool {
+	return true
+}
+
+type IndexPagesSuite struct{}
+
+var _ = Suite(&IndexPagesSuite{})
+
+func (s *IndexPagesSuite) TestIndexPageTree(c *C) {
+	tree := indexPageTree([]string{
+		"dists/stable/Release",
+		"dists/stable/main/binary-amd64/Packages",
+		"dists/stable/index.html",
+		"pool/main/a/aptly/aptly_1.0_amd64.deb",
+	})
+
+	c.Check(tree[""], DeepEquals, []string{"dists/", "pool/"})
+	c.Check(tree["dists/stable"], DeepEquals, []string{"Release", "main/"})
+	c.Check(tree["pool/main/a/aptly"], DeepEquals, []string{"aptly_1.0_amd64.deb"})
+	c.Check(tree, HasLen, 9)
+}
+
+func (s *IndexPagesSuite) TestGenerateIndexPages(c *C) {
+	root := c.MkDir()
+	storage := files.NewPublishedStorage(root, "", "")
+
+	c.Assert(os.MkdirAll(filepath.Join(root, "ppa", "dists", "stable"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(root, "ppa", "dists", "stable", "Release"), []byte("Origin: aptly\n"), 0644), IsNil)
+
+	// storage without index pages support is left as is
+	c.Assert(GenerateIndexPages(storage, "ppa", nil), IsNil)
+	c.Check(filepath.Join(root, "ppa", IndexPageName), Not(PathExists))
+
+	c.Assert(GenerateIndexPages(indexPagesStorage{storage}, "ppa", nil), IsNil)
+	c.Check(filepath.Join(root, "ppa", IndexPageName), PathExists)
+	c.Check(filepath.Join(root, "ppa", "dists", IndexPageName), PathExists)
+
+	contents, err := os.ReadFile(filepath.Join(root, "ppa", "dists", "stable", IndexPageName))
+	c.Assert(err, IsNil)
+	c.Check(string(contents), Matches, `(?s).*<title>Index of /ppa/dists/stable</title>.*<a href="../">../</a>\n<a href="Release">Release</a>\n.*`)
+
+	// regenerating doesn't list index pages themselves
+	c.Assert(GenerateIndexPages(indexPagesStorage{storage}, "ppa", nil), IsNil)
+	contents, err = os.ReadFile(filepath.Join(root, "ppa", IndexPageName))
+	c.Assert(err, IsNil)
+	c.Check(string(contents), Not(Matches), `(?s).*href="index.html".*`)
+}
@@ -0,0 +1,183 @@
+package deb
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+)
+
+// maxMaintainerScriptSize limits size of maintainer script being extracted from the package
+const maxMaintainerScriptSize = 1024 * 1024
+
+// MaintainerScripts lists names of maintainer scripts in control.tar.* of .deb package
+var MaintainerScripts = []string{"preinst", "postinst", "prerm", "postrm", "config"}
+
+// Types of entries in package file list
+const (
+	PackageFileTypeFile     = "file"
+	PackageFileTypeDir      = "dir"
+	PackageFileTypeSymlink  = "symlink"
+	PackageFileTypeHardlink = "hardlink"
+	PackageFileTypeOther    = "other"
+)
+
+// PackageFileEntry is single entry of data.tar.* of .deb package
+type PackageFileEntry struct {
+	// Path of the entry as installed, without leading ./
+	Path string `json:"Path"`
+	// Type of the entry: file, dir, symlink, hardlink or other
+	Type string `json:"Type"`
+	// Permission bits in octal, e.g. 0755
+	Mode string `json:"Mode"`
+	// Size in bytes
+	Size int64 `json:"Size"`
+	// Owner as user/group
+	Owner string `json:"Owner"`
+	// Target of symlink or hardlink
+	LinkTarget string `json:"LinkTarget,omitempty"`
+}
+
+func newPackageFileEntry(tarHeader *tar.Header) PackageFileEntry {
+	entry := PackageFileEntry{
+		Path:  strings.TrimPrefix(strings.TrimPrefix(tarHeader.Name, "."), "/"),
+		Mode:  fmt.Sprintf("%04o", tarHeader.Mode&07777),
+		Size:  tarHeader.Size,
+		Owner: fmt.Sprintf("%s/%s", tarHeader.Uname, tarHeader.Gname),
+	}
+
+	if tarHeader.Uname == "" {
+		entry.Owner = fmt.Sprintf("%d/%d", tarHeader.Uid, tarHeader.Gid)
+	}
+
+	switch tarHeader.Typeflag {
+	case tar.TypeReg:
+		entry.Type = PackageFileTypeFile
+	case tar.TypeDir:
+		entry.Type = PackageFileTypeDir
+		entry.Path = strings.TrimSuffix(entry.Path, "/")
+	case tar.TypeSymlink:
+		entry.Type = PackageFileTypeSymlink
+		entry.LinkTarget = tarHeader.Linkname
+	case tar.TypeLink:
+		entry.Type = PackageFileTypeHardlink
+		entry.LinkTarget = strings.TrimPrefix(tarHeader.Linkname, "./")
+	default:
+		entry.Type = PackageFileTypeOther
+	}
+
+	return entry
+}
+
+// GetFileListFromDeb returns all entries of data.tar.* of .deb package with modes and sizes
+//
+// Unlike GetContentsFromDeb, directories are included as well.
+func GetFileListFromDeb(file io.Reader, packageFile string) ([]PackageFileEntry, error) {
+	result := []PackageFileEntry{}
+
+	err := walkDebData(file, packageFile, func(tarHeader *tar.Header, _ io.Reader) error {
+		entry := newPackageFileEntry(tarHeader)
+		if entry.Path == "" {
+			return nil
+		}
+
+		result = append(result, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetMaintainerScriptsFromDeb extracts maintainer scripts (preinst, postinst, ...) from .deb package
+//
+// Result maps name of the script to its contents, scripts not shipped by package are missing.
+func GetMaintainerScriptsFromDeb(file io.Reader, packageFile string) (map[string]string, error) {
+	result := map[string]string{}
+
+	err := walkDebControl(file, packageFile, func(tarHeader *tar.Header, r io.Reader) error {
+		if tarHeader.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		name := strings.TrimPrefix(tarHeader.Name, "./")
+		if !isMaintainerScript(name) {
+			return nil
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r, maxMaintainerScriptSize))
+		if err != nil {
+			return err
+		}
+
+		result[name] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func isMaintainerScript(name string) bool {
+	for _, script := range MaintainerScripts {
+		if name == script {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetControlFromDeb reads control file from .deb package stream
+func GetControlFromDeb(file io.Reader, packageFile string) (Stanza, error) {
+	var stanza Stanza
+
+	err := walkDebControl(file, packageFile, func(tarHeader *tar.Header, r io.Reader) error {
+		if tarHeader.Name != "./control" && tarHeader.Name != "control" {
+			return nil
+		}
+
+		var err error
+		stanza, err = NewControlFileReader(r, false, false).ReadStanza()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if stanza == nil {
+		return nil, fmt.Errorf("unable to find control file in %s", packageFile)
+	}
+
+	return stanza, nil
+}
+
+// OpenPackageFile opens .deb file of binary package in the package pool
+func (p *Package) OpenPackageFile(packagePool aptly.PackagePool) (aptly.ReadSeekerCloser, string, error) {
+	if p.IsSource {
+		return nil, "", fmt.Errorf("package %s is a source package", p)
+	}
+
+	files := p.Files()
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("package %s has no files", p)
+	}
+
+	poolPath, err := files[0].GetPoolPath(packagePool)
+	if err != nil {
+		return nil, "", err
+	}
+
+	reader, err := packagePool.Open(poolPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return reader, files[0].Filename, nil
+}
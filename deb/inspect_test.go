@@ -0,0 +1,82 @@
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	ar "github.com/mkrautz/goar"
+
+	. "gopkg.in/check.v1"
+)
+
+type InspectSuite struct {
+	debFile string
+}
+
+var _ = Suite(&InspectSuite{})
+
+func (s *InspectSuite) SetUpSuite(c *C) {
+	_, _File, _, _ := runtime.Caller(0)
+	s.debFile = filepath.Join(filepath.Dir(_File), "../system/changes/hardlink_0.2.1_amd64.deb")
+}
+
+func (s *InspectSuite) TestGetControlFromDeb(c *C) {
+	f, err := os.Open(s.debFile)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	st, err := GetControlFromDeb(f, s.debFile)
+	c.Assert(err, IsNil)
+	c.Check(st["Package"], Equals, "hardlink")
+	c.Check(st["Version"], Equals, "0.2.1")
+}
+
+func (s *InspectSuite) TestGetFileListFromDeb(c *C) {
+	f, err := os.Open(s.debFile)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	files, err := GetFileListFromDeb(f, s.debFile)
+	c.Assert(err, IsNil)
+	c.Check(files[0], DeepEquals, PackageFileEntry{Path: "usr", Type: PackageFileTypeDir, Mode: "0755", Owner: "root/root"})
+	c.Check(files[2], DeepEquals, PackageFileEntry{Path: "usr/bin/hardlink", Type: PackageFileTypeFile, Mode: "0755", Size: 18792, Owner: "root/root"})
+}
+
+func (s *InspectSuite) TestGetMaintainerScriptsFromDeb(c *C) {
+	var control bytes.Buffer
+	w := tar.NewWriter(&control)
+	for _, entry := range []struct {
+		name, contents string
+	}{
+		{"./control", "Package: test\n"},
+		{"./postinst", "#!/bin/sh\nset -e\n"},
+		{"./md5sums", ""},
+	} {
+		c.Assert(w.WriteHeader(&tar.Header{Name: entry.name, Mode: 0755, Size: int64(len(entry.contents)), Typeflag: tar.TypeReg}), IsNil)
+		_, err := w.Write([]byte(entry.contents))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(w.Close(), IsNil)
+
+	var deb bytes.Buffer
+	a := ar.NewWriter(&deb)
+	c.Assert(a.WriteHeader(&ar.Header{Name: "control.tar", Mode: 0644, Size: int64(control.Len())}), IsNil)
+	_, err := a.Write(control.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(a.Close(), IsNil)
+
+	scripts, err := GetMaintainerScriptsFromDeb(bytes.NewReader(deb.Bytes()), "test.deb")
+	c.Assert(err, IsNil)
+	c.Check(scripts, DeepEquals, map[string]string{"postinst": "#!/bin/sh\nset -e\n"})
+
+	f, err := os.Open(s.debFile)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	scripts, err = GetMaintainerScriptsFromDeb(f, s.debFile)
+	c.Assert(err, IsNil)
+	c.Check(scripts, HasLen, 0)
+}
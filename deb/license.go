@@ -0,0 +1,184 @@
+package deb
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+)
+
+// maxCopyrightSize limits size of copyright file being extracted from the package
+const maxCopyrightSize = 1024 * 1024
+
+// LicenseUnknown is reported for packages without detectable license
+const LicenseUnknown = "unknown"
+
+var (
+	commonLicenseRegexp = regexp.MustCompile(`/usr/share/common-licenses/([A-Za-z0-9][A-Za-z0-9.+_-]*[A-Za-z0-9+])`)
+	licenseSplitRegexp  = regexp.MustCompile(`(?i)\s+(?:or|and)\s+|\s*,\s*`)
+)
+
+// GetCopyrightFromDeb extracts usr/share/doc/*/copyright files from .deb package
+//
+// Result maps path of the copyright file to its contents.
+func GetCopyrightFromDeb(file io.Reader, packageFile string) (map[string][]byte, error) {
+	result := map[string][]byte{}
+
+	err := walkDebData(file, packageFile, func(tarHeader *tar.Header, r io.Reader) error {
+		if tarHeader.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		name := strings.TrimPrefix(tarHeader.Name, "./")
+		if matched, _ := path.Match("usr/share/doc/*/copyright", name); !matched {
+			return nil
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r, maxCopyrightSize))
+		if err != nil {
+			return err
+		}
+
+		result[name] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ParseLicenses detects licenses in the copyright file
+//
+// Machine-readable (DEP-5) copyright files are parsed for License fields, compound
+// expressions are split into separate licenses. For other copyright files, references
+// to /usr/share/common-licenses are detected.
+func ParseLicenses(copyright []byte) []string {
+	licenses := map[string]bool{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(copyright))
+	scanner.Buffer(nil, maxCopyrightSize)
+
+	machineReadable := false
+	firstLine := true
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if firstLine {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			firstLine = false
+			machineReadable = strings.HasPrefix(strings.ToLower(line), "format:")
+		}
+
+		if machineReadable {
+			if len(line) > 8 && strings.EqualFold(line[:8], "license:") {
+				for _, license := range licenseSplitRegexp.Split(strings.TrimSpace(line[8:]), -1) {
+					license = strings.Trim(license, "() ")
+					if license != "" {
+						licenses[license] = true
+					}
+				}
+			}
+		} else {
+			for _, match := range commonLicenseRegexp.FindAllStringSubmatch(line, -1) {
+				licenses[match[1]] = true
+			}
+		}
+	}
+
+	return sortedKeys(licenses)
+}
+
+// DetectLicenses detects licenses in all the copyright files of the package
+func DetectLicenses(copyrights map[string][]byte) []string {
+	licenses := map[string]bool{}
+
+	for _, copyright := range copyrights {
+		for _, license := range ParseLicenses(copyright) {
+			licenses[license] = true
+		}
+	}
+
+	return sortedKeys(licenses)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	result := make([]string, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// PackageLicenses is a list of licenses detected for the package
+type PackageLicenses struct {
+	Package  string
+	Licenses []string
+}
+
+// LicenseReport builds list of licenses for every binary package in the list
+//
+// If license is not empty, only packages with this license are reported.
+func LicenseReport(list *PackageList, packagePool aptly.PackagePool, license string, progress aptly.Progress) []PackageLicenses {
+	result := []PackageLicenses{}
+
+	list.ForEach(func(p *Package) error {
+		if p.IsSource {
+			return nil
+		}
+
+		licenses := p.Licenses(packagePool, progress)
+		if len(licenses) == 0 {
+			licenses = []string{LicenseUnknown}
+		}
+
+		for _, l := range licenses {
+			if license == "" || strings.EqualFold(l, license) {
+				result = append(result, PackageLicenses{Package: p.GetFullName(), Licenses: licenses})
+				break
+			}
+		}
+
+		return nil
+	})
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Package < result[j].Package })
+
+	return result
+}
+
+// NewLicenseReport loads packages from reflist and builds license report, see LicenseReport
+func NewLicenseReport(reflist *PackageRefList, collection *PackageCollection, packagePool aptly.PackagePool,
+	license string, progress aptly.Progress) ([]PackageLicenses, error) {
+	list, err := NewPackageListFromRefList(reflist, collection, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return LicenseReport(list, packagePool, license, progress), nil
+}
+
+// LicenseSummary counts packages per license in the report
+func LicenseSummary(report []PackageLicenses) map[string]int {
+	result := map[string]int{}
+
+	for _, item := range report {
+		for _, license := range item.Licenses {
+			result[license]++
+		}
+	}
+
+	return result
+}
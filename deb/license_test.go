@@ -0,0 +1,65 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	. "gopkg.in/check.v1"
+)
+
+type LicenseSuite struct{}
+
+var _ = Suite(&LicenseSuite{})
+
+func (s *LicenseSuite) TestParseLicensesMachineReadable(c *C) {
+	c.Check(ParseLicenses([]byte(`
+Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Upstream-Name: example
+
+Files: *
+Copyright: 2020 Someone
+License: GPL-2+ or Artistic
+
+Files: debian/*
+License: MIT, BSD-3-clause
+ Permission is hereby granted...
+ .
+ License: not a field
+
+License: GPL-2+
+ On Debian systems, see /usr/share/common-licenses/GPL-2.
+`)), DeepEquals, []string{"Artistic", "BSD-3-clause", "GPL-2+", "MIT"})
+}
+
+func (s *LicenseSuite) TestParseLicensesCommonLicenses(c *C) {
+	c.Check(ParseLicenses([]byte(`This package was debianized by Someone.
+
+On Debian systems, the complete text of the GNU General Public License
+can be found in /usr/share/common-licenses/GPL-3 and the Apache license
+in '/usr/share/common-licenses/Apache-2.0'.
+`)), DeepEquals, []string{"Apache-2.0", "GPL-3"})
+
+	c.Check(ParseLicenses([]byte("Permission is hereby granted, free of charge\n")), DeepEquals, []string{})
+}
+
+func (s *LicenseSuite) TestGetCopyrightFromDeb(c *C) {
+	_, _File, _, _ := runtime.Caller(0)
+	debFile := filepath.Join(filepath.Dir(_File), "../system/changes/hardlink_0.2.1_amd64.deb")
+
+	f, err := os.Open(debFile)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	copyrights, err := GetCopyrightFromDeb(f, debFile)
+	c.Assert(err, IsNil)
+	c.Check(copyrights, HasLen, 1)
+	c.Check(DetectLicenses(copyrights), DeepEquals, []string{"Expat"})
+}
+
+func (s *LicenseSuite) TestLicenseSummary(c *C) {
+	c.Check(LicenseSummary([]PackageLicenses{
+		{Package: "a_1.0_i386", Licenses: []string{"GPL-2+", "MIT"}},
+		{Package: "b_1.0_i386", Licenses: []string{"MIT"}},
+	}), DeepEquals, map[string]int{"GPL-2+": 1, "MIT": 2})
+}
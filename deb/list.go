@@ -510,11 +510,23 @@ func (l *PackageList) Filter(queries []PackageQuery, withDependencies bool, sour
 
 // FilterWithProgress filters package index by specified queries (ORed together), possibly pulling dependencies and displays progress
 func (l *PackageList) FilterWithProgress(queries []PackageQuery, withDependencies bool, source *PackageList, dependencyOptions int, architecturesList []string, progress aptly.Progress) (*PackageList, error) {
+	result, _, err := l.FilterWithProviders(queries, withDependencies, source, []DependencyProvider{{List: l}}, dependencyOptions, architecturesList, progress)
+	return result, err
+}
+
+// FilterWithProviders filters package index by specified queries (ORed together), possibly pulling dependencies
+//
+// Dependencies are resolved against providers in order: the first provider which has matching
+// packages wins. Resolutions are returned for every dependency which required pulling in packages
+// or which couldn't be satisfied.
+func (l *PackageList) FilterWithProviders(queries []PackageQuery, withDependencies bool, source *PackageList, providers []DependencyProvider,
+	dependencyOptions int, architecturesList []string, progress aptly.Progress) (*PackageList, []DependencyResolution, error) {
 	if !l.indexed {
 		panic("list not indexed, can't filter")
 	}
 
 	result := NewPackageList()
+	resolutions := []DependencyResolution{}
 
 	for _, query := range queries {
 		result.Append(query.Query(l))
@@ -531,6 +543,8 @@ func (l *PackageList) FilterWithProgress(queries []PackageQuery, withDependencie
 		dependencySource.Append(result)
 		dependencySource.PrepareIndex()
 
+		unsatisfied := map[string]bool{}
+
 		// while some new dependencies were discovered
 		for added > 0 {
 			added = 0
@@ -538,7 +552,7 @@ func (l *PackageList) FilterWithProgress(queries []PackageQuery, withDependencie
 			// find missing dependencies
 			missing, err := result.VerifyDependencies(dependencyOptions, architecturesList, dependencySource, progress)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			// try to satisfy dependencies
@@ -557,7 +571,19 @@ func (l *PackageList) FilterWithProgress(queries []PackageQuery, withDependencie
 					}
 				}
 
-				searchResults := l.Search(dep, true, true)
+				var (
+					searchResults []*Package
+					provider      string
+				)
+
+				for _, p := range providers {
+					searchResults = p.List.Search(dep, true, true)
+					if len(searchResults) > 0 {
+						provider = p.Name
+						break
+					}
+				}
+
 				if len(searchResults) > 0 {
 					for _, p := range searchResults {
 						if result.Has(p) {
@@ -569,6 +595,7 @@ func (l *PackageList) FilterWithProgress(queries []PackageQuery, withDependencie
 						}
 						result.Add(p)
 						dependencySource.Add(p)
+						resolutions = append(resolutions, DependencyResolution{Dependency: dep, Package: p, Provider: provider})
 						added++
 						if dependencyOptions&DepFollowAllVariants == 0 {
 							break
@@ -579,10 +606,14 @@ func (l *PackageList) FilterWithProgress(queries []PackageQuery, withDependencie
 						progress.ColoredPrintf("@{r}Unsatisfied dependency@|: %s", dep.String())
 					}
 
+					if !unsatisfied[dep.String()] {
+						unsatisfied[dep.String()] = true
+						resolutions = append(resolutions, DependencyResolution{Dependency: dep})
+					}
 				}
 			}
 		}
 	}
 
-	return result, nil
+	return result, resolutions, nil
 }
@@ -403,6 +403,43 @@ func (s *PackageListSuite) TestFilter(c *C) {
 	c.Check(plString(result), Equals, "aa_2.0-1_i386 app_1.0_s390 app_1.1~bp1_amd64 app_1.1~bp1_arm app_1.1~bp1_i386 mailer_3.5.8_i386")
 }
 
+func (s *PackageListSuite) TestFilterWithProviders(c *C) {
+	primary := NewPackageList()
+	for _, p := range s.packages[1:4] {
+		primary.Add(p)
+	}
+	primary.PrepareIndex()
+
+	providers := []DependencyProvider{{Name: "primary", List: primary}, {Name: "base", List: s.il}}
+
+	result, resolutions, err := primary.FilterWithProviders([]PackageQuery{&DependencyQuery{Dep: Dependency{Pkg: "app", Architecture: "i386"}}},
+		true, NewPackageList(), providers, 0, []string{"i386"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Len(), Equals, 5)
+
+	sort.Slice(resolutions, func(i, j int) bool { return resolutions[i].Package.Name < resolutions[j].Package.Name })
+	c.Assert(resolutions, HasLen, 4)
+	c.Check(resolutions[0].Package.Name, Equals, "data")
+	c.Check(resolutions[0].Provider, Equals, "primary")
+	c.Check(resolutions[1].Package.Name, Equals, "dpkg")
+	c.Check(resolutions[1].Provider, Equals, "primary")
+	c.Check(resolutions[2].Package.Name, Equals, "lib")
+	c.Check(resolutions[2].Provider, Equals, "base")
+	c.Check(resolutions[3].Package.Name, Equals, "mailer")
+	c.Check(resolutions[3].Provider, Equals, "base")
+
+	_, resolutions, err = primary.FilterWithProviders([]PackageQuery{&DependencyQuery{Dep: Dependency{Pkg: "app", Architecture: "i386"}}},
+		true, NewPackageList(), providers[:1], 0, []string{"i386"}, nil)
+	c.Assert(err, IsNil)
+	unsatisfied := []string{}
+	for _, r := range resolutions {
+		if r.Package == nil {
+			unsatisfied = append(unsatisfied, r.Dependency.String())
+		}
+	}
+	c.Check(unsatisfied, DeepEquals, []string{"lib (>> 0.9) [i386]"})
+}
+
 func (s *PackageListSuite) TestVerifyDependencies(c *C) {
 	missing, err := s.il.VerifyDependencies(0, []string{"i386"}, s.il, nil)
 	c.Check(err, IsNil)
@@ -5,12 +5,35 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"time"
 
 	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/utils"
 	"github.com/pborman/uuid"
 	"github.com/ugorji/go/codec"
 )
 
+// Version policies for local repos
+const (
+	// VersionPolicyNone doesn't put any restrictions on package versions
+	VersionPolicyNone = ""
+	// VersionPolicyNoDowngrade rejects packages with version lower than the newest version in the repo
+	VersionPolicyNoDowngrade = "no-downgrade"
+	// VersionPolicyIncreasing rejects packages with version not greater than the newest version in the repo
+	VersionPolicyIncreasing = "increasing"
+)
+
+// ValidateVersionPolicy checks that version policy is known
+func ValidateVersionPolicy(policy string) error {
+	switch policy {
+	case VersionPolicyNone, VersionPolicyNoDowngrade, VersionPolicyIncreasing:
+		return nil
+	}
+
+	return fmt.Errorf("unknown version policy %#v, valid policies are: %s, %s", policy, VersionPolicyNoDowngrade, VersionPolicyIncreasing)
+}
+
 // LocalRepo is a collection of packages created locally
 type LocalRepo struct {
 	// Permanent internal ID
@@ -25,6 +48,16 @@ type LocalRepo struct {
 	DefaultComponent string `codec:",omitempty"`
 	// Uploaders configuration
 	Uploaders *Uploaders `codec:"Uploaders,omitempty" json:"-"`
+	// Keys of held packages, which are protected from removal and replacement
+	Holds []string `codec:"Holds,omitempty" json:",omitempty"`
+	// Policy for versions of packages being added
+	VersionPolicy string `codec:",omitempty" json:",omitempty"`
+	// Policy for pruning old versions of packages
+	Retention *RetentionPolicy `codec:",omitempty" json:",omitempty"`
+	// Times packages were added to the repo, tracked only if retention policy limits age of packages
+	//
+	// Stored separately from the repo, loaded together with package list
+	Added map[string]time.Time `codec:"-" json:"-"`
 	// "Snapshot" of current list of packages
 	packageRefs *PackageRefList
 }
@@ -60,8 +93,115 @@ func (repo *LocalRepo) RefList() *PackageRefList {
 }
 
 // UpdateRefList changes package list for local repo
+//
+// Holds of packages which are not part of the new package list are dropped,
+// new packages are recorded as added now for retention policy
 func (repo *LocalRepo) UpdateRefList(reflist *PackageRefList) {
 	repo.packageRefs = reflist
+	repo.trackAdded(time.Now())
+
+	if len(repo.Holds) > 0 {
+		holds := []string{}
+		for _, key := range repo.Holds {
+			if reflist != nil {
+				i := sort.Search(len(reflist.Refs), func(j int) bool { return string(reflist.Refs[j]) >= key })
+				if i < len(reflist.Refs) && string(reflist.Refs[i]) == key {
+					holds = append(holds, key)
+				}
+			}
+		}
+		repo.Holds = holds
+	}
+}
+
+// IsHeld checks whether package is held in local repo
+func (repo *LocalRepo) IsHeld(p *Package) bool {
+	return utils.StrSliceHasItem(repo.Holds, string(p.Key("")))
+}
+
+// Hold marks package as held, it returns false if package has been already held
+func (repo *LocalRepo) Hold(p *Package) bool {
+	if repo.IsHeld(p) {
+		return false
+	}
+
+	repo.Holds = append(repo.Holds, string(p.Key("")))
+	sort.Strings(repo.Holds)
+
+	return true
+}
+
+// Unhold removes hold from the package, it returns false if package hasn't been held
+func (repo *LocalRepo) Unhold(p *Package) bool {
+	key := string(p.Key(""))
+
+	for i := range repo.Holds {
+		if repo.Holds[i] == key {
+			repo.Holds = append(repo.Holds[:i], repo.Holds[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckHolds verifies that none of the packages in the list are held
+func (repo *LocalRepo) CheckHolds(list *PackageList) error {
+	if len(repo.Holds) == 0 {
+		return nil
+	}
+
+	return list.ForEach(func(p *Package) error {
+		if repo.IsHeld(p) {
+			return fmt.Errorf("package %s is held in local repo %s", p, repo.Name)
+		}
+		return nil
+	})
+}
+
+// CheckVersionPolicy verifies that adding package p to list of packages in the repo
+// satisfies version policy of the repo
+//
+// Versions are compared against the newest package with the same name and architecture,
+// list is indexed if it wasn't indexed before
+func (repo *LocalRepo) CheckVersionPolicy(list *PackageList, p *Package) error {
+	if repo.VersionPolicy == VersionPolicyNone {
+		return nil
+	}
+
+	var (
+		newest  *Package
+		present bool
+		key     = string(p.Key(""))
+	)
+
+	list.PrepareIndex()
+
+	for _, cp := range list.Search(Dependency{Pkg: p.Name, Architecture: p.Architecture, Relation: VersionDontCare}, true, false) {
+		if cp.Architecture != p.Architecture {
+			continue
+		}
+
+		if string(cp.Key("")) == key {
+			present = true
+		}
+
+		if newest == nil || CompareVersions(cp.Version, newest.Version) > 0 {
+			newest = cp
+		}
+	}
+
+	if newest == nil || present {
+		return nil
+	}
+
+	cmp := CompareVersions(p.Version, newest.Version)
+	if cmp < 0 || cmp == 0 && repo.VersionPolicy == VersionPolicyIncreasing {
+		return fmt.Errorf("package %s violates version policy %s of local repo %s: newest version is %s",
+			p, repo.VersionPolicy, repo.Name, newest.Version)
+	}
+
+	return nil
 }
 
 // Encode does msgpack encoding of LocalRepo
@@ -90,6 +230,11 @@ func (repo *LocalRepo) RefKey() []byte {
 	return []byte("E" + repo.UUID)
 }
 
+// AddedKey is a unique id for times packages were added to the repo
+func (repo *LocalRepo) AddedKey() []byte {
+	return []byte("A" + repo.UUID)
+}
+
 // LocalRepoCollection does listing, updating/adding/deleting of LocalRepos
 type LocalRepoCollection struct {
 	db    database.Storage
@@ -162,6 +307,14 @@ func (collection *LocalRepoCollection) Update(repo *LocalRepo) error {
 	batch.Put(repo.Key(), repo.Encode())
 	if repo.packageRefs != nil {
 		batch.Put(repo.RefKey(), repo.packageRefs.Encode())
+
+		if len(repo.Added) > 0 {
+			var buf bytes.Buffer
+			codec.NewEncoder(&buf, &codec.MsgpackHandle{}).Encode(repo.Added)
+			batch.Put(repo.AddedKey(), buf.Bytes())
+		} else {
+			batch.Delete(repo.AddedKey())
+		}
 	}
 	return batch.Write()
 }
@@ -177,7 +330,21 @@ func (collection *LocalRepoCollection) LoadComplete(repo *LocalRepo) error {
 	}
 
 	repo.packageRefs = &PackageRefList{}
-	return repo.packageRefs.Decode(encoded)
+	if err = repo.packageRefs.Decode(encoded); err != nil {
+		return err
+	}
+
+	encoded, err = collection.db.Get(repo.AddedKey())
+	if err == database.ErrNotFound {
+		repo.Added = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	repo.Added = nil
+	return codec.NewDecoderBytes(encoded, &codec.MsgpackHandle{}).Decode(&repo.Added)
 }
 
 // ByName looks up repository by name
@@ -249,5 +416,6 @@ func (collection *LocalRepoCollection) Drop(repo *LocalRepo) error {
 	batch := collection.db.CreateBatch()
 	batch.Delete(repo.Key())
 	batch.Delete(repo.RefKey())
+	batch.Delete(repo.AddedKey())
 	return batch.Write()
 }
@@ -2,6 +2,7 @@ package deb
 
 import (
 	"errors"
+	"time"
 
 	"github.com/aptly-dev/aptly/database"
 	"github.com/aptly-dev/aptly/database/goleveldb"
@@ -63,6 +64,72 @@ func (s *LocalRepoSuite) TestEncodeDecode(c *C) {
 	c.Check(repo.Comment, Equals, s.repo.Comment)
 }
 
+func (s *LocalRepoSuite) TestHolds(c *C) {
+	lib := &Package{Name: "lib", Version: "1.7", Architecture: "i386"}
+	app := &Package{Name: "app", Version: "1.9", Architecture: "amd64"}
+
+	c.Check(s.repo.IsHeld(lib), Equals, false)
+	c.Check(s.repo.CheckHolds(s.list), IsNil)
+
+	c.Check(s.repo.Hold(lib), Equals, true)
+	c.Check(s.repo.Hold(lib), Equals, false)
+	c.Check(s.repo.IsHeld(lib), Equals, true)
+	c.Check(s.repo.IsHeld(app), Equals, false)
+	c.Check(s.repo.CheckHolds(s.list), ErrorMatches, "package lib_1.7_i386 is held in local repo lrepo")
+
+	repo := &LocalRepo{}
+	c.Assert(repo.Decode(s.repo.Encode()), IsNil)
+	c.Check(repo.IsHeld(lib), Equals, true)
+
+	s.repo.UpdateRefList(s.reflist)
+	c.Check(s.repo.IsHeld(lib), Equals, true)
+
+	s.repo.UpdateRefList(NewPackageRefList())
+	c.Check(s.repo.IsHeld(lib), Equals, false)
+	c.Check(s.repo.Hold(lib), Equals, true)
+
+	c.Check(s.repo.Unhold(app), Equals, false)
+	c.Check(s.repo.Unhold(lib), Equals, true)
+	c.Check(s.repo.IsHeld(lib), Equals, false)
+	c.Check(s.repo.CheckHolds(s.list), IsNil)
+}
+
+func (s *LocalRepoSuite) TestCheckVersionPolicy(c *C) {
+	newer := &Package{Name: "lib", Version: "1.8", Architecture: "i386"}
+	older := &Package{Name: "lib", Version: "1.6", Architecture: "i386"}
+	same := &Package{Name: "lib", Version: "1.7", Architecture: "i386"}
+	otherArch := &Package{Name: "lib", Version: "1.0", Architecture: "amd64"}
+
+	for _, p := range []*Package{newer, older, same, otherArch} {
+		c.Check(s.repo.CheckVersionPolicy(s.list, p), IsNil)
+	}
+
+	s.repo.VersionPolicy = VersionPolicyNoDowngrade
+	c.Check(s.repo.CheckVersionPolicy(s.list, newer), IsNil)
+	c.Check(s.repo.CheckVersionPolicy(s.list, same), IsNil)
+	c.Check(s.repo.CheckVersionPolicy(s.list, otherArch), IsNil)
+	c.Check(s.repo.CheckVersionPolicy(s.list, older), ErrorMatches,
+		"package lib_1.6_i386 violates version policy no-downgrade of local repo lrepo: newest version is 1.7")
+
+	s.repo.VersionPolicy = VersionPolicyIncreasing
+	c.Check(s.repo.CheckVersionPolicy(s.list, newer), IsNil)
+	c.Check(s.repo.CheckVersionPolicy(s.list, otherArch), IsNil)
+	c.Check(s.repo.CheckVersionPolicy(s.list, older), NotNil)
+
+	sameFiles := &Package{Name: "lib", Version: "1.7", Architecture: "i386", V06Plus: true}
+	sameFiles.UpdateFiles(PackageFiles{{Filename: "lib_1.7_i386.deb"}})
+	c.Check(s.repo.CheckVersionPolicy(s.list, sameFiles), ErrorMatches, ".*violates version policy increasing.*")
+	// adding package which is already in the repo is not a violation
+	c.Check(s.repo.CheckVersionPolicy(s.list, same), IsNil)
+}
+
+func (s *LocalRepoSuite) TestValidateVersionPolicy(c *C) {
+	c.Check(ValidateVersionPolicy(VersionPolicyNone), IsNil)
+	c.Check(ValidateVersionPolicy(VersionPolicyNoDowngrade), IsNil)
+	c.Check(ValidateVersionPolicy(VersionPolicyIncreasing), IsNil)
+	c.Check(ValidateVersionPolicy("sometimes"), ErrorMatches, "unknown version policy.*")
+}
+
 func (s *LocalRepoSuite) TestKey(c *C) {
 	c.Assert(len(s.repo.Key()), Equals, 37)
 	c.Assert(s.repo.Key()[0], Equals, byte('L'))
@@ -154,6 +221,47 @@ func (s *LocalRepoCollectionSuite) TestUpdateLoadComplete(c *C) {
 	c.Assert(r.NumPackages(), Equals, 2)
 }
 
+func (s *LocalRepoCollectionSuite) TestUpdateLoadCompleteAdded(c *C) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	repo := NewLocalRepo("local1", "Comment 1")
+	repo.Retention = &RetentionPolicy{MaxAgeDays: 30}
+	repo.packageRefs = s.reflist
+	repo.trackAdded(now)
+	c.Assert(s.collection.Update(repo), IsNil)
+
+	// times packages were added aren't part of the repo record
+	encoded, err := s.db.Get(repo.Key())
+	c.Assert(err, IsNil)
+	r := &LocalRepo{}
+	c.Assert(r.Decode(encoded), IsNil)
+	c.Check(r.Added, IsNil)
+
+	collection := NewLocalRepoCollection(s.db)
+	r, err = collection.ByName("local1")
+	c.Assert(err, IsNil)
+	c.Check(r.Added, IsNil)
+	c.Assert(collection.LoadComplete(r), IsNil)
+	c.Assert(r.Added, HasLen, 2)
+	for _, t := range r.Added {
+		c.Check(t.Equal(now), Equals, true)
+	}
+
+	// metadata update without package list keeps times
+	r.Comment = "Comment 2"
+	r.packageRefs = nil
+	r.Added = nil
+	c.Assert(collection.Update(r), IsNil)
+
+	r = &LocalRepo{UUID: repo.UUID}
+	c.Assert(collection.LoadComplete(r), IsNil)
+	c.Check(r.Added, HasLen, 2)
+
+	c.Assert(collection.Drop(repo), IsNil)
+	_, err = s.db.Get(repo.AddedKey())
+	c.Check(err, Equals, database.ErrNotFound)
+}
+
 func (s *LocalRepoCollectionSuite) TestForEachAndLen(c *C) {
 	repo := NewLocalRepo("local1", "Comment 1")
 	s.collection.Add(repo)
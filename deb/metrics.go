@@ -0,0 +1,23 @@
+package deb
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	publishDurationHistogram = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "aptly_publish_duration_seconds",
+			Help:    "Duration of successful publishes and publish updates in seconds.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+		},
+	)
+	publishedStorageErrorsCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aptly_published_storage_errors_total",
+			Help: "Total number of failed published storage operations labeled by operation.",
+		},
+		[]string{"operation"},
+	)
+)
@@ -0,0 +1,191 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/ugorji/go/codec"
+)
+
+// minScheduleInterval is minimal interval between scheduled mirror updates, in seconds
+const minScheduleInterval = 60
+
+// MirrorSchedule is schedule of automatic mirror updates run by API server
+//
+// Mirror is updated either according to cron expression or every Interval seconds,
+// Actions (steps of the same kinds as pipeline steps) are run after successful update.
+type MirrorSchedule struct {
+	// UUID of the mirror
+	MirrorUUID string `codec:"MirrorUUID" json:"-"`
+	// Name of the mirror, filled in when schedule is loaded with the mirror
+	Mirror string `codec:"-" json:"Mirror"`
+	// Cron expression (minute, hour, day of month, month, day of week) in local time of API server
+	Cron string `json:"Cron"`
+	// Interval between updates in seconds, if cron expression is not set
+	Interval int `json:"Interval"`
+	// Steps run after successful update, snapshot names could contain {date} and {timestamp} placeholders
+	Actions []PipelineStep `json:"Actions"`
+	// Time of the next scheduled update
+	NextRun time.Time `json:"NextRun"`
+	// Time of the last scheduled update
+	LastRun time.Time `json:"LastRun"`
+	// Error of the last scheduled update (or of its actions), empty if succeeded
+	LastError string `json:"LastError"`
+}
+
+// NewMirrorSchedule creates new schedule of mirror updates
+func NewMirrorSchedule(repo *RemoteRepo, cron string, interval int, actions []PipelineStep) *MirrorSchedule {
+	return &MirrorSchedule{
+		MirrorUUID: repo.UUID,
+		Mirror:     repo.Name,
+		Cron:       cron,
+		Interval:   interval,
+		Actions:    actions,
+	}
+}
+
+// Validate checks that schedule is complete
+func (schedule *MirrorSchedule) Validate() error {
+	if (schedule.Cron == "") == (schedule.Interval == 0) {
+		return fmt.Errorf("either cron expression or interval should be set")
+	}
+
+	if schedule.Cron != "" {
+		if _, err := utils.ParseCron(schedule.Cron); err != nil {
+			return err
+		}
+	} else if schedule.Interval < minScheduleInterval {
+		return fmt.Errorf("interval should be at least %d seconds", minScheduleInterval)
+	}
+
+	for i := range schedule.Actions {
+		if err := schedule.Actions[i].Validate(); err != nil {
+			return fmt.Errorf("action %d: %s", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// Next returns time of the update following time t, zero time if there is no such time
+func (schedule *MirrorSchedule) Next(t time.Time) time.Time {
+	if schedule.Cron == "" {
+		return t.Add(time.Duration(schedule.Interval) * time.Second)
+	}
+
+	cron, err := utils.ParseCron(schedule.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return cron.Next(t)
+}
+
+// Due checks whether update should be started at time t
+func (schedule *MirrorSchedule) Due(t time.Time) bool {
+	return !schedule.NextRun.IsZero() && !schedule.NextRun.After(t)
+}
+
+// String interface
+func (schedule *MirrorSchedule) String() string {
+	if schedule.Cron != "" {
+		return fmt.Sprintf("[%s]: %s", schedule.Mirror, schedule.Cron)
+	}
+	return fmt.Sprintf("[%s]: every %ds", schedule.Mirror, schedule.Interval)
+}
+
+// Encode does msgpack encoding of MirrorSchedule
+func (schedule *MirrorSchedule) Encode() []byte {
+	var buf bytes.Buffer
+
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	encoder.Encode(schedule)
+
+	return buf.Bytes()
+}
+
+// Decode decodes msgpack representation into MirrorSchedule
+func (schedule *MirrorSchedule) Decode(input []byte) error {
+	decoder := codec.NewDecoderBytes(input, &codec.MsgpackHandle{})
+	return decoder.Decode(schedule)
+}
+
+// Key is a unique id in DB
+func (schedule *MirrorSchedule) Key() []byte {
+	return []byte("M" + schedule.MirrorUUID)
+}
+
+// MirrorScheduleCollection does listing, updating/adding/deleting of MirrorSchedules
+type MirrorScheduleCollection struct {
+	db database.Storage
+}
+
+// NewMirrorScheduleCollection creates new MirrorScheduleCollection and binds it to database
+func NewMirrorScheduleCollection(db database.Storage) *MirrorScheduleCollection {
+	return &MirrorScheduleCollection{
+		db: db,
+	}
+}
+
+// Update stores schedule in DB, replacing previous schedule of the mirror
+func (collection *MirrorScheduleCollection) Update(schedule *MirrorSchedule) error {
+	return collection.db.Put(schedule.Key(), schedule.Encode())
+}
+
+// ByMirror looks up schedule of the mirror
+func (collection *MirrorScheduleCollection) ByMirror(repo *RemoteRepo) (*MirrorSchedule, error) {
+	schedule := &MirrorSchedule{MirrorUUID: repo.UUID}
+
+	encoded, err := collection.db.Get(schedule.Key())
+	if err == database.ErrNotFound {
+		return nil, fmt.Errorf("mirror %s has no schedule", repo.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = schedule.Decode(encoded); err != nil {
+		return nil, err
+	}
+	schedule.Mirror = repo.Name
+
+	return schedule, nil
+}
+
+// ForEach runs method for each schedule
+//
+// Mirror names are not filled in, as schedules are loaded without mirrors.
+func (collection *MirrorScheduleCollection) ForEach(handler func(*MirrorSchedule) error) error {
+	schedules := []*MirrorSchedule{}
+
+	err := collection.db.ProcessByPrefix([]byte("M"), func(_, blob []byte) error {
+		s := &MirrorSchedule{}
+		if err := s.Decode(blob); err != nil {
+			log.Printf("Error decoding mirror schedule: %s\n", err)
+			return nil
+		}
+
+		schedules = append(schedules, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range schedules {
+		if err = handler(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Drop removes schedule of the mirror from DB, it's not an error if mirror has no schedule
+func (collection *MirrorScheduleCollection) Drop(repo *RemoteRepo) error {
+	return collection.db.Delete((&MirrorSchedule{MirrorUUID: repo.UUID}).Key())
+}
@@ -0,0 +1,88 @@
+package deb
+
+import (
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+type MirrorScheduleSuite struct {
+	db   database.Storage
+	repo *RemoteRepo
+}
+
+var _ = Suite(&MirrorScheduleSuite{})
+
+func (s *MirrorScheduleSuite) SetUpTest(c *C) {
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.repo, _ = NewRemoteRepo("bookworm", "http://deb.debian.org/debian/", "bookworm", []string{"main"}, []string{}, false, false, false)
+}
+
+func (s *MirrorScheduleSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *MirrorScheduleSuite) TestValidate(c *C) {
+	c.Check(NewMirrorSchedule(s.repo, "", 0, nil).Validate(), ErrorMatches, "either cron expression or interval should be set")
+	c.Check(NewMirrorSchedule(s.repo, "@daily", 3600, nil).Validate(), ErrorMatches, "either cron expression or interval should be set")
+	c.Check(NewMirrorSchedule(s.repo, "", 30, nil).Validate(), ErrorMatches, "interval should be at least 60 seconds")
+	c.Check(NewMirrorSchedule(s.repo, "0 25 * * *", 0, nil).Validate(), ErrorMatches, ".*out of range 0-23")
+	c.Check(NewMirrorSchedule(s.repo, "@daily", 0, []PipelineStep{{Action: PipelineActionMirrorSnapshot, Mirror: "bookworm"}}).Validate(),
+		ErrorMatches, "action 1: mirror and snapshot are required for mirror-snapshot")
+
+	c.Check(NewMirrorSchedule(s.repo, "", 3600, nil).Validate(), IsNil)
+	c.Check(NewMirrorSchedule(s.repo, "30 2 * * *", 0, []PipelineStep{
+		{Action: PipelineActionMirrorSnapshot, Mirror: "bookworm", Snapshot: "bookworm-{date}"},
+	}).Validate(), IsNil)
+}
+
+func (s *MirrorScheduleSuite) TestNext(c *C) {
+	t := time.Date(2024, 3, 5, 10, 20, 30, 0, time.UTC)
+
+	c.Check(NewMirrorSchedule(s.repo, "", 3600, nil).Next(t), Equals, t.Add(time.Hour))
+	c.Check(NewMirrorSchedule(s.repo, "30 2 * * *", 0, nil).Next(t), Equals, time.Date(2024, 3, 6, 2, 30, 0, 0, time.UTC))
+
+	schedule := NewMirrorSchedule(s.repo, "", 3600, nil)
+	c.Check(schedule.Due(t), Equals, false)
+	schedule.NextRun = t
+	c.Check(schedule.Due(t), Equals, true)
+	c.Check(schedule.Due(t.Add(-time.Second)), Equals, false)
+}
+
+func (s *MirrorScheduleSuite) TestCollection(c *C) {
+	collection := NewMirrorScheduleCollection(s.db)
+
+	_, err := collection.ByMirror(s.repo)
+	c.Check(err, ErrorMatches, "mirror bookworm has no schedule")
+
+	schedule := NewMirrorSchedule(s.repo, "@daily", 0, []PipelineStep{
+		{Action: PipelineActionMirrorSnapshot, Mirror: "bookworm", Snapshot: "bookworm-{date}"},
+	})
+	schedule.NextRun = time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)
+	c.Assert(collection.Update(schedule), IsNil)
+
+	// schedule follows renamed mirror
+	s.repo.Name = "debian-bookworm"
+
+	schedule2, err := collection.ByMirror(s.repo)
+	c.Assert(err, IsNil)
+	c.Check(schedule2.Mirror, Equals, "debian-bookworm")
+	c.Check(schedule2.Cron, Equals, "@daily")
+	c.Check(schedule2.Actions, DeepEquals, schedule.Actions)
+	c.Check(schedule2.NextRun.Equal(schedule.NextRun), Equals, true)
+
+	uuids := []string{}
+	c.Check(collection.ForEach(func(s *MirrorSchedule) error {
+		uuids = append(uuids, s.MirrorUUID)
+		return nil
+	}), IsNil)
+	c.Check(uuids, DeepEquals, []string{s.repo.UUID})
+
+	c.Assert(collection.Drop(s.repo), IsNil)
+	_, err = collection.ByMirror(s.repo)
+	c.Check(err, NotNil)
+	c.Check(collection.Drop(s.repo), IsNil)
+}
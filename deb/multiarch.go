@@ -0,0 +1,188 @@
+package deb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// Kinds of Multi-Arch consistency problems
+const (
+	// MultiArchVersionMismatch is reported when Multi-Arch: same package has different versions across architectures
+	MultiArchVersionMismatch = "version-mismatch"
+	// MultiArchChecksumMismatch is reported when the same package (name, version, architecture) has different files
+	MultiArchChecksumMismatch = "checksum-mismatch"
+	// MultiArchSameForArchAll is reported when Architecture: all package is marked as Multi-Arch: same
+	MultiArchSameForArchAll = "same-for-arch-all"
+	// MultiArchInvalidValue is reported when value of Multi-Arch field is not recognized
+	MultiArchInvalidValue = "invalid-value"
+)
+
+var multiArchValues = []string{"same", "foreign", "allowed", "no"}
+
+// MultiArchProblem describes single Multi-Arch consistency violation
+type MultiArchProblem struct {
+	// Kind of the problem
+	Kind string
+	// Name of the package
+	Package string
+	// Human-readable description
+	Message string
+	// Packages involved
+	Packages []string
+}
+
+// String returns human-readable representation of the problem
+func (problem MultiArchProblem) String() string {
+	return fmt.Sprintf("%s: %s", problem.Package, problem.Message)
+}
+
+// NewMultiArchReport checks packages referenced by reflist for Multi-Arch violations
+//
+// Unlike regular package lists, packages are loaded allowing duplicates, so that
+// conflicting packages with the same name, version and architecture could be detected
+func NewMultiArchReport(reflist *PackageRefList, collection *PackageCollection) ([]MultiArchProblem, error) {
+	list := NewPackageListWithDuplicates(true, reflist.Len())
+
+	err := reflist.ForEach(func(key []byte) error {
+		p, err := collection.ByKey(key)
+		if err != nil {
+			return fmt.Errorf("unable to load package with key %s: %s", key, err)
+		}
+		return list.Add(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return MultiArchReport(list), nil
+}
+
+// MultiArchReport checks list of packages for Multi-Arch violations which break
+// installation on multi-arch enabled systems
+func MultiArchReport(list *PackageList) []MultiArchProblem {
+	problems := []MultiArchProblem{}
+
+	// name -> architecture -> versions
+	sameVersions := map[string]map[string][]string{}
+	// short key -> packages
+	byShortKey := map[string][]*Package{}
+
+	list.ForEach(func(p *Package) error {
+		if p.IsSource {
+			return nil
+		}
+
+		shortKey := string(p.ShortKey(""))
+		byShortKey[shortKey] = append(byShortKey[shortKey], p)
+
+		multiArch := strings.TrimSpace(p.GetField("Multi-Arch"))
+		if multiArch == "" {
+			return nil
+		}
+
+		if !utils.StrSliceHasItem(multiArchValues, multiArch) {
+			problems = append(problems, MultiArchProblem{
+				Kind:     MultiArchInvalidValue,
+				Package:  p.Name,
+				Message:  fmt.Sprintf("invalid Multi-Arch value %#v", multiArch),
+				Packages: []string{p.String()},
+			})
+			return nil
+		}
+
+		if multiArch != "same" {
+			return nil
+		}
+
+		if p.Architecture == ArchitectureAll {
+			problems = append(problems, MultiArchProblem{
+				Kind:     MultiArchSameForArchAll,
+				Package:  p.Name,
+				Message:  "Architecture: all package can't be Multi-Arch: same",
+				Packages: []string{p.String()},
+			})
+			return nil
+		}
+
+		archs, ok := sameVersions[p.Name]
+		if !ok {
+			archs = map[string][]string{}
+			sameVersions[p.Name] = archs
+		}
+		archs[p.Architecture] = append(archs[p.Architecture], p.Version)
+
+		return nil
+	})
+
+	for name, archs := range sameVersions {
+		if len(archs) < 2 {
+			continue
+		}
+
+		var (
+			reference string
+			mismatch  bool
+			packages  []string
+		)
+
+		for arch, versions := range archs {
+			versions = utils.StrSliceDeduplicate(versions)
+			sort.Strings(versions)
+			joined := strings.Join(versions, ", ")
+
+			if reference == "" {
+				reference = joined
+			} else if reference != joined {
+				mismatch = true
+			}
+
+			for _, version := range versions {
+				packages = append(packages, fmt.Sprintf("%s_%s_%s", name, version, arch))
+			}
+		}
+
+		if mismatch {
+			sort.Strings(packages)
+			problems = append(problems, MultiArchProblem{
+				Kind:     MultiArchVersionMismatch,
+				Package:  name,
+				Message:  "Multi-Arch: same package has different versions across architectures",
+				Packages: packages,
+			})
+		}
+	}
+
+	for _, pkgs := range byShortKey {
+		if len(pkgs) < 2 {
+			continue
+		}
+
+		packages := make([]string, len(pkgs))
+		for i, p := range pkgs {
+			packages[i] = fmt.Sprintf("%s (files hash %08x)", p, p.FilesHash)
+		}
+		sort.Strings(packages)
+
+		problems = append(problems, MultiArchProblem{
+			Kind:     MultiArchChecksumMismatch,
+			Package:  pkgs[0].Name,
+			Message:  fmt.Sprintf("package %s is present with different checksums", pkgs[0]),
+			Packages: packages,
+		})
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Package != problems[j].Package {
+			return problems[i].Package < problems[j].Package
+		}
+		if problems[i].Kind != problems[j].Kind {
+			return problems[i].Kind < problems[j].Kind
+		}
+		return strings.Join(problems[i].Packages, " ") < strings.Join(problems[j].Packages, " ")
+	})
+
+	return problems
+}
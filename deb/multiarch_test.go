@@ -0,0 +1,67 @@
+package deb
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type MultiArchSuite struct{}
+
+var _ = Suite(&MultiArchSuite{})
+
+func (s *MultiArchSuite) newPackage(arch, version, multiArch, md5 string) *Package {
+	stanza := packageStanza.Copy()
+	stanza["Architecture"] = arch
+	stanza["Version"] = version
+	if multiArch != "" {
+		stanza["Multi-Arch"] = multiArch
+	}
+	if md5 != "" {
+		stanza["MD5sum"] = md5
+	}
+	return NewPackageFromControlFile(stanza)
+}
+
+func (s *MultiArchSuite) TestConsistent(c *C) {
+	list := NewPackageListWithDuplicates(true, 0)
+	c.Assert(list.Add(s.newPackage("i386", "7.40-2", "same", "")), IsNil)
+	c.Assert(list.Add(s.newPackage("amd64", "7.40-2", "same", "")), IsNil)
+
+	c.Check(MultiArchReport(list), DeepEquals, []MultiArchProblem{})
+}
+
+func (s *MultiArchSuite) TestVersionMismatch(c *C) {
+	list := NewPackageListWithDuplicates(true, 0)
+	c.Assert(list.Add(s.newPackage("i386", "7.40-2", "same", "")), IsNil)
+	c.Assert(list.Add(s.newPackage("amd64", "7.40-3", "same", "")), IsNil)
+	c.Assert(list.Add(s.newPackage("armhf", "7.40-3", "foreign", "")), IsNil)
+
+	problems := MultiArchReport(list)
+	c.Assert(problems, HasLen, 1)
+	c.Check(problems[0].Kind, Equals, MultiArchVersionMismatch)
+	c.Check(problems[0].Package, Equals, "alien-arena-common")
+	c.Check(problems[0].Packages, DeepEquals, []string{"alien-arena-common_7.40-2_i386", "alien-arena-common_7.40-3_amd64"})
+}
+
+func (s *MultiArchSuite) TestChecksumMismatch(c *C) {
+	list := NewPackageListWithDuplicates(true, 0)
+	c.Assert(list.Add(s.newPackage("i386", "7.40-2", "", "")), IsNil)
+	c.Assert(list.Add(s.newPackage("i386", "7.40-2", "", "00000000000000000000000000000000")), IsNil)
+
+	problems := MultiArchReport(list)
+	c.Assert(problems, HasLen, 1)
+	c.Check(problems[0].Kind, Equals, MultiArchChecksumMismatch)
+	c.Check(problems[0].Packages, HasLen, 2)
+}
+
+func (s *MultiArchSuite) TestInvalidFields(c *C) {
+	list := NewPackageListWithDuplicates(true, 0)
+	c.Assert(list.Add(s.newPackage("all", "7.40-2", "same", "")), IsNil)
+	c.Assert(list.Add(s.newPackage("i386", "7.40-2", "sometimes", "")), IsNil)
+
+	problems := MultiArchReport(list)
+	c.Assert(problems, HasLen, 2)
+	c.Check(problems[0].Kind, Equals, MultiArchInvalidValue)
+	c.Check(problems[0].Packages, DeepEquals, []string{"alien-arena-common_7.40-2_i386"})
+	c.Check(problems[1].Kind, Equals, MultiArchSameForArchAll)
+	c.Check(problems[1].Packages, DeepEquals, []string{"alien-arena-common_7.40-2_all"})
+}
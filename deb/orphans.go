@@ -0,0 +1,138 @@
+package deb
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// OrphanedPoolFile is file in package pool not used by any referenced package
+type OrphanedPoolFile struct {
+	// Path of file relative to package pool
+	Path string `json:"Path"`
+	// Size of file in bytes
+	Size int64 `json:"Size"`
+}
+
+// ReferencedPackageRefs collects packages referenced by mirrors, local repos, snapshots
+// and published repositories
+func ReferencedPackageRefs(collectionFactory *CollectionFactory) (*PackageRefList, error) {
+	result := NewPackageRefList()
+
+	err := collectionFactory.RemoteRepoCollection().ForEach(func(repo *RemoteRepo) error {
+		e := collectionFactory.RemoteRepoCollection().LoadComplete(repo)
+		if e != nil {
+			return e
+		}
+		if repo.RefList() != nil {
+			result = result.Merge(repo.RefList(), false, true)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = collectionFactory.LocalRepoCollection().ForEach(func(repo *LocalRepo) error {
+		e := collectionFactory.LocalRepoCollection().LoadComplete(repo)
+		if e != nil {
+			return e
+		}
+		if repo.RefList() != nil {
+			result = result.Merge(repo.RefList(), false, true)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = collectionFactory.SnapshotCollection().ForEach(func(snapshot *Snapshot) error {
+		e := collectionFactory.SnapshotCollection().LoadComplete(snapshot)
+		if e != nil {
+			return e
+		}
+
+		result = result.Merge(snapshot.RefList(), false, true)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = collectionFactory.PublishedRepoCollection().ForEach(func(published *PublishedRepo) error {
+		// published repositories of other kinds reference packages of snapshots
+		if published.SourceKind != SourceLocalRepo {
+			return nil
+		}
+		e := collectionFactory.PublishedRepoCollection().LoadComplete(published, collectionFactory)
+		if e != nil {
+			return e
+		}
+
+		for _, component := range published.Components() {
+			result = result.Merge(published.RefList(component), false, true)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// OrphanedPoolFiles finds files in package pool which are not used by packages referenced
+// by mirrors, local repos, snapshots and published repositories
+//
+// Unlike db cleanup, packages in DB are not touched: files of unreferenced packages are
+// reported as orphaned as well.
+func OrphanedPoolFiles(collectionFactory *CollectionFactory, packagePool aptly.PackagePool, progress aptly.Progress) ([]OrphanedPoolFile, error) {
+	existingPackageRefs, err := ReferencedPackageRefs(collectionFactory)
+	if err != nil {
+		return nil, err
+	}
+
+	referencedFiles := make([]string, 0, existingPackageRefs.Len())
+
+	err = existingPackageRefs.ForEach(func(key []byte) error {
+		pkg, err2 := collectionFactory.PackageCollection().ByKey(key)
+		if err2 != nil {
+			return fmt.Errorf("unable to load package %s: %s", string(key), err2)
+		}
+		paths, err2 := pkg.FilepathList(packagePool)
+		if err2 != nil {
+			return err2
+		}
+		referencedFiles = append(referencedFiles, paths...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(referencedFiles)
+
+	existingFiles, err := packagePool.FilepathList(progress)
+	if err != nil {
+		return nil, fmt.Errorf("unable to collect file paths: %s", err)
+	}
+	sort.Strings(existingFiles)
+
+	result := []OrphanedPoolFile{}
+	for _, path := range utils.StrSlicesSubstract(existingFiles, referencedFiles) {
+		size, err := packagePool.Size(path)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, OrphanedPoolFile{Path: path, Size: size})
+	}
+
+	return result, nil
+}
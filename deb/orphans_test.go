@@ -0,0 +1,78 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+	"github.com/aptly-dev/aptly/files"
+
+	. "gopkg.in/check.v1"
+)
+
+type OrphanedPoolFilesSuite struct {
+	PackageListMixinSuite
+	db          database.Storage
+	factory     *CollectionFactory
+	packagePool aptly.PackagePool
+	poolRoot    string
+}
+
+var _ = Suite(&OrphanedPoolFilesSuite{})
+
+func (s *OrphanedPoolFilesSuite) SetUpTest(c *C) {
+	s.SetUpPackages()
+
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.factory = NewCollectionFactory(s.db)
+
+	s.poolRoot = c.MkDir()
+	s.packagePool = files.NewPackagePool(s.poolRoot, false)
+	cs := files.NewMockChecksumStorage()
+
+	for i, p := range []*Package{s.p1, s.p2} {
+		tmpFilepath := filepath.Join(c.MkDir(), "file")
+		c.Assert(os.WriteFile(tmpFilepath, []byte{byte(i)}, 0644), IsNil)
+
+		pkgFiles := PackageFiles{p.Files()[0]}
+		pkgFiles[0].Checksums.Size = 1
+		pkgFiles[0].Checksums.MD5 = ""
+		pkgFiles[0].Checksums.SHA1 = ""
+		pkgFiles[0].Checksums.SHA256 = ""
+		pkgFiles[0].Checksums.SHA512 = ""
+
+		var err error
+		pkgFiles[0].PoolPath, err = s.packagePool.Import(tmpFilepath, pkgFiles[0].Filename, &pkgFiles[0].Checksums, false, cs)
+		c.Assert(err, IsNil)
+		p.UpdateFiles(pkgFiles)
+
+		c.Assert(s.factory.PackageCollection().Update(p), IsNil)
+	}
+}
+
+func (s *OrphanedPoolFilesSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *OrphanedPoolFilesSuite) TestOrphanedPoolFiles(c *C) {
+	list := NewPackageList()
+	c.Assert(list.Add(s.p1), IsNil)
+
+	repo := NewLocalRepo("repo", "")
+	repo.UpdateRefList(NewPackageRefListFromPackageList(list))
+	c.Assert(s.factory.LocalRepoCollection().Add(repo), IsNil)
+
+	// p2 is in DB, but not referenced
+	orphans, err := OrphanedPoolFiles(s.factory, s.packagePool, nil)
+	c.Assert(err, IsNil)
+	c.Check(orphans, DeepEquals, []OrphanedPoolFile{{Path: s.p2.Files()[0].PoolPath, Size: 1}})
+
+	c.Assert(list.Add(s.p2), IsNil)
+	c.Assert(s.factory.SnapshotCollection().Add(NewSnapshotFromPackageList("snap", nil, list, "")), IsNil)
+
+	orphans, err = OrphanedPoolFiles(s.factory, s.packagePool, nil)
+	c.Assert(err, IsNil)
+	c.Check(orphans, DeepEquals, []OrphanedPoolFile{})
+}
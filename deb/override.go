@@ -0,0 +1,218 @@
+package deb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// PackageOverride is a set of fields to replace in index entry of the package
+type PackageOverride struct {
+	// Fields to set: field name -> value
+	Fields map[string]string
+	// If not empty, Maintainer is overridden only if it matches one of the values
+	OldMaintainers []string `codec:",omitempty" json:",omitempty"`
+}
+
+// PublishOverrides adjusts fields of packages in published indexes without modifying
+// stored package metadata, similar to apt-ftparchive override files
+type PublishOverrides struct {
+	// Overrides for binary packages: package name -> override
+	Binary map[string]*PackageOverride `codec:",omitempty" json:",omitempty"`
+	// Overrides for source packages: package name -> override
+	Source map[string]*PackageOverride `codec:",omitempty" json:",omitempty"`
+}
+
+// NewPublishOverrides creates empty set of overrides
+func NewPublishOverrides() *PublishOverrides {
+	return &PublishOverrides{
+		Binary: map[string]*PackageOverride{},
+		Source: map[string]*PackageOverride{},
+	}
+}
+
+// Empty checks whether there are no overrides
+func (o *PublishOverrides) Empty() bool {
+	return o == nil || len(o.Binary) == 0 && len(o.Source) == 0
+}
+
+func (o *PublishOverrides) set(overrides map[string]*PackageOverride, name, field, value string) *PackageOverride {
+	override := overrides[name]
+	if override == nil {
+		override = &PackageOverride{Fields: map[string]string{}}
+		overrides[name] = override
+	}
+
+	override.Fields[field] = value
+	return override
+}
+
+// SetBinaryField sets override of field for binary package name
+func (o *PublishOverrides) SetBinaryField(name, field, value string) {
+	o.set(o.Binary, name, field, value)
+}
+
+// SetSourceField sets override of field for source package name
+func (o *PublishOverrides) SetSourceField(name, field, value string) {
+	o.set(o.Source, name, field, value)
+}
+
+// Apply modifies stanza of package p according to overrides
+func (o *PublishOverrides) Apply(p *Package, stanza Stanza) {
+	if o == nil {
+		return
+	}
+
+	overrides := o.Binary
+	if p.IsSource {
+		overrides = o.Source
+	}
+
+	override := overrides[p.Name]
+	if override == nil {
+		return
+	}
+
+	for field, value := range override.Fields {
+		if field == "Maintainer" && len(override.OldMaintainers) > 0 && !utils.StrSliceHasItem(override.OldMaintainers, stanza["Maintainer"]) {
+			continue
+		}
+
+		stanza[field] = value
+	}
+}
+
+// overrideLines calls handler for every non-empty line of override file with comments stripped
+func overrideLines(r io.Reader, handler func(fields []string, line string) error) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if err := handler(strings.Fields(line), line); err != nil {
+			return fmt.Errorf("line %d: %s", lineNo, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// overrideRest returns the rest of the line after skipping n whitespace-separated fields
+func overrideRest(line string, n int) string {
+	for i := 0; i < n; i++ {
+		line = strings.TrimLeft(line, " \t")
+		if j := strings.IndexAny(line, " \t"); j != -1 {
+			line = line[j:]
+		} else {
+			line = ""
+		}
+	}
+
+	return strings.TrimSpace(line)
+}
+
+// ParseOverride parses apt-ftparchive binary override file
+//
+// Each line has format: package priority section [maintainer]. Maintainer could be
+// specified as "old => new" or "old1 // old2 => new" to override only matching maintainers
+func (o *PublishOverrides) ParseOverride(r io.Reader) error {
+	return overrideLines(r, func(fields []string, line string) error {
+		if len(fields) < 3 {
+			return fmt.Errorf("expected at least 3 fields, got %#v", line)
+		}
+
+		override := o.set(o.Binary, fields[0], "Priority", fields[1])
+		override.Fields["Section"] = fields[2]
+
+		if len(fields) > 3 {
+			maintainer := overrideRest(line, 3)
+
+			if parts := strings.SplitN(maintainer, "=>", 2); len(parts) == 2 {
+				override.OldMaintainers = nil
+				for _, old := range strings.Split(parts[0], "//") {
+					override.OldMaintainers = append(override.OldMaintainers, strings.TrimSpace(old))
+				}
+				maintainer = strings.TrimSpace(parts[1])
+			}
+
+			override.Fields["Maintainer"] = maintainer
+		}
+
+		return nil
+	})
+}
+
+// ParseSourceOverride parses apt-ftparchive source override file
+//
+// Each line has format: package section
+func (o *PublishOverrides) ParseSourceOverride(r io.Reader) error {
+	return overrideLines(r, func(fields []string, line string) error {
+		if len(fields) != 2 {
+			return fmt.Errorf("expected 2 fields, got %#v", line)
+		}
+
+		o.SetSourceField(fields[0], "Section", fields[1])
+		return nil
+	})
+}
+
+// ParseExtraOverride parses apt-ftparchive extra override file
+//
+// Each line has format: package field value
+func (o *PublishOverrides) ParseExtraOverride(r io.Reader) error {
+	return overrideLines(r, func(fields []string, line string) error {
+		if len(fields) < 3 {
+			return fmt.Errorf("expected at least 3 fields, got %#v", line)
+		}
+
+		o.SetBinaryField(fields[0], fields[1], overrideRest(line, 2))
+		return nil
+	})
+}
+
+// ParseOverrideFiles loads overrides from the files in apt-ftparchive format, empty
+// filenames are skipped
+func ParseOverrideFiles(overrideFile, sourceOverrideFile, extraOverrideFile string) (*PublishOverrides, error) {
+	overrides := NewPublishOverrides()
+
+	for _, item := range []struct {
+		filename string
+		parse    func(io.Reader) error
+	}{
+		{overrideFile, overrides.ParseOverride},
+		{sourceOverrideFile, overrides.ParseSourceOverride},
+		{extraOverrideFile, overrides.ParseExtraOverride},
+	} {
+		if item.filename == "" {
+			continue
+		}
+
+		f, err := os.Open(item.filename)
+		if err != nil {
+			return nil, err
+		}
+
+		err = item.parse(f)
+		f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("error parsing override file %s: %s", item.filename, err)
+		}
+	}
+
+	return overrides, nil
+}
@@ -0,0 +1,69 @@
+package deb
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type OverrideSuite struct{}
+
+var _ = Suite(&OverrideSuite{})
+
+func (s *OverrideSuite) TestParseOverride(c *C) {
+	overrides := NewPublishOverrides()
+	err := overrides.ParseOverride(strings.NewReader(`# comment
+alien-arena-common optional games
+coreutils required utils Debian Team <team@debian.org>
+hardlink extra utils Old One <old@example.com> // Old Two <old2@example.com> => New <new@example.com>
+`))
+	c.Assert(err, IsNil)
+
+	c.Check(overrides.Binary["alien-arena-common"].Fields, DeepEquals, map[string]string{"Priority": "optional", "Section": "games"})
+	c.Check(overrides.Binary["coreutils"].Fields, DeepEquals, map[string]string{
+		"Priority": "required", "Section": "utils", "Maintainer": "Debian Team <team@debian.org>"})
+	c.Check(overrides.Binary["hardlink"].Fields["Maintainer"], Equals, "New <new@example.com>")
+	c.Check(overrides.Binary["hardlink"].OldMaintainers, DeepEquals, []string{"Old One <old@example.com>", "Old Two <old2@example.com>"})
+
+	c.Check(overrides.ParseOverride(strings.NewReader("pkg optional\n")), ErrorMatches, "line 1: expected at least 3 fields.*")
+}
+
+func (s *OverrideSuite) TestParseSourceAndExtraOverride(c *C) {
+	overrides := NewPublishOverrides()
+	c.Assert(overrides.ParseSourceOverride(strings.NewReader("alien-arena games\n")), IsNil)
+	c.Assert(overrides.ParseExtraOverride(strings.NewReader("alien-arena-common Task  desktop, games\n")), IsNil)
+
+	c.Check(overrides.Source["alien-arena"].Fields, DeepEquals, map[string]string{"Section": "games"})
+	c.Check(overrides.Binary["alien-arena-common"].Fields, DeepEquals, map[string]string{"Task": "desktop, games"})
+
+	c.Check(overrides.ParseSourceOverride(strings.NewReader("alien-arena\n")), ErrorMatches, "line 1: expected 2 fields.*")
+}
+
+func (s *OverrideSuite) TestApply(c *C) {
+	var nilOverrides *PublishOverrides
+	c.Check(nilOverrides.Empty(), Equals, true)
+
+	overrides := NewPublishOverrides()
+	c.Check(overrides.Empty(), Equals, true)
+
+	c.Assert(overrides.ParseOverride(strings.NewReader(
+		"alien-arena-common extra oldgames Someone <someone@example.com> => New <new@example.com>\n")), IsNil)
+	c.Check(overrides.Empty(), Equals, false)
+
+	p := NewPackageFromControlFile(packageStanza.Copy())
+	stanza := p.Stanza()
+	overrides.Apply(p, stanza)
+
+	c.Check(stanza["Priority"], Equals, "extra")
+	c.Check(stanza["Section"], Equals, "oldgames")
+	// maintainer doesn't match
+	c.Check(stanza["Maintainer"], Equals, "Debian Games Team <pkg-games-devel@lists.alioth.debian.org>")
+	// stored package is not modified
+	c.Check(p.Stanza()["Section"], Equals, "contrib/games")
+
+	overrides.Binary["alien-arena-common"].OldMaintainers = nil
+	overrides.Apply(p, stanza)
+	c.Check(stanza["Maintainer"], Equals, "New <new@example.com>")
+
+	nilOverrides.Apply(p, stanza)
+}
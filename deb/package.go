@@ -578,6 +578,50 @@ func (p *Package) CalculateContents(packagePool aptly.PackagePool, progress aptl
 	return contents, nil
 }
 
+// Licenses returns licenses detected in copyright files of the package
+func (p *Package) Licenses(packagePool aptly.PackagePool, progress aptly.Progress) []string {
+	if p.IsSource {
+		return nil
+	}
+
+	return p.collection.loadLicenses(p, packagePool, progress)
+}
+
+// CalculateLicenses extracts copyright files from package file and detects licenses
+func (p *Package) CalculateLicenses(packagePool aptly.PackagePool, progress aptly.Progress) ([]string, error) {
+	if p.IsSource {
+		return nil, nil
+	}
+
+	file := p.Files()[0]
+	poolPath, err := file.GetPoolPath(packagePool)
+	if err != nil {
+		if progress != nil {
+			progress.ColoredPrintf("@y[!]@| @!Failed to build pool path: @| %s", err)
+		}
+		return nil, err
+	}
+
+	reader, err := packagePool.Open(poolPath)
+	if err != nil {
+		if progress != nil {
+			progress.ColoredPrintf("@y[!]@| @!Failed to open package in pool: @| %s", err)
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	copyrights, err := GetCopyrightFromDeb(reader, file.Filename)
+	if err != nil {
+		if progress != nil {
+			progress.ColoredPrintf("@y[!]@| @!Failed to extract copyright: @| %s", err)
+		}
+		return nil, err
+	}
+
+	return DetectLicenses(copyrights), nil
+}
+
 // UpdateFiles saves new state of files
 func (p *Package) UpdateFiles(files PackageFiles) {
 	p.files = &files
@@ -688,26 +732,7 @@ func (p *Package) Equals(p2 *Package) bool {
 // LinkFromPool links package file from pool to dist's pool location
 func (p *Package) LinkFromPool(publishedStorage aptly.PublishedStorage, packagePool aptly.PackagePool,
 	prefix, relPath string, force bool) error {
-
-	for i, f := range p.Files() {
-		sourcePoolPath, err := f.GetPoolPath(packagePool)
-		if err != nil {
-			return err
-		}
-
-		err = publishedStorage.LinkFromPool(prefix, relPath, f.Filename, packagePool, sourcePoolPath, f.Checksums, force)
-		if err != nil {
-			return err
-		}
-
-		if p.IsSource {
-			p.Extra()["Directory"] = relPath
-		} else {
-			p.Files()[i].downloadPath = relPath
-		}
-	}
-
-	return nil
+	return newPoolUploader(publishedStorage, packagePool, prefix, force, 1).Link(p, relPath)
 }
 
 // PoolDirectory returns directory in package pool of published repository for this package files
@@ -754,6 +779,14 @@ func (p *Package) DownloadList(packagePool aptly.PackagePool, checksumStorage ap
 			return nil, err
 		}
 
+		if !verified {
+			// same file might be already in the pool under another name
+			verified, err = files[idx].FindInPool(packagePool, checksumStorage)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		if !verified {
 			result = append(result, PackageDownloadTask{File: &files[idx]})
 		}
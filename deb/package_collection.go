@@ -201,6 +201,45 @@ func (collection *PackageCollection) loadContents(p *Package, packagePool aptly.
 	return contents
 }
 
+// loadLicenses loads or calculates and saves package licenses
+func (collection *PackageCollection) loadLicenses(p *Package, packagePool aptly.PackagePool, progress aptly.Progress) []string {
+	encoded, err := collection.db.Get(p.Key("xL"))
+	if err == nil {
+		licenses := []string{}
+
+		decoder := codec.NewDecoderBytes(encoded, collection.codecHandle)
+		err = decoder.Decode(&licenses)
+		if err != nil {
+			panic("unable to decode licenses")
+		}
+
+		return licenses
+	}
+
+	if err != database.ErrNotFound {
+		panic("unable to load licenses")
+	}
+
+	licenses, err := p.CalculateLicenses(packagePool, progress)
+	if err != nil {
+		// failed to acquire licenses, don't persist it
+		return licenses
+	}
+
+	var buf bytes.Buffer
+	err = codec.NewEncoder(&buf, collection.codecHandle).Encode(licenses)
+	if err != nil {
+		panic("unable to encode licenses")
+	}
+
+	err = collection.db.Put(p.Key("xL"), buf.Bytes())
+	if err != nil {
+		panic("unable to save licenses")
+	}
+
+	return licenses
+}
+
 // Update adds or updates information about package in DB
 func (collection *PackageCollection) Update(p *Package) error {
 	transaction, err := collection.db.OpenTransaction()
@@ -343,3 +382,37 @@ func (collection *PackageCollection) SearchByKey(arch, name, version string) (re
 
 	return
 }
+
+// SearchSourceFile looks for file with the same name and checksums among files of all
+// versions of source package source, it returns nil if no such file is found
+//
+// This allows to locate files shared between versions of source package (like orig tarballs)
+// which have been already imported into the package pool
+func (collection *PackageCollection) SearchSourceFile(source string, file PackageFile) *PackageFile {
+	for _, key := range collection.db.KeysByPrefix([]byte(fmt.Sprintf("P%s %s ", ArchitectureSource, source))) {
+		pkg, err := collection.ByKey(key)
+		if err != nil {
+			continue
+		}
+
+		if !pkg.IsSource || pkg.Name != source {
+			continue
+		}
+
+		for _, f := range pkg.Files() {
+			if f.Filename != file.Filename || f.Checksums.Size != file.Checksums.Size {
+				continue
+			}
+
+			if f.Checksums.MD5 != "" && file.Checksums.MD5 != "" && f.Checksums.MD5 != file.Checksums.MD5 ||
+				f.Checksums.SHA256 != "" && file.Checksums.SHA256 != "" && f.Checksums.SHA256 != file.Checksums.SHA256 {
+				continue
+			}
+
+			result := f
+			return &result
+		}
+	}
+
+	return nil
+}
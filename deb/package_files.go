@@ -35,6 +35,33 @@ func (f *PackageFile) Verify(packagePool aptly.PackagePool, checksumStorage aptl
 	return exists, err
 }
 
+// FindInPool looks up file with the same contents in the package pool, which might have been
+// imported under another name (e.g. by another mirror or upload)
+//
+// If file is found, it is used as pool file for f.
+func (f *PackageFile) FindInPool(packagePool aptly.PackagePool, checksumStorage aptly.ChecksumStorage) (bool, error) {
+	index, ok := checksumStorage.(aptly.ChecksumIndex)
+	if !ok || f.Checksums.SHA256 == "" {
+		return false, nil
+	}
+
+	poolPath, err := index.PathBySHA256(f.Checksums.SHA256)
+	if err != nil || poolPath == "" {
+		return false, err
+	}
+
+	checksums := f.Checksums
+	_, exists, err := packagePool.Verify(poolPath, f.Filename, &checksums, checksumStorage)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	f.PoolPath = poolPath
+	f.Checksums = checksums
+
+	return true, nil
+}
+
 // GetPoolPath returns path to the file in the pool
 //
 // For legacy packages which do not have PoolPath field set, that calculates LegacyPath via pool
@@ -61,3 +61,42 @@ func (s *PackageFilesSuite) TestDownloadURL(c *C) {
 func (s *PackageFilesSuite) TestHash(c *C) {
 	c.Check(s.files.Hash(), Equals, uint64(0xc8901eedd79ac51b))
 }
+
+func (s *PackageFilesSuite) TestFindInPool(c *C) {
+	packagePool := files.NewPackagePool(c.MkDir(), false)
+
+	tmpFilepath := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(tmpFilepath, []byte("abcde"), 0777), IsNil)
+
+	checksums, err := utils.ChecksumsForFile(tmpFilepath)
+	c.Assert(err, IsNil)
+
+	s.files[0].Checksums = utils.ChecksumInfo{Size: checksums.Size, SHA256: checksums.SHA256}
+
+	result, err := s.files[0].FindInPool(packagePool, s.cs)
+	c.Check(err, IsNil)
+	c.Check(result, Equals, false)
+
+	// same file uploaded under another name
+	poolPath, err := packagePool.Import(tmpFilepath, "upload.deb", &checksums, false, s.cs)
+	c.Assert(err, IsNil)
+
+	result, err = s.files[0].Verify(packagePool, s.cs)
+	c.Check(err, IsNil)
+	c.Check(result, Equals, false)
+
+	result, err = s.files[0].FindInPool(packagePool, s.cs)
+	c.Check(err, IsNil)
+	c.Check(result, Equals, true)
+	c.Check(s.files[0].PoolPath, Equals, poolPath)
+	c.Check(s.files[0].Checksums, DeepEquals, checksums)
+
+	// file of another size is not matched
+	s.files[0].PoolPath = ""
+	s.files[0].Checksums = utils.ChecksumInfo{Size: 6, SHA256: checksums.SHA256}
+
+	result, err = s.files[0].FindInPool(packagePool, s.cs)
+	c.Check(err, IsNil)
+	c.Check(result, Equals, false)
+	c.Check(s.files[0].PoolPath, Equals, "")
+}
@@ -0,0 +1,549 @@
+package deb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// DefaultDiffsDepth is number of patches kept in index diffs (pdiffs) by default
+const DefaultDiffsDepth = 20
+
+// maxDiffEdits limits number of changed stanzas in a patch, if index changed more
+// than that, history of diffs is restarted and clients download index in full
+const maxDiffEdits = 2000
+
+// pdiffDateFormat is format of patch names
+const pdiffDateFormat = "2006-01-02-1504.05"
+
+// pdiffChecksum is SHA256 checksum and size of a file
+type pdiffChecksum struct {
+	SHA256 string
+	Size   int64
+}
+
+func newPdiffChecksum(contents []byte) pdiffChecksum {
+	sum := sha256.Sum256(contents)
+	return pdiffChecksum{SHA256: hex.EncodeToString(sum[:]), Size: int64(len(contents))}
+}
+
+// pdiffEntry is single patch in pdiff Index
+type pdiffEntry struct {
+	Name string
+	// Index version patch applies to
+	History pdiffChecksum
+	// Uncompressed patch
+	Patch pdiffChecksum
+	// Compressed patch, as downloaded by clients
+	Download pdiffChecksum
+}
+
+// pdiffIndex is contents of Packages.diff/Index file, entries are ordered oldest first
+type pdiffIndex struct {
+	Current pdiffChecksum
+	Entries []pdiffEntry
+}
+
+// parsePdiffIndex parses Packages.diff/Index file
+func parsePdiffIndex(contents []byte) (*pdiffIndex, error) {
+	index := &pdiffIndex{}
+	entries := map[string]int{}
+	var field string
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") {
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("malformed line: %q", line)
+			}
+			field = parts[0]
+
+			if field == "SHA256-Current" {
+				values := strings.Fields(parts[1])
+				if len(values) != 2 {
+					return nil, fmt.Errorf("malformed line: %q", line)
+				}
+				size, err := strconv.ParseInt(values[1], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("malformed line: %q", line)
+				}
+				index.Current = pdiffChecksum{SHA256: values[0], Size: size}
+			}
+			continue
+		}
+
+		values := strings.Fields(line)
+		if len(values) != 3 {
+			return nil, fmt.Errorf("malformed line: %q", line)
+		}
+		size, err := strconv.ParseInt(values[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed line: %q", line)
+		}
+		checksum := pdiffChecksum{SHA256: values[0], Size: size}
+
+		name := strings.TrimSuffix(values[2], ".gz")
+		i, ok := entries[name]
+		if !ok {
+			if field != "SHA256-History" {
+				continue
+			}
+			index.Entries = append(index.Entries, pdiffEntry{Name: name})
+			i = len(index.Entries) - 1
+			entries[name] = i
+		}
+		entry := &index.Entries[i]
+
+		switch field {
+		case "SHA256-History":
+			entry.History = checksum
+		case "SHA256-Patches":
+			entry.Patch = checksum
+		case "SHA256-Download":
+			entry.Download = checksum
+		}
+	}
+
+	return index, scanner.Err()
+}
+
+// WriteTo writes Index file contents
+func (index *pdiffIndex) WriteTo(w *bufio.Writer) error {
+	fmt.Fprintf(w, "SHA256-Current: %s %d\n", index.Current.SHA256, index.Current.Size)
+
+	for _, field := range []string{"SHA256-History", "SHA256-Patches", "SHA256-Download"} {
+		if len(index.Entries) == 0 {
+			break
+		}
+
+		fmt.Fprintf(w, "%s:\n", field)
+		for _, entry := range index.Entries {
+			switch field {
+			case "SHA256-History":
+				fmt.Fprintf(w, " %s %8d %s\n", entry.History.SHA256, entry.History.Size, entry.Name)
+			case "SHA256-Patches":
+				fmt.Fprintf(w, " %s %8d %s\n", entry.Patch.SHA256, entry.Patch.Size, entry.Name)
+			case "SHA256-Download":
+				fmt.Fprintf(w, " %s %8d %s.gz\n", entry.Download.SHA256, entry.Download.Size, entry.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// splitStanzas splits index file into stanzas (with trailing empty line), returning
+// stanzas and number of lines in each of them
+func splitStanzas(contents []byte) (stanzas []string, lines []int) {
+	start, count := 0, 0
+	for i := 0; i < len(contents); i++ {
+		if contents[i] != '\n' {
+			continue
+		}
+		count++
+
+		// stanza ends with empty line
+		if i+1 < len(contents) && contents[i+1] == '\n' {
+			stanzas = append(stanzas, string(contents[start:i+2]))
+			lines = append(lines, count+1)
+			start, count = i+2, 0
+			i++
+		}
+	}
+
+	if start < len(contents) {
+		if contents[len(contents)-1] != '\n' {
+			count++
+		}
+		stanzas = append(stanzas, string(contents[start:]))
+		lines = append(lines, count)
+	}
+
+	return
+}
+
+// diffHunk is a range of stanzas [OldStart, OldEnd) replaced with [NewStart, NewEnd)
+type diffHunk struct {
+	OldStart, OldEnd int
+	NewStart, NewEnd int
+}
+
+// diffSequences finds hunks transforming sequence a into b (Myers algorithm),
+// returns false if there are more than maxEdits changes
+func diffSequences(a, b []int, maxEdits int) ([]diffHunk, bool) {
+	// skip common prefix and suffix
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(a), len(b)
+
+	if n+m > 0 && (n == 0 || m == 0) {
+		if n+m > maxEdits {
+			return nil, false
+		}
+		return []diffHunk{{prefix, prefix + n, prefix, prefix + m}}, true
+	}
+
+	if n+m == 0 {
+		return nil, true
+	}
+
+	maxD := n + m
+	if maxD > maxEdits {
+		maxD = maxEdits
+	}
+
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		trace = append(trace, append([]int(nil), v...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		return nil, false
+	}
+
+	// backtrack edit path, collecting changed positions (in reverse order)
+	type edit struct {
+		insert bool
+		x, y   int
+	}
+	var edits []edit
+
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+
+		if x == prevX {
+			edits = append(edits, edit{insert: true, x: x, y: prevY})
+		} else {
+			edits = append(edits, edit{insert: false, x: prevX, y: y})
+		}
+
+		x, y = prevX, prevY
+	}
+
+	// group consecutive edits into hunks
+	var hunks []diffHunk
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		var hunk diffHunk
+		if e.insert {
+			hunk = diffHunk{e.x, e.x, e.y, e.y + 1}
+		} else {
+			hunk = diffHunk{e.x, e.x + 1, e.y, e.y}
+		}
+		hunk.OldStart += prefix
+		hunk.OldEnd += prefix
+		hunk.NewStart += prefix
+		hunk.NewEnd += prefix
+
+		if len(hunks) > 0 {
+			last := &hunks[len(hunks)-1]
+			if last.OldEnd == hunk.OldStart && last.NewEnd == hunk.NewStart {
+				last.OldEnd, last.NewEnd = hunk.OldEnd, hunk.NewEnd
+				continue
+			}
+		}
+		hunks = append(hunks, hunk)
+	}
+
+	return hunks, true
+}
+
+// edDiff generates patch in ed format (as produced by diff --ed), which transforms
+// index file old into current
+//
+// Index files are compared stanza by stanza, which is much faster than comparing lines,
+// as package stanzas are changed as a whole. If indexes are too different, false is returned.
+func edDiff(old, current []byte) ([]byte, bool) {
+	oldStanzas, oldLines := splitStanzas(old)
+	newStanzas, _ := splitStanzas(current)
+
+	ids := map[string]int{}
+	intern := func(stanzas []string) []int {
+		result := make([]int, len(stanzas))
+		for i, stanza := range stanzas {
+			id, ok := ids[stanza]
+			if !ok {
+				id = len(ids)
+				ids[stanza] = id
+			}
+			result[i] = id
+		}
+		return result
+	}
+
+	hunks, ok := diffSequences(intern(oldStanzas), intern(newStanzas), maxDiffEdits)
+	if !ok {
+		return nil, false
+	}
+
+	// first line (1-based) of each stanza in old file
+	firstLine := make([]int, len(oldStanzas)+1)
+	firstLine[0] = 1
+	for i, count := range oldLines {
+		firstLine[i+1] = firstLine[i] + count
+	}
+
+	var patch bytes.Buffer
+
+	// commands are applied from the end of file, so that line numbers stay valid
+	for i := len(hunks) - 1; i >= 0; i-- {
+		hunk := hunks[i]
+		start, end := firstLine[hunk.OldStart], firstLine[hunk.OldEnd]-1
+
+		switch {
+		case hunk.OldStart == hunk.OldEnd:
+			fmt.Fprintf(&patch, "%da\n", start-1)
+		case start == end:
+			fmt.Fprintf(&patch, "%d", start)
+		default:
+			fmt.Fprintf(&patch, "%d,%d", start, end)
+		}
+
+		if hunk.OldStart != hunk.OldEnd {
+			if hunk.NewStart == hunk.NewEnd {
+				patch.WriteString("d\n")
+				continue
+			}
+			patch.WriteString("c\n")
+		}
+
+		for _, stanza := range newStanzas[hunk.NewStart:hunk.NewEnd] {
+			patch.WriteString(stanza)
+			if !strings.HasSuffix(stanza, "\n") {
+				patch.WriteByte('\n')
+			}
+		}
+		patch.WriteString(".\n")
+	}
+
+	return patch.Bytes(), true
+}
+
+// generateDiff generates patch between previously published version of package index and
+// new one, publishes it and prepares new Index of patches
+func (files *indexFiles) generateDiff(file *indexFile) error {
+	if err := file.w.Flush(); err != nil {
+		return fmt.Errorf("unable to write to index file: %s", err)
+	}
+
+	current, err := os.ReadFile(file.tempFilename)
+	if err != nil {
+		return err
+	}
+	currentChecksum := newPdiffChecksum(current)
+
+	diffDir := file.relativePath + ".diff"
+	index := &pdiffIndex{}
+
+	if contents, e := files.diffsStorage.ReadFile(filepath.Join(files.diffsBasePath, diffDir, "Index")); e == nil {
+		index, err = parsePdiffIndex(contents)
+		if err != nil {
+			return fmt.Errorf("unable to parse %s/Index: %s", diffDir, err)
+		}
+	}
+
+	entries := index.Entries
+
+	old, e := files.diffsStorage.ReadFile(filepath.Join(files.diffsBasePath, file.relativePath))
+	if e != nil {
+		// nothing to diff against
+		entries = nil
+	} else if oldChecksum := newPdiffChecksum(old); oldChecksum != currentChecksum {
+		if oldChecksum != index.Current {
+			// diffs weren't generated for published version
+			entries = nil
+		}
+
+		patch, ok := edDiff(old, current)
+		if ok && len(patch) < len(current)/2 {
+			var entry pdiffEntry
+			entry, err = files.publishPatch(diffDir, entries, patch)
+			if err != nil {
+				return err
+			}
+			entry.History = oldChecksum
+			entries = append(entries, entry)
+		} else {
+			entries = nil
+		}
+	}
+
+	depth := files.diffsDepth
+	if depth <= 0 {
+		depth = DefaultDiffsDepth
+	}
+	if len(entries) > depth {
+		entries = entries[len(entries)-depth:]
+	}
+
+	kept := map[string]bool{}
+	for _, entry := range entries {
+		kept[entry.Name] = true
+	}
+
+	sameDir := files.diffsBasePath == files.basePath
+	for _, entry := range index.Entries {
+		if kept[entry.Name] {
+			if !sameDir {
+				// new generation of indexes is published into another directory, carry patch over
+				err = files.copyPatch(filepath.Join(diffDir, entry.Name+".gz"))
+				if err != nil {
+					return err
+				}
+			}
+		} else if sameDir {
+			_ = files.publishedStorage.Remove(filepath.Join(files.basePath, diffDir, entry.Name+".gz"))
+		}
+	}
+
+	bufWriter, err := files.DiffIndex(file.relativePath).BufWriter()
+	if err != nil {
+		return err
+	}
+
+	return (&pdiffIndex{Current: currentChecksum, Entries: entries}).WriteTo(bufWriter)
+}
+
+// publishPatch compresses and uploads patch under unique name
+func (files *indexFiles) publishPatch(diffDir string, entries []pdiffEntry, patch []byte) (pdiffEntry, error) {
+	entry := pdiffEntry{Name: time.Now().UTC().Format(pdiffDateFormat), Patch: newPdiffChecksum(patch)}
+
+	for i := 1; ; i++ {
+		unique := true
+		for _, other := range entries {
+			if other.Name == entry.Name {
+				unique = false
+			}
+		}
+		if unique {
+			break
+		}
+		entry.Name = fmt.Sprintf("%s-%d", time.Now().UTC().Format(pdiffDateFormat), i)
+	}
+
+	tempFilename := filepath.Join(files.tempDir, strings.Replace(filepath.Join(diffDir, entry.Name), "/", "_", -1))
+	tempFile, err := os.Create(tempFilename)
+	if err != nil {
+		return entry, err
+	}
+	defer tempFile.Close()
+
+	if _, err = tempFile.Write(patch); err != nil {
+		return entry, err
+	}
+
+	if err = utils.CompressFile(tempFile, true); err != nil {
+		return entry, fmt.Errorf("unable to compress patch: %s", err)
+	}
+
+	compressed, err := os.ReadFile(tempFilename + ".gz")
+	if err != nil {
+		return entry, err
+	}
+	entry.Download = newPdiffChecksum(compressed)
+
+	err = files.publishedStorage.MkDir(filepath.Join(files.basePath, diffDir))
+	if err != nil {
+		return entry, fmt.Errorf("unable to create dir: %s", err)
+	}
+
+	err = files.putFile(filepath.Join(files.basePath, diffDir, entry.Name+".gz"), tempFilename+".gz")
+	if err != nil {
+		return entry, fmt.Errorf("unable to publish patch: %s", err)
+	}
+
+	return entry, nil
+}
+
+// copyPatch copies previously published patch into directory of new generation
+func (files *indexFiles) copyPatch(path string) error {
+	contents, err := files.diffsStorage.ReadFile(filepath.Join(files.diffsBasePath, path))
+	if err != nil {
+		return fmt.Errorf("unable to read patch %s: %s", path, err)
+	}
+
+	tempFilename := filepath.Join(files.tempDir, strings.Replace(path, "/", "_", -1))
+	if err = os.WriteFile(tempFilename, contents, 0644); err != nil {
+		return err
+	}
+
+	err = files.publishedStorage.MkDir(filepath.Dir(filepath.Join(files.basePath, path)))
+	if err != nil {
+		return fmt.Errorf("unable to create dir: %s", err)
+	}
+
+	return files.putFile(filepath.Join(files.basePath, path), tempFilename)
+}
+
+// enableDiffs turns on generation of package index diffs, previously published indexes
+// are read from basePath of storage
+func (files *indexFiles) enableDiffs(storage aptly.ReadablePublishedStorage, basePath string, depth int) {
+	files.diffsStorage = storage
+	files.diffsBasePath = basePath
+	files.diffsDepth = depth
+}
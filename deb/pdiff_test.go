@@ -0,0 +1,249 @@
+package deb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aptly-dev/aptly/files"
+	. "gopkg.in/check.v1"
+)
+
+type PdiffSuite struct {
+	storage *files.PublishedStorage
+	tempDir string
+}
+
+var _ = Suite(&PdiffSuite{})
+
+func (s *PdiffSuite) SetUpTest(c *C) {
+	s.storage = files.NewPublishedStorage(c.MkDir(), "", "")
+	s.tempDir = c.MkDir()
+}
+
+// applyEd applies patch in ed format (subset produced by edDiff) to contents
+func applyEd(contents []byte, patch []byte) ([]byte, error) {
+	lines := strings.SplitAfter(string(contents), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	patchLines := strings.SplitAfter(string(patch), "\n")
+	for i := 0; i < len(patchLines) && patchLines[i] != ""; i++ {
+		command := strings.TrimSuffix(patchLines[i], "\n")
+		op := command[len(command)-1]
+		addr := strings.SplitN(command[:len(command)-1], ",", 2)
+
+		start, err := strconv.Atoi(addr[0])
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(addr) == 2 {
+			if end, err = strconv.Atoi(addr[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		var text []string
+		if op == 'a' || op == 'c' {
+			for i++; patchLines[i] != ".\n"; i++ {
+				text = append(text, patchLines[i])
+			}
+		}
+
+		var from, to int
+		switch op {
+		case 'a':
+			from, to = start, start
+		case 'c', 'd':
+			from, to = start-1, end
+		default:
+			return nil, fmt.Errorf("unknown command %q", command)
+		}
+
+		lines = append(lines[:from], append(text, lines[to:]...)...)
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+}
+
+func generateStanzas(names []int) []byte {
+	var buf bytes.Buffer
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "Package: pkg%d\nVersion: 1.%d\nDescription: package %d\n", name, name, name)
+	}
+	return buf.Bytes()
+}
+
+func (s *PdiffSuite) TestEdDiff(c *C) {
+	rnd := rand.New(rand.NewSource(42))
+
+	for iteration := 0; iteration < 200; iteration++ {
+		var oldNames, newNames []int
+		for i := 0; i < rnd.Intn(40); i++ {
+			oldNames = append(oldNames, rnd.Intn(1000))
+		}
+		for _, name := range oldNames {
+			switch rnd.Intn(6) {
+			case 0:
+				// removed
+			case 1:
+				newNames = append(newNames, name, rnd.Intn(1000))
+			case 2:
+				newNames = append(newNames, name+1000)
+			default:
+				newNames = append(newNames, name)
+			}
+		}
+		if rnd.Intn(2) == 0 {
+			newNames = append(newNames, rnd.Intn(1000))
+		}
+
+		old, current := generateStanzas(oldNames), generateStanzas(newNames)
+
+		patch, ok := edDiff(old, current)
+		c.Assert(ok, Equals, true)
+
+		patched, err := applyEd(old, patch)
+		c.Assert(err, IsNil)
+		c.Assert(string(patched), Equals, string(current), Commentf("old: %v, new: %v, patch:\n%s", oldNames, newNames, patch))
+	}
+
+	patch, ok := edDiff(generateStanzas([]int{1, 2, 3}), generateStanzas([]int{1, 2, 3}))
+	c.Check(ok, Equals, true)
+	c.Check(patch, HasLen, 0)
+
+	patch, ok = edDiff(generateStanzas([]int{1, 2, 3}), generateStanzas([]int{1, 4, 3}))
+	c.Check(ok, Equals, true)
+	c.Check(string(patch), Equals, "5,8c\nPackage: pkg4\nVersion: 1.4\nDescription: package 4\n\n.\n")
+}
+
+func (s *PdiffSuite) TestEdDiffTooManyChanges(c *C) {
+	var oldNames, newNames []int
+	for i := 0; i < maxDiffEdits; i++ {
+		oldNames = append(oldNames, 2*i)
+		newNames = append(newNames, 2*i+1)
+	}
+
+	_, ok := edDiff(generateStanzas(oldNames), generateStanzas(newNames))
+	c.Check(ok, Equals, false)
+}
+
+func (s *PdiffSuite) TestIndexRoundTrip(c *C) {
+	index := &pdiffIndex{
+		Current: pdiffChecksum{SHA256: "c0", Size: 300},
+		Entries: []pdiffEntry{
+			{Name: "2024-01-02-0304.05", History: pdiffChecksum{"a1", 100}, Patch: pdiffChecksum{"b1", 10}, Download: pdiffChecksum{"d1", 5}},
+			{Name: "2024-01-03-0304.05", History: pdiffChecksum{"a2", 200}, Patch: pdiffChecksum{"b2", 20}, Download: pdiffChecksum{"d2", 15}},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	c.Assert(index.WriteTo(w), IsNil)
+	c.Assert(w.Flush(), IsNil)
+
+	c.Check(buf.String(), Equals, "SHA256-Current: c0 300\n"+
+		"SHA256-History:\n a1      100 2024-01-02-0304.05\n a2      200 2024-01-03-0304.05\n"+
+		"SHA256-Patches:\n b1       10 2024-01-02-0304.05\n b2       20 2024-01-03-0304.05\n"+
+		"SHA256-Download:\n d1        5 2024-01-02-0304.05.gz\n d2       15 2024-01-03-0304.05.gz\n")
+
+	parsed, err := parsePdiffIndex(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Check(parsed, DeepEquals, index)
+
+	_, err = parsePdiffIndex([]byte("SHA256-Current: c0\n"))
+	c.Check(err, ErrorMatches, "malformed line: .*")
+}
+
+func (s *PdiffSuite) publish(c *C, contents []byte, depth int) *pdiffIndex {
+	indexes := newIndexFiles(s.storage, "dists/test", s.tempDir, "", false, true)
+	indexes.enableDiffs(s.storage, "dists/test", depth)
+
+	w, err := indexes.PackageIndex("main", "i386", false, false, "").BufWriter()
+	c.Assert(err, IsNil)
+	_, err = w.Write(contents)
+	c.Assert(err, IsNil)
+
+	c.Assert(indexes.FinalizeAll(nil, nil), IsNil)
+	_, ok := indexes.generatedFiles["main/binary-i386/Packages.diff/Index"]
+	c.Check(ok, Equals, true)
+
+	contents, err = s.storage.ReadFile("dists/test/main/binary-i386/Packages.diff/Index")
+	c.Assert(err, IsNil)
+	index, err := parsePdiffIndex(contents)
+	c.Assert(err, IsNil)
+	return index
+}
+
+func (s *PdiffSuite) readPatch(c *C, name string) []byte {
+	f, err := os.Open(filepath.Join(s.storage.PublicPath(), "dists/test/main/binary-i386/Packages.diff", name+".gz"))
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	c.Assert(err, IsNil)
+	patch, err := io.ReadAll(r)
+	c.Assert(err, IsNil)
+	return patch
+}
+
+func (s *PdiffSuite) TestGenerateDiff(c *C) {
+	names := make([]int, 20)
+	for i := range names {
+		names[i] = i
+	}
+
+	versions := [][]byte{generateStanzas(names)}
+	index := s.publish(c, versions[0], 2)
+	c.Check(index.Current, Equals, newPdiffChecksum(versions[0]))
+	c.Check(index.Entries, HasLen, 0)
+
+	for i := 0; i < 3; i++ {
+		names[5+i] = 100 + i
+		versions = append(versions, generateStanzas(names))
+		index = s.publish(c, versions[len(versions)-1], 2)
+	}
+
+	c.Check(index.Current, Equals, newPdiffChecksum(versions[3]))
+	c.Assert(index.Entries, HasLen, 2)
+
+	for i, entry := range index.Entries {
+		old := versions[i+1]
+		c.Check(entry.History, Equals, newPdiffChecksum(old))
+
+		patch := s.readPatch(c, entry.Name)
+		c.Check(entry.Patch, Equals, newPdiffChecksum(patch))
+
+		patched, err := applyEd(old, patch)
+		c.Assert(err, IsNil)
+		c.Check(string(patched), Equals, string(versions[i+2]))
+	}
+
+	patches, err := filepath.Glob(filepath.Join(s.storage.PublicPath(), "dists/test/main/binary-i386/Packages.diff/*.gz"))
+	c.Assert(err, IsNil)
+	c.Check(patches, HasLen, 2)
+
+	// unchanged index keeps history
+	index = s.publish(c, versions[3], 2)
+	c.Check(index.Entries, HasLen, 2)
+
+	// completely changed index restarts history
+	index = s.publish(c, generateStanzas([]int{200, 201}), 2)
+	c.Check(index.Entries, HasLen, 0)
+
+	patches, err = filepath.Glob(filepath.Join(s.storage.PublicPath(), "dists/test/main/binary-i386/Packages.diff/*.gz"))
+	c.Assert(err, IsNil)
+	c.Check(patches, HasLen, 0)
+}
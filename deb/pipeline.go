@@ -0,0 +1,183 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Pipeline step actions
+const (
+	PipelineActionMirrorUpdate   = "mirror-update"
+	PipelineActionMirrorSnapshot = "mirror-snapshot"
+	PipelineActionRepoSnapshot   = "repo-snapshot"
+	PipelineActionSnapshotMerge  = "snapshot-merge"
+	PipelineActionPublishSwitch  = "publish-switch"
+	PipelineActionPublishUpdate  = "publish-update"
+)
+
+// PipelineStep is single step of pipeline
+//
+// Snapshot names could contain placeholders {date} and {timestamp}, which are
+// replaced with the time pipeline was started, so that snapshots created by one
+// step could be referenced by following steps.
+type PipelineStep struct {
+	// Action: mirror-update, mirror-snapshot, repo-snapshot, snapshot-merge, publish-switch or publish-update
+	Action string `json:"Action"`
+	// Mirror to update or snapshot
+	Mirror string `json:"Mirror,omitempty"`
+	// Local repo to snapshot
+	Repo string `json:"Repo,omitempty"`
+	// Snapshot to create (mirror-snapshot, repo-snapshot, snapshot-merge)
+	Snapshot string `json:"Snapshot,omitempty"`
+	// Snapshots to merge (snapshot-merge)
+	Sources []string `json:"Sources,omitempty"`
+	// Merge only the latest version of each package (snapshot-merge)
+	Latest bool `json:"Latest,omitempty"`
+	// Published repository prefix, optionally with storage, and distribution (publish-switch, publish-update)
+	Prefix       string `json:"Prefix,omitempty"`
+	Distribution string `json:"Distribution,omitempty"`
+	// Component -> snapshot to switch published repository to (publish-switch)
+	Snapshots map[string]string `json:"Snapshots,omitempty"`
+}
+
+// Validate checks that step is complete
+func (step *PipelineStep) Validate() error {
+	switch step.Action {
+	case PipelineActionMirrorUpdate:
+		if step.Mirror == "" {
+			return fmt.Errorf("mirror is required for %s", step.Action)
+		}
+	case PipelineActionMirrorSnapshot:
+		if step.Mirror == "" || step.Snapshot == "" {
+			return fmt.Errorf("mirror and snapshot are required for %s", step.Action)
+		}
+	case PipelineActionRepoSnapshot:
+		if step.Repo == "" || step.Snapshot == "" {
+			return fmt.Errorf("repo and snapshot are required for %s", step.Action)
+		}
+	case PipelineActionSnapshotMerge:
+		if len(step.Sources) == 0 || step.Snapshot == "" {
+			return fmt.Errorf("sources and snapshot are required for %s", step.Action)
+		}
+	case PipelineActionPublishSwitch:
+		if step.Distribution == "" || len(step.Snapshots) == 0 {
+			return fmt.Errorf("distribution and snapshots are required for %s", step.Action)
+		}
+	case PipelineActionPublishUpdate:
+		if step.Distribution == "" {
+			return fmt.Errorf("distribution is required for %s", step.Action)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", step.Action)
+	}
+
+	return nil
+}
+
+// Pipeline is a named sequence of steps (mirror updates, snapshots, publishing)
+// run as single task
+type Pipeline struct {
+	// Name of the pipeline
+	Name string `json:"Name"`
+	// Description of the pipeline
+	Description string `json:"Description"`
+	// Steps run in order, pipeline stops at first failed step
+	Steps []PipelineStep `json:"Steps"`
+	// Time pipeline was last run
+	LastRun time.Time `json:"LastRun"`
+	// Error of last run, empty if succeeded
+	LastError string `json:"LastError"`
+}
+
+// NewPipeline creates new pipeline
+func NewPipeline(name, description string, steps []PipelineStep) *Pipeline {
+	return &Pipeline{Name: name, Description: description, Steps: steps}
+}
+
+// Validate checks that pipeline is complete
+func (pipeline *Pipeline) Validate() error {
+	if pipeline.Name == "" {
+		return fmt.Errorf("pipeline name is required")
+	}
+
+	if len(pipeline.Steps) == 0 {
+		return fmt.Errorf("pipeline %s has no steps", pipeline.Name)
+	}
+
+	for i := range pipeline.Steps {
+		if err := pipeline.Steps[i].Validate(); err != nil {
+			return fmt.Errorf("step %d: %s", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// ExpandSteps returns steps with placeholders in snapshot names replaced for
+// the run started at specified time
+func (pipeline *Pipeline) ExpandSteps(started time.Time) []PipelineStep {
+	return ExpandPipelineSteps(pipeline.Steps, started)
+}
+
+// ExpandPipelineSteps returns copy of steps with placeholders in snapshot names replaced
+// for the run started at specified time
+func ExpandPipelineSteps(steps []PipelineStep, started time.Time) []PipelineStep {
+	replacer := strings.NewReplacer(
+		"{date}", started.UTC().Format("20060102"),
+		"{timestamp}", started.UTC().Format("20060102150405"),
+	)
+
+	result := make([]PipelineStep, len(steps))
+
+	for i, step := range steps {
+		step.Snapshot = replacer.Replace(step.Snapshot)
+
+		sources := make([]string, len(step.Sources))
+		for j := range step.Sources {
+			sources[j] = replacer.Replace(step.Sources[j])
+		}
+		step.Sources = sources
+
+		if step.Snapshots != nil {
+			snapshots := make(map[string]string, len(step.Snapshots))
+			for component, snapshot := range step.Snapshots {
+				snapshots[component] = replacer.Replace(snapshot)
+			}
+			step.Snapshots = snapshots
+		}
+
+		result[i] = step
+	}
+
+	return result
+}
+
+// String interface
+func (pipeline *Pipeline) String() string {
+	return fmt.Sprintf("[%s]: %d steps", pipeline.Name, len(pipeline.Steps))
+}
+
+// Encode does msgpack encoding of Pipeline
+func (pipeline *Pipeline) Encode() []byte {
+	var buf bytes.Buffer
+
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	encoder.Encode(pipeline)
+
+	return buf.Bytes()
+}
+
+// Decode decodes msgpack representation into Pipeline
+func (pipeline *Pipeline) Decode(input []byte) error {
+	decoder := codec.NewDecoderBytes(input, &codec.MsgpackHandle{})
+	return decoder.Decode(pipeline)
+}
+
+// Key is a unique id in DB
+func (pipeline *Pipeline) Key() []byte {
+	return []byte("W" + pipeline.Name)
+}
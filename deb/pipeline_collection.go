@@ -0,0 +1,92 @@
+package deb
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/aptly-dev/aptly/database"
+)
+
+// PipelineCollection does listing, updating/adding/deleting of Pipelines
+type PipelineCollection struct {
+	db database.Storage
+}
+
+// NewPipelineCollection creates new PipelineCollection and binds it to database
+func NewPipelineCollection(db database.Storage) *PipelineCollection {
+	return &PipelineCollection{
+		db: db,
+	}
+}
+
+// Add appends new pipeline to collection and saves it
+func (collection *PipelineCollection) Add(pipeline *Pipeline) error {
+	_, err := collection.db.Get(pipeline.Key())
+	if err == nil {
+		return fmt.Errorf("pipeline with name %s already exists", pipeline.Name)
+	}
+	if err != database.ErrNotFound {
+		return err
+	}
+
+	return collection.Update(pipeline)
+}
+
+// Update stores updated information about pipeline in DB
+func (collection *PipelineCollection) Update(pipeline *Pipeline) error {
+	return collection.db.Put(pipeline.Key(), pipeline.Encode())
+}
+
+// ByName looks up pipeline by name
+func (collection *PipelineCollection) ByName(name string) (*Pipeline, error) {
+	pipeline := &Pipeline{Name: name}
+
+	encoded, err := collection.db.Get(pipeline.Key())
+	if err == database.ErrNotFound {
+		return nil, fmt.Errorf("pipeline with name %s not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pipeline.Decode(encoded); err != nil {
+		return nil, err
+	}
+
+	return pipeline, nil
+}
+
+// ForEach runs method for each pipeline, sorted by name
+func (collection *PipelineCollection) ForEach(handler func(*Pipeline) error) error {
+	pipelines := []*Pipeline{}
+
+	err := collection.db.ProcessByPrefix([]byte("W"), func(_, blob []byte) error {
+		p := &Pipeline{}
+		if err := p.Decode(blob); err != nil {
+			log.Printf("Error decoding pipeline: %s\n", err)
+			return nil
+		}
+
+		pipelines = append(pipelines, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(pipelines, func(i, j int) bool { return pipelines[i].Name < pipelines[j].Name })
+
+	for _, p := range pipelines {
+		if err = handler(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Drop removes pipeline from DB
+func (collection *PipelineCollection) Drop(pipeline *Pipeline) error {
+	return collection.db.Delete(pipeline.Key())
+}
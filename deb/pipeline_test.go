@@ -0,0 +1,92 @@
+package deb
+
+import (
+	"time"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+type PipelineSuite struct {
+	db database.Storage
+}
+
+var _ = Suite(&PipelineSuite{})
+
+func (s *PipelineSuite) SetUpTest(c *C) {
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+}
+
+func (s *PipelineSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *PipelineSuite) TestValidate(c *C) {
+	c.Check(NewPipeline("", "", nil).Validate(), ErrorMatches, "pipeline name is required")
+	c.Check(NewPipeline("nightly", "", nil).Validate(), ErrorMatches, "pipeline nightly has no steps")
+
+	pipeline := NewPipeline("nightly", "", []PipelineStep{
+		{Action: PipelineActionMirrorUpdate, Mirror: "bookworm"},
+		{Action: PipelineActionMirrorSnapshot, Mirror: "bookworm"},
+	})
+	c.Check(pipeline.Validate(), ErrorMatches, "step 2: mirror and snapshot are required for mirror-snapshot")
+
+	pipeline.Steps[1] = PipelineStep{Action: "mirror-drop"}
+	c.Check(pipeline.Validate(), ErrorMatches, `step 2: unknown action "mirror-drop"`)
+
+	pipeline.Steps[1] = PipelineStep{Action: PipelineActionPublishSwitch, Distribution: "bookworm",
+		Snapshots: map[string]string{"main": "bookworm-{date}"}}
+	c.Check(pipeline.Validate(), IsNil)
+}
+
+func (s *PipelineSuite) TestExpandSteps(c *C) {
+	pipeline := NewPipeline("nightly", "", []PipelineStep{
+		{Action: PipelineActionMirrorSnapshot, Mirror: "bookworm", Snapshot: "bookworm-{date}"},
+		{Action: PipelineActionSnapshotMerge, Sources: []string{"bookworm-{date}", "extras"}, Snapshot: "merged-{timestamp}"},
+		{Action: PipelineActionPublishSwitch, Distribution: "bookworm", Snapshots: map[string]string{"main": "merged-{timestamp}"}},
+	})
+
+	steps := pipeline.ExpandSteps(time.Date(2024, 3, 5, 10, 20, 30, 0, time.UTC))
+	c.Check(steps[0].Snapshot, Equals, "bookworm-20240305")
+	c.Check(steps[1].Sources, DeepEquals, []string{"bookworm-20240305", "extras"})
+	c.Check(steps[1].Snapshot, Equals, "merged-20240305102030")
+	c.Check(steps[2].Snapshots, DeepEquals, map[string]string{"main": "merged-20240305102030"})
+
+	// original steps are not modified
+	c.Check(pipeline.Steps[1].Sources[0], Equals, "bookworm-{date}")
+	c.Check(pipeline.Steps[2].Snapshots["main"], Equals, "merged-{timestamp}")
+}
+
+func (s *PipelineSuite) TestCollection(c *C) {
+	collection := NewPipelineCollection(s.db)
+
+	_, err := collection.ByName("nightly")
+	c.Check(err, ErrorMatches, "pipeline with name nightly not found")
+
+	pipeline := NewPipeline("nightly", "refresh", []PipelineStep{{Action: PipelineActionMirrorUpdate, Mirror: "bookworm"}})
+	c.Assert(collection.Add(pipeline), IsNil)
+	c.Check(collection.Add(pipeline), ErrorMatches, "pipeline with name nightly already exists")
+	c.Assert(collection.Add(NewPipeline("hourly", "", nil)), IsNil)
+
+	pipeline.LastError = "failed"
+	c.Assert(collection.Update(pipeline), IsNil)
+
+	pipeline2, err := collection.ByName("nightly")
+	c.Assert(err, IsNil)
+	c.Check(pipeline2.Description, Equals, "refresh")
+	c.Check(pipeline2.Steps, DeepEquals, pipeline.Steps)
+	c.Check(pipeline2.LastError, Equals, "failed")
+
+	names := []string{}
+	c.Check(collection.ForEach(func(p *Pipeline) error {
+		names = append(names, p.Name)
+		return nil
+	}), IsNil)
+	c.Check(names, DeepEquals, []string{"hourly", "nightly"})
+
+	c.Assert(collection.Drop(pipeline2), IsNil)
+	_, err = collection.ByName("nightly")
+	c.Check(err, NotNil)
+}
@@ -0,0 +1,165 @@
+package deb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// poolUpload is single package file to be linked from package pool to published storage
+type poolUpload struct {
+	relPath    string
+	fileName   string
+	sourcePath string
+	checksums  utils.ChecksumInfo
+}
+
+// poolUploader links package files from package pool to published storage
+//
+// With concurrency above 1, files are uploaded by several workers in background,
+// so that uploads to remote storages are pipelined with index generation. Otherwise files
+// are linked one by one, even if Link is called concurrently.
+type poolUploader struct {
+	publishedStorage aptly.PublishedStorage
+	packagePool      aptly.PackagePool
+	prefix           string
+	force            bool
+
+	queue    chan poolUpload
+	wg       sync.WaitGroup
+	waitOnce sync.Once
+	linkLock sync.Mutex
+
+	errLock sync.Mutex
+	err     error
+
+	// statistics of uploads, updated atomically
+	files    int64
+	bytes    int64
+	duration int64
+}
+
+func newPoolUploader(publishedStorage aptly.PublishedStorage, packagePool aptly.PackagePool, prefix string, force bool, concurrency int) *poolUploader {
+	u := &poolUploader{
+		publishedStorage: publishedStorage,
+		packagePool:      packagePool,
+		prefix:           prefix,
+		force:            force,
+	}
+
+	if concurrency > 1 {
+		u.queue = make(chan poolUpload, concurrency*4)
+
+		for i := 0; i < concurrency; i++ {
+			u.wg.Add(1)
+			go u.worker()
+		}
+	}
+
+	return u
+}
+
+func (u *poolUploader) upload(f poolUpload) error {
+	start := time.Now()
+	err := u.publishedStorage.LinkFromPool(u.prefix, f.relPath, f.fileName, u.packagePool, f.sourcePath, f.checksums, u.force)
+	atomic.AddInt64(&u.duration, int64(time.Since(start)))
+	if err != nil {
+		publishedStorageErrorsCounter.WithLabelValues("link").Inc()
+	} else {
+		atomic.AddInt64(&u.files, 1)
+		atomic.AddInt64(&u.bytes, f.checksums.Size)
+	}
+
+	return err
+}
+
+func (u *poolUploader) worker() {
+	defer u.wg.Done()
+
+	for f := range u.queue {
+		if u.error() != nil {
+			// drain the queue after failure
+			continue
+		}
+
+		if err := u.upload(f); err != nil {
+			u.errLock.Lock()
+			if u.err == nil {
+				u.err = err
+			}
+			u.errLock.Unlock()
+		}
+	}
+}
+
+// error returns first upload error
+func (u *poolUploader) error() error {
+	u.errLock.Lock()
+	defer u.errLock.Unlock()
+
+	return u.err
+}
+
+// Link links package files to relPath in published storage
+//
+// Package is updated to point to published location immediately, while files
+// might still be uploading. Error of any previous upload is returned.
+func (u *poolUploader) Link(p *Package, relPath string) error {
+	for i, f := range p.Files() {
+		sourcePoolPath, err := f.GetPoolPath(u.packagePool)
+		if err != nil {
+			return err
+		}
+
+		upload := poolUpload{relPath: relPath, fileName: f.Filename, sourcePath: sourcePoolPath, checksums: f.Checksums}
+
+		if u.queue == nil {
+			u.linkLock.Lock()
+			err = u.upload(upload)
+			u.linkLock.Unlock()
+		} else {
+			err = u.error()
+			if err == nil {
+				u.queue <- upload
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if p.IsSource {
+			p.Extra()["Directory"] = relPath
+		} else {
+			p.Files()[i].downloadPath = relPath
+		}
+	}
+
+	return nil
+}
+
+// Wait waits for all uploads to complete, returning first error
+func (u *poolUploader) Wait() error {
+	u.waitOnce.Do(func() {
+		if u.queue != nil {
+			close(u.queue)
+			u.wg.Wait()
+		}
+	})
+
+	return u.error()
+}
+
+// concurrent returns true if files are uploaded in background
+func (u *poolUploader) concurrent() bool {
+	return u.queue != nil
+}
+
+// collectStats adds statistics of uploads to stats, should be called after Wait
+func (u *poolUploader) collectStats(stats *PublishStats) {
+	stats.PackageFiles += atomic.LoadInt64(&u.files)
+	stats.PackageBytes += atomic.LoadInt64(&u.bytes)
+	stats.Upload += time.Duration(atomic.LoadInt64(&u.duration))
+}
@@ -0,0 +1,128 @@
+package deb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+// slowStorage is published storage with slow LinkFromPool, tracking concurrent calls
+type slowStorage struct {
+	aptly.PublishedStorage
+
+	sync.Mutex
+	inFlight, maxInFlight int
+	fail                  string
+}
+
+func (storage *slowStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+	storage.Lock()
+	storage.inFlight++
+	if storage.inFlight > storage.maxInFlight {
+		storage.maxInFlight = storage.inFlight
+	}
+	storage.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	storage.Lock()
+	storage.inFlight--
+	storage.Unlock()
+
+	if fileName == storage.fail {
+		return errors.New("upload failed")
+	}
+
+	return storage.PublishedStorage.LinkFromPool(publishedPrefix, publishedRelPath, fileName, sourcePool, sourcePath, sourceChecksums, force)
+}
+
+type PoolUploaderSuite struct {
+	root        string
+	packagePool *files.PackagePool
+	storage     *slowStorage
+	packages    []*Package
+}
+
+var _ = Suite(&PoolUploaderSuite{})
+
+func (s *PoolUploaderSuite) SetUpTest(c *C) {
+	s.packagePool = files.NewPackagePool(c.MkDir(), false)
+	s.root = c.MkDir()
+	s.storage = &slowStorage{PublishedStorage: files.NewPublishedStorage(s.root, "", "")}
+
+	cs := files.NewMockChecksumStorage()
+	s.packages = nil
+
+	for i := 0; i < 8; i++ {
+		p := NewPackageFromControlFile(packageStanza.Copy())
+		p.Files()[0].Filename = fmt.Sprintf("alien-arena-common_7.40-%d_i386.deb", i)
+
+		tmpFilepath := filepath.Join(c.MkDir(), "file")
+		c.Assert(os.WriteFile(tmpFilepath, []byte(p.Files()[0].Filename), 0644), IsNil)
+
+		p.Files()[0].Checksums = utils.ChecksumInfo{}
+		var err error
+		p.Files()[0].PoolPath, err = s.packagePool.Import(tmpFilepath, p.Files()[0].Filename, &p.Files()[0].Checksums, false, cs)
+		c.Assert(err, IsNil)
+
+		s.packages = append(s.packages, p)
+	}
+}
+
+func (s *PoolUploaderSuite) TestSequential(c *C) {
+	uploader := newPoolUploader(s.storage, s.packagePool, "", false, 1)
+
+	for _, p := range s.packages {
+		c.Check(uploader.Link(p, "pool/main/a/alien-arena"), IsNil)
+		c.Check(p.Files()[0].downloadPath, Equals, "pool/main/a/alien-arena")
+	}
+	c.Check(uploader.Wait(), IsNil)
+
+	c.Check(s.storage.maxInFlight, Equals, 1)
+	c.Check(filepath.Join(s.root, "pool/main/a/alien-arena/alien-arena-common_7.40-7_i386.deb"), PathExists)
+}
+
+func (s *PoolUploaderSuite) TestConcurrent(c *C) {
+	uploader := newPoolUploader(s.storage, s.packagePool, "ppa", false, 4)
+
+	for _, p := range s.packages {
+		c.Check(uploader.Link(p, "pool/main/a/alien-arena"), IsNil)
+		c.Check(p.Files()[0].downloadPath, Equals, "pool/main/a/alien-arena")
+	}
+	c.Check(uploader.Wait(), IsNil)
+	// second Wait is no-op
+	c.Check(uploader.Wait(), IsNil)
+
+	c.Check(s.storage.maxInFlight > 1, Equals, true)
+	c.Check(s.storage.maxInFlight <= 4, Equals, true)
+
+	for _, p := range s.packages {
+		c.Check(filepath.Join(s.root, "ppa/pool/main/a/alien-arena", p.Files()[0].Filename), PathExists)
+	}
+}
+
+func (s *PoolUploaderSuite) TestConcurrentFailure(c *C) {
+	s.storage.fail = "alien-arena-common_7.40-0_i386.deb"
+
+	uploader := newPoolUploader(s.storage, s.packagePool, "", false, 2)
+
+	var err error
+	for _, p := range s.packages {
+		if err = uploader.Link(p, "pool/main/a/alien-arena"); err != nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Check(err, ErrorMatches, "upload failed")
+	c.Check(uploader.Wait(), ErrorMatches, "upload failed")
+}
@@ -0,0 +1,91 @@
+package deb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+)
+
+// DependencyProvider is a named package list used to satisfy dependencies
+type DependencyProvider struct {
+	// Name of the provider, e.g. snapshot name
+	Name string
+	// Packages of the provider, should be indexed
+	List *PackageList
+}
+
+// DependencyResolution records how dependency has been resolved
+type DependencyResolution struct {
+	Dependency Dependency
+	// Package which satisfied dependency, nil if dependency is unsatisfied
+	Package *Package
+	// Name of the provider which supplied the package
+	Provider string
+}
+
+// LoadDependencyProviders loads packages of providers specified as [snapshot:|mirror:|repo:]<name>,
+// snapshots among providers are returned as well to be recorded as sources
+func LoadDependencyProviders(collectionFactory *CollectionFactory, specs []string, progress aptly.Progress) ([]DependencyProvider, []*Snapshot, error) {
+	providers := make([]DependencyProvider, 0, len(specs))
+	snapshots := []*Snapshot{}
+
+	for _, spec := range specs {
+		kind, name := "snapshot", spec
+		if i := strings.Index(spec, ":"); i != -1 {
+			kind, name = spec[:i], spec[i+1:]
+		}
+
+		var refList *PackageRefList
+
+		switch kind {
+		case "snapshot":
+			snapshot, err := collectionFactory.SnapshotCollection().ByName(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = collectionFactory.SnapshotCollection().LoadComplete(snapshot)
+			if err != nil {
+				return nil, nil, err
+			}
+			refList = snapshot.RefList()
+			snapshots = append(snapshots, snapshot)
+		case "mirror":
+			repo, err := collectionFactory.RemoteRepoCollection().ByName(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = collectionFactory.RemoteRepoCollection().LoadComplete(repo)
+			if err != nil {
+				return nil, nil, err
+			}
+			refList = repo.RefList()
+		case "repo":
+			repo, err := collectionFactory.LocalRepoCollection().ByName(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = collectionFactory.LocalRepoCollection().LoadComplete(repo)
+			if err != nil {
+				return nil, nil, err
+			}
+			refList = repo.RefList()
+		default:
+			return nil, nil, fmt.Errorf("unknown provider kind %#v in %#v, expected snapshot, mirror or repo", kind, spec)
+		}
+
+		if refList == nil {
+			refList = NewPackageRefList()
+		}
+
+		list, err := NewPackageListFromRefList(refList, collectionFactory.PackageCollection(), progress)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to load packages: %s", err)
+		}
+		list.PrepareIndex()
+
+		providers = append(providers, DependencyProvider{Name: spec, List: list})
+	}
+
+	return providers, snapshots, nil
+}
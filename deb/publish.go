@@ -23,6 +23,8 @@ import (
 
 type SourceEntry struct {
 	Component, Name string
+	// Package query filtering packages of the source
+	Filter string `json:",omitempty"`
 }
 
 type PublishedRepoUpdateResult struct {
@@ -40,6 +42,9 @@ type repoSourceItem struct {
 	packageRefs *PackageRefList
 }
 
+// DefaultByHashDepth is number of previous generations of index files kept under by-hash by default
+const DefaultByHashDepth = 1
+
 // PublishedRepo is a published for http/ftp representation of snapshot as Debian repository
 type PublishedRepo struct {
 	// Internal unique ID
@@ -61,6 +66,8 @@ type PublishedRepo struct {
 
 	// Map of sources by each component: component name -> source UUID
 	Sources map[string]string
+	// Package queries filtering packages of sources: component name -> query
+	Filters map[string]string `codec:",omitempty"`
 
 	// Legacy fields for compatibility with old published repositories (< 0.6)
 	Component string
@@ -74,18 +81,68 @@ type PublishedRepo struct {
 
 	// Skip bz2 compression for index files
 	SkipBz2 bool
+	// Generate zstd compressed index files along with gzip (and bz2)
+	EnableZst bool `codec:",omitempty"`
 
 	// True if repo is being re-published
 	rePublishing bool
 
 	// Provide index files per hash also
 	AcquireByHash bool
+	// Number of previous generations of index files kept under by-hash (0 - DefaultByHashDepth)
+	ByHashDepth int `codec:",omitempty"`
+	// Generations of index files under by-hash: path of index file -> checksums, newest first
+	ByHashHistory map[string][]string `codec:",omitempty"`
+
+	// Generate diffs of package indexes (pdiffs) for incremental updates by clients
+	GenerateDiffs bool `codec:",omitempty"`
+	// Number of patches kept in diffs of package indexes (0 - DefaultDiffsDepth)
+	DiffsDepth int `codec:",omitempty"`
 
 	// Support multiple distributions
 	MultiDist bool
 
+	// Flat repository: indexes and Release file are published in the root of prefix
+	// without dists/<distribution> hierarchy, package files are referenced relative to prefix
+	Flat bool `codec:",omitempty"`
+
+	// Overrides of package fields in published indexes
+	Overrides *PublishOverrides `codec:",omitempty"`
+
+	// Handling of source packages with Extra-Source-Only: yes
+	ExtraSourceOnly string `codec:",omitempty"`
+	// Placement of Architecture: all packages in indexes
+	ArchitectureAll string `codec:",omitempty"`
+	// Handling of source packages without binary packages built from them
+	OrphanedSources string `codec:",omitempty"`
+
 	// Revision
 	Revision *PublishedRepoRevision
+
+	// Pending update waiting for approval
+	Approval *PublishApproval `codec:",omitempty"`
+
+	// Publish new generation of indexes into separate directory and swap it into place
+	BlueGreen bool `codec:",omitempty"`
+
+	// Frozen published repository can't be updated, switched or removed
+	Frozen bool `codec:",omitempty"`
+	// Maintenance notice published in Release file while frozen
+	FreezeNotice string `codec:",omitempty"`
+
+	// Statistics of latest publishing runs, newest first
+	PublishHistory []PublishStats `codec:",omitempty"`
+}
+
+// PublishApproval is an update of published repository requested via API and
+// held until approved by another user
+type PublishApproval struct {
+	// User who requested the update
+	RequestedBy string
+	// Time update was requested
+	RequestedAt time.Time
+	// Sources to be published: component -> snapshot/local repo name
+	Sources map[string]string
 }
 
 type PublishedRepoRevision struct {
@@ -336,7 +393,7 @@ func walkUpTree(source interface{}, collectionFactory *CollectionFactory) (rootD
 			if remoteRepo.Distribution != "" {
 				rootDistributions = append(rootDistributions, remoteRepo.Distribution)
 			}
-			rootComponents = append(rootComponents, remoteRepo.Components...)
+			rootComponents = append(rootComponents, remoteRepo.LocalComponents()...)
 		} else {
 			panic("unknown type")
 		}
@@ -510,10 +567,11 @@ func (p *PublishedRepo) MarshalJSON() ([]byte, error) {
 		sources = append(sources, SourceEntry{
 			Component: component,
 			Name:      name,
+			Filter:    p.Filters[component],
 		})
 	}
 
-	return json.Marshal(map[string]interface{}{
+	result := map[string]interface{}{
 		"Architectures":        p.Architectures,
 		"Distribution":         p.Distribution,
 		"Label":                p.Label,
@@ -530,7 +588,48 @@ func (p *PublishedRepo) MarshalJSON() ([]byte, error) {
 		"SkipContents":         p.SkipContents,
 		"AcquireByHash":        p.AcquireByHash,
 		"MultiDist":            p.MultiDist,
-	})
+		"BlueGreen":            p.BlueGreen,
+		"Frozen":               p.Frozen,
+	}
+
+	if !p.Overrides.Empty() {
+		result["Overrides"] = p.Overrides
+	}
+	if p.ExtraSourceOnly != "" {
+		result["ExtraSourceOnly"] = p.ExtraSourceOnly
+	}
+	if p.OrphanedSources != "" {
+		result["OrphanedSources"] = p.OrphanedSources
+	}
+	if p.ArchitectureAll != "" {
+		result["ArchitectureAll"] = p.ArchitectureAll
+	}
+	if p.Approval != nil {
+		result["PendingApproval"] = p.Approval
+	}
+	if p.FreezeNotice != "" {
+		result["FreezeNotice"] = p.FreezeNotice
+	}
+	if p.ByHashDepth != 0 {
+		result["ByHashDepth"] = p.ByHashDepth
+	}
+	if p.EnableZst {
+		result["EnableZst"] = p.EnableZst
+	}
+	if p.Flat {
+		result["Flat"] = p.Flat
+	}
+	if p.GenerateDiffs {
+		result["GenerateDiffs"] = p.GenerateDiffs
+	}
+	if p.DiffsDepth != 0 {
+		result["DiffsDepth"] = p.DiffsDepth
+	}
+	if len(p.PublishHistory) > 0 {
+		result["PublishHistory"] = p.PublishHistory
+	}
+
+	return json.Marshal(result)
 }
 
 // String returns human-readable representation of PublishedRepo
@@ -689,10 +788,39 @@ func (p *PublishedRepo) UpdateSnapshot(component string, snapshot *Snapshot) {
 	p.rePublishing = true
 }
 
+// Freeze marks published repository as frozen, so that it can't be updated, switched or
+// removed until unfrozen; notice (if set) is published in Release file
+func (p *PublishedRepo) Freeze(notice string) {
+	p.Frozen = true
+	p.FreezeNotice = notice
+	p.rePublishing = true
+}
+
+// Unfreeze lifts freeze of published repository
+func (p *PublishedRepo) Unfreeze() {
+	p.Frozen = false
+	p.FreezeNotice = ""
+	p.rePublishing = true
+}
+
+// CheckFrozen returns error if published repository is frozen
+func (p *PublishedRepo) CheckFrozen() error {
+	if !p.Frozen {
+		return nil
+	}
+
+	if p.FreezeNotice != "" {
+		return fmt.Errorf("published repository %s/%s is frozen: %s", p.StoragePrefix(), p.Distribution, p.FreezeNotice)
+	}
+
+	return fmt.Errorf("published repository %s/%s is frozen", p.StoragePrefix(), p.Distribution)
+}
+
 // RemoveComponent removes component from published repository
 func (p *PublishedRepo) RemoveComponent(component string) {
 	delete(p.Sources, component)
 	delete(p.sourceItems, component)
+	delete(p.Filters, component)
 
 	p.rePublishing = true
 }
@@ -757,6 +885,48 @@ func (p *PublishedRepo) GetPath() string {
 	return fmt.Sprintf("%s/%s", prefix, p.Distribution)
 }
 
+// releaseDir returns directory with Release file and indexes relative to prefix
+func (p *PublishedRepo) releaseDir() string {
+	if p.Flat {
+		return ""
+	}
+
+	return filepath.Join("dists", p.Distribution)
+}
+
+// poolRelPath returns directory in published pool for package files relative to prefix
+func (p *PublishedRepo) poolRelPath(pkg *Package, component string) (string, error) {
+	poolDir, err := pkg.PoolDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	if p.MultiDist {
+		return filepath.Join("pool", p.Distribution, component, poolDir), nil
+	}
+
+	return filepath.Join("pool", component, poolDir), nil
+}
+
+// CheckFlat verifies that published repository could be laid out as flat repository
+func (p *PublishedRepo) CheckFlat() error {
+	if !p.Flat {
+		return nil
+	}
+
+	if len(p.Sources) != 1 {
+		return fmt.Errorf("flat repository should have exactly one component")
+	}
+	if p.MultiDist {
+		return fmt.Errorf("flat repository can't be published with multiple distributions support")
+	}
+	if p.BlueGreen {
+		return fmt.Errorf("flat repository can't be published with blue-green publishing")
+	}
+
+	return nil
+}
+
 // GetSuite returns default or manual Suite:
 func (p *PublishedRepo) GetSuite() string {
 	if p.Suite == "" {
@@ -813,14 +983,27 @@ func (p *PublishedRepo) GetSkelFiles(skelDir string, component string) (map[stri
 
 // Publish publishes snapshot (repository) contents, links package files, generates Packages & Release files, signs them
 func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageProvider aptly.PublishedStorageProvider,
-	collectionFactory *CollectionFactory, signer pgp.Signer, progress aptly.Progress, forceOverwrite bool, skelDir string) error {
+	collectionFactory *CollectionFactory, signer pgp.FileSigner, progress aptly.Progress, forceOverwrite bool, skelDir string) error {
+	stats := PublishStats{StartedAt: time.Now()}
 	publishedStorage := publishedStorageProvider.GetPublishedStorage(p.Storage)
 
-	err := publishedStorage.MkDir(filepath.Join(p.Prefix, "pool"))
+	err := p.CheckFlat()
+	if err != nil {
+		return err
+	}
+
+	err = publishedStorage.MkDir(filepath.Join(p.Prefix, "pool"))
 	if err != nil {
 		return err
 	}
-	basePath := filepath.Join(p.Prefix, "dists", p.Distribution)
+	distPath := p.releaseDir()
+	var generation string
+	if p.BlueGreen {
+		generation = newGeneration()
+		distPath = filepath.Join(p.generationsPath(), generation)
+	}
+
+	basePath := filepath.Join(p.Prefix, distPath)
 	err = publishedStorage.MkDir(basePath)
 	if err != nil {
 		return err
@@ -853,6 +1036,16 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 		if err != nil {
 			return fmt.Errorf("unable to load packages: %s", err)
 		}
+
+		lists[component], err = p.filterComponent(component, lists[component])
+		if err != nil {
+			return err
+		}
+
+		_, err = FilterSources(lists[component], p.ExtraSourceOnly, p.OrphanedSources)
+		if err != nil {
+			return fmt.Errorf("unable to filter source packages: %s", err)
+		}
 	}
 
 	if !p.rePublishing {
@@ -870,8 +1063,15 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 		p.Architectures = utils.StrSliceDeduplicate(p.Architectures)
 	}
 
+	architectures := p.indexArchitectures()
+
+	stats.LoadPackages = time.Since(stats.StartedAt)
+	generationStart := time.Now()
+
+	// new generation is not visible to clients until swapped, so there is no need to write
+	// files under temporary names
 	var suffix string
-	if p.rePublishing {
+	if p.rePublishing && !p.BlueGreen {
 		suffix = ".tmp"
 	}
 
@@ -887,8 +1087,24 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 	defer os.RemoveAll(tempDir)
 
 	indexes := newIndexFiles(publishedStorage, basePath, tempDir, suffix, p.AcquireByHash, p.SkipBz2)
+	indexes.enableZst = p.EnableZst
+	indexes.flat = p.Flat
+	if p.AcquireByHash {
+		if p.ByHashHistory == nil {
+			p.ByHashHistory = make(map[string][]string)
+		}
+		indexes.byHashDepth = p.ByHashDepth
+		indexes.byHashHistory = p.ByHashHistory
+	}
+
+	if p.GenerateDiffs {
+		readable, ok := publishedStorage.(aptly.ReadablePublishedStorage)
+		if !ok {
+			return fmt.Errorf("published storage %s doesn't support reading files, which is required to generate diffs", p.Storage)
+		}
+		indexes.enableDiffs(readable, p.distPath(readable), p.DiffsDepth)
+	}
 
-	legacyContentIndexes := map[string]*ContentsIndex{}
 	var count int64
 	for _, list := range lists {
 		count = count + int64(list.Len())
@@ -898,211 +1114,58 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 		progress.InitBar(count, false, aptly.BarPublishGeneratePackageFiles)
 	}
 
-	for component, list := range lists {
-		hadUdebs := false
-
-		// For all architectures, pregenerate packages/sources files
-		for _, arch := range p.Architectures {
-			indexes.PackageIndex(component, arch, false, false, p.Distribution)
-		}
-
-		list.PrepareIndex()
-
-		contentIndexes := map[string]*ContentsIndex{}
-
-		err = list.ForEachIndexed(func(pkg *Package) error {
-			if progress != nil {
-				progress.AddBar(1)
-			}
-
-			for _, arch := range p.Architectures {
-				if pkg.MatchesArchitecture(arch) {
-					hadUdebs = hadUdebs || pkg.IsUdeb
-
-					var relPath string
-					if !pkg.IsInstaller {
-						poolDir, err2 := pkg.PoolDirectory()
-						if err2 != nil {
-							return err2
-						}
-						if p.MultiDist {
-							relPath = filepath.Join("pool", p.Distribution, component, poolDir)
-						} else {
-							relPath = filepath.Join("pool", component, poolDir)
-						}
-
-					} else {
-						if p.Distribution == aptly.DistributionFocal {
-							relPath = filepath.Join("dists", p.Distribution, component, fmt.Sprintf("%s-%s", pkg.Name, arch), "current", "legacy-images")
-						} else {
-							relPath = filepath.Join("dists", p.Distribution, component, fmt.Sprintf("%s-%s", pkg.Name, arch), "current", "images")
-						}
-					}
-
-					err = pkg.LinkFromPool(publishedStorage, packagePool, p.Prefix, relPath, forceOverwrite)
-					if err != nil {
-						return err
-					}
-					break
-				}
-			}
-
-			// Start a db batch. If we fill contents data we'll need
-			// to push each path of the package into the database.
-			// We'll want this batched so as to avoid an excessive
-			// amount of write() calls.
-			batch := tempDB.CreateBatch()
-
-			for _, arch := range p.Architectures {
-				if pkg.MatchesArchitecture(arch) {
-					var bufWriter *bufio.Writer
-
-					if !p.SkipContents && !pkg.IsInstaller {
-						key := fmt.Sprintf("%s-%v", arch, pkg.IsUdeb)
-						qualifiedName := []byte(pkg.QualifiedName())
-						contents := pkg.Contents(packagePool, progress)
-
-						for _, contentIndexesMap := range []map[string]*ContentsIndex{contentIndexes, legacyContentIndexes} {
-							contentIndex := contentIndexesMap[key]
-
-							if contentIndex == nil {
-								contentIndex = NewContentsIndex(tempDB)
-								contentIndexesMap[key] = contentIndex
-							}
-
-							contentIndex.Push(qualifiedName, contents, batch)
-						}
-					}
+	concurrency, indexConcurrency := 1, 1
+	if concurrencyProvider, ok := publishedStorageProvider.(aptly.PublishConcurrencyProvider); ok {
+		concurrency = concurrencyProvider.PublishConcurrency(p.Storage)
+		indexConcurrency = concurrencyProvider.PublishIndexConcurrency()
+	}
 
-					bufWriter, err = indexes.PackageIndex(component, arch, pkg.IsUdeb, pkg.IsInstaller, p.Distribution).BufWriter()
-					if err != nil {
-						return err
-					}
+	// index files are compressed and uploaded concurrently as well
+	indexes.concurrency = max(indexConcurrency, concurrency)
 
-					err = pkg.Stanza().WriteTo(bufWriter, pkg.IsSource, false, pkg.IsInstaller)
-					if err != nil {
-						return err
-					}
-					err = bufWriter.WriteByte('\n')
-					if err != nil {
-						return err
-					}
-				}
-			}
+	uploader := newPoolUploader(publishedStorage, packagePool, p.Prefix, forceOverwrite, concurrency)
+	// on failure, wait for uploads in progress before cleaning up
+	defer uploader.Wait()
 
-			pkg.files = nil
-			pkg.deps = nil
-			pkg.extra = nil
-			pkg.contents = nil
+	indexer := newComponentIndexer(p, indexes, uploader, tempDB, packagePool, progress, distPath, architectures, indexConcurrency)
 
-			return batch.Write()
-		})
+	err = indexer.Run(lists)
+	if err != nil {
+		return err
+	}
 
+	for component := range p.sourceItems {
+		skelFiles, err := p.GetSkelFiles(skelDir, component)
 		if err != nil {
-			return fmt.Errorf("unable to process packages: %s", err)
-		}
-
-		for _, arch := range p.Architectures {
-			for _, udeb := range []bool{true, false} {
-				index := contentIndexes[fmt.Sprintf("%s-%v", arch, udeb)]
-				if index == nil || index.Empty() {
-					continue
-				}
-
-				var bufWriter *bufio.Writer
-				bufWriter, err = indexes.ContentsIndex(component, arch, udeb).BufWriter()
-				if err != nil {
-					return fmt.Errorf("unable to generate contents index: %v", err)
-				}
-
-				_, err = index.WriteTo(bufWriter)
-				if err != nil {
-					return fmt.Errorf("unable to generate contents index: %v", err)
-				}
-			}
+			return fmt.Errorf("unable to get skeleton files: %v", err)
 		}
 
-		for component := range p.sourceItems {
-			skelFiles, err := p.GetSkelFiles(skelDir, component)
+		for relPath, absPath := range skelFiles {
+			bufWriter, err := indexes.SkelIndex(component, relPath).BufWriter()
 			if err != nil {
-				return fmt.Errorf("unable to get skeleton files: %v", err)
-			}
-
-			for relPath, absPath := range skelFiles {
-				bufWriter, err := indexes.SkelIndex(component, relPath).BufWriter()
-				if err != nil {
-					return fmt.Errorf("unable to generate skeleton index: %v", err)
-				}
-
-				file, err := os.Open(absPath)
-				if err != nil {
-					return fmt.Errorf("unable to read skeleton file: %v", err)
-				}
-
-				_, err = bufio.NewReader(file).WriteTo(bufWriter)
-				if err != nil {
-					return fmt.Errorf("unable to write skeleton file: %v", err)
-				}
+				return fmt.Errorf("unable to generate skeleton index: %v", err)
 			}
-		}
-
-		udebs := []bool{false}
-		if hadUdebs {
-			udebs = append(udebs, true)
 
-			// For all architectures, pregenerate .udeb indexes
-			for _, arch := range p.Architectures {
-				indexes.PackageIndex(component, arch, true, false, p.Distribution)
+			file, err := os.Open(absPath)
+			if err != nil {
+				return fmt.Errorf("unable to read skeleton file: %v", err)
 			}
-		}
-
-		// For all architectures, generate Release files
-		for _, arch := range p.Architectures {
-			for _, udeb := range udebs {
-				release := make(Stanza)
-				release["Archive"] = p.Distribution
-				release["Architecture"] = arch
-				release["Component"] = component
-				release["Origin"] = p.GetOrigin()
-				release["Label"] = p.GetLabel()
-				release["Suite"] = p.GetSuite()
-				release["Codename"] = p.GetCodename()
-				if p.AcquireByHash {
-					release["Acquire-By-Hash"] = "yes"
-				}
-
-				var bufWriter *bufio.Writer
-				bufWriter, err = indexes.ReleaseIndex(component, arch, udeb).BufWriter()
-				if err != nil {
-					return fmt.Errorf("unable to get ReleaseIndex writer: %s", err)
-				}
 
-				err = release.WriteTo(bufWriter, false, true, false)
-				if err != nil {
-					return fmt.Errorf("unable to create Release file: %s", err)
-				}
+			_, err = bufio.NewReader(file).WriteTo(bufWriter)
+			if err != nil {
+				return fmt.Errorf("unable to write skeleton file: %v", err)
 			}
 		}
 	}
 
-	for _, arch := range p.Architectures {
-		for _, udeb := range []bool{true, false} {
-			index := legacyContentIndexes[fmt.Sprintf("%s-%v", arch, udeb)]
-			if index == nil || index.Empty() {
-				continue
-			}
-
-			var bufWriter *bufio.Writer
-			bufWriter, err = indexes.LegacyContentsIndex(arch, udeb).BufWriter()
-			if err != nil {
-				return fmt.Errorf("unable to generate contents index: %v", err)
-			}
+	// all package files should be in place before indexes are published
+	if err = uploader.Wait(); err != nil {
+		return fmt.Errorf("unable to process packages: %s", err)
+	}
 
-			_, err = index.WriteTo(bufWriter)
-			if err != nil {
-				return fmt.Errorf("unable to generate contents index: %v", err)
-			}
-		}
+	err = indexer.WriteLegacyContents()
+	if err != nil {
+		return err
 	}
 
 	if progress != nil {
@@ -1126,18 +1189,26 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 	release["Label"] = p.GetLabel()
 	release["Suite"] = p.GetSuite()
 	release["Codename"] = p.GetCodename()
-	release["Date"] = time.Now().UTC().Format("Mon, 2 Jan 2006 15:04:05 MST")
-	release["Architectures"] = strings.Join(utils.StrSlicesSubstract(p.Architectures, []string{ArchitectureSource}), " ")
+	release["Date"] = time.Now().UTC().Format(releaseDateFormat)
+	release["Architectures"] = strings.Join(utils.StrSlicesSubstract(architectures, []string{ArchitectureSource}), " ")
 	if p.AcquireByHash {
 		release["Acquire-By-Hash"] = "yes"
 	}
+	if p.ArchitectureAll == ArchitectureAllBoth {
+		release["No-Support-for-Architecture-all"] = "Packages"
+	}
+	if p.Frozen && p.FreezeNotice != "" {
+		release["Maintenance-Notice"] = p.FreezeNotice
+	}
 	release["Description"] = " Generated by aptly\n"
 	release["MD5Sum"] = ""
 	release["SHA1"] = ""
 	release["SHA256"] = ""
 	release["SHA512"] = ""
 
-	release["Components"] = strings.Join(p.Components(), " ")
+	if !p.Flat {
+		release["Components"] = strings.Join(p.Components(), " ")
+	}
 
 	sortedPaths := make([]string, 0, len(indexes.generatedFiles))
 	for path := range indexes.generatedFiles {
@@ -1174,7 +1245,154 @@ func (p *PublishedRepo) Publish(packagePool aptly.PackagePool, publishedStorageP
 		return err
 	}
 
-	return indexes.RenameFiles()
+	err = indexes.RenameFiles()
+	if err != nil {
+		return err
+	}
+
+	// index files are uploaded concurrently, so upload time might exceed time of index generation
+	stats.IndexGeneration = max(time.Since(generationStart)-indexes.stats.Signing-indexes.stats.Upload, 0)
+	stats.Signing = indexes.stats.Signing
+	stats.Upload = indexes.stats.Upload
+	stats.IndexFiles = indexes.stats.IndexFiles
+	stats.IndexBytes = indexes.stats.IndexBytes
+	uploader.collectStats(&stats)
+	if !uploader.concurrent() {
+		// package files were uploaded one by one while generating indexes
+		stats.IndexGeneration -= stats.Upload - indexes.stats.Upload
+	}
+
+	if p.BlueGreen {
+		if progress != nil {
+			progress.Printf("Switching to generation %s...\n", generation)
+		}
+
+		err = p.switchGeneration(publishedStorage, generation, tempDir)
+		if err != nil {
+			return fmt.Errorf("unable to switch generation: %s", err)
+		}
+
+		cleanupStart := time.Now()
+		err = p.pruneGenerations(publishedStorage, progress)
+		if err != nil {
+			return fmt.Errorf("unable to remove old generations: %s", err)
+		}
+		stats.Cleanup = time.Since(cleanupStart)
+	}
+
+	err = GenerateIndexPages(publishedStorage, p.Prefix, progress)
+	if err != nil {
+		return err
+	}
+
+	err = flushPublishedStorage(publishedStorage)
+	if err != nil {
+		return err
+	}
+
+	if notifier, ok := publishedStorageProvider.(aptly.PublishNotifier); ok {
+		notifier.PublishComplete(p.Storage, p.Prefix, p.Distribution, progress)
+	}
+
+	stats.Total = time.Since(stats.StartedAt)
+	p.recordPublishStats(stats)
+	publishDurationHistogram.Observe(stats.Total.Seconds())
+
+	return nil
+}
+
+// flushPublishedStorage writes out pending changes, if published storage accumulates them
+func flushPublishedStorage(publishedStorage aptly.PublishedStorage) error {
+	if flushable, ok := publishedStorage.(aptly.FlushablePublishedStorage); ok {
+		return flushable.Flush()
+	}
+
+	return nil
+}
+
+// PublishEstimate is a pre-flight estimation of work required to publish repository
+type PublishEstimate struct {
+	// Number of package files to be linked or uploaded
+	NumberOfFiles int64
+	// Total size of package files to be linked or uploaded in bytes
+	TotalSize int64
+}
+
+// Estimate calculates number and total size of package files which would be linked
+// into published storage by Publish
+//
+// Files already present in published pool are not counted, so that updates of
+// published repository are estimated by the amount of new files only.
+func (p *PublishedRepo) Estimate(collectionFactory *CollectionFactory,
+	publishedStorageProvider aptly.PublishedStorageProvider) (*PublishEstimate, error) {
+	estimate := &PublishEstimate{}
+	seen := make(map[string]struct{})
+
+	publishedStorage := publishedStorageProvider.GetPublishedStorage(p.Storage)
+
+	for component := range p.sourceItems {
+		list, err := NewPackageListFromRefList(p.RefList(component), collectionFactory.PackageCollection(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load packages: %s", err)
+		}
+
+		list, err = p.filterComponent(component, list)
+		if err != nil {
+			return nil, err
+		}
+
+		err = list.ForEach(func(pkg *Package) error {
+			if len(p.Architectures) > 0 {
+				matches := false
+				for _, arch := range p.Architectures {
+					if pkg.MatchesArchitecture(arch) {
+						matches = true
+						break
+					}
+				}
+				if !matches {
+					return nil
+				}
+			}
+
+			// installer images are published into dists and always replaced
+			var relPath string
+			if !pkg.IsInstaller {
+				relPath, err = p.poolRelPath(pkg, component)
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, f := range pkg.Files() {
+				key := component + "/" + f.Filename + "/" + f.Checksums.MD5
+				if _, found := seen[key]; found {
+					continue
+				}
+				seen[key] = struct{}{}
+
+				if relPath != "" {
+					exists, err := publishedStorage.FileExists(filepath.Join(p.Prefix, relPath, f.Filename))
+					if err != nil {
+						return err
+					}
+					if exists {
+						continue
+					}
+				}
+
+				estimate.NumberOfFiles++
+				estimate.TotalSize += f.Checksums.Size
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return estimate, nil
 }
 
 // RemoveFiles removes files that were created by Publish
@@ -1191,15 +1409,43 @@ func (p *PublishedRepo) RemoveFiles(publishedStorageProvider aptly.PublishedStor
 			return err
 		}
 
-		return publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "pool"), progress)
+		err = publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "pool"), progress)
+		if err != nil {
+			return err
+		}
+
+		if p.Flat {
+			err = p.removeFlatIndexes(publishedStorage, progress)
+			if err != nil {
+				return err
+			}
+		}
+
+		if indexStorage, ok := publishedStorage.(aptly.IndexPagesPublishedStorage); ok && indexStorage.IndexPages() {
+			return publishedStorage.Remove(filepath.Join(p.Prefix, IndexPageName))
+		}
+
+		return nil
 	}
 
 	// II. Medium: remove metadata, it can't be shared as prefix/distribution as unique
-	err := publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "dists", p.Distribution), progress)
+	var err error
+	if p.Flat {
+		err = p.removeFlatIndexes(publishedStorage, progress)
+	} else {
+		err = publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "dists", p.Distribution), progress)
+	}
 	if err != nil {
 		return err
 	}
 
+	if p.BlueGreen {
+		err = publishedStorage.RemoveDirs(filepath.Join(p.Prefix, p.generationsPath()), progress)
+		if err != nil {
+			return err
+		}
+	}
+
 	// III. Complex: there are no other publishes with the same prefix + component
 	for _, component := range removePoolComponents {
 		err = publishedStorage.RemoveDirs(filepath.Join(p.Prefix, "pool", component), progress)
@@ -1211,6 +1457,42 @@ func (p *PublishedRepo) RemoveFiles(publishedStorageProvider aptly.PublishedStor
 	return nil
 }
 
+// removeFlatIndexes removes indexes and Release files published in the root of prefix
+func (p *PublishedRepo) removeFlatIndexes(publishedStorage aptly.PublishedStorage, progress aptly.Progress) error {
+	files := []string{"Release", "Release.gpg", "InRelease"}
+	for _, index := range []string{"Packages", "Sources"} {
+		for _, ext := range []string{"", ".gz", ".bz2", ".zst"} {
+			files = append(files, index+ext)
+		}
+	}
+
+	for _, file := range files {
+		path := filepath.Join(p.Prefix, file)
+
+		exists, err := publishedStorage.FileExists(path)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		err = publishedStorage.Remove(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{"by-hash", "Packages.diff", "Sources.diff"} {
+		err := publishedStorage.RemoveDirs(filepath.Join(p.Prefix, dir), progress)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // PublishedRepoCollection does listing, updating/adding/deleting of PublishedRepos
 type PublishedRepoCollection struct {
 	db   database.Storage
@@ -1260,6 +1542,8 @@ func (collection *PublishedRepoCollection) Add(repo *PublishedRepo) error {
 }
 
 // CheckDuplicate verifies that there's no published repo with the same name
+//
+// Flat repository occupies whole prefix, so there could be only one flat repository in a prefix.
 func (collection *PublishedRepoCollection) CheckDuplicate(repo *PublishedRepo) *PublishedRepo {
 	collection.loadList()
 
@@ -1267,6 +1551,9 @@ func (collection *PublishedRepoCollection) CheckDuplicate(repo *PublishedRepo) *
 		if r.Prefix == repo.Prefix && r.Distribution == repo.Distribution && r.Storage == repo.Storage {
 			return r
 		}
+		if r.Prefix == repo.Prefix && r.Storage == repo.Storage && r.Flat && repo.Flat && r != repo {
+			return r
+		}
 	}
 
 	return nil
@@ -1380,6 +1667,22 @@ func (collection *PublishedRepoCollection) ByStoragePrefixDistribution(storage,
 	return nil, fmt.Errorf("published repo with storage:prefix/distribution %s%s/%s not found", storage, prefix, distribution)
 }
 
+// ByPrefixDistribution looks up replicas of published repository: repositories published
+// with the same prefix and distribution to different storages, sorted by storage
+func (collection *PublishedRepoCollection) ByPrefixDistribution(prefix, distribution string) []*PublishedRepo {
+	collection.loadList()
+
+	var result []*PublishedRepo
+	for _, r := range collection.list {
+		if r.Prefix == prefix && r.Distribution == distribution {
+			result = append(result, r)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Storage < result[j].Storage })
+	return result
+}
+
 // ByUUID looks up repository by uuid
 func (collection *PublishedRepoCollection) ByUUID(uuid string) (*PublishedRepo, error) {
 	collection.loadList()
@@ -1637,6 +1940,10 @@ func (collection *PublishedRepoCollection) CleanupPrefixComponentFiles(published
 		orphanedFiles := utils.StrSlicesSubstract(existingFiles, referencedFiles[component])
 
 		for _, file := range orphanedFiles {
+			if filepath.Base(file) == IndexPageName {
+				continue
+			}
+
 			err = publishedStorage.Remove(filepath.Join(path, file))
 			if err != nil {
 				return err
@@ -1644,7 +1951,12 @@ func (collection *PublishedRepoCollection) CleanupPrefixComponentFiles(published
 		}
 	}
 
-	return err
+	err = GenerateIndexPages(publishedStorage, prefix, progress)
+	if err != nil {
+		return err
+	}
+
+	return flushPublishedStorage(publishedStorage)
 }
 
 // Remove removes published repository, cleaning up directories, files
@@ -1701,6 +2013,16 @@ func (collection *PublishedRepoCollection) Remove(publishedStorageProvider aptly
 				return fmt.Errorf("cleanup failed, use -force-drop to override: %s", err)
 			}
 		}
+	} else if !removePrefix {
+		err = GenerateIndexPages(publishedStorageProvider.GetPublishedStorage(repo.Storage), repo.Prefix, progress)
+		if err != nil && !force {
+			return fmt.Errorf("index pages generation failed, use -force-drop to override: %s", err)
+		}
+	}
+
+	err = flushPublishedStorage(publishedStorageProvider.GetPublishedStorage(repo.Storage))
+	if err != nil && !force {
+		return fmt.Errorf("published files removal failed, use -force-drop to override: %s", err)
 	}
 
 	batch := collection.db.CreateBatch()
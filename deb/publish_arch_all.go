@@ -0,0 +1,57 @@
+package deb
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// Placement of Architecture: all packages in published indexes
+const (
+	// ArchitectureAllDuplicate lists Architecture: all packages in every binary-<arch> index (default)
+	ArchitectureAllDuplicate = "duplicate"
+	// ArchitectureAllSeparate lists Architecture: all packages only in binary-all index
+	ArchitectureAllSeparate = "separate"
+	// ArchitectureAllBoth lists Architecture: all packages both in binary-all index and every
+	// binary-<arch> index, Release file declares No-Support-for-Architecture-all
+	ArchitectureAllBoth = "both"
+)
+
+// ValidateArchitectureAllPlacement checks that placement of Architecture: all packages is known,
+// empty placement is the same as ArchitectureAllDuplicate
+func ValidateArchitectureAllPlacement(placement string) error {
+	switch placement {
+	case "", ArchitectureAllDuplicate, ArchitectureAllSeparate, ArchitectureAllBoth:
+		return nil
+	}
+
+	return fmt.Errorf("unknown placement of Architecture: all packages %#v, valid placements are: %s, %s, %s", placement,
+		ArchitectureAllDuplicate, ArchitectureAllSeparate, ArchitectureAllBoth)
+}
+
+// indexArchitectures returns architectures indexes are generated for, binary-all index
+// is generated if placement of Architecture: all packages requires it
+func (p *PublishedRepo) indexArchitectures() []string {
+	if p.ArchitectureAll != ArchitectureAllSeparate && p.ArchitectureAll != ArchitectureAllBoth {
+		return p.Architectures
+	}
+
+	if utils.StrSliceHasItem(p.Architectures, ArchitectureAll) {
+		return p.Architectures
+	}
+
+	result := append(append([]string(nil), p.Architectures...), ArchitectureAll)
+	sort.Strings(result)
+
+	return result
+}
+
+// matchesIndexArchitecture checks whether package should be listed in index of architecture
+func (p *PublishedRepo) matchesIndexArchitecture(pkg *Package, arch string) bool {
+	if p.ArchitectureAll == ArchitectureAllSeparate && pkg.Architecture == ArchitectureAll && arch != ArchitectureAll {
+		return false
+	}
+
+	return pkg.MatchesArchitecture(arch)
+}
@@ -0,0 +1,85 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *PublishedRepoSuite) TestArchitectureAllPlacement(c *C) {
+	c.Check(ValidateArchitectureAllPlacement(""), IsNil)
+	c.Check(ValidateArchitectureAllPlacement(ArchitectureAllBoth), IsNil)
+	c.Check(ValidateArchitectureAllPlacement("everywhere"), ErrorMatches, "unknown placement of Architecture: all packages \"everywhere\".*")
+
+	stanza := packageStanza.Copy()
+	stanza["Package"] = "alien-arena-data"
+	stanza["Architecture"] = "all"
+	pkgAll := NewPackageFromControlFile(stanza)
+	pkgAll.UpdateFiles(s.p1.Files())
+	c.Assert(s.packageCollection.Update(pkgAll), IsNil)
+
+	list := NewPackageList()
+	c.Assert(list.Add(s.p1), IsNil)
+	c.Assert(list.Add(pkgAll), IsNil)
+
+	localRepo := NewLocalRepo("arch-all", "")
+	localRepo.UpdateRefList(NewPackageRefListFromPackageList(list))
+	c.Assert(s.factory.LocalRepoCollection().Add(localRepo), IsNil)
+
+	indexed := func(distribution, arch string) []string {
+		f, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "archall/dists", distribution, "main", "binary-"+arch, "Packages"))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		c.Assert(err, IsNil)
+		defer f.Close()
+
+		names := []string{}
+		reader := NewControlFileReader(f, false, false)
+		for {
+			st, err := reader.ReadStanza()
+			c.Assert(err, IsNil)
+			if st == nil {
+				return names
+			}
+			names = append(names, st["Package"])
+		}
+	}
+
+	release := func(distribution string) Stanza {
+		f, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "archall/dists", distribution, "Release"))
+		c.Assert(err, IsNil)
+		defer f.Close()
+
+		st, err := NewControlFileReader(f, true, false).ReadStanza()
+		c.Assert(err, IsNil)
+		return st
+	}
+
+	for _, t := range []struct {
+		placement string
+		i386, all []string
+		archs     string
+		noSupport string
+	}{
+		{"", []string{"alien-arena-common", "alien-arena-data"}, nil, "i386", ""},
+		{ArchitectureAllSeparate, []string{"alien-arena-common"}, []string{"alien-arena-data"}, "all i386", ""},
+		{ArchitectureAllBoth, []string{"alien-arena-common", "alien-arena-data"}, []string{"alien-arena-data"}, "all i386", "Packages"},
+	} {
+		distribution := "sid-" + t.placement
+
+		published, err := NewPublishedRepo("", "archall", distribution, []string{"i386"}, []string{"main"}, []interface{}{localRepo}, s.factory, false)
+		c.Assert(err, IsNil)
+		published.SkipContents = true
+		published.ArchitectureAll = t.placement
+
+		c.Assert(published.Publish(s.packagePool, s.provider, s.factory, nil, nil, false, ""), IsNil)
+
+		c.Check(indexed(distribution, "i386"), DeepEquals, t.i386, Commentf("placement %q", t.placement))
+		c.Check(indexed(distribution, "all"), DeepEquals, t.all, Commentf("placement %q", t.placement))
+		c.Check(release(distribution)["Architectures"], Equals, t.archs)
+		c.Check(release(distribution)["No-Support-for-Architecture-all"], Equals, t.noSupport)
+		c.Check(published.Architectures, DeepEquals, []string{"i386"})
+	}
+}
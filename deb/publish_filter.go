@@ -0,0 +1,59 @@
+package deb
+
+import (
+	"fmt"
+)
+
+// PackageQueryParser parses package queries of component filters of published repositories,
+// it is set by package query (which depends on this package)
+var PackageQueryParser parseQuery
+
+// SetComponentFilter sets package query which filters packages of component source,
+// so that one source could be split into several components, empty filter removes it
+func (p *PublishedRepo) SetComponentFilter(component, filter string) error {
+	if _, ok := p.Sources[component]; !ok {
+		return fmt.Errorf("component %s does not exist", component)
+	}
+
+	if filter == "" {
+		delete(p.Filters, component)
+		if len(p.Filters) == 0 {
+			p.Filters = nil
+		}
+		return nil
+	}
+
+	if _, err := parseComponentFilter(filter); err != nil {
+		return fmt.Errorf("unable to parse filter of component %s: %s", component, err)
+	}
+
+	if p.Filters == nil {
+		p.Filters = make(map[string]string)
+	}
+	p.Filters[component] = filter
+
+	return nil
+}
+
+func parseComponentFilter(filter string) (PackageQuery, error) {
+	if PackageQueryParser == nil {
+		return nil, fmt.Errorf("package queries are not supported")
+	}
+
+	return PackageQueryParser(filter)
+}
+
+// filterComponent applies filter of component (if any) to packages of the component
+func (p *PublishedRepo) filterComponent(component string, list *PackageList) (*PackageList, error) {
+	filter := p.Filters[component]
+	if filter == "" {
+		return list, nil
+	}
+
+	q, err := parseComponentFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse filter of component %s: %s", component, err)
+	}
+
+	return list.Scan(q), nil
+}
@@ -0,0 +1,65 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+// testQueryParser parses <field>=<value> or !<field>=<value> queries
+func testQueryParser(q string) (PackageQuery, error) {
+	negate := strings.HasPrefix(q, "!")
+	field, value, _ := strings.Cut(strings.TrimPrefix(q, "!"), "=")
+
+	var result PackageQuery = &FieldQuery{Field: field, Relation: VersionEqual, Value: value}
+	if negate {
+		result = &NotQuery{Q: result}
+	}
+
+	return result, nil
+}
+
+func (s *PublishedRepoSuite) TestComponentFilters(c *C) {
+	defer func(parser parseQuery) { PackageQueryParser = parser }(PackageQueryParser)
+
+	PackageQueryParser = nil
+	c.Check(s.repo3.SetComponentFilter("main", "Name=mars-invaders"), ErrorMatches, ".*package queries are not supported")
+
+	PackageQueryParser = testQueryParser
+
+	c.Check(s.repo3.SetComponentFilter("non-free", "Name=mars-invaders"), ErrorMatches, "component non-free does not exist")
+	c.Assert(s.repo3.SetComponentFilter("main", "Name=mars-invaders"), IsNil)
+	c.Assert(s.repo3.SetComponentFilter("contrib", "!Name=mars-invaders"), IsNil)
+	c.Check(s.repo3.Filters, DeepEquals, map[string]string{"main": "Name=mars-invaders", "contrib": "!Name=mars-invaders"})
+
+	estimate, err := s.repo3.Estimate(s.factory, s.provider)
+	c.Assert(err, IsNil)
+	c.Check(estimate.NumberOfFiles, Equals, int64(2))
+
+	c.Assert(s.repo3.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	for component, expected := range map[string][]string{"main": {"mars-invaders"}, "contrib": {"alien-arena-common", "lonely-strangers"}} {
+		f, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty", component, "binary-i386/Packages"))
+		c.Assert(err, IsNil)
+
+		names := []string{}
+		reader := NewControlFileReader(f, false, false)
+		for {
+			st, err := reader.ReadStanza()
+			c.Assert(err, IsNil)
+			if st == nil {
+				break
+			}
+			names = append(names, st["Package"])
+		}
+		f.Close()
+
+		c.Check(names, DeepEquals, expected)
+	}
+
+	c.Assert(s.repo3.SetComponentFilter("main", ""), IsNil)
+	s.repo3.RemoveComponent("contrib")
+	c.Check(s.repo3.Filters, HasLen, 0)
+}
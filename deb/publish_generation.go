@@ -0,0 +1,87 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+)
+
+// Blue/green publishing: each publish of distribution generates complete new
+// generation of dists/<distribution> in separate directory, which is swapped
+// into place when it's complete, so that clients never observe half-updated
+// indexes.
+const (
+	// GenerationsDir is directory under dists/ keeping generations of distributions
+	GenerationsDir = ".generations"
+	// GenerationPointer is file in generations directory of distribution pointing to the current
+	// generation, written to published storages which can't swap directories (object storages)
+	GenerationPointer = "current"
+	// generationsToKeep is number of generations kept: current one and previous one,
+	// as clients might be still downloading files from it
+	generationsToKeep = 2
+)
+
+var generationRegexp = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}$`)
+
+// newGeneration returns name of new generation of distribution
+func newGeneration() string {
+	return time.Now().UTC().Format("20060102T150405.000000000")
+}
+
+// generationsPath returns path (relative to prefix) to generations of distribution
+func (p *PublishedRepo) generationsPath() string {
+	return filepath.Join("dists", GenerationsDir, p.Distribution)
+}
+
+// switchGeneration makes generation current one
+func (p *PublishedRepo) switchGeneration(publishedStorage aptly.PublishedStorage, generation, tempDir string) error {
+	generationPath := filepath.Join(p.generationsPath(), generation)
+
+	if swappable, ok := publishedStorage.(aptly.SwappablePublishedStorage); ok {
+		return swappable.SwapDir(filepath.Join(p.Prefix, generationPath), filepath.Join(p.Prefix, "dists", p.Distribution))
+	}
+
+	pointer := filepath.Join(tempDir, GenerationPointer)
+	if err := os.WriteFile(pointer, []byte(generationPath+"\n"), 0644); err != nil {
+		return err
+	}
+
+	return publishedStorage.PutFile(filepath.Join(p.Prefix, p.generationsPath(), GenerationPointer), pointer)
+}
+
+// pruneGenerations removes old generations of distribution, keeping current and previous one
+func (p *PublishedRepo) pruneGenerations(publishedStorage aptly.PublishedStorage, progress aptly.Progress) error {
+	root := filepath.Join(p.Prefix, p.generationsPath())
+
+	files, err := publishedStorage.Filelist(root)
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	generations := []string{}
+	for _, file := range files {
+		parts := strings.SplitN(filepath.ToSlash(file), "/", 2)
+		if len(parts) == 2 && generationRegexp.MatchString(parts[0]) && !seen[parts[0]] {
+			seen[parts[0]] = true
+			generations = append(generations, parts[0])
+		}
+	}
+
+	sort.Strings(generations)
+
+	for len(generations) > generationsToKeep {
+		err = publishedStorage.RemoveDirs(filepath.Join(root, generations[0]), progress)
+		if err != nil {
+			return err
+		}
+		generations = generations[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,423 @@
+package deb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/database"
+)
+
+// errIndexerStopped stops feeding packages to workers after failure
+var errIndexerStopped = errors.New("indexer stopped")
+
+// renderedPackage is package prepared for indexes of all matching architectures
+type renderedPackage struct {
+	architectures []string
+	isUdeb        bool
+	isInstaller   bool
+	hasContents   bool
+	qualifiedName []byte
+	contents      []string
+	stanza        []byte
+	err           error
+}
+
+// componentIndexer generates indexes of published repository
+//
+// Components are indexed concurrently. Packages of each component are prepared (package files
+// linked, contents looked up and stanzas rendered) by workers, while indexes are written in the
+// original order of packages, so that generated indexes don't depend on concurrency. Number of
+// workers is shared by all components.
+type componentIndexer struct {
+	p             *PublishedRepo
+	indexes       *indexFiles
+	uploader      *poolUploader
+	tempDB        database.Storage
+	packagePool   aptly.PackagePool
+	progress      aptly.Progress
+	distPath      string
+	architectures []string
+
+	workers chan struct{}
+
+	legacyLock           sync.Mutex
+	legacyContentIndexes map[string]*ContentsIndex
+}
+
+func newComponentIndexer(p *PublishedRepo, indexes *indexFiles, uploader *poolUploader, tempDB database.Storage,
+	packagePool aptly.PackagePool, progress aptly.Progress, distPath string, architectures []string, concurrency int) *componentIndexer {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &componentIndexer{
+		p:                    p,
+		indexes:              indexes,
+		uploader:             uploader,
+		tempDB:               tempDB,
+		packagePool:          packagePool,
+		progress:             progress,
+		distPath:             distPath,
+		architectures:        architectures,
+		workers:              make(chan struct{}, concurrency),
+		legacyContentIndexes: map[string]*ContentsIndex{},
+	}
+}
+
+// parallel runs jobs by workers, returning first error
+func (ci *componentIndexer) parallel(jobs []func() error) error {
+	var (
+		wg      sync.WaitGroup
+		errLock sync.Mutex
+		err     error
+	)
+
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job func() error) {
+			defer wg.Done()
+
+			ci.workers <- struct{}{}
+			e := job()
+			<-ci.workers
+
+			if e != nil {
+				errLock.Lock()
+				if err == nil {
+					err = e
+				}
+				errLock.Unlock()
+			}
+		}(job)
+	}
+
+	wg.Wait()
+	return err
+}
+
+// Run generates indexes of all components
+//
+// Components don't occupy workers, as they are mostly waiting for packages to be prepared.
+func (ci *componentIndexer) Run(lists map[string]*PackageList) error {
+	var (
+		wg      sync.WaitGroup
+		errLock sync.Mutex
+		err     error
+	)
+
+	for component, list := range lists {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if e := ci.indexComponent(component, list); e != nil {
+				errLock.Lock()
+				if err == nil {
+					err = e
+				}
+				errLock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return err
+}
+
+// render prepares package for indexes of component
+func (ci *componentIndexer) render(component string, pkg *Package) (result renderedPackage) {
+	p := ci.p
+
+	if ci.progress != nil {
+		// indexes are not published yet, so cancelled publishing leaves repository intact
+		if ci.progress.Context().Err() != nil {
+			result.err = fmt.Errorf("publishing cancelled")
+			return
+		}
+		ci.progress.AddBar(1)
+	}
+
+	defer func() {
+		pkg.files = nil
+		pkg.deps = nil
+		pkg.extra = nil
+		pkg.contents = nil
+	}()
+
+	for _, arch := range ci.architectures {
+		if p.matchesIndexArchitecture(pkg, arch) {
+			result.architectures = append(result.architectures, arch)
+		}
+	}
+	if len(result.architectures) == 0 {
+		return
+	}
+
+	arch := result.architectures[0]
+
+	if pkg.IsInstaller && p.Flat {
+		result.err = fmt.Errorf("installer images can't be published in flat repository")
+		return
+	}
+
+	var relPath string
+	if !pkg.IsInstaller {
+		relPath, result.err = p.poolRelPath(pkg, component)
+		if result.err != nil {
+			return
+		}
+	} else {
+		if p.Distribution == aptly.DistributionFocal {
+			relPath = filepath.Join(ci.distPath, component, fmt.Sprintf("%s-%s", pkg.Name, arch), "current", "legacy-images")
+		} else {
+			relPath = filepath.Join(ci.distPath, component, fmt.Sprintf("%s-%s", pkg.Name, arch), "current", "images")
+		}
+	}
+
+	result.err = ci.uploader.Link(pkg, relPath)
+	if result.err != nil {
+		return
+	}
+
+	result.isUdeb = pkg.IsUdeb
+	result.isInstaller = pkg.IsInstaller
+
+	if !p.SkipContents && !p.Flat && !pkg.IsInstaller {
+		result.hasContents = true
+		result.qualifiedName = []byte(pkg.QualifiedName())
+		result.contents = pkg.Contents(ci.packagePool, ci.progress)
+	}
+
+	stanza := pkg.Stanza()
+	p.Overrides.Apply(pkg, stanza)
+
+	var buf bytes.Buffer
+	bufWriter := bufio.NewWriter(&buf)
+
+	result.err = stanza.WriteTo(bufWriter, pkg.IsSource, false, pkg.IsInstaller)
+	if result.err != nil {
+		return
+	}
+	result.err = bufWriter.WriteByte('\n')
+	if result.err != nil {
+		return
+	}
+	result.err = bufWriter.Flush()
+	result.stanza = buf.Bytes()
+
+	return
+}
+
+// write appends prepared package to indexes of component
+func (ci *componentIndexer) write(component string, result *renderedPackage, contentIndexes map[string]*ContentsIndex) error {
+	// Start a db batch. If we fill contents data we'll need
+	// to push each path of the package into the database.
+	// We'll want this batched so as to avoid an excessive
+	// amount of write() calls.
+	batch := ci.tempDB.CreateBatch()
+
+	for i, arch := range result.architectures {
+		if result.hasContents {
+			key := fmt.Sprintf("%s-%v", arch, result.isUdeb)
+
+			contentIndex := contentIndexes[key]
+			if contentIndex == nil {
+				contentIndex = NewContentsIndex(ci.tempDB)
+				contentIndexes[key] = contentIndex
+			}
+			contentIndex.Push(result.qualifiedName, result.contents, batch)
+
+			// legacy index is shared by all the components, which are indexed concurrently
+			ci.legacyLock.Lock()
+			legacyIndex := ci.legacyContentIndexes[key]
+			if legacyIndex == nil {
+				legacyIndex = NewContentsIndex(ci.tempDB)
+				ci.legacyContentIndexes[key] = legacyIndex
+			}
+			err := legacyIndex.Push(result.qualifiedName, result.contents, batch)
+			ci.legacyLock.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+
+		// flat repository has single package index for all architectures
+		if ci.p.Flat && i > 0 {
+			continue
+		}
+
+		bufWriter, err := ci.indexes.PackageIndex(component, arch, result.isUdeb, result.isInstaller, ci.p.Distribution).BufWriter()
+		if err != nil {
+			return err
+		}
+
+		_, err = bufWriter.Write(result.stanza)
+		if err != nil {
+			return err
+		}
+	}
+
+	return batch.Write()
+}
+
+// indexComponent generates package, contents and release indexes of component
+func (ci *componentIndexer) indexComponent(component string, list *PackageList) error {
+	p := ci.p
+	hadUdebs := false
+
+	// For all architectures, pregenerate packages/sources files
+	for _, arch := range ci.architectures {
+		ci.indexes.PackageIndex(component, arch, false, false, p.Distribution)
+	}
+
+	list.PrepareIndex()
+
+	contentIndexes := map[string]*ContentsIndex{}
+
+	// packages are prepared by workers, results are collected in order of packages
+	results := make(chan chan renderedPackage, cap(ci.workers))
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(results)
+
+		list.ForEachIndexed(func(pkg *Package) error {
+			result := make(chan renderedPackage, 1)
+
+			select {
+			case results <- result:
+			case <-stop:
+				return errIndexerStopped
+			}
+
+			ci.workers <- struct{}{}
+			go func() {
+				defer func() { <-ci.workers }()
+				result <- ci.render(component, pkg)
+			}()
+
+			return nil
+		})
+	}()
+
+	var err error
+	for result := range results {
+		rendered := <-result
+		if err != nil {
+			// wait for packages being prepared after failure
+			continue
+		}
+
+		err = rendered.err
+		if err == nil {
+			hadUdebs = hadUdebs || (rendered.isUdeb && len(rendered.architectures) > 0)
+			err = ci.write(component, &rendered, contentIndexes)
+		}
+		if err != nil {
+			close(stop)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to process packages: %s", err)
+	}
+
+	var jobs []func() error
+	for _, arch := range ci.architectures {
+		for _, udeb := range []bool{true, false} {
+			index := contentIndexes[fmt.Sprintf("%s-%v", arch, udeb)]
+			if index == nil || index.Empty() {
+				continue
+			}
+
+			contentsFile := ci.indexes.ContentsIndex(component, arch, udeb)
+			jobs = append(jobs, func() error { return writeContentsIndex(contentsFile, index) })
+		}
+	}
+
+	if err = ci.parallel(jobs); err != nil {
+		return err
+	}
+
+	udebs := []bool{false}
+	if hadUdebs {
+		udebs = append(udebs, true)
+
+		// For all architectures, pregenerate .udeb indexes
+		for _, arch := range ci.architectures {
+			ci.indexes.PackageIndex(component, arch, true, false, p.Distribution)
+		}
+	}
+
+	// flat repository has no Release files of components
+	if p.Flat {
+		return nil
+	}
+
+	// For all architectures, generate Release files
+	for _, arch := range ci.architectures {
+		for _, udeb := range udebs {
+			release := make(Stanza)
+			release["Archive"] = p.Distribution
+			release["Architecture"] = arch
+			release["Component"] = component
+			release["Origin"] = p.GetOrigin()
+			release["Label"] = p.GetLabel()
+			release["Suite"] = p.GetSuite()
+			release["Codename"] = p.GetCodename()
+			if p.AcquireByHash {
+				release["Acquire-By-Hash"] = "yes"
+			}
+
+			var bufWriter *bufio.Writer
+			bufWriter, err = ci.indexes.ReleaseIndex(component, arch, udeb).BufWriter()
+			if err != nil {
+				return fmt.Errorf("unable to get ReleaseIndex writer: %s", err)
+			}
+
+			err = release.WriteTo(bufWriter, false, true, false)
+			if err != nil {
+				return fmt.Errorf("unable to create Release file: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteLegacyContents generates contents indexes of all components, should be called after Run
+func (ci *componentIndexer) WriteLegacyContents() error {
+	var jobs []func() error
+	for _, arch := range ci.architectures {
+		for _, udeb := range []bool{true, false} {
+			index := ci.legacyContentIndexes[fmt.Sprintf("%s-%v", arch, udeb)]
+			if index == nil || index.Empty() {
+				continue
+			}
+
+			contentsFile := ci.indexes.LegacyContentsIndex(arch, udeb)
+			jobs = append(jobs, func() error { return writeContentsIndex(contentsFile, index) })
+		}
+	}
+
+	return ci.parallel(jobs)
+}
+
+func writeContentsIndex(file *indexFile, index *ContentsIndex) error {
+	bufWriter, err := file.BufWriter()
+	if err != nil {
+		return fmt.Errorf("unable to generate contents index: %v", err)
+	}
+
+	_, err = index.WriteTo(bufWriter)
+	if err != nil {
+		return fmt.Errorf("unable to generate contents index: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package deb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/pgp"
+)
+
+// releaseDateFormat is format of Date and Valid-Until fields of Release file
+const releaseDateFormat = "Mon, 2 Jan 2006 15:04:05 MST"
+
+// ResignOptions controls changes to Release file while re-signing published repository
+type ResignOptions struct {
+	// Set Date of Release file to current time
+	RefreshDate bool
+	// Set Valid-Until of Release file to current time plus ValidFor, if not zero
+	ValidFor time.Duration
+}
+
+// distPath returns path (relative to root of published storage) to directory with Release file
+// of published repository, following current generation on storages which can't swap directories
+func (p *PublishedRepo) distPath(storage aptly.ReadablePublishedStorage) string {
+	if p.BlueGreen {
+		if _, swappable := storage.(aptly.SwappablePublishedStorage); !swappable {
+			pointer, err := storage.ReadFile(filepath.Join(p.Prefix, p.generationsPath(), GenerationPointer))
+			if err == nil && strings.TrimSpace(string(pointer)) != "" {
+				return filepath.Join(p.Prefix, strings.TrimSpace(string(pointer)))
+			}
+		}
+	}
+
+	return filepath.Join(p.Prefix, p.releaseDir())
+}
+
+// Resign regenerates signatures of published Release file (InRelease and Release.gpg)
+// without regenerating package indexes, e.g. to rotate signing key or to refresh Valid-Until
+//
+// Release file is changed only if options ask for it, checksums of indexes listed in
+// Release file stay intact.
+func (p *PublishedRepo) Resign(publishedStorageProvider aptly.PublishedStorageProvider, signer pgp.FileSigner,
+	options ResignOptions, progress aptly.Progress) error {
+	if signer == nil {
+		return fmt.Errorf("signing is disabled, nothing to re-sign")
+	}
+
+	publishedStorage := publishedStorageProvider.GetPublishedStorage(p.Storage)
+
+	storage, ok := publishedStorage.(aptly.ReadablePublishedStorage)
+	if !ok {
+		return fmt.Errorf("published storage %s doesn't support reading files", p.Storage)
+	}
+
+	distPath := p.distPath(storage)
+
+	release, err := storage.ReadFile(filepath.Join(distPath, "Release"))
+	if err != nil {
+		return fmt.Errorf("unable to read Release file: %s", err)
+	}
+
+	changed := options.RefreshDate || options.ValidFor != 0
+	if changed {
+		var stanza Stanza
+
+		stanza, err = NewControlFileReader(bytes.NewReader(release), true, false).ReadStanza()
+		if err != nil || stanza == nil {
+			return fmt.Errorf("unable to parse Release file: %v", err)
+		}
+
+		now := time.Now().UTC()
+		if options.RefreshDate {
+			stanza["Date"] = now.Format(releaseDateFormat)
+		}
+		if options.ValidFor != 0 {
+			stanza["Valid-Until"] = now.Add(options.ValidFor).Format(releaseDateFormat)
+		}
+
+		var buf bytes.Buffer
+
+		w := bufio.NewWriter(&buf)
+		if err = stanza.WriteTo(w, false, true, false); err != nil {
+			return fmt.Errorf("unable to create Release file: %s", err)
+		}
+		if err = w.Flush(); err != nil {
+			return fmt.Errorf("unable to create Release file: %s", err)
+		}
+
+		release = buf.Bytes()
+	}
+
+	tempDir, err := os.MkdirTemp("", "aptly")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	releaseFile := filepath.Join(tempDir, "Release")
+	if err = os.WriteFile(releaseFile, release, 0644); err != nil {
+		return err
+	}
+
+	// Signing files might output to console, so flush progress writer first
+	if progress != nil {
+		progress.Printf("Signing Release file of %s/%s...\n", p.StoragePrefix(), p.Distribution)
+		progress.Flush()
+	}
+
+	if err = signer.DetachedSign(releaseFile, releaseFile+".gpg"); err != nil {
+		return fmt.Errorf("unable to detached sign file: %s", err)
+	}
+
+	if err = signer.ClearSign(releaseFile, filepath.Join(tempDir, "InRelease")); err != nil {
+		return fmt.Errorf("unable to clearsign file: %s", err)
+	}
+
+	files := []string{"Release.gpg", "InRelease"}
+	if changed {
+		files = append([]string{"Release"}, files...)
+	}
+
+	for _, file := range files {
+		if err = publishedStorage.PutFile(filepath.Join(distPath, file), filepath.Join(tempDir, file)); err != nil {
+			return fmt.Errorf("unable to publish file: %s", err)
+		}
+	}
+
+	if err = flushPublishedStorage(publishedStorage); err != nil {
+		return err
+	}
+
+	if notifier, ok := publishedStorageProvider.(aptly.PublishNotifier); ok {
+		notifier.PublishComplete(p.Storage, p.Prefix, p.Distribution, progress)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package deb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *PublishedRepoSuite) TestResign(c *C) {
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	dist := filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze")
+	original, err := os.ReadFile(filepath.Join(dist, "Release"))
+	c.Assert(err, IsNil)
+	c.Assert(os.Remove(filepath.Join(dist, "InRelease")), IsNil)
+
+	c.Check(s.repo.Resign(s.provider, nil, ResignOptions{}, nil), ErrorMatches, "signing is disabled.*")
+
+	c.Assert(s.repo.Resign(s.provider, &NullSigner{}, ResignOptions{}, nil), IsNil)
+	c.Check(filepath.Join(dist, "InRelease"), PathExists)
+	c.Check(filepath.Join(dist, "Release.gpg"), PathExists)
+
+	release, err := os.ReadFile(filepath.Join(dist, "Release"))
+	c.Assert(err, IsNil)
+	c.Check(release, DeepEquals, original)
+
+	c.Assert(s.repo.Resign(s.provider, &NullSigner{}, ResignOptions{RefreshDate: true, ValidFor: 24 * time.Hour}, nil), IsNil)
+
+	release, err = os.ReadFile(filepath.Join(dist, "Release"))
+	c.Assert(err, IsNil)
+
+	stanza, err := NewControlFileReader(bytes.NewReader(release), true, false).ReadStanza()
+	c.Assert(err, IsNil)
+	originalStanza, err := NewControlFileReader(bytes.NewReader(original), true, false).ReadStanza()
+	c.Assert(err, IsNil)
+
+	validUntil, err := time.Parse(releaseDateFormat, stanza["Valid-Until"])
+	c.Assert(err, IsNil)
+	c.Check(validUntil.After(time.Now().Add(23*time.Hour)), Equals, true)
+	c.Check(stanza["SHA256"], Equals, originalStanza["SHA256"])
+	c.Check(stanza["Components"], Equals, originalStanza["Components"])
+}
@@ -0,0 +1,62 @@
+package deb
+
+import (
+	"time"
+)
+
+// PublishHistoryLength is number of latest publishing statistics kept for published repository
+const PublishHistoryLength = 10
+
+// PublishStats are timings and sizes collected while publishing repository
+//
+// Durations are in nanoseconds. Package files are uploaded in background while indexes are
+// being generated, so Upload (summed over all uploads) might overlap with IndexGeneration.
+type PublishStats struct {
+	// Time publishing started
+	StartedAt time.Time
+	// Loading and filtering packages of sources
+	LoadPackages time.Duration
+	// Generating and compressing index files, excluding signing and uploading of indexes
+	IndexGeneration time.Duration
+	// Signing Release files
+	Signing time.Duration
+	// Uploading package and index files to published storage
+	Upload time.Duration
+	// Removing old generations and files not referenced anymore
+	Cleanup time.Duration
+	// Whole publishing, including cleanup
+	Total time.Duration
+	// Number of package files linked or uploaded to published storage
+	PackageFiles int64
+	// Size of package files linked or uploaded to published storage
+	PackageBytes int64
+	// Number of index files (including signatures) uploaded to published storage
+	IndexFiles int64
+	// Size of index files (including signatures) uploaded to published storage
+	IndexBytes int64
+}
+
+// LastPublishStats returns statistics of latest publishing, nil if there are none
+func (p *PublishedRepo) LastPublishStats() *PublishStats {
+	if len(p.PublishHistory) == 0 {
+		return nil
+	}
+
+	return &p.PublishHistory[0]
+}
+
+// recordPublishStats adds statistics of publishing to history, dropping oldest entries
+func (p *PublishedRepo) recordPublishStats(stats PublishStats) {
+	p.PublishHistory = append([]PublishStats{stats}, p.PublishHistory...)
+	if len(p.PublishHistory) > PublishHistoryLength {
+		p.PublishHistory = p.PublishHistory[:PublishHistoryLength]
+	}
+}
+
+// RecordCleanup adds time spent cleaning up files after publishing to latest publishing statistics
+func (p *PublishedRepo) RecordCleanup(duration time.Duration) {
+	if stats := p.LastPublishStats(); stats != nil {
+		stats.Cleanup += duration
+		stats.Total += duration
+	}
+}
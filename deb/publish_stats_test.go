@@ -0,0 +1,39 @@
+package deb
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *PublishedRepoSuite) TestPublishStats(c *C) {
+	c.Check(s.repo.LastPublishStats(), IsNil)
+
+	err := s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	c.Assert(s.repo.PublishHistory, HasLen, 1)
+
+	stats := s.repo.LastPublishStats()
+	c.Assert(stats, NotNil)
+	c.Check(stats.StartedAt.IsZero(), Equals, false)
+	c.Check(stats.PackageFiles, Equals, int64(3))
+	c.Check(stats.IndexFiles > 0, Equals, true)
+	c.Check(stats.IndexBytes > 0, Equals, true)
+	c.Check(stats.Total >= stats.LoadPackages, Equals, true)
+	c.Check(stats.Cleanup, Equals, time.Duration(0))
+
+	s.repo.RecordCleanup(time.Second)
+	c.Check(stats.Cleanup, Equals, time.Second)
+	c.Check(stats.Total >= time.Second, Equals, true)
+
+	for i := 0; i < PublishHistoryLength; i++ {
+		err = s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+		c.Assert(err, IsNil)
+	}
+
+	c.Check(s.repo.PublishHistory, HasLen, PublishHistoryLength)
+	c.Check(s.repo.LastPublishStats().Cleanup, Equals, time.Duration(0))
+	c.Check(s.repo.PublishHistory[PublishHistoryLength-1].Cleanup, Equals, time.Duration(0))
+	c.Check(s.repo.PublishHistory[0].StartedAt.After(s.repo.PublishHistory[1].StartedAt), Equals, true)
+}
@@ -2,18 +2,22 @@ package deb
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/database"
 	"github.com/aptly-dev/aptly/database/goleveldb"
 	"github.com/aptly-dev/aptly/files"
+	"github.com/klauspost/compress/zstd"
 	"github.com/ugorji/go/codec"
 
 	. "gopkg.in/check.v1"
@@ -194,6 +198,24 @@ func (s *PublishedRepoSuite) TestNewPublishedRepo(c *C) {
 	c.Check(err, IsNil)
 }
 
+func (s *PublishedRepoSuite) TestNewPublishedRepoComponentMap(c *C) {
+	mirror, _ := NewRemoteRepo("ubuntu", "http://archive.ubuntu.com/ubuntu/", "jammy", []string{"main", "universe"}, []string{}, false, false, false)
+	mirror.packageRefs = s.reflist
+	c.Assert(mirror.SetComponentMap(map[string]string{"main": "upstream", "universe": "upstream"}), IsNil)
+	c.Assert(s.factory.RemoteRepoCollection().Add(mirror), IsNil)
+
+	snapshot, _ := NewSnapshotFromRepository("ubuntu-snap", mirror)
+	c.Assert(s.factory.SnapshotCollection().Add(snapshot), IsNil)
+
+	merged := NewSnapshotFromRefList("merged", []*Snapshot{snapshot}, snapshot.RefList(), "merged")
+	c.Assert(s.factory.SnapshotCollection().Add(merged), IsNil)
+
+	repo, err := NewPublishedRepo("", "ubuntu", "", nil, []string{""}, []interface{}{merged}, s.factory, false)
+	c.Assert(err, IsNil)
+	c.Check(repo.Components(), DeepEquals, []string{"upstream"})
+	c.Check(repo.Distribution, Equals, "jammy")
+}
+
 func (s *PublishedRepoSuite) TestMultiDistPool(c *C) {
 	repo, err := NewPublishedRepo("", "ppa", "squeeze", nil, []string{"main"}, []interface{}{s.snapshot}, s.factory, true)
 	c.Assert(err, IsNil)
@@ -426,6 +448,378 @@ func (s *PublishedRepoSuite) TestPublish(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *PublishedRepoSuite) TestPublishBlueGreen(c *C) {
+	s.repo.BlueGreen = true
+
+	distPath := filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze")
+	generationsPath := filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists", GenerationsDir, "squeeze")
+
+	var targets []string
+	for i := 0; i < 3; i++ {
+		c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+		target, err := os.Readlink(distPath)
+		c.Assert(err, IsNil)
+		c.Check(filepath.IsAbs(target), Equals, false)
+		targets = append(targets, target)
+
+		_, err = os.Stat(filepath.Join(distPath, "main/binary-i386/Packages"))
+		c.Check(err, IsNil)
+	}
+
+	c.Check(targets[0], Not(Equals), targets[1])
+	c.Check(targets[1], Not(Equals), targets[2])
+
+	// current and previous generations are kept
+	generations, err := os.ReadDir(generationsPath)
+	c.Assert(err, IsNil)
+	c.Assert(generations, HasLen, 2)
+	c.Check(filepath.Join(GenerationsDir, "squeeze", generations[1].Name()), Equals, targets[2])
+
+	c.Assert(s.repo.RemoveFiles(s.provider, false, nil, nil), IsNil)
+	_, err = os.Lstat(distPath)
+	c.Check(os.IsNotExist(err), Equals, true)
+	_, err = os.Stat(generationsPath)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *PublishedRepoSuite) TestPublishBlueGreenOverDirectory(c *C) {
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	s.repo.BlueGreen = true
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	distPath := filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze")
+	info, err := os.Lstat(distPath)
+	c.Assert(err, IsNil)
+	c.Check(info.Mode()&os.ModeSymlink, Not(Equals), os.FileMode(0))
+
+	_, err = os.Stat(filepath.Join(distPath, "Release"))
+	c.Check(err, IsNil)
+	_, err = os.Stat(distPath + ".old")
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *PublishedRepoSuite) TestPublishFrozen(c *C) {
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+	c.Check(s.repo.CheckFrozen(), IsNil)
+
+	s.repo.Freeze("release freeze")
+	c.Check(s.repo.CheckFrozen(), ErrorMatches, "published repository ppa/squeeze is frozen: release freeze")
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	readRelease := func() Stanza {
+		rf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+		c.Assert(err, IsNil)
+		defer rf.Close()
+
+		st, err := NewControlFileReader(rf, true, false).ReadStanza()
+		c.Assert(err, IsNil)
+		return st
+	}
+
+	c.Check(readRelease()["Maintenance-Notice"], Equals, "release freeze")
+
+	s.repo.Unfreeze()
+	c.Check(s.repo.CheckFrozen(), IsNil)
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	_, ok := readRelease()["Maintenance-Notice"]
+	c.Check(ok, Equals, false)
+
+	s.repo.Freeze("")
+	c.Check(s.repo.CheckFrozen(), ErrorMatches, "published repository ppa/squeeze is frozen")
+}
+
+func (s *PublishedRepoSuite) TestPublishByHashDepth(c *C) {
+	s.repo.AcquireByHash = true
+	s.repo.ByHashDepth = 2
+	s.repo.Overrides = NewPublishOverrides()
+
+	byHashDir := filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/by-hash/SHA256")
+	key := "main/binary-i386/by-hash/SHA256/Packages"
+
+	var generations []string
+	for _, section := range []string{"games", "net", "web", "x11"} {
+		s.repo.Overrides.SetBinaryField("alien-arena-common", "Section", section)
+		c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+		generations = append(generations, s.repo.ByHashHistory[key][0])
+	}
+
+	c.Check(s.repo.ByHashHistory[key], DeepEquals, []string{generations[3], generations[2], generations[1]})
+	c.Check(filepath.Join(byHashDir, generations[0]), Not(PathExists))
+	for _, sum := range generations[1:] {
+		c.Check(filepath.Join(byHashDir, sum), PathExists)
+	}
+
+	// republishing unchanged index doesn't add generation
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+	c.Check(s.repo.ByHashHistory[key], DeepEquals, []string{generations[3], generations[2], generations[1]})
+
+	s.repo.ByHashDepth = 0
+	s.repo.Overrides.SetBinaryField("alien-arena-common", "Section", "games")
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+	c.Check(s.repo.ByHashHistory[key], HasLen, DefaultByHashDepth+1)
+	c.Check(filepath.Join(byHashDir, generations[1]), Not(PathExists))
+}
+
+func (s *PublishedRepoSuite) TestPublishGenerateDiffs(c *C) {
+	s.repo.GenerateDiffs = true
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	release, err := os.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+	c.Assert(err, IsNil)
+	c.Check(string(release), Matches, "(?s).* main/binary-i386/Packages.diff/Index\n.*")
+
+	index, err := os.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages.diff/Index"))
+	c.Assert(err, IsNil)
+	c.Check(string(index), Matches, "SHA256-Current: [0-9a-f]{64} [0-9]+\n")
+
+	s.repo5.GenerateDiffs = true
+	s.provider.storages["files:other"] = &NotReadableStorage{s.provider.storages["files:other"]}
+	c.Check(s.repo5.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), ErrorMatches,
+		"published storage files:other doesn't support reading files, which is required to generate diffs")
+}
+
+func (s *PublishedRepoSuite) TestPublishEnableZst(c *C) {
+	s.repo.EnableZst = true
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	release, err := os.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release"))
+	c.Assert(err, IsNil)
+	c.Check(string(release), Matches, "(?s).* main/binary-i386/Packages.zst\n.*")
+
+	packages, err := os.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages"))
+	c.Assert(err, IsNil)
+
+	compressed, err := os.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages.zst"))
+	c.Assert(err, IsNil)
+
+	decoder, err := zstd.NewReader(nil)
+	c.Assert(err, IsNil)
+	defer decoder.Close()
+
+	decompressed, err := decoder.DecodeAll(compressed, nil)
+	c.Assert(err, IsNil)
+	c.Check(string(decompressed), Equals, string(packages))
+}
+
+func (s *PublishedRepoSuite) TestPublishFlat(c *C) {
+	s.repo.Flat = true
+	s.repo.Architectures = []string{"amd64", "i386"}
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	_, err := os.Stat(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists"))
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	rf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "ppa/Release"))
+	c.Assert(err, IsNil)
+	defer rf.Close()
+
+	st, err := NewControlFileReader(rf, true, false).ReadStanza()
+	c.Assert(err, IsNil)
+	c.Check(st["Suite"], Equals, "squeeze")
+	c.Check(st["Architectures"], Equals, "amd64 i386")
+	c.Check(st["Components"], Equals, "")
+	c.Check(st["SHA256"], Matches, "(?s).* Packages\n.* Packages.gz\n.*")
+
+	pf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "ppa/Packages"))
+	c.Assert(err, IsNil)
+	defer pf.Close()
+
+	cfr := NewControlFileReader(pf, false, false)
+	for i := 0; i < 3; i++ {
+		st, err = cfr.ReadStanza()
+		c.Assert(err, IsNil)
+		c.Check(st["Filename"], Equals, "pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb")
+	}
+	st, err = cfr.ReadStanza()
+	c.Assert(err, IsNil)
+	c.Check(st, IsNil)
+
+	for _, path := range []string{"ppa/InRelease", "ppa/Release.gpg", "ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"} {
+		_, err = os.Stat(filepath.Join(s.publishedStorage.PublicPath(), path))
+		c.Check(err, IsNil)
+	}
+
+	c.Assert(s.repo.RemoveFiles(s.provider, false, nil, nil), IsNil)
+	for _, path := range []string{"ppa/Release", "ppa/InRelease", "ppa/Packages", "ppa/Packages.gz"} {
+		_, err = os.Stat(filepath.Join(s.publishedStorage.PublicPath(), path))
+		c.Check(os.IsNotExist(err), Equals, true)
+	}
+	_, err = os.Stat(filepath.Join(s.publishedStorage.PublicPath(), "ppa/pool/main/a/alien-arena/alien-arena-common_7.40-2_i386.deb"))
+	c.Check(err, IsNil)
+}
+
+func (s *PublishedRepoSuite) TestPublishFlatChecks(c *C) {
+	s.repo3.Flat = true
+	c.Check(s.repo3.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), ErrorMatches,
+		"flat repository should have exactly one component")
+
+	s.repo.Flat = true
+	s.repo.BlueGreen = true
+	c.Check(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), ErrorMatches,
+		"flat repository can't be published with blue-green publishing")
+
+	collection := s.factory.PublishedRepoCollection()
+	s.repo.BlueGreen = false
+	c.Assert(collection.Add(s.repo), IsNil)
+
+	s.repo2.Flat = true
+	c.Check(collection.CheckDuplicate(s.repo2), Equals, s.repo)
+	s.repo2.Flat = false
+	c.Check(collection.CheckDuplicate(s.repo2), IsNil)
+}
+
+// NotReadableStorage hides ReadFile of wrapped published storage
+type NotReadableStorage struct {
+	aptly.PublishedStorage
+}
+
+func (s *PublishedRepoSuite) TestPublishWithOverrides(c *C) {
+	s.repo.Overrides = NewPublishOverrides()
+	s.repo.Overrides.SetBinaryField("alien-arena-common", "Section", "games")
+
+	err := s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	pf, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages"))
+	c.Assert(err, IsNil)
+
+	cfr := NewControlFileReader(pf, false, false)
+	st, err := cfr.ReadStanza()
+	c.Assert(err, IsNil)
+
+	c.Check(st["Section"], Equals, "games")
+	c.Check(s.p1.Stanza()["Section"], Equals, "contrib/games")
+}
+
+func (s *PublishedRepoSuite) TestEstimate(c *C) {
+	estimate, err := s.repo.Estimate(s.factory, s.provider)
+	c.Assert(err, IsNil)
+	c.Check(estimate.NumberOfFiles, Equals, int64(1))
+	c.Check(estimate.TotalSize, Equals, s.p1.Files()[0].Checksums.Size)
+
+	estimate, err = s.repo3.Estimate(s.factory, s.provider)
+	c.Assert(err, IsNil)
+	c.Check(estimate.NumberOfFiles, Equals, int64(2))
+	c.Check(estimate.TotalSize, Equals, 2*s.p1.Files()[0].Checksums.Size)
+
+	// files already in published pool are not counted
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+	estimate, err = s.repo.Estimate(s.factory, s.provider)
+	c.Assert(err, IsNil)
+	c.Check(estimate.NumberOfFiles, Equals, int64(0))
+	c.Check(estimate.TotalSize, Equals, int64(0))
+
+	s.repo.Architectures = []string{"amd64"}
+	estimate, err = s.repo.Estimate(s.factory, s.provider)
+	c.Assert(err, IsNil)
+	c.Check(estimate.NumberOfFiles, Equals, int64(0))
+}
+
+type concurrentStorageProvider struct {
+	*FakeStorageProvider
+	concurrency int
+}
+
+func (p *concurrentStorageProvider) PublishConcurrency(_ string) int {
+	return p.concurrency
+}
+
+func (p *concurrentStorageProvider) PublishIndexConcurrency() int {
+	return p.concurrency
+}
+
+func (s *PublishedRepoSuite) TestPublishConcurrently(c *C) {
+	indexes := []string{"main/binary-i386/Packages", "contrib/binary-i386/Packages", "main/binary-i386/Release", "contrib/binary-i386/Release"}
+	readIndexes := func() map[string]string {
+		result := map[string]string{}
+		for _, path := range indexes {
+			contents, err := ioutil.ReadFile(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty", path))
+			c.Assert(err, IsNil)
+			result[path] = string(contents)
+		}
+		return result
+	}
+
+	err := s.repo3.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+	sequential := readIndexes()
+	c.Check(sequential["contrib/binary-i386/Packages"], Matches, "(?s).*Filename: pool/contrib/.*")
+
+	s.repo3.rePublishing = true
+	err = s.repo3.Publish(s.packagePool, &concurrentStorageProvider{s.provider, 4}, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	// indexes don't depend on concurrency
+	c.Check(readIndexes(), DeepEquals, sequential)
+
+	_, err = os.Stat(filepath.Join(s.publishedStorage.PublicPath(), "linux/dists/natty/Release.tmp"))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *PublishedRepoSuite) TestPublishContentsConcurrently(c *C) {
+	// components are indexed concurrently, all of them pushing contents to the same legacy index
+	components := []string{"main", "contrib", "non-free", "extra"}
+	sources := []interface{}{}
+	expected := map[string]string{}
+
+	for _, component := range components {
+		list := NewPackageList()
+
+		for i := 0; i < 25; i++ {
+			stanza := packageStanza.Copy()
+			stanza["Package"] = fmt.Sprintf("%s-%02d", component, i)
+			p := NewPackageFromControlFile(stanza)
+			p.UpdateFiles(s.p1.Files())
+			c.Assert(s.packageCollection.Update(p), IsNil)
+			c.Assert(list.Add(p), IsNil)
+
+			// short paths fit into spare capacity of index prefix
+			contents := []string{}
+			for j := 0; j < 10; j++ {
+				path := fmt.Sprintf("%c%02d/f%d", component[0], i, j)
+				contents = append(contents, path)
+				expected[path] = "contrib/games/" + p.Name
+			}
+
+			var buf bytes.Buffer
+			c.Assert(codec.NewEncoder(&buf, s.packageCollection.codecHandle).Encode(contents), IsNil)
+			c.Assert(s.db.Put(p.Key("xC"), buf.Bytes()), IsNil)
+		}
+
+		localRepo := NewLocalRepo("contents-"+component, "")
+		localRepo.packageRefs = NewPackageRefListFromPackageList(list)
+		c.Assert(s.factory.LocalRepoCollection().Add(localRepo), IsNil)
+		sources = append(sources, localRepo)
+	}
+
+	repo, err := NewPublishedRepo("", "contents", "sid", nil, components, sources, s.factory, false)
+	c.Assert(err, IsNil)
+
+	err = repo.Publish(s.packagePool, &concurrentStorageProvider{s.provider, 4}, s.factory, &NullSigner{}, nil, false, "")
+	c.Assert(err, IsNil)
+
+	f, err := os.Open(filepath.Join(s.publishedStorage.PublicPath(), "contents/dists/sid/Contents-i386.gz"))
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	c.Assert(err, IsNil)
+	contents, err := io.ReadAll(r)
+	c.Assert(err, IsNil)
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	c.Assert(lines, HasLen, 1+len(expected))
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		c.Assert(fields, HasLen, 2)
+		c.Check(fields[1], Equals, expected[fields[0]])
+	}
+}
+
 func (s *PublishedRepoSuite) TestPublishNoSigner(c *C) {
 	err := s.repo.Publish(s.packagePool, s.provider, s.factory, nil, nil, false, "")
 	c.Assert(err, IsNil)
@@ -0,0 +1,175 @@
+package deb
+
+import (
+	"time"
+)
+
+// Strategies of executing package query
+const (
+	// packages are matched one by one against the query
+	QueryStrategyScan = "scan"
+	// packages are looked up in the index by name (and provides)
+	QueryStrategyIndex = "index"
+	// package is looked up by exact key
+	QueryStrategyKey = "key"
+	// results of fast sub-queries are combined
+	QueryStrategyUnion = "union"
+	// results of fast sub-query are matched against the other sub-query
+	QueryStrategyFilter = "filter"
+	// query is only used as predicate by its parent
+	QueryStrategyPredicate = "predicate"
+)
+
+// QueryPlanNode is explanation of how one node of parsed query was executed
+type QueryPlanNode struct {
+	// Type of query node: or, and, not, field, dependency, package or all
+	Type string `json:"Type"`
+	// Query node in canonical form
+	Query string `json:"Query"`
+	// Strategy used to execute query node
+	Strategy string `json:"Strategy"`
+	// Number of packages matched against query node
+	Evaluated int `json:"Evaluated"`
+	// Number of packages which matched query node
+	Matched int `json:"Matched"`
+	// Number of packages returned by query node, if it was executed as query
+	Results  int              `json:"Results"`
+	Children []*QueryPlanNode `json:"Children,omitempty"`
+}
+
+// QueryExplain is explanation of parsed package query and statistics of its execution
+type QueryExplain struct {
+	// Parsed query in canonical form
+	Query string         `json:"Query"`
+	Plan  *QueryPlanNode `json:"Plan"`
+	// Number of packages examined: matched against query by scans or returned by index lookups
+	Examined int `json:"Examined"`
+	// Number of packages in query result
+	Matched int `json:"Matched"`
+	// Duration of query execution
+	Duration time.Duration `json:"Duration"`
+
+	instrumented PackageQuery
+	depth        int
+	start        time.Time
+}
+
+// explainQuery wraps query node collecting execution statistics
+type explainQuery struct {
+	PackageQuery
+	node    *QueryPlanNode
+	explain *QueryExplain
+}
+
+// Matches counts packages evaluated and matched by query node
+func (q *explainQuery) Matches(pkg PackageLike) bool {
+	if q.explain.depth == 0 {
+		q.explain.Examined++
+	}
+
+	q.explain.depth++
+	matched := q.PackageQuery.Matches(pkg)
+	q.explain.depth--
+
+	q.node.Evaluated++
+	if matched {
+		q.node.Matched++
+	}
+
+	return matched
+}
+
+// Query records strategy chosen by query node
+func (q *explainQuery) Query(list PackageCatalog) (result *PackageList) {
+	_, matchAll := q.PackageQuery.(*MatchAllQuery)
+
+	if !q.PackageQuery.Fast(list) || matchAll {
+		// scan with instrumented query, so that packages are counted
+		q.node.Strategy = QueryStrategyScan
+		result = list.Scan(q)
+	} else {
+		switch q.PackageQuery.(type) {
+		case *OrQuery:
+			q.node.Strategy = QueryStrategyUnion
+		case *AndQuery:
+			q.node.Strategy = QueryStrategyFilter
+		case *DependencyQuery:
+			q.node.Strategy = QueryStrategyIndex
+		case *PkgQuery:
+			q.node.Strategy = QueryStrategyKey
+		}
+
+		result = q.PackageQuery.Query(list)
+		if q.node.Strategy == QueryStrategyIndex || q.node.Strategy == QueryStrategyKey {
+			q.explain.Examined += result.Len()
+		}
+	}
+
+	q.node.Results = result.Len()
+	return
+}
+
+func (explain *QueryExplain) instrument(q PackageQuery) (PackageQuery, *QueryPlanNode) {
+	node := &QueryPlanNode{Query: q.String(), Strategy: QueryStrategyPredicate}
+
+	switch v := q.(type) {
+	case *OrQuery:
+		node.Type = "or"
+		l, lNode := explain.instrument(v.L)
+		r, rNode := explain.instrument(v.R)
+		node.Children = []*QueryPlanNode{lNode, rNode}
+		q = &OrQuery{L: l, R: r}
+	case *AndQuery:
+		node.Type = "and"
+		l, lNode := explain.instrument(v.L)
+		r, rNode := explain.instrument(v.R)
+		node.Children = []*QueryPlanNode{lNode, rNode}
+		q = &AndQuery{L: l, R: r}
+	case *NotQuery:
+		node.Type = "not"
+		inner, innerNode := explain.instrument(v.Q)
+		node.Children = []*QueryPlanNode{innerNode}
+		q = &NotQuery{Q: inner}
+	case *FieldQuery:
+		node.Type = "field"
+	case *DependencyQuery:
+		node.Type = "dependency"
+	case *PkgQuery:
+		node.Type = "package"
+	case *MatchAllQuery:
+		node.Type = "all"
+	}
+
+	return &explainQuery{PackageQuery: q, node: node, explain: explain}, node
+}
+
+// NewQueryExplain instruments parsed query to collect statistics of its execution
+//
+// Instrumented query returned by PackageQuery() should be executed instead of original
+// one, and Finish() should be called when execution is complete.
+func NewQueryExplain(q PackageQuery) *QueryExplain {
+	explain := &QueryExplain{Query: q.String(), start: time.Now()}
+	explain.instrumented, explain.Plan = explain.instrument(q)
+
+	return explain
+}
+
+// PackageQuery returns instrumented query
+func (explain *QueryExplain) PackageQuery() PackageQuery {
+	return explain.instrumented
+}
+
+// Finish records number of matched packages and duration of query execution
+func (explain *QueryExplain) Finish(matched int) {
+	explain.Matched = matched
+	explain.Duration = time.Since(explain.start)
+}
+
+// ExplainQuery executes query against package catalog collecting statistics
+func ExplainQuery(q PackageQuery, list PackageCatalog) (*PackageList, *QueryExplain) {
+	explain := NewQueryExplain(q)
+	result := explain.PackageQuery().Query(list)
+	explain.Finish(result.Len())
+
+	return result, explain
+}
@@ -0,0 +1,82 @@
+package deb
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type QueryExplainSuite struct {
+	PackageListMixinSuite
+}
+
+var _ = Suite(&QueryExplainSuite{})
+
+func (s *QueryExplainSuite) SetUpTest(c *C) {
+	s.SetUpPackages()
+	s.list.PrepareIndex()
+}
+
+func (s *QueryExplainSuite) TestScan(c *C) {
+	q := &FieldQuery{Field: "Name", Relation: VersionPatternMatch, Value: "*-invaders"}
+
+	result, explain := ExplainQuery(q, s.list)
+	c.Check(result.Len(), Equals, 1)
+	c.Check(explain.Query, Equals, "Name (% *-invaders)")
+	c.Check(explain.Examined, Equals, 3)
+	c.Check(explain.Matched, Equals, 1)
+	c.Check(explain.Plan.Type, Equals, "field")
+	c.Check(explain.Plan.Strategy, Equals, QueryStrategyScan)
+	c.Check(explain.Plan.Evaluated, Equals, 3)
+	c.Check(explain.Plan.Matched, Equals, 1)
+	c.Check(explain.Plan.Results, Equals, 1)
+}
+
+func (s *QueryExplainSuite) TestIndexAndFilter(c *C) {
+	q := &AndQuery{
+		L: &FieldQuery{Field: "$Architecture", Relation: VersionEqual, Value: "amd64"},
+		R: &DependencyQuery{Dep: Dependency{Pkg: "alien-arena-common"}},
+	}
+
+	result, explain := ExplainQuery(q, s.list)
+	c.Check(result.Len(), Equals, 0)
+	c.Check(explain.Examined, Equals, 2)
+	c.Check(explain.Matched, Equals, 0)
+	c.Check(explain.Plan.Strategy, Equals, QueryStrategyFilter)
+	c.Assert(explain.Plan.Children, HasLen, 2)
+	c.Check(explain.Plan.Children[0].Strategy, Equals, QueryStrategyPredicate)
+	c.Check(explain.Plan.Children[0].Evaluated, Equals, 1)
+	c.Check(explain.Plan.Children[0].Matched, Equals, 0)
+	c.Check(explain.Plan.Children[1].Type, Equals, "dependency")
+	c.Check(explain.Plan.Children[1].Strategy, Equals, QueryStrategyIndex)
+	c.Check(explain.Plan.Children[1].Results, Equals, 1)
+}
+
+func (s *QueryExplainSuite) TestNotScan(c *C) {
+	q := &OrQuery{
+		L: &DependencyQuery{Dep: Dependency{Pkg: "mars-invaders"}},
+		R: &NotQuery{Q: &DependencyQuery{Dep: Dependency{Pkg: "alien-arena-common"}}},
+	}
+
+	result, explain := ExplainQuery(q, s.list)
+	c.Check(result.Len(), Equals, 2)
+	// packages are counted once, even though they're evaluated by several nodes
+	c.Check(explain.Examined, Equals, 3)
+	c.Check(explain.Matched, Equals, 2)
+	c.Check(explain.Plan.Strategy, Equals, QueryStrategyScan)
+	c.Check(explain.Plan.Evaluated, Equals, 3)
+	c.Check(explain.Plan.Children[1].Type, Equals, "not")
+	c.Check(explain.Plan.Children[1].Children[0].Evaluated, Equals, 2)
+}
+
+func (s *QueryExplainSuite) TestUnion(c *C) {
+	q := &OrQuery{
+		L: &DependencyQuery{Dep: Dependency{Pkg: "mars-invaders"}},
+		R: &PkgQuery{Pkg: "lonely-strangers", Version: "7.40-2", Arch: "i386"},
+	}
+
+	result, explain := ExplainQuery(q, s.list)
+	c.Check(result.Len(), Equals, 2)
+	c.Check(explain.Examined, Equals, 2)
+	c.Check(explain.Plan.Strategy, Equals, QueryStrategyUnion)
+	c.Check(explain.Plan.Children[1].Strategy, Equals, QueryStrategyKey)
+	c.Check(explain.Plan.Children[1].Results, Equals, 1)
+}
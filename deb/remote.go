@@ -28,6 +28,7 @@ import (
 const (
 	MirrorIdle = iota
 	MirrorUpdating
+	MirrorPaused
 )
 
 // RemoteRepo represents remote (fetchable) Debian repository.
@@ -40,10 +41,19 @@ type RemoteRepo struct {
 	Name string
 	// Root of Debian archive, URL
 	ArchiveRoot string
+	// Archive roots used (in order) when ArchiveRoot fails
+	FallbackURLs []string `codec:",omitempty" json:",omitempty"`
+	// URL of list of archive roots used when ArchiveRoot and fallback URLs fail
+	MirrorListURL string `codec:",omitempty" json:",omitempty"`
+	// Health of upstream URLs observed during last update
+	URLHealth map[string]*RemoteURLHealth `codec:",omitempty" json:",omitempty"`
 	// Distribution name, e.g. squeeze
 	Distribution string
 	// List of components to fetch, if empty, then fetch all components
 	Components []string
+	// Mapping of upstream components to local component names (several upstream components
+	// could be merged into one), components missing in the map keep their names
+	ComponentMap map[string]string `codec:",omitempty" json:",omitempty"`
 	// List of architectures to fetch, if empty, then fetch all architectures
 	Architectures []string
 	// Meta-information about repository
@@ -70,6 +80,12 @@ type RemoteRepo struct {
 	DownloadUdebs bool
 	// Should we download installer files?
 	DownloadInstaller bool
+	// URL to fetch public keys of repository from
+	KeyURL string `codec:",omitempty" json:",omitempty"`
+	// Keyserver to fetch public keys of repository from
+	KeyServer string `codec:",omitempty" json:",omitempty"`
+	// Fingerprints of pinned public keys, fetched keys are stored in keyring of the mirror
+	KeyFingerprints []string `codec:",omitempty" json:",omitempty"`
 	// Packages for json output
 	Packages []string `codec:"-" json:",omitempty"`
 	// "Snapshot" of current list of packages
@@ -154,6 +170,62 @@ func (repo *RemoteRepo) String() string {
 	return fmt.Sprintf("[%s]: %s %s%s", repo.Name, repo.ArchiveRoot, distribution, srcFlag)
 }
 
+// SetComponentMap sets mapping of upstream components to local component names
+func (repo *RemoteRepo) SetComponentMap(componentMap map[string]string) error {
+	if len(componentMap) == 0 {
+		repo.ComponentMap = nil
+		return nil
+	}
+
+	if repo.IsFlat() {
+		return fmt.Errorf("components aren't supported for flat repos")
+	}
+
+	for upstream, local := range componentMap {
+		if upstream == "" || local == "" || strings.ContainsAny(upstream+local, " \t\n") {
+			return fmt.Errorf("invalid component mapping %#v -> %#v", upstream, local)
+		}
+	}
+
+	repo.ComponentMap = componentMap
+
+	if len(repo.Components) == 0 {
+		// components are not known yet, mapping is checked when Release file is fetched
+		return nil
+	}
+
+	return repo.checkComponentMap()
+}
+
+// checkComponentMap verifies that all mapped components are mirrored
+func (repo *RemoteRepo) checkComponentMap() error {
+	for upstream := range repo.ComponentMap {
+		if !utils.StrSliceHasItem(repo.Components, upstream) {
+			return fmt.Errorf("component %s in component mapping is not mirrored from repo %s", upstream, repo)
+		}
+	}
+
+	return nil
+}
+
+// LocalComponents returns list of components as presented downstream (e.g. when publishing
+// snapshots of the mirror), with component mapping applied
+func (repo *RemoteRepo) LocalComponents() []string {
+	result := make([]string, 0, len(repo.Components))
+
+	for _, component := range repo.Components {
+		if local, ok := repo.ComponentMap[component]; ok {
+			component = local
+		}
+
+		if !utils.StrSliceHasItem(result, component) {
+			result = append(result, component)
+		}
+	}
+
+	return result
+}
+
 // IsFlat determines if repository is flat
 func (repo *RemoteRepo) IsFlat() bool {
 	// aptly < 0.5.1 had Distribution = "" for flat repos
@@ -161,6 +233,12 @@ func (repo *RemoteRepo) IsFlat() bool {
 	return repo.Distribution == "" || (strings.HasPrefix(repo.Distribution, ".") && strings.HasSuffix(repo.Distribution, "/"))
 }
 
+// IsSecurityArchive determines if repository is a security updates archive,
+// e.g. bookworm-security or security.ubuntu.com
+func (repo *RemoteRepo) IsSecurityArchive() bool {
+	return strings.Contains(repo.Distribution, "security") || strings.Contains(repo.ArchiveRoot, "security")
+}
+
 // NumPackages return number of packages retrieved from remote repo
 func (repo *RemoteRepo) NumPackages() int {
 	if repo.packageRefs == nil {
@@ -191,6 +269,18 @@ func (repo *RemoteRepo) MarkAsIdle() {
 	repo.WorkerPID = 0
 }
 
+// MarkAsPaused clears updating flag and marks update as paused, so that it
+// could be resumed later on
+func (repo *RemoteRepo) MarkAsPaused() {
+	repo.Status = MirrorPaused
+	repo.WorkerPID = 0
+}
+
+// IsPaused checks whether mirror update was paused
+func (repo *RemoteRepo) IsPaused() bool {
+	return repo.Status == MirrorPaused
+}
+
 // CheckLock returns error if mirror is being updated by another process
 func (repo *RemoteRepo) CheckLock() error {
 	if repo.Status == MirrorIdle || repo.WorkerPID == 0 {
@@ -387,6 +477,10 @@ ok:
 				return err
 			}
 		}
+
+		if err = repo.checkComponentMap(); err != nil {
+			return err
+		}
 	}
 
 	repo.ReleaseFiles = make(map[string]utils.ChecksumInfo)
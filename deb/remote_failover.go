@@ -0,0 +1,290 @@
+package deb
+
+import (
+	"bufio"
+	gocontext "context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/http"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// RemoteURLHealth is health of upstream URL of mirror, as observed during last update
+type RemoteURLHealth struct {
+	// Number of successful downloads
+	Successes int
+	// Number of failed downloads
+	Failures int
+	// Last download error
+	LastError string `codec:",omitempty" json:",omitempty"`
+	// Time of last successful download
+	LastSuccess time.Time `codec:",omitempty" json:",omitempty"`
+}
+
+// normalizeArchiveRoot checks that URL is valid archive root, appending final /
+func normalizeArchiveRoot(archiveRoot string) (string, error) {
+	if !strings.HasSuffix(archiveRoot, "/") {
+		archiveRoot += "/"
+	}
+
+	u, err := url.Parse(archiveRoot)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("URL %s should be absolute", archiveRoot)
+	}
+
+	return u.String(), nil
+}
+
+// SetFallbackURLs sets archive roots which are used (in order) when primary URL fails
+func (repo *RemoteRepo) SetFallbackURLs(urls []string) error {
+	fallbacks := make([]string, 0, len(urls))
+
+	for _, u := range urls {
+		archiveRoot, err := normalizeArchiveRoot(u)
+		if err != nil {
+			return fmt.Errorf("invalid fallback URL: %s", err)
+		}
+
+		fallbacks = append(fallbacks, archiveRoot)
+	}
+
+	if len(fallbacks) == 0 {
+		fallbacks = nil
+	}
+
+	repo.FallbackURLs = utils.StrSliceDeduplicate(fallbacks)
+
+	return nil
+}
+
+// SetMirrorListURL sets URL of list of archive roots (one per line), which are used after
+// fallback URLs when primary URL fails
+func (repo *RemoteRepo) SetMirrorListURL(mirrorList string) error {
+	if mirrorList != "" {
+		u, err := url.Parse(mirrorList)
+		if err != nil {
+			return fmt.Errorf("invalid mirror list URL: %s", err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid mirror list URL: URL %s should be absolute", mirrorList)
+		}
+	}
+
+	repo.MirrorListURL = mirrorList
+
+	return nil
+}
+
+// URLFailover switches mirror downloads between upstream URLs when one of them fails
+//
+// Downloads start at the currently active URL; if it fails for reason other than missing file,
+// next URL is tried, and it becomes active for further downloads. Health of every URL is
+// recorded in the mirror.
+type URLFailover struct {
+	repo     *RemoteRepo
+	roots    []string
+	progress aptly.Progress
+
+	lock   sync.Mutex
+	active int
+}
+
+// NewURLFailover prepares failover between primary URL, fallback URLs and URLs from mirror list
+// of the mirror for single update, resetting health of URLs
+//
+// Mirror list is downloaded with downloader d. Failure to download it is not fatal, as primary
+// URL might still be working.
+func (repo *RemoteRepo) NewURLFailover(d aptly.Downloader) *URLFailover {
+	f := &URLFailover{
+		repo:     repo,
+		roots:    append([]string{repo.archiveRootURL.String()}, repo.FallbackURLs...),
+		progress: d.GetProgress(),
+	}
+
+	if repo.MirrorListURL != "" {
+		mirrors, err := downloadMirrorList(d, repo.MirrorListURL)
+		if err != nil {
+			if f.progress != nil {
+				f.progress.ColoredPrintf("@y[!]@| @!unable to download mirror list: %s@|", err)
+			}
+		}
+
+		f.roots = append(f.roots, mirrors...)
+	}
+
+	f.roots = utils.StrSliceDeduplicate(f.roots)
+
+	repo.URLHealth = nil
+	if len(f.roots) > 1 {
+		repo.URLHealth = make(map[string]*RemoteURLHealth, len(f.roots))
+		for _, root := range f.roots {
+			repo.URLHealth[root] = &RemoteURLHealth{}
+		}
+	}
+
+	return f
+}
+
+// downloadMirrorList downloads and parses list of archive roots, skipping invalid ones
+func downloadMirrorList(d aptly.Downloader, mirrorList string) ([]string, error) {
+	file, err := http.DownloadTemp(gocontext.TODO(), d, mirrorList)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var mirrors []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// apt mirror lists might contain tab-separated metadata after URL
+		archiveRoot, err := normalizeArchiveRoot(strings.Fields(line)[0])
+		if err != nil {
+			continue
+		}
+
+		mirrors = append(mirrors, archiveRoot)
+	}
+
+	return mirrors, scanner.Err()
+}
+
+// Roots returns list of archive roots in order of preference
+func (f *URLFailover) Roots() []string {
+	return f.roots
+}
+
+// Active returns archive root currently used for downloads
+func (f *URLFailover) Active() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.roots[f.active]
+}
+
+// Wrap returns downloader which fails over between upstream URLs of the mirror
+func (f *URLFailover) Wrap(d aptly.Downloader) aptly.Downloader {
+	if len(f.roots) < 2 {
+		return d
+	}
+
+	return &failoverDownloader{Downloader: d, failover: f}
+}
+
+// shouldFailover returns true if download error means upstream URL is not healthy
+func shouldFailover(err error) bool {
+	if errors.Is(err, gocontext.Canceled) {
+		return false
+	}
+
+	var herr *http.Error
+	if errors.As(err, &herr) {
+		// missing files are expected (e.g. compression variants of indexes), other mirrors won't have them either
+		return herr.Code != 404 && herr.Code != 403
+	}
+
+	return true
+}
+
+// do runs download of URL via currently active root, trying other roots on failure
+func (f *URLFailover) do(u string, download func(u string) error) error {
+	if !strings.HasPrefix(u, f.roots[0]) {
+		return download(u)
+	}
+
+	relPath := strings.TrimPrefix(u, f.roots[0])
+
+	f.lock.Lock()
+	start := f.active
+	f.lock.Unlock()
+
+	var err error
+
+	for i := range f.roots {
+		idx := (start + i) % len(f.roots)
+
+		err = download(f.roots[idx] + relPath)
+		if err == nil {
+			f.record(idx, nil)
+			return nil
+		}
+		if !shouldFailover(err) {
+			return err
+		}
+
+		f.record(idx, err)
+	}
+
+	return err
+}
+
+// record updates health of root, switching active root to the next one on failure
+func (f *URLFailover) record(idx int, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	health := f.repo.URLHealth[f.roots[idx]]
+
+	if err == nil {
+		health.Successes++
+		health.LastSuccess = time.Now()
+		return
+	}
+
+	health.Failures++
+	health.LastError = err.Error()
+
+	if idx == f.active {
+		f.active = (idx + 1) % len(f.roots)
+		if f.progress != nil {
+			f.progress.ColoredPrintf("@y[!]@| @!upstream %s failed, switching to %s@|", f.roots[idx], f.roots[f.active])
+		}
+	}
+}
+
+// failoverDownloader is aptly.Downloader which fails over between upstream URLs of the mirror
+type failoverDownloader struct {
+	aptly.Downloader
+	failover *URLFailover
+}
+
+// Download implements aptly.Downloader
+func (d *failoverDownloader) Download(ctx gocontext.Context, downloadURL string, destination string) error {
+	return d.failover.do(downloadURL, func(u string) error {
+		return d.Downloader.Download(ctx, u, destination)
+	})
+}
+
+// DownloadWithChecksum implements aptly.Downloader
+func (d *failoverDownloader) DownloadWithChecksum(ctx gocontext.Context, downloadURL string, destination string,
+	expected *utils.ChecksumInfo, ignoreMismatch bool) error {
+	return d.failover.do(downloadURL, func(u string) error {
+		return d.Downloader.DownloadWithChecksum(ctx, u, destination, expected, ignoreMismatch)
+	})
+}
+
+// GetLength implements aptly.Downloader
+func (d *failoverDownloader) GetLength(ctx gocontext.Context, downloadURL string) (int64, error) {
+	var length int64
+
+	err := d.failover.do(downloadURL, func(u string) (err error) {
+		length, err = d.Downloader.GetLength(ctx, u)
+		return
+	})
+
+	return length, err
+}
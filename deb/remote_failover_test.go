@@ -0,0 +1,74 @@
+package deb
+
+import (
+	gocontext "context"
+	"errors"
+
+	"github.com/aptly-dev/aptly/http"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *RemoteRepoSuite) TestSetFallbackURLs(c *C) {
+	c.Check(s.repo.SetFallbackURLs([]string{"http://ftp.ru.debian.org/debian", "http://ftp.de.debian.org/debian/", "http://ftp.ru.debian.org/debian/"}), IsNil)
+	c.Check(s.repo.FallbackURLs, DeepEquals, []string{"http://ftp.ru.debian.org/debian/", "http://ftp.de.debian.org/debian/"})
+
+	c.Check(s.repo.SetFallbackURLs(nil), IsNil)
+	c.Check(s.repo.FallbackURLs, IsNil)
+
+	c.Check(s.repo.SetFallbackURLs([]string{"debian"}), ErrorMatches, "invalid fallback URL: URL debian/ should be absolute")
+	c.Check(s.repo.SetMirrorListURL("mirrors.txt"), ErrorMatches, "invalid mirror list URL: .*")
+	c.Check(s.repo.SetMirrorListURL("http://mirrors.example.com/debian.list"), IsNil)
+}
+
+func (s *RemoteRepoSuite) TestURLFailover(c *C) {
+	c.Assert(s.repo.SetFallbackURLs([]string{"http://ftp.ru.debian.org/debian"}), IsNil)
+
+	failover := s.repo.NewURLFailover(s.downloader)
+	c.Check(failover.Roots(), DeepEquals, []string{"http://mirror.yandex.ru/debian/", "http://ftp.ru.debian.org/debian/"})
+
+	s.downloader = http.NewFakeDownloader().
+		ExpectError("http://mirror.yandex.ru/debian/dists/squeeze/Release", errors.New("connection refused")).
+		ExpectResponse("http://ftp.ru.debian.org/debian/dists/squeeze/Release", exampleReleaseFile).
+		ExpectError("http://ftp.ru.debian.org/debian/dists/squeeze/main/binary-i386/Packages.bz2", &http.Error{Code: 404})
+
+	d := failover.Wrap(s.downloader)
+
+	err := s.repo.Fetch(d, nil, true)
+	c.Assert(err, IsNil)
+	c.Check(s.repo.Architectures, DeepEquals, []string{"amd64", "armel", "armhf", "i386", "powerpc"})
+	c.Check(failover.Active(), Equals, "http://ftp.ru.debian.org/debian/")
+
+	// missing file doesn't switch to another URL
+	_, err = http.DownloadTemp(gocontext.TODO(), d, "http://mirror.yandex.ru/debian/dists/squeeze/main/binary-i386/Packages.bz2")
+	c.Check(err, ErrorMatches, "HTTP code 404 .*")
+	c.Check(failover.Active(), Equals, "http://ftp.ru.debian.org/debian/")
+	c.Check(s.downloader.Empty(), Equals, true)
+
+	primary := s.repo.URLHealth["http://mirror.yandex.ru/debian/"]
+	c.Check(primary.Failures, Equals, 1)
+	c.Check(primary.Successes, Equals, 0)
+	c.Check(primary.LastError, Equals, "connection refused")
+
+	fallback := s.repo.URLHealth["http://ftp.ru.debian.org/debian/"]
+	c.Check(fallback.Failures, Equals, 0)
+	c.Check(fallback.Successes, Equals, 1)
+	c.Check(fallback.LastSuccess.IsZero(), Equals, false)
+}
+
+func (s *RemoteRepoSuite) TestURLFailoverMirrorList(c *C) {
+	c.Assert(s.repo.SetMirrorListURL("http://mirrors.example.com/debian.list"), IsNil)
+
+	s.downloader = http.NewFakeDownloader().
+		ExpectResponse("http://mirrors.example.com/debian.list", "# Debian mirrors\nhttp://ftp.ru.debian.org/debian\tpriority:1\n\nnot a url\nhttp://mirror.yandex.ru/debian/\n")
+
+	failover := s.repo.NewURLFailover(s.downloader)
+	c.Check(failover.Roots(), DeepEquals, []string{"http://mirror.yandex.ru/debian/", "http://ftp.ru.debian.org/debian/"})
+	c.Check(s.repo.URLHealth, HasLen, 2)
+
+	// without alternatives, downloader is used as is
+	s.repo.MirrorListURL = ""
+	failover = s.repo.NewURLFailover(s.downloader)
+	c.Check(failover.Wrap(s.downloader), Equals, s.downloader)
+	c.Check(s.repo.URLHealth, IsNil)
+}
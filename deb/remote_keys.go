@@ -0,0 +1,143 @@
+package deb
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/http"
+	"github.com/aptly-dev/aptly/pgp"
+)
+
+// SetPinnedKeys configures fetching of public keys of repository from keyURL or keyserver,
+// fetched keys should match fingerprints
+func (repo *RemoteRepo) SetPinnedKeys(keyURL, keyServer string, fingerprints []string) error {
+	if keyURL == "" && keyServer == "" && len(fingerprints) == 0 {
+		repo.KeyURL, repo.KeyServer, repo.KeyFingerprints = "", "", nil
+		return nil
+	}
+
+	if keyURL != "" && keyServer != "" {
+		return fmt.Errorf("key URL and keyserver can't be used together")
+	}
+
+	if keyURL == "" && keyServer == "" {
+		return fmt.Errorf("key URL or keyserver is required to fetch pinned keys")
+	}
+
+	if len(fingerprints) == 0 {
+		return fmt.Errorf("fingerprints of keys are required to fetch keys")
+	}
+
+	repo.KeyURL, repo.KeyServer = keyURL, keyServer
+	repo.KeyFingerprints = make([]string, len(fingerprints))
+	for i, fingerprint := range fingerprints {
+		repo.KeyFingerprints[i] = pgp.NormalizeFingerprint(fingerprint)
+	}
+
+	return nil
+}
+
+// HasPinnedKeys checks whether public keys of repository are fetched automatically
+func (repo *RemoteRepo) HasPinnedKeys() bool {
+	return len(repo.KeyFingerprints) > 0
+}
+
+// KeyringPath returns path to keyring of the mirror in directory keyringsDir
+func (repo *RemoteRepo) KeyringPath(keyringsDir string) string {
+	return filepath.Join(keyringsDir, repo.UUID+".gpg")
+}
+
+// keyServerURL builds HKP lookup URL for key with fingerprint
+func keyServerURL(keyServer, fingerprint string) (string, error) {
+	if !strings.Contains(keyServer, "://") {
+		keyServer = "hkps://" + keyServer
+	}
+
+	u, err := url.Parse(keyServer)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "hkp":
+		u.Scheme = "http"
+		if u.Port() == "" {
+			u.Host += ":11371"
+		}
+	case "hkps":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("unsupported keyserver scheme %s", u.Scheme)
+	}
+
+	u.Path = "/pks/lookup"
+	u.RawQuery = url.Values{"op": {"get"}, "options": {"mr"}, "search": {"0x" + fingerprint}}.Encode()
+
+	return u.String(), nil
+}
+
+func downloadKeys(d aptly.Downloader, keyURL string) ([]byte, error) {
+	f, err := http.DownloadTemp(gocontext.TODO(), d, keyURL)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// FetchKeys downloads public keys of repository, verifies fingerprints and stores pinned keys
+// in keyring of the mirror, returns path to the keyring
+func (repo *RemoteRepo) FetchKeys(d aptly.Downloader, keyringsDir string) (string, error) {
+	var keys []byte
+
+	if repo.KeyURL != "" {
+		data, err := downloadKeys(d, repo.KeyURL)
+		if err != nil {
+			return "", fmt.Errorf("unable to fetch keys from %s: %s", repo.KeyURL, err)
+		}
+		keys = data
+	} else {
+		for _, fingerprint := range repo.KeyFingerprints {
+			lookupURL, err := keyServerURL(repo.KeyServer, fingerprint)
+			if err != nil {
+				return "", fmt.Errorf("unable to fetch key %s: %s", fingerprint, err)
+			}
+
+			data, err := downloadKeys(d, lookupURL)
+			if err != nil {
+				return "", fmt.Errorf("unable to fetch key %s from %s: %s", fingerprint, repo.KeyServer, err)
+			}
+			keys = append(keys, data...)
+			keys = append(keys, '\n')
+		}
+	}
+
+	keyring, err := pgp.PinKeys(keys, repo.KeyFingerprints)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(keyringsDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	path := repo.KeyringPath(keyringsDir)
+	err = os.WriteFile(path+".tmp", keyring, 0644)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to store keyring: %s", err)
+	}
+
+	return path, nil
+}
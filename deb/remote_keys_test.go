@@ -0,0 +1,55 @@
+package deb
+
+import (
+	"os"
+
+	"github.com/aptly-dev/aptly/http"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *RemoteRepoSuite) TestSetPinnedKeys(c *C) {
+	c.Check(s.repo.SetPinnedKeys("", "", nil), IsNil)
+	c.Check(s.repo.HasPinnedKeys(), Equals, false)
+
+	c.Check(s.repo.SetPinnedKeys("https://example.com/key.asc", "keyserver.ubuntu.com", []string{"AB"}), ErrorMatches, "key URL and keyserver can't be used together")
+	c.Check(s.repo.SetPinnedKeys("", "", []string{"AB"}), ErrorMatches, "key URL or keyserver is required.*")
+	c.Check(s.repo.SetPinnedKeys("https://example.com/key.asc", "", nil), ErrorMatches, "fingerprints of keys are required.*")
+
+	c.Check(s.repo.SetPinnedKeys("https://example.com/key.asc", "", []string{"0xab cd"}), IsNil)
+	c.Check(s.repo.HasPinnedKeys(), Equals, true)
+	c.Check(s.repo.KeyFingerprints, DeepEquals, []string{"ABCD"})
+}
+
+func (s *RemoteRepoSuite) TestKeyServerURL(c *C) {
+	u, err := keyServerURL("keyserver.ubuntu.com", "ABCD")
+	c.Check(err, IsNil)
+	c.Check(u, Equals, "https://keyserver.ubuntu.com/pks/lookup?op=get&options=mr&search=0xABCD")
+
+	u, err = keyServerURL("hkp://keyserver.ubuntu.com", "ABCD")
+	c.Check(err, IsNil)
+	c.Check(u, Equals, "http://keyserver.ubuntu.com:11371/pks/lookup?op=get&options=mr&search=0xABCD")
+
+	_, err = keyServerURL("ldap://keyserver.ubuntu.com", "ABCD")
+	c.Check(err, ErrorMatches, "unsupported keyserver scheme ldap")
+}
+
+func (s *RemoteRepoSuite) TestFetchKeys(c *C) {
+	keys, err := os.ReadFile("../system/files/aptly.pub")
+	c.Assert(err, IsNil)
+
+	keyringsDir := c.MkDir()
+	c.Assert(s.repo.SetPinnedKeys("https://example.com/key.gpg", "", []string{"C5ACD2179B5231DFE842EE6121DBB89C16DB3E6D"}), IsNil)
+
+	downloader := http.NewFakeDownloader().ExpectResponse("https://example.com/key.gpg", string(keys))
+	path, err := s.repo.FetchKeys(downloader, keyringsDir)
+	c.Assert(err, IsNil)
+	c.Check(path, Equals, s.repo.KeyringPath(keyringsDir))
+	c.Check(path, PathExists)
+
+	// key was rotated upstream
+	c.Assert(s.repo.SetPinnedKeys("https://example.com/key.gpg", "", []string{"0000000000000000000000000000000000000000"}), IsNil)
+	downloader = http.NewFakeDownloader().ExpectResponse("https://example.com/key.gpg", string(keys))
+	_, err = s.repo.FetchKeys(downloader, keyringsDir)
+	c.Check(err, ErrorMatches, "key with fingerprint 0000000000000000000000000000000000000000 not found in fetched keys")
+}
@@ -153,6 +153,19 @@ func (s *RemoteRepoSuite) TestRefList(c *C) {
 	c.Check(s.repo.RefList(), Equals, s.reflist)
 }
 
+func (s *RemoteRepoSuite) TestMarkAsPaused(c *C) {
+	s.repo.MarkAsUpdating()
+	c.Check(s.repo.IsPaused(), Equals, false)
+
+	s.repo.MarkAsPaused()
+	c.Check(s.repo.IsPaused(), Equals, true)
+	c.Check(s.repo.WorkerPID, Equals, 0)
+	c.Check(s.repo.CheckLock(), IsNil)
+
+	s.repo.MarkAsIdle()
+	c.Check(s.repo.IsPaused(), Equals, false)
+}
+
 func (s *RemoteRepoSuite) TestReleaseURL(c *C) {
 	c.Assert(s.repo.ReleaseURL("Release").String(), Equals, "http://mirror.yandex.ru/debian/dists/squeeze/Release")
 	c.Assert(s.repo.ReleaseURL("InRelease").String(), Equals, "http://mirror.yandex.ru/debian/dists/squeeze/InRelease")
@@ -482,6 +495,7 @@ func (s *RemoteRepoSuite) TestDownloadFlat(c *C) {
 	downloader := http.NewFakeDownloader()
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Release", exampleReleaseFile)
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.bz2", &http.Error{Code: 404})
+	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.zst", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.gz", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.xz", &http.Error{Code: 404})
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Packages", examplePackagesFile)
@@ -510,6 +524,7 @@ func (s *RemoteRepoSuite) TestDownloadFlat(c *C) {
 	// Next call must return an empty download list with option "skip-existing-packages"
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Release", exampleReleaseFile)
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.bz2", &http.Error{Code: 404})
+	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.zst", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.gz", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.xz", &http.Error{Code: 404})
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Packages", examplePackagesFile)
@@ -532,6 +547,7 @@ func (s *RemoteRepoSuite) TestDownloadFlat(c *C) {
 	// Next call must return the download list without option "skip-existing-packages"
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Release", exampleReleaseFile)
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.bz2", &http.Error{Code: 404})
+	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.zst", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.gz", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.xz", &http.Error{Code: 404})
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Packages", examplePackagesFile)
@@ -559,10 +575,12 @@ func (s *RemoteRepoSuite) TestDownloadWithSourcesFlat(c *C) {
 	downloader := http.NewFakeDownloader()
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Release", exampleReleaseFile)
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.bz2", &http.Error{Code: 404})
+	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.zst", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.gz", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.xz", &http.Error{Code: 404})
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Packages", examplePackagesFile)
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.bz2", &http.Error{Code: 404})
+	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.zst", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.gz", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.xz", &http.Error{Code: 404})
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Sources", exampleSourcesFile)
@@ -605,10 +623,12 @@ func (s *RemoteRepoSuite) TestDownloadWithSourcesFlat(c *C) {
 	// Next call must return an empty download list with option "skip-existing-packages"
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Release", exampleReleaseFile)
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.bz2", &http.Error{Code: 404})
+	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.zst", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.gz", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.xz", &http.Error{Code: 404})
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Packages", examplePackagesFile)
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.bz2", &http.Error{Code: 404})
+	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.zst", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.gz", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.xz", &http.Error{Code: 404})
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Sources", exampleSourcesFile)
@@ -631,10 +651,12 @@ func (s *RemoteRepoSuite) TestDownloadWithSourcesFlat(c *C) {
 	// Next call must return the download list without option "skip-existing-packages"
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Release", exampleReleaseFile)
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.bz2", &http.Error{Code: 404})
+	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.zst", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.gz", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Packages.xz", &http.Error{Code: 404})
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Packages", examplePackagesFile)
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.bz2", &http.Error{Code: 404})
+	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.zst", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.gz", &http.Error{Code: 404})
 	downloader.ExpectError("http://repos.express42.com/virool/precise/Sources.xz", &http.Error{Code: 404})
 	downloader.ExpectResponse("http://repos.express42.com/virool/precise/Sources", exampleSourcesFile)
@@ -956,3 +978,29 @@ netboot/xen/initrd.gz           -- initrd for installing under Xen
 netboot/xen/vmlinuz             -- kernel image for installing under Xen`
 
 const exampleSourcesFile = sourcePackageMeta
+
+func (s *RemoteRepoSuite) TestComponentMap(c *C) {
+	repo, _ := NewRemoteRepo("ubuntu", "http://archive.ubuntu.com/ubuntu/", "jammy", []string{"main", "universe", "restricted"}, []string{}, false, false, false)
+	c.Check(repo.LocalComponents(), DeepEquals, []string{"main", "universe", "restricted"})
+
+	c.Check(repo.SetComponentMap(map[string]string{"multiverse": "upstream"}), ErrorMatches, "component multiverse in component mapping is not mirrored.*")
+	c.Check(repo.SetComponentMap(map[string]string{"main": ""}), ErrorMatches, "invalid component mapping.*")
+	c.Check(s.flat.SetComponentMap(map[string]string{"main": "upstream"}), ErrorMatches, "components aren't supported for flat repos")
+
+	c.Assert(repo.SetComponentMap(map[string]string{"main": "upstream", "universe": "upstream"}), IsNil)
+	c.Check(repo.LocalComponents(), DeepEquals, []string{"upstream", "restricted"})
+
+	c.Assert(repo.SetComponentMap(nil), IsNil)
+	c.Check(repo.ComponentMap, IsNil)
+	c.Check(repo.LocalComponents(), DeepEquals, []string{"main", "universe", "restricted"})
+
+	// components are not known before Release file is fetched
+	repo, _ = NewRemoteRepo("yandex", "http://mirror.yandex.ru/debian", "squeeze", []string{}, []string{}, false, false, false)
+	c.Assert(repo.SetComponentMap(map[string]string{"universe": "upstream"}), IsNil)
+	c.Check(repo.Fetch(s.downloader, nil, true), ErrorMatches, "component universe in component mapping is not mirrored.*")
+
+	s.downloader = http.NewFakeDownloader().ExpectResponse("http://mirror.yandex.ru/debian/dists/squeeze/Release", exampleReleaseFile)
+	c.Assert(repo.SetComponentMap(map[string]string{"main": "upstream"}), IsNil)
+	c.Assert(repo.Fetch(s.downloader, nil, true), IsNil)
+	c.Check(repo.LocalComponents(), DeepEquals, []string{"upstream"})
+}
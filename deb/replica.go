@@ -0,0 +1,247 @@
+package deb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/pgp"
+)
+
+// ReplicaStatus is state of one replica of published repository
+type ReplicaStatus struct {
+	// Published storage of replica ("" for default storage)
+	Storage string `json:"Storage"`
+	// SHA256 of Release file without Date and Valid-Until fields, empty if storage doesn't allow to read files
+	ReleaseSHA256 string `json:"ReleaseSHA256"`
+	// Date field of Release file
+	ReleaseDate string `json:"ReleaseDate"`
+	// Number of files in dists/<distribution> and pool
+	Files int `json:"Files"`
+	// Files present on reference replica, but missing on this replica
+	MissingFiles []string `json:"MissingFiles"`
+	// Files present on this replica, but missing on reference replica
+	ExtraFiles []string `json:"ExtraFiles"`
+	// Replica has different Release file or is missing files
+	Stale bool `json:"Stale"`
+	// Stale replica was re-published
+	Resynced bool `json:"Resynced"`
+	// Error checking (or re-publishing) replica
+	Error string `json:"Error,omitempty"`
+
+	files       map[string]struct{}
+	releaseTime time.Time
+}
+
+// ReplicaCheck is result of comparing replicas of published repository
+type ReplicaCheck struct {
+	Prefix       string `json:"Prefix"`
+	Distribution string `json:"Distribution"`
+	// Storage of reference replica, which has the most recent Release file
+	Reference string `json:"Reference"`
+	// All replicas are in sync
+	Consistent bool             `json:"Consistent"`
+	Replicas   []*ReplicaStatus `json:"Replicas"`
+}
+
+// inspectReplica reads file inventory and Release file of replica
+func inspectReplica(publishedStorageProvider aptly.PublishedStorageProvider, p *PublishedRepo) *ReplicaStatus {
+	status := &ReplicaStatus{Storage: p.Storage, files: map[string]struct{}{}}
+
+	storage := publishedStorageProvider.GetPublishedStorage(p.Storage)
+
+	for _, dir := range []string{p.releaseDir(), "pool"} {
+		list, err := storage.Filelist(filepath.Join(p.Prefix, dir))
+		if err != nil {
+			status.Error = fmt.Sprintf("unable to list files: %s", err)
+			return status
+		}
+
+		for _, f := range list {
+			status.files[filepath.Join(dir, f)] = struct{}{}
+		}
+	}
+	status.Files = len(status.files)
+
+	readable, ok := storage.(aptly.ReadablePublishedStorage)
+	if !ok {
+		return status
+	}
+
+	release, err := readable.ReadFile(filepath.Join(p.Prefix, p.releaseDir(), "Release"))
+	if err != nil {
+		status.Error = fmt.Sprintf("unable to read Release file: %s", err)
+		return status
+	}
+
+	// replicas are published at different times, so dates are not compared
+	h := sha256.New()
+	for _, line := range bytes.SplitAfter(release, []byte("\n")) {
+		if !bytes.HasPrefix(line, []byte("Date:")) && !bytes.HasPrefix(line, []byte("Valid-Until:")) {
+			h.Write(line)
+		}
+	}
+	status.ReleaseSHA256 = fmt.Sprintf("%x", h.Sum(nil))
+
+	stanza, err := NewControlFileReader(bytes.NewReader(release), true, false).ReadStanza()
+	if err == nil && stanza != nil {
+		status.ReleaseDate = stanza["Date"]
+		status.releaseTime, _ = time.Parse("Mon, 2 Jan 2006 15:04:05 MST", status.ReleaseDate)
+	}
+
+	return status
+}
+
+// CheckReplicas compares Release files and file inventories of replicas of published
+// repository (published with the same prefix and distribution to different storages)
+//
+// Replica with the most recent Release file is used as reference, other replicas
+// are stale if their Release file differs or they are missing files.
+func CheckReplicas(publishedStorageProvider aptly.PublishedStorageProvider, replicas []*PublishedRepo) (*ReplicaCheck, error) {
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("no replicas to check")
+	}
+
+	check := &ReplicaCheck{
+		Prefix:       replicas[0].Prefix,
+		Distribution: replicas[0].Distribution,
+		Consistent:   true,
+	}
+
+	var reference *ReplicaStatus
+	for _, p := range replicas {
+		status := inspectReplica(publishedStorageProvider, p)
+		check.Replicas = append(check.Replicas, status)
+
+		if status.Error != "" {
+			continue
+		}
+
+		if reference == nil || status.releaseTime.After(reference.releaseTime) {
+			reference = status
+		}
+	}
+
+	if reference == nil {
+		return nil, fmt.Errorf("unable to inspect any replica of %s/%s", check.Prefix, check.Distribution)
+	}
+	check.Reference = reference.Storage
+
+	for _, status := range check.Replicas {
+		if status.Error != "" {
+			check.Consistent = false
+			continue
+		}
+
+		if status == reference {
+			continue
+		}
+
+		status.MissingFiles, status.ExtraFiles = []string{}, []string{}
+		for f := range reference.files {
+			if _, found := status.files[f]; !found {
+				status.MissingFiles = append(status.MissingFiles, f)
+			}
+		}
+		for f := range status.files {
+			if _, found := reference.files[f]; !found {
+				status.ExtraFiles = append(status.ExtraFiles, f)
+			}
+		}
+		sort.Strings(status.MissingFiles)
+		sort.Strings(status.ExtraFiles)
+
+		releaseDiffers := status.ReleaseSHA256 != "" && reference.ReleaseSHA256 != "" && status.ReleaseSHA256 != reference.ReleaseSHA256
+		status.Stale = releaseDiffers || len(status.MissingFiles) > 0
+
+		if status.Stale || len(status.ExtraFiles) > 0 {
+			check.Consistent = false
+		}
+	}
+
+	return check, nil
+}
+
+// copySources replaces sources of published repository with sources of another one
+func (p *PublishedRepo) copySources(other *PublishedRepo) error {
+	if p.SourceKind != other.SourceKind {
+		return fmt.Errorf("source kind %s differs from %s", p.SourceKind, other.SourceKind)
+	}
+
+	for _, component := range p.Components() {
+		if _, exists := other.Sources[component]; !exists {
+			p.RemoveComponent(component)
+		}
+	}
+
+	for component, item := range other.sourceItems {
+		p.sourceItems[component] = item
+		p.Sources[component] = other.Sources[component]
+	}
+	p.rePublishing = true
+
+	return nil
+}
+
+// Resync re-publishes stale replicas with sources of reference replica
+func (check *ReplicaCheck) Resync(replicas []*PublishedRepo, packagePool aptly.PackagePool, publishedStorageProvider aptly.PublishedStorageProvider,
+	collectionFactory *CollectionFactory, signer pgp.FileSigner, progress aptly.Progress, skelDir string) error {
+	collection := collectionFactory.PublishedRepoCollection()
+
+	var reference *PublishedRepo
+	for _, p := range replicas {
+		if p.Storage == check.Reference {
+			reference = p
+		}
+	}
+	if reference == nil {
+		return fmt.Errorf("reference replica %s not found", check.Reference)
+	}
+
+	if err := collection.LoadComplete(reference, collectionFactory); err != nil {
+		return err
+	}
+
+	for i, status := range check.Replicas {
+		if !status.Stale {
+			continue
+		}
+
+		p := replicas[i]
+		err := p.CheckFrozen()
+		if err == nil {
+			err = collection.LoadComplete(p, collectionFactory)
+		}
+		if err == nil {
+			err = p.copySources(reference)
+		}
+		if err == nil {
+			if progress != nil {
+				progress.Printf("Re-publishing stale replica %s...\n", p.String())
+			}
+			err = p.Publish(packagePool, publishedStorageProvider, collectionFactory, signer, progress, false, skelDir)
+		}
+		if err == nil {
+			err = collection.Update(p)
+		}
+
+		if err != nil {
+			status.Error = fmt.Sprintf("unable to re-sync: %s", err)
+			continue
+		}
+		status.Resynced = true
+	}
+
+	check.Consistent = true
+	for _, status := range check.Replicas {
+		if status.Error != "" || (status.Stale && !status.Resynced) || len(status.ExtraFiles) > 0 {
+			check.Consistent = false
+		}
+	}
+
+	return nil
+}
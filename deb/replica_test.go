@@ -0,0 +1,51 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *PublishedRepoSuite) TestCheckReplicas(c *C) {
+	replica, err := NewPublishedRepo("files:other", "ppa", "squeeze", nil, []string{"main"}, []interface{}{s.snapshot}, s.factory, false)
+	c.Assert(err, IsNil)
+	replica.SkipContents = true
+
+	collection := s.factory.PublishedRepoCollection()
+	c.Assert(collection.Add(s.repo), IsNil)
+	c.Assert(collection.Add(replica), IsNil)
+
+	// replica in default storage is published last, so it is the reference one
+	c.Assert(replica.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, &NullSigner{}, nil, false, ""), IsNil)
+
+	replicas := collection.ByPrefixDistribution("ppa", "squeeze")
+	c.Assert(replicas, HasLen, 2)
+	c.Check(replicas[0].Storage, Equals, "")
+	c.Check(replicas[1].Storage, Equals, "files:other")
+
+	check, err := CheckReplicas(s.provider, replicas)
+	c.Assert(err, IsNil)
+	c.Check(check.Consistent, Equals, true)
+	c.Check(check.Reference, Equals, "")
+	c.Check(check.Replicas[1].ReleaseSHA256, Equals, check.Replicas[0].ReleaseSHA256)
+
+	c.Assert(os.Remove(filepath.Join(s.publishedStorage2.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages")), IsNil)
+
+	check, err = CheckReplicas(s.provider, replicas)
+	c.Assert(err, IsNil)
+	c.Check(check.Consistent, Equals, false)
+	c.Check(check.Replicas[0].Stale, Equals, false)
+	c.Check(check.Replicas[1].Stale, Equals, true)
+	c.Check(check.Replicas[1].MissingFiles, DeepEquals, []string{"dists/squeeze/main/binary-i386/Packages"})
+	c.Check(check.Replicas[1].ExtraFiles, DeepEquals, []string{})
+
+	c.Assert(check.Resync(replicas, s.packagePool, s.provider, s.factory, &NullSigner{}, nil, ""), IsNil)
+	c.Check(check.Replicas[1].Error, Equals, "")
+	c.Check(check.Replicas[1].Resynced, Equals, true)
+
+	check, err = CheckReplicas(s.provider, replicas)
+	c.Assert(err, IsNil)
+	c.Check(check.Consistent, Equals, true)
+}
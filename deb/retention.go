@@ -0,0 +1,145 @@
+package deb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+)
+
+// RetentionPolicy limits versions of packages kept in local repo
+//
+// Packages are grouped by name and architecture, the newest version in each group
+// and held packages are never pruned.
+type RetentionPolicy struct {
+	// Number of newest versions kept for each package name and architecture, 0 for no limit
+	KeepVersions int `codec:",omitempty" json:"KeepVersions"`
+	// Versions added to the repo more than MaxAgeDays days ago are pruned, 0 for no limit
+	MaxAgeDays int `codec:",omitempty" json:"MaxAgeDays"`
+	// Prune repo automatically after packages are added to it
+	AutoPrune bool `codec:",omitempty" json:"AutoPrune"`
+}
+
+// Validate checks that retention policy is consistent
+func (policy *RetentionPolicy) Validate() error {
+	if policy.KeepVersions < 0 || policy.MaxAgeDays < 0 {
+		return fmt.Errorf("number of versions and age of packages in retention policy can't be negative")
+	}
+
+	if policy.KeepVersions == 0 && policy.MaxAgeDays == 0 {
+		return fmt.Errorf("retention policy should limit either number of versions or age of packages")
+	}
+
+	return nil
+}
+
+// String interface
+func (policy *RetentionPolicy) String() string {
+	var result string
+
+	if policy.KeepVersions > 0 {
+		result = fmt.Sprintf("keep %d versions", policy.KeepVersions)
+	}
+	if policy.MaxAgeDays > 0 {
+		if result != "" {
+			result += ", "
+		}
+		result += fmt.Sprintf("max age %d days", policy.MaxAgeDays)
+	}
+	if policy.AutoPrune {
+		result += ", pruned automatically"
+	}
+
+	return result
+}
+
+// SetRetention replaces retention policy of local repo, nil policy removes it
+//
+// Age of packages already in the repo is counted from the time policy is set, so
+// complete package list of the repo should be loaded.
+func (repo *LocalRepo) SetRetention(policy *RetentionPolicy) {
+	repo.Retention = policy
+	repo.trackAdded(time.Now())
+}
+
+// trackAdded records time packages were added to the repo, if retention policy limits age of packages
+func (repo *LocalRepo) trackAdded(now time.Time) {
+	if repo.Retention == nil || repo.Retention.MaxAgeDays == 0 || repo.packageRefs == nil {
+		repo.Added = nil
+		return
+	}
+
+	added := make(map[string]time.Time, repo.packageRefs.Len())
+	for _, ref := range repo.packageRefs.Refs {
+		if t, ok := repo.Added[string(ref)]; ok {
+			added[string(ref)] = t
+		} else {
+			added[string(ref)] = now
+		}
+	}
+
+	repo.Added = added
+}
+
+// Prune removes packages which are not retained by retention policy of the repo from the list
+// and returns them, sorted by key
+//
+// Packages which are not in the repo yet are considered to be added at time now.
+func (repo *LocalRepo) Prune(list *PackageList, now time.Time) []*Package {
+	policy := repo.Retention
+	if policy == nil {
+		return nil
+	}
+
+	groups := map[string][]*Package{}
+	list.ForEach(func(p *Package) error {
+		key := p.Name + " " + p.Architecture
+		groups[key] = append(groups[key], p)
+		return nil
+	})
+
+	maxAge := time.Duration(policy.MaxAgeDays) * 24 * time.Hour
+
+	removed := []*Package{}
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool { return CompareVersions(group[i].Version, group[j].Version) > 0 })
+
+		for i, p := range group {
+			if i == 0 || repo.IsHeld(p) {
+				continue
+			}
+
+			expired := policy.KeepVersions > 0 && i >= policy.KeepVersions
+			if policy.MaxAgeDays > 0 {
+				if added, ok := repo.Added[string(p.Key(""))]; ok && now.Sub(added) > maxAge {
+					expired = true
+				}
+			}
+
+			if expired {
+				removed = append(removed, p)
+			}
+		}
+	}
+
+	sort.Slice(removed, func(i, j int) bool { return string(removed[i].Key("")) < string(removed[j].Key("")) })
+
+	for _, p := range removed {
+		list.Remove(p)
+	}
+
+	return removed
+}
+
+// AutoPrune prunes list if retention policy of the repo requires automatic pruning,
+// removed packages are reported
+func (repo *LocalRepo) AutoPrune(list *PackageList, reporter aptly.ResultReporter) {
+	if repo.Retention == nil || !repo.Retention.AutoPrune {
+		return
+	}
+
+	for _, p := range repo.Prune(list, time.Now()) {
+		reporter.Removed("%s removed by retention policy", p)
+	}
+}
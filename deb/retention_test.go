@@ -0,0 +1,121 @@
+package deb
+
+import (
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+
+	. "gopkg.in/check.v1"
+)
+
+type RetentionSuite struct {
+	list *PackageList
+	repo *LocalRepo
+}
+
+var _ = Suite(&RetentionSuite{})
+
+func (s *RetentionSuite) SetUpTest(c *C) {
+	s.list = NewPackageList()
+	for _, version := range []string{"1.0", "1.10", "1.2", "1.9"} {
+		s.list.Add(&Package{Name: "app", Version: version, Architecture: "amd64"})
+	}
+	s.list.Add(&Package{Name: "app", Version: "1.0", Architecture: "i386"})
+	s.list.Add(&Package{Name: "lib", Version: "0.1", Architecture: "amd64"})
+
+	s.repo = NewLocalRepo("nightly", "")
+	s.repo.UpdateRefList(NewPackageRefListFromPackageList(s.list))
+}
+
+func packageKeys(packages []*Package) []string {
+	result := []string{}
+	for _, p := range packages {
+		result = append(result, string(p.Key("")))
+	}
+	return result
+}
+
+func (s *RetentionSuite) TestValidate(c *C) {
+	c.Check((&RetentionPolicy{KeepVersions: 3}).Validate(), IsNil)
+	c.Check((&RetentionPolicy{MaxAgeDays: 30, AutoPrune: true}).Validate(), IsNil)
+	c.Check((&RetentionPolicy{AutoPrune: true}).Validate(), ErrorMatches, "retention policy should limit.*")
+	c.Check((&RetentionPolicy{KeepVersions: -1}).Validate(), ErrorMatches, ".*can't be negative")
+}
+
+func (s *RetentionSuite) TestString(c *C) {
+	c.Check((&RetentionPolicy{KeepVersions: 3}).String(), Equals, "keep 3 versions")
+	c.Check((&RetentionPolicy{KeepVersions: 3, MaxAgeDays: 7, AutoPrune: true}).String(), Equals,
+		"keep 3 versions, max age 7 days, pruned automatically")
+}
+
+func (s *RetentionSuite) TestPruneNoPolicy(c *C) {
+	c.Check(s.repo.Prune(s.list, time.Now()), HasLen, 0)
+	c.Check(s.list.Len(), Equals, 6)
+	c.Check(s.repo.Added, IsNil)
+}
+
+func (s *RetentionSuite) TestPruneKeepVersions(c *C) {
+	s.repo.SetRetention(&RetentionPolicy{KeepVersions: 2})
+	c.Check(s.repo.Added, IsNil)
+
+	removed := s.repo.Prune(s.list, time.Now())
+	c.Check(packageKeys(removed), DeepEquals, []string{"Pamd64 app 1.0", "Pamd64 app 1.2"})
+	c.Check(s.list.Len(), Equals, 4)
+
+	c.Check(s.repo.Prune(s.list, time.Now()), HasLen, 0)
+}
+
+func (s *RetentionSuite) TestPruneHeld(c *C) {
+	s.repo.SetRetention(&RetentionPolicy{KeepVersions: 1})
+	s.repo.Hold(&Package{Name: "app", Version: "1.2", Architecture: "amd64"})
+
+	removed := s.repo.Prune(s.list, time.Now())
+	c.Check(packageKeys(removed), DeepEquals, []string{"Pamd64 app 1.0", "Pamd64 app 1.9"})
+}
+
+func (s *RetentionSuite) TestPruneMaxAge(c *C) {
+	s.repo.SetRetention(&RetentionPolicy{MaxAgeDays: 7})
+	c.Check(s.repo.Added, HasLen, 6)
+
+	now := time.Now()
+	c.Check(s.repo.Prune(s.list, now.AddDate(0, 0, 6)), HasLen, 0)
+
+	// newer build is added later, it's not expired with the old ones
+	s.list.Add(&Package{Name: "app", Version: "1.11", Architecture: "amd64"})
+	s.repo.UpdateRefList(NewPackageRefListFromPackageList(s.list))
+	c.Check(s.repo.Added, HasLen, 7)
+	s.repo.Added["Pamd64 app 1.11"] = now.AddDate(0, 0, 5)
+
+	removed := s.repo.Prune(s.list, now.AddDate(0, 0, 8))
+	c.Check(packageKeys(removed), DeepEquals, []string{"Pamd64 app 1.0", "Pamd64 app 1.10",
+		"Pamd64 app 1.2", "Pamd64 app 1.9"})
+
+	// removed packages are not tracked anymore
+	s.repo.UpdateRefList(NewPackageRefListFromPackageList(s.list))
+	c.Check(s.repo.Added, HasLen, 3)
+
+	s.repo.SetRetention(&RetentionPolicy{KeepVersions: 3})
+	c.Check(s.repo.Added, IsNil)
+}
+
+func (s *RetentionSuite) TestAutoPrune(c *C) {
+	reporter := &aptly.RecordingResultReporter{}
+
+	s.repo.SetRetention(&RetentionPolicy{KeepVersions: 3})
+	s.repo.AutoPrune(s.list, reporter)
+	c.Check(reporter.RemovedLines, HasLen, 0)
+
+	s.repo.Retention.AutoPrune = true
+	s.repo.AutoPrune(s.list, reporter)
+	c.Check(reporter.RemovedLines, DeepEquals, []string{"app_1.0_amd64 removed by retention policy"})
+}
+
+func (s *RetentionSuite) TestEncodeDecode(c *C) {
+	s.repo.SetRetention(&RetentionPolicy{KeepVersions: 3, MaxAgeDays: 7})
+
+	repo := &LocalRepo{}
+	c.Assert(repo.Decode(s.repo.Encode()), IsNil)
+	c.Check(repo.Retention, DeepEquals, s.repo.Retention)
+	// times packages were added are stored along with package list
+	c.Check(repo.Added, IsNil)
+}
@@ -0,0 +1,450 @@
+package deb
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Formats of security tracker data
+const (
+	// SecurityFormatDebian is JSON of Debian security tracker (security-tracker.debian.org/tracker/data/json)
+	SecurityFormatDebian = "debian"
+	// SecurityFormatOVAL is OVAL definitions (as published by Debian or Ubuntu)
+	SecurityFormatOVAL = "oval"
+)
+
+// Vulnerability is a known security issue affecting some package
+type Vulnerability struct {
+	// CVE or other identifier of the issue
+	ID string
+	// Version which fixes the issue, empty if issue is not fixed yet
+	FixedVersion string `codec:",omitempty" json:",omitempty"`
+	// Urgency or severity of the issue
+	Urgency string `codec:",omitempty" json:",omitempty"`
+	// Description of the issue
+	Description string `codec:",omitempty" json:",omitempty"`
+}
+
+// Affects checks whether package version is affected by vulnerability
+func (v *Vulnerability) Affects(version string) bool {
+	return v.FixedVersion == "" || CompareVersions(version, v.FixedVersion) < 0
+}
+
+// SecurityTracker is a set of vulnerabilities imported from security tracker data
+type SecurityTracker struct {
+	// Name of the tracker
+	Name string
+	// Format of imported data
+	Format string
+	// Release (distribution codename) data was imported for
+	Release string `codec:",omitempty"`
+	// Time of import
+	ImportedAt time.Time
+	// Vulnerabilities: package name -> list of vulnerabilities
+	Vulnerabilities map[string][]Vulnerability `codec:"Vulnerabilities" json:"-"`
+}
+
+// NewSecurityTracker creates empty security tracker
+func NewSecurityTracker(name, format, release string) *SecurityTracker {
+	return &SecurityTracker{
+		Name:            name,
+		Format:          format,
+		Release:         release,
+		ImportedAt:      time.Now(),
+		Vulnerabilities: map[string][]Vulnerability{},
+	}
+}
+
+// String returns human-readable representation of the tracker
+func (t *SecurityTracker) String() string {
+	if t.Release != "" {
+		return fmt.Sprintf("[%s]: %s data for %s, imported at %s", t.Name, t.Format, t.Release, t.ImportedAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("[%s]: %s data, imported at %s", t.Name, t.Format, t.ImportedAt.Format(time.RFC3339))
+}
+
+// NumVulnerabilities returns number of imported package vulnerabilities
+func (t *SecurityTracker) NumVulnerabilities() int {
+	result := 0
+	for _, vulnerabilities := range t.Vulnerabilities {
+		result += len(vulnerabilities)
+	}
+	return result
+}
+
+// Add records vulnerability for package name
+func (t *SecurityTracker) Add(name string, v Vulnerability) {
+	t.Vulnerabilities[name] = append(t.Vulnerabilities[name], v)
+}
+
+// Affecting returns vulnerabilities affecting exact version of the package
+//
+// Vulnerabilities are looked up both by source package name (with source version) and,
+// for binary packages, by the package name itself.
+func (t *SecurityTracker) Affecting(p *Package) []Vulnerability {
+	result := []Vulnerability{}
+	seen := map[string]bool{}
+
+	check := func(name, version string) {
+		for _, v := range t.Vulnerabilities[name] {
+			if !seen[v.ID] && v.Affects(version) {
+				seen[v.ID] = true
+				result = append(result, v)
+			}
+		}
+	}
+
+	if p.IsSource {
+		check(p.Name, p.Version)
+	} else {
+		check(p.GetField("$Source"), p.GetField("$SourceVersion"))
+		check(p.Name, p.Version)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result
+}
+
+// Encode does msgpack encoding of SecurityTracker
+func (t *SecurityTracker) Encode() []byte {
+	var buf bytes.Buffer
+
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	encoder.Encode(t)
+
+	return buf.Bytes()
+}
+
+// Decode decodes msgpack representation into SecurityTracker
+func (t *SecurityTracker) Decode(input []byte) error {
+	decoder := codec.NewDecoderBytes(input, &codec.MsgpackHandle{})
+	return decoder.Decode(t)
+}
+
+// Key is a unique id in DB
+func (t *SecurityTracker) Key() []byte {
+	return []byte("V" + t.Name)
+}
+
+// ParseDebianSecurityTracker loads vulnerabilities for release from Debian security tracker JSON
+//
+// Issues which are not affecting the release (fixed version "0") are skipped.
+func (t *SecurityTracker) ParseDebianSecurityTracker(r io.Reader) error {
+	if t.Release == "" {
+		return fmt.Errorf("release is required for %s format", SecurityFormatDebian)
+	}
+
+	var data map[string]map[string]struct {
+		Description string `json:"description"`
+		Releases    map[string]struct {
+			Status       string `json:"status"`
+			FixedVersion string `json:"fixed_version"`
+			Urgency      string `json:"urgency"`
+		} `json:"releases"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return fmt.Errorf("unable to parse security tracker data: %s", err)
+	}
+
+	for source, issues := range data {
+		for id, issue := range issues {
+			release, ok := issue.Releases[t.Release]
+			if !ok || release.Status == "not-affected" || release.FixedVersion == "0" {
+				continue
+			}
+
+			v := Vulnerability{ID: id, Urgency: release.Urgency, Description: issue.Description}
+			if release.Status == "resolved" {
+				v.FixedVersion = release.FixedVersion
+			}
+
+			t.Add(source, v)
+		}
+	}
+
+	return nil
+}
+
+type ovalCriteria struct {
+	Criteria  []ovalCriteria `xml:"criteria"`
+	Criterion []struct {
+		TestRef string `xml:"test_ref,attr"`
+	} `xml:"criterion"`
+}
+
+func (c *ovalCriteria) testRefs() []string {
+	result := []string{}
+	for _, criterion := range c.Criterion {
+		result = append(result, criterion.TestRef)
+	}
+	for i := range c.Criteria {
+		result = append(result, c.Criteria[i].testRefs()...)
+	}
+	return result
+}
+
+type ovalRef struct {
+	ObjectRef string `xml:"object_ref,attr"`
+	StateRef  string `xml:"state_ref,attr"`
+}
+
+// ParseOVAL loads vulnerabilities from OVAL definitions
+//
+// Only dpkginfo tests are supported: package name is taken from the test object, fixed
+// version from "less than" EVR of the test state. Tests without state mark all the
+// versions as affected.
+func (t *SecurityTracker) ParseOVAL(r io.Reader) error {
+	var data struct {
+		Definitions []struct {
+			Class    string `xml:"class,attr"`
+			Metadata struct {
+				Title       string `xml:"title"`
+				Description string `xml:"description"`
+				References  []struct {
+					Source string `xml:"source,attr"`
+					RefID  string `xml:"ref_id,attr"`
+				} `xml:"reference"`
+				Severity string `xml:"advisory>severity"`
+			} `xml:"metadata"`
+			Criteria ovalCriteria `xml:"criteria"`
+		} `xml:"definitions>definition"`
+		Tests struct {
+			Tests []struct {
+				ID     string  `xml:"id,attr"`
+				Object ovalRef `xml:"object"`
+				State  ovalRef `xml:"state"`
+			} `xml:",any"`
+		} `xml:"tests"`
+		Objects struct {
+			Objects []struct {
+				ID   string `xml:"id,attr"`
+				Name struct {
+					Value  string `xml:",chardata"`
+					VarRef string `xml:"var_ref,attr"`
+				} `xml:"name"`
+			} `xml:",any"`
+		} `xml:"objects"`
+		States struct {
+			States []struct {
+				ID  string `xml:"id,attr"`
+				EVR struct {
+					Value     string `xml:",chardata"`
+					Operation string `xml:"operation,attr"`
+				} `xml:"evr"`
+			} `xml:",any"`
+		} `xml:"states"`
+		Variables struct {
+			Variables []struct {
+				ID     string   `xml:"id,attr"`
+				Values []string `xml:"value"`
+			} `xml:",any"`
+		} `xml:"variables"`
+	}
+
+	if err := xml.NewDecoder(r).Decode(&data); err != nil {
+		return fmt.Errorf("unable to parse OVAL data: %s", err)
+	}
+
+	variables := map[string][]string{}
+	for _, variable := range data.Variables.Variables {
+		variables[variable.ID] = variable.Values
+	}
+
+	objects := map[string][]string{}
+	for _, object := range data.Objects.Objects {
+		if object.Name.VarRef != "" {
+			objects[object.ID] = variables[object.Name.VarRef]
+		} else if name := strings.TrimSpace(object.Name.Value); name != "" {
+			objects[object.ID] = []string{name}
+		}
+	}
+
+	states := map[string]string{}
+	for _, state := range data.States.States {
+		if state.EVR.Operation == "less than" {
+			states[state.ID] = strings.TrimPrefix(strings.TrimSpace(state.EVR.Value), "0:")
+		}
+	}
+
+	tests := map[string]ovalRef{}
+	for _, test := range data.Tests.Tests {
+		tests[test.ID] = ovalRef{ObjectRef: test.Object.ObjectRef, StateRef: test.State.StateRef}
+	}
+
+	for _, definition := range data.Definitions {
+		if definition.Class != "" && definition.Class != "vulnerability" && definition.Class != "patch" {
+			continue
+		}
+
+		ids := []string{}
+		for _, ref := range definition.Metadata.References {
+			if ref.Source == "CVE" || ref.Source == "DSA" || ref.Source == "USN" {
+				ids = append(ids, ref.RefID)
+			}
+		}
+		if len(ids) == 0 {
+			ids = append(ids, strings.TrimSpace(definition.Metadata.Title))
+		}
+
+		for _, testRef := range definition.Criteria.testRefs() {
+			test, ok := tests[testRef]
+			if !ok {
+				continue
+			}
+
+			for _, name := range objects[test.ObjectRef] {
+				for _, id := range ids {
+					t.Add(name, Vulnerability{
+						ID:           id,
+						FixedVersion: states[test.StateRef],
+						Urgency:      definition.Metadata.Severity,
+						Description:  strings.TrimSpace(definition.Metadata.Description),
+					})
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Parse loads vulnerabilities from security tracker data in the format of the tracker
+func (t *SecurityTracker) Parse(r io.Reader) error {
+	switch t.Format {
+	case SecurityFormatDebian:
+		return t.ParseDebianSecurityTracker(r)
+	case SecurityFormatOVAL:
+		return t.ParseOVAL(r)
+	}
+
+	return fmt.Errorf("unknown security tracker format %#v, valid formats are: %s, %s", t.Format,
+		SecurityFormatDebian, SecurityFormatOVAL)
+}
+
+// PackageVulnerabilities is a list of vulnerabilities affecting the package
+type PackageVulnerabilities struct {
+	Package         string
+	Vulnerabilities []Vulnerability
+}
+
+// SecurityReport lists packages affected by vulnerabilities known to the tracker
+func SecurityReport(list *PackageList, tracker *SecurityTracker) []PackageVulnerabilities {
+	result := []PackageVulnerabilities{}
+
+	list.ForEach(func(p *Package) error {
+		if vulnerabilities := tracker.Affecting(p); len(vulnerabilities) > 0 {
+			result = append(result, PackageVulnerabilities{Package: p.GetFullName(), Vulnerabilities: vulnerabilities})
+		}
+		return nil
+	})
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Package < result[j].Package })
+
+	return result
+}
+
+// NewSecurityReport loads packages from reflists and builds security report, see SecurityReport
+func NewSecurityReport(reflists []*PackageRefList, collection *PackageCollection, tracker *SecurityTracker) ([]PackageVulnerabilities, error) {
+	result := []PackageVulnerabilities{}
+	seen := map[string]bool{}
+
+	for _, reflist := range reflists {
+		list, err := NewPackageListFromRefList(reflist, collection, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range SecurityReport(list, tracker) {
+			if !seen[item.Package] {
+				seen[item.Package] = true
+				result = append(result, item)
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Package < result[j].Package })
+
+	return result, nil
+}
+
+// SecurityUpdates lists packages added to the mirror by the update which are security updates
+//
+// All new packages are security updates if mirror is a security archive. Otherwise
+// package is a security update if it fixes some vulnerability (known to any of the trackers)
+// which affected previous version of the package in the mirror. Initial download of the
+// mirror (empty previous reflist) never reports security updates.
+func SecurityUpdates(repo *RemoteRepo, previous *PackageRefList, collection *PackageCollection, trackers []*SecurityTracker) ([]string, error) {
+	result := []string{}
+
+	if previous == nil || previous.Len() == 0 || repo.RefList() == nil {
+		return result, nil
+	}
+
+	securityArchive := repo.IsSecurityArchive()
+	if !securityArchive && len(trackers) == 0 {
+		return result, nil
+	}
+
+	// previous versions by "arch name"
+	previousKeys := map[string][]byte{}
+	_ = previous.ForEach(func(key []byte) error {
+		parts := strings.Split(string(key[1:]), " ")
+		if len(parts) == 4 {
+			previousKeys[parts[0]+" "+parts[1]] = key
+		}
+		return nil
+	})
+
+	err := repo.RefList().Subtract(previous).ForEach(func(key []byte) error {
+		p, err := collection.ByKey(key)
+		if err != nil {
+			return err
+		}
+
+		if securityArchive {
+			result = append(result, p.String())
+			return nil
+		}
+
+		previousKey, ok := previousKeys[p.Architecture+" "+p.Name]
+		if !ok {
+			return nil
+		}
+
+		old, err := collection.ByKey(previousKey)
+		if err != nil {
+			return err
+		}
+
+		for _, tracker := range trackers {
+			fixed := map[string]bool{}
+			for _, v := range tracker.Affecting(old) {
+				fixed[v.ID] = true
+			}
+			for _, v := range tracker.Affecting(p) {
+				delete(fixed, v.ID)
+			}
+
+			if len(fixed) > 0 {
+				result = append(result, p.String())
+				break
+			}
+		}
+
+		return nil
+	})
+
+	sort.Strings(result)
+
+	return result, err
+}
@@ -0,0 +1,79 @@
+package deb
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/aptly-dev/aptly/database"
+)
+
+// SecurityTrackerCollection does listing, updating/adding/deleting of SecurityTrackers
+type SecurityTrackerCollection struct {
+	db database.Storage
+}
+
+// NewSecurityTrackerCollection creates new SecurityTrackerCollection and binds it to database
+func NewSecurityTrackerCollection(db database.Storage) *SecurityTrackerCollection {
+	return &SecurityTrackerCollection{
+		db: db,
+	}
+}
+
+// Update adds or replaces security tracker in DB
+func (collection *SecurityTrackerCollection) Update(tracker *SecurityTracker) error {
+	return collection.db.Put(tracker.Key(), tracker.Encode())
+}
+
+// ByName looks up security tracker by name
+func (collection *SecurityTrackerCollection) ByName(name string) (*SecurityTracker, error) {
+	tracker := &SecurityTracker{Name: name}
+
+	encoded, err := collection.db.Get(tracker.Key())
+	if err == database.ErrNotFound {
+		return nil, fmt.Errorf("security tracker with name %s not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tracker.Decode(encoded); err != nil {
+		return nil, err
+	}
+
+	return tracker, nil
+}
+
+// ForEach runs method for each security tracker, sorted by name
+func (collection *SecurityTrackerCollection) ForEach(handler func(*SecurityTracker) error) error {
+	trackers := []*SecurityTracker{}
+
+	err := collection.db.ProcessByPrefix([]byte("V"), func(_, blob []byte) error {
+		t := &SecurityTracker{}
+		if err := t.Decode(blob); err != nil {
+			log.Printf("Error decoding security tracker: %s\n", err)
+			return nil
+		}
+
+		trackers = append(trackers, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(trackers, func(i, j int) bool { return trackers[i].Name < trackers[j].Name })
+
+	for _, t := range trackers {
+		if err = handler(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Drop removes security tracker from DB
+func (collection *SecurityTrackerCollection) Drop(tracker *SecurityTracker) error {
+	return collection.db.Delete(tracker.Key())
+}
@@ -0,0 +1,216 @@
+package deb
+
+import (
+	"strings"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+const debianSecurityTrackerJSON = `{
+  "alien-arena": {
+    "CVE-2020-0001": {
+      "description": "buffer overflow",
+      "releases": {
+        "bookworm": {"status": "resolved", "fixed_version": "7.40-3", "urgency": "high"},
+        "bullseye": {"status": "resolved", "fixed_version": "7.40-1", "urgency": "high"}
+      }
+    },
+    "CVE-2020-0002": {
+      "releases": {
+        "bookworm": {"status": "open", "urgency": "low"}
+      }
+    },
+    "CVE-2020-0003": {
+      "releases": {
+        "bookworm": {"status": "resolved", "fixed_version": "0", "urgency": "unimportant"}
+      }
+    }
+  }
+}`
+
+const ubuntuOVAL = `<?xml version="1.0" encoding="UTF-8"?>
+<oval_definitions xmlns="http://oval.mitre.org/XMLSchema/oval-definitions-5"
+    xmlns:linux="http://oval.mitre.org/XMLSchema/oval-definitions-5#linux">
+  <definitions>
+    <definition class="vulnerability" id="oval:com.ubuntu.jammy:def:1" version="1">
+      <metadata>
+        <title>CVE-2021-0001 on Ubuntu 22.04 LTS (jammy) - medium.</title>
+        <description>use after free</description>
+        <reference source="CVE" ref_id="CVE-2021-0001" ref_url="https://ubuntu.com/security/CVE-2021-0001"/>
+        <advisory><severity>Medium</severity></advisory>
+      </metadata>
+      <criteria operator="AND">
+        <criterion test_ref="oval:com.ubuntu.jammy:tst:0" comment="Ubuntu 22.04 is installed."/>
+        <criteria operator="OR">
+          <criterion test_ref="oval:com.ubuntu.jammy:tst:1" comment="binaries are earlier than 7.40-2ubuntu1"/>
+        </criteria>
+      </criteria>
+    </definition>
+    <definition class="inventory" id="oval:com.ubuntu.jammy:def:100" version="1">
+      <metadata><title>Check that Ubuntu 22.04 LTS (jammy) is installed.</title></metadata>
+      <criteria><criterion test_ref="oval:com.ubuntu.jammy:tst:0"/></criteria>
+    </definition>
+  </definitions>
+  <tests>
+    <ind:textfilecontent54_test xmlns:ind="http://oval.mitre.org/XMLSchema/oval-definitions-5#independent" id="oval:com.ubuntu.jammy:tst:0">
+      <ind:object object_ref="oval:com.ubuntu.jammy:obj:0"/>
+    </ind:textfilecontent54_test>
+    <linux:dpkginfo_test id="oval:com.ubuntu.jammy:tst:1" check="at least one">
+      <linux:object object_ref="oval:com.ubuntu.jammy:obj:1"/>
+      <linux:state state_ref="oval:com.ubuntu.jammy:ste:1"/>
+    </linux:dpkginfo_test>
+  </tests>
+  <objects>
+    <linux:dpkginfo_object id="oval:com.ubuntu.jammy:obj:1" version="1">
+      <linux:name var_ref="oval:com.ubuntu.jammy:var:1" var_check="at least one"/>
+    </linux:dpkginfo_object>
+  </objects>
+  <states>
+    <linux:dpkginfo_state id="oval:com.ubuntu.jammy:ste:1" version="1">
+      <linux:evr datatype="debian_evr_string" operation="less than">0:7.40-2ubuntu1</linux:evr>
+    </linux:dpkginfo_state>
+  </states>
+  <variables>
+    <constant_variable id="oval:com.ubuntu.jammy:var:1" version="1" datatype="string">
+      <value>alien-arena-common</value>
+      <value>alien-arena-server</value>
+    </constant_variable>
+  </variables>
+</oval_definitions>`
+
+type SecuritySuite struct {
+	db database.Storage
+}
+
+var _ = Suite(&SecuritySuite{})
+
+func (s *SecuritySuite) SetUpTest(c *C) {
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+}
+
+func (s *SecuritySuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *SecuritySuite) TestParseDebianSecurityTracker(c *C) {
+	tracker := NewSecurityTracker("debian", SecurityFormatDebian, "bookworm")
+	c.Assert(tracker.Parse(strings.NewReader(debianSecurityTrackerJSON)), IsNil)
+	c.Check(tracker.NumVulnerabilities(), Equals, 2)
+
+	// source alien-arena 7.40-2
+	p := NewPackageFromControlFile(packageStanza.Copy())
+	vulnerabilities := tracker.Affecting(p)
+	c.Assert(vulnerabilities, HasLen, 2)
+	c.Check(vulnerabilities[0].ID, Equals, "CVE-2020-0001")
+	c.Check(vulnerabilities[0].FixedVersion, Equals, "7.40-3")
+	c.Check(vulnerabilities[0].Urgency, Equals, "high")
+	c.Check(vulnerabilities[1].ID, Equals, "CVE-2020-0002")
+	c.Check(vulnerabilities[1].FixedVersion, Equals, "")
+
+	tracker = NewSecurityTracker("debian", SecurityFormatDebian, "bullseye")
+	c.Assert(tracker.Parse(strings.NewReader(debianSecurityTrackerJSON)), IsNil)
+	c.Check(tracker.Affecting(p), HasLen, 0)
+
+	tracker = NewSecurityTracker("debian", SecurityFormatDebian, "")
+	c.Check(tracker.Parse(strings.NewReader(debianSecurityTrackerJSON)), ErrorMatches, "release is required.*")
+
+	tracker = NewSecurityTracker("debian", "nvd", "")
+	c.Check(tracker.Parse(strings.NewReader("")), ErrorMatches, "unknown security tracker format.*")
+}
+
+func (s *SecuritySuite) TestParseOVAL(c *C) {
+	tracker := NewSecurityTracker("jammy", SecurityFormatOVAL, "")
+	c.Assert(tracker.Parse(strings.NewReader(ubuntuOVAL)), IsNil)
+	c.Check(tracker.NumVulnerabilities(), Equals, 2)
+	c.Check(tracker.Vulnerabilities["alien-arena-server"], DeepEquals, []Vulnerability{
+		{ID: "CVE-2021-0001", FixedVersion: "7.40-2ubuntu1", Urgency: "Medium", Description: "use after free"}})
+
+	list := NewPackageList()
+	c.Assert(list.Add(NewPackageFromControlFile(packageStanza.Copy())), IsNil)
+	stanza := packageStanza.Copy()
+	stanza["Version"] = "7.40-2ubuntu1"
+	c.Assert(list.Add(NewPackageFromControlFile(stanza)), IsNil)
+
+	report := SecurityReport(list, tracker)
+	c.Assert(report, HasLen, 1)
+	c.Check(report[0].Package, Equals, "alien-arena-common_7.40-2_i386")
+	c.Check(report[0].Vulnerabilities[0].ID, Equals, "CVE-2021-0001")
+}
+
+func (s *SecuritySuite) TestCollection(c *C) {
+	collection := NewSecurityTrackerCollection(s.db)
+
+	_, err := collection.ByName("debian")
+	c.Check(err, ErrorMatches, "security tracker with name debian not found")
+
+	tracker := NewSecurityTracker("debian", SecurityFormatDebian, "bookworm")
+	c.Assert(tracker.Parse(strings.NewReader(debianSecurityTrackerJSON)), IsNil)
+	c.Assert(collection.Update(tracker), IsNil)
+	c.Assert(collection.Update(NewSecurityTracker("base", SecurityFormatOVAL, "")), IsNil)
+
+	tracker2, err := collection.ByName("debian")
+	c.Assert(err, IsNil)
+	c.Check(tracker2.Release, Equals, "bookworm")
+	c.Check(tracker2.NumVulnerabilities(), Equals, 2)
+
+	names := []string{}
+	c.Check(collection.ForEach(func(t *SecurityTracker) error {
+		names = append(names, t.Name)
+		return nil
+	}), IsNil)
+	c.Check(names, DeepEquals, []string{"base", "debian"})
+
+	c.Assert(collection.Drop(tracker2), IsNil)
+	_, err = collection.ByName("debian")
+	c.Check(err, NotNil)
+}
+
+func (s *SecuritySuite) TestSecurityUpdates(c *C) {
+	collection := NewPackageCollection(s.db)
+
+	tracker := NewSecurityTracker("debian", SecurityFormatDebian, "bookworm")
+	c.Assert(tracker.Parse(strings.NewReader(debianSecurityTrackerJSON)), IsNil)
+
+	oldPackage := NewPackageFromControlFile(packageStanza.Copy())
+	stanza := packageStanza.Copy()
+	stanza["Version"] = "7.40-3"
+	fixedPackage := NewPackageFromControlFile(stanza)
+	stanza = packageStanza.Copy()
+	stanza["Package"] = "alien-arena-data"
+	stanza["Source"] = "alien-arena-data"
+	newPackage := NewPackageFromControlFile(stanza)
+
+	previousList := NewPackageList()
+	currentList := NewPackageList()
+	for _, p := range []*Package{oldPackage, fixedPackage, newPackage} {
+		c.Assert(collection.Update(p), IsNil)
+	}
+	c.Assert(previousList.Add(oldPackage), IsNil)
+	c.Assert(currentList.Add(fixedPackage), IsNil)
+	c.Assert(currentList.Add(newPackage), IsNil)
+	previous := NewPackageRefListFromPackageList(previousList)
+
+	repo, _ := NewRemoteRepo("bookworm", "http://deb.debian.org/debian", "bookworm", []string{"main"}, []string{}, false, false, false)
+	repo.packageRefs = NewPackageRefListFromPackageList(currentList)
+
+	updates, err := SecurityUpdates(repo, previous, collection, []*SecurityTracker{tracker})
+	c.Assert(err, IsNil)
+	c.Check(updates, DeepEquals, []string{"alien-arena-common_7.40-3_i386"})
+
+	updates, err = SecurityUpdates(repo, previous, collection, nil)
+	c.Assert(err, IsNil)
+	c.Check(updates, HasLen, 0)
+
+	updates, err = SecurityUpdates(repo, NewPackageRefList(), collection, []*SecurityTracker{tracker})
+	c.Assert(err, IsNil)
+	c.Check(updates, HasLen, 0)
+
+	repo.Distribution = "bookworm-security"
+	c.Check(repo.IsSecurityArchive(), Equals, true)
+	updates, err = SecurityUpdates(repo, previous, collection, nil)
+	c.Assert(err, IsNil)
+	c.Check(updates, DeepEquals, []string{"alien-arena-common_7.40-3_i386", "alien-arena-data_7.40-2_i386"})
+}
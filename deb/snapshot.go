@@ -120,6 +120,25 @@ func (s *Snapshot) RefList() *PackageRefList {
 	return s.packageRefs
 }
 
+// FilterSources drops source packages from snapshot according to handling modes, see FilterSources
+func (s *Snapshot) FilterSources(collection *PackageCollection, extraSourceOnly, orphaned string) ([]*Package, error) {
+	list, err := NewPackageListFromRefList(s.packageRefs, collection, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dropped, err := FilterSources(list, extraSourceOnly, orphaned)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dropped) > 0 {
+		s.packageRefs = NewPackageRefListFromPackageList(list)
+	}
+
+	return dropped, nil
+}
+
 // Key is a unique id in DB
 func (s *Snapshot) Key() []byte {
 	return []byte("S" + s.UUID)
@@ -0,0 +1,176 @@
+package deb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+)
+
+// RebaseConflict is a change between original base and derived snapshot which
+// doesn't apply cleanly to new base, as new base changed the same package
+type RebaseConflict struct {
+	// Package in original base, nil if package was added in derived snapshot
+	Base *Package
+	// Package in derived snapshot, nil if package was removed in derived snapshot
+	Derived *Package
+	// Packages with the same name and architecture in new base
+	NewBase []*Package
+}
+
+// Check interface
+var (
+	_ json.Marshaler = RebaseConflict{}
+)
+
+// String returns human-readable description of the conflict
+func (c RebaseConflict) String() string {
+	newBase := make([]string, len(c.NewBase))
+	for i, p := range c.NewBase {
+		newBase[i] = p.String()
+	}
+
+	inNewBase := "missing in new base"
+	if len(newBase) > 0 {
+		inNewBase = "new base has " + strings.Join(newBase, ", ")
+	}
+
+	switch {
+	case c.Base == nil:
+		return fmt.Sprintf("%s added, %s", c.Derived, inNewBase)
+	case c.Derived == nil:
+		return fmt.Sprintf("%s removed, %s", c.Base, inNewBase)
+	default:
+		return fmt.Sprintf("%s replaced with %s, %s", c.Base, c.Derived, inNewBase)
+	}
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (c RebaseConflict) MarshalJSON() ([]byte, error) {
+	serialized := struct {
+		Base, Derived *string
+		NewBase       []string
+	}{
+		NewBase: make([]string, len(c.NewBase)),
+	}
+
+	if c.Base != nil {
+		key := string(c.Base.Key(""))
+		serialized.Base = &key
+	}
+	if c.Derived != nil {
+		key := string(c.Derived.Key(""))
+		serialized.Derived = &key
+	}
+	for i, p := range c.NewBase {
+		serialized.NewBase[i] = string(p.Key(""))
+	}
+
+	return json.Marshal(serialized)
+}
+
+// Rebase re-applies changes which distinguish derived reflist from its original base
+// on top of new base, returning resulting reflist
+//
+// Change applies cleanly if new base still has package as it was in original base (or
+// already has package as it is in derived reflist). Otherwise change is a conflict: it's
+// applied anyway (replacing packages with the same name and architecture in new base),
+// unless preferBase is set, in which case new base is kept as is.
+func Rebase(derived, base, newBase *PackageRefList, packageCollection *PackageCollection, preferBase bool,
+	progress aptly.Progress) (result *PackageRefList, applied PackageDiffs, conflicts []RebaseConflict, err error) {
+	changes, err := base.Diff(derived, packageCollection)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to calculate changes: %s", err)
+	}
+
+	list, err := NewPackageListFromRefList(newBase, packageCollection, progress)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to load packages: %s", err)
+	}
+
+	// packages of new base by name and architecture
+	index := map[string][]*Package{}
+	_ = list.ForEach(func(p *Package) error {
+		index[p.Name+"_"+p.Architecture] = append(index[p.Name+"_"+p.Architecture], p)
+		return nil
+	})
+
+	remove := func(p *Package) {
+		list.Remove(p)
+
+		key := p.Name + "_" + p.Architecture
+		packages := index[key][:0]
+		for _, other := range index[key] {
+			if !other.Equals(p) {
+				packages = append(packages, other)
+			}
+		}
+		index[key] = packages
+	}
+
+	add := func(p *Package) error {
+		index[p.Name+"_"+p.Architecture] = append(index[p.Name+"_"+p.Architecture], p)
+		return list.Add(p)
+	}
+
+	has := func(packages []*Package, p *Package) bool {
+		for _, other := range packages {
+			if other.Equals(p) {
+				return true
+			}
+		}
+		return false
+	}
+
+	applied = PackageDiffs{}
+
+	for _, change := range changes {
+		pkg := change.Left
+		if pkg == nil {
+			pkg = change.Right
+		}
+		current := append([]*Package(nil), index[pkg.Name+"_"+pkg.Architecture]...)
+
+		switch {
+		case change.Right != nil && has(current, change.Right):
+			// new base already has the change
+			if change.Left != nil && has(current, change.Left) {
+				remove(change.Left)
+			}
+			continue
+		case change.Left == nil && len(current) == 0,
+			change.Left != nil && has(current, change.Left):
+			if change.Left != nil {
+				remove(change.Left)
+			}
+			if change.Right != nil {
+				if err = add(change.Right); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+			applied = append(applied, change)
+			continue
+		case change.Left != nil && change.Right == nil && len(current) == 0:
+			// package removed in derived was removed in new base as well
+			continue
+		}
+
+		conflicts = append(conflicts, RebaseConflict{Base: change.Left, Derived: change.Right, NewBase: current})
+
+		if preferBase {
+			continue
+		}
+
+		for _, p := range current {
+			remove(p)
+		}
+		if change.Right != nil {
+			if err = add(change.Right); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	return NewPackageRefListFromPackageList(list), applied, conflicts, nil
+}
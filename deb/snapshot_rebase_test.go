@@ -0,0 +1,75 @@
+package deb
+
+import (
+	"encoding/json"
+
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+type RebaseSuite struct{}
+
+var _ = Suite(&RebaseSuite{})
+
+func (s *RebaseSuite) TestRebase(c *C) {
+	db, _ := goleveldb.NewOpenDB(c.MkDir())
+	coll := NewPackageCollection(db)
+
+	packages := []*Package{
+		{Name: "lib", Version: "1.0", Architecture: "i386"},      //0
+		{Name: "lib", Version: "1.1", Architecture: "i386"},      //1
+		{Name: "app", Version: "2.0", Architecture: "i386"},      //2
+		{Name: "app", Version: "2.0+fix1", Architecture: "i386"}, //3
+		{Name: "app", Version: "2.1", Architecture: "i386"},      //4
+		{Name: "tool", Version: "1.0", Architecture: "i386"},     //5
+		{Name: "extra", Version: "0.1", Architecture: "all"},     //6
+		{Name: "dpkg", Version: "1.7", Architecture: "i386"},     //7
+		{Name: "dpkg", Version: "1.8", Architecture: "i386"},     //8
+		{Name: "gone", Version: "1.0", Architecture: "i386"},     //9
+	}
+
+	for _, p := range packages {
+		coll.Update(p)
+	}
+
+	reflist := func(idx ...int) *PackageRefList {
+		list := NewPackageList()
+		for _, i := range idx {
+			list.Add(packages[i])
+		}
+		return NewPackageRefListFromPackageList(list)
+	}
+
+	// derived snapshot patched app, added extra, removed tool and dpkg
+	base := reflist(0, 2, 5, 7, 9)
+	derived := reflist(0, 3, 6, 9)
+
+	// nothing changed upstream: rebase reproduces derived snapshot
+	result, applied, conflicts, err := Rebase(derived, base, base, coll, false, nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Strings(), DeepEquals, derived.Strings())
+	c.Check(applied, HasLen, 4)
+	c.Check(conflicts, HasLen, 0)
+
+	// upstream updated lib, app and dpkg, removed gone
+	newBase := reflist(1, 4, 5, 8)
+
+	result, applied, conflicts, err = Rebase(derived, base, newBase, coll, false, nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Strings(), DeepEquals, reflist(1, 3, 6).Strings())
+	c.Check(applied, HasLen, 2)
+	c.Assert(conflicts, HasLen, 2)
+	c.Check(conflicts[0].String(), Equals, "app_2.0_i386 replaced with app_2.0+fix1_i386, new base has app_2.1_i386")
+	c.Check(conflicts[1].String(), Equals, "dpkg_1.7_i386 removed, new base has dpkg_1.8_i386")
+
+	encoded, err := json.Marshal(conflicts[1])
+	c.Assert(err, IsNil)
+	c.Check(string(encoded), Equals, `{"Base":"Pi386 dpkg 1.7","Derived":null,"NewBase":["Pi386 dpkg 1.8"]}`)
+
+	// new base wins conflicts
+	result, _, conflicts, err = Rebase(derived, base, newBase, coll, true, nil)
+	c.Assert(err, IsNil)
+	c.Check(result.Strings(), DeepEquals, reflist(1, 4, 6, 8).Strings())
+	c.Check(conflicts, HasLen, 2)
+}
@@ -0,0 +1,102 @@
+package deb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Modes of handling Extra-Source-Only and orphaned source packages
+const (
+	// SourceHandlingKeep keeps source packages (default)
+	SourceHandlingKeep = "keep"
+	// SourceHandlingDrop drops source packages
+	SourceHandlingDrop = "drop"
+	// SourceHandlingKeepReferenced keeps only source packages which binary packages are built
+	// from or which are referenced via Built-Using
+	SourceHandlingKeepReferenced = "keep-referenced-only"
+)
+
+// ValidateSourceHandling checks that source handling mode is known, empty mode is the same
+// as SourceHandlingKeep
+func ValidateSourceHandling(mode string) error {
+	switch mode {
+	case "", SourceHandlingKeep, SourceHandlingDrop, SourceHandlingKeepReferenced:
+		return nil
+	}
+
+	return fmt.Errorf("unknown source handling mode %#v, valid modes are: %s, %s, %s", mode,
+		SourceHandlingKeep, SourceHandlingDrop, SourceHandlingKeepReferenced)
+}
+
+// FilterSources removes source packages from the list according to handling modes
+//
+// Mode extraSourceOnly applies to source packages with Extra-Source-Only: yes, mode orphaned
+// applies to other source packages which have no binary packages built from them in the list.
+// Source packages which are dropped are returned.
+func FilterSources(list *PackageList, extraSourceOnly, orphaned string) ([]*Package, error) {
+	if err := ValidateSourceHandling(extraSourceOnly); err != nil {
+		return nil, err
+	}
+	if err := ValidateSourceHandling(orphaned); err != nil {
+		return nil, err
+	}
+
+	keep := func(mode string) bool { return mode == "" || mode == SourceHandlingKeep }
+	if keep(extraSourceOnly) && keep(orphaned) {
+		return nil, nil
+	}
+
+	// "name version" of source packages binaries are built from
+	builtFrom := map[string]bool{}
+	// "name version" of source packages referenced via Built-Using
+	builtUsing := map[string]bool{}
+
+	list.ForEach(func(p *Package) error {
+		if p.IsSource {
+			return nil
+		}
+
+		builtFrom[p.GetField("$Source")+" "+p.GetField("$SourceVersion")] = true
+
+		for _, ref := range strings.Split(p.GetField("Built-Using"), ",") {
+			dep, err := ParseDependency(strings.TrimSpace(ref))
+			if err != nil || dep.Pkg == "" {
+				continue
+			}
+			builtUsing[dep.Pkg+" "+dep.Version] = true
+		}
+
+		return nil
+	})
+
+	var dropped []*Package
+
+	list.ForEach(func(p *Package) error {
+		if !p.IsSource {
+			return nil
+		}
+
+		key := p.Name + " " + p.Version
+
+		var mode string
+		if strings.EqualFold(strings.TrimSpace(p.GetField("Extra-Source-Only")), "yes") {
+			mode = extraSourceOnly
+		} else if !builtFrom[key] {
+			mode = orphaned
+		} else {
+			return nil
+		}
+
+		if mode == SourceHandlingDrop || mode == SourceHandlingKeepReferenced && !builtFrom[key] && !builtUsing[key] {
+			dropped = append(dropped, p)
+		}
+
+		return nil
+	})
+
+	for _, p := range dropped {
+		list.Remove(p)
+	}
+
+	return dropped, nil
+}
@@ -0,0 +1,82 @@
+package deb
+
+import (
+	"sort"
+
+	. "gopkg.in/check.v1"
+)
+
+type SourceFilterSuite struct {
+	list *PackageList
+}
+
+var _ = Suite(&SourceFilterSuite{})
+
+func (s *SourceFilterSuite) newSource(c *C, name, version string, extraSourceOnly bool) *Package {
+	stanza := Stanza{"Package": name, "Version": version, "Architecture": "any"}
+	if extraSourceOnly {
+		stanza["Extra-Source-Only"] = "yes"
+	}
+	p, err := NewSourcePackageFromControlFile(stanza)
+	c.Assert(err, IsNil)
+	return p
+}
+
+func (s *SourceFilterSuite) SetUpTest(c *C) {
+	s.list = NewPackageList()
+
+	// binary alien-arena-common is built from alien-arena 7.40-2 using libfoo 1.0
+	stanza := packageStanza.Copy()
+	stanza["Built-Using"] = "libfoo (= 1.0), libbar (= 2.0)"
+	c.Assert(s.list.Add(NewPackageFromControlFile(stanza)), IsNil)
+
+	c.Assert(s.list.Add(s.newSource(c, "alien-arena", "7.40-2", false)), IsNil)
+	c.Assert(s.list.Add(s.newSource(c, "orphan", "1.0", false)), IsNil)
+	c.Assert(s.list.Add(s.newSource(c, "libfoo", "1.0", true)), IsNil)
+	c.Assert(s.list.Add(s.newSource(c, "libbaz", "1.0", true)), IsNil)
+}
+
+func (s *SourceFilterSuite) names() []string {
+	names := []string{}
+	s.list.ForEach(func(p *Package) error {
+		if p.IsSource {
+			names = append(names, p.Name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names
+}
+
+func (s *SourceFilterSuite) TestValidate(c *C) {
+	c.Check(ValidateSourceHandling(""), IsNil)
+	c.Check(ValidateSourceHandling(SourceHandlingKeepReferenced), IsNil)
+	c.Check(ValidateSourceHandling("remove"), ErrorMatches, "unknown source handling mode.*")
+
+	_, err := FilterSources(s.list, "remove", "")
+	c.Check(err, ErrorMatches, "unknown source handling mode.*")
+}
+
+func (s *SourceFilterSuite) TestKeep(c *C) {
+	dropped, err := FilterSources(s.list, SourceHandlingKeep, "")
+	c.Assert(err, IsNil)
+	c.Check(dropped, HasLen, 0)
+	c.Check(s.list.Len(), Equals, 5)
+}
+
+func (s *SourceFilterSuite) TestDrop(c *C) {
+	dropped, err := FilterSources(s.list, SourceHandlingDrop, SourceHandlingDrop)
+	c.Assert(err, IsNil)
+	c.Check(dropped, HasLen, 3)
+	c.Check(s.names(), DeepEquals, []string{"alien-arena"})
+}
+
+func (s *SourceFilterSuite) TestKeepReferenced(c *C) {
+	_, err := FilterSources(s.list, SourceHandlingKeepReferenced, "")
+	c.Assert(err, IsNil)
+	c.Check(s.names(), DeepEquals, []string{"alien-arena", "libfoo", "orphan"})
+
+	_, err = FilterSources(s.list, "", SourceHandlingKeepReferenced)
+	c.Assert(err, IsNil)
+	c.Check(s.names(), DeepEquals, []string{"alien-arena", "libfoo"})
+}
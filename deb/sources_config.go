@@ -0,0 +1,106 @@
+package deb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClientSourcesConfig is APT client configuration for published repository
+type ClientSourcesConfig struct {
+	// Name of configuration, used for file names on client
+	Name string `json:"Name"`
+	// deb822 configuration, to be installed as /etc/apt/sources.list.d/<name>.sources
+	Sources string `json:"Sources"`
+	// One-line configuration, to be installed as /etc/apt/sources.list.d/<name>.list
+	List string `json:"List"`
+	// Path of public key referenced by one-line configuration
+	KeyPath string `json:"KeyPath,omitempty"`
+	// Public key in ASCII armor, inlined into deb822 configuration
+	Key string `json:"Key,omitempty"`
+}
+
+// ClientConfig builds APT client configuration for published repository served at baseURL (URL
+// of the root of published storage), key is public key Release files are signed with (optional)
+func (p *PublishedRepo) ClientConfig(baseURL, name string, key []byte) *ClientSourcesConfig {
+	uri := strings.TrimSuffix(baseURL, "/")
+	if p.Prefix != "." {
+		uri += "/" + p.Prefix
+	}
+
+	types := []string{}
+	architectures := []string{}
+	for _, arch := range p.Architectures {
+		if arch == ArchitectureSource {
+			continue
+		}
+		architectures = append(architectures, arch)
+	}
+	if len(architectures) > 0 || len(p.Architectures) == 0 {
+		types = append(types, "deb")
+	}
+	if len(architectures) < len(p.Architectures) {
+		types = append(types, "deb-src")
+	}
+
+	// flat repository is referenced by exact path ending with slash, without components
+	suite, components := p.Distribution, strings.Join(p.Components(), " ")
+	if p.Flat {
+		suite, components = "./", ""
+	}
+
+	result := &ClientSourcesConfig{Name: name}
+
+	var sources strings.Builder
+	fmt.Fprintf(&sources, "Types: %s\n", strings.Join(types, " "))
+	fmt.Fprintf(&sources, "URIs: %s\n", uri)
+	fmt.Fprintf(&sources, "Suites: %s\n", suite)
+	if components != "" {
+		fmt.Fprintf(&sources, "Components: %s\n", components)
+	}
+	if len(architectures) > 0 {
+		fmt.Fprintf(&sources, "Architectures: %s\n", strings.Join(architectures, " "))
+	}
+
+	options := []string{}
+	if len(architectures) > 0 {
+		options = append(options, "arch="+strings.Join(architectures, ","))
+	}
+
+	if len(key) > 0 {
+		result.Key = string(key)
+		result.KeyPath = fmt.Sprintf("/etc/apt/keyrings/%s.asc", name)
+
+		// multi-line field: continuation lines are indented, empty lines are replaced with "."
+		sources.WriteString("Signed-By:\n")
+		for _, line := range strings.Split(strings.TrimRight(result.Key, "\n"), "\n") {
+			if strings.TrimSpace(line) == "" {
+				line = "."
+			}
+			fmt.Fprintf(&sources, " %s\n", line)
+		}
+
+		options = append(options, "signed-by="+result.KeyPath)
+	}
+	result.Sources = sources.String()
+
+	var list strings.Builder
+	for _, typ := range types {
+		typeOptions := options
+		if typ == "deb-src" && len(architectures) > 0 {
+			typeOptions = options[1:]
+		}
+
+		line := []string{typ}
+		if len(typeOptions) > 0 {
+			line = append(line, "["+strings.Join(typeOptions, " ")+"]")
+		}
+		line = append(line, uri, suite)
+		if components != "" {
+			line = append(line, components)
+		}
+		fmt.Fprintf(&list, "%s\n", strings.Join(line, " "))
+	}
+	result.List = list.String()
+
+	return result
+}
@@ -0,0 +1,45 @@
+package deb
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *PublishedRepoSuite) TestClientConfig(c *C) {
+	s.repo3.Architectures = []string{"amd64", "i386", "source"}
+
+	config := s.repo3.ClientConfig("https://apt.example.com/", "linux", []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmQGi\n-----END PGP PUBLIC KEY BLOCK-----\n"))
+	c.Check(config.Sources, Equals, "Types: deb deb-src\n"+
+		"URIs: https://apt.example.com/linux\n"+
+		"Suites: natty\n"+
+		"Components: contrib main\n"+
+		"Architectures: amd64 i386\n"+
+		"Signed-By:\n"+
+		" -----BEGIN PGP PUBLIC KEY BLOCK-----\n"+
+		" .\n"+
+		" mQGi\n"+
+		" -----END PGP PUBLIC KEY BLOCK-----\n")
+	c.Check(config.List, Equals, "deb [arch=amd64,i386 signed-by=/etc/apt/keyrings/linux.asc] https://apt.example.com/linux natty contrib main\n"+
+		"deb-src [signed-by=/etc/apt/keyrings/linux.asc] https://apt.example.com/linux natty contrib main\n")
+	c.Check(config.KeyPath, Equals, "/etc/apt/keyrings/linux.asc")
+
+	s.repo4.Prefix = "."
+	config = s.repo4.ClientConfig("http://localhost:8080/repos/-", "maverick", nil)
+	c.Check(config.Sources, Equals, "Types: deb-src\n"+
+		"URIs: http://localhost:8080/repos/-\n"+
+		"Suites: maverick\n"+
+		"Components: main\n")
+	c.Check(config.List, Equals, "deb-src http://localhost:8080/repos/- maverick main\n")
+	c.Check(config.Key, Equals, "")
+}
+
+func (s *PublishedRepoSuite) TestClientConfigFlat(c *C) {
+	s.repo.Flat = true
+	s.repo.Architectures = []string{"i386"}
+
+	config := s.repo.ClientConfig("https://apt.example.com", "ppa", nil)
+	c.Check(config.Sources, Equals, "Types: deb\n"+
+		"URIs: https://apt.example.com/ppa\n"+
+		"Suites: ./\n"+
+		"Architectures: i386\n")
+	c.Check(config.List, Equals, "deb [arch=i386] https://apt.example.com/ppa ./\n")
+}
@@ -0,0 +1,78 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/task"
+	"github.com/ugorji/go/codec"
+)
+
+// TaskRecordCollection persists metadata of API tasks, implementing task.Store
+type TaskRecordCollection struct {
+	db database.Storage
+}
+
+// Check interface
+var (
+	_ task.Store = (*TaskRecordCollection)(nil)
+)
+
+// NewTaskRecordCollection creates new TaskRecordCollection and binds it to database
+func NewTaskRecordCollection(db database.Storage) *TaskRecordCollection {
+	return &TaskRecordCollection{
+		db: db,
+	}
+}
+
+// taskRecordKey is a unique id of task record in DB, ids are padded so that records are sorted by id
+func taskRecordKey(ID int) []byte {
+	return []byte(fmt.Sprintf("K%010d", ID))
+}
+
+// Put stores record of the task, replacing previous one
+func (collection *TaskRecordCollection) Put(record *task.Record) error {
+	var buf bytes.Buffer
+
+	encoder := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	if err := encoder.Encode(record); err != nil {
+		return err
+	}
+
+	return collection.db.Put(taskRecordKey(record.ID), buf.Bytes())
+}
+
+// Delete removes record of the task, it's not an error if there is no such record
+func (collection *TaskRecordCollection) Delete(ID int) error {
+	return collection.db.Delete(taskRecordKey(ID))
+}
+
+// ForEach runs method for each record
+func (collection *TaskRecordCollection) ForEach(handler func(*task.Record) error) error {
+	records := []*task.Record{}
+
+	err := collection.db.ProcessByPrefix([]byte("K"), func(_, blob []byte) error {
+		record := &task.Record{}
+		decoder := codec.NewDecoderBytes(blob, &codec.MsgpackHandle{})
+		if err := decoder.Decode(record); err != nil {
+			log.Printf("Error decoding task record: %s\n", err)
+			return nil
+		}
+
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if err = handler(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package deb
+
+import (
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+	"github.com/aptly-dev/aptly/task"
+
+	. "gopkg.in/check.v1"
+)
+
+type TaskRecordCollectionSuite struct {
+	db         database.Storage
+	collection *TaskRecordCollection
+}
+
+var _ = Suite(&TaskRecordCollectionSuite{})
+
+func (s *TaskRecordCollectionSuite) SetUpTest(c *C) {
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.collection = NewTaskRecordCollection(s.db)
+}
+
+func (s *TaskRecordCollectionSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *TaskRecordCollectionSuite) TestPutForEachDelete(c *C) {
+	c.Assert(s.collection.Put(&task.Record{ID: 10, Name: "Publish", State: task.RUNNING, Resources: []string{"U1"}}), IsNil)
+	c.Assert(s.collection.Put(&task.Record{ID: 9, Name: "Update", State: task.IDLE, Priority: 5}), IsNil)
+	c.Assert(s.collection.Put(&task.Record{ID: 10, Name: "Publish", State: task.FAILED, Error: "cancelled"}), IsNil)
+
+	var records []*task.Record
+	c.Assert(s.collection.ForEach(func(record *task.Record) error {
+		records = append(records, record)
+		return nil
+	}), IsNil)
+
+	// records are sorted by id
+	c.Assert(records, HasLen, 2)
+	c.Check(records[0].ID, Equals, 9)
+	c.Check(records[0].Priority, Equals, 5)
+	c.Check(records[1].State, Equals, task.FAILED)
+	c.Check(records[1].Error, Equals, "cancelled")
+
+	c.Assert(s.collection.Delete(9), IsNil)
+	c.Assert(s.collection.Delete(100), IsNil)
+
+	records = nil
+	s.collection.ForEach(func(record *task.Record) error {
+		records = append(records, record)
+		return nil
+	})
+	c.Check(records, HasLen, 1)
+}
@@ -0,0 +1,95 @@
+package deb
+
+import (
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// NamespaceUsage calculates total size of package files referenced by local repos, mirrors
+// and snapshots in namespace, each file is counted once
+func NamespaceUsage(collectionFactory *CollectionFactory, namespace string) (int64, error) {
+	var refLists []*PackageRefList
+
+	err := collectionFactory.LocalRepoCollection().ForEach(func(repo *LocalRepo) error {
+		if !utils.InNamespace(namespace, repo.Name) {
+			return nil
+		}
+
+		if err := collectionFactory.LocalRepoCollection().LoadComplete(repo); err != nil {
+			return err
+		}
+		refLists = append(refLists, repo.RefList())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = collectionFactory.RemoteRepoCollection().ForEach(func(repo *RemoteRepo) error {
+		if !utils.InNamespace(namespace, repo.Name) {
+			return nil
+		}
+
+		if err := collectionFactory.RemoteRepoCollection().LoadComplete(repo); err != nil {
+			return err
+		}
+		refLists = append(refLists, repo.RefList())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = collectionFactory.SnapshotCollection().ForEach(func(snapshot *Snapshot) error {
+		if !utils.InNamespace(namespace, snapshot.Name) {
+			return nil
+		}
+
+		if err := collectionFactory.SnapshotCollection().LoadComplete(snapshot); err != nil {
+			return err
+		}
+		refLists = append(refLists, snapshot.RefList())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var usage int64
+	seenPackages := make(map[string]struct{})
+	seenFiles := make(map[string]struct{})
+
+	for _, refList := range refLists {
+		if refList == nil {
+			continue
+		}
+
+		err = refList.ForEach(func(key []byte) error {
+			if _, found := seenPackages[string(key)]; found {
+				return nil
+			}
+			seenPackages[string(key)] = struct{}{}
+
+			pkg, err := collectionFactory.PackageCollection().ByKey(key)
+			if err != nil {
+				return err
+			}
+
+			for _, f := range pkg.Files() {
+				fileKey := f.Filename + "/" + f.Checksums.MD5
+				if _, found := seenFiles[fileKey]; found {
+					continue
+				}
+				seenFiles[fileKey] = struct{}{}
+
+				usage += f.Checksums.Size
+			}
+
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,59 @@
+package deb
+
+import (
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+type NamespaceUsageSuite struct {
+	PackageListMixinSuite
+	db      database.Storage
+	factory *CollectionFactory
+}
+
+var _ = Suite(&NamespaceUsageSuite{})
+
+func (s *NamespaceUsageSuite) SetUpTest(c *C) {
+	s.SetUpPackages()
+
+	s.db, _ = goleveldb.NewOpenDB(c.MkDir())
+	s.factory = NewCollectionFactory(s.db)
+
+	for _, p := range []*Package{s.p1, s.p2, s.p3} {
+		c.Assert(s.factory.PackageCollection().Update(p), IsNil)
+	}
+}
+
+func (s *NamespaceUsageSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *NamespaceUsageSuite) TestNamespaceUsage(c *C) {
+	usage, err := NamespaceUsage(s.factory, "team")
+	c.Assert(err, IsNil)
+	c.Check(usage, Equals, int64(0))
+
+	list := NewPackageList()
+	c.Assert(list.Add(s.p1), IsNil)
+
+	repo := NewLocalRepo("team/main", "")
+	repo.UpdateRefList(NewPackageRefListFromPackageList(list))
+	c.Assert(s.factory.LocalRepoCollection().Add(repo), IsNil)
+
+	other := NewLocalRepo("other/main", "")
+	other.UpdateRefList(s.reflist)
+	c.Assert(s.factory.LocalRepoCollection().Add(other), IsNil)
+
+	usage, err = NamespaceUsage(s.factory, "team")
+	c.Assert(err, IsNil)
+	c.Check(usage, Equals, s.p1.Files()[0].Checksums.Size)
+
+	// packages referenced by several resources are counted once
+	c.Assert(s.factory.SnapshotCollection().Add(NewSnapshotFromRefList("team/snap", nil, s.reflist, "")), IsNil)
+
+	usage, err = NamespaceUsage(s.factory, "team")
+	c.Assert(err, IsNil)
+	c.Check(usage, Equals, s.p1.Files()[0].Checksums.Size+s.p2.Files()[0].Checksums.Size+s.p3.Files()[0].Checksums.Size)
+}
@@ -0,0 +1,259 @@
+package deb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/pgp"
+)
+
+// Signature states of published repository
+const (
+	SignatureGood    = "good"
+	SignatureBad     = "bad"
+	SignatureMissing = "missing"
+	SignatureSkipped = "skipped"
+)
+
+// Kinds of problems found while verifying published repository
+const (
+	VerifyProblemMissing   = "missing"
+	VerifyProblemChecksum  = "checksum"
+	VerifyProblemSignature = "signature"
+	VerifyProblemIndex     = "index"
+)
+
+// VerifyProblem is a single problem found while verifying published repository
+type VerifyProblem struct {
+	// Kind of problem: missing, checksum, signature or index
+	Kind string `json:"Kind"`
+	// Path of file relative to publishing prefix
+	Path string `json:"Path"`
+	// Description of the problem
+	Problem string `json:"Problem"`
+}
+
+// VerifyReport is health report of published repository
+type VerifyReport struct {
+	Storage      string `json:"Storage"`
+	Prefix       string `json:"Prefix"`
+	Distribution string `json:"Distribution"`
+	// Published repository is intact: signature is good (or skipped), all checked files match
+	Healthy bool `json:"Healthy"`
+	// State of Release signature: good, bad, missing or skipped
+	Signature string `json:"Signature"`
+	// Number of index files listed in Release file which were checked
+	IndexFiles int `json:"IndexFiles"`
+	// Number of package files in pool referenced by indexes
+	PoolFiles int `json:"PoolFiles"`
+	// Number of package files in pool which were checked
+	PoolFilesChecked int `json:"PoolFilesChecked"`
+	// Problems found
+	Problems []VerifyProblem `json:"Problems"`
+}
+
+func (report *VerifyReport) problem(kind, path, format string, args ...interface{}) {
+	report.Problems = append(report.Problems, VerifyProblem{Kind: kind, Path: path, Problem: fmt.Sprintf(format, args...)})
+}
+
+// verifyEntry is file with expected checksum and size
+type verifyEntry struct {
+	path   string
+	sha256 string
+	size   int64
+}
+
+// parseChecksumLines parses lines "<checksum> <size> <name>" of Release and Sources files
+func parseChecksumLines(value, dir string) []verifyEntry {
+	var result []verifyEntry
+
+	for _, line := range strings.Split(value, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		result = append(result, verifyEntry{path: filepath.Join(dir, fields[2]), sha256: fields[0], size: size})
+	}
+
+	return result
+}
+
+// poolEntries finds package files referenced by Packages or Sources index
+func poolEntries(index []byte) ([]verifyEntry, error) {
+	var result []verifyEntry
+
+	reader := NewControlFileReader(bytes.NewReader(index), false, false)
+	for {
+		stanza, err := reader.ReadStanza()
+		if err != nil {
+			return nil, err
+		}
+		if stanza == nil {
+			break
+		}
+
+		if stanza["Filename"] != "" {
+			size, _ := strconv.ParseInt(stanza["Size"], 10, 64)
+			result = append(result, verifyEntry{path: stanza["Filename"], sha256: stanza["SHA256"], size: size})
+		} else if stanza["Directory"] != "" {
+			result = append(result, parseChecksumLines(stanza["Checksums-Sha256"], stanza["Directory"])...)
+		}
+	}
+
+	return result, nil
+}
+
+// verifyFile checks that file in published storage has expected size and checksum
+func verifyFile(storage aptly.ReadablePublishedStorage, prefix string, entry verifyEntry, report *VerifyReport) []byte {
+	contents, err := storage.ReadFile(filepath.Join(prefix, entry.path))
+	if err != nil {
+		report.problem(VerifyProblemMissing, entry.path, "unable to read file: %s", err)
+		return nil
+	}
+
+	if int64(len(contents)) != entry.size {
+		report.problem(VerifyProblemChecksum, entry.path, "size mismatch: expected %d, got %d", entry.size, len(contents))
+		return nil
+	}
+
+	if entry.sha256 != "" {
+		if actual := fmt.Sprintf("%x", sha256.Sum256(contents)); actual != entry.sha256 {
+			report.problem(VerifyProblemChecksum, entry.path, "SHA256 mismatch: expected %s, got %s", entry.sha256, actual)
+			return nil
+		}
+	}
+
+	return contents
+}
+
+// verifySignature checks InRelease and Release.gpg signatures, if verifier is nil check is skipped
+func verifySignature(storage aptly.ReadablePublishedStorage, p *PublishedRepo, release []byte, verifier pgp.Verifier, report *VerifyReport) {
+	if verifier == nil {
+		report.Signature = SignatureSkipped
+		return
+	}
+
+	distDir := filepath.Join(p.Prefix, p.releaseDir())
+	inRelease, inReleaseErr := storage.ReadFile(filepath.Join(distDir, "InRelease"))
+	releaseSig, releaseSigErr := storage.ReadFile(filepath.Join(distDir, "Release.gpg"))
+
+	if inReleaseErr != nil && releaseSigErr != nil {
+		report.Signature = SignatureMissing
+		report.problem(VerifyProblemSignature, filepath.Join(p.releaseDir(), "Release"), "Release file is not signed")
+		return
+	}
+
+	report.Signature = SignatureGood
+
+	if inReleaseErr == nil {
+		if _, err := verifier.VerifyClearsigned(bytes.NewReader(inRelease), false); err != nil {
+			report.Signature = SignatureBad
+			report.problem(VerifyProblemSignature, filepath.Join(p.releaseDir(), "InRelease"), "signature verification failed: %s", err)
+		}
+	}
+
+	if releaseSigErr == nil {
+		if err := verifier.VerifyDetachedSignature(bytes.NewReader(releaseSig), bytes.NewReader(release), false); err != nil {
+			report.Signature = SignatureBad
+			report.problem(VerifyProblemSignature, filepath.Join(p.releaseDir(), "Release.gpg"), "signature verification failed: %s", err)
+		}
+	}
+}
+
+// Verify reads published Release file, verifies its signature and checksums of all index files
+// listed in it.
+//
+// Package files in pool referenced by indexes are checked if poolSample is not zero:
+// negative poolSample checks all files, positive one checks random sample of that size.
+func (p *PublishedRepo) Verify(publishedStorageProvider aptly.PublishedStorageProvider, verifier pgp.Verifier, poolSample int) (*VerifyReport, error) {
+	storage, ok := publishedStorageProvider.GetPublishedStorage(p.Storage).(aptly.ReadablePublishedStorage)
+	if !ok {
+		return nil, fmt.Errorf("published storage %s doesn't support reading files", p.Storage)
+	}
+
+	report := &VerifyReport{
+		Storage:      p.Storage,
+		Prefix:       p.Prefix,
+		Distribution: p.Distribution,
+		Problems:     []VerifyProblem{},
+	}
+
+	releasePath := filepath.Join(p.releaseDir(), "Release")
+	release, err := storage.ReadFile(filepath.Join(p.Prefix, releasePath))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Release file: %s", err)
+	}
+
+	verifySignature(storage, p, release, verifier, report)
+
+	stanza, err := NewControlFileReader(bytes.NewReader(release), true, false).ReadStanza()
+	if err != nil || stanza == nil {
+		report.problem(VerifyProblemIndex, releasePath, "unable to parse Release file: %v", err)
+		return report, nil
+	}
+
+	indexes := parseChecksumLines(stanza["SHA256"], p.releaseDir())
+	if len(indexes) == 0 {
+		report.problem(VerifyProblemIndex, releasePath, "no SHA256 checksums in Release file")
+	}
+
+	var pool []verifyEntry
+	seen := map[string]struct{}{}
+
+	for _, entry := range indexes {
+		report.IndexFiles++
+
+		contents := verifyFile(storage, p.Prefix, entry, report)
+		if contents == nil || poolSample == 0 {
+			continue
+		}
+
+		base := filepath.Base(entry.path)
+		if base != "Packages" && base != "Sources" {
+			continue
+		}
+
+		entries, err := poolEntries(contents)
+		if err != nil {
+			report.problem(VerifyProblemIndex, entry.path, "unable to parse index: %s", err)
+			continue
+		}
+
+		for _, poolEntry := range entries {
+			if _, found := seen[poolEntry.path]; !found {
+				seen[poolEntry.path] = struct{}{}
+				pool = append(pool, poolEntry)
+			}
+		}
+	}
+
+	report.PoolFiles = len(pool)
+
+	if poolSample > 0 && poolSample < len(pool) {
+		rand.Shuffle(len(pool), func(i, j int) { pool[i], pool[j] = pool[j], pool[i] })
+		pool = pool[:poolSample]
+		sort.Slice(pool, func(i, j int) bool { return pool[i].path < pool[j].path })
+	}
+
+	for _, entry := range pool {
+		report.PoolFilesChecked++
+		verifyFile(storage, p.Prefix, entry, report)
+	}
+
+	report.Healthy = len(report.Problems) == 0
+
+	return report, nil
+}
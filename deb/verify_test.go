@@ -0,0 +1,41 @@
+package deb
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *PublishedRepoSuite) TestVerify(c *C) {
+	c.Assert(s.repo.Publish(s.packagePool, s.provider, s.factory, nil, nil, false, ""), IsNil)
+
+	report, err := s.repo.Verify(s.provider, nil, 0)
+	c.Assert(err, IsNil)
+	c.Check(report.Healthy, Equals, true)
+	c.Check(report.Signature, Equals, SignatureSkipped)
+	c.Check(report.IndexFiles > 0, Equals, true)
+	c.Check(report.PoolFilesChecked, Equals, 0)
+
+	report, err = s.repo.Verify(s.provider, nil, -1)
+	c.Assert(err, IsNil)
+	c.Check(report.PoolFiles, Equals, 1)
+	c.Check(report.PoolFilesChecked, Equals, 1)
+	c.Check(report.Problems, DeepEquals, []VerifyProblem{})
+
+	packages := filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/main/binary-i386/Packages")
+	c.Assert(os.WriteFile(packages, []byte("tampered\n"), 0644), IsNil)
+
+	report, err = s.repo.Verify(s.provider, nil, 0)
+	c.Assert(err, IsNil)
+	c.Check(report.Healthy, Equals, false)
+	c.Check(report.Problems, HasLen, 1)
+	c.Check(report.Problems[0].Kind, Equals, VerifyProblemChecksum)
+	c.Check(report.Problems[0].Path, Equals, "dists/squeeze/main/binary-i386/Packages")
+	c.Check(report.Problems[0].Problem, Matches, "size mismatch.*")
+
+	c.Assert(os.Remove(filepath.Join(s.publishedStorage.PublicPath(), "ppa/dists/squeeze/Release")), IsNil)
+
+	_, err = s.repo.Verify(s.provider, nil, 0)
+	c.Check(err, ErrorMatches, "unable to read Release file.*")
+}
@@ -30,7 +30,18 @@ func (st *MockChecksumStorage) Update(path string, c *utils.ChecksumInfo) error
 	return nil
 }
 
+func (st *MockChecksumStorage) PathBySHA256(sha256 string) (string, error) {
+	for path, c := range st.Store {
+		if c.SHA256 == sha256 {
+			return path, nil
+		}
+	}
+
+	return "", nil
+}
+
 // Check interface
 var (
 	_ aptly.ChecksumStorage = &MockChecksumStorage{}
+	_ aptly.ChecksumIndex   = &MockChecksumStorage{}
 )
@@ -254,6 +254,11 @@ func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
 	result := []string{}
 	resultLock := &sync.Mutex{}
 
+	// list target of symbolic link (e.g. distribution published blue/green)
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+
 	err := walker.Walk(root, func(path string, info os.FileInfo) error {
 		if !info.IsDir() {
 			resultLock.Lock()
@@ -282,6 +287,49 @@ func (storage *PublishedStorage) SymLink(src string, dst string) error {
 	return os.Symlink(filepath.Join(storage.rootPath, src), filepath.Join(storage.rootPath, dst))
 }
 
+// SwapDir atomically replaces path with relative symbolic link to directory target
+//
+// If path is a directory (and not a link), it is moved away and removed afterwards,
+// so the path is briefly missing when switching over for the first time.
+func (storage *PublishedStorage) SwapDir(target, path string) error {
+	fullPath := filepath.Join(storage.rootPath, path)
+
+	relTarget, err := filepath.Rel(filepath.Dir(fullPath), filepath.Join(storage.rootPath, target))
+	if err != nil {
+		return err
+	}
+
+	var oldDir string
+	if info, err := os.Lstat(fullPath); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		oldDir = fullPath + ".old"
+		if err = os.RemoveAll(oldDir); err != nil {
+			return err
+		}
+		if err = os.Rename(fullPath, oldDir); err != nil {
+			return err
+		}
+	}
+
+	tempLink := fullPath + ".swap"
+	if err = os.Remove(tempLink); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err = os.Symlink(relTarget, tempLink); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tempLink, fullPath); err != nil {
+		return err
+	}
+
+	if oldDir != "" {
+		return os.RemoveAll(oldDir)
+	}
+
+	return nil
+}
+
 // HardLink creates a hardlink of a file
 func (storage *PublishedStorage) HardLink(src string, dst string) error {
 	return os.Link(filepath.Join(storage.rootPath, src), filepath.Join(storage.rootPath, dst))
@@ -296,6 +344,11 @@ func (storage *PublishedStorage) FileExists(path string) (bool, error) {
 	return true, nil
 }
 
+// ReadFile returns contents of file under public path
+func (storage *PublishedStorage) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(storage.rootPath, path))
+}
+
 // ReadLink returns the symbolic link pointed to by path (relative to storage
 // root)
 func (storage *PublishedStorage) ReadLink(path string) (string, error) {
@@ -89,6 +89,16 @@ func (s *PublishedStorageSuite) TestFilelist(c *C) {
 	c.Check(list, DeepEquals, []string{})
 }
 
+func (s *PublishedStorageSuite) TestFilelistSymLink(c *C) {
+	c.Assert(s.storage.MkDir("ppa/dists/.generations/squeeze/1/main"), IsNil)
+	c.Assert(s.storage.PutFile("ppa/dists/.generations/squeeze/1/main/Packages", "/dev/null"), IsNil)
+	c.Assert(os.Symlink(".generations/squeeze/1", filepath.Join(s.storage.rootPath, "ppa/dists/squeeze")), IsNil)
+
+	list, err := s.storage.Filelist("ppa/dists/squeeze")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"main/Packages"})
+}
+
 func (s *PublishedStorageSuite) TestRenameFile(c *C) {
 	err := s.storage.MkDir("ppa/dists/squeeze/")
 	c.Assert(err, IsNil)
@@ -117,6 +127,18 @@ func (s *PublishedStorageSuite) TestFileExists(c *C) {
 	c.Check(exists, Equals, true)
 }
 
+func (s *PublishedStorageSuite) TestReadFile(c *C) {
+	c.Assert(s.storage.MkDir("ppa/dists/squeeze/"), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(s.storage.rootPath, "ppa/dists/squeeze/Release"), []byte("Origin: ppa\n"), 0644), IsNil)
+
+	data, err := s.storage.ReadFile("ppa/dists/squeeze/Release")
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "Origin: ppa\n")
+
+	_, err = s.storage.ReadFile("ppa/dists/squeeze/InRelease")
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
 func (s *PublishedStorageSuite) TestSymLink(c *C) {
 	err := s.storage.MkDir("ppa/dists/squeeze/")
 	c.Assert(err, IsNil)
@@ -0,0 +1,2 @@
+// Package gs handles publishing to Google Cloud Storage
+package gs
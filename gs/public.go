@@ -0,0 +1,361 @@
+package gs
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// PublishedStorage abstract file system with published files (actually hosted on GCS)
+type PublishedStorage struct {
+	client        *gcs.Client
+	bucket        *gcs.BucketHandle
+	bucketName    string
+	prefix        string
+	predefinedACL string
+
+	// pathCacheLock protects pathCache, as files might be uploaded concurrently
+	pathCacheLock sync.Mutex
+	pathCache     map[string]map[string]string
+}
+
+// Check interface
+var (
+	_ aptly.PublishedStorage         = (*PublishedStorage)(nil)
+	_ aptly.ReadablePublishedStorage = (*PublishedStorage)(nil)
+)
+
+// predefinedACLs maps ACL settings (named the same way as for S3) to GCS predefined ACLs
+var predefinedACLs = map[string]string{
+	"":                   "",
+	"none":               "",
+	"private":            "private",
+	"public-read":        "publicRead",
+	"project-private":    "projectPrivate",
+	"bucket-owner-read":  "bucketOwnerRead",
+	"bucket-owner-full":  "bucketOwnerFullControl",
+	"authenticated-read": "authenticatedRead",
+}
+
+// NewPublishedStorageRaw creates published storage using existing GCS client
+func NewPublishedStorageRaw(client *gcs.Client, bucket, prefix, acl string) (*PublishedStorage, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("GCS bucket not specified")
+	}
+
+	predefinedACL, ok := predefinedACLs[acl]
+	if !ok {
+		return nil, fmt.Errorf("unsupported GCS ACL %q", acl)
+	}
+
+	return &PublishedStorage{
+		client:        client,
+		bucket:        client.Bucket(bucket),
+		bucketName:    bucket,
+		prefix:        prefix,
+		predefinedACL: predefinedACL,
+	}, nil
+}
+
+// NewPublishedStorage creates published storage in GCS bucket
+//
+// If credentialsFile (service account key in JSON format) is not set, application default
+// credentials are used. Endpoint overrides GCS JSON API endpoint (e.g. for emulators).
+func NewPublishedStorage(bucket, prefix, acl, credentialsFile, endpoint string) (*PublishedStorage, error) {
+	var opts []option.ClientOption
+
+	if credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
+	}
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+
+	client, err := gcs.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCS client: %s", err)
+	}
+
+	return NewPublishedStorageRaw(client, bucket, prefix, acl)
+}
+
+// String
+func (storage *PublishedStorage) String() string {
+	return fmt.Sprintf("GCS: %s/%s", storage.bucketName, storage.prefix)
+}
+
+// objectName returns name of object for path under public path
+func (storage *PublishedStorage) objectName(p string) string {
+	name := path.Join(storage.prefix, filepath.ToSlash(p))
+	if name == "." {
+		return ""
+	}
+
+	return name
+}
+
+// MkDir creates directory recursively under public path
+func (storage *PublishedStorage) MkDir(_ string) error {
+	// no op for GCS
+	return nil
+}
+
+// PutFile puts file into published storage at specified path
+func (storage *PublishedStorage) PutFile(path string, sourceFilename string) error {
+	sourceMD5, err := utils.MD5ChecksumForFile(sourceFilename)
+	if err != nil {
+		return err
+	}
+
+	source, err := os.Open(sourceFilename)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	err = storage.putFile(path, source, sourceMD5)
+	if err != nil {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s", sourceFilename, storage))
+	}
+
+	return err
+}
+
+// putFile uploads file-like object to path, GCS verifies upload against MD5 if it's set
+func (storage *PublishedStorage) putFile(path string, source io.Reader, sourceMD5 string) error {
+	w := storage.bucket.Object(storage.objectName(path)).NewWriter(context.TODO())
+	w.PredefinedACL = storage.predefinedACL
+	if filepath.Base(path) == "index.html" {
+		w.ContentType = "text/html; charset=utf-8"
+	}
+
+	if sourceMD5 != "" {
+		md5, err := hex.DecodeString(sourceMD5)
+		if err != nil {
+			return err
+		}
+		w.MD5 = md5
+	}
+
+	if _, err := io.Copy(w, source); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// Remove removes single file under public path
+func (storage *PublishedStorage) Remove(path string) error {
+	err := storage.bucket.Object(storage.objectName(path)).Delete(context.TODO())
+	if err != nil && !errors.Is(err, gcs.ErrObjectNotExist) {
+		return errors.Wrap(err, fmt.Sprintf("error deleting %s from %s", path, storage))
+	}
+
+	return nil
+}
+
+// RemoveDirs removes directory structure under public path
+func (storage *PublishedStorage) RemoveDirs(path string, _ aptly.Progress) error {
+	filelist, err := storage.Filelist(path)
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range filelist {
+		err = storage.Remove(filepath.Join(path, filename))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LinkFromPool links package file from pool to dist's pool location
+//
+// publishedPrefix is desired prefix for the location in the pool.
+// publishedRelPath is desired location in pool (like pool/component/liba/libav/)
+// sourcePool is instance of aptly.PackagePool
+// sourcePath is filepath to package file in package pool
+//
+// LinkFromPool returns relative path for the published file to be included in package index
+func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+
+	relFilePath := filepath.Join(publishedRelPath, fileName)
+	relPath := filepath.Join(publishedPrefix, relFilePath)
+	poolPath := storage.objectName(relPath)
+
+	storage.pathCacheLock.Lock()
+	if storage.pathCache == nil {
+		storage.pathCache = make(map[string]map[string]string)
+	}
+	pathCache := storage.pathCache[publishedPrefix]
+	if pathCache == nil {
+		paths, md5s, err := storage.internalFilelist(publishedPrefix)
+		if err != nil {
+			storage.pathCacheLock.Unlock()
+			return fmt.Errorf("error caching paths under prefix: %s", err)
+		}
+
+		pathCache = make(map[string]string, len(paths))
+
+		for i := range paths {
+			pathCache[paths[i]] = md5s[i]
+		}
+		storage.pathCache[publishedPrefix] = pathCache
+	}
+
+	destinationMD5, exists := pathCache[relFilePath]
+	storage.pathCacheLock.Unlock()
+	sourceMD5 := sourceChecksums.MD5
+
+	if exists {
+		if sourceMD5 == "" {
+			return fmt.Errorf("unable to compare object, MD5 checksum missing")
+		}
+
+		if destinationMD5 == sourceMD5 {
+			return nil
+		}
+
+		if !force {
+			return fmt.Errorf("error putting file to %s: file already exists and is different: %s", poolPath, storage)
+		}
+	}
+
+	source, err := sourcePool.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	err = storage.putFile(relPath, source, sourceMD5)
+	if err == nil {
+		storage.pathCacheLock.Lock()
+		pathCache[relFilePath] = sourceMD5
+		storage.pathCacheLock.Unlock()
+	} else {
+		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s: %s", sourcePath, storage, poolPath))
+	}
+
+	return err
+}
+
+// Filelist returns list of files under prefix
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	paths, _, err := storage.internalFilelist(prefix)
+	return paths, err
+}
+
+// internalFilelist returns paths (relative to prefix) and MD5 checksums of objects under prefix
+func (storage *PublishedStorage) internalFilelist(prefix string) (paths []string, md5s []string, err error) {
+	paths = make([]string, 0, 1024)
+	md5s = make([]string, 0, 1024)
+
+	prefix = storage.objectName(prefix)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	it := storage.bucket.Objects(context.TODO(), &gcs.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error listing under prefix %s in %s: %s", prefix, storage, err)
+		}
+
+		paths = append(paths, strings.TrimPrefix(attrs.Name, prefix))
+		md5s = append(md5s, hex.EncodeToString(attrs.MD5))
+	}
+
+	return paths, md5s, nil
+}
+
+// copyObject copies object src to dst with metadata, removing src if move is set
+func (storage *PublishedStorage) copyObject(src, dst string, metadata map[string]string, move bool) error {
+	srcObject := storage.bucket.Object(storage.objectName(src))
+
+	copier := storage.bucket.Object(storage.objectName(dst)).CopierFrom(srcObject)
+	copier.PredefinedACL = storage.predefinedACL
+	copier.Metadata = metadata
+
+	if _, err := copier.Run(context.TODO()); err != nil {
+		return fmt.Errorf("error copying %s -> %s in %s: %s", src, dst, storage, err)
+	}
+
+	if move {
+		if err := srcObject.Delete(context.TODO()); err != nil {
+			return fmt.Errorf("error deleting %s in %s: %s", src, storage, err)
+		}
+	}
+
+	return nil
+}
+
+// RenameFile renames (moves) file
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	return storage.copyObject(oldName, newName, nil, true)
+}
+
+// SymLink creates a copy of src file and adds link information as meta data
+func (storage *PublishedStorage) SymLink(src string, dst string) error {
+	return storage.copyObject(src, dst, map[string]string{"SymLink": src}, false)
+}
+
+// HardLink using symlink functionality as hard links do not exist
+func (storage *PublishedStorage) HardLink(src string, dst string) error {
+	return storage.SymLink(src, dst)
+}
+
+// FileExists returns true if path exists
+func (storage *PublishedStorage) FileExists(path string) (bool, error) {
+	_, err := storage.bucket.Object(storage.objectName(path)).Attrs(context.TODO())
+	if err != nil {
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReadFile returns contents of file under public path
+func (storage *PublishedStorage) ReadFile(path string) ([]byte, error) {
+	r, err := storage.bucket.Object(storage.objectName(path)).NewReader(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// ReadLink returns the symbolic link pointed to by path.
+// This simply reads metadata of object created with SymLink
+func (storage *PublishedStorage) ReadLink(path string) (string, error) {
+	attrs, err := storage.bucket.Object(storage.objectName(path)).Attrs(context.TODO())
+	if err != nil {
+		return "", err
+	}
+
+	return attrs.Metadata["SymLink"], nil
+}
@@ -0,0 +1,201 @@
+package gs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+type PublishedStorageSuite struct {
+	fake                     *fakeGCS
+	storage, prefixedStorage *PublishedStorage
+}
+
+var _ = Suite(&PublishedStorageSuite{})
+
+func (s *PublishedStorageSuite) newStorage(c *C, prefix, acl string) *PublishedStorage {
+	client, err := gcs.NewClient(context.Background(), option.WithEndpoint(s.fake.URL+"/storage/v1/"), option.WithoutAuthentication())
+	c.Assert(err, IsNil)
+
+	storage, err := NewPublishedStorageRaw(client, "repo", prefix, acl)
+	c.Assert(err, IsNil)
+
+	return storage
+}
+
+func (s *PublishedStorageSuite) SetUpTest(c *C) {
+	s.fake = newFakeGCS("repo")
+
+	s.storage = s.newStorage(c, "", "")
+	s.prefixedStorage = s.newStorage(c, "lala", "public-read")
+}
+
+func (s *PublishedStorageSuite) TearDownTest(c *C) {
+	s.fake.Close()
+}
+
+func (s *PublishedStorageSuite) putFile(c *C, storage *PublishedStorage, path, contents string) {
+	tmp := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(tmp, []byte(contents), 0644), IsNil)
+	c.Assert(storage.PutFile(path, tmp), IsNil)
+}
+
+func (s *PublishedStorageSuite) contents(name string) []byte {
+	object, ok := s.fake.objects[name]
+	if !ok {
+		return nil
+	}
+	return object.data
+}
+
+func (s *PublishedStorageSuite) TestNewPublishedStorage(c *C) {
+	_, err := NewPublishedStorageRaw(s.storage.client, "", "", "")
+	c.Check(err, ErrorMatches, "GCS bucket not specified")
+
+	_, err = NewPublishedStorageRaw(s.storage.client, "repo", "", "public-write")
+	c.Check(err, ErrorMatches, "unsupported GCS ACL \"public-write\"")
+
+	c.Check(s.prefixedStorage.String(), Equals, "GCS: repo/lala")
+}
+
+func (s *PublishedStorageSuite) TestPutFile(c *C) {
+	s.putFile(c, s.storage, "a/b.txt", "welcome to gcs!")
+	c.Check(s.contents("a/b.txt"), DeepEquals, []byte("welcome to gcs!"))
+	c.Check(s.fake.objects["a/b.txt"].predefinedACL, Equals, "")
+
+	s.putFile(c, s.prefixedStorage, "a/b.txt", "welcome to gcs!")
+	c.Check(s.contents("lala/a/b.txt"), DeepEquals, []byte("welcome to gcs!"))
+	c.Check(s.fake.objects["lala/a/b.txt"].predefinedACL, Equals, "publicRead")
+
+	data, err := s.prefixedStorage.ReadFile("a/b.txt")
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, []byte("welcome to gcs!"))
+}
+
+func (s *PublishedStorageSuite) TestFilelist(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.putFile(c, s.storage, path, "test")
+	}
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "test/a", "test/b", "testa"})
+
+	list, err = s.storage.Filelist("test")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b"})
+
+	list, err = s.prefixedStorage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *PublishedStorageSuite) TestRemove(c *C) {
+	s.putFile(c, s.storage, "a/b", "test")
+
+	c.Check(s.storage.Remove("a/b"), IsNil)
+	c.Check(s.fake.objects, HasLen, 0)
+
+	c.Check(s.storage.Remove("a/missing"), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestRemoveDirs(c *C) {
+	paths := []string{"a", "b", "c", "testa", "test/a", "test/b", "lala/a", "lala/b", "lala/c"}
+	for _, path := range paths {
+		s.putFile(c, s.storage, path, "test")
+	}
+
+	c.Check(s.storage.RemoveDirs("test", nil), IsNil)
+
+	list, err := s.storage.Filelist("")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"a", "b", "c", "lala/a", "lala/b", "lala/c", "testa"})
+}
+
+func (s *PublishedStorageSuite) TestRenameFile(c *C) {
+	s.putFile(c, s.prefixedStorage, "dists/stable/Release.tmp", "release")
+
+	c.Check(s.prefixedStorage.RenameFile("dists/stable/Release.tmp", "dists/stable/Release"), IsNil)
+
+	list, _ := s.storage.Filelist("")
+	c.Check(list, DeepEquals, []string{"lala/dists/stable/Release"})
+	c.Check(s.contents("lala/dists/stable/Release"), DeepEquals, []byte("release"))
+	c.Check(s.fake.objects["lala/dists/stable/Release"].predefinedACL, Equals, "publicRead")
+
+	c.Check(s.storage.RenameFile("dists/stable/Missing", "dists/stable/Release"), ErrorMatches, "error copying dists/stable/Missing -> dists/stable/Release in GCS: repo/: .*")
+}
+
+func (s *PublishedStorageSuite) TestSymLink(c *C) {
+	s.putFile(c, s.storage, "a/b", "test")
+
+	c.Check(s.storage.SymLink("a/b", "a/b.link"), IsNil)
+
+	link, err := s.storage.ReadLink("a/b.link")
+	c.Check(err, IsNil)
+	c.Check(link, Equals, "a/b")
+	c.Check(s.contents("a/b.link"), DeepEquals, []byte("test"))
+
+	exists, err := s.storage.FileExists("a/b.link")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+
+	exists, err = s.storage.FileExists("a/b.lin")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile1 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err := os.WriteFile(tmpFile1, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum1 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	tmpFile2 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err = os.WriteFile(tmpFile2, []byte("Spam"), 0644)
+	c.Assert(err, IsNil)
+	cksum2 := utils.ChecksumInfo{MD5: "e9dfd31cc505d51fc26975250750deab"}
+
+	src1, err := pool.Import(tmpFile1, "mars-invaders_1.03.deb", &cksum1, true, cs)
+	c.Assert(err, IsNil)
+	src2, err := pool.Import(tmpFile2, "mars-invaders_1.03.deb", &cksum2, true, cs)
+	c.Assert(err, IsNil)
+
+	// first link from pool
+	err = s.storage.LinkFromPool(".", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+	c.Check(s.contents("pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Contents"))
+
+	// duplicate link from pool
+	err = s.storage.LinkFromPool(".", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+
+	// link from pool with conflict
+	err = s.storage.LinkFromPool(".", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, false)
+	c.Check(err, ErrorMatches, ".*file already exists and is different.*")
+
+	// link from pool with conflict and force
+	err = s.storage.LinkFromPool(".", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, true)
+	c.Check(err, IsNil)
+	c.Check(s.contents("pool/main/m/mars-invaders/mars-invaders_1.03.deb"), DeepEquals, []byte("Spam"))
+
+	// existing files are picked up by new storage, MD5 is verified by GCS
+	storage := s.newStorage(c, "", "")
+	err = storage.LinkFromPool(".", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, false)
+	c.Check(err, IsNil)
+
+	err = storage.LinkFromPool("ppa", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum1, false)
+	c.Check(err, ErrorMatches, "error uploading .* to GCS: repo/: ppa/pool/main/m/mars-invaders/mars-invaders_1.03.deb: .*MD5.*")
+}
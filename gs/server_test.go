@@ -0,0 +1,194 @@
+package gs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fakeObject is object stored in fakeGCS
+type fakeObject struct {
+	data          []byte
+	metadata      map[string]string
+	predefinedACL string
+}
+
+// fakeGCS is minimal in-memory implementation of GCS JSON (and XML for reads) API
+// for single bucket
+type fakeGCS struct {
+	*httptest.Server
+
+	bucket string
+
+	lock    sync.Mutex
+	objects map[string]*fakeObject
+}
+
+func newFakeGCS(bucket string) *fakeGCS {
+	f := &fakeGCS{bucket: bucket, objects: map[string]*fakeObject{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeGCS) resource(name string, object *fakeObject) map[string]interface{} {
+	sum := md5.Sum(object.data)
+
+	return map[string]interface{}{
+		"kind":     "storage#object",
+		"bucket":   f.bucket,
+		"name":     name,
+		"size":     fmt.Sprintf("%d", len(object.data)),
+		"md5Hash":  base64.StdEncoding.EncodeToString(sum[:]),
+		"metadata": object.metadata,
+	}
+}
+
+func (f *fakeGCS) reply(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func (f *fakeGCS) fail(w http.ResponseWriter, code int, message string) {
+	f.reply(w, code, map[string]interface{}{"error": map[string]interface{}{"code": code, "message": message}})
+}
+
+func (f *fakeGCS) handle(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i := range parts {
+		parts[i], _ = url.PathUnescape(parts[i])
+	}
+
+	switch {
+	case len(parts) >= 6 && parts[0] == "upload" && parts[4] == f.bucket && r.Method == "POST":
+		f.upload(w, r)
+	case len(parts) >= 4 && parts[0] == "storage" && parts[3] == f.bucket:
+		f.api(w, r, parts[4:])
+	case len(parts) == 2 && parts[0] == f.bucket && r.Method == "GET":
+		object, ok := f.objects[parts[1]]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(object.data)))
+		w.Write(object.data)
+	default:
+		f.fail(w, http.StatusBadRequest, "unsupported request "+r.Method+" "+r.URL.String())
+	}
+}
+
+func (f *fakeGCS) api(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		prefix := r.URL.Query().Get("prefix")
+		names := []string{}
+		for name := range f.objects {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		items := []interface{}{}
+		for _, name := range names {
+			items = append(items, f.resource(name, f.objects[name]))
+		}
+		f.reply(w, http.StatusOK, map[string]interface{}{"kind": "storage#objects", "items": items})
+	case len(parts) == 2 && r.Method == "GET":
+		object, ok := f.objects[parts[1]]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "No such object")
+			return
+		}
+		f.reply(w, http.StatusOK, f.resource(parts[1], object))
+	case len(parts) == 2 && r.Method == "DELETE":
+		if _, ok := f.objects[parts[1]]; !ok {
+			f.fail(w, http.StatusNotFound, "No such object")
+			return
+		}
+		delete(f.objects, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 7 && parts[2] == "rewriteTo" && r.Method == "POST":
+		source, ok := f.objects[parts[1]]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "No such object")
+			return
+		}
+
+		var attrs struct {
+			Metadata map[string]string `json:"metadata"`
+		}
+		json.NewDecoder(r.Body).Decode(&attrs)
+
+		object := &fakeObject{data: source.data, metadata: attrs.Metadata, predefinedACL: r.URL.Query().Get("destinationPredefinedAcl")}
+		f.objects[parts[6]] = object
+		f.reply(w, http.StatusOK, map[string]interface{}{
+			"kind":                "storage#rewriteResponse",
+			"totalBytesRewritten": fmt.Sprintf("%d", len(object.data)),
+			"objectSize":          fmt.Sprintf("%d", len(object.data)),
+			"done":                true,
+			"resource":            f.resource(parts[6], object),
+		})
+	default:
+		f.fail(w, http.StatusBadRequest, "unsupported request "+r.Method+" "+r.URL.String())
+	}
+}
+
+func (f *fakeGCS) upload(w http.ResponseWriter, r *http.Request) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || r.URL.Query().Get("uploadType") != "multipart" {
+		f.fail(w, http.StatusBadRequest, "multipart upload expected")
+		return
+	}
+
+	reader := multipart.NewReader(r.Body, params["boundary"])
+
+	part, err := reader.NextPart()
+	if err != nil {
+		f.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var attrs struct {
+		Name        string            `json:"name"`
+		MD5Hash     string            `json:"md5Hash"`
+		Metadata    map[string]string `json:"metadata"`
+		ContentType string            `json:"contentType"`
+	}
+	if err = json.NewDecoder(part).Decode(&attrs); err != nil {
+		f.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	part, err = reader.NextPart()
+	if err != nil {
+		f.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data := &bytes.Buffer{}
+	io.Copy(data, part)
+
+	object := &fakeObject{data: data.Bytes(), metadata: attrs.Metadata, predefinedACL: r.URL.Query().Get("predefinedAcl")}
+	if attrs.MD5Hash != "" && f.resource(attrs.Name, object)["md5Hash"] != attrs.MD5Hash {
+		f.fail(w, http.StatusBadRequest, "Provided MD5 hash doesn't match calculated MD5 hash")
+		return
+	}
+
+	f.objects[attrs.Name] = object
+	f.reply(w, http.StatusOK, f.resource(attrs.Name, object))
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/utils"
+	"github.com/klauspost/compress/zstd"
 	xz "github.com/smira/go-xz"
 )
 
@@ -23,6 +24,11 @@ var compressionMethods = []struct {
 		extenstion:     ".bz2",
 		transformation: func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil },
 	},
+	{
+		extenstion: ".zst",
+		// single-threaded decoder doesn't start goroutines, so it doesn't have to be closed
+		transformation: func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r, zstd.WithDecoderConcurrency(1)) },
+	},
 	{
 		extenstion:     ".gz",
 		transformation: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
@@ -37,7 +43,7 @@ var compressionMethods = []struct {
 	},
 }
 
-// DownloadTryCompression tries to download from URL .bz2, .gz and raw extension until
+// DownloadTryCompression tries to download from URL .bz2, .zst, .gz, .xz and raw extension until
 // it finds existing file.
 func DownloadTryCompression(ctx context.Context, downloader aptly.Downloader, baseURL *url.URL, path string, expectedChecksums map[string]utils.ChecksumInfo, ignoreMismatch bool) (io.Reader, *os.File, error) {
 	var err error
@@ -21,6 +21,7 @@ var _ = Suite(&CompressionSuite{})
 const (
 	bzipData = "BZh91AY&SY\xcc\xc3q\xd4\x00\x00\x02A\x80\x00\x10\x02\x00\x0c\x00 \x00!\x9ah3M\x19\x97\x8b\xb9\"\x9c(Hfa\xb8\xea\x00"
 	gzipData = "\x1f\x8b\x08\x00\xc8j\xb0R\x00\x03+I-.\xe1\x02\x00\xc65\xb9;\x05\x00\x00\x00"
+	zstdData = "(\xb5/\xfd\x04\x00!\x00\x00test9\x81g\xdb"
 	xzData   = "\xfd\x37\x7a\x58\x5a\x00\x00\x04\xe6\xd6\xb4\x46\x02\x00\x21\x01\x16\x00\x00\x00\x74\x2f\xe5\xa3\x01\x00\x04\x74\x65\x73\x74\x0a\x00\x00\x00\x00\x9d\xed\x31\x1d\x0f\x9f\xd7\xe6\x00\x01\x1d\x05\xb8\x2d\x80\xaf\x1f\xb6\xf3\x7d\x01\x00\x00\x00\x00\x04\x59\x5a"
 	rawData  = "test"
 )
@@ -35,6 +36,7 @@ func (s *CompressionSuite) TestDownloadTryCompression(c *C) {
 
 	expectedChecksums := map[string]utils.ChecksumInfo{
 		"file.bz2": {Size: int64(len(bzipData))},
+		"file.zst": {Size: int64(len(zstdData))},
 		"file.gz":  {Size: int64(len(gzipData))},
 		"file.xz":  {Size: int64(len(xzData))},
 		"file":     {Size: int64(len(rawData))},
@@ -51,10 +53,23 @@ func (s *CompressionSuite) TestDownloadTryCompression(c *C) {
 	c.Assert(string(buf), Equals, rawData)
 	c.Assert(d.Empty(), Equals, true)
 
-	// bzip2 not available, but gz is
+	// bzip2 not available, but zstd is
 	buf = make([]byte, 4)
 	d = NewFakeDownloader()
 	d.ExpectError("http://example.com/file.bz2", &Error{Code: 404})
+	d.ExpectResponse("http://example.com/file.zst", zstdData)
+	r, file, err = DownloadTryCompression(s.ctx, d, s.baseURL, "file", expectedChecksums, false)
+	c.Assert(err, IsNil)
+	defer file.Close()
+	io.ReadFull(r, buf)
+	c.Assert(string(buf), Equals, rawData)
+	c.Assert(d.Empty(), Equals, true)
+
+	// bzip2 & zstd not available, but gz is
+	buf = make([]byte, 4)
+	d = NewFakeDownloader()
+	d.ExpectError("http://example.com/file.bz2", &Error{Code: 404})
+	d.ExpectError("http://example.com/file.zst", &Error{Code: 404})
 	d.ExpectResponse("http://example.com/file.gz", gzipData)
 	r, file, err = DownloadTryCompression(s.ctx, d, s.baseURL, "file", expectedChecksums, false)
 	c.Assert(err, IsNil)
@@ -63,10 +78,11 @@ func (s *CompressionSuite) TestDownloadTryCompression(c *C) {
 	c.Assert(string(buf), Equals, rawData)
 	c.Assert(d.Empty(), Equals, true)
 
-	// bzip2 & gzip not available, but xz is
+	// bzip2, zstd & gzip not available, but xz is
 	buf = make([]byte, 4)
 	d = NewFakeDownloader()
 	d.ExpectError("http://example.com/file.bz2", &Error{Code: 404})
+	d.ExpectError("http://example.com/file.zst", &Error{Code: 404})
 	d.ExpectError("http://example.com/file.gz", &Error{Code: 404})
 	d.ExpectResponse("http://example.com/file.xz", xzData)
 	r, file, err = DownloadTryCompression(s.ctx, d, s.baseURL, "file", expectedChecksums, false)
@@ -76,10 +92,11 @@ func (s *CompressionSuite) TestDownloadTryCompression(c *C) {
 	c.Assert(string(buf), Equals, rawData)
 	c.Assert(d.Empty(), Equals, true)
 
-	// bzip2, gzip & xz not available, but raw is
+	// bzip2, zstd, gzip & xz not available, but raw is
 	buf = make([]byte, 4)
 	d = NewFakeDownloader()
 	d.ExpectError("http://example.com/file.bz2", &Error{Code: 404})
+	d.ExpectError("http://example.com/file.zst", &Error{Code: 404})
 	d.ExpectError("http://example.com/file.gz", &Error{Code: 404})
 	d.ExpectError("http://example.com/file.xz", &Error{Code: 404})
 	d.ExpectResponse("http://example.com/file", rawData)
@@ -93,6 +110,7 @@ func (s *CompressionSuite) TestDownloadTryCompression(c *C) {
 	// gzip available, but broken
 	d = NewFakeDownloader()
 	d.ExpectError("http://example.com/file.bz2", &Error{Code: 404})
+	d.ExpectError("http://example.com/file.zst", &Error{Code: 404})
 	d.ExpectResponse("http://example.com/file.gz", "x")
 	_, _, err = DownloadTryCompression(s.ctx, d, s.baseURL, "file", nil, true)
 	c.Assert(err, ErrorMatches, "unexpected EOF")
@@ -127,6 +145,7 @@ func (s *CompressionSuite) TestDownloadTryCompressionErrors(c *C) {
 
 	d = NewFakeDownloader()
 	d.ExpectError("http://example.com/file.bz2", &Error{Code: 404})
+	d.ExpectError("http://example.com/file.zst", &Error{Code: 404})
 	d.ExpectError("http://example.com/file.gz", &Error{Code: 404})
 	d.ExpectError("http://example.com/file.xz", &Error{Code: 404})
 	d.ExpectError("http://example.com/file", errors.New("403"))
@@ -135,11 +154,13 @@ func (s *CompressionSuite) TestDownloadTryCompressionErrors(c *C) {
 
 	d = NewFakeDownloader()
 	d.ExpectError("http://example.com/file.bz2", &Error{Code: 404})
+	d.ExpectError("http://example.com/file.zst", &Error{Code: 404})
 	d.ExpectError("http://example.com/file.gz", &Error{Code: 404})
 	d.ExpectError("http://example.com/file.xz", &Error{Code: 404})
 	d.ExpectResponse("http://example.com/file", rawData)
 	expectedChecksums := map[string]utils.ChecksumInfo{
 		"file.bz2": {Size: 7},
+		"file.zst": {Size: 7},
 		"file.gz":  {Size: 7},
 		"file.xz":  {Size: 7},
 		"file":     {Size: 7},
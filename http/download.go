@@ -218,6 +218,7 @@ func (downloader *downloaderImpl) DownloadWithChecksum(ctx context.Context, url
 
 	// still an error after retrying, giving up
 	if err != nil {
+		downloadErrorsCounter.Inc()
 		if downloader.progress != nil {
 			downloader.progress.Printf("Download Error: %s\n", url)
 		}
@@ -268,7 +269,8 @@ func (downloader *downloaderImpl) download(req *http.Request, url, destination s
 
 	w := io.MultiWriter(writers...)
 
-	_, err = io.Copy(w, resp.Body)
+	n, err := io.Copy(w, resp.Body)
+	downloadBytesCounter.Add(float64(n))
 	if err != nil {
 		os.Remove(temppath)
 		return "", errors.Wrap(err, url)
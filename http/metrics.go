@@ -0,0 +1,21 @@
+package http
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	downloadBytesCounter = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "aptly_download_bytes_total",
+			Help: "Total number of bytes downloaded from remote repositories.",
+		},
+	)
+	downloadErrorsCounter = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "aptly_download_errors_total",
+			Help: "Total number of downloads from remote repositories which failed after all the retries.",
+		},
+	)
+)
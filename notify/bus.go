@@ -0,0 +1,51 @@
+package notify
+
+import "sync"
+
+// subscriberBuffer is number of events buffered for slow subscriber, further events are dropped
+const subscriberBuffer = 64
+
+// Bus broadcasts events to live subscribers (e.g. clients of event stream API)
+type Bus struct {
+	sync.Mutex
+	subscribers map[chan *Event]struct{}
+}
+
+// NewBus creates new event bus
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan *Event]struct{})}
+}
+
+// Subscribe returns channel receiving all the events published from now on, unsubscribe
+// function should be called once subscriber is not interested in events anymore
+func (b *Bus) Subscribe() (<-chan *Event, func()) {
+	ch := make(chan *Event, subscriberBuffer)
+
+	b.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.Unlock()
+
+	return ch, func() {
+		b.Lock()
+		defer b.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish delivers event to all the subscribers, never blocking: if subscriber
+// doesn't keep up, event is dropped for it
+func (b *Bus) Publish(event *Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"sync"
+
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultQueueSize is number of events waiting for delivery, further events are dropped
+const DefaultQueueSize = 256
+
+// delivery is event to be sent via named notifier
+type delivery struct {
+	name     string
+	notifier utils.Notifier
+	event    *Event
+}
+
+// Dispatcher sends events to notifiers in background, so that callers never wait
+// for slow or unreachable endpoints
+//
+// Events are delivered one by one in the order they were queued, delivery failures are logged.
+type Dispatcher struct {
+	sync.Mutex
+	queue  chan delivery
+	closed bool
+	done   chan struct{}
+}
+
+// NewDispatcher creates dispatcher queueing up to queueSize events and starts delivering them
+func NewDispatcher(queueSize int) *Dispatcher {
+	d := &Dispatcher{
+		queue: make(chan delivery, queueSize),
+		done:  make(chan struct{}),
+	}
+
+	go d.run()
+
+	return d
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+
+	for item := range d.queue {
+		if err := Send(&item.notifier, item.event); err != nil {
+			log.Warn().Msgf("notification (%s) of %s failed: %s", item.name, item.event.Type, err)
+		}
+	}
+}
+
+// Dispatch queues event for delivery via notifier, never blocking
+//
+// If queue is full or dispatcher is closed, event is dropped and false is returned.
+func (d *Dispatcher) Dispatch(name string, notifier utils.Notifier, event *Event) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.closed {
+		return false
+	}
+
+	select {
+	case d.queue <- delivery{name: name, notifier: notifier, event: event}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting events and waits for queued events to be delivered
+func (d *Dispatcher) Close() {
+	d.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.Unlock()
+
+	<-d.done
+}
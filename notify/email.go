@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// emailMessage builds RFC 5322 message for event
+func emailMessage(cfg *utils.Notifier, event *Event) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", event.Subject())
+	fmt.Fprintf(&b, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(event.Text(), "\n", "\r\n"))
+
+	return []byte(b.String())
+}
+
+// sendEmail sends event by email via SMTP server
+func sendEmail(cfg *utils.Notifier, event *Event) error {
+	var auth smtp.Auth
+
+	if cfg.SMTPUser != "" {
+		host, _, err := net.SplitHostPort(cfg.SMTPServer)
+		if err != nil {
+			return fmt.Errorf("wrong smtpServer %s: %s", cfg.SMTPServer, err)
+		}
+		auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPassword, host)
+	}
+
+	return smtp.SendMail(cfg.SMTPServer, auth, cfg.From, cfg.To, emailMessage(cfg, event))
+}
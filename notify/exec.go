@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// commandTimeout limits time exec notifier could run
+const commandTimeout = time.Minute
+
+// runCommand runs external command passing event as JSON on stdin and in environment
+func runCommand(cfg *utils.Notifier, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, cfg.Command[0], cfg.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"APTLY_EVENT_TYPE="+event.Type,
+		"APTLY_EVENT_SEVERITY="+event.Severity,
+		"APTLY_EVENT_TITLE="+event.Title,
+		"APTLY_EVENT_MESSAGE="+event.Message,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s: %s", cfg.Command[0], err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
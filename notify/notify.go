@@ -0,0 +1,114 @@
+// Package notify implements notifications about task outcomes and other events
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// Notifier types
+const (
+	TypeEmail      = "email"
+	TypeSlack      = "slack"
+	TypeMattermost = "mattermost"
+	TypeWebhook    = "webhook"
+	TypeExec       = "exec"
+)
+
+// httpClient is used for all the webhook requests
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Event is something operators should learn about
+type Event struct {
+	// Type of event, e.g. task-failed
+	Type string `json:"type"`
+	// Severity: info, warning or error
+	Severity string `json:"severity"`
+	// One-line summary
+	Title string `json:"title"`
+	// Details, might be multi-line
+	Message string `json:"message,omitempty"`
+	// Time event happened
+	Time time.Time `json:"time"`
+	// Additional properties of event (task ID, mirror name, ...)
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// NewEvent creates event happened now
+func NewEvent(eventType, severity, title, message string, fields map[string]string) *Event {
+	return &Event{
+		Type:     eventType,
+		Severity: severity,
+		Title:    title,
+		Message:  message,
+		Time:     time.Now(),
+		Fields:   fields,
+	}
+}
+
+// Subject returns one-line representation of event
+func (e *Event) Subject() string {
+	return fmt.Sprintf("[aptly] %s: %s", e.Severity, e.Title)
+}
+
+// Text returns plain text representation of event details
+func (e *Event) Text() string {
+	var b strings.Builder
+
+	if e.Message != "" {
+		b.WriteString(e.Message)
+		b.WriteString("\n\n")
+	}
+
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", key, e.Fields[key])
+	}
+	fmt.Fprintf(&b, "Event: %s\nTime: %s\n", e.Type, e.Time.Format(time.RFC3339))
+
+	return b.String()
+}
+
+// Send delivers event via notifier
+func Send(config *utils.Notifier, event *Event) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	switch config.Type {
+	case TypeEmail:
+		return sendEmail(config, event)
+	case TypeSlack, TypeMattermost:
+		return sendWebhook(config, event)
+	case TypeWebhook:
+		return postEvent(config, event)
+	case TypeExec:
+		return runCommand(config, event)
+	}
+
+	return fmt.Errorf("unknown notifier type: %q", config.Type)
+}
+
+// checkResponse returns error for unsuccessful response
+func checkResponse(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: unexpected response %s", resp.Request.Method, resp.Request.URL, resp.Status)
+	}
+
+	return nil
+}
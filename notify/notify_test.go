@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aptly-dev/aptly/utils"
+
+	. "gopkg.in/check.v1"
+)
+
+// Launch gocheck tests
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type NotifySuite struct {
+	server  *httptest.Server
+	bodies  []string
+	headers http.Header
+	status  int
+	event   *Event
+}
+
+var _ = Suite(&NotifySuite{})
+
+func (s *NotifySuite) SetUpTest(c *C) {
+	s.bodies = nil
+	s.status = http.StatusOK
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.bodies = append(s.bodies, string(body))
+		s.headers = r.Header
+		w.WriteHeader(s.status)
+	}))
+
+	s.event = &Event{
+		Type:     utils.NotifyEventTaskFailed,
+		Severity: utils.NotifySeverityError,
+		Title:    "Task 5 \"Update mirror wheezy\" failed",
+		Message:  "unable to download",
+		Time:     time.Date(2024, 3, 1, 4, 0, 0, 0, time.UTC),
+		Fields:   map[string]string{"task": "5"},
+	}
+}
+
+func (s *NotifySuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *NotifySuite) TestText(c *C) {
+	c.Check(s.event.Subject(), Equals, "[aptly] error: Task 5 \"Update mirror wheezy\" failed")
+	c.Check(s.event.Text(), Equals, "unable to download\n\ntask: 5\nEvent: task-failed\nTime: 2024-03-01T04:00:00Z\n")
+}
+
+func (s *NotifySuite) TestSlack(c *C) {
+	err := Send(&utils.Notifier{Type: TypeSlack, URL: s.server.URL, Channel: "#ops"}, s.event)
+	c.Assert(err, IsNil)
+	c.Assert(s.bodies, HasLen, 1)
+
+	var payload map[string]string
+	c.Assert(json.Unmarshal([]byte(s.bodies[0]), &payload), IsNil)
+	c.Check(payload["channel"], Equals, "#ops")
+	c.Check(payload["username"], Equals, "aptly")
+	c.Check(strings.HasPrefix(payload["text"], ":x: *Task 5"), Equals, true)
+	c.Check(payload["text"], Matches, "(?s).*unable to download.*")
+
+	s.status = http.StatusForbidden
+	err = Send(&utils.Notifier{Type: TypeMattermost, URL: s.server.URL}, s.event)
+	c.Check(err, ErrorMatches, ".*unexpected response 403 Forbidden")
+}
+
+func (s *NotifySuite) TestWebhook(c *C) {
+	err := Send(&utils.Notifier{Type: TypeWebhook, URL: s.server.URL, Secret: "s3cr3t",
+		Headers: map[string]string{"X-Ci-Token": "abc"}}, s.event)
+	c.Assert(err, IsNil)
+	c.Assert(s.bodies, HasLen, 1)
+
+	var event Event
+	c.Assert(json.Unmarshal([]byte(s.bodies[0]), &event), IsNil)
+	c.Check(event, DeepEquals, *s.event)
+
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write([]byte(s.bodies[0]))
+	c.Check(s.headers.Get("X-Hub-Signature-256"), Equals, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	c.Check(s.headers.Get("X-Aptly-Event"), Equals, "task-failed")
+	c.Check(s.headers.Get("X-Ci-Token"), Equals, "abc")
+
+	err = Send(&utils.Notifier{Type: TypeWebhook, URL: s.server.URL}, s.event)
+	c.Assert(err, IsNil)
+	c.Check(s.headers.Get("X-Hub-Signature-256"), Equals, "")
+}
+
+func (s *NotifySuite) TestWebhookRetries(c *C) {
+	defer func(unit time.Duration) { retryDelayUnit = unit }(retryDelayUnit)
+	retryDelayUnit = time.Millisecond
+
+	s.status = http.StatusServiceUnavailable
+	err := Send(&utils.Notifier{Type: TypeWebhook, URL: s.server.URL, Retries: 2}, s.event)
+	c.Check(err, ErrorMatches, ".*unexpected response 503 Service Unavailable")
+	c.Check(s.bodies, HasLen, 3)
+
+	// client errors are not retried
+	s.bodies = nil
+	s.status = http.StatusBadRequest
+	err = Send(&utils.Notifier{Type: TypeWebhook, URL: s.server.URL, Retries: 2}, s.event)
+	c.Check(err, ErrorMatches, ".*unexpected response 400 Bad Request")
+	c.Check(s.bodies, HasLen, 1)
+}
+
+func (s *NotifySuite) TestDispatcher(c *C) {
+	received := make(chan string, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-Aptly-Event")
+		<-release
+	}))
+	defer server.Close()
+
+	notifier := utils.Notifier{Type: TypeWebhook, URL: server.URL}
+	dispatcher := NewDispatcher(1)
+
+	// slow endpoint doesn't block dispatching
+	c.Check(dispatcher.Dispatch("ci", notifier, s.event), Equals, true)
+	c.Check(<-received, Equals, "task-failed")
+	c.Check(dispatcher.Dispatch("ci", notifier, s.event), Equals, true)
+	// queue is full
+	c.Check(dispatcher.Dispatch("ci", notifier, s.event), Equals, false)
+
+	close(release)
+	dispatcher.Close()
+	c.Check(received, HasLen, 1)
+
+	c.Check(dispatcher.Dispatch("ci", notifier, s.event), Equals, false)
+}
+
+func (s *NotifySuite) TestBus(c *C) {
+	bus := NewBus()
+
+	events1, unsubscribe1 := bus.Subscribe()
+	events2, unsubscribe2 := bus.Subscribe()
+	defer unsubscribe2()
+
+	bus.Publish(s.event)
+	c.Check(<-events1, Equals, s.event)
+	c.Check(<-events2, Equals, s.event)
+
+	unsubscribe1()
+	_, ok := <-events1
+	c.Check(ok, Equals, false)
+
+	// slow subscriber doesn't block publishing
+	for i := 0; i < subscriberBuffer+10; i++ {
+		bus.Publish(s.event)
+	}
+	c.Check(events2, HasLen, subscriberBuffer)
+}
+
+func (s *NotifySuite) TestEmailMessage(c *C) {
+	msg := string(emailMessage(&utils.Notifier{Type: TypeEmail, From: "aptly@example.com", To: []string{"ops@example.com", "dev@example.com"}}, s.event))
+
+	c.Check(msg, Matches, "(?s)From: aptly@example.com\r\nTo: ops@example.com, dev@example.com\r\nSubject: \\[aptly\\] error: Task 5.*")
+	c.Check(strings.HasSuffix(msg, "\r\n\r\nunable to download\r\n\r\ntask: 5\r\nEvent: task-failed\r\nTime: 2024-03-01T04:00:00Z\r\n"), Equals, true)
+}
+
+func (s *NotifySuite) TestExec(c *C) {
+	output := filepath.Join(c.MkDir(), "event")
+
+	err := Send(&utils.Notifier{Type: TypeExec, Command: []string{"sh", "-c", "(cat; echo; echo $APTLY_EVENT_SEVERITY) > " + output}}, s.event)
+	c.Assert(err, IsNil)
+
+	contents, err := os.ReadFile(output)
+	c.Assert(err, IsNil)
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	c.Assert(lines, HasLen, 2)
+	c.Check(lines[1], Equals, "error")
+
+	var event Event
+	c.Assert(json.Unmarshal([]byte(lines[0]), &event), IsNil)
+	c.Check(event, DeepEquals, *s.event)
+
+	err = Send(&utils.Notifier{Type: TypeExec, Command: []string{"sh", "-c", "echo broken; exit 3"}}, s.event)
+	c.Check(err, ErrorMatches, "sh: exit status 3: broken")
+}
+
+func (s *NotifySuite) TestInvalid(c *C) {
+	c.Check(Send(&utils.Notifier{Type: "pager"}, s.event), ErrorMatches, "unknown notifier type \"pager\"")
+	c.Check(Send(&utils.Notifier{Type: TypeSlack}, s.event), ErrorMatches, "url is required for slack notifier")
+	c.Check(Send(&utils.Notifier{Type: TypeWebhook}, s.event), ErrorMatches, "url is required for webhook notifier")
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// Defaults of webhook notifier retries
+const (
+	defaultRetries    = 3
+	defaultRetryDelay = 1
+)
+
+// retryDelayUnit is unit of retryDelay setting, could be lowered in tests
+var retryDelayUnit = time.Second
+
+// postEvent posts event as JSON to webhook URL, signing body with HMAC-SHA256
+// (in the same way as GitHub does) if secret is set
+//
+// Failed requests (network errors, 5xx and 429 responses) are retried with exponential backoff.
+func postEvent(cfg *utils.Notifier, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	retries := cfg.Retries
+	if retries <= 0 {
+		retries = defaultRetries
+	}
+
+	delay := time.Duration(cfg.RetryDelay) * retryDelayUnit
+	if delay <= 0 {
+		delay = defaultRetryDelay * retryDelayUnit
+	}
+
+	for attempt := 0; ; attempt++ {
+		var retry bool
+
+		retry, err = postEventOnce(cfg, event, body)
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// postEventOnce makes single attempt to post event, reporting whether failed request should be retried
+func postEventOnce(cfg *utils.Notifier, event *Event, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "aptly")
+	req.Header.Set("X-Aptly-Event", event.Type)
+	for name, value := range cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if cfg.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%s %s: unexpected response %s", req.Method, req.URL, resp.Status)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aptly-dev/aptly/utils"
+)
+
+// severity markers used in chat messages
+var severityEmoji = map[string]string{
+	utils.NotifySeverityInfo:    ":information_source:",
+	utils.NotifySeverityWarning: ":warning:",
+	utils.NotifySeverityError:   ":x:",
+}
+
+// sendWebhook posts event to Slack or Mattermost incoming webhook
+//
+// Both services accept the same payload format.
+func sendWebhook(cfg *utils.Notifier, event *Event) error {
+	payload := struct {
+		Text     string `json:"text"`
+		Channel  string `json:"channel,omitempty"`
+		Username string `json:"username"`
+	}{
+		Text:     fmt.Sprintf("%s *%s*\n```\n%s```", severityEmoji[event.Severity], event.Title, event.Text()),
+		Channel:  cfg.Channel,
+		Username: "aptly",
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return checkResponse(httpClient.Do(req))
+}
@@ -0,0 +1,2 @@
+// Package oci handles publishing to OCI (container) registries
+package oci
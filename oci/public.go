@@ -0,0 +1,549 @@
+package oci
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/pkg/errors"
+)
+
+// artifact is the published prefix stored as single OCI artifact
+type artifact struct {
+	repository string
+	tag        string
+	// digest of manifest in the registry, empty if not pushed yet
+	digest string
+	// files by path relative to published prefix
+	files map[string]descriptor
+	dirty bool
+}
+
+// PublishedStorage abstract file system with published files (actually hosted in OCI registry)
+//
+// Every published prefix is stored as OCI artifact (one layer per file, named with
+// org.opencontainers.image.title annotation, like ORAS does), so that published repository
+// could be pulled with any ORAS-compatible tool. Changes are accumulated in memory and
+// manifest is pushed to the registry on Flush.
+type PublishedStorage struct {
+	registry   *registry
+	repository string
+	// published prefix -> [repository:]tag
+	prefixes map[string]string
+
+	lock      sync.Mutex
+	artifacts map[string]*artifact
+}
+
+// Check interface
+var (
+	_ aptly.PublishedStorage              = (*PublishedStorage)(nil)
+	_ aptly.FlushablePublishedStorage     = (*PublishedStorage)(nil)
+	_ aptly.HealthCheckedPublishedStorage = (*PublishedStorage)(nil)
+)
+
+// NewPublishedStorage creates published storage in OCI registry
+//
+// repository is used for prefixes not listed in prefixes mapping, which maps published
+// prefix to "repository:tag" or just "tag"
+func NewPublishedStorage(host, repository, username, password string, plainHTTP bool, prefixes map[string]string) (*PublishedStorage, error) {
+	if host == "" {
+		return nil, fmt.Errorf("OCI registry not specified")
+	}
+
+	return &PublishedStorage{
+		registry:   newRegistry(host, username, password, plainHTTP),
+		repository: repository,
+		prefixes:   prefixes,
+		artifacts:  map[string]*artifact{},
+	}, nil
+}
+
+// String
+func (storage *PublishedStorage) String() string {
+	return fmt.Sprintf("OCI: %s/%s", storage.registry.host, storage.repository)
+}
+
+var invalidTagChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// reference returns repository and tag for published prefix
+func (storage *PublishedStorage) reference(prefix string) (string, string, error) {
+	repository, tag := storage.repository, ""
+
+	if mapped, ok := storage.prefixes[prefix]; ok {
+		if i := strings.LastIndex(mapped, ":"); i != -1 {
+			repository, tag = mapped[:i], mapped[i+1:]
+		} else {
+			tag = mapped
+		}
+	} else if prefix == "." {
+		tag = "latest"
+	} else {
+		tag = strings.TrimLeft(invalidTagChars.ReplaceAllString(prefix, "-"), ".-")
+		if len(tag) > 128 {
+			tag = tag[:128]
+		}
+	}
+
+	if repository == "" || tag == "" {
+		return "", "", fmt.Errorf("no OCI repository or tag for prefix %s in %s", prefix, storage)
+	}
+
+	return repository, tag, nil
+}
+
+// splitPath splits path into published prefix and path inside published prefix
+//
+// Prefix ends before "dists" or "pool" directory, for paths without those
+// file is considered to be in prefix root (isDir: path is the prefix itself).
+func splitPath(path string, isDir bool) (string, string) {
+	path = strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/")
+	if path == "." {
+		path = ""
+	}
+
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if part == "dists" || part == "pool" {
+			prefix := strings.Join(parts[:i], "/")
+			if prefix == "" {
+				prefix = "."
+			}
+			return prefix, strings.Join(parts[i:], "/")
+		}
+	}
+
+	if isDir {
+		if path == "" {
+			path = "."
+		}
+		return path, ""
+	}
+
+	prefix, file := filepath.Split(path)
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		prefix = "."
+	}
+	return prefix, file
+}
+
+// artifact returns (loading if required) artifact for published prefix, lock should be held
+func (storage *PublishedStorage) artifact(prefix string) (*artifact, error) {
+	if a, ok := storage.artifacts[prefix]; ok {
+		return a, nil
+	}
+
+	repository, tag, err := storage.reference(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &artifact{repository: repository, tag: tag, files: map[string]descriptor{}}
+
+	m, digest, err := storage.registry.getManifest(repository, tag)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading %s:%s from %s", repository, tag, storage)
+	}
+
+	if m != nil {
+		if m.ArtifactType != artifactType {
+			return nil, fmt.Errorf("%s:%s in %s is not published by aptly (artifact type %q)", repository, tag, storage, m.ArtifactType)
+		}
+
+		a.digest = digest
+		for _, layer := range m.Layers {
+			if layer.Annotations[annotationTitle] != "" {
+				a.files[layer.Annotations[annotationTitle]] = layer
+			}
+		}
+	}
+
+	storage.artifacts[prefix] = a
+	return a, nil
+}
+
+// lookup returns artifact and path in it
+func (storage *PublishedStorage) lookup(path string, isDir bool) (*artifact, string, error) {
+	prefix, relPath := splitPath(path, isDir)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	a, err := storage.artifact(prefix)
+	return a, relPath, err
+}
+
+// setFile records file in artifact
+func (storage *PublishedStorage) setFile(a *artifact, relPath string, desc descriptor) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	desc.Annotations = map[string]string{annotationTitle: relPath}
+	a.files[relPath] = desc
+	a.dirty = true
+}
+
+// MkDir creates directory recursively under public path
+func (storage *PublishedStorage) MkDir(_ string) error {
+	// no op for OCI
+	return nil
+}
+
+// PutFile puts file into published storage at specified path
+func (storage *PublishedStorage) PutFile(path string, sourceFilename string) error {
+	a, relPath, err := storage.lookup(path, false)
+	if err != nil {
+		return err
+	}
+
+	checksums, err := utils.ChecksumsForFile(sourceFilename)
+	if err != nil {
+		return err
+	}
+
+	desc := descriptor{MediaType: mediaTypeFile, Digest: "sha256:" + checksums.SHA256, Size: checksums.Size}
+
+	err = storage.registry.pushBlob(a.repository, desc.Digest, desc.Size, func() (io.ReadCloser, error) {
+		return os.Open(sourceFilename)
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error uploading %s to %s", sourceFilename, storage))
+	}
+
+	storage.setFile(a, relPath, desc)
+	return nil
+}
+
+// Remove removes single file under public path
+func (storage *PublishedStorage) Remove(path string) error {
+	a, relPath, err := storage.lookup(path, false)
+	if err != nil {
+		return err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if _, ok := a.files[relPath]; ok {
+		delete(a.files, relPath)
+		a.dirty = true
+	}
+
+	return nil
+}
+
+// RemoveDirs removes directory structure under public path
+func (storage *PublishedStorage) RemoveDirs(path string, _ aptly.Progress) error {
+	a, relPath, err := storage.lookup(path, true)
+	if err != nil {
+		return err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	for file := range a.files {
+		if relPath == "" || strings.HasPrefix(file, relPath+"/") {
+			delete(a.files, file)
+			a.dirty = true
+		}
+	}
+
+	return nil
+}
+
+// LinkFromPool links package file from pool to dist's pool location
+//
+// publishedPrefix is desired prefix for the location in the pool.
+// publishedRelPath is desired location in pool (like pool/component/liba/libav/)
+// sourcePool is instance of aptly.PackagePool
+// sourcePath is filepath to package file in package pool
+//
+// LinkFromPool returns relative path for the published file to be included in package index
+func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+
+	relPath := filepath.Join(publishedPrefix, publishedRelPath, fileName)
+
+	a, fileRelPath, err := storage.lookup(relPath, false)
+	if err != nil {
+		return err
+	}
+
+	digest, size := sourceChecksums.SHA256, sourceChecksums.Size
+	if digest == "" {
+		source, err := sourcePool.Open(sourcePath)
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		size, err = io.Copy(hash, source)
+		source.Close()
+		if err != nil {
+			return err
+		}
+		digest = hex.EncodeToString(hash.Sum(nil))
+	}
+	digest = "sha256:" + digest
+
+	storage.lock.Lock()
+	existing, exists := a.files[fileRelPath]
+	storage.lock.Unlock()
+
+	if exists {
+		if existing.Digest == digest {
+			return nil
+		}
+		if !force {
+			return fmt.Errorf("error putting file to %s: file already exists and is different: %s", relPath, storage)
+		}
+	}
+
+	err = storage.registry.pushBlob(a.repository, digest, size, func() (io.ReadCloser, error) {
+		return sourcePool.Open(sourcePath)
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error uploading %s to %s: %s", sourcePath, storage, relPath))
+	}
+
+	storage.setFile(a, fileRelPath, descriptor{MediaType: mediaTypeFile, Digest: digest, Size: size})
+	return nil
+}
+
+// Filelist returns list of files under prefix
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	a, relPath, err := storage.lookup(prefix, true)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	result := []string{}
+	for file := range a.files {
+		if relPath == "" {
+			result = append(result, file)
+		} else if strings.HasPrefix(file, relPath+"/") {
+			result = append(result, file[len(relPath)+1:])
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// copyFile copies file descriptor inside artifact, optionally removing source
+func (storage *PublishedStorage) copyFile(src, dst string, symlink, move bool) error {
+	srcArtifact, srcPath, err := storage.lookup(src, false)
+	if err != nil {
+		return err
+	}
+	dstArtifact, dstPath, err := storage.lookup(dst, false)
+	if err != nil {
+		return err
+	}
+
+	if srcArtifact != dstArtifact {
+		return fmt.Errorf("unable to link %s -> %s in %s: files in different prefixes", src, dst, storage)
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	desc, ok := srcArtifact.files[srcPath]
+	if !ok {
+		return fmt.Errorf("error linking %s -> %s in %s: %s not found", src, dst, storage, src)
+	}
+
+	link := ""
+	if symlink {
+		link = srcPath
+	} else if move {
+		link = desc.Annotations[annotationSymLink]
+	}
+
+	desc.Annotations = map[string]string{annotationTitle: dstPath}
+	if link != "" {
+		desc.Annotations[annotationSymLink] = link
+	}
+
+	dstArtifact.files[dstPath] = desc
+	if move {
+		delete(srcArtifact.files, srcPath)
+	}
+	dstArtifact.dirty = true
+
+	return nil
+}
+
+// RenameFile renames (moves) file
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	return storage.copyFile(oldName, newName, false, true)
+}
+
+// SymLink creates a copy of src file and adds link information as annotation
+func (storage *PublishedStorage) SymLink(src string, dst string) error {
+	return storage.copyFile(src, dst, true, false)
+}
+
+// HardLink creates a copy of src file, as hard links do not exist
+func (storage *PublishedStorage) HardLink(src string, dst string) error {
+	return storage.copyFile(src, dst, false, false)
+}
+
+// FileExists returns true if path exists
+func (storage *PublishedStorage) FileExists(path string) (bool, error) {
+	a, relPath, err := storage.lookup(path, false)
+	if err != nil {
+		return false, err
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	_, ok := a.files[relPath]
+	return ok, nil
+}
+
+// ReadLink returns the symbolic link pointed to by path
+func (storage *PublishedStorage) ReadLink(path string) (string, error) {
+	prefix, relPath := splitPath(path, false)
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	a, err := storage.artifact(prefix)
+	if err != nil {
+		return "", err
+	}
+
+	desc, ok := a.files[relPath]
+	if !ok || desc.Annotations[annotationSymLink] == "" {
+		return "", fmt.Errorf("error reading symlink %s in %s: not a symlink", path, storage)
+	}
+
+	return filepath.Join(prefix, desc.Annotations[annotationSymLink]), nil
+}
+
+// Flush pushes manifests of all the changed artifacts to the registry
+//
+// Artifacts without files are deleted (or replaced with empty artifact, if
+// registry doesn't support deletion).
+func (storage *PublishedStorage) Flush() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	prefixes := make([]string, 0, len(storage.artifacts))
+	for prefix := range storage.artifacts {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		a := storage.artifacts[prefix]
+		if !a.dirty {
+			continue
+		}
+
+		if len(a.files) == 0 && a.digest != "" {
+			deleted, err := storage.registry.deleteManifest(a.repository, a.digest)
+			if err != nil {
+				return errors.Wrapf(err, "error deleting %s:%s from %s", a.repository, a.tag, storage)
+			}
+			if deleted {
+				a.digest = ""
+				a.dirty = false
+				continue
+			}
+		} else if len(a.files) == 0 {
+			a.dirty = false
+			continue
+		}
+
+		err := storage.registry.pushBlob(a.repository, sha256Digest(emptyConfig), int64(len(emptyConfig)), func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(emptyConfig)), nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error uploading config to %s", storage)
+		}
+
+		m := &manifest{
+			SchemaVersion: 2,
+			MediaType:     mediaTypeManifest,
+			ArtifactType:  artifactType,
+			Config: descriptor{
+				MediaType: mediaTypeEmpty,
+				Digest:    sha256Digest(emptyConfig),
+				Size:      int64(len(emptyConfig)),
+			},
+			Layers: make([]descriptor, 0, len(a.files)),
+		}
+
+		files := make([]string, 0, len(a.files))
+		for file := range a.files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			m.Layers = append(m.Layers, a.files[file])
+		}
+
+		if len(m.Layers) == 0 {
+			// manifest should have at least one layer
+			m.Layers = append(m.Layers, m.Config)
+		}
+
+		a.digest, err = storage.registry.putManifest(a.repository, a.tag, m)
+		if err != nil {
+			return errors.Wrapf(err, "error pushing %s:%s to %s", a.repository, a.tag, storage)
+		}
+		a.dirty = false
+	}
+
+	return nil
+}
+
+// HealthCheck verifies push access to all configured repositories by pushing
+// empty config blob (which is shared by all artifacts), as files are not pushed
+// to the registry until Flush
+func (storage *PublishedStorage) HealthCheck() error {
+	repositories := []string{}
+	if storage.repository != "" {
+		repositories = append(repositories, storage.repository)
+	}
+	for prefix := range storage.prefixes {
+		repository, _, err := storage.reference(prefix)
+		if err != nil {
+			return err
+		}
+		repositories = append(repositories, repository)
+	}
+
+	sort.Strings(repositories)
+	repositories = utils.StrSliceDeduplicate(repositories)
+
+	for _, repository := range repositories {
+		err := storage.registry.pushBlob(repository, sha256Digest(emptyConfig), int64(len(emptyConfig)), func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(emptyConfig)), nil
+		})
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("error pushing to %s in %s", repository, storage))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package oci
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+type PublishedStorageSuite struct {
+	fake    *fakeRegistry
+	storage *PublishedStorage
+}
+
+var _ = Suite(&PublishedStorageSuite{})
+
+func (s *PublishedStorageSuite) SetUpTest(c *C) {
+	var err error
+
+	s.fake = newFakeRegistry()
+	s.storage, err = NewPublishedStorage(s.fake.host(), "apt/repo", "user", "secret", true,
+		map[string]string{"ubuntu": "apt/ubuntu:stable", "debian": "bookworm"})
+	c.Assert(err, IsNil)
+}
+
+func (s *PublishedStorageSuite) TearDownTest(c *C) {
+	s.fake.server.Close()
+}
+
+func (s *PublishedStorageSuite) manifest(c *C, path string) *manifest {
+	data, ok := s.fake.manifests[path]
+	if !ok {
+		return nil
+	}
+
+	m := &manifest{}
+	c.Assert(json.Unmarshal(data, m), IsNil)
+	return m
+}
+
+func (s *PublishedStorageSuite) putFile(c *C, path, contents string) {
+	tmp := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(tmp, []byte(contents), 0644), IsNil)
+	c.Assert(s.storage.PutFile(path, tmp), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestNewPublishedStorage(c *C) {
+	_, err := NewPublishedStorage("", "apt/repo", "", "", false, nil)
+	c.Check(err, ErrorMatches, "OCI registry not specified")
+
+	c.Check(s.storage.String(), Equals, "OCI: "+s.fake.host()+"/apt/repo")
+}
+
+func (s *PublishedStorageSuite) TestReference(c *C) {
+	for _, t := range []struct{ prefix, repository, tag string }{
+		{".", "apt/repo", "latest"},
+		{"ubuntu", "apt/ubuntu", "stable"},
+		{"debian", "apt/repo", "bookworm"},
+		{"ppa/team", "apt/repo", "ppa-team"},
+	} {
+		repository, tag, err := s.storage.reference(t.prefix)
+		c.Check(err, IsNil)
+		c.Check(repository, Equals, t.repository)
+		c.Check(tag, Equals, t.tag)
+	}
+
+	s.storage.repository = ""
+	_, _, err := s.storage.reference("ppa")
+	c.Check(err, ErrorMatches, "no OCI repository or tag for prefix ppa in .*")
+}
+
+func (s *PublishedStorageSuite) TestSplitPath(c *C) {
+	for _, t := range []struct {
+		path         string
+		isDir        bool
+		prefix, file string
+	}{
+		{"dists/stable/Release", false, ".", "dists/stable/Release"},
+		{"ppa/team/pool/main/a/a.deb", false, "ppa/team", "pool/main/a/a.deb"},
+		{"ppa/index.html", false, "ppa", "index.html"},
+		{"index.html", false, ".", "index.html"},
+		{"ppa/dists", true, "ppa", "dists"},
+		{"ppa", true, "ppa", ""},
+		{"", true, ".", ""},
+	} {
+		prefix, file := splitPath(t.path, t.isDir)
+		c.Check(prefix, Equals, t.prefix, Commentf("path %s", t.path))
+		c.Check(file, Equals, t.file, Commentf("path %s", t.path))
+	}
+}
+
+func (s *PublishedStorageSuite) TestPutFileFlush(c *C) {
+	s.putFile(c, "ubuntu/dists/stable/Release", "release")
+	s.putFile(c, "ubuntu/dists/stable/main/binary-amd64/Packages", "packages")
+
+	// nothing is pushed until flush
+	c.Check(s.manifest(c, "apt/ubuntu/manifests/stable"), IsNil)
+
+	c.Assert(s.storage.Flush(), IsNil)
+
+	m := s.manifest(c, "apt/ubuntu/manifests/stable")
+	c.Assert(m, NotNil)
+	c.Check(m.ArtifactType, Equals, artifactType)
+	c.Check(m.Config.Digest, Equals, "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a")
+	c.Assert(m.Layers, HasLen, 2)
+	c.Check(m.Layers[0].Annotations[annotationTitle], Equals, "dists/stable/Release")
+	c.Check(s.fake.blobs[m.Layers[0].Digest], DeepEquals, []byte("release"))
+	c.Check(m.Layers[1].Annotations[annotationTitle], Equals, "dists/stable/main/binary-amd64/Packages")
+
+	// state is loaded from registry by new storage
+	storage, _ := NewPublishedStorage(s.fake.host(), "apt/repo", "user", "secret", true,
+		map[string]string{"ubuntu": "apt/ubuntu:stable"})
+
+	list, err := storage.Filelist("ubuntu/dists/stable")
+	c.Check(err, IsNil)
+	c.Check(list, DeepEquals, []string{"Release", "main/binary-amd64/Packages"})
+
+	exists, err := storage.FileExists("ubuntu/dists/stable/Release")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, true)
+
+	exists, err = storage.FileExists("ubuntu/dists/stable/InRelease")
+	c.Check(err, IsNil)
+	c.Check(exists, Equals, false)
+}
+
+func (s *PublishedStorageSuite) TestRemove(c *C) {
+	s.putFile(c, "dists/stable/Release", "release")
+	s.putFile(c, "dists/stable/InRelease", "inrelease")
+	s.putFile(c, "pool/main/a/a.deb", "deb")
+
+	c.Assert(s.storage.Remove("dists/stable/InRelease"), IsNil)
+	c.Assert(s.storage.Remove("dists/stable/Missing"), IsNil)
+
+	list, _ := s.storage.Filelist("")
+	c.Check(list, DeepEquals, []string{"dists/stable/Release", "pool/main/a/a.deb"})
+
+	c.Assert(s.storage.RemoveDirs("pool", nil), IsNil)
+
+	list, _ = s.storage.Filelist("")
+	c.Check(list, DeepEquals, []string{"dists/stable/Release"})
+
+	c.Assert(s.storage.Flush(), IsNil)
+	c.Check(s.manifest(c, "apt/repo/manifests/latest").Layers, HasLen, 1)
+
+	// artifact without files is deleted
+	c.Assert(s.storage.RemoveDirs("dists", nil), IsNil)
+	c.Assert(s.storage.Flush(), IsNil)
+	c.Check(s.manifest(c, "apt/repo/manifests/latest"), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestRemoveNoDelete(c *C) {
+	s.fake.noDelete = true
+
+	s.putFile(c, "dists/stable/Release", "release")
+	c.Assert(s.storage.Flush(), IsNil)
+
+	c.Assert(s.storage.RemoveDirs("dists", nil), IsNil)
+	c.Assert(s.storage.Flush(), IsNil)
+
+	m := s.manifest(c, "apt/repo/manifests/latest")
+	c.Assert(m, NotNil)
+	c.Check(m.Layers, HasLen, 1)
+	c.Check(m.Layers[0].Annotations[annotationTitle], Equals, "")
+}
+
+func (s *PublishedStorageSuite) TestNotAptlyArtifact(c *C) {
+	s.fake.manifests["apt/repo/manifests/latest"] = []byte(`{"schemaVersion": 2, "mediaType": "` + mediaTypeManifest + `"}`)
+
+	_, err := s.storage.FileExists("dists/stable/Release")
+	c.Check(err, ErrorMatches, "apt/repo:latest in .* is not published by aptly .*")
+}
+
+func (s *PublishedStorageSuite) TestLinks(c *C) {
+	s.putFile(c, "dists/stable/main/binary-amd64/by-hash/SHA256/abcd", "packages")
+
+	c.Assert(s.storage.HardLink("dists/stable/main/binary-amd64/by-hash/SHA256/abcd", "dists/stable/main/binary-amd64/Packages"), IsNil)
+	_, err := s.storage.ReadLink("dists/stable/main/binary-amd64/Packages")
+	c.Check(err, ErrorMatches, "error reading symlink .*: not a symlink")
+
+	c.Assert(s.storage.SymLink("dists/stable/main/binary-amd64/by-hash/SHA256/abcd", "dists/stable/main/binary-amd64/by-hash/SHA256/Packages"), IsNil)
+	c.Assert(s.storage.RenameFile("dists/stable/main/binary-amd64/by-hash/SHA256/Packages", "dists/stable/main/binary-amd64/by-hash/SHA256/Packages.old"), IsNil)
+
+	link, err := s.storage.ReadLink("dists/stable/main/binary-amd64/by-hash/SHA256/Packages.old")
+	c.Check(err, IsNil)
+	c.Check(link, Equals, "dists/stable/main/binary-amd64/by-hash/SHA256/abcd")
+
+	list, _ := s.storage.Filelist("dists/stable/main/binary-amd64")
+	c.Check(list, DeepEquals, []string{"Packages", "by-hash/SHA256/Packages.old", "by-hash/SHA256/abcd"})
+
+	c.Check(s.storage.RenameFile("dists/stable/Release", "dists/stable/Release2"), ErrorMatches, "error linking .*: dists/stable/Release not found")
+	c.Check(s.storage.SymLink("dists/stable/main/binary-amd64/Packages", "ubuntu/dists/stable/Packages"), ErrorMatches, "unable to link .*: files in different prefixes")
+}
+
+func (s *PublishedStorageSuite) TestHealthCheck(c *C) {
+	c.Check(s.storage.HealthCheck(), IsNil)
+	c.Check(s.fake.blobs["sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"], DeepEquals, emptyConfig)
+	c.Check(s.fake.uploads, Equals, 1)
+
+	s.storage.registry.password = "wrong"
+	s.storage.registry.tokens = map[string]string{}
+	c.Check(s.storage.HealthCheck(), ErrorMatches, "error pushing to apt/repo in .*")
+}
+
+func (s *PublishedStorageSuite) TestLinkFromPool(c *C) {
+	root := c.MkDir()
+	pool := files.NewPackagePool(root, false)
+	cs := files.NewMockChecksumStorage()
+
+	tmpFile1 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err := os.WriteFile(tmpFile1, []byte("Contents"), 0644)
+	c.Assert(err, IsNil)
+	cksum1 := utils.ChecksumInfo{MD5: "c1df1da7a1ce305a3b60af9d5733ac1d"}
+
+	tmpFile2 := filepath.Join(c.MkDir(), "mars-invaders_1.03.deb")
+	err = os.WriteFile(tmpFile2, []byte("Spam"), 0644)
+	c.Assert(err, IsNil)
+	cksum2 := utils.ChecksumInfo{MD5: "e9dfd31cc505d51fc26975250750deab"}
+
+	src1, err := pool.Import(tmpFile1, "mars-invaders_1.03.deb", &cksum1, true, cs)
+	c.Assert(err, IsNil)
+	src2, err := pool.Import(tmpFile2, "mars-invaders_1.03.deb", &cksum2, true, cs)
+	c.Assert(err, IsNil)
+
+	// first link from pool
+	err = s.storage.LinkFromPool("ubuntu", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+	c.Check(s.fake.uploads, Equals, 1)
+
+	// duplicate link from pool
+	err = s.storage.LinkFromPool("ubuntu", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src1, cksum1, false)
+	c.Check(err, IsNil)
+	c.Check(s.fake.uploads, Equals, 1)
+
+	// link from pool with conflict
+	err = s.storage.LinkFromPool("ubuntu", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, false)
+	c.Check(err, ErrorMatches, ".*file already exists and is different.*")
+
+	// link from pool with conflict and force
+	err = s.storage.LinkFromPool("ubuntu", filepath.Join("pool", "main", "m/mars-invaders"), "mars-invaders_1.03.deb", pool, src2, cksum2, true)
+	c.Check(err, IsNil)
+
+	c.Assert(s.storage.Flush(), IsNil)
+
+	m := s.manifest(c, "apt/ubuntu/manifests/stable")
+	c.Assert(m.Layers, HasLen, 1)
+	c.Check(m.Layers[0].Annotations[annotationTitle], Equals, "pool/main/m/mars-invaders/mars-invaders_1.03.deb")
+	c.Check(s.fake.blobs[m.Layers[0].Digest], DeepEquals, []byte("Spam"))
+}
@@ -0,0 +1,385 @@
+package oci
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeEmpty    = "application/vnd.oci.empty.v1+json"
+	mediaTypeFile     = "application/octet-stream"
+
+	// artifactType marks manifests created by aptly
+	artifactType = "application/vnd.aptly.repository.v1"
+
+	annotationTitle   = "org.opencontainers.image.title"
+	annotationSymLink = "io.aptly.symlink"
+)
+
+// emptyConfig is the empty JSON object used as config of artifact manifests
+var emptyConfig = []byte("{}")
+
+// descriptor describes blob in the registry
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// manifest is OCI image manifest
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	ArtifactType  string       `json:"artifactType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+// registryError is unexpected response from registry
+type registryError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *registryError) Error() string {
+	msg := fmt.Sprintf("registry request %s %s failed: %d", e.Method, e.URL, e.StatusCode)
+	if body := strings.TrimSpace(e.Body); body != "" {
+		msg += " " + body
+	}
+	return msg
+}
+
+// sha256Digest returns digest of the data in OCI format
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// registry is minimal client of OCI distribution API
+type registry struct {
+	host     string
+	scheme   string
+	username string
+	password string
+	client   *http.Client
+
+	tokensLock sync.Mutex
+	// bearer tokens by scope
+	tokens map[string]string
+}
+
+func newRegistry(host, username, password string, plainHTTP bool) *registry {
+	scheme := "https"
+	if plainHTTP {
+		scheme = "http"
+	}
+
+	return &registry{
+		host:     host,
+		scheme:   scheme,
+		username: username,
+		password: password,
+		client:   http.DefaultClient,
+		tokens:   map[string]string{},
+	}
+}
+
+func (r *registry) url(repository, kind, reference string) string {
+	return fmt.Sprintf("%s://%s/v2/%s/%s/%s", r.scheme, r.host, repository, kind, reference)
+}
+
+// parseChallenge parses WWW-Authenticate header into scheme and parameters
+func parseChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+
+	for rest != "" {
+		var key, value string
+
+		rest = strings.TrimLeft(rest, " ,")
+		key, rest, _ = strings.Cut(rest, "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+
+	return strings.ToLower(scheme), params
+}
+
+// fetchToken requests bearer token from authorization service
+func (r *registry) fetchToken(params map[string]string, scope string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid bearer realm %q", params["realm"])
+	}
+
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", &registryError{Method: req.Method, URL: realm.String(), StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+// do performs request, authenticating when requested by registry
+//
+// newRequest is called for every attempt, so that request body could be re-read
+func (r *registry) do(repository, actions string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	scope := fmt.Sprintf("repository:%s:%s", repository, actions)
+
+	authorize := func(req *http.Request) {
+		r.tokensLock.Lock()
+		token := r.tokens[scope]
+		r.tokensLock.Unlock()
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if r.username != "" {
+			req.SetBasicAuth(r.username, r.password)
+		}
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	authorize(req)
+
+	resp, err := r.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	resp.Body.Close()
+
+	if scheme != "bearer" {
+		// basic auth was already tried (if configured)
+		return nil, &registryError{Method: req.Method, URL: req.URL.String(), StatusCode: resp.StatusCode, Body: "authentication required"}
+	}
+
+	token, err := r.fetchToken(params, scope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to authenticate to %s: %s", r.host, err)
+	}
+
+	r.tokensLock.Lock()
+	r.tokens[scope] = token
+	r.tokensLock.Unlock()
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+	authorize(req)
+
+	return r.client.Do(req)
+}
+
+// expect checks response status, consuming body of unexpected response
+func expect(resp *http.Response, codes ...int) error {
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &registryError{Method: resp.Request.Method, URL: resp.Request.URL.String(), StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// blobExists checks whether blob is already present in the repository
+func (r *registry) blobExists(repository, digest string) (bool, error) {
+	resp, err := r.do(repository, "pull,push", func() (*http.Request, error) {
+		return http.NewRequest(http.MethodHead, r.url(repository, "blobs", digest), nil)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	return true, expect(resp, http.StatusOK)
+}
+
+// pushBlob uploads blob to the repository (monolithic upload), unless it's already there
+func (r *registry) pushBlob(repository, digest string, size int64, open func() (io.ReadCloser, error)) error {
+	exists, err := r.blobExists(repository, digest)
+	if err != nil || exists {
+		return err
+	}
+
+	resp, err := r.do(repository, "pull,push", func() (*http.Request, error) {
+		return http.NewRequest(http.MethodPost, r.url(repository, "blobs", "uploads/"), nil)
+	})
+	if err != nil {
+		return err
+	}
+	err = expect(resp, http.StatusAccepted)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %s", err)
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = r.do(repository, "pull,push", func() (*http.Request, error) {
+		body, e := open()
+		if e != nil {
+			return nil, e
+		}
+
+		req, e := http.NewRequest(http.MethodPut, location.String(), body)
+		if e != nil {
+			body.Close()
+			return nil, e
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return expect(resp, http.StatusCreated)
+}
+
+// getManifest fetches manifest by tag or digest, returning nil manifest if it doesn't exist
+func (r *registry) getManifest(repository, reference string) (*manifest, string, error) {
+	resp, err := r.do(repository, "pull,push", func() (*http.Request, error) {
+		req, e := http.NewRequest(http.MethodGet, r.url(repository, "manifests", reference), nil)
+		if e == nil {
+			req.Header.Set("Accept", mediaTypeManifest)
+		}
+		return req, e
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if err = expect(resp, http.StatusOK); err != nil {
+		return nil, "", err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	result := &manifest{}
+	if err = json.Unmarshal(data, result); err != nil {
+		return nil, "", fmt.Errorf("unable to parse manifest %s:%s: %s", repository, reference, err)
+	}
+
+	return result, sha256Digest(data), nil
+}
+
+// putManifest uploads manifest under tag, returning manifest digest
+func (r *registry) putManifest(repository, tag string, m *manifest) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := r.do(repository, "pull,push", func() (*http.Request, error) {
+		req, e := http.NewRequest(http.MethodPut, r.url(repository, "manifests", tag), bytes.NewReader(data))
+		if e == nil {
+			req.Header.Set("Content-Type", mediaTypeManifest)
+		}
+		return req, e
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err = expect(resp, http.StatusCreated, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	return sha256Digest(data), nil
+}
+
+// deleteManifest deletes manifest by digest, returns false if registry doesn't support deletion
+func (r *registry) deleteManifest(repository, digest string) (bool, error) {
+	resp, err := r.do(repository, "delete", func() (*http.Request, error) {
+		return http.NewRequest(http.MethodDelete, r.url(repository, "manifests", digest), nil)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusUnsupportedMediaType {
+		return false, nil
+	}
+
+	return true, expect(resp, http.StatusAccepted, http.StatusOK, http.StatusNotFound)
+}
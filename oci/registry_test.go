@@ -0,0 +1,183 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+// fakeRegistry is in-memory OCI registry requiring bearer token
+type fakeRegistry struct {
+	sync.Mutex
+	server    *httptest.Server
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   int
+	noDelete  bool
+}
+
+func newFakeRegistry() *fakeRegistry {
+	r := &fakeRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	r.server = httptest.NewServer(r)
+	return r
+}
+
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	if req.URL.Path == "/token" {
+		user, password, _ := req.BasicAuth()
+		if user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"token": "t0ken"}`)
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer t0ken" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+
+	switch {
+	case strings.HasSuffix(path, "/blobs/uploads/") && req.Method == http.MethodPost:
+		w.Header().Set("Location", "/upload/"+strings.TrimSuffix(path, "/blobs/uploads/"))
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(req.URL.Path, "/upload/") && req.Method == http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		sum := sha256.Sum256(data)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		if digest != req.URL.Query().Get("digest") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[digest] = data
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/") && req.Method == http.MethodHead:
+		if _, ok := r.blobs[path[strings.LastIndex(path, "/")+1:]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case strings.Contains(path, "/manifests/") && req.Method == http.MethodGet:
+		data, ok := r.manifests[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case strings.Contains(path, "/manifests/") && req.Method == http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		r.manifests[path] = data
+		r.manifests[path[:strings.LastIndex(path, "/")+1]+sha256Digest(data)] = data
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/manifests/") && req.Method == http.MethodDelete:
+		if r.noDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		data := r.manifests[path]
+		for key, value := range r.manifests {
+			if string(value) == string(data) {
+				delete(r.manifests, key)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+type RegistrySuite struct {
+	fake *fakeRegistry
+}
+
+var _ = Suite(&RegistrySuite{})
+
+func (s *RegistrySuite) SetUpTest(c *C) {
+	s.fake = newFakeRegistry()
+}
+
+func (s *RegistrySuite) TearDownTest(c *C) {
+	s.fake.server.Close()
+}
+
+func (s *RegistrySuite) TestParseChallenge(c *C) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:a/b:pull,push"`)
+	c.Check(scheme, Equals, "bearer")
+	c.Check(params, DeepEquals, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:a/b:pull,push",
+	})
+
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	c.Check(scheme, Equals, "basic")
+	c.Check(params, DeepEquals, map[string]string{"realm": "registry"})
+}
+
+func (s *RegistrySuite) TestBlobs(c *C) {
+	r := newRegistry(s.fake.host(), "user", "secret", true)
+
+	data := []byte("hello")
+	digest := sha256Digest(data)
+
+	exists, err := r.blobExists("apt/repo", digest)
+	c.Assert(err, IsNil)
+	c.Check(exists, Equals, false)
+
+	open := func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(string(data))), nil }
+
+	c.Assert(r.pushBlob("apt/repo", digest, int64(len(data)), open), IsNil)
+	c.Check(s.fake.blobs[digest], DeepEquals, data)
+
+	// second push is skipped
+	c.Assert(r.pushBlob("apt/repo", digest, int64(len(data)), open), IsNil)
+	c.Check(s.fake.uploads, Equals, 1)
+}
+
+func (s *RegistrySuite) TestManifests(c *C) {
+	r := newRegistry(s.fake.host(), "user", "secret", true)
+
+	m, _, err := r.getManifest("apt/repo", "latest")
+	c.Assert(err, IsNil)
+	c.Check(m, IsNil)
+
+	digest, err := r.putManifest("apt/repo", "latest", &manifest{SchemaVersion: 2, MediaType: mediaTypeManifest, ArtifactType: artifactType})
+	c.Assert(err, IsNil)
+
+	m, digest2, err := r.getManifest("apt/repo", "latest")
+	c.Assert(err, IsNil)
+	c.Check(m.ArtifactType, Equals, artifactType)
+	c.Check(digest2, Equals, digest)
+
+	deleted, err := r.deleteManifest("apt/repo", digest)
+	c.Assert(err, IsNil)
+	c.Check(deleted, Equals, true)
+
+	m, _, err = r.getManifest("apt/repo", "latest")
+	c.Assert(err, IsNil)
+	c.Check(m, IsNil)
+}
+
+func (s *RegistrySuite) TestAuthFailure(c *C) {
+	r := newRegistry(s.fake.host(), "user", "wrong", true)
+
+	_, err := r.blobExists("apt/repo", sha256Digest(nil))
+	c.Check(err, ErrorMatches, "unable to authenticate to .*: registry request GET .*/token.* failed: 401")
+}
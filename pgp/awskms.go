@@ -0,0 +1,107 @@
+package pgp
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/pkg/errors"
+)
+
+// Test interface
+var (
+	_ DigestSigner = &AWSKMS{}
+)
+
+// kmsSigningAlgorithms maps hash functions to KMS signing algorithms
+var kmsSigningAlgorithms = map[crypto.Hash]types.SigningAlgorithmSpec{
+	crypto.SHA256: types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+	crypto.SHA384: types.SigningAlgorithmSpecRsassaPkcs1V15Sha384,
+	crypto.SHA512: types.SigningAlgorithmSpecRsassaPkcs1V15Sha512,
+}
+
+// AWSKMS is DigestSigner using asymmetric (RSA_*, SIGN_VERIFY) keys in AWS KMS
+type AWSKMS struct {
+	client *kms.Client
+	key    string
+}
+
+// NewAWSKMS creates signing backend using AWS KMS
+//
+// Credentials (and region, if not set) are taken from default AWS configuration chain.
+// Endpoint overrides KMS endpoint (e.g. for VPC endpoints or local KMS).
+func NewAWSKMS(region, endpoint, key string) (*AWSKMS, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "awskms: error loading AWS configuration")
+	}
+
+	client := kms.NewFromConfig(cfg, func(o *kms.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	return &AWSKMS{client: client, key: key}, nil
+}
+
+func (k *AWSKMS) keyID(keyRef string) (string, error) {
+	if keyRef == "" {
+		keyRef = k.key
+	}
+	if keyRef == "" {
+		return "", fmt.Errorf("awskms: key is not specified")
+	}
+
+	return keyRef, nil
+}
+
+// PublicKey returns public key of KMS key
+func (k *AWSKMS) PublicKey(keyRef string) (crypto.PublicKey, error) {
+	keyID, err := k.keyID(keyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := k.client.GetPublicKey(context.TODO(), &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, errors.Wrapf(err, "awskms: error getting public key %s", keyID)
+	}
+
+	return x509.ParsePKIXPublicKey(output.PublicKey)
+}
+
+// SignDigest signs digest with KMS key
+func (k *AWSKMS) SignDigest(keyRef string, digest []byte, hash crypto.Hash) ([]byte, error) {
+	keyID, err := k.keyID(keyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, ok := kmsSigningAlgorithms[hash]
+	if !ok {
+		return nil, fmt.Errorf("awskms: unsupported hash function %s", hash)
+	}
+
+	output, err := k.client.Sign(context.TODO(), &kms.SignInput{
+		KeyId:            aws.String(keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: algorithm,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "awskms: error signing with key %s", keyID)
+	}
+
+	return output.Signature, nil
+}
@@ -0,0 +1,111 @@
+package pgp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Test interface
+var (
+	_ Signer = &ExternalSigner{}
+)
+
+// ExternalSigner is implementation of Signer interface delegating signing to external command
+//
+// Command is invoked with gpg-compatible arguments appended: `--local-user <key>` (if key is set),
+// followed by `--detach-sign` or `--clearsign`. It should read data to be signed from stdin
+// and write ASCII-armored result to stdout. That could be gpg talking to gpg-agent over
+// forwarded socket, or wrapper around remote signing service.
+type ExternalSigner struct {
+	command []string
+	keyRef  string
+}
+
+// NewExternalSigner creates signer running command (with arguments)
+func NewExternalSigner(command []string) *ExternalSigner {
+	return &ExternalSigner{command: command}
+}
+
+// SetBatch is no-op, external command never gets terminal
+func (e *ExternalSigner) SetBatch(_ bool) {
+}
+
+// SetKey sets key reference passed to the command
+func (e *ExternalSigner) SetKey(keyRef string) {
+	e.keyRef = keyRef
+}
+
+// SetKeyRing is no-op, keys are managed by external command
+func (e *ExternalSigner) SetKeyRing(_, _ string) {
+}
+
+// SetPassphrase is no-op, keys are managed by external command
+func (e *ExternalSigner) SetPassphrase(_, _ string) {
+}
+
+// Init verifies availability of the command
+func (e *ExternalSigner) Init() error {
+	if len(e.command) == 0 {
+		return fmt.Errorf("external signer command is not configured")
+	}
+
+	_, err := exec.LookPath(e.command[0])
+	if err != nil {
+		return errors.Wrapf(err, "external signer command %s is not available", e.command[0])
+	}
+
+	return nil
+}
+
+func (e *ExternalSigner) run(mode string, source string, destination string) error {
+	args := append([]string(nil), e.command[1:]...)
+	if e.keyRef != "" {
+		args = append(args, "--local-user", e.keyRef)
+	}
+	args = append(args, mode)
+
+	input, err := os.Open(source)
+	if err != nil {
+		return errors.Wrap(err, "error opening source file")
+	}
+	defer input.Close()
+
+	output, err := os.Create(destination)
+	if err != nil {
+		return errors.Wrap(err, "error creating output file")
+	}
+	defer output.Close()
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(e.command[0], args...)
+	cmd.Stdin = input
+	cmd.Stdout = output
+	cmd.Stderr = &stderr
+
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("external signer %s failed: %s: %s", e.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output.Close()
+}
+
+// DetachedSign signs file with detached signature in ASCII format
+func (e *ExternalSigner) DetachedSign(source string, destination string) error {
+	fmt.Printf("external: signing file '%s'...\n", filepath.Base(source))
+
+	return e.run("--detach-sign", source, destination)
+}
+
+// ClearSign clear-signs the file
+func (e *ExternalSigner) ClearSign(source string, destination string) error {
+	fmt.Printf("external: clearsigning file '%s'...\n", filepath.Base(source))
+
+	return e.run("--clearsign", source, destination)
+}
@@ -14,8 +14,9 @@ import (
 
 // Test interface
 var (
-	_ Signer   = &GpgSigner{}
-	_ Verifier = &GpgVerifier{}
+	_ Signer            = &GpgSigner{}
+	_ PublicKeyExporter = &GpgSigner{}
+	_ Verifier          = &GpgVerifier{}
 )
 
 // GpgSigner is implementation of Signer interface using gpg as external program
@@ -135,6 +136,31 @@ func (g *GpgSigner) ClearSign(source string, destination string) error {
 	return cmd.Run()
 }
 
+// ExportPublicKey exports public key in ASCII armor, gpg needs no passphrase for that
+func (g *GpgSigner) ExportPublicKey() ([]byte, error) {
+	args := []string{"--armor"}
+	if g.keyring != "" {
+		args = append(args, "--no-auto-check-trustdb", "--no-default-keyring", "--keyring", g.keyring)
+	}
+	args = append(args, "--export")
+	if g.keyRef != "" {
+		args = append(args, g.keyRef)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(g.gpg, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to export public key: %s: %s", err, stderr.String())
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("unable to export public key: key %s not found", g.keyRef)
+	}
+
+	return output, nil
+}
+
 // GpgVerifier is implementation of Verifier interface using gpgv as external program
 type GpgVerifier struct {
 	gpg      string
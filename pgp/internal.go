@@ -14,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
 	openpgp_errors "github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
@@ -22,8 +23,9 @@ import (
 
 // Test interface
 var (
-	_ Signer   = &GoSigner{}
-	_ Verifier = &GoVerifier{}
+	_ Signer            = &GoSigner{}
+	_ PublicKeyExporter = &GoSigner{}
+	_ Verifier          = &GoVerifier{}
 )
 
 // Internal errors
@@ -200,6 +202,58 @@ func (g *GoSigner) Init() error {
 	return nil
 }
 
+// ExportPublicKey exports public key in ASCII armor, only public keyring is
+// required, so signer doesn't need to be initialized
+func (g *GoSigner) ExportPublicKey() ([]byte, error) {
+	keyringFile := g.keyringFile
+	if keyringFile == "" {
+		keyringFile = "pubring.gpg"
+	}
+
+	keyring, err := loadKeyRing(keyringFile, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading public keyring")
+	}
+
+	var entity *openpgp.Entity
+pickKeyLoop:
+	for _, candidate := range keyring {
+		if !validEntity(candidate) {
+			continue
+		}
+
+		if g.keyRef == "" || KeyFromUint64(candidate.PrimaryKey.KeyId).Matches(Key(g.keyRef)) {
+			entity = candidate
+			break
+		}
+
+		for name := range candidate.Identities {
+			if strings.Contains(name, g.keyRef) {
+				entity = candidate
+				break pickKeyLoop
+			}
+		}
+	}
+
+	if entity == nil {
+		return nil, errors.Errorf("couldn't find public key for key reference %v", g.keyRef)
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = entity.Serialize(w); err != nil {
+		return nil, errors.Wrap(err, "error exporting public key")
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 func (g *GoSigner) decryptKey() error {
 	err := g.signer.PrivateKey.Decrypt([]byte(g.passphrase))
 
@@ -0,0 +1,205 @@
+package pgp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/pkg/errors"
+)
+
+// Test interface
+var (
+	_ FileSigner = &MultiSigner{}
+)
+
+const (
+	signatureType        = "PGP SIGNATURE"
+	signatureBeginMarker = "\n-----BEGIN " + signatureType + "-----"
+)
+
+// MultiSigner signs files with several signers (usually with different keys), combining
+// their signatures, e.g. to keep old and new signatures during key rotation
+//
+// Each signer should be configured with its own key, keyring and passphrase before it is
+// added, so MultiSigner implements only FileSigner and can't be reconfigured as a whole.
+// SetBatch applies to all the signers.
+type MultiSigner struct {
+	signers []Signer
+}
+
+// NewMultiSigner creates signer which combines signatures of all the signers
+func NewMultiSigner(signers ...Signer) *MultiSigner {
+	return &MultiSigner{signers: signers}
+}
+
+// Init initializes all the signers
+func (m *MultiSigner) Init() error {
+	if len(m.signers) == 0 {
+		return errors.New("no signers configured")
+	}
+
+	for _, signer := range m.signers {
+		if err := signer.Init(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetBatch controls whether signers are allowed to interact with the user
+func (m *MultiSigner) SetBatch(batch bool) {
+	for _, signer := range m.signers {
+		signer.SetBatch(batch)
+	}
+}
+
+// sign runs sign for every signer, returning contents of their output files
+func (m *MultiSigner) sign(source string, sign func(signer Signer, source, destination string) error) ([][]byte, error) {
+	tempDir, err := os.MkdirTemp("", "aptly-sign")
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	results := make([][]byte, 0, len(m.signers))
+	for i, signer := range m.signers {
+		destination := filepath.Join(tempDir, fmt.Sprintf("%d.asc", i))
+
+		if err = sign(signer, source, destination); err != nil {
+			return nil, err
+		}
+
+		var result []byte
+		result, err = os.ReadFile(destination)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading signature")
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// writeSignatures writes signature packets as single armored signature block
+func writeSignatures(w io.Writer, packets [][]byte) error {
+	encoder, err := armor.Encode(w, signatureType, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range packets {
+		if _, err = encoder.Write(p); err != nil {
+			encoder.Close()
+			return err
+		}
+	}
+
+	return encoder.Close()
+}
+
+// DetachedSign signs file with all the signers, producing one detached signature
+func (m *MultiSigner) DetachedSign(source string, destination string) error {
+	signatures, err := m.sign(source, func(signer Signer, source, destination string) error {
+		return signer.DetachedSign(source, destination)
+	})
+	if err != nil {
+		return err
+	}
+
+	packets := make([][]byte, 0, len(signatures))
+	for _, signature := range signatures {
+		block, err := armor.Decode(bytes.NewReader(signature))
+		if err != nil {
+			return errors.Wrap(err, "error decoding detached signature")
+		}
+
+		packet, err := io.ReadAll(block.Body)
+		if err != nil {
+			return errors.Wrap(err, "error decoding detached signature")
+		}
+		packets = append(packets, packet)
+	}
+
+	var buf bytes.Buffer
+	if err = writeSignatures(&buf, packets); err != nil {
+		return errors.Wrap(err, "error combining detached signatures")
+	}
+
+	return errors.Wrap(os.WriteFile(destination, append(buf.Bytes(), '\n'), 0644), "error creating signature file")
+}
+
+// ClearSign clear-signs the file with all the signers
+//
+// Signed text is taken from the output of the first signer, as all the signatures
+// are calculated over the same canonical text.
+func (m *MultiSigner) ClearSign(source string, destination string) error {
+	outputs, err := m.sign(source, func(signer Signer, source, destination string) error {
+		return signer.ClearSign(source, destination)
+	})
+	if err != nil {
+		return err
+	}
+
+	hashes := []string{}
+	packets := make([][]byte, 0, len(outputs))
+	for _, output := range outputs {
+		block, _ := clearsign.Decode(output)
+		if block == nil {
+			return errors.New("error decoding clearsigned file")
+		}
+
+		for _, hash := range block.Headers["Hash"] {
+			for _, h := range strings.Split(hash, ",") {
+				h = strings.TrimSpace(h)
+				if h != "" && !contains(hashes, h) {
+					hashes = append(hashes, h)
+				}
+			}
+		}
+
+		packet, err := io.ReadAll(block.ArmoredSignature.Body)
+		if err != nil {
+			return errors.Wrap(err, "error decoding clearsigned signature")
+		}
+		packets = append(packets, packet)
+	}
+
+	// text is everything between the headers and the signature block, it is
+	// dash-escaped, so signature marker can't appear inside it
+	first := outputs[0]
+	headersEnd := bytes.Index(first, []byte("\n\n"))
+	textEnd := bytes.LastIndex(first, []byte(signatureBeginMarker))
+	if headersEnd == -1 || textEnd < headersEnd {
+		return errors.New("error decoding clearsigned file")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("-----BEGIN PGP SIGNED MESSAGE-----\n")
+	if len(hashes) > 0 {
+		buf.WriteString("Hash: " + strings.Join(hashes, ", ") + "\n")
+	}
+	buf.Write(first[headersEnd+1 : textEnd+1])
+
+	if err = writeSignatures(&buf, packets); err != nil {
+		return errors.Wrap(err, "error combining clearsigned signatures")
+	}
+	buf.WriteByte('\n')
+
+	return errors.Wrap(os.WriteFile(destination, buf.Bytes(), 0644), "error creating clearsigned file")
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package pgp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type MultiSignerSuite struct {
+	signer   *MultiSigner
+	verifier *GoVerifier
+
+	source, destination string
+}
+
+var _ = Suite(&MultiSignerSuite{})
+
+func (s *MultiSignerSuite) SetUpTest(c *C) {
+	oldKey := &GoSigner{}
+	oldKey.SetKey("21DBB89C16DB3E6D")
+	oldKey.SetKeyRing("../system/files/aptly.pub", "../system/files/aptly.sec")
+
+	newKey := &GoSigner{}
+	newKey.SetKey("F30E8CB9CDDE2AF8")
+	newKey.SetKeyRing("../system/files/aptly_passphrase.pub", "../system/files/aptly_passphrase.sec")
+	newKey.SetPassphrase("verysecret", "")
+
+	s.signer = NewMultiSigner(oldKey, newKey)
+	s.signer.SetBatch(true)
+	c.Assert(s.signer.Init(), IsNil)
+
+	s.verifier = &GoVerifier{}
+	s.verifier.AddKeyring("../system/files/aptly.pub")
+	s.verifier.AddKeyring("../system/files/aptly_passphrase.pub")
+	c.Assert(s.verifier.InitKeyring(false), IsNil)
+
+	tempDir := c.MkDir()
+	s.source = filepath.Join(tempDir, "Release")
+	s.destination = filepath.Join(tempDir, "Release.gpg")
+	c.Assert(os.WriteFile(s.source, []byte("Origin: test\n-Label: dash\nSuite: stable \n"), 0644), IsNil)
+}
+
+func (s *MultiSignerSuite) TestInitNoSigners(c *C) {
+	c.Check(NewMultiSigner().Init(), ErrorMatches, "no signers configured")
+}
+
+func (s *MultiSignerSuite) TestDetachedSign(c *C) {
+	c.Assert(s.signer.DetachedSign(s.source, s.destination), IsNil)
+
+	signature, err := os.Open(s.destination)
+	c.Assert(err, IsNil)
+	defer signature.Close()
+
+	cleartext, err := os.Open(s.source)
+	c.Assert(err, IsNil)
+	defer cleartext.Close()
+
+	signers, missingKeys, err := checkArmoredDetachedSignature(s.verifier.trustedKeyring, cleartext, signature)
+	c.Assert(err, IsNil)
+	c.Check(missingKeys, Equals, 0)
+	c.Assert(signers, HasLen, 2)
+	c.Check(KeyFromUint64(signers[0].IssuerKeyID), Equals, Key("21DBB89C16DB3E6D"))
+	c.Check(KeyFromUint64(signers[1].IssuerKeyID), Equals, Key("F30E8CB9CDDE2AF8"))
+}
+
+func (s *MultiSignerSuite) TestClearSign(c *C) {
+	c.Assert(s.signer.ClearSign(s.source, s.destination), IsNil)
+
+	clearsigned, err := os.Open(s.destination)
+	c.Assert(err, IsNil)
+	defer clearsigned.Close()
+
+	keyInfo, err := s.verifier.VerifyClearsigned(clearsigned, false)
+	c.Assert(err, IsNil)
+	c.Check(keyInfo.GoodKeys, DeepEquals, []Key{"21DBB89C16DB3E6D", "F30E8CB9CDDE2AF8"})
+	c.Check(keyInfo.MissingKeys, IsNil)
+
+	_, err = clearsigned.Seek(0, io.SeekStart)
+	c.Assert(err, IsNil)
+	extracted, err := s.verifier.ExtractClearsigned(clearsigned)
+	c.Assert(err, IsNil)
+	defer extracted.Close()
+
+	text, err := io.ReadAll(extracted)
+	c.Assert(err, IsNil)
+	c.Check(string(text), Equals, "Origin: test\r\n-Label: dash\r\nSuite: stable")
+}
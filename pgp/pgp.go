@@ -38,15 +38,26 @@ type KeyInfo struct {
 	MissingKeys []Key
 }
 
+// FileSigner interface describes facility signing files with already configured key(s)
+type FileSigner interface {
+	DetachedSign(source string, destination string) error
+	ClearSign(source string, destination string) error
+}
+
 // Signer interface describes facility implementing signing of files
 type Signer interface {
+	FileSigner
 	Init() error
 	SetKey(keyRef string)
 	SetKeyRing(keyring, secretKeyring string)
 	SetPassphrase(passphrase, passphraseFile string)
 	SetBatch(batch bool)
-	DetachedSign(source string, destination string) error
-	ClearSign(source string, destination string) error
+}
+
+// PublicKeyExporter is implemented by signers which can export public key used for signing,
+// e.g. to be installed on clients
+type PublicKeyExporter interface {
+	ExportPublicKey() ([]byte, error)
 }
 
 // Verifier interface describes signature verification factility
@@ -0,0 +1,71 @@
+package pgp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// NormalizeFingerprint converts fingerprint to upper-case hex without spaces and 0x prefix
+func NormalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ToUpper(strings.Join(strings.Fields(fingerprint), ""))
+	return strings.TrimPrefix(fingerprint, "0X")
+}
+
+// PinKeys parses public keys (ASCII armored or binary) and builds binary keyring with keys
+// matching pinned fingerprints
+//
+// Keys not matching any of fingerprints are dropped, error is returned if some of pinned keys
+// are missing.
+func PinKeys(keys []byte, fingerprints []string) ([]byte, error) {
+	if len(fingerprints) == 0 {
+		return nil, fmt.Errorf("no key fingerprints to pin")
+	}
+
+	var entities openpgp.EntityList
+	for _, block := range bytes.SplitAfter(keys, []byte("-----END PGP PUBLIC KEY BLOCK-----")) {
+		if len(bytes.TrimSpace(block)) == 0 {
+			continue
+		}
+
+		var (
+			list openpgp.EntityList
+			err  error
+		)
+		if bytes.Contains(block, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+			list, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(block))
+		} else {
+			list, err = openpgp.ReadKeyRing(bytes.NewReader(block))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse keys: %s", err)
+		}
+		entities = append(entities, list...)
+	}
+
+	var result bytes.Buffer
+	for _, fingerprint := range fingerprints {
+		fingerprint = NormalizeFingerprint(fingerprint)
+
+		found := false
+		for _, entity := range entities {
+			if fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint) != fingerprint {
+				continue
+			}
+
+			if err := entity.Serialize(&result); err != nil {
+				return nil, fmt.Errorf("unable to store key %s: %s", fingerprint, err)
+			}
+			found = true
+			break
+		}
+
+		if !found {
+			return nil, fmt.Errorf("key with fingerprint %s not found in fetched keys", fingerprint)
+		}
+	}
+
+	return result.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package pgp
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	. "gopkg.in/check.v1"
+)
+
+type PinKeysSuite struct{}
+
+var _ = Suite(&PinKeysSuite{})
+
+func (s *PinKeysSuite) TestNormalizeFingerprint(c *C) {
+	c.Check(NormalizeFingerprint("0xc5acd217 9b5231df"), Equals, "C5ACD2179B5231DF")
+	c.Check(NormalizeFingerprint("C5AC D217 9B52 31DF E842  EE61 21DB B89C 16DB 3E6D"), Equals, "C5ACD2179B5231DFE842EE6121DBB89C16DB3E6D")
+}
+
+func (s *PinKeysSuite) TestPinKeys(c *C) {
+	keys, err := os.ReadFile("../system/files/aptly.pub")
+	c.Assert(err, IsNil)
+
+	keyring, err := PinKeys(keys, []string{"c5acd2179b5231dfe842ee6121dbb89c16db3e6d"})
+	c.Assert(err, IsNil)
+
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(keyring))
+	c.Assert(err, IsNil)
+	c.Assert(entities, HasLen, 1)
+	c.Check(KeyFromUint64(entities[0].PrimaryKey.KeyId), Equals, Key("21DBB89C16DB3E6D"))
+
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	c.Assert(err, IsNil)
+	_, err = w.Write(keys)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	keyring, err = PinKeys(armored.Bytes(), []string{"C5AC D217 9B52 31DF E842  EE61 21DB B89C 16DB 3E6D"})
+	c.Assert(err, IsNil)
+	entities, err = openpgp.ReadKeyRing(bytes.NewReader(keyring))
+	c.Assert(err, IsNil)
+	c.Check(entities, HasLen, 1)
+
+	_, err = PinKeys(keys, []string{"0000000000000000000000000000000000000000"})
+	c.Check(err, ErrorMatches, "key with fingerprint 0000000000000000000000000000000000000000 not found in fetched keys")
+
+	_, err = PinKeys(keys, nil)
+	c.Check(err, ErrorMatches, "no key fingerprints to pin")
+
+	_, err = PinKeys([]byte("garbage"), []string{"C5ACD2179B5231DFE842EE6121DBB89C16DB3E6D"})
+	c.Check(err, ErrorMatches, "unable to parse keys.*")
+}
@@ -0,0 +1,252 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+)
+
+// Test interface
+var (
+	_ Signer            = &RemoteSigner{}
+	_ PublicKeyExporter = &RemoteSigner{}
+	_ crypto.Signer     = &remoteKey{}
+)
+
+// DigestSigner is remote signing service (e.g. KMS), which signs digests with RSA key
+// never leaving the service
+type DigestSigner interface {
+	// PublicKey returns public part of the key, empty keyRef selects default key
+	PublicKey(keyRef string) (crypto.PublicKey, error)
+	// SignDigest signs digest calculated with hash using RSASSA-PKCS1-v1_5
+	SignDigest(keyRef string, digest []byte, hash crypto.Hash) ([]byte, error)
+}
+
+// RemoteSigner is implementation of Signer interface, which produces OpenPGP signatures
+// with the key held by remote signing service
+//
+// OpenPGP public key (primary key or subkey) matching the key of signing service should be present
+// in the keyring, as OpenPGP key ID depends on key creation time and can't be derived from the key
+// itself.
+type RemoteSigner struct {
+	name        string
+	backend     DigestSigner
+	keyRef      string
+	keyringFile string
+
+	entity       *openpgp.Entity
+	signingKey   *packet.PrivateKey
+	signerConfig *packet.Config
+}
+
+// NewRemoteSigner creates new signer using remote signing service, name is used in messages
+func NewRemoteSigner(name string, backend DigestSigner, keyringFile string) *RemoteSigner {
+	return &RemoteSigner{name: name, backend: backend, keyringFile: keyringFile}
+}
+
+// SetBatch is no-op, remote signer never interacts with user
+func (r *RemoteSigner) SetBatch(_ bool) {
+}
+
+// SetKey sets reference to the key in remote signing service, overriding default key
+func (r *RemoteSigner) SetKey(keyRef string) {
+	r.keyRef = keyRef
+}
+
+// SetKeyRing sets keyring with OpenPGP public key, secret keyring is not used
+func (r *RemoteSigner) SetKeyRing(keyring, _ string) {
+	if keyring != "" {
+		r.keyringFile = keyring
+	}
+}
+
+// SetPassphrase is no-op, private key never leaves remote signing service
+func (r *RemoteSigner) SetPassphrase(_, _ string) {
+}
+
+// Init fetches public key from remote signing service and looks up matching OpenPGP key
+func (r *RemoteSigner) Init() error {
+	if r.keyringFile == "" {
+		return fmt.Errorf("%s: keyring with OpenPGP public key is not configured", r.name)
+	}
+
+	public, err := r.backend.PublicKey(r.keyRef)
+	if err != nil {
+		return errors.Wrapf(err, "%s: error fetching public key", r.name)
+	}
+
+	rsaPublic, ok := public.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%s: unsupported key type %T, only RSA keys are supported", r.name, public)
+	}
+
+	keyring, err := loadPublicKeyRing(r.keyringFile)
+	if err != nil {
+		return errors.Wrapf(err, "%s: error loading keyring", r.name)
+	}
+
+	for _, entity := range keyring {
+		keys := []*packet.PublicKey{entity.PrimaryKey}
+		for _, subkey := range entity.Subkeys {
+			keys = append(keys, subkey.PublicKey)
+		}
+
+		for i, key := range keys {
+			candidate, ok := key.PublicKey.(*rsa.PublicKey)
+			if !ok || !candidate.Equal(rsaPublic) {
+				continue
+			}
+
+			r.signingKey = &packet.PrivateKey{
+				PublicKey:  *key,
+				PrivateKey: &remoteKey{backend: r.backend, keyRef: r.keyRef, public: rsaPublic},
+			}
+
+			// entity is copied, so that keyring is not modified
+			signer := *entity
+			if i == 0 {
+				signer.PrivateKey = r.signingKey
+			} else {
+				signer.Subkeys = append([]openpgp.Subkey(nil), entity.Subkeys...)
+				signer.Subkeys[i-1].PrivateKey = r.signingKey
+			}
+
+			r.entity = &signer
+			r.signerConfig = &packet.Config{
+				DefaultHash:  crypto.SHA256,
+				SigningKeyId: key.KeyId,
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: couldn't find OpenPGP key matching remote key in keyring %s", r.name, r.keyringFile)
+}
+
+// ExportPublicKey exports OpenPGP public key in ASCII armor
+func (r *RemoteSigner) ExportPublicKey() ([]byte, error) {
+	if r.entity == nil {
+		if err := r.Init(); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.entity.Serialize(w); err != nil {
+		return nil, errors.Wrap(err, "error exporting public key")
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DetachedSign signs file with detached signature in ASCII format
+func (r *RemoteSigner) DetachedSign(source string, destination string) error {
+	fmt.Printf("%s: signing file '%s'...\n", r.name, filepath.Base(source))
+
+	message, err := os.Open(source)
+	if err != nil {
+		return errors.Wrap(err, "error opening source file")
+	}
+	defer message.Close()
+
+	signature, err := os.Create(destination)
+	if err != nil {
+		return errors.Wrap(err, "error creating signature file")
+	}
+	defer signature.Close()
+
+	err = openpgp.ArmoredDetachSign(signature, r.entity, message, r.signerConfig)
+	if err != nil {
+		return errors.Wrap(err, "error creating detached signature")
+	}
+
+	return nil
+}
+
+// ClearSign clear-signs the file
+func (r *RemoteSigner) ClearSign(source string, destination string) error {
+	fmt.Printf("%s: clearsigning file '%s'...\n", r.name, filepath.Base(source))
+
+	message, err := os.Open(source)
+	if err != nil {
+		return errors.Wrap(err, "error opening source file")
+	}
+	defer message.Close()
+
+	clearsigned, err := os.Create(destination)
+	if err != nil {
+		return errors.Wrap(err, "error creating clearsigned file")
+	}
+	defer clearsigned.Close()
+
+	stream, err := clearsign.Encode(clearsigned, r.signingKey, r.signerConfig)
+	if err != nil {
+		return errors.Wrap(err, "error initializing clear signer")
+	}
+
+	_, err = io.Copy(stream, message)
+	if err != nil {
+		stream.Close()
+		return errors.Wrap(err, "error generating clearsigned signature")
+	}
+
+	err = stream.Close()
+	if err != nil {
+		return errors.Wrap(err, "error generating clearsigned signature")
+	}
+
+	return nil
+}
+
+// remoteKey is crypto.Signer passing digests to remote signing service
+type remoteKey struct {
+	backend DigestSigner
+	keyRef  string
+	public  *rsa.PublicKey
+}
+
+func (k *remoteKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+func (k *remoteKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.backend.SignDigest(k.keyRef, digest, opts.HashFunc())
+}
+
+// loadPublicKeyRing loads keyring either in binary format or in ASCII armor
+func loadPublicKeyRing(name string) (openpgp.EntityList, error) {
+	// if path doesn't contain slashes, treat it as relative to GnuPG home directory
+	if !strings.Contains(name, "/") {
+		name = filepath.Join(gnupgHome, name)
+	}
+
+	contents, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(contents), []byte("-----BEGIN")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(contents))
+	}
+
+	return openpgp.ReadKeyRing(bytes.NewReader(contents))
+}
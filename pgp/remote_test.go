@@ -0,0 +1,200 @@
+package pgp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	. "gopkg.in/check.v1"
+)
+
+// localDigestSigner signs digests with local RSA key
+type localDigestSigner struct {
+	key *rsa.PrivateKey
+}
+
+func (l *localDigestSigner) PublicKey(_ string) (crypto.PublicKey, error) {
+	return &l.key.PublicKey, nil
+}
+
+func (l *localDigestSigner) SignDigest(_ string, digest []byte, hash crypto.Hash) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, l.key, hash, digest)
+}
+
+type RemoteSignerSuite struct {
+	entity  *openpgp.Entity
+	key     *rsa.PrivateKey
+	keyring string
+	source  string
+}
+
+var _ = Suite(&RemoteSignerSuite{})
+
+func (s *RemoteSignerSuite) SetUpSuite(c *C) {
+	var err error
+	s.entity, err = openpgp.NewEntity("Remote Signer", "", "remote@example.com", &packet.Config{
+		Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048})
+	c.Assert(err, IsNil)
+	s.key = s.entity.PrivateKey.PrivateKey.(*rsa.PrivateKey)
+}
+
+func (s *RemoteSignerSuite) SetUpTest(c *C) {
+	tempDir := c.MkDir()
+
+	s.keyring = filepath.Join(tempDir, "remote.gpg")
+	f, err := os.Create(s.keyring)
+	c.Assert(err, IsNil)
+	c.Assert(s.entity.Serialize(f), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	s.source = filepath.Join(tempDir, "Release")
+	c.Assert(os.WriteFile(s.source, []byte("Origin: aptly\nLabel: remote\n"), 0644), IsNil)
+}
+
+func (s *RemoteSignerSuite) verify(c *C, signer Signer) {
+	c.Assert(signer.Init(), IsNil)
+
+	verifier := &GoVerifier{}
+	verifier.AddKeyring(s.keyring)
+	c.Assert(verifier.InitKeyring(false), IsNil)
+
+	c.Assert(signer.DetachedSign(s.source, s.source+".gpg"), IsNil)
+
+	signature, err := os.Open(s.source + ".gpg")
+	c.Assert(err, IsNil)
+	defer signature.Close()
+	cleartext, err := os.Open(s.source)
+	c.Assert(err, IsNil)
+	defer cleartext.Close()
+
+	c.Check(verifier.VerifyDetachedSignature(signature, cleartext, false), IsNil)
+
+	c.Assert(signer.ClearSign(s.source, s.source+".asc"), IsNil)
+
+	clearsigned, err := os.Open(s.source + ".asc")
+	c.Assert(err, IsNil)
+	defer clearsigned.Close()
+
+	keyInfo, err := verifier.VerifyClearsigned(clearsigned, false)
+	c.Assert(err, IsNil)
+	c.Check(keyInfo.GoodKeys, DeepEquals, []Key{KeyFromUint64(s.entity.PrimaryKey.KeyId)})
+}
+
+func (s *RemoteSignerSuite) TestSign(c *C) {
+	s.verify(c, NewRemoteSigner("local", &localDigestSigner{key: s.key}, s.keyring))
+}
+
+func (s *RemoteSignerSuite) TestArmoredKeyring(c *C) {
+	signer := NewRemoteSigner("local", &localDigestSigner{key: s.key}, "")
+	c.Check(signer.Init(), ErrorMatches, "local: keyring with OpenPGP public key is not configured")
+
+	signer.SetKeyRing(s.keyring, "")
+	c.Assert(signer.Init(), IsNil)
+
+	armored, err := signer.ExportPublicKey()
+	c.Assert(err, IsNil)
+	c.Check(strings.HasPrefix(string(armored), "-----BEGIN PGP PUBLIC KEY BLOCK-----"), Equals, true)
+
+	armoredKeyring := filepath.Join(filepath.Dir(s.keyring), "remote.asc")
+	c.Assert(os.WriteFile(armoredKeyring, armored, 0644), IsNil)
+
+	s.verify(c, NewRemoteSigner("local", &localDigestSigner{key: s.key}, armoredKeyring))
+}
+
+func (s *RemoteSignerSuite) TestKeyMismatch(c *C) {
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	c.Assert(err, IsNil)
+
+	signer := NewRemoteSigner("local", &localDigestSigner{key: other}, s.keyring)
+	c.Check(signer.Init(), ErrorMatches, "local: couldn't find OpenPGP key matching remote key in keyring .*")
+}
+
+func (s *RemoteSignerSuite) TestVault(c *C) {
+	publicKey, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	c.Assert(err, IsNil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s3cret" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v1/pki-transit/keys/aptly":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"latest_version": 1,
+				"keys": map[string]interface{}{"1": map[string]string{
+					"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))}},
+			}})
+		case r.Method == "POST" && r.URL.Path == "/v1/pki-transit/sign/aptly/sha2-256":
+			var body struct {
+				Input              string `json:"input"`
+				Prehashed          bool   `json:"prehashed"`
+				SignatureAlgorithm string `json:"signature_algorithm"`
+			}
+			c.Check(json.NewDecoder(r.Body).Decode(&body), IsNil)
+			c.Check(body.Prehashed, Equals, true)
+			c.Check(body.SignatureAlgorithm, Equals, "pkcs1v15")
+
+			digest, _ := base64.StdEncoding.DecodeString(body.Input)
+			signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest)
+			c.Check(err, IsNil)
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+				"signature": "vault:v1:" + base64.StdEncoding.EncodeToString(signature)}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+	defer server.Close()
+
+	vault, err := NewVaultTransit(server.URL, "s3cret", "", "pki-transit", "aptly")
+	c.Assert(err, IsNil)
+	s.verify(c, NewRemoteSigner("vault", vault, s.keyring))
+
+	vault, err = NewVaultTransit(server.URL, "wrong", "", "pki-transit", "aptly")
+	c.Assert(err, IsNil)
+	c.Check(NewRemoteSigner("vault", vault, s.keyring).Init(), ErrorMatches, "vault: error fetching public key: vault: HTTP 403: permission denied")
+
+	vault, err = NewVaultTransit(server.URL, "s3cret", "", "pki-transit", "")
+	c.Assert(err, IsNil)
+	c.Check(NewRemoteSigner("vault", vault, s.keyring).Init(), ErrorMatches, ".*transit key is not specified")
+}
+
+func (s *RemoteSignerSuite) TestExternal(c *C) {
+	script := filepath.Join(c.MkDir(), "sign")
+	c.Assert(os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\"\ncat\n"), 0755), IsNil)
+
+	signer := NewExternalSigner([]string{script, "--armor"})
+	signer.SetKey("A0546A43624A8331")
+	c.Assert(signer.Init(), IsNil)
+
+	c.Assert(signer.ClearSign(s.source, s.source+".asc"), IsNil)
+	contents, err := os.ReadFile(s.source + ".asc")
+	c.Assert(err, IsNil)
+	c.Check(string(contents), Equals, "--armor --local-user A0546A43624A8331 --clearsign\nOrigin: aptly\nLabel: remote\n")
+
+	c.Assert(signer.DetachedSign(s.source, s.source+".gpg"), IsNil)
+	contents, err = os.ReadFile(s.source + ".gpg")
+	c.Assert(err, IsNil)
+	c.Check(strings.HasPrefix(string(contents), "--armor --local-user A0546A43624A8331 --detach-sign\n"), Equals, true)
+
+	c.Check(NewExternalSigner(nil).Init(), ErrorMatches, "external signer command is not configured")
+
+	failing := NewExternalSigner([]string{"sh", "-c", "echo no key >&2; exit 2", "sh"})
+	c.Assert(failing.Init(), IsNil)
+	c.Check(failing.ClearSign(s.source, s.source+".asc"), ErrorMatches, "external signer sh failed: exit status 2: no key")
+}
@@ -1,12 +1,14 @@
 package pgp
 
 import (
+	"bytes"
 	"crypto/rand"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	. "gopkg.in/check.v1"
 )
 
@@ -188,3 +190,23 @@ func (s *SignerSuite) TestClearSignPassphraseFile(c *C) {
 
 	s.testClearSign(c, s.passphraseKey)
 }
+
+func (s *SignerSuite) TestExportPublicKey(c *C) {
+	s.signer.SetKey(string(s.passphraseKey))
+	s.signer.SetKeyRing(s.keyringPassphrase[0], s.keyringPassphrase[1])
+
+	exporter, ok := s.signer.(PublicKeyExporter)
+	c.Assert(ok, Equals, true)
+
+	key, err := exporter.ExportPublicKey()
+	c.Assert(err, IsNil)
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	c.Assert(err, IsNil)
+	c.Assert(keyring, HasLen, 1)
+	c.Check(KeyFromUint64(keyring[0].PrimaryKey.KeyId), Equals, s.passphraseKey)
+
+	s.signer.SetKey("0000000000000000")
+	_, err = exporter.ExportPublicKey()
+	c.Check(err, NotNil)
+}
@@ -0,0 +1,192 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Test interface
+var (
+	_ DigestSigner = &VaultTransit{}
+)
+
+// vaultHashAlgorithms maps hash functions to transit engine names
+var vaultHashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA224: "sha2-224",
+	crypto.SHA256: "sha2-256",
+	crypto.SHA384: "sha2-384",
+	crypto.SHA512: "sha2-512",
+}
+
+// VaultTransit is DigestSigner using transit secrets engine of HashiCorp Vault
+type VaultTransit struct {
+	address string
+	token   string
+	mount   string
+	key     string
+	client  *http.Client
+}
+
+// NewVaultTransit creates signing backend using Vault transit engine mounted at mount
+//
+// If address or token are not set, they're taken from VAULT_ADDR and VAULT_TOKEN environment
+// variables, token might be read from tokenFile instead (e.g. written by Vault agent).
+func NewVaultTransit(address, token, tokenFile, mount, key string) (*VaultTransit, error) {
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("vault: address is not configured")
+	}
+
+	if token == "" && tokenFile != "" {
+		contents, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "vault: error reading token file")
+		}
+		token = strings.TrimSpace(string(contents))
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	if mount == "" {
+		mount = "transit"
+	}
+
+	return &VaultTransit{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		key:     key,
+		client:  &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (v *VaultTransit) keyName(keyRef string) (string, error) {
+	if keyRef == "" {
+		keyRef = v.key
+	}
+	if keyRef == "" {
+		return "", fmt.Errorf("vault: transit key is not specified")
+	}
+
+	return keyRef, nil
+}
+
+// request performs request to Vault API and decodes data from the response
+func (v *VaultTransit) request(method, path string, body interface{}, data interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, v.address+"/v1/"+v.mount+"/"+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("vault: error decoding response (HTTP %d): %s", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault: HTTP %d: %s", resp.StatusCode, strings.Join(response.Errors, ", "))
+	}
+
+	return json.Unmarshal(response.Data, data)
+}
+
+// PublicKey returns public key of the latest version of transit key
+func (v *VaultTransit) PublicKey(keyRef string) (crypto.PublicKey, error) {
+	name, err := v.keyName(keyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		LatestVersion int `json:"latest_version"`
+		Keys          map[string]struct {
+			PublicKey string `json:"public_key"`
+		} `json:"keys"`
+	}
+
+	if err = v.request("GET", "keys/"+name, nil, &data); err != nil {
+		return nil, err
+	}
+
+	key, ok := data.Keys[strconv.Itoa(data.LatestVersion)]
+	if !ok || key.PublicKey == "" {
+		return nil, fmt.Errorf("vault: public key of transit key %s is not available", name)
+	}
+
+	block, _ := pem.Decode([]byte(key.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("vault: unable to decode public key of transit key %s", name)
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// SignDigest signs digest with the latest version of transit key
+func (v *VaultTransit) SignDigest(keyRef string, digest []byte, hash crypto.Hash) ([]byte, error) {
+	name, err := v.keyName(keyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, ok := vaultHashAlgorithms[hash]
+	if !ok {
+		return nil, fmt.Errorf("vault: unsupported hash function %s", hash)
+	}
+
+	body := map[string]interface{}{
+		"input":               base64.StdEncoding.EncodeToString(digest),
+		"prehashed":           true,
+		"signature_algorithm": "pkcs1v15",
+	}
+
+	var data struct {
+		Signature string `json:"signature"`
+	}
+
+	if err = v.request("POST", "sign/"+name+"/"+algorithm, body, &data); err != nil {
+		return nil, err
+	}
+
+	// signature is prefixed with vault:v<version>:
+	parts := strings.SplitN(data.Signature, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("vault: unexpected signature format %q", data.Signature)
+	}
+
+	return base64.StdEncoding.DecodeString(parts[2])
+}
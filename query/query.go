@@ -21,6 +21,10 @@ import (
   operator := | << | < | <= | > | >> | >= | = | % | ~
 */
 
+func init() {
+	deb.PackageQueryParser = Parse
+}
+
 // Parse parses input package query into PackageQuery tree ready for evaluation
 func Parse(query string) (result deb.PackageQuery, err error) {
 	l, _ := lex("", query)
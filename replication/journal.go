@@ -0,0 +1,340 @@
+// Package replication implements following of primary aptly instance by replicas
+package replication
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/pborman/uuid"
+)
+
+// Keys of replication state in DB, all of them start with "J" and are never replicated
+var (
+	// prefix of journal entries, followed by big endian sequence number
+	journalPrefix = []byte("J:")
+	// last sequence number written to journal
+	journalSeqKey = []byte("J#")
+	// random ID of journal, changes when primary DB is recreated
+	journalEpochKey = []byte("J@")
+	// position of replica in journal of primary
+	replicaStateKey = []byte("J>")
+)
+
+// DefaultJournalSize is number of changes kept in journal if not configured
+const DefaultJournalSize = 100000
+
+// pruneEvery is how often (in number of changes) journal is pruned
+const pruneEvery = 1000
+
+var errStopIteration = errors.New("stop iteration")
+
+// IsInternalKey checks whether key is replication state, which is never replicated
+func IsInternalKey(key []byte) bool {
+	return len(key) > 0 && key[0] == 'J'
+}
+
+func journalKey(seq uint64) []byte {
+	key := make([]byte, len(journalPrefix)+8)
+	copy(key, journalPrefix)
+	binary.BigEndian.PutUint64(key[len(journalPrefix):], seq)
+	return key
+}
+
+func encodeSeq(seq uint64) []byte {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, seq)
+	return value
+}
+
+func decodeSeq(value []byte) (uint64, error) {
+	if len(value) != 8 {
+		return 0, fmt.Errorf("malformed sequence number")
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// Journal is database.Storage which records keys of all the changes into
+// the journal kept in the same database, so that replicas could follow them
+//
+// Only the keys are journaled: values are read from the database when changes
+// are sent to replica.
+type Journal struct {
+	database.Storage
+
+	size   int
+	lock   sync.Mutex
+	seq    uint64
+	loaded bool
+}
+
+// NewJournal wraps storage with journal keeping last size changes
+func NewJournal(storage database.Storage, size int) *Journal {
+	if size <= 0 {
+		size = DefaultJournalSize
+	}
+
+	return &Journal{Storage: storage, size: size}
+}
+
+// Open opens database and loads journal state
+func (j *Journal) Open() error {
+	if err := j.Storage.Open(); err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.load(j.Storage)
+}
+
+// Close closes database, journal state is reloaded on next open as database
+// might be modified by other process meanwhile
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	j.loaded = false
+	j.lock.Unlock()
+
+	return j.Storage.Close()
+}
+
+// load reads journal state, should be called with lock held
+func (j *Journal) load(rw database.ReaderWriter) error {
+	if j.loaded {
+		return nil
+	}
+
+	value, err := rw.Get(journalSeqKey)
+	if err == database.ErrNotFound {
+		j.seq = 0
+	} else if err != nil {
+		return err
+	} else if j.seq, err = decodeSeq(value); err != nil {
+		return err
+	}
+
+	_, err = rw.Get(journalEpochKey)
+	if err == database.ErrNotFound {
+		err = rw.Put(journalEpochKey, []byte(uuid.New()))
+	}
+	if err != nil {
+		return err
+	}
+
+	j.loaded = true
+	return nil
+}
+
+// record writes journal entries for keys, should be called with lock held
+//
+// Journal state is loaded via rw, which is either the transaction being committed or the storage itself.
+func (j *Journal) record(rw database.ReaderWriter, w database.Writer, keys [][]byte) error {
+	if err := j.load(rw); err != nil {
+		return err
+	}
+
+	seq := j.seq
+	for _, key := range keys {
+		if IsInternalKey(key) {
+			continue
+		}
+
+		seq++
+		if err := w.Put(journalKey(seq), key); err != nil {
+			return err
+		}
+	}
+
+	if seq == j.seq {
+		return nil
+	}
+
+	if err := w.Put(journalSeqKey, encodeSeq(seq)); err != nil {
+		return err
+	}
+
+	// if write fails, sequence number is reloaded from the database
+	j.loaded = false
+	j.seq = seq
+
+	return nil
+}
+
+// committed is called after journal entries were written, should be called with lock held
+func (j *Journal) committed(previous uint64) {
+	j.loaded = true
+
+	if previous/pruneEvery != j.seq/pruneEvery && j.seq > uint64(j.size) {
+		_ = j.prune(j.seq - uint64(j.size))
+	}
+}
+
+// prune removes journal entries up to (including) seq
+func (j *Journal) prune(seq uint64) error {
+	keys := [][]byte{}
+	last := journalKey(seq)
+
+	err := j.Storage.ProcessByPrefix(journalPrefix, func(key, _ []byte) error {
+		if bytes.Compare(key, last) > 0 {
+			return errStopIteration
+		}
+		keys = append(keys, append([]byte(nil), key...))
+		return nil
+	})
+	if err != nil && err != errStopIteration {
+		return err
+	}
+
+	batch := j.Storage.CreateBatch()
+	for _, key := range keys {
+		if err = batch.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return batch.Write()
+}
+
+// changed checks whether writing value for key changes anything
+func changed(r database.Reader, key, value []byte) bool {
+	old, err := r.Get(key)
+	if err != nil {
+		return true
+	}
+
+	return !bytes.Equal(old, value)
+}
+
+// Put saves key to database and journals the change
+func (j *Journal) Put(key []byte, value []byte) error {
+	if IsInternalKey(key) || !changed(j.Storage, key, value) {
+		return j.Storage.Put(key, value)
+	}
+
+	batch := j.CreateBatch()
+	if err := batch.Put(key, value); err != nil {
+		return err
+	}
+
+	return batch.Write()
+}
+
+// Delete removes key from database and journals the change
+func (j *Journal) Delete(key []byte) error {
+	if IsInternalKey(key) {
+		return j.Storage.Delete(key)
+	}
+
+	batch := j.CreateBatch()
+	if err := batch.Delete(key); err != nil {
+		return err
+	}
+
+	return batch.Write()
+}
+
+// CreateBatch creates batch which journals changes when written
+func (j *Journal) CreateBatch() database.Batch {
+	return &journalBatch{Batch: j.Storage.CreateBatch(), journal: j}
+}
+
+// OpenTransaction opens transaction which journals changes when committed
+func (j *Journal) OpenTransaction() (database.Transaction, error) {
+	transaction, err := j.Storage.OpenTransaction()
+	if err != nil {
+		return nil, err
+	}
+
+	return &journalTransaction{Transaction: transaction, journal: j}, nil
+}
+
+type journalBatch struct {
+	database.Batch
+
+	journal *Journal
+	keys    [][]byte
+}
+
+func (b *journalBatch) Put(key, value []byte) error {
+	if changed(b.journal.Storage, key, value) {
+		b.keys = append(b.keys, append([]byte(nil), key...))
+	}
+
+	return b.Batch.Put(key, value)
+}
+
+func (b *journalBatch) Delete(key []byte) error {
+	b.keys = append(b.keys, append([]byte(nil), key...))
+
+	return b.Batch.Delete(key)
+}
+
+func (b *journalBatch) Write() error {
+	j := b.journal
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	previous := j.seq
+	if err := j.record(j.Storage, b.Batch, b.keys); err != nil {
+		return err
+	}
+
+	if err := b.Batch.Write(); err != nil {
+		return err
+	}
+
+	j.committed(previous)
+	return nil
+}
+
+type journalTransaction struct {
+	database.Transaction
+
+	journal *Journal
+	keys    [][]byte
+}
+
+func (t *journalTransaction) Put(key, value []byte) error {
+	if changed(t.Transaction, key, value) {
+		t.keys = append(t.keys, append([]byte(nil), key...))
+	}
+
+	return t.Transaction.Put(key, value)
+}
+
+func (t *journalTransaction) Delete(key []byte) error {
+	t.keys = append(t.keys, append([]byte(nil), key...))
+
+	return t.Transaction.Delete(key)
+}
+
+func (t *journalTransaction) Commit() error {
+	j := t.journal
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	previous := j.seq
+	if err := j.record(t.Transaction, t.Transaction, t.keys); err != nil {
+		return err
+	}
+
+	if err := t.Transaction.Commit(); err != nil {
+		return err
+	}
+
+	j.committed(previous)
+	return nil
+}
+
+// Check interfaces
+var (
+	_ database.Storage     = &Journal{}
+	_ database.Batch       = &journalBatch{}
+	_ database.Transaction = &journalTransaction{}
+)
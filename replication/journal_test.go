@@ -0,0 +1,159 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+
+	. "gopkg.in/check.v1"
+)
+
+// Launch gocheck tests
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type JournalSuite struct {
+	db      database.Storage
+	journal *Journal
+}
+
+var _ = Suite(&JournalSuite{})
+
+func (s *JournalSuite) SetUpTest(c *C) {
+	var err error
+
+	s.db, err = goleveldb.NewOpenDB(c.MkDir())
+	c.Assert(err, IsNil)
+
+	s.journal = NewJournal(s.db, 10)
+	c.Assert(s.journal.Open(), IsNil)
+}
+
+func (s *JournalSuite) TearDownTest(c *C) {
+	s.journal.Close()
+}
+
+func keys(changes *Changes) []string {
+	result := []string{}
+	for _, change := range changes.Changes {
+		if change.Deleted {
+			result = append(result, "-"+string(change.Key))
+		} else {
+			result = append(result, string(change.Key)+"="+string(change.Value))
+		}
+	}
+	return result
+}
+
+func (s *JournalSuite) TestChanges(c *C) {
+	status, err := ReadStatus(s.journal)
+	c.Assert(err, IsNil)
+	c.Check(status.Head, Equals, uint64(0))
+	c.Check(status.Epoch, Not(Equals), "")
+
+	c.Assert(s.journal.Put([]byte("La"), []byte("1")), IsNil)
+	c.Assert(s.journal.Put([]byte("Lb"), []byte("2")), IsNil)
+	// unchanged value is not journaled
+	c.Assert(s.journal.Put([]byte("Lb"), []byte("2")), IsNil)
+
+	batch := s.journal.CreateBatch()
+	c.Assert(batch.Put([]byte("Lc"), []byte("3")), IsNil)
+	c.Assert(batch.Delete([]byte("La")), IsNil)
+	c.Assert(batch.Write(), IsNil)
+
+	transaction, err := s.journal.OpenTransaction()
+	c.Assert(err, IsNil)
+	c.Assert(transaction.Put([]byte("Ld"), []byte("4")), IsNil)
+	c.Assert(transaction.Put([]byte("Lb"), []byte("5")), IsNil)
+	c.Assert(transaction.Commit(), IsNil)
+
+	transaction, err = s.journal.OpenTransaction()
+	c.Assert(err, IsNil)
+	c.Assert(transaction.Put([]byte("Le"), []byte("6")), IsNil)
+	transaction.Discard()
+
+	changes, err := ReadChanges(s.journal, 0, 0)
+	c.Assert(err, IsNil)
+	c.Check(changes.Epoch, Equals, status.Epoch)
+	c.Check(changes.Head, Equals, uint64(6))
+	c.Check(changes.Seq, Equals, uint64(6))
+	// latest value of the key is returned once
+	c.Check(keys(changes), DeepEquals, []string{"-La", "Lb=5", "Lc=3", "Ld=4"})
+
+	changes, err = ReadChanges(s.journal, 3, 2)
+	c.Assert(err, IsNil)
+	c.Check(changes.Seq, Equals, uint64(5))
+	c.Check(keys(changes), DeepEquals, []string{"-La", "Ld=4"})
+
+	changes, err = ReadChanges(s.journal, 6, 0)
+	c.Assert(err, IsNil)
+	c.Check(changes.Seq, Equals, uint64(6))
+	c.Check(changes.Changes, HasLen, 0)
+
+	// journal is kept across reopening
+	c.Assert(s.journal.Close(), IsNil)
+	c.Assert(s.journal.Open(), IsNil)
+	c.Assert(s.journal.Delete([]byte("Lc")), IsNil)
+
+	changes, err = ReadChanges(s.journal, 6, 0)
+	c.Assert(err, IsNil)
+	c.Check(changes.Seq, Equals, uint64(7))
+	c.Check(keys(changes), DeepEquals, []string{"-Lc"})
+
+	_, err = ReadChanges(s.db, 0, 0)
+	c.Check(err, IsNil)
+}
+
+func (s *JournalSuite) TestPrune(c *C) {
+	for i := 0; i < pruneEvery+5; i++ {
+		c.Assert(s.journal.Put([]byte(fmt.Sprintf("L%04d", i)), []byte("x")), IsNil)
+	}
+
+	status, err := ReadStatus(s.journal)
+	c.Assert(err, IsNil)
+	c.Check(status.Head, Equals, uint64(pruneEvery+5))
+	c.Check(status.First, Equals, uint64(pruneEvery-9))
+
+	_, err = ReadChanges(s.journal, 100, 0)
+	c.Check(err, Equals, ErrJournalTruncated)
+
+	changes, err := ReadChanges(s.journal, pruneEvery, 0)
+	c.Assert(err, IsNil)
+	c.Check(changes.Changes, HasLen, 5)
+}
+
+func (s *JournalSuite) TestNoJournal(c *C) {
+	db, err := goleveldb.NewOpenDB(c.MkDir())
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = ReadChanges(db, 0, 0)
+	c.Check(err, Equals, ErrNoJournal)
+}
+
+func (s *JournalSuite) TestDump(c *C) {
+	c.Assert(s.journal.Put([]byte("La"), []byte("1")), IsNil)
+	c.Assert(s.journal.Put([]byte("Pb"), []byte("2")), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(Dump(s.journal, &buf), IsNil)
+
+	decoder := json.NewDecoder(&buf)
+
+	var header DumpHeader
+	c.Assert(decoder.Decode(&header), IsNil)
+	c.Check(header.Seq, Equals, uint64(2))
+
+	dumped := []string{}
+	for decoder.More() {
+		var change Change
+		c.Assert(decoder.Decode(&change), IsNil)
+		dumped = append(dumped, string(change.Key)+"="+string(change.Value))
+	}
+	c.Check(dumped, DeepEquals, []string{"La=1", "Pb=2"})
+}
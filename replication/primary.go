@@ -0,0 +1,173 @@
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/aptly-dev/aptly/database"
+)
+
+// Errors returned to replicas
+var (
+	ErrNoJournal        = errors.New("replication journal is not enabled")
+	ErrJournalTruncated = errors.New("requested changes are no longer in the journal, full resync is required")
+)
+
+// DefaultPageSize is maximum number of changes returned at once if not specified
+const DefaultPageSize = 1000
+
+// Status describes journal of primary
+type Status struct {
+	// ID of journal, changes when database is recreated
+	Epoch string
+	// Sequence number of the last change
+	Head uint64
+	// Sequence number of the oldest change still in the journal
+	First uint64
+}
+
+// Change is a single change of key in database
+type Change struct {
+	Key     []byte
+	Value   []byte `json:",omitempty"`
+	Deleted bool   `json:",omitempty"`
+}
+
+// Changes is a page of changes read from journal
+type Changes struct {
+	Epoch string
+	// Sequence number of the last change in the journal
+	Head uint64
+	// Sequence number of the last change in this page
+	Seq     uint64
+	Changes []Change
+}
+
+// DumpHeader starts full database dump, it is followed by Change entries
+type DumpHeader struct {
+	Epoch string
+	// Sequence number of the last change included into the dump
+	Seq uint64
+}
+
+// ReadStatus returns status of journal in database
+func ReadStatus(db database.Storage) (*Status, error) {
+	epoch, err := db.Get(journalEpochKey)
+	if err == database.ErrNotFound {
+		return nil, ErrNoJournal
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Epoch: string(epoch)}
+
+	value, err := db.Get(journalSeqKey)
+	if err == nil {
+		status.Head, err = decodeSeq(value)
+	} else if err == database.ErrNotFound {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status.First = status.Head + 1
+	err = db.ProcessByPrefix(journalPrefix, func(key, _ []byte) error {
+		status.First, err = decodeSeq(key[len(journalPrefix):])
+		if err != nil {
+			return err
+		}
+		return errStopIteration
+	})
+	if err != nil && err != errStopIteration {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// ReadChanges returns up to limit changes from journal which happened after since
+//
+// Values are read from the database, so change always has the latest value of the key.
+func ReadChanges(db database.Storage, since uint64, limit int) (*Changes, error) {
+	status, err := ReadStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if since+1 < status.First && since != status.Head {
+		return nil, ErrJournalTruncated
+	}
+
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	result := &Changes{Epoch: status.Epoch, Head: status.Head, Seq: since, Changes: []Change{}}
+	seen := map[string]int{}
+	start := journalKey(since)
+
+	err = db.ProcessByPrefix(journalPrefix, func(key, value []byte) error {
+		if string(key) <= string(start) {
+			return nil
+		}
+		if len(result.Changes) >= limit {
+			return errStopIteration
+		}
+
+		result.Seq, err = decodeSeq(key[len(journalPrefix):])
+		if err != nil {
+			return err
+		}
+
+		// change of the same key is sent only once
+		if _, ok := seen[string(value)]; ok {
+			return nil
+		}
+		seen[string(value)] = len(result.Changes)
+		result.Changes = append(result.Changes, Change{Key: append([]byte(nil), value...)})
+		return nil
+	})
+	if err != nil && err != errStopIteration {
+		return nil, err
+	}
+
+	for i := range result.Changes {
+		change := &result.Changes[i]
+
+		change.Value, err = db.Get(change.Key)
+		if err == database.ErrNotFound {
+			change.Deleted = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Dump writes contents of the whole database (except for replication state) to w
+//
+// Dump starts with DumpHeader, changes done after the change with sequence number
+// in the header might be included into the dump as well.
+func Dump(db database.Storage, w io.Writer) error {
+	status, err := ReadStatus(db)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	if err = encoder.Encode(DumpHeader{Epoch: status.Epoch, Seq: status.Head}); err != nil {
+		return err
+	}
+
+	return db.ProcessByPrefix([]byte{}, func(key, value []byte) error {
+		if IsInternalKey(key) {
+			return nil
+		}
+
+		return encoder.Encode(Change{Key: key, Value: value})
+	})
+}
@@ -0,0 +1,376 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/ugorji/go/codec"
+)
+
+// batchSize is number of keys written to database at once during full resync
+const batchSize = 1000
+
+// Replica follows journal of primary aptly instance, copying database
+// changes and package files missing in local package pool
+type Replica struct {
+	// Base URL of primary aptly API, e.g. http://primary:8080
+	PrimaryURL string
+	// Token to authenticate to primary (sent as bearer token), optional
+	Token string
+	// Number of changes requested at once
+	PageSize int
+
+	Client *http.Client
+	DB     database.Storage
+	Pool   aptly.PackagePool
+}
+
+// State is position of replica in the journal of primary
+type State struct {
+	Epoch string
+	Seq   uint64
+	// Time of last sync
+	SyncedAt time.Time
+}
+
+// SyncResult describes what was changed by sync
+type SyncResult struct {
+	// Whether whole database was copied from primary
+	FullResync bool
+	// Number of keys changed
+	Changes int
+	// Number of package files downloaded from primary
+	Files int
+	// Published repositories updated or added on primary, they should be published locally
+	Published []*deb.PublishedRepo
+	// Published repositories dropped on primary
+	Dropped []*deb.PublishedRepo
+	// Position in journal of primary after sync
+	Seq uint64
+	// Last change in journal of primary
+	Head uint64
+}
+
+// LoadState returns current position of replica, nil if replica has never been synced
+func LoadState(db database.Reader) (*State, error) {
+	value, err := db.Get(replicaStateKey)
+	if err == database.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{}
+	return state, json.Unmarshal(value, state)
+}
+
+func saveState(w database.Writer, state *State) error {
+	state.SyncedAt = time.Now()
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return w.Put(replicaStateKey, value)
+}
+
+// Sync brings replica up to date with primary
+//
+// Changes are followed from the journal of primary, the whole database is copied
+// if replica has never been synced or if journal of primary doesn't contain
+// all the changes since last sync anymore.
+func (r *Replica) Sync(ctx context.Context) (*SyncResult, error) {
+	state, err := LoadState(r.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{}
+
+	if state == nil {
+		return result, r.fullResync(ctx, result)
+	}
+
+	for {
+		var changes *Changes
+
+		changes, err = r.fetchChanges(ctx, state.Seq)
+		if err == ErrJournalTruncated || (err == nil && changes.Epoch != state.Epoch) {
+			return result, r.fullResync(ctx, result)
+		}
+		if err != nil {
+			return result, err
+		}
+
+		state.Seq = changes.Seq
+		err = r.apply(ctx, changes.Changes, state, result)
+		if err != nil {
+			return result, err
+		}
+
+		result.Seq, result.Head = changes.Seq, changes.Head
+		if changes.Seq >= changes.Head || len(changes.Changes) == 0 {
+			return result, nil
+		}
+	}
+}
+
+// request performs GET request to primary API
+func (r *Replica) request(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := strings.TrimSuffix(r.PrimaryURL, "/") + "/api/replication/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusGone {
+		resp.Body.Close()
+		return nil, ErrJournalTruncated
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("GET %s: unexpected response %s: %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return resp, nil
+}
+
+func (r *Replica) fetchChanges(ctx context.Context, since uint64) (*Changes, error) {
+	query := url.Values{}
+	query.Set("since", fmt.Sprintf("%d", since))
+	if r.PageSize > 0 {
+		query.Set("limit", fmt.Sprintf("%d", r.PageSize))
+	}
+
+	resp, err := r.request(ctx, "changes", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	changes := &Changes{}
+	return changes, json.NewDecoder(resp.Body).Decode(changes)
+}
+
+// prepare fetches package files and records published repositories affected by change,
+// it should be called before change is written to the database
+func (r *Replica) prepare(ctx context.Context, change *Change, result *SyncResult) error {
+	result.Changes++
+
+	switch {
+	case change.Deleted && bytes.HasPrefix(change.Key, []byte("U")):
+		value, err := r.DB.Get(change.Key)
+		if err == database.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		published := &deb.PublishedRepo{}
+		if err = published.Decode(value); err != nil {
+			return err
+		}
+		result.Dropped = append(result.Dropped, published)
+	case change.Deleted:
+	case bytes.HasPrefix(change.Key, []byte("U")):
+		published := &deb.PublishedRepo{}
+		if err := published.Decode(change.Value); err != nil {
+			return err
+		}
+		result.Published = append(result.Published, published)
+	case bytes.HasPrefix(change.Key, []byte("xF")):
+		return r.fetchFiles(ctx, change.Value, result)
+	}
+
+	return nil
+}
+
+// apply writes changes and state to the database
+func (r *Replica) apply(ctx context.Context, changes []Change, state *State, result *SyncResult) error {
+	batch := r.DB.CreateBatch()
+
+	for i := range changes {
+		change := &changes[i]
+
+		if IsInternalKey(change.Key) {
+			continue
+		}
+
+		if err := r.prepare(ctx, change, result); err != nil {
+			return err
+		}
+
+		var err error
+		if change.Deleted {
+			err = batch.Delete(change.Key)
+		} else {
+			err = batch.Put(change.Key, change.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := saveState(batch, state); err != nil {
+		return err
+	}
+
+	return batch.Write()
+}
+
+// fullResync replaces contents of the database with dump of primary database
+func (r *Replica) fullResync(ctx context.Context, result *SyncResult) error {
+	result.FullResync = true
+
+	resp, err := r.request(ctx, "dump", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+
+	var header DumpHeader
+	if err = decoder.Decode(&header); err != nil {
+		return fmt.Errorf("unable to read dump: %s", err)
+	}
+
+	seen := map[string]struct{}{}
+	changes := make([]Change, 0, batchSize)
+
+	for {
+		var change Change
+
+		err = decoder.Decode(&change)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read dump: %s", err)
+		}
+
+		seen[string(change.Key)] = struct{}{}
+		changes = append(changes, change)
+
+		if len(changes) == batchSize {
+			if err = r.apply(ctx, changes, &State{}, result); err != nil {
+				return err
+			}
+			changes = changes[:0]
+		}
+	}
+
+	// keys missing in the dump have been removed on primary
+	err = r.DB.ProcessByPrefix([]byte{}, func(key, _ []byte) error {
+		if _, ok := seen[string(key)]; !ok && !IsInternalKey(key) {
+			changes = append(changes, Change{Key: append([]byte(nil), key...), Deleted: true})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	result.Seq, result.Head = header.Seq, header.Seq
+
+	return r.apply(ctx, changes, &State{Epoch: header.Epoch, Seq: header.Seq}, result)
+}
+
+// fetchFiles downloads package files missing in the pool
+func (r *Replica) fetchFiles(ctx context.Context, value []byte, result *SyncResult) error {
+	var files deb.PackageFiles
+
+	if err := codec.NewDecoderBytes(value, &codec.MsgpackHandle{}).Decode(&files); err != nil {
+		return fmt.Errorf("unable to decode package files: %s", err)
+	}
+
+	checksumStorage := deb.NewChecksumCollection(r.DB)
+
+	for i := range files {
+		f := &files[i]
+
+		exists, err := f.Verify(r.Pool, checksumStorage)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		poolPath, err := f.GetPoolPath(r.Pool)
+		if err != nil {
+			return err
+		}
+
+		if err = r.fetchFile(ctx, poolPath, f, checksumStorage); err != nil {
+			return err
+		}
+		result.Files++
+	}
+
+	return nil
+}
+
+// fetchFile downloads single file from the pool of primary and imports it into local pool
+func (r *Replica) fetchFile(ctx context.Context, poolPath string, f *deb.PackageFile, checksumStorage aptly.ChecksumStorage) error {
+	resp, err := r.request(ctx, "pool/"+poolPath, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	temp, err := os.CreateTemp("", "aptly-replica")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	checksums := utils.NewChecksumWriter()
+	if _, err = io.Copy(io.MultiWriter(temp, checksums), resp.Body); err != nil {
+		return fmt.Errorf("unable to download %s: %s", poolPath, err)
+	}
+
+	actual := checksums.Sum()
+	if actual.Size != f.Checksums.Size || (f.Checksums.SHA256 != "" && actual.SHA256 != f.Checksums.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s: expected %d/%s, got %d/%s", poolPath,
+			f.Checksums.Size, f.Checksums.SHA256, actual.Size, actual.SHA256)
+	}
+
+	_, err = r.Pool.Import(temp.Name(), f.Filename, &actual, true, checksumStorage)
+	return err
+}
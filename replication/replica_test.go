@@ -0,0 +1,160 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aptly-dev/aptly/database"
+	"github.com/aptly-dev/aptly/database/goleveldb"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+	"github.com/ugorji/go/codec"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReplicaSuite struct {
+	primary     *Journal
+	primaryPool *files.PackagePool
+	server      *httptest.Server
+	replica     *Replica
+}
+
+var _ = Suite(&ReplicaSuite{})
+
+func (s *ReplicaSuite) SetUpTest(c *C) {
+	db, err := goleveldb.NewOpenDB(c.MkDir())
+	c.Assert(err, IsNil)
+	s.primary = NewJournal(db, 100)
+	c.Assert(s.primary.Open(), IsNil)
+	s.primaryPool = files.NewPackagePool(c.MkDir(), false)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/replication/changes", func(w http.ResponseWriter, r *http.Request) {
+		since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+		changes, err := ReadChanges(s.primary, since, 2)
+		if err == ErrJournalTruncated {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		c.Assert(err, IsNil)
+		c.Assert(json.NewEncoder(w).Encode(changes), IsNil)
+	})
+	mux.HandleFunc("/api/replication/dump", func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(Dump(s.primary, w), IsNil)
+	})
+	mux.HandleFunc("/api/replication/pool/", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, s.primaryPool.FullPath(strings.TrimPrefix(r.URL.Path, "/api/replication/pool/")))
+	})
+	s.server = httptest.NewServer(mux)
+
+	replicaDB, err := goleveldb.NewOpenDB(c.MkDir())
+	c.Assert(err, IsNil)
+
+	s.replica = &Replica{
+		PrimaryURL: s.server.URL,
+		DB:         replicaDB,
+		Pool:       files.NewPackagePool(c.MkDir(), false),
+	}
+}
+
+func (s *ReplicaSuite) TearDownTest(c *C) {
+	s.server.Close()
+	s.primary.Close()
+	s.replica.DB.Close()
+}
+
+// addFile imports file into pool of primary and records it in the database
+func (s *ReplicaSuite) addFile(c *C, key, filename, contents string) {
+	path := filepath.Join(c.MkDir(), filename)
+	c.Assert(os.WriteFile(path, []byte(contents), 0644), IsNil)
+
+	checksums, err := utils.ChecksumsForFile(path)
+	c.Assert(err, IsNil)
+
+	poolPath, err := s.primaryPool.Import(path, filename, &checksums, false, deb.NewChecksumCollection(s.primary))
+	c.Assert(err, IsNil)
+
+	var encoded []byte
+	packageFiles := deb.PackageFiles{{Filename: filename, Checksums: checksums, PoolPath: poolPath}}
+	c.Assert(codec.NewEncoderBytes(&encoded, &codec.MsgpackHandle{}).Encode(packageFiles), IsNil)
+	c.Assert(s.primary.Put([]byte(key), encoded), IsNil)
+}
+
+func (s *ReplicaSuite) checkSame(c *C) {
+	expected, actual := map[string]string{}, map[string]string{}
+
+	collect := func(db database.Storage, result map[string]string) {
+		c.Assert(db.ProcessByPrefix([]byte{}, func(key, value []byte) error {
+			if !IsInternalKey(key) {
+				result[string(key)] = string(value)
+			}
+			return nil
+		}), IsNil)
+	}
+
+	collect(s.primary, expected)
+	collect(s.replica.DB, actual)
+	c.Check(actual, DeepEquals, expected)
+}
+
+func (s *ReplicaSuite) TestSync(c *C) {
+	c.Assert(s.primary.Put([]byte("La"), []byte("1")), IsNil)
+	c.Assert(s.primary.Put([]byte("Lb"), []byte("2")), IsNil)
+	s.addFile(c, "xFPall a 1.0 1", "a_1.0_all.deb", "package a")
+
+	// initial sync copies whole database
+	result, err := s.replica.Sync(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.FullResync, Equals, true)
+	c.Check(result.Files, Equals, 1)
+	s.checkSame(c)
+
+	state, err := LoadState(s.replica.DB)
+	c.Assert(err, IsNil)
+	c.Check(state.Seq, Equals, result.Head)
+
+	// changes are followed from the journal, page by page
+	c.Assert(s.primary.Delete([]byte("La")), IsNil)
+	c.Assert(s.primary.Put([]byte("Lb"), []byte("3")), IsNil)
+	c.Assert(s.primary.Put([]byte("Lc"), []byte("4")), IsNil)
+	s.addFile(c, "xFPall b 1.0 2", "b_1.0_all.deb", "package b")
+
+	result, err = s.replica.Sync(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.FullResync, Equals, false)
+	// checksum of imported file (and its index by SHA256) is recorded on primary as well
+	c.Check(result.Changes, Equals, 6)
+	c.Check(result.Files, Equals, 1)
+	c.Check(result.Seq, Equals, result.Head)
+	s.checkSame(c)
+
+	checksums, err := utils.ChecksumsForReader(strings.NewReader("package b"))
+	c.Assert(err, IsNil)
+	exists, err := (&deb.PackageFile{Filename: "b_1.0_all.deb", Checksums: checksums}).Verify(s.replica.Pool, deb.NewChecksumCollection(s.replica.DB))
+	c.Assert(err, IsNil)
+	c.Check(exists, Equals, true)
+
+	// nothing to do
+	result, err = s.replica.Sync(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.Changes, Equals, 0)
+
+	// journal has been recreated on primary
+	c.Assert(s.primary.Storage.Put(journalEpochKey, []byte("new")), IsNil)
+	c.Assert(s.primary.Put([]byte("Ld"), []byte("5")), IsNil)
+	c.Assert(s.replica.DB.Put([]byte("Lz"), []byte("stale")), IsNil)
+
+	result, err = s.replica.Sync(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(result.FullResync, Equals, true)
+	c.Check(result.Files, Equals, 0)
+	s.checkSame(c)
+}
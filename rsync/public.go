@@ -0,0 +1,232 @@
+package rsync
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/files"
+	"github.com/aptly-dev/aptly/utils"
+)
+
+const (
+	tmpSuffix = ".aptly-tmp"
+	oldSuffix = ".aptly-old"
+)
+
+// PublishedStorage abstract file system with published files (actually hosted on remote host)
+//
+// Published tree is maintained in local staging directory and pushed to remote host
+// with rsync on Flush: tree is transferred to temporary directory next to destination
+// (unchanged files are hardlinked from current destination), which then replaces
+// destination directory.
+type PublishedStorage struct {
+	// local is staging directory
+	local *files.PublishedStorage
+
+	host       string
+	path       string
+	sshCommand string
+	rsyncArgs  []string
+
+	// run executes command, replaced in tests
+	run func(name string, args ...string) error
+
+	lock  sync.Mutex
+	dirty bool
+}
+
+// Check interface
+var (
+	_ aptly.PublishedStorage              = (*PublishedStorage)(nil)
+	_ aptly.FlushablePublishedStorage     = (*PublishedStorage)(nil)
+	_ aptly.HealthCheckedPublishedStorage = (*PublishedStorage)(nil)
+)
+
+// NewPublishedStorage creates published storage pushed with rsync to path at host ([user@]host),
+// host could be empty to rsync to local path
+func NewPublishedStorage(stagingDir, linkMethod, host, path, sshCommand string, rsyncArgs []string) (*PublishedStorage, error) {
+	path = strings.TrimRight(path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("rsync destination path not specified")
+	}
+
+	if sshCommand == "" {
+		sshCommand = "ssh"
+	}
+
+	return &PublishedStorage{
+		local:      files.NewPublishedStorage(stagingDir, linkMethod, ""),
+		host:       host,
+		path:       path,
+		sshCommand: sshCommand,
+		rsyncArgs:  rsyncArgs,
+		run:        runCommand,
+	}, nil
+}
+
+func runCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %s\n%s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// String
+func (storage *PublishedStorage) String() string {
+	return fmt.Sprintf("rsync: %s", storage.destination(""))
+}
+
+// destination returns rsync destination for path with suffix
+func (storage *PublishedStorage) destination(suffix string) string {
+	if storage.host == "" {
+		return storage.path + suffix
+	}
+	return storage.host + ":" + storage.path + suffix
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runScript runs shell script on remote host (or locally)
+func (storage *PublishedStorage) runScript(script string) error {
+	if storage.host == "" {
+		return storage.run("sh", "-c", script)
+	}
+
+	sshArgs := strings.Fields(storage.sshCommand)
+	return storage.run(sshArgs[0], append(sshArgs[1:], storage.host, script)...)
+}
+
+// changed marks published tree as changed since last Flush
+func (storage *PublishedStorage) changed() {
+	storage.lock.Lock()
+	storage.dirty = true
+	storage.lock.Unlock()
+}
+
+// MkDir creates directory recursively under public path
+func (storage *PublishedStorage) MkDir(path string) error {
+	return storage.local.MkDir(path)
+}
+
+// PutFile puts file into published storage at specified path
+func (storage *PublishedStorage) PutFile(path string, sourceFilename string) error {
+	storage.changed()
+	return storage.local.PutFile(path, sourceFilename)
+}
+
+// Remove removes single file under public path
+func (storage *PublishedStorage) Remove(path string) error {
+	storage.changed()
+	return storage.local.Remove(path)
+}
+
+// RemoveDirs removes directory structure under public path
+func (storage *PublishedStorage) RemoveDirs(path string, progress aptly.Progress) error {
+	storage.changed()
+	return storage.local.RemoveDirs(path, progress)
+}
+
+// LinkFromPool links package file from pool to dist's pool location
+func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath, fileName string, sourcePool aptly.PackagePool,
+	sourcePath string, sourceChecksums utils.ChecksumInfo, force bool) error {
+	storage.changed()
+	return storage.local.LinkFromPool(publishedPrefix, publishedRelPath, fileName, sourcePool, sourcePath, sourceChecksums, force)
+}
+
+// RenameFile renames (moves) file
+func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
+	storage.changed()
+	return storage.local.RenameFile(oldName, newName)
+}
+
+// SymLink creates a symbolic link, which can be read with ReadLink
+func (storage *PublishedStorage) SymLink(src string, dst string) error {
+	storage.changed()
+	return storage.local.SymLink(src, dst)
+}
+
+// HardLink creates a hardlink of a file
+func (storage *PublishedStorage) HardLink(src string, dst string) error {
+	storage.changed()
+	return storage.local.HardLink(src, dst)
+}
+
+// Filelist returns list of files under prefix
+func (storage *PublishedStorage) Filelist(prefix string) ([]string, error) {
+	return storage.local.Filelist(prefix)
+}
+
+// FileExists returns true if path exists
+func (storage *PublishedStorage) FileExists(path string) (bool, error) {
+	return storage.local.FileExists(path)
+}
+
+// ReadLink returns the symbolic link pointed to by path
+func (storage *PublishedStorage) ReadLink(path string) (string, error) {
+	return storage.local.ReadLink(path)
+}
+
+// Flush pushes staging directory to remote host, replacing destination directory
+func (storage *PublishedStorage) Flush() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if !storage.dirty {
+		return nil
+	}
+
+	stagingDir := storage.local.PublicPath()
+	if err := os.MkdirAll(stagingDir, 0777); err != nil {
+		return err
+	}
+
+	// symlinks in staging directory are absolute, so they are "unsafe"
+	// for rsync and are transferred as files
+	args := []string{"--archive", "--copy-unsafe-links", "--delete-after",
+		"--link-dest=../" + path.Base(storage.path)}
+	if storage.host != "" {
+		args = append(args, "--rsh="+storage.sshCommand)
+	}
+	args = append(args, storage.rsyncArgs...)
+	args = append(args, stagingDir+"/", storage.destination(tmpSuffix)+"/")
+
+	if err := storage.run("rsync", args...); err != nil {
+		return fmt.Errorf("error pushing to %s: %s", storage, err)
+	}
+
+	dst, tmp, old := shellQuote(storage.path), shellQuote(storage.path+tmpSuffix), shellQuote(storage.path+oldSuffix)
+	script := fmt.Sprintf("rm -rf %s && if [ -e %s ]; then mv %s %s; fi && mv %s %s && rm -rf %s",
+		old, dst, dst, old, tmp, dst, old)
+
+	if err := storage.runScript(script); err != nil {
+		return fmt.Errorf("error replacing %s: %s", storage, err)
+	}
+
+	storage.dirty = false
+	return nil
+}
+
+// HealthCheck verifies that staging directory is writable and destination
+// parent directory (where temporary directory is created) is writable on remote host
+func (storage *PublishedStorage) HealthCheck() error {
+	if err := storage.local.MkDir(""); err != nil {
+		return fmt.Errorf("error creating staging directory for %s: %s", storage, err)
+	}
+
+	parent := shellQuote(path.Dir(storage.path))
+	script := fmt.Sprintf("test -d %s && test -w %s", parent, parent)
+
+	if err := storage.runScript(script); err != nil {
+		return fmt.Errorf("destination directory parent is not writable in %s: %s", storage, err)
+	}
+
+	return nil
+}
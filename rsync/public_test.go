@@ -0,0 +1,138 @@
+package rsync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type PublishedStorageSuite struct {
+	stagingDir, dest string
+	storage          *PublishedStorage
+	commands         [][]string
+}
+
+var _ = Suite(&PublishedStorageSuite{})
+
+func (s *PublishedStorageSuite) SetUpTest(c *C) {
+	var err error
+
+	s.stagingDir = c.MkDir()
+	s.dest = filepath.Join(c.MkDir(), "public")
+	s.commands = nil
+
+	s.storage, err = NewPublishedStorage(s.stagingDir, "copy", "", s.dest+"/", "", nil)
+	c.Assert(err, IsNil)
+
+	// emulate rsync with cp, as rsync might be missing
+	s.storage.run = func(name string, args ...string) error {
+		s.commands = append(s.commands, append([]string{name}, args...))
+		if name == "rsync" {
+			src, dst := args[len(args)-2], args[len(args)-1]
+			return runCommand("sh", "-c", "rm -rf "+shellQuote(dst)+" && mkdir -p "+shellQuote(dst)+" && cp -a "+shellQuote(src+".")+" "+shellQuote(dst))
+		}
+		return runCommand(name, args...)
+	}
+}
+
+func (s *PublishedStorageSuite) putFile(c *C, path, contents string) {
+	tmp := filepath.Join(c.MkDir(), "file")
+	c.Assert(os.WriteFile(tmp, []byte(contents), 0644), IsNil)
+	c.Assert(s.storage.MkDir(filepath.Dir(path)), IsNil)
+	c.Assert(s.storage.PutFile(path, tmp), IsNil)
+}
+
+func (s *PublishedStorageSuite) TestNewPublishedStorage(c *C) {
+	_, err := NewPublishedStorage(s.stagingDir, "", "mirror.example.com", "/", "", nil)
+	c.Check(err, ErrorMatches, "rsync destination path not specified")
+
+	storage, err := NewPublishedStorage(s.stagingDir, "", "user@mirror.example.com", "/srv/apt", "", nil)
+	c.Check(err, IsNil)
+	c.Check(storage.String(), Equals, "rsync: user@mirror.example.com:/srv/apt")
+	c.Check(storage.sshCommand, Equals, "ssh")
+}
+
+func (s *PublishedStorageSuite) TestFlush(c *C) {
+	// nothing changed, nothing to push
+	c.Assert(s.storage.Flush(), IsNil)
+	c.Check(s.commands, HasLen, 0)
+
+	s.putFile(c, "dists/stable/Release", "release")
+	s.putFile(c, "dists/stable/InRelease", "inrelease")
+
+	c.Assert(s.storage.Flush(), IsNil)
+	c.Check(s.commands, HasLen, 2)
+	c.Check(s.commands[0], DeepEquals, []string{"rsync", "--archive", "--copy-unsafe-links", "--delete-after",
+		"--link-dest=../public", s.stagingDir + "/", s.dest + ".aptly-tmp/"})
+
+	data, err := os.ReadFile(filepath.Join(s.dest, "dists/stable/Release"))
+	c.Check(err, IsNil)
+	c.Check(string(data), Equals, "release")
+
+	// second flush replaces destination
+	c.Assert(s.storage.Remove("dists/stable/InRelease"), IsNil)
+	c.Assert(s.storage.Flush(), IsNil)
+
+	_, err = os.Stat(filepath.Join(s.dest, "dists/stable/InRelease"))
+	c.Check(os.IsNotExist(err), Equals, true)
+	_, err = os.Stat(filepath.Join(s.dest, "dists/stable/Release"))
+	c.Check(err, IsNil)
+
+	for _, suffix := range []string{tmpSuffix, oldSuffix} {
+		_, err = os.Stat(s.dest + suffix)
+		c.Check(os.IsNotExist(err), Equals, true)
+	}
+
+	// local operations
+	exists, _ := s.storage.FileExists("dists/stable/Release")
+	c.Check(exists, Equals, true)
+	list, _ := s.storage.Filelist("dists")
+	c.Check(list, DeepEquals, []string{"stable/Release"})
+}
+
+func (s *PublishedStorageSuite) TestFlushRemote(c *C) {
+	s.storage.host = "user@mirror.example.com"
+	s.storage.sshCommand = "ssh -p 2222"
+	s.storage.rsyncArgs = []string{"--bwlimit=1000"}
+	s.storage.run = func(name string, args ...string) error {
+		s.commands = append(s.commands, append([]string{name}, args...))
+		return nil
+	}
+
+	s.putFile(c, "dists/stable/Release", "release")
+	c.Assert(s.storage.Flush(), IsNil)
+
+	c.Assert(s.commands, HasLen, 2)
+	c.Check(s.commands[0], DeepEquals, []string{"rsync", "--archive", "--copy-unsafe-links", "--delete-after",
+		"--link-dest=../public", "--rsh=ssh -p 2222", "--bwlimit=1000", s.stagingDir + "/",
+		"user@mirror.example.com:" + s.dest + ".aptly-tmp/"})
+	c.Check(s.commands[1][:4], DeepEquals, []string{"ssh", "-p", "2222", "user@mirror.example.com"})
+	c.Check(strings.HasSuffix(s.commands[1][4], "&& mv '"+s.dest+".aptly-tmp' '"+s.dest+"' && rm -rf '"+s.dest+".aptly-old'"), Equals, true)
+}
+
+func (s *PublishedStorageSuite) TestFlushError(c *C) {
+	s.storage.run = func(name string, args ...string) error {
+		return runCommand("false")
+	}
+
+	s.putFile(c, "dists/stable/Release", "release")
+	c.Check(s.storage.Flush(), ErrorMatches, "error pushing to rsync: .*: false failed: exit status 1\n")
+
+	// still dirty
+	c.Check(s.storage.dirty, Equals, true)
+}
+
+func (s *PublishedStorageSuite) TestHealthCheck(c *C) {
+	c.Check(s.storage.HealthCheck(), IsNil)
+
+	storage, err := NewPublishedStorage(s.stagingDir, "copy", "", filepath.Join(s.dest, "missing", "public"), "", nil)
+	c.Assert(err, IsNil)
+	c.Check(storage.HealthCheck(), ErrorMatches, "destination directory parent is not writable in rsync: .*: sh failed: exit status 1\n")
+}
+
+func (s *PublishedStorageSuite) TestShellQuote(c *C) {
+	c.Check(shellQuote("/srv/apt"), Equals, "'/srv/apt'")
+	c.Check(shellQuote("it's"), Equals, `'it'\''s'`)
+}
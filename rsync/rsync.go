@@ -0,0 +1,2 @@
+// Package rsync handles publishing to remote hosts via rsync
+package rsync
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/aptly-dev/aptly/aptly"
 	"github.com/aptly-dev/aptly/utils"
@@ -52,7 +54,12 @@ type PublishedStorage struct {
 	encryptionMethod types.ServerSideEncryption
 	plusWorkaround   bool
 	disableMultiDel  bool
-	pathCache        map[string]string
+	indexPages       bool
+	pathClasses      map[string]utils.S3PathClass
+
+	// pathCacheLock protects pathCache, as files might be uploaded concurrently
+	pathCacheLock sync.Mutex
+	pathCache     map[string]string
 
 	// True if the bucket encrypts objects by default.
 	encryptByDefault bool
@@ -60,14 +67,15 @@ type PublishedStorage struct {
 
 // Check interface
 var (
-	_ aptly.PublishedStorage = (*PublishedStorage)(nil)
+	_ aptly.PublishedStorage           = (*PublishedStorage)(nil)
+	_ aptly.IndexPagesPublishedStorage = (*PublishedStorage)(nil)
 )
 
 // NewPublishedStorageRaw creates published storage from raw aws credentials
 func NewPublishedStorageRaw(
 	bucket, defaultACL, prefix, storageClass, encryptionMethod string,
-	plusWorkaround, disabledMultiDel, forceVirtualHostedStyle bool,
-	config *aws.Config, endpoint string,
+	plusWorkaround, disabledMultiDel, forceVirtualHostedStyle, indexPages bool,
+	pathClasses map[string]utils.S3PathClass, config *aws.Config, endpoint string,
 ) (*PublishedStorage, error) {
 	var acl types.ObjectCannedACL
 	if defaultACL == "" || defaultACL == "private" {
@@ -101,6 +109,8 @@ func NewPublishedStorageRaw(
 		encryptionMethod: types.ServerSideEncryption(encryptionMethod),
 		plusWorkaround:   plusWorkaround,
 		disableMultiDel:  disabledMultiDel,
+		indexPages:       indexPages,
+		pathClasses:      pathClasses,
 	}
 
 	result.setKMSFlag()
@@ -108,6 +118,11 @@ func NewPublishedStorageRaw(
 	return result, nil
 }
 
+// IndexPages returns true if index.html directory listings should be generated
+func (storage *PublishedStorage) IndexPages() bool {
+	return storage.indexPages
+}
+
 func (storage *PublishedStorage) setKMSFlag() {
 	params := &s3.GetBucketEncryptionInput{
 		Bucket: aws.String(storage.bucket),
@@ -127,7 +142,8 @@ func (storage *PublishedStorage) setKMSFlag() {
 // keys, region and bucket name
 func NewPublishedStorage(
 	accessKey, secretKey, sessionToken, region, endpoint, bucket, defaultACL, prefix, storageClass, encryptionMethod string,
-	plusWorkaround, disableMultiDel, _, forceVirtualHostedStyle, debug bool) (*PublishedStorage, error) {
+	plusWorkaround, disableMultiDel, _, forceVirtualHostedStyle, debug, indexPages bool,
+	pathClasses map[string]utils.S3PathClass) (*PublishedStorage, error) {
 
 	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
 	if accessKey != "" {
@@ -144,7 +160,7 @@ func NewPublishedStorage(
 	}
 
 	result, err := NewPublishedStorageRaw(bucket, defaultACL, prefix, storageClass,
-		encryptionMethod, plusWorkaround, disableMultiDel, forceVirtualHostedStyle, &config, endpoint)
+		encryptionMethod, plusWorkaround, disableMultiDel, forceVirtualHostedStyle, indexPages, pathClasses, &config, endpoint)
 
 	return result, err
 }
@@ -194,17 +210,67 @@ func (storage *PublishedStorage) getMD5(path string) (string, error) {
 	return output.Metadata["Md5"], nil
 }
 
+// objectSettings are settings of S3 object depending on its path class
+type objectSettings struct {
+	storageClass types.StorageClass
+	cacheControl *string
+	contentType  *string
+	tagging      *string
+}
+
+// objectSettings returns settings for the object at path, based on path class:
+// "dists" for metadata and "pool" for package files
+func (storage *PublishedStorage) objectSettings(path string) objectSettings {
+	var class utils.S3PathClass
+
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == "dists" || part == "pool" {
+			class = storage.pathClasses[part]
+			break
+		}
+	}
+
+	result := objectSettings{storageClass: storage.storageClass}
+
+	if class.StorageClass != "" {
+		result.storageClass = types.StorageClass(class.StorageClass)
+		if result.storageClass == types.StorageClassStandard {
+			result.storageClass = ""
+		}
+	}
+	if class.CacheControl != "" {
+		result.cacheControl = aws.String(class.CacheControl)
+	}
+	if class.ContentType != "" {
+		result.contentType = aws.String(class.ContentType)
+	}
+	if filepath.Base(path) == "index.html" {
+		result.contentType = aws.String("text/html; charset=utf-8")
+	}
+	if len(class.Tags) > 0 {
+		tags := url.Values{}
+		for key, value := range class.Tags {
+			tags.Set(key, value)
+		}
+		result.tagging = aws.String(tags.Encode())
+	}
+
+	return result
+}
+
 // putFile uploads file-like object to
 func (storage *PublishedStorage) putFile(path string, source io.ReadSeeker, sourceMD5 string) error {
+	settings := storage.objectSettings(path)
 
 	params := &s3.PutObjectInput{
-		Bucket: aws.String(storage.bucket),
-		Key:    aws.String(filepath.Join(storage.prefix, path)),
-		Body:   source,
-		ACL:    storage.acl,
-	}
-	if storage.storageClass != "" {
-		params.StorageClass = types.StorageClass(storage.storageClass)
+		Bucket:       aws.String(storage.bucket),
+		Key:          aws.String(filepath.Join(storage.prefix, path)),
+		Body:         source,
+		ACL:          storage.acl,
+		StorageClass: settings.storageClass,
+		CacheControl: settings.cacheControl,
+		ContentType:  settings.contentType,
+		Tagging:      settings.tagging,
 	}
 	if storage.encryptionMethod != "" {
 		params.ServerSideEncryption = types.ServerSideEncryption(storage.encryptionMethod)
@@ -252,7 +318,9 @@ func (storage *PublishedStorage) Remove(path string) error {
 		_ = storage.Remove(strings.Replace(path, "+", " ", -1))
 	}
 
+	storage.pathCacheLock.Lock()
 	delete(storage.pathCache, path)
+	storage.pathCacheLock.Unlock()
 
 	return nil
 }
@@ -280,7 +348,9 @@ func (storage *PublishedStorage) RemoveDirs(path string, _ aptly.Progress) error
 			if err != nil {
 				return fmt.Errorf("error deleting path %s from %s: %s", filelist[i], storage, err)
 			}
+			storage.pathCacheLock.Lock()
 			delete(storage.pathCache, filepath.Join(path, filelist[i]))
+			storage.pathCacheLock.Unlock()
 		}
 	} else {
 		numParts := (len(filelist) + page - 1) / page
@@ -313,9 +383,11 @@ func (storage *PublishedStorage) RemoveDirs(path string, _ aptly.Progress) error
 			if err != nil {
 				return fmt.Errorf("error deleting multiple paths from %s: %s", storage, err)
 			}
+			storage.pathCacheLock.Lock()
 			for i := range part {
 				delete(storage.pathCache, filepath.Join(path, part[i]))
 			}
+			storage.pathCacheLock.Unlock()
 		}
 	}
 
@@ -337,9 +409,11 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	relPath := filepath.Join(publishedDirectory, fileName)
 	poolPath := filepath.Join(storage.prefix, relPath)
 
+	storage.pathCacheLock.Lock()
 	if storage.pathCache == nil {
 		paths, md5s, err := storage.internalFilelist(filepath.Join(storage.prefix, publishedPrefix, "pool"), true)
 		if err != nil {
+			storage.pathCacheLock.Unlock()
 			return errors.Wrap(err, "error caching paths under prefix")
 		}
 
@@ -351,6 +425,7 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 	}
 
 	destinationMD5, exists := storage.pathCache[relPath]
+	storage.pathCacheLock.Unlock()
 	sourceMD5 := sourceChecksums.MD5
 
 	if exists {
@@ -367,7 +442,9 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 				err = errors.Wrap(err, fmt.Sprintf("error verifying MD5 for %s: %s", storage, poolPath))
 				return err
 			}
+			storage.pathCacheLock.Lock()
 			storage.pathCache[relPath] = destinationMD5
+			storage.pathCacheLock.Unlock()
 		}
 
 		if destinationMD5 == sourceMD5 {
@@ -387,7 +464,9 @@ func (storage *PublishedStorage) LinkFromPool(publishedPrefix, publishedRelPath,
 
 	err = storage.putFile(relPath, source, sourceMD5)
 	if err == nil {
+		storage.pathCacheLock.Lock()
 		storage.pathCache[relPath] = sourceMD5
+		storage.pathCacheLock.Unlock()
 	} else {
 		err = errors.Wrap(err, fmt.Sprintf("error uploading %s to %s: %s", sourcePath, storage, poolPath))
 	}
@@ -452,15 +531,13 @@ func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
 	source := fmt.Sprintf("/%s/%s", storage.bucket, filepath.Join(storage.prefix, oldName))
 
 	params := &s3.CopyObjectInput{
-		Bucket:     aws.String(storage.bucket),
-		CopySource: aws.String(source),
-		Key:        aws.String(filepath.Join(storage.prefix, newName)),
-		ACL:        storage.acl,
+		Bucket:       aws.String(storage.bucket),
+		CopySource:   aws.String(source),
+		Key:          aws.String(filepath.Join(storage.prefix, newName)),
+		ACL:          storage.acl,
+		StorageClass: storage.objectSettings(newName).storageClass,
 	}
 
-	if storage.storageClass != "" {
-		params.StorageClass = storage.storageClass
-	}
 	if storage.encryptionMethod != "" {
 		params.ServerSideEncryption = storage.encryptionMethod
 	}
@@ -476,6 +553,8 @@ func (storage *PublishedStorage) RenameFile(oldName, newName string) error {
 // SymLink creates a copy of src file and adds link information as meta data
 func (storage *PublishedStorage) SymLink(src string, dst string) error {
 
+	settings := storage.objectSettings(dst)
+
 	params := &s3.CopyObjectInput{
 		Bucket:     aws.String(storage.bucket),
 		CopySource: aws.String(filepath.Join(storage.bucket, storage.prefix, src)),
@@ -485,11 +564,11 @@ func (storage *PublishedStorage) SymLink(src string, dst string) error {
 			"SymLink": src,
 		},
 		MetadataDirective: types.MetadataDirective("REPLACE"),
+		StorageClass:      settings.storageClass,
+		CacheControl:      settings.cacheControl,
+		ContentType:       settings.contentType,
 	}
 
-	if storage.storageClass != "" {
-		params.StorageClass = types.StorageClass(storage.storageClass)
-	}
 	if storage.encryptionMethod != "" {
 		params.ServerSideEncryption = types.ServerSideEncryption(storage.encryptionMethod)
 	}
@@ -537,6 +616,21 @@ func (storage *PublishedStorage) FileExists(path string) (bool, error) {
 	return true, nil
 }
 
+// ReadFile returns contents of file under public path
+func (storage *PublishedStorage) ReadFile(path string) ([]byte, error) {
+	params := &s3.GetObjectInput{
+		Bucket: aws.String(storage.bucket),
+		Key:    aws.String(filepath.Join(storage.prefix, path)),
+	}
+	output, err := storage.s3.GetObject(context.TODO(), params)
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+
+	return io.ReadAll(output.Body)
+}
+
 // ReadLink returns the symbolic link pointed to by path.
 // This simply reads text file created with SymLink
 func (storage *PublishedStorage) ReadLink(path string) (string, error) {
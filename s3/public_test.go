@@ -33,11 +33,11 @@ func (s *PublishedStorageSuite) SetUpTest(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(s.srv, NotNil)
 
-	s.storage, err = NewPublishedStorage("aa", "bb", "", "test-1", s.srv.URL(), "test", "", "", "", "", false, true, false, false, false)
+	s.storage, err = NewPublishedStorage("aa", "bb", "", "test-1", s.srv.URL(), "test", "", "", "", "", false, true, false, false, false, false, nil)
 	c.Assert(err, IsNil)
-	s.prefixedStorage, err = NewPublishedStorage("aa", "bb", "", "test-1", s.srv.URL(), "test", "", "lala", "", "", false, true, false, false, false)
+	s.prefixedStorage, err = NewPublishedStorage("aa", "bb", "", "test-1", s.srv.URL(), "test", "", "lala", "", "", false, true, false, false, false, false, nil)
 	c.Assert(err, IsNil)
-	s.noSuchBucketStorage, err = NewPublishedStorage("aa", "bb", "", "test-1", s.srv.URL(), "no-bucket", "", "", "", "", false, true, false, false, false)
+	s.noSuchBucketStorage, err = NewPublishedStorage("aa", "bb", "", "test-1", s.srv.URL(), "no-bucket", "", "", "", "", false, true, false, false, false, false, nil)
 	c.Assert(err, IsNil)
 
 	_, err = s.storage.s3.CreateBucket(context.TODO(), &s3.CreateBucketInput{
@@ -112,6 +112,47 @@ func (s *PublishedStorageSuite) TestPutFile(c *C) {
 	c.Check(s.GetFile(c, "lala/a/b.txt"), DeepEquals, []byte("welcome to s3!"))
 }
 
+func (s *PublishedStorageSuite) TestObjectSettings(c *C) {
+	s.storage.storageClass = types.StorageClassStandardIa
+	s.storage.pathClasses = map[string]utils.S3PathClass{
+		"dists": {CacheControl: "max-age=60", ContentType: "text/plain"},
+		"pool": {StorageClass: "STANDARD", CacheControl: "max-age=31536000, immutable",
+			Tags: map[string]string{"class": "pool", "lifecycle": "keep"}},
+	}
+
+	settings := s.storage.objectSettings("ppa/dists/stable/Release")
+	c.Check(settings.storageClass, Equals, types.StorageClassStandardIa)
+	c.Check(*settings.cacheControl, Equals, "max-age=60")
+	c.Check(*settings.contentType, Equals, "text/plain")
+	c.Check(settings.tagging, IsNil)
+
+	settings = s.storage.objectSettings("pool/main/a/a.deb")
+	c.Check(settings.storageClass, Equals, types.StorageClass(""))
+	c.Check(*settings.cacheControl, Equals, "max-age=31536000, immutable")
+	c.Check(settings.contentType, IsNil)
+	c.Check(*settings.tagging, Equals, "class=pool&lifecycle=keep")
+
+	settings = s.storage.objectSettings("ppa/index.html")
+	c.Check(settings.storageClass, Equals, types.StorageClassStandardIa)
+	c.Check(settings.cacheControl, IsNil)
+	c.Check(*settings.contentType, Equals, "text/html; charset=utf-8")
+
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "a"), []byte("release"), 0644)
+	c.Assert(err, IsNil)
+
+	err = s.storage.PutFile("dists/stable/Release", filepath.Join(dir, "a"))
+	c.Check(err, IsNil)
+
+	output, err := s.storage.s3.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.storage.bucket),
+		Key:    aws.String("dists/stable/Release"),
+	})
+	c.Assert(err, IsNil)
+	c.Check(*output.CacheControl, Equals, "max-age=60")
+	c.Check(*output.ContentType, Equals, "text/plain")
+}
+
 func (s *PublishedStorageSuite) TestPutFilePlusWorkaround(c *C) {
 	s.storage.plusWorkaround = true
 
@@ -409,6 +450,17 @@ func (s *PublishedStorageSuite) TestSymLink(c *C) {
 	c.Skip("copy not available in s3test")
 }
 
+func (s *PublishedStorageSuite) TestReadFile(c *C) {
+	s.PutFile(c, "lala/a/b", []byte("test"))
+
+	data, err := s.prefixedStorage.ReadFile("a/b")
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "test")
+
+	_, err = s.prefixedStorage.ReadFile("a/b.invalid")
+	c.Check(err, NotNil)
+}
+
 func (s *PublishedStorageSuite) TestFileExists(c *C) {
 	s.PutFile(c, "a/b", []byte("test"))
 
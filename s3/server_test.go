@@ -624,6 +624,7 @@ var metaHeaders = map[string]bool{
 	"Content-MD5":         true,
 	"x-amz-acl":           true,
 	"Content-Type":        true,
+	"Cache-Control":       true,
 	"Content-Encoding":    true,
 	"Content-Disposition": true,
 }
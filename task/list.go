@@ -2,9 +2,12 @@ package task
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/aptly-dev/aptly/aptly"
+	"github.com/aptly-dev/aptly/utils"
 )
 
 // List is handling list of processes and makes sure
@@ -18,9 +21,13 @@ type List struct {
 	usedResources *ResourcesSet
 	idCounter     int
 
-	queue     chan *Task
-	queueWg   *sync.WaitGroup
-	queueDone chan bool
+	// no more tasks are started once list is stopped
+	stopped atomic.Bool
+	// store persists metadata of tasks, if set
+	store *storeWriter
+
+	// called when task is finished
+	completionHandler func(task Task, err error)
 }
 
 // NewList creates empty task list
@@ -31,70 +38,104 @@ func NewList() *List {
 		wgTasks:       make(map[int]*sync.WaitGroup),
 		wg:            &sync.WaitGroup{},
 		usedResources: NewResourcesSet(),
-		queue:         make(chan *Task, 0),
-		queueWg:       &sync.WaitGroup{},
-		queueDone:     make(chan bool),
 	}
-	go list.consumer()
 	return list
 }
 
-// consumer is processing the queue
-func (list *List) consumer() {
-	for {
-		select {
-		case task := <-list.queue:
-			list.Lock()
-			{
-				task.State = RUNNING
-			}
-			list.Unlock()
+// run runs process of the task and marks task as finished
+func (list *List) run(task *Task) {
+	retValue, err := task.process(aptly.Progress(task.output), task.detail)
+
+	var (
+		completionHandler func(task Task, err error)
+		finished          Task
+	)
+
+	list.Lock()
+	{
+		task.processReturnValue = retValue
+		list.finish(task, err)
+
+		list.usedResources.Free(task.resources)
+
+		completionHandler = list.completionHandler
+		finished = *task
 
-			go func() {
-				retValue, err := task.process(aptly.Progress(task.output), task.detail)
-
-				list.Lock()
-				{
-					task.processReturnValue = retValue
-					task.err = err
-					if err != nil {
-						task.output.Printf("Task failed with error: %v", err)
-						task.State = FAILED
-					} else {
-						task.output.Print("Task succeeded")
-						task.State = SUCCEEDED
-					}
-
-					list.usedResources.Free(task.resources)
-
-					task.wgTask.Done()
-					list.wg.Done()
-
-					for _, t := range list.tasks {
-						if t.State == IDLE {
-							// check resources
-							blockingTasks := list.usedResources.UsedBy(t.resources)
-							if len(blockingTasks) == 0 {
-								list.usedResources.MarkInUse(task.resources, task)
-								list.queue <- t
-								break
-							}
-						}
-					}
-				}
-				list.Unlock()
-			}()
-
-		case <-list.queueDone:
-			return
+		list.scheduleIdle()
+	}
+	list.Unlock()
+
+	if completionHandler != nil {
+		completionHandler(finished, err)
+	}
+}
+
+// finish marks task as succeeded or failed, should be called with list locked
+func (list *List) finish(task *Task, err error) {
+	task.err = err
+	if err != nil {
+		task.output.Printf("Task failed with error: %v", err)
+		task.State = FAILED
+	} else {
+		task.output.Print("Task succeeded")
+		task.State = SUCCEEDED
+	}
+
+	// release context of the task
+	task.cancel()
+	list.persist(task)
+
+	task.wgTask.Done()
+	list.wg.Done()
+}
+
+// scheduleIdle starts idle tasks which resources became available, should be called with list locked
+//
+// Tasks are considered in order of priority (and creation within the same priority), resources
+// needed by waiting task are reserved, so that tasks considered later can't overtake it.
+func (list *List) scheduleIdle() {
+	if list.stopped.Load() {
+		return
+	}
+
+	var idle []*Task
+	for _, t := range list.tasks {
+		if t.State == IDLE {
+			idle = append(idle, t)
 		}
 	}
+
+	sort.SliceStable(idle, func(i, j int) bool { return idle[i].Priority > idle[j].Priority })
+
+	reserved := NewResourcesSet()
+	for _, t := range idle {
+		if len(list.usedResources.UsedBy(t.resources)) == 0 && len(reserved.UsedBy(t.resources)) == 0 {
+			t.State = RUNNING
+			list.usedResources.MarkInUse(t.resources, t)
+			list.persist(t)
+
+			go list.run(t)
+		} else {
+			reserved.MarkInUse(t.resources, t)
+		}
+	}
+}
+
+// SetCompletionHandler sets function which is called after every task is finished
+// with task and error it has failed with (nil if task succeeded)
+func (list *List) SetCompletionHandler(handler func(task Task, err error)) {
+	list.Lock()
+	defer list.Unlock()
+
+	list.completionHandler = handler
 }
 
-// Stop signals the consumer to stop processing tasks and waits for it to finish
+// Stop prevents idle tasks from being started, tasks already running are not interrupted
+//
+// Changes of tasks made so far are written to the store before Stop returns.
 func (list *List) Stop() {
-	close(list.queueDone)
-	list.queueWg.Wait()
+	list.stopped.Store(true)
+	list.flushStore()
 }
 
 // GetTasks gets complete list of tasks
@@ -109,6 +150,28 @@ func (list *List) GetTasks() []Task {
 	return tasks
 }
 
+// PendingTasks returns idle or running tasks which were created with any of given resources
+func (list *List) PendingTasks(resources []string) []Task {
+	list.Lock()
+	defer list.Unlock()
+
+	var tasks []Task
+	for _, t := range list.tasks {
+		if t.State != IDLE && t.State != RUNNING {
+			continue
+		}
+
+		for _, resource := range resources {
+			if utils.StrSliceHasItem(t.resources, resource) {
+				tasks = append(tasks, *t)
+				break
+			}
+		}
+	}
+
+	return tasks
+}
+
 // DeleteTaskByID deletes given task from list. Only finished
 // tasks can be deleted.
 func (list *List) DeleteTaskByID(ID int) (Task, error) {
@@ -120,6 +183,7 @@ func (list *List) DeleteTaskByID(ID int) (Task, error) {
 		if task.ID == ID {
 			if task.State == SUCCEEDED || task.State == FAILED {
 				list.tasks = append(tasks[:i], tasks[i+1:]...)
+				list.forget(task)
 				return *task, nil
 			}
 
@@ -186,12 +250,21 @@ func (list *List) GetTaskReturnValueByID(ID int) (*ProcessReturnValue, error) {
 // RunTaskInBackground creates task and runs it in background. This will block until the necessary resources
 // become available.
 func (list *List) RunTaskInBackground(name string, resources []string, process Process) (Task, *ResourceConflictError) {
+	return list.RunTaskWithPriority(name, resources, 0, process)
+}
+
+// RunTaskWithPriority creates task with given priority and runs it in background
+//
+// Task waits until necessary resources become available and until waiting tasks with higher priority
+// (or created earlier) which need the same resources are started.
+func (list *List) RunTaskWithPriority(name string, resources []string, priority int, process Process) (Task, *ResourceConflictError) {
 	list.Lock()
 	defer list.Unlock()
 
 	list.idCounter++
 	wgTask := &sync.WaitGroup{}
 	task := NewTask(process, name, list.idCounter, resources, wgTask)
+	task.Priority = priority
 
 	list.tasks = append(list.tasks, task)
 	list.wgTasks[task.ID] = wgTask
@@ -199,15 +272,71 @@ func (list *List) RunTaskInBackground(name string, resources []string, process P
 	list.wg.Add(1)
 	task.wgTask.Add(1)
 
-	// add task to queue for processing if resources are available
-	// if not, task will be queued by the consumer once resources are available
-	tasks := list.usedResources.UsedBy(resources)
-	if len(tasks) == 0 {
-		list.usedResources.MarkInUse(task.resources, task)
-		list.queue <- task
+	for _, t := range list.usedResources.UsedBy(resources) {
+		if t.lock {
+			task.output.Printf("Waiting for resources held by lock %d: %s\n", t.ID, t.Name)
+		}
+	}
+
+	list.persist(task)
+	queued := *task
+
+	// start task right away if resources are available
+	// if not, task will be started once resources are available
+	list.scheduleIdle()
+
+	return queued, nil
+}
+
+// CancelTaskByID cancels task with given id
+//
+// Idle task is marked as failed right away, running task is signalled via context of its progress
+// and finishes once process notices cancellation.
+func (list *List) CancelTaskByID(ID int) (Task, error) {
+	list.Lock()
+
+	for _, task := range list.tasks {
+		if task.ID != ID {
+			continue
+		}
+
+		if task.lock {
+			list.Unlock()
+			return *task, fmt.Errorf("task with id %v is a lock, it should be unlocked instead", ID)
+		}
+
+		switch task.State {
+		case IDLE:
+			list.finish(task, ErrCancelled)
+
+			completionHandler := list.completionHandler
+			cancelled := *task
+
+			// resources reserved by cancelled task might be available now
+			list.scheduleIdle()
+			list.Unlock()
+
+			if completionHandler != nil {
+				completionHandler(cancelled, ErrCancelled)
+			}
+			return cancelled, nil
+		case RUNNING:
+			if !task.Cancelled() {
+				task.output.Print("Cancelling task\n")
+				task.cancel()
+			}
+
+			running := *task
+			list.Unlock()
+			return running, nil
+		default:
+			list.Unlock()
+			return *task, fmt.Errorf("task with id %v is already finished", ID)
+		}
 	}
 
-	return *task, nil
+	list.Unlock()
+	return Task{}, fmt.Errorf("Could not find task with id %v", ID)
 }
 
 // Clear removes finished tasks from list
@@ -218,6 +347,8 @@ func (list *List) Clear() {
 	for _, task := range list.tasks {
 		if task.State == IDLE || task.State == RUNNING {
 			tasks = append(tasks, task)
+		} else {
+			list.forget(task)
 		}
 	}
 	list.tasks = tasks
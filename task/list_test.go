@@ -52,3 +52,239 @@ func (s *ListSuite) TestList(c *check.C) {
 	c.Check(deleteErr, check.IsNil)
         list.Stop()
 }
+
+func (s *ListSuite) TestCompletionHandler(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+
+	type completion struct {
+		name  string
+		state State
+		err   error
+	}
+	completed := make(chan completion, 2)
+
+	list.SetCompletionHandler(func(task Task, err error) {
+		completed <- completion{task.Name, task.State, err}
+	})
+
+	_, err := list.RunTaskInBackground("Successful task", nil, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(<-completed, check.DeepEquals, completion{"Successful task", SUCCEEDED, nil})
+
+	failure := errors.New("Task failed")
+	_, err = list.RunTaskInBackground("Faulty task", nil, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		return nil, failure
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(<-completed, check.DeepEquals, completion{"Faulty task", FAILED, failure})
+}
+
+func (s *ListSuite) TestPriority(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+
+	lock, conflictErr := list.LockResources("maintenance", []string{"repo"})
+	c.Assert(conflictErr, check.IsNil)
+
+	started := make(chan string, 3)
+	process := func(name string) Process {
+		return func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+			started <- name
+			return nil, nil
+		}
+	}
+
+	low, _ := list.RunTaskWithPriority("Huge publish", []string{"repo"}, 0, process("low"))
+	high, _ := list.RunTaskWithPriority("Small metadata change", []string{"repo"}, 10, process("high"))
+	c.Check(high.Priority, check.Equals, 10)
+
+	// tasks not waiting for locked resources are started right away
+	other, _ := list.RunTaskInBackground("Other task", []string{"other"}, process("other"))
+	list.WaitForTaskByID(other.ID)
+	c.Check(<-started, check.Equals, "other")
+
+	_, err := list.UnlockResources(lock.ID)
+	c.Assert(err, check.IsNil)
+
+	list.WaitForTaskByID(low.ID)
+	list.WaitForTaskByID(high.ID)
+	c.Check(<-started, check.Equals, "high")
+	c.Check(<-started, check.Equals, "low")
+}
+
+func (s *ListSuite) TestCancel(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+
+	lock, _ := list.LockResources("maintenance", []string{"repo"})
+
+	// idle task is failed right away, without running process
+	idle, _ := list.RunTaskInBackground("Waiting task", []string{"repo"}, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		c.Error("process of cancelled task should not be run")
+		return nil, nil
+	})
+	cancelled, err := list.CancelTaskByID(idle.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(cancelled.State, check.Equals, FAILED)
+	taskErr, _ := list.GetTaskErrorByID(idle.ID)
+	c.Check(taskErr, check.Equals, ErrCancelled)
+
+	_, err = list.CancelTaskByID(idle.ID)
+	c.Check(err, check.ErrorMatches, "task with id 2 is already finished")
+	_, err = list.CancelTaskByID(lock.ID)
+	c.Check(err, check.ErrorMatches, "task with id 1 is a lock, it should be unlocked instead")
+	_, err = list.CancelTaskByID(1000)
+	c.Check(err, check.ErrorMatches, "Could not find task with id 1000")
+
+	list.UnlockResources(lock.ID)
+
+	// running task is cancelled via context of its progress
+	running := make(chan struct{})
+	task, _ := list.RunTaskInBackground("Runaway task", []string{"repo"}, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		close(running)
+		<-out.Context().Done()
+		return nil, errors.New("stopped")
+	})
+	<-running
+
+	cancelled, err = list.CancelTaskByID(task.ID)
+	c.Assert(err, check.IsNil)
+	c.Check(cancelled.State, check.Equals, RUNNING)
+
+	task, _ = list.WaitForTaskByID(task.ID)
+	c.Check(task.State, check.Equals, FAILED)
+	output, _ := list.GetTaskOutputByID(task.ID)
+	c.Check(output, check.Equals, "Cancelling task\nTask failed with error: stopped")
+}
+
+type memoryStore struct {
+	records map[int]Record
+}
+
+func (m *memoryStore) Put(record *Record) error {
+	m.records[record.ID] = *record
+	return nil
+}
+
+func (m *memoryStore) Delete(ID int) error {
+	delete(m.records, ID)
+	return nil
+}
+
+func (m *memoryStore) ForEach(handler func(record *Record) error) error {
+	for _, record := range m.records {
+		r := record
+		if err := handler(&r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ListSuite) TestStore(c *check.C) {
+	store := &memoryStore{records: map[int]Record{
+		1: {ID: 1, Name: "Finished task", State: SUCCEEDED},
+		2: {ID: 2, Name: "Failed task", State: FAILED, Error: "no space left"},
+		5: {ID: 5, Name: "Interrupted task", State: RUNNING, Resources: []string{"repo"}},
+	}}
+
+	list := NewList()
+	defer list.Stop()
+	c.Assert(list.SetStore(store), check.IsNil)
+
+	tasks := list.GetTasks()
+	c.Assert(tasks, check.HasLen, 3)
+	c.Check(tasks[0].State, check.Equals, SUCCEEDED)
+	output, _ := list.GetTaskOutputByID(2)
+	c.Check(output, check.Equals, "Task failed with error: no space left")
+	c.Check(tasks[2].State, check.Equals, FAILED)
+	output, _ = list.GetTaskOutputByID(5)
+	c.Check(output, check.Equals, "Task failed with error: interrupted by restart of aptly")
+	list.flushStore()
+	c.Check(store.records[5].State, check.Equals, FAILED)
+
+	// interrupted task doesn't hold resources, new task gets next id
+	task, _ := list.RunTaskWithPriority("New task", []string{"repo"}, 3, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	})
+	c.Check(task.ID, check.Equals, 6)
+	list.WaitForTaskByID(task.ID)
+	list.flushStore()
+	c.Check(store.records[6].State, check.Equals, SUCCEEDED)
+	c.Check(store.records[6].Priority, check.Equals, 3)
+	c.Check(store.records[6].Resources, check.DeepEquals, []string{"repo"})
+
+	list.DeleteTaskByID(1)
+	list.flushStore()
+	_, found := store.records[1]
+	c.Check(found, check.Equals, false)
+	list.Clear()
+	list.flushStore()
+	c.Check(store.records, check.HasLen, 0)
+}
+
+// blockingStore blocks writes until released
+type blockingStore struct {
+	memoryStore
+	release chan struct{}
+}
+
+func (b *blockingStore) Put(record *Record) error {
+	<-b.release
+	return b.memoryStore.Put(record)
+}
+
+func (s *ListSuite) TestStoreDoesntBlockList(c *check.C) {
+	store := &blockingStore{memoryStore: memoryStore{records: map[int]Record{}}, release: make(chan struct{})}
+
+	list := NewList()
+	c.Assert(list.SetStore(store), check.IsNil)
+
+	// tasks are run and listed, while their changes wait to be written
+	task, _ := list.RunTaskInBackground("Task", nil, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	})
+	task, _ = list.WaitForTaskByID(task.ID)
+	c.Check(task.State, check.Equals, SUCCEEDED)
+	c.Check(list.GetTasks(), check.HasLen, 1)
+
+	close(store.release)
+	list.Stop()
+
+	c.Check(store.records[task.ID].State, check.Equals, SUCCEEDED)
+}
+
+func (s *ListSuite) TestPendingTasks(c *check.C) {
+	list := NewList()
+	release := make(chan struct{})
+
+	blocking := func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		<-release
+		return nil, nil
+	}
+
+	running, _ := list.RunTaskInBackground("Running", []string{"a"}, blocking)
+	idle, _ := list.RunTaskInBackground("Idle", []string{"a", "b"}, blocking)
+	other, _ := list.RunTaskInBackground("Other", []string{"c"}, blocking)
+
+	c.Check(list.PendingTasks([]string{"d"}), check.HasLen, 0)
+
+	pending := list.PendingTasks([]string{"b", "c"})
+	c.Assert(pending, check.HasLen, 2)
+	c.Check(pending[0].ID, check.Equals, idle.ID)
+	c.Check(pending[1].ID, check.Equals, other.ID)
+
+	pending = list.PendingTasks([]string{"a"})
+	c.Assert(pending, check.HasLen, 2)
+	c.Check(pending[0].ID, check.Equals, running.ID)
+	c.Check(pending[0].State, check.Equals, RUNNING)
+	c.Check(pending[1].State, check.Equals, IDLE)
+
+	close(release)
+	list.Wait()
+
+	c.Check(list.PendingTasks([]string{"a", "b", "c"}), check.HasLen, 0)
+}
@@ -0,0 +1,99 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// LockResources holds resources on behalf of operator (e.g. during out-of-band maintenance) until it is released
+// with UnlockResources
+//
+// Lock is represented as running task without process, so tasks which need any of locked resources wait
+// until lock is released. If resources are used by other tasks, lock is not acquired and error is
+// returned instead.
+func (list *List) LockResources(reason string, resources []string) (Task, *ResourceConflictError) {
+	list.Lock()
+	defer list.Unlock()
+
+	tasks := list.usedResources.UsedBy(resources)
+	if len(tasks) > 0 {
+		ids := make([]string, len(tasks))
+		for i := range tasks {
+			ids[i] = fmt.Sprintf("%d", tasks[i].ID)
+		}
+
+		return Task{}, &ResourceConflictError{
+			Tasks:   tasks,
+			Message: fmt.Sprintf("resources are used by tasks %s", strings.Join(ids, ", ")),
+		}
+	}
+
+	list.idCounter++
+	wgTask := &sync.WaitGroup{}
+	task := NewTask(nil, "Lock: "+reason, list.idCounter, resources, wgTask)
+	task.lock = true
+	task.State = RUNNING
+	task.output.Printf("Resources locked: %s\n", reason)
+
+	list.tasks = append(list.tasks, task)
+	list.wgTasks[task.ID] = wgTask
+	wgTask.Add(1)
+
+	list.usedResources.MarkInUse(task.resources, task)
+	list.persist(task)
+
+	return *task, nil
+}
+
+// UnlockResources releases lock with given id, allowing waiting tasks to proceed
+func (list *List) UnlockResources(ID int) (Task, error) {
+	list.Lock()
+	defer list.Unlock()
+
+	for _, task := range list.tasks {
+		if task.ID != ID {
+			continue
+		}
+
+		if !task.lock {
+			return *task, fmt.Errorf("task with id %v is not a lock", ID)
+		}
+		if task.State != RUNNING {
+			return *task, fmt.Errorf("lock with id %v is already released", ID)
+		}
+
+		task.output.Print("Resources unlocked")
+		task.State = SUCCEEDED
+		task.cancel()
+		list.usedResources.Free(task.resources)
+		list.persist(task)
+		task.wgTask.Done()
+
+		list.scheduleIdle()
+
+		return *task, nil
+	}
+
+	return Task{}, fmt.Errorf("could not find lock with id %v", ID)
+}
+
+// GetResourceLocks returns locks currently held
+func (list *List) GetResourceLocks() []Task {
+	list.Lock()
+	defer list.Unlock()
+
+	locks := []Task{}
+	for _, task := range list.tasks {
+		if task.lock && task.State == RUNNING {
+			locks = append(locks, *task)
+		}
+	}
+
+	return locks
+}
+
+// IsLock returns true if task is a lock held by operator
+func (t *Task) IsLock() bool {
+	return t.lock
+}
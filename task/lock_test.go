@@ -0,0 +1,63 @@
+package task
+
+import (
+	"github.com/aptly-dev/aptly/aptly"
+
+	check "gopkg.in/check.v1"
+)
+
+type LockSuite struct{}
+
+var _ = check.Suite(&LockSuite{})
+
+func (s *LockSuite) TestLockResources(c *check.C) {
+	list := NewList()
+	defer list.Stop()
+
+	lock, conflict := list.LockResources("disk replacement", []string{"Ufoo"})
+	c.Assert(conflict, check.IsNil)
+	c.Check(lock.Name, check.Equals, "Lock: disk replacement")
+	c.Check(lock.State, check.Equals, RUNNING)
+	c.Check(lock.IsLock(), check.Equals, true)
+	c.Check(list.GetResourceLocks(), check.HasLen, 1)
+
+	// resources held by lock can't be locked again
+	_, conflict = list.LockResources("another", []string{"Ubar", "Ufoo"})
+	c.Assert(conflict, check.NotNil)
+	c.Check(conflict.Error(), check.Equals, "resources are used by tasks 1")
+
+	// conflicting task waits for lock to be released
+	task, err := list.RunTaskInBackground("Publish", []string{"Ufoo"}, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	})
+	c.Assert(err, check.IsNil)
+	task, _ = list.GetTaskByID(task.ID)
+	c.Check(task.State, check.Equals, IDLE)
+	output, _ := list.GetTaskOutputByID(task.ID)
+	c.Check(output, check.Equals, "Waiting for resources held by lock 1: Lock: disk replacement\n")
+
+	// other tasks are not affected
+	other, err := list.RunTaskInBackground("Update mirror", []string{"Rbar"}, func(out aptly.Progress, detail *Detail) (*ProcessReturnValue, error) {
+		return nil, nil
+	})
+	c.Assert(err, check.IsNil)
+	other, _ = list.WaitForTaskByID(other.ID)
+	c.Check(other.State, check.Equals, SUCCEEDED)
+
+	_, e := list.UnlockResources(other.ID)
+	c.Check(e, check.ErrorMatches, "task with id 3 is not a lock")
+
+	lock, e = list.UnlockResources(lock.ID)
+	c.Assert(e, check.IsNil)
+	c.Check(lock.State, check.Equals, SUCCEEDED)
+	c.Check(list.GetResourceLocks(), check.HasLen, 0)
+
+	task, _ = list.WaitForTaskByID(task.ID)
+	c.Check(task.State, check.Equals, SUCCEEDED)
+
+	_, e = list.UnlockResources(lock.ID)
+	c.Check(e, check.ErrorMatches, "lock with id 1 is already released")
+
+	_, e = list.UnlockResources(42)
+	c.Check(e, check.ErrorMatches, "could not find lock with id 42")
+}
@@ -2,8 +2,10 @@ package task
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/aptly-dev/aptly/aptly"
 )
@@ -13,6 +15,7 @@ import (
 type Output struct {
 	mu     *sync.Mutex
 	output *bytes.Buffer
+	ctx    context.Context
 }
 
 // PublishOutput specific output for publishing api
@@ -34,6 +37,14 @@ func (t *Output) String() string {
 	return t.output.String()
 }
 
+// Context is cancelled when task is cancelled
+func (t *Output) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
 // Write is used to determine how many bytes have been written
 // not needed in our case.
 func (t *Output) Write(p []byte) (n int, err error) {
@@ -92,10 +103,10 @@ func (t *Output) AddBar(_ int) {
 	// Not implemented
 }
 
-// AddBar publish output specific
+// AddBar publish output specific, packages are processed concurrently
 func (t *PublishOutput) AddBar(_ int) {
 	if t.barType != nil && *t.barType == aptly.BarPublishGeneratePackageFiles {
-		t.RemainingNumberOfPackages--
+		atomic.AddInt64(&t.RemainingNumberOfPackages, -1)
 		t.Store(t)
 	}
 }
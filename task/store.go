@@ -0,0 +1,225 @@
+package task
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errInterrupted is error of task which was queued or running when aptly was stopped
+var errInterrupted = errors.New("interrupted by restart of aptly")
+
+// Record is metadata of task persisted in Store
+type Record struct {
+	ID        int
+	Name      string
+	State     State
+	Priority  int
+	Resources []string
+	Lock      bool
+	// Error task has failed with
+	Error string
+	// Updated is time of the last change of task state
+	Updated time.Time
+}
+
+// Store persists metadata of tasks, so that tasks survive restart of aptly
+type Store interface {
+	// Put stores record, replacing previous record of the task
+	Put(record *Record) error
+	// Delete removes record of the task with given id
+	Delete(ID int) error
+	// ForEach runs handler for each record
+	ForEach(handler func(record *Record) error) error
+}
+
+// record builds persisted metadata of the task
+func (t *Task) record() *Record {
+	record := &Record{
+		ID:        t.ID,
+		Name:      t.Name,
+		State:     t.State,
+		Priority:  t.Priority,
+		Resources: t.resources,
+		Lock:      t.lock,
+		Updated:   time.Now(),
+	}
+	if t.err != nil {
+		record.Error = t.err.Error()
+	}
+
+	return record
+}
+
+// storeChange is record to put into the store or, if record is nil, id of the task to delete
+type storeChange struct {
+	record *Record
+	ID     int
+}
+
+// storeWriter writes changes to the store in background, in the order they were made,
+// so that task list isn't locked while store (e.g. database) is being written
+type storeWriter struct {
+	store Store
+
+	mu      sync.Mutex
+	flushed *sync.Cond
+	queue   []storeChange
+	busy    bool
+	wake    chan struct{}
+}
+
+func newStoreWriter(store Store) *storeWriter {
+	w := &storeWriter{store: store, wake: make(chan struct{}, 1)}
+	w.flushed = sync.NewCond(&w.mu)
+
+	go w.run()
+
+	return w
+}
+
+// push queues change to be written, never blocking on the store
+func (w *storeWriter) push(change storeChange) {
+	w.mu.Lock()
+	w.queue = append(w.queue, change)
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *storeWriter) run() {
+	for range w.wake {
+		for {
+			w.mu.Lock()
+			changes := w.queue
+			w.queue = nil
+			w.busy = len(changes) > 0
+			if !w.busy {
+				w.flushed.Broadcast()
+			}
+			w.mu.Unlock()
+
+			if len(changes) == 0 {
+				break
+			}
+
+			for _, change := range changes {
+				w.write(change)
+			}
+		}
+	}
+}
+
+func (w *storeWriter) write(change storeChange) {
+	if change.record != nil {
+		if err := w.store.Put(change.record); err != nil {
+			log.Warn().Msgf("unable to persist task %d: %s", change.record.ID, err)
+		}
+		return
+	}
+
+	if err := w.store.Delete(change.ID); err != nil {
+		log.Warn().Msgf("unable to remove task %d: %s", change.ID, err)
+	}
+}
+
+// flush waits for queued changes to be written
+func (w *storeWriter) flush() {
+	w.mu.Lock()
+	for w.busy || len(w.queue) > 0 {
+		w.flushed.Wait()
+	}
+	w.mu.Unlock()
+}
+
+// persist queues metadata of the task to be stored, should be called with list locked
+func (list *List) persist(task *Task) {
+	if list.store == nil {
+		return
+	}
+
+	list.store.push(storeChange{record: task.record()})
+}
+
+// forget queues removal of metadata of the task from the store, should be called with list locked
+func (list *List) forget(task *Task) {
+	if list.store == nil {
+		return
+	}
+
+	list.store.push(storeChange{ID: task.ID})
+}
+
+// flushStore waits for metadata of tasks changed so far to be stored
+func (list *List) flushStore() {
+	list.Lock()
+	store := list.store
+	list.Unlock()
+
+	if store != nil {
+		store.flush()
+	}
+}
+
+// SetStore makes list persist metadata of tasks in the store and restores tasks of the previous run
+//
+// Processes of tasks can't be persisted, so tasks which were queued or running (and locks which were held)
+// when aptly was stopped are marked as failed. New tasks get ids following ids of restored tasks.
+//
+// Changes of tasks are written to the store in background, without holding the list locked.
+func (list *List) SetStore(store Store) error {
+	list.Lock()
+	defer list.Unlock()
+
+	var records []*Record
+	err := store.ForEach(func(record *Record) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	list.store = newStoreWriter(store)
+
+	for _, record := range records {
+		if record.ID > list.idCounter {
+			list.idCounter = record.ID
+		}
+
+		task := NewTask(nil, record.Name, record.ID, record.Resources, &sync.WaitGroup{})
+		task.Priority = record.Priority
+		task.lock = record.Lock
+		task.State = record.State
+		task.cancel()
+
+		if record.Error != "" {
+			task.err = errors.New(record.Error)
+		}
+
+		if task.State == IDLE || task.State == RUNNING {
+			task.err = errInterrupted
+			task.State = FAILED
+			list.persist(task)
+		}
+
+		if task.err != nil {
+			task.output.Printf("Task failed with error: %v", task.err)
+		} else {
+			task.output.Print("Task succeeded")
+		}
+
+		list.tasks = append(list.tasks, task)
+		list.wgTasks[task.ID] = task.wgTask
+	}
+
+	return nil
+}
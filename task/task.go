@@ -1,6 +1,8 @@
 package task
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 
@@ -20,6 +22,8 @@ type PublishDetail struct {
 	*Detail
 	TotalNumberOfPackages     int64
 	RemainingNumberOfPackages int64
+	EstimatedNumberOfFiles    int64
+	EstimatedSize             int64
 }
 
 type ProcessReturnValue struct {
@@ -41,6 +45,9 @@ const (
 	FAILED
 )
 
+// ErrCancelled is error of task cancelled before it was started
+var ErrCancelled = errors.New("task cancelled")
+
 // Task represents as task in a queue encapsulates process code
 type Task struct {
 	output             *Output
@@ -51,12 +58,20 @@ type Task struct {
 	Name               string
 	ID                 int
 	State              State
-	resources          []string
-	wgTask             *sync.WaitGroup
+	// Priority of the task, idle tasks with higher priority are started first
+	Priority  int `json:",omitempty"`
+	resources []string
+	wgTask    *sync.WaitGroup
+	// cancel cancels context of the task, which is available to process via Progress
+	cancel context.CancelFunc
+	// lock is a task without process holding resources until released
+	lock bool
 }
 
 // NewTask creates new task
 func NewTask(process Process, name string, ID int, resources []string, wgTask *sync.WaitGroup) *Task {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	task := &Task{
 		output:    NewOutput(),
 		detail:    &Detail{},
@@ -66,6 +81,13 @@ func NewTask(process Process, name string, ID int, resources []string, wgTask *s
 		State:     IDLE,
 		resources: resources,
 		wgTask:    wgTask,
+		cancel:    cancel,
 	}
+	task.output.ctx = ctx
 	return task
 }
+
+// Cancelled returns true if cancellation of the task was requested
+func (t *Task) Cancelled() bool {
+	return t.output.Context().Err() != nil
+}
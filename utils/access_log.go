@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Access log formats
+const (
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatJSON     = "json"
+)
+
+// AccessLogConfig configures access log of served published repositories
+type AccessLogConfig struct {
+	// Path to log file, "-" for stdout, empty disables access log
+	Path string `json:"path"`
+	// Format of the log: combined (Apache/nginx combined log format) or json
+	Format string `json:"format"`
+}
+
+// AccessLog writes access log entries for served files
+type AccessLog struct {
+	sync.Mutex
+	out    io.Writer
+	closer io.Closer
+	format string
+}
+
+// AccessLogEntry is a single served request
+type AccessLogEntry struct {
+	Time      time.Time `json:"time"`
+	ClientIP  string    `json:"client_ip"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Protocol  string    `json:"protocol"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// NewAccessLog creates access log writing to out in specified format
+func NewAccessLog(out io.Writer, format string) (*AccessLog, error) {
+	if format == "" {
+		format = AccessLogFormatCombined
+	}
+
+	if format != AccessLogFormatCombined && format != AccessLogFormatJSON {
+		return nil, fmt.Errorf("unknown access log format %#v, valid formats are: %s, %s", format,
+			AccessLogFormatCombined, AccessLogFormatJSON)
+	}
+
+	return &AccessLog{out: out, format: format}, nil
+}
+
+// OpenAccessLog opens access log according to configuration, nil is returned
+// if access log is not enabled
+func OpenAccessLog(config AccessLogConfig) (*AccessLog, error) {
+	if config.Path == "" {
+		return nil, nil
+	}
+
+	if config.Path == "-" {
+		return NewAccessLog(os.Stdout, config.Format)
+	}
+
+	f, err := os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open access log: %s", err)
+	}
+
+	log, err := NewAccessLog(f, config.Format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	log.closer = f
+
+	return log, nil
+}
+
+// Close closes access log file
+func (l *AccessLog) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+
+	return l.closer.Close()
+}
+
+// NewAccessLogEntry fills in access log entry from the request
+func NewAccessLogEntry(r *http.Request, status int, bytes int64, at time.Time) *AccessLogEntry {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+
+	user, _, _ := r.BasicAuth()
+
+	return &AccessLogEntry{
+		Time:      at,
+		ClientIP:  clientIP,
+		User:      user,
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		Protocol:  r.Proto,
+		Status:    status,
+		Bytes:     bytes,
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+func dashIfEmpty(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Log writes entry to access log
+func (l *AccessLog) Log(entry *AccessLogEntry) {
+	var line []byte
+
+	if l.format == AccessLogFormatJSON {
+		line, _ = json.Marshal(entry)
+		line = append(line, '\n')
+	} else {
+		line = []byte(fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d %q %q\n",
+			entry.ClientIP, dashIfEmpty(entry.User), entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			entry.Method, entry.Path, entry.Protocol, entry.Status, entry.Bytes,
+			dashIfEmpty(entry.Referer), dashIfEmpty(entry.UserAgent)))
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.out.Write(line)
+}
+
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Handler wraps HTTP handler to log all the requests
+func (l *AccessLog) Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &accessLogResponseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		handler.ServeHTTP(recorder, r)
+
+		l.Log(NewAccessLogEntry(r, recorder.status, recorder.bytes, start))
+	})
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type AccessLogSuite struct{}
+
+var _ = Suite(&AccessLogSuite{})
+
+func (s *AccessLogSuite) serve(c *C, log *AccessLog) {
+	handler := log.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+
+	r := httptest.NewRequest("GET", "/dists/stable/Release", nil)
+	r.RemoteAddr = "192.0.2.1:4711"
+	r.Header.Set("User-Agent", "Debian APT-HTTP/1.3 (2.6.1)")
+	r.SetBasicAuth("alice", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest("GET", "/missing", nil)
+	r.RemoteAddr = "192.0.2.2:4711"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+}
+
+func (s *AccessLogSuite) TestCombined(c *C) {
+	var buf bytes.Buffer
+
+	log, err := NewAccessLog(&buf, "")
+	c.Assert(err, IsNil)
+	s.serve(c, log)
+
+	c.Check(buf.String(), Matches,
+		`192\.0\.2\.1 - alice \[.+\] "GET /dists/stable/Release HTTP/1\.1" 200 5 "-" "Debian APT-HTTP/1\.3 \(2\.6\.1\)"\n`+
+			`192\.0\.2\.2 - - \[.+\] "GET /missing HTTP/1\.1" 404 19 "-" "-"\n`)
+}
+
+func (s *AccessLogSuite) TestJSON(c *C) {
+	var buf bytes.Buffer
+
+	log, err := NewAccessLog(&buf, AccessLogFormatJSON)
+	c.Assert(err, IsNil)
+	s.serve(c, log)
+
+	var entry AccessLogEntry
+	c.Assert(json.NewDecoder(&buf).Decode(&entry), IsNil)
+	c.Check(entry.ClientIP, Equals, "192.0.2.1")
+	c.Check(entry.User, Equals, "alice")
+	c.Check(entry.Path, Equals, "/dists/stable/Release")
+	c.Check(entry.Status, Equals, 200)
+	c.Check(entry.Bytes, Equals, int64(5))
+	c.Check(entry.UserAgent, Equals, "Debian APT-HTTP/1.3 (2.6.1)")
+
+	_, err = NewAccessLog(&buf, "common")
+	c.Check(err, ErrorMatches, "unknown access log format.*")
+}
+
+func (s *AccessLogSuite) TestOpenAccessLog(c *C) {
+	log, err := OpenAccessLog(AccessLogConfig{})
+	c.Check(err, IsNil)
+	c.Check(log, IsNil)
+
+	path := filepath.Join(c.MkDir(), "access.log")
+	log, err = OpenAccessLog(AccessLogConfig{Path: path, Format: AccessLogFormatJSON})
+	c.Assert(err, IsNil)
+	s.serve(c, log)
+	c.Assert(log.Close(), IsNil)
+
+	contents, err := os.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Check(bytes.Count(contents, []byte("\n")), Equals, 2)
+}
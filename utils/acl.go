@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"net/http"
+	pathpkg "path"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ServeACL restricts access to published prefix served by aptly
+//
+// ACL without users and tokens allows anonymous access, it could be used
+// to open part of restricted prefix to the public.
+type ServeACL struct {
+	// Users allowed with basic auth: user name -> password or bcrypt hash of password
+	Users map[string]string `json:"users,omitempty" secret:"true"`
+	// Tokens allowed either as bearer token or as basic auth password (with any user name)
+	Tokens []string `json:"tokens,omitempty" secret:"true"`
+}
+
+// ServeAccessControl is a set of ACLs per published prefix
+//
+// Keys are published prefixes ("." for the root), optionally prefixed
+// with published storage: "filesystem:<name>:<prefix>". The ACL with
+// the longest matching prefix applies.
+type ServeAccessControl map[string]ServeACL
+
+func secretMatches(secret, value string) bool {
+	if strings.HasPrefix(secret, "$2a$") || strings.HasPrefix(secret, "$2b$") || strings.HasPrefix(secret, "$2y$") {
+		return bcrypt.CompareHashAndPassword([]byte(secret), []byte(value)) == nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(value)) == 1
+}
+
+// Allowed checks whether request is authorized by ACL
+func (acl *ServeACL) Allowed(r *http.Request) bool {
+	if len(acl.Users) == 0 && len(acl.Tokens) == 0 {
+		return true
+	}
+
+	var candidates []string
+
+	if user, password, ok := r.BasicAuth(); ok {
+		if secret, exists := acl.Users[user]; exists && secretMatches(secret, password) {
+			return true
+		}
+		candidates = append(candidates, password)
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		candidates = append(candidates, strings.TrimPrefix(auth, "Bearer "))
+	}
+
+	for _, candidate := range candidates {
+		for _, token := range acl.Tokens {
+			if secretMatches(token, candidate) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Match finds ACL for path in published storage ("" for default storage),
+// returns nil if path is not restricted
+//
+// Path is cleaned the same way file servers do it before matching.
+func (acls ServeAccessControl) Match(storage, path string) *ServeACL {
+	path = strings.Trim(pathpkg.Clean("/"+path), "/")
+
+	var result *ServeACL
+	matchLen := -1
+
+	for key := range acls {
+		keyStorage, keyPrefix := "", key
+		if strings.HasPrefix(key, "filesystem:") {
+			parts := strings.SplitN(key, ":", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			keyStorage, keyPrefix = parts[0]+":"+parts[1], parts[2]
+		}
+
+		if keyStorage != storage {
+			continue
+		}
+
+		keyPrefix = strings.Trim(keyPrefix, "/")
+		if keyPrefix == "." {
+			keyPrefix = ""
+		}
+
+		if keyPrefix != "" && path != keyPrefix && !strings.HasPrefix(path, keyPrefix+"/") {
+			continue
+		}
+
+		if len(keyPrefix) > matchLen {
+			acl := acls[key]
+			result, matchLen = &acl, len(keyPrefix)
+		}
+	}
+
+	return result
+}
+
+// Authorize checks request for path against ACLs, responding with
+// 401 Unauthorized if access is denied
+//
+// Paths with ".." segments are rejected with 400 Bad Request, as they could
+// point outside of the prefix ACL was matched for.
+//
+// Returns true if request could be served.
+func (acls ServeAccessControl) Authorize(w http.ResponseWriter, r *http.Request, storage, path string) bool {
+	if hasDotDotSegment(path) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return false
+	}
+
+	acl := acls.Match(storage, path)
+	if acl == nil || acl.Allowed(r) {
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="aptly"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+	return false
+}
+
+func hasDotDotSegment(path string) bool {
+	for _, segment := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"golang.org/x/crypto/bcrypt"
+
+	. "gopkg.in/check.v1"
+)
+
+type ACLSuite struct {
+	acls ServeAccessControl
+}
+
+var _ = Suite(&ACLSuite{})
+
+func (s *ACLSuite) SetUpTest(c *C) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	c.Assert(err, IsNil)
+
+	s.acls = ServeAccessControl{
+		"customer":                {Users: map[string]string{"alice": "plain", "bob": string(hash)}},
+		"customer/public":         {},
+		"filesystem:internal:ppa": {Tokens: []string{"t0ken"}},
+	}
+}
+
+func (s *ACLSuite) TestMatch(c *C) {
+	c.Check(s.acls.Match("", "/debian/dists/stable/Release"), IsNil)
+	c.Check(s.acls.Match("", "/customers/dists/stable/Release"), IsNil)
+	c.Check(s.acls.Match("", "/customer/dists/stable/Release").Users, HasLen, 2)
+	c.Check(s.acls.Match("", "/customer/public/dists/stable/Release").Users, HasLen, 0)
+	c.Check(s.acls.Match("", "/ppa/pool/main/a/a_1.0_all.deb"), IsNil)
+	c.Check(s.acls.Match("filesystem:internal", "/ppa/pool/main/a/a_1.0_all.deb").Tokens, HasLen, 1)
+
+	c.Check(s.acls.Match("", "/foo/../customer/dists/stable/Release").Users, HasLen, 2)
+	c.Check(s.acls.Match("", "/customer/public/../dists/stable/Release").Users, HasLen, 2)
+	c.Check(s.acls.Match("", "//customer/./dists/stable/Release").Users, HasLen, 2)
+
+	s.acls["."] = ServeACL{Tokens: []string{"root"}}
+	c.Check(s.acls.Match("", "/debian/dists/stable/Release").Tokens, DeepEquals, []string{"root"})
+}
+
+func (s *ACLSuite) TestAuthorize(c *C) {
+	check := func(storage, path string, setup func(r *http.Request)) int {
+		r := httptest.NewRequest("GET", path, nil)
+		if setup != nil {
+			setup(r)
+		}
+		w := httptest.NewRecorder()
+		if s.acls.Authorize(w, r, storage, path) {
+			return http.StatusOK
+		}
+		return w.Code
+	}
+
+	c.Check(check("", "/debian/Release", nil), Equals, http.StatusOK)
+	c.Check(check("", "/customer/Release", nil), Equals, http.StatusUnauthorized)
+	c.Check(check("", "/customer/public/Release", nil), Equals, http.StatusOK)
+	c.Check(check("", "/customer/Release", func(r *http.Request) { r.SetBasicAuth("alice", "plain") }), Equals, http.StatusOK)
+	c.Check(check("", "/customer/Release", func(r *http.Request) { r.SetBasicAuth("alice", "wrong") }), Equals, http.StatusUnauthorized)
+	c.Check(check("", "/customer/Release", func(r *http.Request) { r.SetBasicAuth("bob", "secret") }), Equals, http.StatusOK)
+	c.Check(check("filesystem:internal", "/ppa/Release", func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }), Equals, http.StatusOK)
+	c.Check(check("filesystem:internal", "/ppa/Release", func(r *http.Request) { r.SetBasicAuth("apt", "t0ken") }), Equals, http.StatusOK)
+	c.Check(check("filesystem:internal", "/ppa/Release", func(r *http.Request) { r.SetBasicAuth("alice", "plain") }), Equals, http.StatusUnauthorized)
+
+	// traversal can't escape ACL of the prefix
+	c.Check(check("", "/foo/../customer/dists/x/Release", nil), Equals, http.StatusBadRequest)
+	c.Check(check("", "/customer/public/../dists/x/Release", nil), Equals, http.StatusBadRequest)
+	c.Check(check("", "/customer/public/..", nil), Equals, http.StatusBadRequest)
+	c.Check(check("", "/debian/pool/a..b_1.0_all.deb", nil), Equals, http.StatusOK)
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// API token scopes, every scope includes read-only access
+const (
+	APIScopeReadOnly     = "read-only"
+	APIScopeRepoAdmin    = "repo-admin"
+	APIScopePublishAdmin = "publish-admin"
+	APIScopeAdmin        = "admin"
+)
+
+// APIScopes lists valid API token scopes
+var APIScopes = []string{APIScopeReadOnly, APIScopeRepoAdmin, APIScopePublishAdmin, APIScopeAdmin}
+
+// APITokenConfig configures single API token
+type APITokenConfig struct {
+	// Name of the token, reported in logs and by GET /api/tokens
+	Name string `json:"name"`
+	// Token (or bcrypt hash of token)
+	Token string `json:"token" secret:"true"`
+	// Scope: read-only, repo-admin, publish-admin or admin
+	Scope string `json:"scope"`
+	// Published prefixes token is allowed to modify, all prefixes if empty
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// APIAuthConfig configures token-based authentication of API requests
+type APIAuthConfig struct {
+	// Require authentication for API requests
+	Enabled bool `json:"enabled"`
+	// Tokens defined in configuration, more tokens could be managed with /api/tokens
+	Tokens []APITokenConfig `json:"tokens,omitempty" secret:"true"`
+}
+
+// ValidateAPIScope checks that scope is known
+func ValidateAPIScope(scope string) error {
+	if !StrSliceHasItem(APIScopes, scope) {
+		return fmt.Errorf("unknown scope %q, should be one of: %s", scope, strings.Join(APIScopes, ", "))
+	}
+
+	return nil
+}
+
+// RequestTokens returns tokens presented with request, either as bearer token or as
+// basic auth password (with any user name)
+func RequestTokens(r *http.Request) []string {
+	var candidates []string
+
+	if _, password, ok := r.BasicAuth(); ok {
+		candidates = append(candidates, password)
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		candidates = append(candidates, strings.TrimPrefix(auth, "Bearer "))
+	}
+
+	return candidates
+}
+
+// Authenticate finds configured token matching one presented with request, returns nil
+// if there is no such token
+func (conf *APIAuthConfig) Authenticate(r *http.Request) *APITokenConfig {
+	for _, candidate := range RequestTokens(r) {
+		for i := range conf.Tokens {
+			if secretMatches(conf.Tokens[i].Token, candidate) {
+				return &conf.Tokens[i]
+			}
+		}
+	}
+
+	return nil
+}
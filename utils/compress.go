@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/klauspost/pgzip"
 )
 
@@ -32,3 +33,26 @@ func CompressFile(source *os.File, onlyGzip bool) error {
 	cmd := exec.Command("bzip2", "-k", "-f", source.Name())
 	return cmd.Run()
 }
+
+// CompressFileZstd compresses file specified by source to .zst
+func CompressFileZstd(source *os.File) error {
+	zstFile, err := os.Create(source.Name() + ".zst")
+	if err != nil {
+		return err
+	}
+	defer zstFile.Close()
+
+	zstWriter, err := zstd.NewWriter(zstFile)
+	if err != nil {
+		return err
+	}
+
+	source.Seek(0, 0)
+	_, err = io.Copy(zstWriter, source)
+	if err != nil {
+		zstWriter.Close()
+		return err
+	}
+
+	return zstWriter.Close()
+}
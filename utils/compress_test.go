@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/klauspost/compress/zstd"
 	. "gopkg.in/check.v1"
 )
 
@@ -56,3 +57,21 @@ func (s *CompressSuite) TestCompress(c *C) {
 
 	c.Check(string(buf), Equals, testString)
 }
+
+func (s *CompressSuite) TestCompressZstd(c *C) {
+	err := CompressFileZstd(s.tempfile)
+	c.Assert(err, IsNil)
+
+	file, err := os.Open(s.tempfile.Name() + ".zst")
+	c.Assert(err, IsNil)
+	defer file.Close()
+
+	zstReader, err := zstd.NewReader(file)
+	c.Assert(err, IsNil)
+	defer zstReader.Close()
+
+	buf, err := ioutil.ReadAll(zstReader)
+	c.Assert(err, IsNil)
+
+	c.Check(string(buf), Equals, testString)
+}
@@ -5,44 +5,79 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 )
 
 // ConfigStructure is structure of main configuration
+//
+// Settings holding secrets should be tagged with secret:"true", so that they are
+// redacted when configuration is shown. Settings which could be changed on running
+// server (as they are looked up for every request or task) should be tagged with
+// reload:"true", so that they are applied by ReloadConfig.
 type ConfigStructure struct { // nolint: maligned
-	RootDir                string                           `json:"rootDir"`
-	DownloadConcurrency    int                              `json:"downloadConcurrency"`
-	DownloadLimit          int64                            `json:"downloadSpeedLimit"`
-	DownloadRetries        int                              `json:"downloadRetries"`
-	Downloader             string                           `json:"downloader"`
-	DatabaseOpenAttempts   int                              `json:"databaseOpenAttempts"`
-	Architectures          []string                         `json:"architectures"`
-	DepFollowSuggests      bool                             `json:"dependencyFollowSuggests"`
-	DepFollowRecommends    bool                             `json:"dependencyFollowRecommends"`
-	DepFollowAllVariants   bool                             `json:"dependencyFollowAllVariants"`
-	DepFollowSource        bool                             `json:"dependencyFollowSource"`
-	DepVerboseResolve      bool                             `json:"dependencyVerboseResolve"`
-	GpgDisableSign         bool                             `json:"gpgDisableSign"`
-	GpgDisableVerify       bool                             `json:"gpgDisableVerify"`
-	GpgProvider            string                           `json:"gpgProvider"`
-	DownloadSourcePackages bool                             `json:"downloadSourcePackages"`
-	PackagePoolStorage     PackagePoolStorage               `json:"packagePoolStorage"`
-	SkipLegacyPool         bool                             `json:"skipLegacyPool"`
-	PpaDistributorID       string                           `json:"ppaDistributorID"`
-	PpaCodename            string                           `json:"ppaCodename"`
-	SkipContentsPublishing bool                             `json:"skipContentsPublishing"`
-	SkipBz2Publishing      bool                             `json:"skipBz2Publishing"`
-	FileSystemPublishRoots map[string]FileSystemPublishRoot `json:"FileSystemPublishEndpoints"`
-	S3PublishRoots         map[string]S3PublishRoot         `json:"S3PublishEndpoints"`
-	SwiftPublishRoots      map[string]SwiftPublishRoot      `json:"SwiftPublishEndpoints"`
-	AzurePublishRoots      map[string]AzureEndpoint         `json:"AzurePublishEndpoints"`
-	AsyncAPI               bool                             `json:"AsyncAPI"`
-	EnableMetricsEndpoint  bool                             `json:"enableMetricsEndpoint"`
-	LogLevel               string                           `json:"logLevel"`
-	LogFormat              string                           `json:"logFormat"`
-	ServeInAPIMode         bool                             `json:"serveInAPIMode"`
-	DatabaseBackend        DBConfig                         `json:"databaseBackend"`
-	EnableSwaggerEndpoint  bool                             `json:"enableSwaggerEndpoint"`
+	RootDir                  string                           `json:"rootDir"`
+	DownloadConcurrency      int                              `json:"downloadConcurrency" reload:"true"`
+	DownloadLimit            int64                            `json:"downloadSpeedLimit" reload:"true"`
+	DownloadRetries          int                              `json:"downloadRetries" reload:"true"`
+	Downloader               string                           `json:"downloader"`
+	DatabaseOpenAttempts     int                              `json:"databaseOpenAttempts"`
+	Architectures            []string                         `json:"architectures"`
+	DepFollowSuggests        bool                             `json:"dependencyFollowSuggests"`
+	DepFollowRecommends      bool                             `json:"dependencyFollowRecommends"`
+	DepFollowAllVariants     bool                             `json:"dependencyFollowAllVariants"`
+	DepFollowSource          bool                             `json:"dependencyFollowSource"`
+	DepVerboseResolve        bool                             `json:"dependencyVerboseResolve"`
+	GpgDisableSign           bool                             `json:"gpgDisableSign" reload:"true"`
+	GpgDisableVerify         bool                             `json:"gpgDisableVerify" reload:"true"`
+	GpgProvider              string                           `json:"gpgProvider" reload:"true"`
+	DownloadSourcePackages   bool                             `json:"downloadSourcePackages"`
+	PackagePoolStorage       PackagePoolStorage               `json:"packagePoolStorage"`
+	SkipLegacyPool           bool                             `json:"skipLegacyPool"`
+	PpaDistributorID         string                           `json:"ppaDistributorID"`
+	PpaCodename              string                           `json:"ppaCodename"`
+	SkipContentsPublishing   bool                             `json:"skipContentsPublishing"`
+	SkipBz2Publishing        bool                             `json:"skipBz2Publishing"`
+	EnableZstPublishing      bool                             `json:"enableZstPublishing"`
+	GenerateDiffs            bool                             `json:"generateDiffs"`
+	FileSystemPublishRoots   map[string]FileSystemPublishRoot `json:"FileSystemPublishEndpoints" reload:"true"`
+	S3PublishRoots           map[string]S3PublishRoot         `json:"S3PublishEndpoints" reload:"true"`
+	SwiftPublishRoots        map[string]SwiftPublishRoot      `json:"SwiftPublishEndpoints" reload:"true"`
+	AzurePublishRoots        map[string]AzureEndpoint         `json:"AzurePublishEndpoints" reload:"true"`
+	OCIPublishRoots          map[string]OCIPublishRoot        `json:"OCIPublishEndpoints" reload:"true"`
+	RsyncPublishRoots        map[string]RsyncPublishRoot      `json:"RsyncPublishEndpoints" reload:"true"`
+	B2PublishRoots           map[string]B2PublishRoot         `json:"B2PublishEndpoints" reload:"true"`
+	GCSPublishRoots          map[string]GCSPublishRoot        `json:"GCSPublishEndpoints" reload:"true"`
+	AsyncAPI                 bool                             `json:"AsyncAPI"`
+	EnableMetricsEndpoint    bool                             `json:"enableMetricsEndpoint"`
+	LogLevel                 string                           `json:"logLevel"`
+	LogFormat                string                           `json:"logFormat"`
+	ServeInAPIMode           bool                             `json:"serveInAPIMode"`
+	DatabaseBackend          DBConfig                         `json:"databaseBackend"`
+	EnableSwaggerEndpoint    bool                             `json:"enableSwaggerEndpoint"`
+	EstimateConfirmThreshold int64                            `json:"estimateConfirmThreshold"`
+	MaxUploadSize            int64                            `json:"maxUploadSize"`
+	EnableDownloadStats      bool                             `json:"enableDownloadStats"`
+	ServeAccessControl       ServeAccessControl               `json:"serveAccessControl" reload:"true"`
+	ServeAccessLog           AccessLogConfig                  `json:"serveAccessLog"`
+	EnableWebUI              bool                             `json:"enableWebUI"`
+	WebUIAccessControl       ServeACL                         `json:"webUIAccessControl" reload:"true"`
+	Webhooks                 map[string]Webhook               `json:"webhooks" reload:"true"`
+	CDNInvalidation          map[string]CDNInvalidation       `json:"cdnInvalidation" reload:"true"`
+	PublishConcurrency       int                              `json:"publishConcurrency" reload:"true"`
+	PublishIndexConcurrency  int                              `json:"publishIndexConcurrency" reload:"true"`
+	Contexts                 map[string]json.RawMessage       `json:"contexts" reload:"true"`
+	Templates                map[string]ResourceTemplate      `json:"templates" reload:"true"`
+	Features                 map[string]bool                  `json:"features" reload:"true"`
+	PublishApproval          PublishApprovalConfig            `json:"publishApproval" reload:"true"`
+	Tenancy                  TenancyConfig                    `json:"tenancy" reload:"true"`
+	APIAuth                  APIAuthConfig                    `json:"apiAuth" reload:"true"`
+	Incoming                 IncomingConfig                   `json:"incoming" reload:"true"`
+	Notifiers                map[string]Notifier              `json:"notifiers" reload:"true"`
+	Replication              ReplicationConfig                `json:"replication"`
+	Signing                  SigningConfig                    `json:"signing" reload:"true"`
 }
 
 // DBConfig
@@ -113,8 +148,8 @@ type S3PublishRoot struct {
 	Bucket                  string `json:"bucket"`
 	Endpoint                string `json:"endpoint"`
 	AccessKeyID             string `json:"awsAccessKeyID"`
-	SecretAccessKey         string `json:"awsSecretAccessKey"`
-	SessionToken            string `json:"awsSessionToken"`
+	SecretAccessKey         string `json:"awsSecretAccessKey" secret:"true"`
+	SessionToken            string `json:"awsSessionToken" secret:"true"`
 	Prefix                  string `json:"prefix"`
 	ACL                     string `json:"acl"`
 	StorageClass            string `json:"storageClass"`
@@ -124,12 +159,23 @@ type S3PublishRoot struct {
 	ForceSigV2              bool   `json:"forceSigV2"`
 	ForceVirtualHostedStyle bool   `json:"forceVirtualHostedStyle"`
 	Debug                   bool   `json:"debug"`
+	GenerateIndexPages      bool   `json:"generateIndexPages"`
+	// path class ("dists" or "pool") -> object settings
+	PathClasses map[string]S3PathClass `json:"pathClasses"`
+}
+
+// S3PathClass describes settings of S3 objects for class of published paths
+type S3PathClass struct {
+	StorageClass string            `json:"storageClass"`
+	CacheControl string            `json:"cacheControl"`
+	ContentType  string            `json:"contentType"`
+	Tags         map[string]string `json:"tags"`
 }
 
 // SwiftPublishRoot describes single OpenStack Swift publishing entry point
 type SwiftPublishRoot struct {
 	UserName       string `json:"osname"`
-	Password       string `json:"password"`
+	Password       string `json:"password" secret:"true"`
 	AuthURL        string `json:"authurl"`
 	Tenant         string `json:"tenant"`
 	TenantID       string `json:"tenantid"`
@@ -144,56 +190,325 @@ type SwiftPublishRoot struct {
 // AzureEndpoint describes single Azure publishing entry point
 type AzureEndpoint struct {
 	AccountName string `json:"accountName"`
-	AccountKey  string `json:"accountKey"`
+	AccountKey  string `json:"accountKey" secret:"true"`
 	Container   string `json:"container"`
 	Prefix      string `json:"prefix"`
 	Endpoint    string `json:"endpoint"`
 }
 
+// OCIPublishRoot describes single OCI registry publishing entry point
+type OCIPublishRoot struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Username   string `json:"username"`
+	Password   string `json:"password" secret:"true"`
+	PlainHTTP  bool   `json:"plainHTTP"`
+	// published prefix -> "repository:tag" or "tag"
+	Prefixes map[string]string `json:"prefixes"`
+}
+
+// RsyncPublishRoot describes single rsync publishing entry point
+type RsyncPublishRoot struct {
+	Host         string   `json:"host"`
+	Path         string   `json:"path"`
+	SSHCommand   string   `json:"sshCommand"`
+	RsyncOptions []string `json:"rsyncOptions"`
+	StagingDir   string   `json:"stagingDir"`
+	LinkMethod   string   `json:"linkMethod"`
+}
+
+// B2PublishRoot describes single Backblaze B2 publishing entry point
+type B2PublishRoot struct {
+	ApplicationKeyID string `json:"applicationKeyID"`
+	ApplicationKey   string `json:"applicationKey" secret:"true"`
+	Bucket           string `json:"bucket"`
+	Prefix           string `json:"prefix"`
+}
+
+// GCSPublishRoot describes single Google Cloud Storage publishing entry point
+type GCSPublishRoot struct {
+	Bucket          string `json:"bucket"`
+	Prefix          string `json:"prefix"`
+	ACL             string `json:"acl"`
+	CredentialsFile string `json:"credentialsFile"`
+	Endpoint        string `json:"endpoint"`
+}
+
+// CDNInvalidation describes CDN cache invalidation after publishing to published storage
+type CDNInvalidation struct {
+	// Type is one of cloudfront, fastly, http
+	Type string `json:"type"`
+	// PathPrefix is prepended to published paths to build CDN paths
+	PathPrefix string `json:"pathPrefix"`
+	// CloudFront
+	DistributionID  string `json:"distributionID"`
+	AccessKeyID     string `json:"awsAccessKeyID"`
+	SecretAccessKey string `json:"awsSecretAccessKey" secret:"true"`
+	SessionToken    string `json:"awsSessionToken" secret:"true"`
+	// Fastly
+	APIToken string `json:"apiToken" secret:"true"`
+	BaseURL  string `json:"baseURL"`
+	// generic HTTP purge API
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers" secret:"true"`
+}
+
 // Config is configuration for aptly, shared by all modules
-var Config = ConfigStructure{
-	RootDir:                filepath.Join(os.Getenv("HOME"), ".aptly"),
-	DownloadConcurrency:    4,
-	DownloadLimit:          0,
-	Downloader:             "default",
-	DatabaseOpenAttempts:   -1,
-	Architectures:          []string{},
-	DepFollowSuggests:      false,
-	DepFollowRecommends:    false,
-	DepFollowAllVariants:   false,
-	DepFollowSource:        false,
-	GpgProvider:            "gpg",
-	GpgDisableSign:         false,
-	GpgDisableVerify:       false,
-	DownloadSourcePackages: false,
-	PackagePoolStorage: PackagePoolStorage{
-		Local: &LocalPoolStorage{Path: ""},
-	},
-	SkipLegacyPool:         false,
-	PpaDistributorID:       "ubuntu",
-	PpaCodename:            "",
-	FileSystemPublishRoots: map[string]FileSystemPublishRoot{},
-	S3PublishRoots:         map[string]S3PublishRoot{},
-	SwiftPublishRoots:      map[string]SwiftPublishRoot{},
-	AzurePublishRoots:      map[string]AzureEndpoint{},
-	AsyncAPI:               false,
-	EnableMetricsEndpoint:  false,
-	LogLevel:               "debug",
-	LogFormat:              "default",
-	ServeInAPIMode:         false,
-	EnableSwaggerEndpoint:  false,
+var Config = defaultConfig()
+
+// defaultConfig returns configuration with default settings
+func defaultConfig() ConfigStructure {
+	return ConfigStructure{
+		RootDir:                filepath.Join(os.Getenv("HOME"), ".aptly"),
+		DownloadConcurrency:    4,
+		DownloadLimit:          0,
+		Downloader:             "default",
+		DatabaseOpenAttempts:   -1,
+		Architectures:          []string{},
+		DepFollowSuggests:      false,
+		DepFollowRecommends:    false,
+		DepFollowAllVariants:   false,
+		DepFollowSource:        false,
+		GpgProvider:            "gpg",
+		GpgDisableSign:         false,
+		GpgDisableVerify:       false,
+		DownloadSourcePackages: false,
+		PackagePoolStorage: PackagePoolStorage{
+			Local: &LocalPoolStorage{Path: ""},
+		},
+		SkipLegacyPool:           false,
+		PpaDistributorID:         "ubuntu",
+		PpaCodename:              "",
+		FileSystemPublishRoots:   map[string]FileSystemPublishRoot{},
+		S3PublishRoots:           map[string]S3PublishRoot{},
+		SwiftPublishRoots:        map[string]SwiftPublishRoot{},
+		AzurePublishRoots:        map[string]AzureEndpoint{},
+		OCIPublishRoots:          map[string]OCIPublishRoot{},
+		RsyncPublishRoots:        map[string]RsyncPublishRoot{},
+		B2PublishRoots:           map[string]B2PublishRoot{},
+		GCSPublishRoots:          map[string]GCSPublishRoot{},
+		AsyncAPI:                 false,
+		EnableMetricsEndpoint:    false,
+		LogLevel:                 "debug",
+		LogFormat:                "default",
+		ServeInAPIMode:           false,
+		EnableSwaggerEndpoint:    false,
+		EstimateConfirmThreshold: 0,
+		MaxUploadSize:            4 << 30,
+		EnableDownloadStats:      false,
+		ServeAccessControl:       ServeAccessControl{},
+		ServeAccessLog:           AccessLogConfig{Format: AccessLogFormatCombined},
+		EnableWebUI:              false,
+		WebUIAccessControl:       ServeACL{},
+		Webhooks:                 map[string]Webhook{},
+		CDNInvalidation:          map[string]CDNInvalidation{},
+		PublishConcurrency:       4,
+		Contexts:                 map[string]json.RawMessage{},
+		Templates:                map[string]ResourceTemplate{},
+		Features:                 map[string]bool{},
+		PublishApproval:          PublishApprovalConfig{},
+		Tenancy:                  TenancyConfig{},
+		APIAuth:                  APIAuthConfig{},
+		Incoming:                 IncomingConfig{},
+		Notifiers:                map[string]Notifier{},
+		Replication:              ReplicationConfig{},
+		Signing:                  SigningConfig{},
+	}
 }
 
+// configFragmentsSuffix is appended to config file name to get directory with config fragments
+const configFragmentsSuffix = ".d"
+
 // LoadConfig loads configuration from json file
+//
+// Configuration fragments from drop-in directory (config file name with .d suffix, e.g.
+// /etc/aptly.conf.d/) are merged afterwards in lexical order: settings in fragments override
+// settings from main file, endpoints and other named entries are added.
 func LoadConfig(filename string, config *ConfigStructure) error {
+	err := decodeConfig(filename, config)
+	if err != nil {
+		return err
+	}
+
+	fragments, err := filepath.Glob(filepath.Join(filename+configFragmentsSuffix, "*.conf"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(fragments)
+
+	for _, fragment := range fragments {
+		if err = decodeConfig(fragment, config); err != nil {
+			return fmt.Errorf("error loading config fragment %s: %s", fragment, err)
+		}
+	}
+
+	return nil
+}
+
+// decodeConfig decodes single json config file over config
+func decodeConfig(filename string, config *ConfigStructure) error {
 	f, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
+	var raw interface{}
+
 	dec := json.NewDecoder(f)
-	return dec.Decode(&config)
+	dec.UseNumber()
+	if err = dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	raw, err = expandConfigValue(raw, filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+
+	return remarshal(raw, config)
+}
+
+// configEnvRegexp matches ${ENV_VAR} references in config values
+var configEnvRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// configFilePrefix marks config value which should be read from file
+const configFilePrefix = "file://"
+
+// expandConfigValue walks parsed JSON config, replacing ${ENV_VAR} references in string values with
+// environment variables and string values starting with file:// with contents of the file
+//
+// Relative file paths are resolved against directory of config file.
+func expandConfigValue(value interface{}, baseDir string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			expanded, err := expandConfigValue(item, baseDir)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err)
+			}
+			v[key] = expanded
+		}
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := expandConfigValue(item, baseDir)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	case string:
+		var err error
+
+		result := configEnvRegexp.ReplaceAllStringFunc(v, func(ref string) string {
+			name := configEnvRegexp.FindStringSubmatch(ref)[1]
+			env, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("environment variable %s is not set", name)
+			}
+			return env
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(result, configFilePrefix) {
+			path := strings.TrimPrefix(result, configFilePrefix)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(baseDir, path)
+			}
+
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s: %s", path, err)
+			}
+
+			result = strings.TrimRight(string(contents), "\r\n")
+		}
+
+		return result, nil
+	}
+
+	return value, nil
+}
+
+// ApplyContext overlays settings of named context over configuration
+//
+// Context is a partial configuration, settings which are not set in context are
+// kept from main configuration.
+func (conf *ConfigStructure) ApplyContext(name string) error {
+	overlay, ok := conf.Contexts[name]
+	if !ok {
+		return fmt.Errorf("context %s not found in configuration", name)
+	}
+
+	if err := json.Unmarshal(overlay, conf); err != nil {
+		return fmt.Errorf("error loading context %s: %s", name, err)
+	}
+
+	return nil
+}
+
+// ReloadConfig loads configuration from json file and applies reloadable settings
+// to copy of config, returning updated copy and list of changed settings which require restart
+//
+// If contextName is not empty, named context is applied to loaded configuration.
+func ReloadConfig(filename string, contextName string, config *ConfigStructure) (*ConfigStructure, []string, error) {
+	loaded := defaultConfig()
+	if err := LoadConfig(filename, &loaded); err != nil {
+		return nil, nil, fmt.Errorf("error loading config file %s: %s", filename, err)
+	}
+
+	if contextName != "" {
+		if err := loaded.ApplyContext(contextName); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := loaded.ValidateFeatures(); err != nil {
+		return nil, nil, err
+	}
+
+	updated := *config
+
+	// copy settings tagged as reloadable
+	updatedValue, loadedValue := reflect.ValueOf(&updated).Elem(), reflect.ValueOf(&loaded).Elem()
+	for i := 0; i < updatedValue.NumField(); i++ {
+		if updatedValue.Type().Field(i).Tag.Get("reload") == "true" {
+			updatedValue.Field(i).Set(loadedValue.Field(i))
+		}
+	}
+
+	// find out settings which were changed, but not applied
+	var current, wanted map[string]json.RawMessage
+	if err := remarshal(&updated, &current); err != nil {
+		return nil, nil, err
+	}
+	if err := remarshal(&loaded, &wanted); err != nil {
+		return nil, nil, err
+	}
+
+	// reloadable settings were copied, so only settings requiring restart might differ
+	ignored := []string{}
+	for key := range wanted {
+		if string(current[key]) != string(wanted[key]) {
+			ignored = append(ignored, key)
+		}
+	}
+	sort.Strings(ignored)
+
+	return &updated, ignored, nil
+}
+
+// remarshal converts value to another type via JSON
+func remarshal(value interface{}, result interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(encoded, result)
 }
 
 // SaveConfig write configuration to json file
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 
@@ -26,6 +27,124 @@ func (s *ConfigSuite) TestLoadConfig(c *C) {
 	c.Check(s.config.DatabaseOpenAttempts, Equals, 33)
 }
 
+func (s *ConfigSuite) TestLoadConfigFragments(c *C) {
+	configname := filepath.Join(c.MkDir(), "aptly.conf")
+	c.Assert(os.WriteFile(configname, []byte(`{"rootDir": "/srv/aptly", "downloadConcurrency": 3,
+		"S3PublishEndpoints": {"main": {"bucket": "main"}}}`), 0644), IsNil)
+
+	config := defaultConfig()
+	c.Assert(LoadConfig(configname, &config), IsNil)
+	c.Check(config.S3PublishRoots, HasLen, 1)
+
+	c.Assert(os.Mkdir(configname+".d", 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(configname+".d", "20-s3.conf"),
+		[]byte(`{"S3PublishEndpoints": {"extra": {"bucket": "extra"}}, "downloadConcurrency": 5}`), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(configname+".d", "10-s3.conf"),
+		[]byte(`{"S3PublishEndpoints": {"other": {"bucket": "other"}}, "downloadConcurrency": 4}`), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(configname+".d", "README"), []byte(`not a config`), 0644), IsNil)
+
+	config = defaultConfig()
+	c.Assert(LoadConfig(configname, &config), IsNil)
+	c.Check(config.RootDir, Equals, "/srv/aptly")
+	c.Check(config.DownloadConcurrency, Equals, 5)
+	c.Check(config.S3PublishRoots, HasLen, 3)
+	c.Check(config.S3PublishRoots["extra"].Bucket, Equals, "extra")
+	c.Check(config.S3PublishRoots["main"].Bucket, Equals, "main")
+
+	c.Assert(os.WriteFile(filepath.Join(configname+".d", "30-broken.conf"), []byte(`{"rootDir": `), 0644), IsNil)
+	c.Check(LoadConfig(configname, &config), ErrorMatches, "error loading config fragment .*30-broken.conf: unexpected EOF")
+}
+
+func (s *ConfigSuite) TestLoadConfigSubstitution(c *C) {
+	dir := c.MkDir()
+	configname := filepath.Join(dir, "aptly.json")
+	c.Assert(os.WriteFile(filepath.Join(dir, "secret"), []byte("s3cr3t\n"), 0600), IsNil)
+	c.Assert(os.WriteFile(configname, []byte(`{"rootDir": "${APTLY_TEST_ROOT}/aptly", "downloadSpeedLimit": 1099511627776,
+		"S3PublishEndpoints": {"test": {"bucket": "${APTLY_TEST_BUCKET}", "awsAccessKeyID": "file://secret",
+		"awsSecretAccessKey": "file://`+filepath.Join(dir, "secret")+`"}},
+		"ppaDistributorID": "$HOME"}`), 0644), IsNil)
+
+	os.Setenv("APTLY_TEST_ROOT", "/srv")
+	os.Setenv("APTLY_TEST_BUCKET", "repo")
+	defer os.Unsetenv("APTLY_TEST_ROOT")
+	defer os.Unsetenv("APTLY_TEST_BUCKET")
+
+	config := defaultConfig()
+	c.Assert(LoadConfig(configname, &config), IsNil)
+	c.Check(config.RootDir, Equals, "/srv/aptly")
+	c.Check(config.DownloadLimit, Equals, int64(1099511627776))
+	c.Check(config.S3PublishRoots["test"].Bucket, Equals, "repo")
+	c.Check(config.S3PublishRoots["test"].AccessKeyID, Equals, "s3cr3t")
+	c.Check(config.S3PublishRoots["test"].SecretAccessKey, Equals, "s3cr3t")
+	c.Check(config.PpaDistributorID, Equals, "$HOME")
+
+	os.Unsetenv("APTLY_TEST_BUCKET")
+	c.Check(LoadConfig(configname, &config), ErrorMatches, "S3PublishEndpoints: test: bucket: environment variable APTLY_TEST_BUCKET is not set")
+
+	c.Assert(os.WriteFile(configname, []byte(`{"gpgProvider": "file://missing"}`), 0644), IsNil)
+	c.Check(LoadConfig(configname, &config), ErrorMatches, "gpgProvider: unable to read .*missing: .*")
+}
+
+func (s *ConfigSuite) TestReloadConfig(c *C) {
+	configname := filepath.Join(c.MkDir(), "aptly.json")
+	c.Assert(os.WriteFile(configname, []byte(configFile), 0644), IsNil)
+
+	config := defaultConfig()
+	c.Assert(LoadConfig(configname, &config), IsNil)
+
+	reloaded, ignored, err := ReloadConfig(configname, "", &config)
+	c.Check(err, IsNil)
+	c.Check(ignored, DeepEquals, []string{})
+	c.Check(*reloaded, DeepEquals, config)
+
+	c.Assert(os.WriteFile(configname, []byte(`{"rootDir": "/srv/aptly/", "downloadConcurrency": 2, "logLevel": "warn",
+		"S3PublishEndpoints": {"test": {"bucket": "repo"}}, "notifiers": {"ops": {"type": "slack", "url": "https://hooks.example.com/x"}}}`), 0644), IsNil)
+
+	reloaded, ignored, err = ReloadConfig(configname, "", &config)
+	c.Check(err, IsNil)
+	c.Check(ignored, DeepEquals, []string{"databaseOpenAttempts", "logLevel", "rootDir"})
+	c.Check(reloaded.Notifiers["ops"].URL, Equals, "https://hooks.example.com/x")
+	c.Check(reloaded.GetRootDir(), Equals, "/opt/aptly/")
+	c.Check(reloaded.LogLevel, Equals, "debug")
+	c.Check(reloaded.DownloadConcurrency, Equals, 2)
+	c.Check(reloaded.S3PublishRoots["test"].Bucket, Equals, "repo")
+	// original configuration is not modified
+	c.Check(config.DownloadConcurrency, Equals, 33)
+	c.Check(config.S3PublishRoots["test"].Bucket, Equals, "")
+
+	c.Assert(os.WriteFile(configname, []byte(`{"rootDir": `), 0644), IsNil)
+	_, _, err = ReloadConfig(configname, "", reloaded)
+	c.Check(err, ErrorMatches, "error loading config file .*: unexpected EOF")
+	c.Check(reloaded.DownloadConcurrency, Equals, 2)
+}
+
+func (s *ConfigSuite) TestApplyContext(c *C) {
+	configname := filepath.Join(c.MkDir(), "aptly.json")
+	c.Assert(os.WriteFile(configname, []byte(`{"rootDir": "/srv/aptly", "downloadConcurrency": 3,
+		"FileSystemPublishEndpoints": {"www": {"rootDir": "/var/www"}},
+		"contexts": {
+			"staging": {"rootDir": "/srv/staging", "FileSystemPublishEndpoints": {"www": {"rootDir": "/var/www/staging"}}},
+			"broken": {"rootDir": 5}
+		}}`), 0644), IsNil)
+
+	config := defaultConfig()
+	c.Assert(LoadConfig(configname, &config), IsNil)
+	c.Assert(config.ApplyContext("staging"), IsNil)
+	c.Check(config.RootDir, Equals, "/srv/staging")
+	c.Check(config.DownloadConcurrency, Equals, 3)
+	c.Check(config.FileSystemPublishRoots["www"].RootDir, Equals, "/var/www/staging")
+
+	c.Check(config.ApplyContext("production"), ErrorMatches, "context production not found in configuration")
+	c.Check(config.ApplyContext("broken"), ErrorMatches, "error loading context broken: .*")
+
+	_, ignored, err := ReloadConfig(configname, "staging", &config)
+	c.Check(err, IsNil)
+	c.Check(ignored, DeepEquals, []string{})
+
+	_, _, err = ReloadConfig(configname, "production", &config)
+	c.Check(err, ErrorMatches, "context production not found in configuration")
+}
+
 func (s *ConfigSuite) TestSaveConfig(c *C) {
 	configname := filepath.Join(c.MkDir(), "aptly.json")
 
@@ -41,7 +160,9 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 
 	s.config.S3PublishRoots = map[string]S3PublishRoot{"test": {
 		Region: "us-east-1",
-		Bucket: "repo"}}
+		Bucket: "repo",
+		PathClasses: map[string]S3PathClass{"dists": {
+			CacheControl: "max-age=60", Tags: map[string]string{"class": "metadata"}}}}}
 
 	s.config.SwiftPublishRoots = map[string]SwiftPublishRoot{"test": {
 		Container: "repo"}}
@@ -49,6 +170,48 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 	s.config.AzurePublishRoots = map[string]AzureEndpoint{"test": {
 		Container: "repo"}}
 
+	s.config.OCIPublishRoots = map[string]OCIPublishRoot{"test": {
+		Registry: "registry.example.com", Repository: "apt/repo",
+		Prefixes: map[string]string{"ubuntu": "apt/ubuntu:stable"}}}
+
+	s.config.RsyncPublishRoots = map[string]RsyncPublishRoot{"test": {
+		Host: "mirror@mirror.example.com", Path: "/srv/apt",
+		RsyncOptions: []string{"--bwlimit=10000"}}}
+
+	s.config.B2PublishRoots = map[string]B2PublishRoot{"test": {
+		Bucket: "repo", Prefix: "debian"}}
+
+	s.config.GCSPublishRoots = map[string]GCSPublishRoot{"test": {
+		Bucket: "repo", ACL: "public-read"}}
+
+	s.config.ServeAccessControl = ServeAccessControl{"customer": {
+		Tokens: []string{"t0ken"}}}
+	s.config.Webhooks = map[string]Webhook{"upstream": {
+		Secret: "s3cret", Action: WebhookActionMirrorUpdate, Mirror: "debian"}}
+
+	s.config.PublishConcurrency = 8
+	s.config.Contexts = map[string]json.RawMessage{"staging": json.RawMessage(`{"rootDir": "/tmp/staging"}`)}
+	skipContents := true
+	s.config.Templates = map[string]ResourceTemplate{"standard": {Architectures: []string{"amd64", "arm64"},
+		SkipContents: &skipContents, GpgKey: "A0546A43624A8331"}}
+	s.config.Features = map[string]bool{FeatureB2Publishing: true}
+	s.config.PublishApproval = PublishApprovalConfig{Enabled: true, Users: map[string]string{"release": "s3cret"}}
+	s.config.Tenancy = TenancyConfig{Enabled: true, AdminTokens: []string{"r00t"}, Tenants: map[string]TenantConfig{
+		"team-a": {GpgKey: "A0546A43624A8331", Quota: 10737418240, Tokens: []string{"t0ken"}}}}
+	s.config.APIAuth = APIAuthConfig{Enabled: true, Tokens: []APITokenConfig{{Name: "ci", Token: "c1",
+		Scope: APIScopePublishAdmin, Prefixes: []string{"ppa"}}}}
+	s.config.Incoming = IncomingConfig{Checks: []IncomingCheck{{Name: "lintian",
+		Command: []string{"lintian", "--fail-on", "error"}, Timeout: 300}}}
+	s.config.Notifiers = map[string]Notifier{"ops": {Type: "slack", Events: []string{NotifyEventTaskFailed},
+		MinSeverity: NotifySeverityWarning, URL: "https://hooks.slack.com/services/T000/B000/XXXX"}}
+	s.config.Replication = ReplicationConfig{Role: ReplicationRoleReplica, PrimaryURL: "http://primary.example.com:8080",
+		PrimaryToken: "r00t", Interval: 60, LagAlert: 600, Publish: true}
+	s.config.Signing = SigningConfig{Backend: SigningBackendVault, Vault: VaultSigningConfig{
+		Address: "https://vault.example.com:8200", Key: "aptly", Keyring: "/etc/aptly/signing.asc"}}
+	s.config.CDNInvalidation = map[string]CDNInvalidation{"s3:test": {
+		Type: "http", URL: "https://cache.example.com/purge",
+		Headers: map[string]string{"Authorization": "Bearer t0ken"}}}
+
 	s.config.LogLevel = "info"
 	s.config.LogFormat = "json"
 
@@ -89,6 +252,8 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 		"  \"ppaCodename\": \"\",\n"+
 		"  \"skipContentsPublishing\": false,\n"+
 		"  \"skipBz2Publishing\": false,\n"+
+		"  \"enableZstPublishing\": false,\n"+
+		"  \"generateDiffs\": false,\n"+
 		"  \"FileSystemPublishEndpoints\": {\n"+
 		"    \"test\": {\n"+
 		"      \"rootDir\": \"/opt/aptly-publish\",\n"+
@@ -112,7 +277,18 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 		"      \"disableMultiDel\": false,\n"+
 		"      \"forceSigV2\": false,\n"+
 		"      \"forceVirtualHostedStyle\": false,\n"+
-		"      \"debug\": false\n"+
+		"      \"debug\": false,\n"+
+		"      \"generateIndexPages\": false,\n"+
+		"      \"pathClasses\": {\n"+
+		"        \"dists\": {\n"+
+		"          \"storageClass\": \"\",\n"+
+		"          \"cacheControl\": \"max-age=60\",\n"+
+		"          \"contentType\": \"\",\n"+
+		"          \"tags\": {\n"+
+		"            \"class\": \"metadata\"\n"+
+		"          }\n"+
+		"        }\n"+
+		"      }\n"+
 		"    }\n"+
 		"  },\n"+
 		"  \"SwiftPublishEndpoints\": {\n"+
@@ -139,6 +315,47 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 		"      \"endpoint\": \"\"\n"+
 		"    }\n"+
 		"  },\n"+
+		"  \"OCIPublishEndpoints\": {\n"+
+		"    \"test\": {\n"+
+		"      \"registry\": \"registry.example.com\",\n"+
+		"      \"repository\": \"apt/repo\",\n"+
+		"      \"username\": \"\",\n"+
+		"      \"password\": \"\",\n"+
+		"      \"plainHTTP\": false,\n"+
+		"      \"prefixes\": {\n"+
+		"        \"ubuntu\": \"apt/ubuntu:stable\"\n"+
+		"      }\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"RsyncPublishEndpoints\": {\n"+
+		"    \"test\": {\n"+
+		"      \"host\": \"mirror@mirror.example.com\",\n"+
+		"      \"path\": \"/srv/apt\",\n"+
+		"      \"sshCommand\": \"\",\n"+
+		"      \"rsyncOptions\": [\n"+
+		"        \"--bwlimit=10000\"\n"+
+		"      ],\n"+
+		"      \"stagingDir\": \"\",\n"+
+		"      \"linkMethod\": \"\"\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"B2PublishEndpoints\": {\n"+
+		"    \"test\": {\n"+
+		"      \"applicationKeyID\": \"\",\n"+
+		"      \"applicationKey\": \"\",\n"+
+		"      \"bucket\": \"repo\",\n"+
+		"      \"prefix\": \"debian\"\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"GCSPublishEndpoints\": {\n"+
+		"    \"test\": {\n"+
+		"      \"bucket\": \"repo\",\n"+
+		"      \"prefix\": \"\",\n"+
+		"      \"acl\": \"public-read\",\n"+
+		"      \"credentialsFile\": \"\",\n"+
+		"      \"endpoint\": \"\"\n"+
+		"    }\n"+
+		"  },\n"+
 		"  \"AsyncAPI\": false,\n"+
 		"  \"enableMetricsEndpoint\": false,\n"+
 		"  \"logLevel\": \"info\",\n"+
@@ -149,7 +366,141 @@ func (s *ConfigSuite) TestSaveConfig(c *C) {
 		"    \"url\": \"\",\n"+
                 "    \"dbPath\": \"\"\n" +
 		"  },\n"+
-                "  \"enableSwaggerEndpoint\": false\n" +
+                "  \"enableSwaggerEndpoint\": false,\n" +
+		"  \"estimateConfirmThreshold\": 0,\n"+
+		"  \"maxUploadSize\": 0,\n"+
+		"  \"enableDownloadStats\": false,\n"+
+		"  \"serveAccessControl\": {\n"+
+		"    \"customer\": {\n"+
+		"      \"tokens\": [\n"+
+		"        \"t0ken\"\n"+
+		"      ]\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"serveAccessLog\": {\n"+
+		"    \"path\": \"\",\n"+
+		"    \"format\": \"\"\n"+
+		"  },\n"+
+		"  \"enableWebUI\": false,\n"+
+		"  \"webUIAccessControl\": {},\n"+
+		"  \"webhooks\": {\n"+
+		"    \"upstream\": {\n"+
+		"      \"secret\": \"s3cret\",\n"+
+		"      \"action\": \"mirror-update\",\n"+
+		"      \"mirror\": \"debian\"\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"cdnInvalidation\": {\n"+
+		"    \"s3:test\": {\n"+
+		"      \"type\": \"http\",\n"+
+		"      \"pathPrefix\": \"\",\n"+
+		"      \"distributionID\": \"\",\n"+
+		"      \"awsAccessKeyID\": \"\",\n"+
+		"      \"awsSecretAccessKey\": \"\",\n"+
+		"      \"awsSessionToken\": \"\",\n"+
+		"      \"apiToken\": \"\",\n"+
+		"      \"baseURL\": \"\",\n"+
+		"      \"url\": \"https://cache.example.com/purge\",\n"+
+		"      \"method\": \"\",\n"+
+		"      \"headers\": {\n"+
+		"        \"Authorization\": \"Bearer t0ken\"\n"+
+		"      }\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"publishConcurrency\": 8,\n"+
+		"  \"publishIndexConcurrency\": 0,\n"+
+		"  \"contexts\": {\n"+
+		"    \"staging\": {\n"+
+		"      \"rootDir\": \"/tmp/staging\"\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"templates\": {\n"+
+		"    \"standard\": {\n"+
+		"      \"architectures\": [\n"+
+		"        \"amd64\",\n"+
+		"        \"arm64\"\n"+
+		"      ],\n"+
+		"      \"skipContents\": true,\n"+
+		"      \"gpgKey\": \"A0546A43624A8331\"\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"features\": {\n"+
+		"    \"b2Publishing\": true\n"+
+		"  },\n"+
+		"  \"publishApproval\": {\n"+
+		"    \"enabled\": true,\n"+
+		"    \"users\": {\n"+
+		"      \"release\": \"s3cret\"\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"tenancy\": {\n"+
+		"    \"enabled\": true,\n"+
+		"    \"adminTokens\": [\n"+
+		"      \"r00t\"\n"+
+		"    ],\n"+
+		"    \"tenants\": {\n"+
+		"      \"team-a\": {\n"+
+		"        \"gpgKey\": \"A0546A43624A8331\",\n"+
+		"        \"quota\": 10737418240,\n"+
+		"        \"tokens\": [\n"+
+		"          \"t0ken\"\n"+
+		"        ]\n"+
+		"      }\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"apiAuth\": {\n"+
+		"    \"enabled\": true,\n"+
+		"    \"tokens\": [\n"+
+		"      {\n"+
+		"        \"name\": \"ci\",\n"+
+		"        \"token\": \"c1\",\n"+
+		"        \"scope\": \"publish-admin\",\n"+
+		"        \"prefixes\": [\n"+
+		"          \"ppa\"\n"+
+		"        ]\n"+
+		"      }\n"+
+		"    ]\n"+
+		"  },\n"+
+		"  \"incoming\": {\n"+
+		"    \"checks\": [\n"+
+		"      {\n"+
+		"        \"name\": \"lintian\",\n"+
+		"        \"command\": [\n"+
+		"          \"lintian\",\n"+
+		"          \"--fail-on\",\n"+
+		"          \"error\"\n"+
+		"        ],\n"+
+		"        \"timeout\": 300\n"+
+		"      }\n"+
+		"    ]\n"+
+		"  },\n"+
+		"  \"notifiers\": {\n"+
+		"    \"ops\": {\n"+
+		"      \"type\": \"slack\",\n"+
+		"      \"events\": [\n"+
+		"        \"task-failed\"\n"+
+		"      ],\n"+
+		"      \"minSeverity\": \"warning\",\n"+
+		"      \"url\": \"https://hooks.slack.com/services/T000/B000/XXXX\"\n"+
+		"    }\n"+
+		"  },\n"+
+		"  \"replication\": {\n"+
+		"    \"role\": \"replica\",\n"+
+		"    \"primaryURL\": \"http://primary.example.com:8080\",\n"+
+		"    \"primaryToken\": \"r00t\",\n"+
+		"    \"interval\": 60,\n"+
+		"    \"lagAlert\": 600,\n"+
+		"    \"publish\": true\n"+
+		"  },\n"+
+		"  \"signing\": {\n"+
+		"    \"backend\": \"vault\",\n"+
+		"    \"vault\": {\n"+
+		"      \"address\": \"https://vault.example.com:8200\",\n"+
+		"      \"key\": \"aptly\",\n"+
+		"      \"keyring\": \"/etc/aptly/signing.asc\"\n"+
+		"    },\n"+
+		"    \"awsKms\": {}\n"+
+		"  }\n"+
 		"}")
 }
 
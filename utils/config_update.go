@@ -0,0 +1,379 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces secrets in redacted configuration
+const RedactedValue = "<redacted>"
+
+// RuntimeSettings are JSON keys of settings which could be changed on running server
+// and persisted to configuration file
+var RuntimeSettings = []string{
+	"downloadConcurrency", "downloadSpeedLimit", "downloadRetries",
+	"skipContentsPublishing", "skipBz2Publishing", "enableZstPublishing",
+}
+
+// Redacted returns configuration as JSON object with secrets replaced by RedactedValue
+//
+// Secrets are settings tagged with secret:"true", for maps and lists all the values are secrets.
+func (conf *ConfigStructure) Redacted() (map[string]interface{}, error) {
+	var result map[string]interface{}
+
+	redacted := redactValue(reflect.ValueOf(*conf), false).Interface()
+	if err := remarshal(redacted, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// configOverlaysType is type of configuration contexts, which are partial configurations
+var configOverlaysType = reflect.TypeOf(map[string]json.RawMessage{})
+
+// isSecretField returns true if struct field holds a secret
+func isSecretField(field reflect.StructField) bool {
+	return field.Tag.Get("secret") == "true"
+}
+
+// redactValue returns deep copy of value with secrets replaced by RedactedValue
+func redactValue(value reflect.Value, secret bool) reflect.Value {
+	switch value.Kind() {
+	case reflect.String:
+		if secret && value.String() != "" {
+			return reflect.ValueOf(RedactedValue).Convert(value.Type())
+		}
+	case reflect.Ptr:
+		if !value.IsNil() {
+			result := reflect.New(value.Type().Elem())
+			result.Elem().Set(redactValue(value.Elem(), secret))
+			return result
+		}
+	case reflect.Struct:
+		result := reflect.New(value.Type()).Elem()
+		result.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.IsExported() {
+				result.Field(i).Set(redactValue(value.Field(i), secret || isSecretField(field)))
+			}
+		}
+		return result
+	case reflect.Map:
+		if value.IsNil() {
+			break
+		}
+		if value.Type() == configOverlaysType {
+			return reflect.ValueOf(redactOverlays(value.Interface().(map[string]json.RawMessage), secret))
+		}
+		result := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			result.SetMapIndex(iter.Key(), redactValue(iter.Value(), secret))
+		}
+		return result
+	case reflect.Slice:
+		if value.IsNil() || value.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		result := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			result.Index(i).Set(redactValue(value.Index(i), secret))
+		}
+		return result
+	}
+
+	return value
+}
+
+// redactOverlays redacts configuration contexts, settings which couldn't be parsed are redacted completely
+func redactOverlays(overlays map[string]json.RawMessage, secret bool) map[string]json.RawMessage {
+	redactedJSON, _ := json.Marshal(RedactedValue)
+	fields := map[string]reflect.StructField{}
+	configType := reflect.TypeOf(ConfigStructure{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		fields[strings.Split(field.Tag.Get("json"), ",")[0]] = field
+	}
+
+	result := make(map[string]json.RawMessage, len(overlays))
+	for name, overlay := range overlays {
+		var settings map[string]json.RawMessage
+		if secret || json.Unmarshal(overlay, &settings) != nil {
+			result[name] = redactedJSON
+			continue
+		}
+
+		for key, setting := range settings {
+			field, ok := fields[key]
+			if !ok {
+				continue
+			}
+
+			parsed := reflect.New(field.Type)
+			if err := json.Unmarshal(setting, parsed.Interface()); err != nil {
+				settings[key] = redactedJSON
+				continue
+			}
+
+			encoded, err := json.Marshal(redactValue(parsed.Elem(), isSecretField(field)).Interface())
+			if err != nil {
+				encoded = redactedJSON
+			}
+			settings[key] = encoded
+		}
+
+		result[name], _ = json.Marshal(settings)
+	}
+
+	return result
+}
+
+// ValidateRuntimeSettings checks that settings could be changed at runtime and
+// applies them to config
+func ValidateRuntimeSettings(config *ConfigStructure, settings map[string]json.RawMessage) error {
+	if len(settings) == 0 {
+		return fmt.Errorf("no settings to update")
+	}
+
+	for key := range settings {
+		if !StrSliceHasItem(RuntimeSettings, key) {
+			return fmt.Errorf("setting %s could not be changed at runtime", key)
+		}
+	}
+
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(encoded, config); err != nil {
+		return fmt.Errorf("invalid settings: %s", err)
+	}
+
+	if config.DownloadConcurrency < 1 {
+		return fmt.Errorf("downloadConcurrency should be positive")
+	}
+	if config.DownloadLimit < 0 {
+		return fmt.Errorf("downloadSpeedLimit should not be negative")
+	}
+	if config.DownloadRetries < 0 {
+		return fmt.Errorf("downloadRetries should not be negative")
+	}
+
+	return nil
+}
+
+// UpdateConfigFile sets settings in json config file, preserving other settings as is
+//
+// If contextName is not empty, settings are set in named context. Settings are patched in place,
+// so that order of keys and formatting of the file are kept. Settings defined in config fragments
+// can't be updated, as fragments override the file. File is replaced atomically.
+func UpdateConfigFile(filename string, contextName string, settings map[string]json.RawMessage) error {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if err = checkConfigFragments(filename, contextName, settings); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var value bytes.Buffer
+		if err = json.Compact(&value, settings[key]); err != nil {
+			return fmt.Errorf("invalid value of setting %s: %s", key, err)
+		}
+
+		start := 0
+		if contextName != "" {
+			member, err := findJSONMember(contents, start, "contexts")
+			if err == nil && member.found {
+				member, err = findJSONMember(contents, member.valueStart, contextName)
+			}
+			if err != nil || !member.found {
+				return fmt.Errorf("context %s not found in config file %s", contextName, filename)
+			}
+			start = member.valueStart
+		}
+
+		contents, err = setJSONMember(contents, start, key, value.Bytes())
+		if err != nil {
+			return fmt.Errorf("error updating config file %s: %s", filename, err)
+		}
+	}
+
+	// write to temporary file in the same directory and rename it over config file
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(contents); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if info, e := os.Stat(filename); e == nil {
+		if err = os.Chmod(f.Name(), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(f.Name(), filename)
+}
+
+// checkConfigFragments verifies that settings are not overridden by config fragments
+func checkConfigFragments(filename string, contextName string, settings map[string]json.RawMessage) error {
+	fragments, err := filepath.Glob(filepath.Join(filename+configFragmentsSuffix, "*.conf"))
+	if err != nil {
+		return err
+	}
+
+	for _, fragment := range fragments {
+		contents, err := os.ReadFile(fragment)
+		if err != nil {
+			return err
+		}
+
+		var raw map[string]json.RawMessage
+		if err = json.Unmarshal(contents, &raw); err != nil {
+			return fmt.Errorf("error loading config fragment %s: %s", fragment, err)
+		}
+
+		if contextName != "" {
+			var contexts map[string]json.RawMessage
+			if json.Unmarshal(raw["contexts"], &contexts) == nil && contexts[contextName] != nil {
+				return fmt.Errorf("context %s is defined in config fragment %s", contextName, fragment)
+			}
+			continue
+		}
+
+		for key := range settings {
+			if _, ok := raw[key]; ok {
+				return fmt.Errorf("setting %s is defined in config fragment %s", key, fragment)
+			}
+		}
+	}
+
+	return nil
+}
+
+// jsonMember is location of member in JSON object
+type jsonMember struct {
+	found bool
+	// number of members before the member
+	members int
+	// start of key and boundaries of value of the member
+	keyStart, valueStart, valueEnd int
+	// end of previous member value (or start of object) and closing brace of object
+	lastEnd, objectEnd int
+}
+
+// findJSONMember locates member key in JSON object starting at offset start of data
+func findJSONMember(data []byte, start int, key string) (jsonMember, error) {
+	var member jsonMember
+
+	decoder := json.NewDecoder(bytes.NewReader(data[start:]))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return member, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return member, fmt.Errorf("JSON object expected")
+	}
+	member.lastEnd = start + int(decoder.InputOffset())
+
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return member, err
+		}
+
+		keyEnd := start + int(decoder.InputOffset())
+		keyStart := bytes.LastIndexByte(data[:keyEnd-1], '"')
+
+		var value json.RawMessage
+		if err = decoder.Decode(&value); err != nil {
+			return member, err
+		}
+		valueEnd := start + int(decoder.InputOffset())
+
+		if token.(string) == key {
+			member.found = true
+			member.keyStart = keyStart
+			member.valueEnd = valueEnd
+			member.valueStart = valueEnd - len(value)
+			return member, nil
+		}
+
+		member.keyStart = keyStart
+		member.lastEnd = valueEnd
+		member.members++
+	}
+
+	if _, err = decoder.Token(); err != nil {
+		return member, err
+	}
+	member.objectEnd = start + int(decoder.InputOffset()) - 1
+
+	return member, nil
+}
+
+// setJSONMember sets member key of JSON object starting at offset start of data to value,
+// new members are appended to the object using indentation of the last member
+func setJSONMember(data []byte, start int, key string, value []byte) ([]byte, error) {
+	member, err := findJSONMember(data, start, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var result bytes.Buffer
+
+	if member.found {
+		result.Write(data[:member.valueStart])
+		result.Write(value)
+		result.Write(data[member.valueEnd:])
+
+		return result.Bytes(), nil
+	}
+
+	encodedKey, _ := json.Marshal(key)
+
+	result.Write(data[:member.lastEnd])
+	if member.members > 0 {
+		// repeat indentation of the last member
+		lineStart := bytes.LastIndexByte(data[:member.keyStart], '\n')
+		indent := " "
+		if lineStart >= start {
+			indent = string(data[lineStart:member.keyStart])
+		}
+		result.WriteString(",")
+		result.WriteString(indent)
+	}
+	result.Write(encodedKey)
+	result.WriteString(": ")
+	result.Write(value)
+	result.Write(data[member.lastEnd:])
+
+	return result.Bytes(), nil
+}
@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConfigUpdateSuite struct{}
+
+var _ = Suite(&ConfigUpdateSuite{})
+
+func (s *ConfigUpdateSuite) TestRedacted(c *C) {
+	config := defaultConfig()
+	config.S3PublishRoots = map[string]S3PublishRoot{"test": {Bucket: "repo", AccessKeyID: "id", SecretAccessKey: "secret"}}
+	config.ServeAccessControl = ServeAccessControl{".": {Users: map[string]string{"admin": "pass"}, Tokens: []string{"t1"}}}
+	config.Contexts = map[string]json.RawMessage{"staging": json.RawMessage(`{"webhooks": {"ci": {"secret": "s", "action": "mirror-update"}}}`)}
+
+	result, err := config.Redacted()
+	c.Assert(err, IsNil)
+
+	s3 := result["S3PublishEndpoints"].(map[string]interface{})["test"].(map[string]interface{})
+	c.Check(s3["bucket"], Equals, "repo")
+	c.Check(s3["awsAccessKeyID"], Equals, "id")
+	c.Check(s3["awsSecretAccessKey"], Equals, RedactedValue)
+	c.Check(s3["awsSessionToken"], Equals, "")
+
+	acl := result["serveAccessControl"].(map[string]interface{})["."].(map[string]interface{})
+	c.Check(acl["users"], DeepEquals, map[string]interface{}{"admin": RedactedValue})
+	c.Check(acl["tokens"], DeepEquals, []interface{}{RedactedValue})
+
+	webhook := result["contexts"].(map[string]interface{})["staging"].(map[string]interface{})["webhooks"].(map[string]interface{})["ci"].(map[string]interface{})
+	c.Check(webhook["secret"], Equals, RedactedValue)
+	c.Check(webhook["action"], Equals, "mirror-update")
+
+	// original configuration is not modified
+	c.Check(config.S3PublishRoots["test"].SecretAccessKey, Equals, "secret")
+}
+
+func (s *ConfigUpdateSuite) TestValidateRuntimeSettings(c *C) {
+	config := defaultConfig()
+
+	c.Check(ValidateRuntimeSettings(&config, map[string]json.RawMessage{
+		"downloadSpeedLimit": json.RawMessage(`500`), "skipBz2Publishing": json.RawMessage(`true`)}), IsNil)
+	c.Check(config.DownloadLimit, Equals, int64(500))
+	c.Check(config.SkipBz2Publishing, Equals, true)
+
+	c.Check(ValidateRuntimeSettings(&config, map[string]json.RawMessage{}), ErrorMatches, "no settings to update")
+	c.Check(ValidateRuntimeSettings(&config, map[string]json.RawMessage{"rootDir": json.RawMessage(`"/tmp"`)}),
+		ErrorMatches, "setting rootDir could not be changed at runtime")
+	c.Check(ValidateRuntimeSettings(&config, map[string]json.RawMessage{"downloadRetries": json.RawMessage(`"5"`)}),
+		ErrorMatches, "invalid settings: .*")
+	c.Check(ValidateRuntimeSettings(&config, map[string]json.RawMessage{"downloadConcurrency": json.RawMessage(`0`)}),
+		ErrorMatches, "downloadConcurrency should be positive")
+}
+
+// secretNameRegexp matches JSON keys of settings which look like secrets
+var secretNameRegexp = regexp.MustCompile(`(?i)(password|secret|token|tokens|secretAccessKey|accountKey|applicationKey)$`)
+
+// fillConfigValue sets every string in value to unique string, marking strings in secret settings
+func fillConfigValue(c *C, value reflect.Value, path string, secret bool, counter *int) {
+	switch value.Kind() {
+	case reflect.String:
+		*counter++
+		if secret {
+			value.SetString(fmt.Sprintf("secret-value-%d", *counter))
+		} else {
+			value.SetString(fmt.Sprintf("plain-value-%d", *counter))
+		}
+	case reflect.Ptr:
+		value.Set(reflect.New(value.Type().Elem()))
+		fillConfigValue(c, value.Elem(), path, secret, counter)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if secretNameRegexp.MatchString(name) {
+				c.Check(isSecretField(field), Equals, true, Commentf("%s.%s should be tagged as secret", path, name))
+			}
+
+			fillConfigValue(c, value.Field(i), path+"."+name, secret || isSecretField(field), counter)
+		}
+	case reflect.Map:
+		if value.Type() == configOverlaysType || value.Type().Key().Kind() != reflect.String {
+			return
+		}
+		item := reflect.New(value.Type().Elem()).Elem()
+		fillConfigValue(c, item, path+"[]", secret, counter)
+		value.Set(reflect.MakeMap(value.Type()))
+		value.SetMapIndex(reflect.ValueOf("key").Convert(value.Type().Key()), item)
+	case reflect.Slice:
+		item := reflect.New(value.Type().Elem()).Elem()
+		fillConfigValue(c, item, path+"[]", secret, counter)
+		value.Set(reflect.Append(reflect.MakeSlice(value.Type(), 0, 1), item))
+	}
+}
+
+func (s *ConfigUpdateSuite) TestRedactedAllSecrets(c *C) {
+	var config ConfigStructure
+	counter := 0
+	fillConfigValue(c, reflect.ValueOf(&config).Elem(), "config", false, &counter)
+
+	plain, err := json.Marshal(config)
+	c.Assert(err, IsNil)
+	c.Assert(string(plain), Matches, ".*secret-value-.*")
+
+	// same settings in context
+	config.Contexts = map[string]json.RawMessage{"staging": plain}
+
+	result, err := config.Redacted()
+	c.Assert(err, IsNil)
+
+	encoded, err := json.Marshal(result)
+	c.Assert(err, IsNil)
+	c.Check(string(encoded), Not(Matches), ".*secret-value-.*")
+	c.Check(string(encoded), Matches, ".*plain-value-.*")
+
+	c.Check(result["tenancy"].(map[string]interface{})["adminTokens"], DeepEquals, []interface{}{RedactedValue})
+	c.Check(result["notifiers"].(map[string]interface{})["key"].(map[string]interface{})["smtpPassword"], Equals, RedactedValue)
+	c.Check(result["replication"].(map[string]interface{})["primaryToken"], Equals, RedactedValue)
+	c.Check(result["signing"].(map[string]interface{})["vault"].(map[string]interface{})["token"], Equals, RedactedValue)
+}
+
+func (s *ConfigUpdateSuite) TestUpdateConfigFile(c *C) {
+	configname := filepath.Join(c.MkDir(), "aptly.conf")
+	c.Assert(os.WriteFile(configname, []byte(`{"rootDir": "${APTLY_ROOT}", "downloadRetries": 1,
+		"contexts": {"staging": {"rootDir": "/srv/staging"}}}`), 0600), IsNil)
+
+	c.Assert(UpdateConfigFile(configname, "", map[string]json.RawMessage{"downloadRetries": json.RawMessage(`3`)}), IsNil)
+	c.Assert(UpdateConfigFile(configname, "staging", map[string]json.RawMessage{"skipBz2Publishing": json.RawMessage(`true`)}), IsNil)
+
+	contents, err := os.ReadFile(configname)
+	c.Assert(err, IsNil)
+
+	var raw map[string]interface{}
+	c.Assert(json.Unmarshal(contents, &raw), IsNil)
+	c.Check(raw, DeepEquals, map[string]interface{}{
+		"rootDir":         "${APTLY_ROOT}",
+		"downloadRetries": float64(3),
+		"contexts": map[string]interface{}{
+			"staging": map[string]interface{}{"rootDir": "/srv/staging", "skipBz2Publishing": true},
+		},
+	})
+
+	info, err := os.Stat(configname)
+	c.Assert(err, IsNil)
+	c.Check(info.Mode().Perm(), Equals, os.FileMode(0600))
+
+	files, _ := filepath.Glob(configname + "*")
+	c.Check(files, HasLen, 1)
+
+	c.Check(UpdateConfigFile(configname, "production", map[string]json.RawMessage{"downloadRetries": json.RawMessage(`3`)}),
+		ErrorMatches, "context production not found in config file .*")
+}
+
+func (s *ConfigUpdateSuite) TestUpdateConfigFileInPlace(c *C) {
+	configname := filepath.Join(c.MkDir(), "aptly.conf")
+	c.Assert(os.WriteFile(configname, []byte(`{
+    "rootDir": "/srv/aptly",
+    "downloadRetries": 1,
+    "contexts": {
+        "staging": {"rootDir": "/srv/staging"},
+        "empty": {}
+    }
+}
+`), 0644), IsNil)
+
+	c.Assert(UpdateConfigFile(configname, "", map[string]json.RawMessage{
+		"downloadRetries": json.RawMessage(`3`), "downloadSpeedLimit": json.RawMessage(` 1024 `)}), IsNil)
+	c.Assert(UpdateConfigFile(configname, "staging", map[string]json.RawMessage{"skipBz2Publishing": json.RawMessage(`true`)}), IsNil)
+	c.Assert(UpdateConfigFile(configname, "empty", map[string]json.RawMessage{"downloadRetries": json.RawMessage(`5`)}), IsNil)
+
+	contents, err := os.ReadFile(configname)
+	c.Assert(err, IsNil)
+	c.Check(string(contents), Equals, `{
+    "rootDir": "/srv/aptly",
+    "downloadRetries": 3,
+    "contexts": {
+        "staging": {"rootDir": "/srv/staging", "skipBz2Publishing": true},
+        "empty": {"downloadRetries": 5}
+    },
+    "downloadSpeedLimit": 1024
+}
+`)
+}
+
+func (s *ConfigUpdateSuite) TestUpdateConfigFileFragments(c *C) {
+	configname := filepath.Join(c.MkDir(), "aptly.conf")
+	c.Assert(os.WriteFile(configname, []byte(`{"downloadRetries": 1, "contexts": {"staging": {}, "production": {}}}`), 0644), IsNil)
+	c.Assert(os.Mkdir(configname+".d", 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(configname+".d", "10-download.conf"),
+		[]byte(`{"downloadRetries": 5, "contexts": {"staging": {"downloadRetries": 2}}}`), 0644), IsNil)
+
+	c.Check(UpdateConfigFile(configname, "", map[string]json.RawMessage{"downloadRetries": json.RawMessage(`3`)}),
+		ErrorMatches, "setting downloadRetries is defined in config fragment .*10-download.conf")
+	c.Check(UpdateConfigFile(configname, "staging", map[string]json.RawMessage{"downloadRetries": json.RawMessage(`3`)}),
+		ErrorMatches, "context staging is defined in config fragment .*10-download.conf")
+
+	c.Assert(UpdateConfigFile(configname, "", map[string]json.RawMessage{"skipBz2Publishing": json.RawMessage(`true`)}), IsNil)
+	c.Assert(UpdateConfigFile(configname, "production", map[string]json.RawMessage{"downloadRetries": json.RawMessage(`3`)}), IsNil)
+
+	contents, err := os.ReadFile(configname)
+	c.Assert(err, IsNil)
+	c.Check(string(contents), Equals, `{"downloadRetries": 1, "contexts": {"staging": {}, "production": {"downloadRetries": 3}}, "skipBz2Publishing": true}`)
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type CronSuite struct{}
+
+var _ = Suite(&CronSuite{})
+
+func (s *CronSuite) next(c *C, expr string, t string) string {
+	schedule, err := ParseCron(expr)
+	c.Assert(err, IsNil)
+
+	start, err := time.Parse("2006-01-02 15:04", t)
+	c.Assert(err, IsNil)
+
+	next := schedule.Next(start)
+	if next.IsZero() {
+		return ""
+	}
+	return next.Format("2006-01-02 15:04 Mon")
+}
+
+func (s *CronSuite) TestNext(c *C) {
+	c.Check(s.next(c, "* * * * *", "2024-03-01 10:15"), Equals, "2024-03-01 10:16 Fri")
+	c.Check(s.next(c, "*/15 * * * *", "2024-03-01 10:15"), Equals, "2024-03-01 10:30 Fri")
+	c.Check(s.next(c, "30 3 * * *", "2024-03-01 10:15"), Equals, "2024-03-02 03:30 Sat")
+	c.Check(s.next(c, "@daily", "2024-12-31 10:15"), Equals, "2025-01-01 00:00 Wed")
+	c.Check(s.next(c, "@hourly", "2024-03-01 10:15"), Equals, "2024-03-01 11:00 Fri")
+	c.Check(s.next(c, "0 6 * * 1-5", "2024-03-01 10:15"), Equals, "2024-03-04 06:00 Mon")
+	c.Check(s.next(c, "0 0 * * 7", "2024-03-01 10:15"), Equals, "2024-03-03 00:00 Sun")
+	c.Check(s.next(c, "0 12 29 2 *", "2024-03-01 10:15"), Equals, "2028-02-29 12:00 Tue")
+	c.Check(s.next(c, "5/20 1,13 * * *", "2024-03-01 10:15"), Equals, "2024-03-01 13:05 Fri")
+
+	// either day of month or day of week
+	c.Check(s.next(c, "0 0 15 * 1", "2024-03-01 10:15"), Equals, "2024-03-04 00:00 Mon")
+	c.Check(s.next(c, "0 0 2 * 1", "2024-03-01 10:15"), Equals, "2024-03-02 00:00 Sat")
+
+	c.Check(s.next(c, "0 0 30 2 *", "2024-03-01 10:15"), Equals, "")
+}
+
+func (s *CronSuite) TestParseErrors(c *C) {
+	_, err := ParseCron("* * * *")
+	c.Check(err, ErrorMatches, ".*should have 5 fields.*")
+
+	_, err = ParseCron("60 * * * *")
+	c.Check(err, ErrorMatches, ".*\"60\" is out of range 0-59")
+
+	_, err = ParseCron("*/0 * * * *")
+	c.Check(err, ErrorMatches, ".*invalid step in \"\\*/0\"")
+
+	_, err = ParseCron("0 5-2 * * *")
+	c.Check(err, ErrorMatches, ".*\"5-2\" is out of range 0-23")
+
+	_, err = ParseCron("0 0 * JAN *")
+	c.Check(err, ErrorMatches, ".*invalid value in \"JAN\"")
+}
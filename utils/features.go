@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Feature is experimental feature, which could be enabled or disabled
+// with feature flag in configuration
+type Feature struct {
+	// Description of the feature
+	Description string
+	// Default state if not set in configuration
+	Default bool
+}
+
+// Experimental features
+const (
+	FeatureB2Publishing = "b2Publishing"
+)
+
+// KnownFeatures is registry of experimental features, keyed by name of feature flag
+var KnownFeatures = map[string]Feature{
+	FeatureB2Publishing: {Description: "publishing to Backblaze B2 via native API"},
+}
+
+// FeatureEnabled checks whether experimental feature is enabled
+func (conf *ConfigStructure) FeatureEnabled(name string) bool {
+	if enabled, ok := conf.Features[name]; ok {
+		return enabled
+	}
+
+	return KnownFeatures[name].Default
+}
+
+// EnabledFeatures returns state of all known experimental features
+func (conf *ConfigStructure) EnabledFeatures() map[string]bool {
+	result := map[string]bool{}
+
+	for name := range KnownFeatures {
+		result[name] = conf.FeatureEnabled(name)
+	}
+
+	return result
+}
+
+// ValidateFeatures checks that only known feature flags are set
+func (conf *ConfigStructure) ValidateFeatures() error {
+	unknown := []string{}
+
+	for name := range conf.Features {
+		if _, ok := KnownFeatures[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown feature flags: %v", unknown)
+	}
+
+	return nil
+}
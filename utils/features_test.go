@@ -0,0 +1,29 @@
+package utils
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type FeaturesSuite struct{}
+
+var _ = Suite(&FeaturesSuite{})
+
+func (s *FeaturesSuite) TestFeatureEnabled(c *C) {
+	config := defaultConfig()
+
+	c.Check(config.FeatureEnabled(FeatureB2Publishing), Equals, false)
+	c.Check(config.FeatureEnabled("missing"), Equals, false)
+	c.Check(config.EnabledFeatures(), DeepEquals, map[string]bool{FeatureB2Publishing: false})
+
+	config.Features = map[string]bool{FeatureB2Publishing: true}
+	c.Check(config.FeatureEnabled(FeatureB2Publishing), Equals, true)
+	c.Check(config.EnabledFeatures(), DeepEquals, map[string]bool{FeatureB2Publishing: true})
+}
+
+func (s *FeaturesSuite) TestValidateFeatures(c *C) {
+	config := defaultConfig()
+	c.Check(config.ValidateFeatures(), IsNil)
+
+	config.Features = map[string]bool{FeatureB2Publishing: true, "zstdIndexes": true, "b2Publish": false}
+	c.Check(config.ValidateFeatures(), ErrorMatches, `unknown feature flags: \[b2Publish zstdIndexes\]`)
+}
@@ -0,0 +1,35 @@
+package utils
+
+import "fmt"
+
+// IncomingConfig configures review queue of uploaded .changes files
+type IncomingConfig struct {
+	// Checks run for every .changes file put into the queue
+	Checks []IncomingCheck `json:"checks,omitempty"`
+}
+
+// IncomingCheck is external command (e.g. lintian) run for .changes file in the review queue
+//
+// Path to .changes file is appended to the command, which is run in the directory with
+// files of the upload. Check passes if command exits with zero status.
+type IncomingCheck struct {
+	// Name of the check, as reported in the queue
+	Name string `json:"name"`
+	// Command with arguments
+	Command []string `json:"command"`
+	// Timeout in seconds, no timeout if zero
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// Validate checks incoming check configuration
+func (check *IncomingCheck) Validate() error {
+	if check.Name == "" {
+		return fmt.Errorf("incoming check name is not configured")
+	}
+
+	if len(check.Command) == 0 {
+		return fmt.Errorf("command is not configured for incoming check %s", check.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package utils
+
+import "fmt"
+
+// Notification events
+const (
+	NotifyEventTaskFailed         = "task-failed"
+	NotifyEventTaskSucceeded      = "task-succeeded"
+	NotifyEventMirrorUpdateFailed = "mirror-update-failed"
+	NotifyEventMirrorSecurity     = "mirror-security-updates"
+	NotifyEventPublishComplete    = "publish-complete"
+	NotifyEventReplicationLag     = "replication-lag"
+	NotifyEventPublishCreated     = "publish-created"
+	NotifyEventPublishUpdated     = "publish-updated"
+	NotifyEventPublishDropped     = "publish-dropped"
+	NotifyEventMirrorUpdated      = "mirror-updated"
+	NotifyEventSnapshotCreated    = "snapshot-created"
+	NotifyEventPackagesUploaded   = "packages-uploaded"
+)
+
+// Severities of notification events
+const (
+	NotifySeverityInfo    = "info"
+	NotifySeverityWarning = "warning"
+	NotifySeverityError   = "error"
+)
+
+var notifySeverityLevels = map[string]int{
+	NotifySeverityInfo:    0,
+	NotifySeverityWarning: 1,
+	NotifySeverityError:   2,
+}
+
+// Notifier describes destination of notifications about task outcomes and other events
+type Notifier struct {
+	// Type of notifier: email, slack, mattermost, webhook or exec
+	Type string `json:"type"`
+	// Events to notify about, all events if empty
+	Events []string `json:"events,omitempty"`
+	// Minimal severity of events to notify about: info, warning or error
+	MinSeverity string `json:"minSeverity,omitempty"`
+	// Incoming webhook URL (slack, mattermost), URL event is posted to (webhook)
+	URL string `json:"url,omitempty" secret:"true"`
+	// Channel to post to instead of the default one of webhook (slack, mattermost)
+	Channel string `json:"channel,omitempty"`
+	// SMTP server as host:port (email)
+	SMTPServer string `json:"smtpServer,omitempty"`
+	// SMTP credentials, no authentication if empty (email)
+	SMTPUser     string `json:"smtpUser,omitempty"`
+	SMTPPassword string `json:"smtpPassword,omitempty" secret:"true"`
+	// Sender and recipients (email)
+	From string   `json:"from,omitempty"`
+	To   []string `json:"to,omitempty"`
+	// Command with arguments, event is passed as JSON on stdin and in APTLY_EVENT_* environment variables (exec)
+	Command []string `json:"command,omitempty"`
+	// Secret to sign request body with HMAC-SHA256, passed in X-Hub-Signature-256 header (webhook)
+	Secret string `json:"secret,omitempty" secret:"true"`
+	// Additional request headers (webhook)
+	Headers map[string]string `json:"headers,omitempty" secret:"true"`
+	// Number of retries of failed requests, 3 by default (webhook)
+	Retries int `json:"retries,omitempty"`
+	// Delay before first retry in seconds, doubled for every next retry, 1 by default (webhook)
+	RetryDelay int `json:"retryDelay,omitempty"`
+}
+
+// Validate checks notifier configuration
+func (n *Notifier) Validate() error {
+	switch n.Type {
+	case "slack", "mattermost", "webhook":
+		if n.URL == "" {
+			return fmt.Errorf("url is required for %s notifier", n.Type)
+		}
+	case "email":
+		if n.SMTPServer == "" || n.From == "" || len(n.To) == 0 {
+			return fmt.Errorf("smtpServer, from and to are required for email notifier")
+		}
+	case "exec":
+		if len(n.Command) == 0 {
+			return fmt.Errorf("command is required for exec notifier")
+		}
+	default:
+		return fmt.Errorf("unknown notifier type %#v", n.Type)
+	}
+
+	if n.MinSeverity != "" {
+		if _, ok := notifySeverityLevels[n.MinSeverity]; !ok {
+			return fmt.Errorf("unknown severity %#v", n.MinSeverity)
+		}
+	}
+
+	return nil
+}
+
+// Matches checks whether notifier is interested in event of specified type and severity
+func (n *Notifier) Matches(event, severity string) bool {
+	if n.MinSeverity != "" && notifySeverityLevel(severity) < notifySeverityLevel(n.MinSeverity) {
+		return false
+	}
+
+	if len(n.Events) == 0 {
+		return true
+	}
+
+	for _, e := range n.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+func notifySeverityLevel(severity string) int {
+	level, ok := notifySeverityLevels[severity]
+	if !ok {
+		return -1
+	}
+
+	return level
+}
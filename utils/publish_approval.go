@@ -0,0 +1,27 @@
+package utils
+
+import "net/http"
+
+// PublishApprovalConfig configures two-phase publishing via API: updates of published
+// repositories are held until approved by another user
+type PublishApprovalConfig struct {
+	// Require approval for updates of published repositories
+	Enabled bool `json:"enabled"`
+	// Users allowed to request and approve updates with basic auth: user name -> password or bcrypt hash of password
+	Users map[string]string `json:"users,omitempty" secret:"true"`
+}
+
+// Principal returns name of the user authenticated by request, or empty string
+// if request is not authenticated as one of configured users
+func (conf *PublishApprovalConfig) Principal(r *http.Request) string {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return ""
+	}
+
+	if secret, exists := conf.Users[user]; exists && secretMatches(secret, password) {
+		return user
+	}
+
+	return ""
+}
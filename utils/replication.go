@@ -0,0 +1,49 @@
+package utils
+
+import "fmt"
+
+// Replication roles
+const (
+	ReplicationRolePrimary = "primary"
+	ReplicationRoleReplica = "replica"
+)
+
+// ReplicationConfig configures primary/replica replication of aptly instances
+type ReplicationConfig struct {
+	// Role of this instance: primary, replica or empty if replication is disabled
+	Role string `json:"role,omitempty"`
+	// Number of changes kept in the journal for replicas (primary)
+	JournalSize int `json:"journalSize,omitempty"`
+	// Base URL of primary aptly API (replica)
+	PrimaryURL string `json:"primaryURL,omitempty"`
+	// Token to authenticate to primary (replica)
+	PrimaryToken string `json:"primaryToken,omitempty" secret:"true"`
+	// Interval between syncs in seconds, 30 if not set (replica)
+	Interval int `json:"interval,omitempty"`
+	// Notify if replica is not in sync with primary for longer, in seconds, 0 disables (replica)
+	LagAlert int `json:"lagAlert,omitempty"`
+	// Publish repositories published on primary to local published storages (replica)
+	Publish bool `json:"publish,omitempty"`
+	// GPG key to sign repositories published locally (replica)
+	GpgKey string `json:"gpgKey,omitempty"`
+}
+
+// Validate checks replication configuration
+func (r *ReplicationConfig) Validate() error {
+	switch r.Role {
+	case "", ReplicationRolePrimary:
+	case ReplicationRoleReplica:
+		if r.PrimaryURL == "" {
+			return fmt.Errorf("primaryURL is required for replica")
+		}
+	default:
+		return fmt.Errorf("unknown replication role %#v", r.Role)
+	}
+
+	return nil
+}
+
+// IsReplica checks whether this instance is read-only replica
+func (r *ReplicationConfig) IsReplica() bool {
+	return r.Role == ReplicationRoleReplica
+}
@@ -0,0 +1,51 @@
+package utils
+
+// Signing backends
+const (
+	SigningBackendGpg         = "gpg"
+	SigningBackendVault       = "vault"
+	SigningBackendAWSKMS      = "awskms"
+	SigningBackendExternalCmd = "external-cmd"
+)
+
+// SigningConfig configures signing backends, so that Release files could be signed without
+// private key stored on aptly host
+type SigningConfig struct {
+	// Backend used if not specified with signing options, "gpg" (local GnuPG or internal
+	// provider, as set by gpgProvider) if not set
+	Backend string `json:"backend,omitempty"`
+	// HashiCorp Vault transit engine
+	Vault VaultSigningConfig `json:"vault"`
+	// AWS KMS
+	AWSKMS AWSKMSSigningConfig `json:"awsKms"`
+	// Command (with arguments) for external-cmd backend
+	ExternalCommand []string `json:"externalCommand,omitempty"`
+}
+
+// VaultSigningConfig configures signing with Vault transit engine
+type VaultSigningConfig struct {
+	// Vault address, VAULT_ADDR if not set
+	Address string `json:"address,omitempty"`
+	// Vault token, VAULT_TOKEN if not set
+	Token string `json:"token,omitempty" secret:"true"`
+	// File with Vault token (e.g. written by Vault agent)
+	TokenFile string `json:"tokenFile,omitempty"`
+	// Transit engine mount path, "transit" if not set
+	Mount string `json:"mount,omitempty"`
+	// Default transit key name
+	Key string `json:"key,omitempty"`
+	// Keyring with OpenPGP public key matching transit key
+	Keyring string `json:"keyring,omitempty"`
+}
+
+// AWSKMSSigningConfig configures signing with AWS KMS
+type AWSKMSSigningConfig struct {
+	// AWS region, default AWS configuration is used if not set
+	Region string `json:"region,omitempty"`
+	// KMS endpoint override
+	Endpoint string `json:"endpoint,omitempty"`
+	// Default key ID, ARN or alias
+	Key string `json:"key,omitempty"`
+	// Keyring with OpenPGP public key matching KMS key
+	Keyring string `json:"keyring,omitempty"`
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"fmt"
+)
+
+// ResourceTemplate is a named set of default settings used when creating mirrors,
+// local repos and published repositories
+//
+// Settings specified explicitly on creation take precedence over the template.
+type ResourceTemplate struct {
+	// Architectures of mirrors and published repositories
+	Architectures []string `json:"architectures,omitempty"`
+
+	// Mirror settings
+	Filter         string   `json:"filter,omitempty"`
+	FilterWithDeps *bool    `json:"filterWithDeps,omitempty"`
+	WithSources    *bool    `json:"withSources,omitempty"`
+	WithUdebs      *bool    `json:"withUdebs,omitempty"`
+	VerifyKeyrings []string `json:"verifyKeyrings,omitempty"`
+
+	// Local repo settings
+	Distribution  string `json:"distribution,omitempty"`
+	Component     string `json:"component,omitempty"`
+	VersionPolicy string `json:"versionPolicy,omitempty"`
+
+	// Published repository settings
+	Origin        string `json:"origin,omitempty"`
+	Label         string `json:"label,omitempty"`
+	SkipContents  *bool  `json:"skipContents,omitempty"`
+	SkipBz2       *bool  `json:"skipBz2,omitempty"`
+	EnableZst     *bool  `json:"enableZst,omitempty"`
+	AcquireByHash *bool  `json:"acquireByHash,omitempty"`
+	MultiDist     *bool  `json:"multiDist,omitempty"`
+
+	// Signing settings of published repositories
+	SkipSigning    *bool  `json:"skipSigning,omitempty"`
+	GpgKey         string `json:"gpgKey,omitempty"`
+	Keyring        string `json:"keyring,omitempty"`
+	SecretKeyring  string `json:"secretKeyring,omitempty"`
+	PassphraseFile string `json:"passphraseFile,omitempty"`
+}
+
+// GetTemplate returns resource template by name
+func (conf *ConfigStructure) GetTemplate(name string) (*ResourceTemplate, error) {
+	template, ok := conf.Templates[name]
+	if !ok {
+		return nil, fmt.Errorf("template %s not found in configuration", name)
+	}
+
+	return &template, nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TenantConfig configures namespace of one tenant
+type TenantConfig struct {
+	// Default GPG key to sign repositories published under tenant prefix
+	GpgKey string `json:"gpgKey,omitempty"`
+	// Limit of total size of package files in tenant repositories, mirrors and snapshots, in bytes (0 - unlimited)
+	Quota int64 `json:"quota,omitempty"`
+	// Access tokens, either as bearer token or as basic auth password (with any user name)
+	Tokens []string `json:"tokens,omitempty" secret:"true"`
+}
+
+// TenancyConfig configures multi-tenant API: repositories, mirrors, snapshots and published
+// prefixes belong to namespace of tenant if their names start with "<tenant>/"
+type TenancyConfig struct {
+	// Require authentication for API and restrict tenants to their namespaces
+	Enabled bool `json:"enabled"`
+	// Tokens with unrestricted access to API
+	AdminTokens []string `json:"adminTokens,omitempty" secret:"true"`
+	// Tenants, keyed by name of namespace
+	Tenants map[string]TenantConfig `json:"tenants,omitempty"`
+}
+
+// InNamespace checks whether name (of repository, mirror, snapshot, upload directory or published
+// prefix) belongs to namespace
+func InNamespace(namespace, name string) bool {
+	return name == namespace || strings.HasPrefix(name, namespace+"/")
+}
+
+// Namespace returns name of tenant owning resource, or empty string if resource
+// is not in namespace of any tenant
+func (conf *TenancyConfig) Namespace(name string) string {
+	namespace, _, found := strings.Cut(name, "/")
+	if !found {
+		namespace = name
+	}
+
+	if _, exists := conf.Tenants[namespace]; exists {
+		return namespace
+	}
+
+	return ""
+}
+
+// TenantNames returns sorted list of tenants
+func (conf *TenancyConfig) TenantNames() []string {
+	result := make([]string, 0, len(conf.Tenants))
+	for name := range conf.Tenants {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// Authenticate finds out who made request: admin, one of tenants or nobody (if
+// both admin is false and tenant is empty)
+func (conf *TenancyConfig) Authenticate(r *http.Request) (tenant string, admin bool) {
+	for _, candidate := range RequestTokens(r) {
+		for _, token := range conf.AdminTokens {
+			if secretMatches(token, candidate) {
+				return "", true
+			}
+		}
+
+		for _, name := range conf.TenantNames() {
+			for _, token := range conf.Tenants[name].Tokens {
+				if secretMatches(token, candidate) {
+					return name, false
+				}
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type TenancySuite struct {
+	conf TenancyConfig
+}
+
+var _ = Suite(&TenancySuite{})
+
+func (s *TenancySuite) SetUpTest(c *C) {
+	s.conf = TenancyConfig{
+		Enabled:     true,
+		AdminTokens: []string{"root"},
+		Tenants: map[string]TenantConfig{
+			"team-a": {Tokens: []string{"a-token"}},
+			"team-b": {Tokens: []string{"b-token"}},
+		},
+	}
+}
+
+func (s *TenancySuite) TestInNamespace(c *C) {
+	c.Check(InNamespace("team-a", "team-a"), Equals, true)
+	c.Check(InNamespace("team-a", "team-a/stable"), Equals, true)
+	c.Check(InNamespace("team-a", "team-ab/stable"), Equals, false)
+	c.Check(InNamespace("team-a", "stable"), Equals, false)
+}
+
+func (s *TenancySuite) TestNamespace(c *C) {
+	c.Check(s.conf.Namespace("team-a/stable"), Equals, "team-a")
+	c.Check(s.conf.Namespace("team-b"), Equals, "team-b")
+	c.Check(s.conf.Namespace("team-c/stable"), Equals, "")
+	c.Check(s.conf.Namespace("stable"), Equals, "")
+}
+
+func (s *TenancySuite) TestAuthenticate(c *C) {
+	r := httptest.NewRequest("GET", "/api/repos", nil)
+	tenant, admin := s.conf.Authenticate(r)
+	c.Check(tenant, Equals, "")
+	c.Check(admin, Equals, false)
+
+	r.Header.Set("Authorization", "Bearer root")
+	tenant, admin = s.conf.Authenticate(r)
+	c.Check(tenant, Equals, "")
+	c.Check(admin, Equals, true)
+
+	r = httptest.NewRequest("GET", "/api/repos", nil)
+	r.SetBasicAuth("ci", "b-token")
+	tenant, admin = s.conf.Authenticate(r)
+	c.Check(tenant, Equals, "team-b")
+	c.Check(admin, Equals, false)
+
+	r.SetBasicAuth("ci", "wrong")
+	tenant, admin = s.conf.Authenticate(r)
+	c.Check(tenant, Equals, "")
+	c.Check(admin, Equals, false)
+}
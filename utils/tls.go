@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertificateReloader serves TLS certificate loaded from files, reloading
+// it whenever certificate or key file is modified (e.g. rotated by certbot)
+type CertificateReloader struct {
+	sync.Mutex
+
+	certFile, keyFile string
+
+	certificate       *tls.Certificate
+	certMod, keyMod   time.Time
+	lastCheck         time.Time
+	checkInterval     time.Duration
+	reloadErrorLogger func(err error)
+}
+
+// NewCertificateReloader loads certificate and key from files
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		checkInterval: 10 * time.Second,
+		reloadErrorLogger: func(err error) {
+			fmt.Fprintf(os.Stderr, "Unable to reload TLS certificate: %s\n", err)
+		},
+	}
+
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func modTime(filename string) (time.Time, error) {
+	st, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return st.ModTime(), nil
+}
+
+func (reloader *CertificateReloader) reload() error {
+	certMod, err := modTime(reloader.certFile)
+	if err != nil {
+		return err
+	}
+
+	keyMod, err := modTime(reloader.keyFile)
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load TLS certificate: %s", err)
+	}
+
+	reloader.certificate = &certificate
+	reloader.certMod, reloader.keyMod = certMod, keyMod
+
+	return nil
+}
+
+// GetCertificate returns current certificate, it could be used as tls.Config.GetCertificate
+//
+// Files are checked for modifications at most once in check interval. If new certificate
+// fails to load, previous certificate is kept.
+func (reloader *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.Lock()
+	defer reloader.Unlock()
+
+	if time.Since(reloader.lastCheck) >= reloader.checkInterval {
+		reloader.lastCheck = time.Now()
+
+		certMod, err1 := modTime(reloader.certFile)
+		keyMod, err2 := modTime(reloader.keyFile)
+
+		if err1 == nil && err2 == nil && (!certMod.Equal(reloader.certMod) || !keyMod.Equal(reloader.keyMod)) {
+			if err := reloader.reload(); err != nil {
+				reloader.reloadErrorLogger(err)
+			}
+		}
+	}
+
+	return reloader.certificate, nil
+}
+
+// TLSConfig returns TLS server configuration using reloaded certificate
+func (reloader *CertificateReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+}
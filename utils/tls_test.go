@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type TLSSuite struct {
+	certFile, keyFile string
+}
+
+var _ = Suite(&TLSSuite{})
+
+func (s *TLSSuite) SetUpTest(c *C) {
+	dir := c.MkDir()
+	s.certFile = filepath.Join(dir, "cert.pem")
+	s.keyFile = filepath.Join(dir, "key.pem")
+}
+
+func (s *TLSSuite) writeCertificate(c *C, commonName string, mtime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+
+	c.Assert(os.WriteFile(s.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600), IsNil)
+	c.Assert(os.WriteFile(s.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600), IsNil)
+	c.Assert(os.Chtimes(s.certFile, mtime, mtime), IsNil)
+	c.Assert(os.Chtimes(s.keyFile, mtime, mtime), IsNil)
+}
+
+func commonName(c *C, reloader *CertificateReloader) string {
+	certificate, err := reloader.GetCertificate(nil)
+	c.Assert(err, IsNil)
+
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	c.Assert(err, IsNil)
+
+	return parsed.Subject.CommonName
+}
+
+func (s *TLSSuite) TestReload(c *C) {
+	_, err := NewCertificateReloader(s.certFile, s.keyFile)
+	c.Check(err, NotNil)
+
+	s.writeCertificate(c, "first", time.Now().Add(-time.Minute))
+
+	reloader, err := NewCertificateReloader(s.certFile, s.keyFile)
+	c.Assert(err, IsNil)
+	reloader.checkInterval = 0
+	c.Check(commonName(c, reloader), Equals, "first")
+
+	s.writeCertificate(c, "second", time.Now())
+	c.Check(commonName(c, reloader), Equals, "second")
+
+	// broken certificate keeps previous one
+	var reloadErr error
+	reloader.reloadErrorLogger = func(err error) { reloadErr = err }
+	c.Assert(os.WriteFile(s.certFile, []byte("garbage"), 0600), IsNil)
+	c.Assert(os.Chtimes(s.certFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)), IsNil)
+	c.Check(commonName(c, reloader), Equals, "second")
+	c.Check(reloadErr, NotNil)
+}
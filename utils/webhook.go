@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Webhook actions
+const (
+	WebhookActionMirrorUpdate  = "mirror-update"
+	WebhookActionPublishUpdate = "publish-update"
+)
+
+// Webhook is inbound webhook which triggers aptly action
+type Webhook struct {
+	// Shared secret: either sent as is in X-Aptly-Token (or X-Gitlab-Token) header,
+	// or used as HMAC-SHA256 key for request body signature in X-Hub-Signature-256 header
+	Secret string `json:"secret" secret:"true"`
+	// Action to run: mirror-update or publish-update
+	Action string `json:"action"`
+	// Mirror to update for mirror-update
+	Mirror string `json:"mirror,omitempty"`
+	// Published repository to update for publish-update, prefix might include storage
+	Prefix       string `json:"prefix,omitempty"`
+	Distribution string `json:"distribution,omitempty"`
+}
+
+// Validate checks webhook configuration
+func (w *Webhook) Validate() error {
+	if w.Secret == "" {
+		return fmt.Errorf("webhook secret is not configured")
+	}
+
+	switch w.Action {
+	case WebhookActionMirrorUpdate:
+		if w.Mirror == "" {
+			return fmt.Errorf("mirror is required for %s webhook action", w.Action)
+		}
+	case WebhookActionPublishUpdate:
+		if w.Distribution == "" {
+			return fmt.Errorf("distribution is required for %s webhook action", w.Action)
+		}
+	default:
+		return fmt.Errorf("unknown webhook action %#v", w.Action)
+	}
+
+	return nil
+}
+
+// Verify checks that request carries shared secret or valid signature of body
+func (w *Webhook) Verify(r *http.Request, body []byte) bool {
+	if w.Secret == "" {
+		return false
+	}
+
+	if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+		expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+		if err != nil {
+			return false
+		}
+
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+
+		return hmac.Equal(mac.Sum(nil), expected)
+	}
+
+	for _, header := range []string{"X-Aptly-Token", "X-Gitlab-Token"} {
+		if token := r.Header.Get(header); token != "" {
+			return subtle.ConstantTimeCompare([]byte(token), []byte(w.Secret)) == 1
+		}
+	}
+
+	return false
+}
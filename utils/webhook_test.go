@@ -0,0 +1,18 @@
+package utils
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type WebhookSuite struct{}
+
+var _ = Suite(&WebhookSuite{})
+
+func (s *WebhookSuite) TestValidate(c *C) {
+	c.Check((&Webhook{Action: WebhookActionMirrorUpdate, Mirror: "debian"}).Validate(), ErrorMatches, "webhook secret is not configured")
+	c.Check((&Webhook{Secret: "s", Action: WebhookActionMirrorUpdate}).Validate(), ErrorMatches, "mirror is required for mirror-update webhook action")
+	c.Check((&Webhook{Secret: "s", Action: WebhookActionMirrorUpdate, Mirror: "debian"}).Validate(), IsNil)
+	c.Check((&Webhook{Secret: "s", Action: WebhookActionPublishUpdate, Prefix: "ppa"}).Validate(), ErrorMatches, "distribution is required for publish-update webhook action")
+	c.Check((&Webhook{Secret: "s", Action: WebhookActionPublishUpdate, Distribution: "stable"}).Validate(), IsNil)
+	c.Check((&Webhook{Secret: "s", Action: "run"}).Validate(), ErrorMatches, `unknown webhook action "run"`)
+}